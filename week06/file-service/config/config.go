@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type Config struct {
 	Port         int    `yaml:"port"`
 	UploadDir    string `yaml:"upload_dir"`
@@ -7,6 +9,8 @@ type Config struct {
 	LogDir       string `yaml:"log_dir"`
 	DatabasePath string `yaml:"database_path"`
 	MaxFileSize  int64  `yaml:"max_file_size"`
+
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // 退出时等待进行中请求的最长时间
 }
 
 func Load() *Config {
@@ -17,5 +21,7 @@ func Load() *Config {
 		LogDir:       "./logs",      // 日志目录配置
 		DatabasePath: "./file-service.db",
 		MaxFileSize:  5 << 20, // 5MB
+
+		ShutdownTimeout: 15 * time.Second,
 	}
 }
@@ -69,19 +69,29 @@ func (h *FileHandler) Upload(c *gin.Context) {
 	}
 
 	// 3. 初始化事务
+	ctx := c.Request.Context()
 	tx, err := h.db.Beginx()
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, "服务不可用")
 		return
 	}
 
+	// 失败时回滚事务，并删除本次请求已保存的文件
+	var saved []string
+	rollback := func() {
+		tx.Rollback()
+		for _, uuid := range saved {
+			_ = h.fileStore.Delete(uuid)
+		}
+	}
+
 	// 4. 处理上传结果
 	var uploadedFiles []FileListResponse
 	for _, fileHeader := range files {
 		// 4.1 打开文件流
 		file, err := fileHeader.Open()
 		if err != nil {
-			tx.Rollback()
+			rollback()
 			api.Error(c, http.StatusInternalServerError, "文件读取失败")
 			return
 		}
@@ -89,7 +99,7 @@ func (h *FileHandler) Upload(c *gin.Context) {
 
 		// 4.2 验证文件类型
 		if !utils.ValidateFileType(fileHeader) {
-			tx.Rollback()
+			rollback()
 			api.Error(c, http.StatusBadRequest,
 				fmt.Sprintf("禁止的文件类型: %s", filepath.Ext(fileHeader.Filename)))
 			return
@@ -99,11 +109,16 @@ func (h *FileHandler) Upload(c *gin.Context) {
 		uuid := utils.GenerateUUID()
 
 		// 4.4 保存到存储系统
-		if err := h.fileStore.Save(uuid, file); err != nil {
-			tx.Rollback()
+		if err := h.fileStore.Save(ctx, uuid, file); err != nil {
+			rollback()
+			if ctx.Err() != nil {
+				api.Error(c, http.StatusServiceUnavailable, "上传已取消")
+				return
+			}
 			api.Error(c, http.StatusInternalServerError, "文件保存失败")
 			return
 		}
+		saved = append(saved, uuid)
 
 		// 获取文件扩展名
 		ext := filepath.Ext(fileHeader.Filename)
@@ -126,7 +141,7 @@ func (h *FileHandler) Upload(c *gin.Context) {
 			})
 
 		if err != nil {
-			tx.Rollback()
+			rollback()
 			api.Error(c, http.StatusInternalServerError, "数据库写入失败")
 			return
 		}
@@ -145,6 +160,7 @@ func (h *FileHandler) Upload(c *gin.Context) {
 
 	// 5. 提交事务
 	if err := tx.Commit(); err != nil {
+		rollback()
 		api.Error(c, http.StatusInternalServerError, "事务提交失败")
 		return
 	}
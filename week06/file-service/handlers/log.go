@@ -9,10 +9,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// RequestLogger 中间件定义
-func RequestLogger(logDir string) gin.HandlerFunc {
-	dailyLogger := logger.NewDailyLogger(logDir)
-
+// RequestLogger 中间件定义，日志异步写入，退出时由 dailyLogger.Close 等待写完
+func RequestLogger(dailyLogger *logger.DailyLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		// 创建响应记录器
@@ -56,8 +54,6 @@ func RequestLogger(logDir string) gin.HandlerFunc {
 		}
 
 		// 异步写入日志
-		go func() {
-			_ = dailyLogger.Log(logEntry)
-		}()
+		dailyLogger.LogAsync(logEntry)
 	}
 }
@@ -0,0 +1,161 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"fileservice/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 取消根上下文后，继续等待请求收尾（写日志、删除未完成的上传）的最长时间
+const cancelGrace = 5 * time.Second
+
+// Manager 管理服务的启动与优雅退出。文件服务只有HTTP请求需要排空，
+// 因此只保留请求登记与清理函数，不管理后台任务
+//
+// 收到 SIGINT/SIGTERM 后：
+//  1. 停止接收新连接，等待进行中的请求结束（最长 drain）
+//  2. 超时仍未结束时取消根上下文，进行中的上传随之中断并删除不完整的文件
+//  3. 等待请求收尾（最长 cancelGrace）
+//  4. 按注册的逆序执行清理函数：写完请求日志、关闭数据库等
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	drain  time.Duration
+
+	mu       sync.Mutex
+	closing  bool
+	requests sync.WaitGroup // 进行中的HTTP请求
+	hooks    []hook
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// New 创建生命周期管理器，drain 为退出时等待进行中请求的最长时间
+func New(drain time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel, drain: drain}
+}
+
+// OnShutdown 注册退出时执行的清理函数，按注册的逆序执行（先注册的资源最后关闭）
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// Middleware 记录进行中的请求；服务退出期间到达的请求直接返回503
+func (m *Manager) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.enter() {
+			c.Header("Connection", "close")
+			api.Error(c, http.StatusServiceUnavailable, "服务正在关闭，请稍后重试")
+			c.Abort()
+			return
+		}
+		defer m.requests.Done()
+		c.Next()
+	}
+}
+
+// enter 在未开始退出时登记一个请求
+func (m *Manager) enter() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		return false
+	}
+	m.requests.Add(1)
+	return true
+}
+
+// Serve 启动HTTP服务并阻塞，直到收到退出信号或服务异常退出，返回前完成优雅退出。
+// 请求的上下文派生自根上下文，退出超时后随之取消
+func (m *Manager) Serve(srv *http.Server) error {
+	srv.BaseContext = func(net.Listener) context.Context { return m.ctx }
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var serveErr error
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr = err
+		}
+	case sig := <-signals:
+		log.Printf("[LIFECYCLE] 收到信号 %s，开始优雅退出（最长等待 %s）", sig, m.drain)
+	}
+
+	m.shutdown(srv)
+	return serveErr
+}
+
+func (m *Manager) shutdown(srv *http.Server) {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+
+	// 1. 停止接收新连接，等待进行中的请求
+	drainCtx, cancel := context.WithTimeout(context.Background(), m.drain)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		log.Printf("[LIFECYCLE] 等待进行中的请求超时，取消剩余请求: %v", err)
+	}
+
+	// 2. 取消根上下文，中断仍在进行的上传
+	m.cancel()
+
+	// 3. 等待请求收尾
+	if !waitTimeout(&m.requests, cancelGrace) {
+		log.Printf("[LIFECYCLE] 仍有请求未结束，强制关闭连接")
+	}
+	_ = srv.Close()
+
+	// 4. 逆序执行清理函数
+	m.mu.Lock()
+	hooks := m.hooks
+	m.mu.Unlock()
+	hookCtx, hookCancel := context.WithTimeout(context.Background(), m.drain)
+	defer hookCancel()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].fn(hookCtx); err != nil {
+			log.Printf("[LIFECYCLE] %s 失败: %v", hooks[i].name, err)
+		}
+	}
+	log.Printf("[LIFECYCLE] 服务已退出")
+}
+
+// waitTimeout 等待 wg 归零，超时返回 false
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
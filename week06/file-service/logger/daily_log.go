@@ -1,7 +1,9 @@
 package logger
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -15,8 +17,15 @@ type DailyLogger struct {
 	file       *os.File
 	currentDay string
 	logDir     string
+	closed     bool // 文件已关闭，不再写入
+
+	pendingMu sync.Mutex
+	pending   sync.WaitGroup // 尚未写完的异步日志
+	closing   bool           // 不再接收新的异步日志
 }
 
+var ErrLoggerClosed = errors.New("日志已关闭")
+
 func NewDailyLogger(logDir string) *DailyLogger {
 	_ = os.MkdirAll(logDir, 0755)
 	return &DailyLogger{
@@ -47,9 +56,56 @@ func (dl *DailyLogger) getLogFile() (*os.File, error) {
 	return dl.file, nil
 }
 
+// LogAsync 异步写入一条日志，Close 会等待所有异步写入完成
+func (dl *DailyLogger) LogAsync(data map[string]interface{}) {
+	dl.pendingMu.Lock()
+	if dl.closing {
+		dl.pendingMu.Unlock()
+		return
+	}
+	dl.pending.Add(1)
+	dl.pendingMu.Unlock()
+
+	go func() {
+		defer dl.pending.Done()
+		_ = dl.Log(data)
+	}()
+}
+
+// Close 等待未完成的异步写入后关闭日志文件，ctx 超时则放弃等待
+func (dl *DailyLogger) Close(ctx context.Context) error {
+	dl.pendingMu.Lock()
+	dl.closing = true
+	dl.pendingMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		dl.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("等待日志写入超时: %w", ctx.Err())
+	}
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	dl.closed = true
+	if dl.file == nil {
+		return nil
+	}
+	err := dl.file.Close()
+	dl.file = nil
+	return err
+}
+
 func (dl *DailyLogger) Log(data map[string]interface{}) error {
 	dl.mu.Lock()
 	defer dl.mu.Unlock()
+	if dl.closed {
+		return ErrLoggerClosed
+	}
 
 	file, err := dl.getLogFile()
 	if err != nil {
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"fileservice/config"
 	"fileservice/handlers"
+	"fileservice/lifecycle"
+	"fileservice/logger"
 	"fileservice/storage"
 	"log"
+	"net/http"
 	"os"
 
 	"github.com/gin-gonic/gin"
@@ -19,12 +23,19 @@ func main() {
 		log.Fatal("创建上传目录失败: ", err)
 	}
 
+	// 服务生命周期：退出时等待进行中的请求，再逆序执行下面注册的清理函数
+	app := lifecycle.New(cfg.ShutdownTimeout)
+
 	// 初始化数据库
 	db, err := storage.InitDB("file_service.db")
 	if err != nil {
 		log.Fatal("数据库初始化失败: ", err)
 	}
-	defer db.Close()
+	app.OnShutdown("关闭数据库", func(context.Context) error { return db.Close() })
+
+	// 请求日志异步写入，退出时等待全部写完，避免日志文件被截断
+	dailyLogger := logger.NewDailyLogger(cfg.LogDir)
+	app.OnShutdown("写完请求日志", dailyLogger.Close)
 
 	// 初始化文件存储
 	fileStore := storage.NewFileStore(cfg.UploadDir)
@@ -34,7 +45,8 @@ func main() {
 	// 配置Gin
 	router := gin.Default()
 	router.Use(
-		handlers.RequestLogger(cfg.LogDir),
+		app.Middleware(),
+		handlers.RequestLogger(dailyLogger),
 		gin.Recovery(),
 	)
 
@@ -63,6 +75,8 @@ func main() {
 			"status": "ok",
 		})
 	})
-	router.Run(":8081")
-
+	srv := &http.Server{Addr: ":8081", Handler: router}
+	if err := app.Serve(srv); err != nil {
+		log.Fatal("服务启动失败: ", err)
+	}
 }
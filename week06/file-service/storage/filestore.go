@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -24,18 +25,37 @@ func (fs *FileStore) generatePath(uuid string) string {
 	return filepath.Join(subDir, uuid)
 }
 
-func (fs *FileStore) Save(uuid string, src io.Reader) error {
+// Save 保存文件，ctx 取消（客户端断开或服务退出）时中止写入并删除不完整的文件
+func (fs *FileStore) Save(ctx context.Context, uuid string, src io.Reader) error {
 	dstPath := fs.generatePath(uuid)
 	file, err := os.Create(dstPath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	_, err = io.Copy(file, src)
+	_, err = io.Copy(file, &contextReader{ctx: ctx, r: src})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dstPath)
+	}
 	return err
 }
 
+// contextReader 每次读取前检查 ctx 是否已取消
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
 func (fs *FileStore) Get(uuid string) (io.ReadCloser, error) {
 	return os.Open(fs.findFile(uuid))
 }
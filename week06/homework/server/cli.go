@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"Server/config"
+	"Server/services"
+	"Server/storage"
+)
+
+const commandUsage = `管理命令（使用与服务相同的配置，服务运行时也可以执行）:
+  backup create               立即创建手动备份
+  backup list                 列出备份目录中的备份
+  backup rotate               按 backup.keep 删除多余的定时备份
+  backup verify <备份>        校验备份的完整性
+  backup restore <备份>       校验后从备份恢复，恢复前的数据保存为 pre-restore 备份
+  backup snapshot [-o 文件]   导出数据库、AI日志与附件的 tar.gz 快照（默认写入当前目录）
+
+<备份> 可以是备份目录中的文件名，也可以是数据库文件的路径。
+`
+
+// runCommand 执行命令行管理命令，返回进程退出码
+func runCommand(cfg *config.AIConfig, args []string) int {
+	if len(args) < 2 || args[0] != "backup" {
+		fmt.Fprint(os.Stderr, commandUsage)
+		return 2
+	}
+
+	// Ctrl+C 时中断正在进行的备份
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := storage.InitDB(cfg.Storage.DBPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "数据库初始化失败:", err)
+		return 1
+	}
+	defer db.Close()
+	manager := services.NewBackupManager(db, storage.NewJSONStorage(cfg.Storage.LogDir), storage.NewFileStore(cfg.Storage.AttachmentDir), cfg.Backup)
+
+	if err := runBackupCommand(ctx, manager, args[1], args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		return 1
+	}
+	return 0
+}
+
+func runBackupCommand(ctx context.Context, manager *services.BackupManager, cmd string, args []string) error {
+	switch cmd {
+	case "create":
+		info, err := manager.Create(ctx, services.BackupManual)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已备份到 %s（%d 字节）\n", info.Name, info.Size)
+
+	case "list":
+		list, err := manager.List()
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("没有备份")
+		}
+		for _, b := range list {
+			fmt.Printf("%-40s %-12s %12d  %s\n", b.Name, b.Kind, b.Size, b.CreatedAt)
+		}
+
+	case "rotate":
+		removed, err := manager.Rotate()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已删除 %d 份旧备份\n", len(removed))
+		for _, name := range removed {
+			fmt.Println("  " + name)
+		}
+
+	case "verify":
+		path, err := resolveBackup(manager, args)
+		if err != nil {
+			return err
+		}
+		report, err := manager.Verify(ctx, path)
+		if err != nil {
+			return err
+		}
+		printJSON(report)
+		if !report.OK {
+			return errors.New("备份未通过完整性校验")
+		}
+
+	case "restore":
+		path, err := resolveBackup(manager, args)
+		if err != nil {
+			return err
+		}
+		result, err := manager.Restore(ctx, path)
+		if result != nil {
+			printJSON(result)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println("恢复完成。服务正在运行时建议重启，以重新加载内存中的统计缓存。")
+
+	case "snapshot":
+		fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+		output := fs.String("o", fmt.Sprintf("question-service-snapshot-%s.tar.gz", time.Now().Format("20060102-150405")), "输出文件")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		manifest, err := manager.Snapshot(ctx, f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(*output)
+			return err
+		}
+		fmt.Printf("已导出快照 %s（数据库 %d 字节，%d 个日志文件，%d 个附件）\n", *output, manifest.Database.Size, len(manifest.Logs), len(manifest.Attachments))
+
+	default:
+		fmt.Fprint(os.Stderr, commandUsage)
+		return fmt.Errorf("未知命令: backup %s", cmd)
+	}
+	return nil
+}
+
+// resolveBackup 参数是路径时直接使用，否则在备份目录中查找
+func resolveBackup(manager *services.BackupManager, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("请指定一个备份")
+	}
+	if strings.ContainsRune(args[0], filepath.Separator) || strings.Contains(args[0], "/") {
+		if _, err := os.Stat(args[0]); err != nil {
+			return "", err
+		}
+		return args[0], nil
+	}
+	path, err := manager.Path(args[0])
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("备份不存在: %s", args[0])
+	}
+	return path, err
+}
+
+func printJSON(v interface{}) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(data))
+}
@@ -0,0 +1,49 @@
+// ltimock 本地模拟的 LTI 1.3 平台（LMS），用于在没有真实课程平台时联调 LTI 接入（平台实现见 Server/ltimock）。
+//
+// 它实现了平台一侧的 OIDC 授权、id_token 签发、JWKS、OAuth2 令牌（校验工具的 client_assertion）、
+// Deep Linking 返回与 AGS 成绩接收。浏览器打开首页即可以教师身份添加内容、以学生身份答题，
+// 收到的成绩打印到日志并可通过 /scores 查询。
+//
+//	go run ./cmd/ltimock -register -token <backup.admin_token>
+package main
+
+import (
+	"Server/ltimock"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "监听地址")
+	base := flag.String("base", "http://localhost:8090", "平台对外地址（同时作为 issuer）")
+	tool := flag.String("tool", "http://localhost:8080", "题库服务地址（lti.base_url）")
+	clientID := flag.String("client-id", "ltimock-client", "分配给工具的 client_id")
+	deployment := flag.String("deployment", "ltimock-deployment", "部署ID")
+	register := flag.Bool("register", false, "启动时在题库服务中登记本平台（需要 -token）")
+	token := flag.String("token", "", "题库服务的管理令牌（backup.admin_token）")
+	workspace := flag.String("workspace", "", "登记时学生作答的工作区ID或标识，默认工作区为空")
+	offline := flag.Bool("offline-jwks", false, "登记时直接提供平台公钥（JWKS），而不是 jwks_url")
+	failScores := flag.Int("fail-scores", 0, "前 N 次成绩回传返回 503，用于测试重试")
+	flag.Parse()
+
+	p, err := ltimock.New(ltimock.Config{
+		Base:       *base,
+		Tool:       *tool,
+		ClientID:   *clientID,
+		Deployment: *deployment,
+		FailScores: *failScores,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *register {
+		if err := p.Register(*token, *workspace, *offline); err != nil {
+			log.Fatal("登记平台失败: ", err)
+		}
+	}
+
+	log.Printf("模拟 LTI 平台启动于 %s（issuer %s，client_id %s）", *addr, strings.TrimRight(*base, "/"), *clientID)
+	log.Fatal(http.ListenAndServe(*addr, p.Handler()))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// runAPI 调用任意接口并输出 data，用于 qbank 没有单独封装的接口，如
+// qbank api POST /api/templates -d @template.json、qbank api GET /api/quiz/sessions -q limit=5
+func runAPI(env *cmdEnv, args []string) error {
+	fs := newFlagSet("api", env.global)
+	body := fs.String("d", "", "请求体JSON，@文件 从文件读取，@- 从标准输入读取")
+	var params stringList
+	fs.Var(&params, "q", "查询参数 key=value，可重复")
+	rest, err := env.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 || !strings.HasPrefix(rest[1], "/") {
+		return usageError("api <GET|POST|PUT|DELETE> </api/路径> [-d JSON|@文件] [-q key=value]...")
+	}
+	method := strings.ToUpper(rest[0])
+
+	query := url.Values{}
+	for _, p := range params {
+		key, value, ok := strings.Cut(p, "=")
+		if !ok {
+			return fmt.Errorf("无效的查询参数 %q，应为 key=value", p)
+		}
+		query.Add(key, value)
+	}
+	var reqBody interface{}
+	if *body != "" {
+		var r io.Reader = strings.NewReader(*body)
+		if name, ok := strings.CutPrefix(*body, "@"); ok {
+			if name == "-" {
+				r = os.Stdin
+			} else {
+				f, err := os.Open(name)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+		}
+		reqBody = jsonBody{r}
+	}
+	data, err := env.client.Do(method, rest[1], query, reqBody)
+	if err != nil {
+		return err
+	}
+	return env.print(data, nil)
+}
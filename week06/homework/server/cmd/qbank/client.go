@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client 题库服务的HTTP客户端，按 profile 附加身份请求头
+type Client struct {
+	base    string
+	profile Profile
+	http    *http.Client
+}
+
+// APIError 服务端返回的错误
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("服务端返回 %d: %s", e.Status, e.Message)
+}
+
+// envelope 统一响应格式；AI出题接口的结果在 aiRes 中
+type envelope struct {
+	Code  int             `json:"code"`
+	Msg   string          `json:"msg"`
+	Data  json.RawMessage `json:"data"`
+	AIRes json.RawMessage `json:"aiRes"`
+}
+
+// jsonBody 原样发送的JSON请求体
+type jsonBody struct {
+	io.Reader
+}
+
+func NewClient(p Profile) *Client {
+	return &Client{
+		base:    strings.TrimRight(p.Server, "/"),
+		profile: p,
+		// AI出题可能需要一分钟以上，由服务端控制超时
+		http: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// newRequest 构造请求，body 为 nil、io.Reader 或可JSON编码的值
+func (c *Client) newRequest(method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case jsonBody:
+		reader, contentType = b.Reader, "application/json"
+	case io.Reader:
+		reader = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.profile.Token != "" {
+		req.Header.Set("X-Admin-Token", c.profile.Token)
+	}
+	if c.profile.User != "" {
+		req.Header.Set("X-User", c.profile.User)
+	}
+	if c.profile.Workspace != "" {
+		req.Header.Set("X-Workspace", c.profile.Workspace)
+	}
+	return req, nil
+}
+
+// Do 发送请求并解析统一响应，返回 data（AI出题接口为 aiRes）
+func (c *Client) Do(method, path string, query url.Values, body interface{}) (json.RawMessage, error) {
+	resp, err := c.send(method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		if resp.StatusCode >= 400 {
+			return nil, &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		}
+		return data, nil // 不是统一响应格式（如健康检查），原样返回
+	}
+	if resp.StatusCode >= 400 || env.Code != 0 {
+		return nil, &APIError{Status: resp.StatusCode, Message: env.Msg}
+	}
+	if len(env.AIRes) > 0 {
+		return env.AIRes, nil
+	}
+	return env.Data, nil
+}
+
+// Download 发送请求并返回响应体，用于导出文件等非JSON响应，调用方负责关闭
+func (c *Client) Download(method, path string, query url.Values) (*http.Response, error) {
+	resp, err := c.send(method, path, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		var env envelope
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &env) == nil && env.Msg != "" {
+			msg = env.Msg
+		}
+		return nil, &APIError{Status: resp.StatusCode, Message: msg}
+	}
+	return resp, nil
+}
+
+func (c *Client) send(method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	req, err := c.newRequest(method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, fmt.Errorf("无法连接 %s: %w", c.base, urlErr.Err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
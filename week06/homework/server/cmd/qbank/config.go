@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// Profile 一组连接配置，对应一个服务端（或同一服务端的不同工作区、身份）
+type Profile struct {
+	Server    string `yaml:"server"`
+	Token     string `yaml:"token,omitempty"`     // 管理令牌，以 X-Admin-Token 发送
+	User      string `yaml:"user,omitempty"`      // 以 X-User 发送，工作区按成员检查权限
+	Workspace string `yaml:"workspace,omitempty"` // 以 X-Workspace 发送，工作区ID或标识
+	Output    string `yaml:"output,omitempty"`    // 默认输出格式 json/table/yaml
+}
+
+// Config 配置文件：多个命名的 profile 与当前使用的 profile
+type Config struct {
+	Current  string              `yaml:"current"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+
+	path string
+}
+
+// configPath 配置文件路径：$QBANK_CONFIG，默认为用户配置目录下的 qbank/config.yaml
+func configPath() (string, error) {
+	if p := os.Getenv("QBANK_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("找不到用户配置目录，请设置 QBANK_CONFIG: %w", err)
+	}
+	return filepath.Join(dir, "qbank", "config.yaml"), nil
+}
+
+// loadConfig 读取配置文件，文件不存在时返回空配置
+func loadConfig() (*Config, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		cfg.Profiles = map[string]*Profile{}
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*Profile{}
+	}
+	return cfg, nil
+}
+
+// save 写回配置文件，文件中有令牌，只允许本人读写
+func (cfg *Config) save() error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.path), 0700); err != nil {
+		return fmt.Errorf("创建配置目录失败: %w", err)
+	}
+	if err := os.WriteFile(cfg.path, data, 0600); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	return nil
+}
+
+// profileName 未指定 profile 时依次使用 $QBANK_PROFILE、配置中的 current、default
+func (cfg *Config) profileName(name string) string {
+	if name == "" {
+		name = os.Getenv("QBANK_PROFILE")
+	}
+	if name == "" {
+		name = cfg.Current
+	}
+	if name == "" {
+		name = "default"
+	}
+	return name
+}
+
+// names 按名称排序的 profile 列表
+func (cfg *Config) names() []string {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolve 合并连接参数，优先级：命令行参数 > 环境变量 > profile > 默认值
+func (cfg *Config) resolve(g *globalOptions) (Profile, error) {
+	name := cfg.profileName(g.profile)
+	p, ok := cfg.Profiles[name]
+	if !ok && g.profile != "" {
+		return Profile{}, fmt.Errorf("profile %q 不存在，可用 qbank config set 创建", name)
+	}
+	var merged Profile
+	if p != nil {
+		merged = *p
+	}
+	pick := func(dst *string, flagValue, env string) {
+		if v := os.Getenv(env); v != "" {
+			*dst = v
+		}
+		if flagValue != "" {
+			*dst = flagValue
+		}
+	}
+	pick(&merged.Server, g.server, "QBANK_SERVER")
+	pick(&merged.Token, g.token, "QBANK_TOKEN")
+	pick(&merged.User, g.user, "QBANK_USER")
+	pick(&merged.Workspace, g.workspace, "QBANK_WORKSPACE")
+	pick(&merged.Output, g.output, "QBANK_OUTPUT")
+	if merged.Server == "" {
+		merged.Server = defaultServer
+	}
+	if merged.Output == "" {
+		merged.Output = "table"
+	}
+	if !validFormat(merged.Output) {
+		return Profile{}, fmt.Errorf("不支持的输出格式 %q，可选 json、table、yaml", merged.Output)
+	}
+	return merged, nil
+}
+
+// runConfig qbank config set|use|show|list
+func runConfig(cfg *Config, g *globalOptions, args []string) error {
+	if len(args) == 0 {
+		return usageError("config set <键> <值> | config use <profile> | config show | config list")
+	}
+	name := cfg.profileName(g.profile)
+	switch args[0] {
+	case "set":
+		if len(args) != 3 {
+			return usageError("config set <server|token|user|workspace|output> <值>")
+		}
+		p := cfg.Profiles[name]
+		if p == nil {
+			p = &Profile{Server: defaultServer}
+			cfg.Profiles[name] = p
+		}
+		switch args[1] {
+		case "server":
+			p.Server = args[2]
+		case "token":
+			p.Token = args[2]
+		case "user":
+			p.User = args[2]
+		case "workspace":
+			p.Workspace = args[2]
+		case "output":
+			if !validFormat(args[2]) {
+				return fmt.Errorf("不支持的输出格式 %q，可选 json、table、yaml", args[2])
+			}
+			p.Output = args[2]
+		default:
+			return fmt.Errorf("未知的配置项 %q", args[1])
+		}
+		if cfg.Current == "" {
+			cfg.Current = name
+		}
+		if err := cfg.save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "已更新 profile %s（%s）\n", name, cfg.path)
+
+	case "use":
+		if len(args) != 2 {
+			return usageError("config use <profile>")
+		}
+		if cfg.Profiles[args[1]] == nil {
+			return fmt.Errorf("profile %q 不存在", args[1])
+		}
+		cfg.Current = args[1]
+		if err := cfg.save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "当前 profile: %s\n", args[1])
+
+	case "show":
+		p, err := cfg.resolve(g)
+		if err != nil {
+			return err
+		}
+		if p.Token != "" {
+			p.Token = "******"
+		}
+		return printResult(p.Output, map[string]interface{}{
+			"profile":   name,
+			"file":      cfg.path,
+			"server":    p.Server,
+			"token":     p.Token,
+			"user":      p.User,
+			"workspace": p.Workspace,
+			"output":    p.Output,
+		}, nil)
+
+	case "list":
+		for _, n := range cfg.names() {
+			mark := " "
+			if n == cfg.Current {
+				mark = "*"
+			}
+			fmt.Printf("%s %-16s %s\n", mark, n, cfg.Profiles[n].Server)
+		}
+
+	default:
+		return usageError("config set|use|show|list")
+	}
+	return nil
+}
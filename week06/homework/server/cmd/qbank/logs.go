@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 日志输出的列
+var logColumns = []column{
+	{"start", "aiStartTime"},
+	{"status", "status"},
+	{"model", "aiReq.model"},
+	{"language", "aiReq.language"},
+	{"type", "aiReq.type"},
+	{"keyword", "aiReq.keyword"},
+	{"cost", "aiCostTime"},
+	{"cache", "cache"},
+	{"error", "error"},
+}
+
+// runLogs 查看AI出题日志，-f 时按间隔轮询新记录，直到 Ctrl+C
+func runLogs(env *cmdEnv, args []string) error {
+	fs := newFlagSet("logs", env.global)
+	n := fs.Int("n", 20, "显示最近的条数 1-500")
+	follow := fs.Bool("f", false, "持续输出新的日志")
+	interval := fs.Duration("interval", 2*time.Second, "-f 时的轮询间隔")
+	status := fs.String("status", "", "只看 success 或 failed")
+	if _, err := env.parse(fs, args); err != nil {
+		return err
+	}
+	if *n < 1 || *n > 500 {
+		return fmt.Errorf("-n 必须在1-500之间")
+	}
+
+	// 1. 最近的记录
+	page, err := fetchLogs(env.client, -1, *n, *status)
+	if err != nil {
+		return err
+	}
+	if !*follow {
+		return env.print(page.Entries, logColumns)
+	}
+
+	// 2. 持续跟踪：逐条输出，json 为每行一条，yaml 为多个文档，table 为对齐的行
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if env.profile.Output == "table" {
+		fmt.Println(logLine(nil))
+	}
+	next := page.Next
+	for {
+		for _, entry := range page.Entries {
+			if err := printLogEntry(env.profile.Output, entry); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+		if page, err = fetchLogs(env.client, next, 500, *status); err != nil {
+			fmt.Fprintln(os.Stderr, "读取日志失败:", err) // 服务重启等临时错误，下次重试
+			page = &logPage{Next: next}
+			continue
+		}
+		next = page.Next
+	}
+}
+
+type logPage struct {
+	Entries []json.RawMessage `json:"entries"`
+	Next    int               `json:"next"`
+}
+
+// fetchLogs after 为负数时取最近 limit 条
+func fetchLogs(client *Client, after, limit int, status string) (*logPage, error) {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if after >= 0 {
+		query.Set("after", strconv.Itoa(after))
+	}
+	if status != "" {
+		query.Set("status", status)
+	}
+	data, err := client.Do("GET", "/api/analytics/ai/logs", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	var page logPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, fmt.Errorf("解析日志失败: %w", err)
+	}
+	return &page, nil
+}
+
+func printLogEntry(format string, entry json.RawMessage) error {
+	switch format {
+	case "json":
+		_, err := fmt.Println(string(compactJSON(entry)))
+		return err
+	case "yaml":
+		v, err := normalize(entry)
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("---\n%s", data)
+		return nil
+	}
+	v, err := normalize(entry)
+	if err != nil {
+		return err
+	}
+	fmt.Println(logLine(v))
+	return nil
+}
+
+// logLine 跟踪模式下的一行，entry 为 nil 时输出表头
+func logLine(entry interface{}) string {
+	widths := []int{19, 7, 8, 10, 4, 20, 7, 9, 0}
+	parts := make([]string, len(logColumns))
+	for i, col := range logColumns {
+		s := strings.ToUpper(col.header)
+		if entry != nil {
+			s = cell(lookup(entry, col.key))
+		}
+		if w := widths[i]; w > 0 {
+			s = padRight(s, w)
+		}
+		parts[i] = s
+	}
+	return strings.TrimRight(strings.Join(parts, "  "), " ")
+}
+
+// padRight 按显示宽度补齐，中文字符占两列
+func padRight(s string, width int) string {
+	w := 0
+	for _, r := range s {
+		if r > 0x2E80 {
+			w += 2
+		} else {
+			w++
+		}
+	}
+	if w >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-w)
+}
+
+func compactJSON(data json.RawMessage) []byte {
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	var v interface{}
+	if json.Unmarshal(data, &v) != nil || enc.Encode(v) != nil {
+		return data
+	}
+	return []byte(strings.TrimRight(buf.String(), "\n"))
+}
@@ -0,0 +1,204 @@
+// qbank 题库服务的命令行客户端，用于脚本与自动批改等不经过浏览器的场景。
+//
+// 连接参数来自配置文件中的 profile（qbank config set server http://host:8080），
+// 也可以用环境变量 QBANK_SERVER、QBANK_TOKEN、QBANK_USER、QBANK_WORKSPACE 或同名参数覆盖。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const usage = `用法: qbank [全局选项] <命令> [选项] [参数]
+
+题目:
+  generate -keyword <关键词>       AI出题（-provider -type -language -count，-save 保存到题库）
+  list                             分页列出题目（-type -locale -page -page-size，-all 列出全部）
+  search <关键词>                  按标题搜索题目，选项同 list
+  show <ID>                        查看题目详情
+  edit <ID>                        修改题目（-title -answer -right -tag 等，或 -file、-editor）
+  delete <ID>...                   删除题目（-y 跳过确认）
+  import <文件>                    从 JSON/YAML/CSV 文件导入题目（导出文件可直接导入）
+  export                           导出题目（-format json|csv|zip -type -language -tag -locale -ids -out）
+
+其他:
+  logs                             查看AI出题日志（-n 条数，-f 持续跟踪，-status success|failed）
+  api <方法> <路径>                调用任意接口（-d JSON 或 -d @文件，-q key=value）
+  config set <键> <值>             设置 profile 的 server/token/user/workspace/output
+  config use <profile>             切换当前 profile
+  config show | config list        查看当前配置 / 全部 profile
+
+全局选项（也可以写在命令之后）:
+  -profile <名称>   使用的 profile          -server <地址>     服务地址
+  -token <令牌>     管理令牌                -user <用户>       X-User 身份
+  -workspace <ID>   工作区ID或标识          -o json|table|yaml 输出格式
+`
+
+// globalOptions 所有命令共用的参数
+type globalOptions struct {
+	profile   string
+	server    string
+	token     string
+	user      string
+	workspace string
+	output    string
+}
+
+func (g *globalOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.profile, "profile", g.profile, "使用的 profile")
+	fs.StringVar(&g.server, "server", g.server, "服务地址")
+	fs.StringVar(&g.token, "token", g.token, "管理令牌")
+	fs.StringVar(&g.user, "user", g.user, "X-User 身份")
+	fs.StringVar(&g.workspace, "workspace", g.workspace, "工作区ID或标识")
+	fs.StringVar(&g.output, "o", g.output, "输出格式 json|table|yaml")
+}
+
+func isGlobalFlag(name string) bool {
+	switch name {
+	case "profile", "server", "token", "user", "workspace", "o":
+		return true
+	}
+	return false
+}
+
+// errUsage 参数错误，退出码为2
+type errUsage string
+
+func (e errUsage) Error() string { return "用法: qbank " + string(e) }
+
+func usageError(s string) error { return errUsage(s) }
+
+// command 一个子命令，解析参数后 env 中有合并后的连接参数与客户端
+type command func(env *cmdEnv, args []string) error
+
+type cmdEnv struct {
+	global  *globalOptions
+	config  *Config
+	profile Profile
+	client  *Client
+}
+
+var commands = map[string]command{
+	"generate": runGenerate,
+	"list":     runList,
+	"search":   runSearch,
+	"show":     runShow,
+	"edit":     runEdit,
+	"delete":   runDelete,
+	"import":   runImport,
+	"export":   runExport,
+	"logs":     runLogs,
+	"api":      runAPI,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run 执行命令并返回退出码：0 成功，1 执行失败，2 参数错误
+func run(args []string) int {
+	// 1. 命令之前的全局选项
+	g := &globalOptions{}
+	fs := flag.NewFlagSet("qbank", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	g.register(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		if err != nil && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "错误:", err)
+		}
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	name, rest := fs.Arg(0), fs.Args()[1:]
+
+	// 2. 读取配置并执行命令
+	cfg, err := loadConfig()
+	if err == nil {
+		if name == "config" {
+			err = runConfigCommand(cfg, g, rest)
+		} else if cmd, ok := commands[name]; ok {
+			err = cmd(&cmdEnv{global: g, config: cfg}, rest)
+		} else {
+			fmt.Fprintf(os.Stderr, "未知命令 %q\n\n%s", name, usage)
+			return 2
+		}
+	}
+
+	var usageErr errUsage
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 2
+	case errors.As(err, &usageErr):
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	default:
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		return 1
+	}
+}
+
+func runConfigCommand(cfg *Config, g *globalOptions, args []string) error {
+	fs := newFlagSet("config", g)
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	return runConfig(cfg, g, rest)
+}
+
+// parse 解析子命令参数（含全局选项），之后才能确定 profile，再按合并后的配置创建客户端
+func (env *cmdEnv) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if env.profile, err = env.config.resolve(env.global); err != nil {
+		return nil, err
+	}
+	env.client = NewClient(env.profile)
+	return rest, nil
+}
+
+// print 按 -o 指定的格式输出
+func (env *cmdEnv) print(result interface{}, columns []column) error {
+	return printResult(env.profile.Output, result, columns)
+}
+
+// newFlagSet 子命令的参数集合，同时接受全局选项
+func newFlagSet(name string, g *globalOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("qbank "+name, flag.ContinueOnError)
+	g.register(fs)
+	return fs
+}
+
+// parseFlags 允许选项与位置参数交替出现，如 qbank show 12 -o yaml
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// stringList 可重复的字符串参数，如 -answer A -answer B
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+const maxCellWidth = 60 // 表格单元格最多显示的字符数
+
+// column 表格的一列，key 为字段名，嵌套字段用点分隔，如 "aiReq.keyword"
+type column struct {
+	header string
+	key    string
+}
+
+func validFormat(format string) bool {
+	return format == "json" || format == "table" || format == "yaml"
+}
+
+// printResult 按格式输出结果。table 格式下对象列表按 columns 输出（为空时取第一项的标量字段），
+// 单个对象输出为 字段/值 两列
+func printResult(format string, result interface{}, columns []column) error {
+	data, err := normalize(result)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(data)
+	case "yaml":
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		defer enc.Close()
+		return enc.Encode(data)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	switch v := data.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			fmt.Fprintln(os.Stderr, "（无数据）")
+			return nil
+		}
+		if columns == nil {
+			columns = scalarColumns(v[0])
+		}
+		headers := make([]string, len(columns))
+		for i, col := range columns {
+			headers[i] = strings.ToUpper(col.header)
+		}
+		fmt.Fprintln(w, strings.Join(headers, "\t"))
+		for _, item := range v {
+			cells := make([]string, len(columns))
+			for i, col := range columns {
+				cells[i] = cell(lookup(item, col.key))
+			}
+			fmt.Fprintln(w, strings.Join(cells, "\t"))
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", k, cell(v[k]))
+		}
+	default:
+		fmt.Fprintln(w, cell(v))
+	}
+	return nil
+}
+
+// normalize 把结构体或原始JSON统一转换为 map/slice，三种格式输出的字段一致
+func normalize(result interface{}) (interface{}, error) {
+	raw, ok := result.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(result); err != nil {
+			return nil, err
+		}
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	return data, nil
+}
+
+// scalarColumns 对象中值为标量的字段，id 排在最前
+func scalarColumns(item interface{}) []column {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return []column{{header: "value"}}
+	}
+	var columns []column
+	for k, v := range m {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			continue
+		}
+		columns = append(columns, column{header: k, key: k})
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		if (columns[i].key == "id") != (columns[j].key == "id") {
+			return columns[i].key == "id"
+		}
+		return columns[i].key < columns[j].key
+	})
+	return columns
+}
+
+// lookup 按点分隔的路径取值，key 为空时返回对象本身
+func lookup(item interface{}, key string) interface{} {
+	if key == "" {
+		return item
+	}
+	for _, part := range strings.Split(key, ".") {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		item = m[part]
+	}
+	return item
+}
+
+// cell 单元格文本：数组用逗号连接，对象输出为紧凑JSON，换行替换为空格，过长时截断
+func cell(v interface{}) string {
+	var s string
+	switch x := v.(type) {
+	case nil:
+		s = ""
+	case string:
+		s = x
+	case float64:
+		s = strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		s = strconv.FormatBool(x)
+	case []interface{}:
+		parts := make([]string, len(x))
+		allScalar := true
+		for i, e := range x {
+			switch e.(type) {
+			case map[string]interface{}, []interface{}:
+				allScalar = false
+			}
+			parts[i] = cell(e)
+		}
+		if allScalar {
+			s = strings.Join(parts, ",")
+		} else {
+			data, _ := json.Marshal(x)
+			s = string(data)
+		}
+	default:
+		data, _ := json.Marshal(x)
+		s = string(data)
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > maxCellWidth {
+		s = string(r[:maxCellWidth-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const importBatchSize = 100 // 导入时每次请求提交的题目数
+
+// question 题目的可编辑字段，与导出文件及 /api/questions/batch-insert 的格式一致
+type question struct {
+	ID           int      `json:"id,omitempty" yaml:"id,omitempty"`
+	Type         int      `json:"type" yaml:"type"`
+	Title        string   `json:"title" yaml:"title"`
+	Language     string   `json:"language" yaml:"language"`
+	Answers      []string `json:"answers" yaml:"answers"`
+	Rights       []string `json:"rights" yaml:"rights"`
+	Tags         []string `json:"tags" yaml:"tags"`
+	Explanations []string `json:"explanations" yaml:"explanations"`
+	Hint         string   `json:"hint" yaml:"hint"`
+	Reference    string   `json:"reference" yaml:"reference"`
+	Source       string   `json:"source,omitempty" yaml:"source,omitempty"`
+	Locale       string   `json:"locale,omitempty" yaml:"locale,omitempty"`
+}
+
+// 列表输出的列
+var questionColumns = []column{{"id", "id"}, {"type", "type"}, {"title", "title"}}
+
+// runGenerate 调用AI出题，-save 时把结果保存到题库
+func runGenerate(env *cmdEnv, args []string) error {
+	fs := newFlagSet("generate", env.global)
+	provider := fs.String("provider", "", "AI服务 deepseek|tongyi，默认由服务端决定")
+	typ := fs.Int("type", 1, "题型 1单选 2多选 3编程")
+	language := fs.String("language", "go", "编程语言")
+	count := fs.Int("count", 3, "题目数量 3-10")
+	keyword := fs.String("keyword", "", "关键词，也可以写在命令之后")
+	noCache := fs.Bool("no-cache", false, "跳过AI出题缓存，重新生成")
+	save := fs.Bool("save", false, "保存生成的题目")
+	var tags stringList
+	fs.Var(&tags, "tag", "保存时附加的标签，可重复")
+	rest, err := env.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *keyword == "" {
+		*keyword = strings.Join(rest, " ")
+	}
+	if *keyword == "" {
+		return usageError("generate -keyword <关键词> [-provider deepseek|tongyi] [-type 1] [-language go] [-count 3] [-save]")
+	}
+
+	// 1. 出题
+	req := map[string]interface{}{
+		"model":    *provider,
+		"language": *language,
+		"type":     *typ,
+		"count":    *count,
+		"keyword":  *keyword,
+	}
+	if *noCache {
+		req["cache"] = "bypass"
+	}
+	data, err := env.client.Do("POST", "/api/questions/CreateByAI", nil, req)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Questions []question `json:"questions"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("解析出题结果失败: %w", err)
+	}
+	if len(result.Questions) == 0 {
+		return fmt.Errorf("AI出题失败，可用 qbank logs -status failed -n 1 查看原因")
+	}
+
+	// 2. 保存到题库，输出带ID的题目
+	if *save {
+		for i := range result.Questions {
+			q := &result.Questions[i]
+			q.Type, q.Language, q.Tags, q.Source = *typ, *language, tags, "ai"
+		}
+		ids, err := insertQuestions(env.client, result.Questions)
+		if err != nil {
+			return err
+		}
+		for i, id := range ids {
+			result.Questions[i].ID = id
+		}
+		fmt.Fprintf(os.Stderr, "已保存 %d 道题\n", len(ids))
+	}
+	return env.print(result.Questions, []column{{"id", "id"}, {"title", "title"}, {"answers", "answers"}, {"rights", "rights"}})
+}
+
+// listOptions list 与 search 共用的筛选条件，对应分页接口的参数
+type listOptions struct {
+	typ      int
+	locale   string
+	page     int
+	pageSize int
+	all      bool
+}
+
+func (o *listOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.typ, "type", 0, "题型 1单选 2多选 3编程，默认全部")
+	fs.StringVar(&o.locale, "locale", "", "内容语言，如 zh-CN、en-US")
+	fs.IntVar(&o.page, "page", 1, "页码")
+	fs.IntVar(&o.pageSize, "page-size", 20, "每页数量 1-100")
+	fs.BoolVar(&o.all, "all", false, "列出全部页")
+}
+
+func runList(env *cmdEnv, args []string) error {
+	var opts listOptions
+	fs := newFlagSet("list", env.global)
+	search := fs.String("search", "", "标题关键词")
+	opts.register(fs)
+	if _, err := env.parse(fs, args); err != nil {
+		return err
+	}
+	return listQuestions(env, opts, *search)
+}
+
+func runSearch(env *cmdEnv, args []string) error {
+	var opts listOptions
+	fs := newFlagSet("search", env.global)
+	opts.register(fs)
+	rest, err := env.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return usageError("search <关键词> [-type 1] [-locale zh-CN] [-page 1] [-page-size 20] [-all]")
+	}
+	return listQuestions(env, opts, strings.Join(rest, " "))
+}
+
+// listQuestions 调用分页接口，-all 时逐页读取直到取完
+func listQuestions(env *cmdEnv, opts listOptions, search string) error {
+	path := "/api/stats/summary"
+	if opts.typ != 0 {
+		if opts.typ < 1 || opts.typ > 3 {
+			return fmt.Errorf("无效的题型 %d", opts.typ)
+		}
+		path = fmt.Sprintf("/api/stats/bytype%d", opts.typ)
+	}
+	var all []json.RawMessage
+	total := 0
+	for page := opts.page; ; page++ {
+		query := url.Values{
+			"page":     {strconv.Itoa(page)},
+			"pageSize": {strconv.Itoa(opts.pageSize)},
+		}
+		if search != "" {
+			query.Set("search", search)
+		}
+		if opts.locale != "" {
+			query.Set("locale", opts.locale)
+		}
+		data, err := env.client.Do("GET", path, query, nil)
+		if err != nil {
+			return err
+		}
+		var result struct {
+			Total     int               `json:"total"`
+			Questions []json.RawMessage `json:"questions"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("解析题目列表失败: %w", err)
+		}
+		total = result.Total
+		all = append(all, result.Questions...)
+		if !opts.all || len(result.Questions) == 0 || page*opts.pageSize >= total {
+			break
+		}
+	}
+	if env.profile.Output == "table" {
+		fmt.Fprintf(os.Stderr, "共 %d 道题，显示 %d 道\n", total, len(all))
+	}
+	if all == nil {
+		all = []json.RawMessage{}
+	}
+	return env.print(all, questionColumns)
+}
+
+func runShow(env *cmdEnv, args []string) error {
+	fs := newFlagSet("show", env.global)
+	rest, err := env.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usageError("show <ID>")
+	}
+	id, err := parseID(rest[0])
+	if err != nil {
+		return err
+	}
+	data, err := env.client.Do("GET", "/api/stats/byid/"+strconv.Itoa(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	return env.print(data, nil)
+}
+
+// runEdit 读取题目，按参数、文件或编辑器修改后整体提交
+func runEdit(env *cmdEnv, args []string) error {
+	fs := newFlagSet("edit", env.global)
+	title := fs.String("title", "", "题干")
+	typ := fs.Int("type", 0, "题型 1单选 2多选")
+	hint := fs.String("hint", "", "提示")
+	reference := fs.String("reference", "", "参考链接")
+	file := fs.String("file", "", "从 JSON/YAML 文件读取修改后的题目")
+	editor := fs.Bool("editor", false, "用 $EDITOR 编辑 YAML 格式的题目")
+	var answers, rights, tags, explanations stringList
+	fs.Var(&answers, "answer", "选项，按顺序重复指定，替换全部选项")
+	fs.Var(&rights, "right", "正确答案字母，可重复或用逗号分隔")
+	fs.Var(&tags, "tag", "标签，可重复，替换全部标签")
+	fs.Var(&explanations, "explanation", "选项解析，按选项顺序重复指定")
+	rest, err := env.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usageError("edit <ID> [-title ..] [-answer ..]... [-right A,B] [-tag ..]... | -file 文件 | -editor")
+	}
+	id, err := parseID(rest[0])
+	if err != nil {
+		return err
+	}
+
+	// 1. 读取当前内容
+	data, err := env.client.Do("GET", "/api/stats/byid/"+strconv.Itoa(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	var q question
+	if err := json.Unmarshal(data, &q); err != nil {
+		return fmt.Errorf("解析题目失败: %w", err)
+	}
+
+	// 2. 应用修改
+	switch {
+	case *file != "":
+		var edited question
+		if err := decodeFile(*file, &edited); err != nil {
+			return err
+		}
+		q = edited
+	case *editor:
+		edited, changed, err := editQuestion(q)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			fmt.Fprintln(os.Stderr, "没有修改")
+			return nil
+		}
+		q = edited
+	default:
+		set := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) {
+			if !isGlobalFlag(f.Name) {
+				set[f.Name] = true
+			}
+		})
+		if len(set) == 0 {
+			return usageError("edit <ID> 需要至少一个修改项，或使用 -file、-editor")
+		}
+		if set["title"] {
+			q.Title = *title
+		}
+		if set["type"] {
+			q.Type = *typ
+		}
+		if set["hint"] {
+			q.Hint = *hint
+		}
+		if set["reference"] {
+			q.Reference = *reference
+		}
+		if set["answer"] {
+			q.Answers = answers
+		}
+		if set["right"] {
+			q.Rights = splitList(rights)
+		}
+		if set["tag"] {
+			q.Tags = tags
+		}
+		if set["explanation"] {
+			q.Explanations = explanations
+		}
+	}
+	q.ID = id
+
+	// 3. 提交
+	result, err := env.client.Do("PUT", "/api/questions/update", nil, q)
+	if err != nil {
+		return err
+	}
+	return env.print(result, nil)
+}
+
+// editQuestion 在编辑器中修改题目，返回修改后的内容与是否有改动
+func editQuestion(q question) (question, bool, error) {
+	original, err := yaml.Marshal(q)
+	if err != nil {
+		return q, false, err
+	}
+	f, err := os.CreateTemp("", fmt.Sprintf("qbank-%d-*.yaml", q.ID))
+	if err != nil {
+		return q, false, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(original); err != nil {
+		f.Close()
+		return q, false, err
+	}
+	f.Close()
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	// EDITOR 可以带参数，如 "code --wait"
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return q, false, fmt.Errorf("编辑器退出: %w", err)
+	}
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return q, false, err
+	}
+	if string(edited) == string(original) {
+		return q, false, nil
+	}
+	var result question
+	if err := yaml.Unmarshal(edited, &result); err != nil {
+		return q, false, fmt.Errorf("解析修改后的题目失败: %w", err)
+	}
+	return result, true, nil
+}
+
+func runDelete(env *cmdEnv, args []string) error {
+	fs := newFlagSet("delete", env.global)
+	yes := fs.Bool("y", false, "不询问，直接删除")
+	rest, err := env.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return usageError("delete <ID>... [-y]")
+	}
+	ids := make([]int, 0, len(rest))
+	for _, s := range splitList(rest) {
+		id, err := parseID(s)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if !*yes && !confirm(fmt.Sprintf("确定删除 %d 道题？", len(ids))) {
+		return fmt.Errorf("已取消")
+	}
+	result, err := env.client.Do("DELETE", "/api/questions/batch-delete", nil, map[string]interface{}{"ids": ids})
+	if err != nil {
+		return err
+	}
+	return env.print(result, nil)
+}
+
+// runImport 导入 JSON/YAML 题目数组或导出的 CSV，分批提交
+func runImport(env *cmdEnv, args []string) error {
+	fs := newFlagSet("import", env.global)
+	source := fs.String("source", "", "覆盖题目来源，如 hand；默认使用文件中的来源")
+	rest, err := env.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usageError("import <文件.json|.yaml|.csv> [-source hand]")
+	}
+	var questions []question
+	if strings.EqualFold(filepath.Ext(rest[0]), ".csv") {
+		questions, err = readQuestionsCSV(rest[0])
+	} else {
+		err = decodeFile(rest[0], &questions)
+	}
+	if err != nil {
+		return err
+	}
+	if len(questions) == 0 {
+		return fmt.Errorf("%s 中没有题目", rest[0])
+	}
+	for i := range questions {
+		questions[i].ID = 0 // 导出文件中的ID由服务端重新分配
+		if *source != "" {
+			questions[i].Source = *source
+		}
+	}
+	ids, err := insertQuestions(env.client, questions)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已导入 %d 道题\n", len(ids))
+	return env.print(map[string]interface{}{"imported": len(ids), "ids": ids}, nil)
+}
+
+// insertQuestions 分批调用批量插入接口，返回新题目的ID；某一批失败时之前的批次已经保存
+func insertQuestions(client *Client, questions []question) ([]int, error) {
+	var ids []int
+	for start := 0; start < len(questions); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(questions) {
+			end = len(questions)
+		}
+		data, err := client.Do("POST", "/api/questions/batch-insert", nil, questions[start:end])
+		if err != nil {
+			if start > 0 {
+				return ids, fmt.Errorf("第 %d-%d 道题导入失败（之前的 %d 道已保存）: %w", start+1, end, start, err)
+			}
+			return nil, err
+		}
+		var result struct {
+			IDs []int `json:"ids"`
+		}
+		_ = json.Unmarshal(data, &result)
+		ids = append(ids, result.IDs...)
+	}
+	return ids, nil
+}
+
+// readQuestionsCSV 读取 export -format csv 导出的表格：选项与解析按 option_X、explanation_X 列展开
+func readQuestionsCSV(path string) ([]question, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(bufio.NewReader(f))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("解析 CSV 失败: %w", err)
+	}
+	if len(records) < 1 {
+		return nil, nil
+	}
+	header := records[0]
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	var questions []question
+	for line, row := range records[1:] {
+		get := func(name string) string {
+			for i, h := range header {
+				if h == name && i < len(row) {
+					return strings.TrimSpace(row[i])
+				}
+			}
+			return ""
+		}
+		q := question{
+			Title:     get("title"),
+			Language:  get("language"),
+			Hint:      get("hint"),
+			Reference: get("reference"),
+			Source:    get("source"),
+			Locale:    get("locale"),
+		}
+		if q.Type, err = strconv.Atoi(get("type")); err != nil {
+			return nil, fmt.Errorf("第 %d 行: 无效的题型 %q", line+2, get("type"))
+		}
+		for i := 0; ; i++ {
+			letter := string(rune('A' + i))
+			name := "option_" + letter
+			if !contains(header, name) {
+				break
+			}
+			if option := get(name); option != "" {
+				q.Answers = append(q.Answers, option)
+				q.Explanations = append(q.Explanations, get("explanation_"+letter))
+			}
+		}
+		if strings.Join(q.Explanations, "") == "" {
+			q.Explanations = nil
+		}
+		if rights := get("rights"); rights != "" {
+			q.Rights = strings.Split(rights, ",")
+		}
+		if tags := get("tags"); tags != "" {
+			q.Tags = strings.Split(tags, ";")
+		}
+		questions = append(questions, q)
+	}
+	return questions, nil
+}
+
+// runExport 下载导出文件，默认使用服务端给出的文件名保存在当前目录，-out - 输出到标准输出
+func runExport(env *cmdEnv, args []string) error {
+	fs := newFlagSet("export", env.global)
+	format := fs.String("format", "json", "导出格式 json|csv|zip（zip 包含图片）")
+	typ := fs.String("type", "", "题型")
+	language := fs.String("language", "", "编程语言")
+	tag := fs.String("tag", "", "标签")
+	locale := fs.String("locale", "", "内容语言")
+	ids := fs.String("ids", "", "题目ID，逗号分隔")
+	out := fs.String("out", "", "保存路径，- 表示标准输出")
+	if _, err := env.parse(fs, args); err != nil {
+		return err
+	}
+	query := url.Values{"format": {*format}}
+	for key, value := range map[string]string{"type": *typ, "language": *language, "tag": *tag, "locale": *locale, "ids": *ids} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	resp, err := env.client.Download("GET", "/api/questions/export", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var w io.Writer = os.Stdout
+	path := *out
+	if path != "-" {
+		if path == "" {
+			path = "questions." + *format
+			if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+				path = filepath.Base(params["filename"])
+			}
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return fmt.Errorf("下载导出文件失败: %w", err)
+	}
+	if path != "-" {
+		fmt.Fprintf(os.Stderr, "已导出到 %s（%d 字节）\n", path, n)
+	}
+	return nil
+}
+
+// decodeFile 按扩展名解析 JSON 或 YAML 文件
+func decodeFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, v)
+	default:
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	return nil
+}
+
+func parseID(s string) (int, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("无效的ID: %s", s)
+	}
+	return id, nil
+}
+
+// splitList 展开逗号分隔的参数，如 -right A,B 与 -right A -right B 等价
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, part)
+			}
+		}
+	}
+	return list
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// confirm 在终端中询问确认，标准输入不是终端时视为拒绝（脚本中应使用 -y）
+func confirm(prompt string) bool {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	fmt.Fprint(os.Stderr, prompt+" [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -1,17 +1,137 @@
 package config
 
 import (
-	"fmt"
-	"os"
+	"encoding/json"
 	"time"
-
-	"github.com/joho/godotenv"
 )
 
+// AIConfig 服务配置：默认值 < 配置文件(YAML/TOML) < 环境变量
 type AIConfig struct {
-	DeepSeekKey string
-	TongyiKey   string
-	Timeout     time.Duration
+	DeepSeek     ProviderConfig
+	Tongyi       ProviderConfig
+	DefaultModel string        // 未指定模型时使用的AI服务
+	Timeout      time.Duration // 单次AI调用超时
+	Temperature  float32
+	MaxTokens    int
+	Prompt       PromptConfig
+
+	AnalyticsCacheTTL time.Duration // 统计结果缓存时间
+	Cache             CacheConfig   // AI出题结果缓存
+
+	Server          ServerConfig
+	ShutdownTimeout time.Duration // 退出时等待进行中请求与后台任务的最长时间
+	Storage         StorageConfig
+	Telemetry       TelemetryConfig
+	Exam            ExamConfig
+	Events          EventsConfig
+	Backup          BackupConfig
+	LTI             LTIConfig
+	Embedding       EmbeddingConfig
+	Retention       RetentionConfig
+	Feedback        FeedbackConfig
+
+	File           string        // 配置文件路径，未使用配置文件时为空
+	ReloadInterval time.Duration // 检查配置文件修改的间隔，0表示只响应SIGHUP
+}
+
+// ProviderConfig 单个AI服务的接入配置
+type ProviderConfig struct {
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	Model    string `yaml:"model" toml:"model"`
+	APIKey   string `yaml:"api_key" toml:"api_key"`
+
+	// 每千token价格（元），用于估算批量出题的费用，未配置时费用为0
+	PromptPrice     float64 `yaml:"prompt_price" toml:"prompt_price"`
+	CompletionPrice float64 `yaml:"completion_price" toml:"completion_price"`
+}
+
+// PromptConfig 出题提示词的可调部分
+type PromptConfig struct {
+	System     string   `yaml:"system" toml:"system"`           // 覆盖默认的system提示词
+	ExtraRules []string `yaml:"extra_rules" toml:"extra_rules"` // 追加到"必须遵守"列表末尾的规则
+}
+
+type ServerConfig struct {
+	Port       int    `yaml:"port" toml:"port"`
+	GRPCPort   int    `yaml:"grpc_port" toml:"grpc_port"` // gRPC 服务端口，0 表示不启动
+	CORSOrigin string `yaml:"cors_origin" toml:"cors_origin"`
+}
+
+// CacheConfig AI出题结果缓存，相同请求在有效期内直接返回上次的结果
+type CacheConfig struct {
+	Backend string        // none/memory/sqlite，none 时不缓存也不合并并发请求
+	TTL     time.Duration // 缓存有效期
+}
+
+// TelemetryConfig 链路追踪配置（/metrics 始终开启）
+type TelemetryConfig struct {
+	ServiceName  string  `yaml:"service_name" toml:"service_name"`
+	Exporter     string  `yaml:"exporter" toml:"exporter"`           // none/stdout/otlp，none时仍生成trace id
+	OTLPEndpoint string  `yaml:"otlp_endpoint" toml:"otlp_endpoint"` // otlp导出地址，如 localhost:4318
+	SampleRatio  float64 `yaml:"sample_ratio" toml:"sample_ratio"`   // 采样比例 0-1
+}
+
+// ExamConfig 试卷导出配置，PDF需要包含中文字形的TrueType字体
+type ExamConfig struct {
+	Font     string `yaml:"font" toml:"font"`           // 正文字体（.ttf），为空时在常见位置查找
+	CodeFont string `yaml:"code_font" toml:"code_font"` // 代码等宽字体（.ttf），为空时纯ASCII代码使用Courier
+}
+
+// EventsConfig 题库变更事件的保留时间与Webhook投递策略
+type EventsConfig struct {
+	WebhookTimeout time.Duration // 单次投递的超时时间
+	MaxAttempts    int           // 最多投递次数（含首次），用尽后标记为失败
+	RetryBase      time.Duration // 首次重试的等待时间，之后每次翻倍
+	RetryMax       time.Duration // 重试等待时间上限
+	Retention      time.Duration // 事件与投递记录的保留时间
+
+	AllowPrivateTargets bool // 允许 Webhook 指向本机与内网地址，仅用于本地开发
+}
+
+// BackupConfig 数据库备份：定时备份的目录、间隔与保留份数
+type BackupConfig struct {
+	Dir        string        // 备份目录
+	Interval   time.Duration // 定时备份间隔，0 表示不定时备份
+	Keep       int           // 保留最近的定时备份份数，手动备份不会自动删除
+	AdminToken string        // 备份管理接口的令牌（X-Admin-Token），为空时禁用这些接口
+}
+
+// LTIConfig LTI 1.3 工具（Tool）配置，平台（LMS）在管理接口中登记
+type LTIConfig struct {
+	KeyFile    string        // 工具签名私钥（PEM），不存在时自动生成
+	BaseURL    string        // 本服务对外的地址，用于生成登录、启动与 JWKS 地址
+	LaunchURL  string        // 启动成功后跳转的答题页面，为空时使用内置页面
+	StateTTL   time.Duration // OIDC 登录发起到启动之间 state 的有效期
+	SessionTTL time.Duration // 启动后答题会话的有效期
+}
+
+// EmbeddingConfig 题目向量索引：local 为本地的哈希 TF-IDF 向量，不需要网络；
+// tongyi/openai 调用兼容 OpenAI 的 embeddings 接口
+type EmbeddingConfig struct {
+	Provider     string        // local/tongyi/openai，更换后索引会全部重建
+	Endpoint     string        // 接口地址（不含 /embeddings），tongyi 未配置时沿用 ai.tongyi.endpoint
+	Model        string        // 向量模型
+	APIKey       string        // tongyi 未配置时沿用 ai.tongyi.api_key
+	Dimensions   int           // local 的向量维度
+	BatchSize    int           // 每次请求计算的题目数
+	SyncInterval time.Duration // 定期核对题目与索引的间隔，题目变更事件会立即触发核对
+}
+
+// RetentionConfig 题库清理：按各工作区的策略定时归档久未使用的题目、删除被驳回的草稿
+type RetentionConfig struct {
+	Interval time.Duration // 定时执行的间隔，0 表示只能手动执行
+	KeepRuns int           // 每个工作区保留的执行记录条数
+}
+
+// FeedbackConfig 学生对题目的反馈（答案错误、表述歧义、错别字等）
+type FeedbackConfig struct {
+	SuspendThreshold int // 作答过该题的学生未处理的反馈达到该数量时题目暂停用于考试，0 表示不暂停
+}
+
+type StorageConfig struct {
+	DBPath        string `yaml:"db_path" toml:"db_path"`
+	LogDir        string `yaml:"log_dir" toml:"log_dir"`
+	AttachmentDir string `yaml:"attachment_dir" toml:"attachment_dir"` // 题目图片等附件的存储目录
 }
 
 const (
@@ -20,23 +140,59 @@ const (
 	Coding       int = 3
 )
 
+// 题目来源
+const (
+	SourceHand = "hand" // 手动录入
+	SourceAI   = "ai"   // AI生成
+
+	SourceTranslation = "translation" // 由其他语言版本翻译而来
+)
+
+// 题目内容语言
+const (
+	LocaleZh = "zh-CN"
+	LocaleEn = "en-US"
+)
+
+// 题目状态
+const (
+	StatusActive   = "active"
+	StatusDraft    = "draft"    // 草稿，待审核
+	StatusRejected = "rejected" // 审核未通过的草稿
+	StatusArchived = "archived" // 已归档：不参与练习，不计入题目数上限，默认不在列表中显示
+)
+
 type QuestionRequest struct {
 	Model    string `json:"model" binding:"omitempty,oneof=deepseek tongyi"`                  // 非必选，默认tongyi
 	Language string `json:"language" binding:"omitempty,oneof=go java python javascript c++ css html"` // 非必选，默认go
 	Count    int    `json:"count" binding:"omitempty,min=3,max=10"` 
 	Type     int    `json:"type" binding:"omitempty,oneof=1 2 3"`
 	Keyword  string `json:"keyword" binding:"required"` // 必选参数
+	Cache    string `json:"cache,omitempty" binding:"omitempty,oneof=bypass"` // bypass 跳过缓存，重新生成
 }
 
 
 type QuestionResponse struct {
-	Title   string   `json:"title"`
-	Answers []string `json:"answers"`
-	Rights  []string `json:"rights"`
+	Title        string   `json:"title"`
+	Answers      []string `json:"answers"`
+	Rights       []string `json:"rights"`
+	Explanations []string `json:"explanations"` // 每个选项对错的解析，与answers一一对应
+	Hint         string   `json:"hint"`         // 简短提示（不直接透露答案）
+	Reference    string   `json:"reference"`    // 参考资料链接
 }
 
 type QuestionResponses struct {
 	Questions []QuestionResponse `json:"questions"`
+	Cache     string             `json:"cache,omitempty"` // 缓存状态：hit/coalesced/miss/bypass，未启用缓存时为空
+	Usage     *TokenUsage        `json:"usage,omitempty"` // 生成这些题目消耗的token（命中缓存时为原始调用的消耗）
+	Repairs   []string           `json:"repairs,omitempty"` // 解析AI响应时所做的修复，如去除代码块标记、补全被截断的输出
+}
+
+// TokenUsage AI调用的token消耗与估算费用
+type TokenUsage struct {
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Cost             float64 `json:"cost"` // 元，按配置的单价估算
 }
 
 type QuestionRequest1 struct {
@@ -46,6 +202,47 @@ type QuestionRequest1 struct {
 	Language string   `json:"language"` // 语言
 	Answers  []string `json:"answers"`  // 所有选项
 	Rights   []string `json:"rights"`   // 正确答案
+	Tags     []string `json:"tags"`     // 标签（课程、知识点等）
+
+	Explanations []string `json:"explanations"` // 选项解析
+	Hint         string   `json:"hint"`         // 提示
+	Reference    string   `json:"reference"`    // 参考链接
+
+	Locale string `json:"locale" binding:"omitempty,oneof=zh-CN en-US"` // 内容语言，默认zh-CN
+
+	// 修改题目时请求中是否包含 hint/reference：包含时按请求修改（空字符串表示清空），不包含时保留原值
+	HintSet      bool `json:"-"`
+	ReferenceSet bool `json:"-"`
+}
+
+// UnmarshalJSON 解析请求并记录 hint 与 reference 字段是否出现
+func (r *QuestionRequest1) UnmarshalJSON(data []byte) error {
+	type plain QuestionRequest1
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	_, r.HintSet = fields["hint"]
+	_, r.ReferenceSet = fields["reference"]
+	return nil
+}
+
+// Translation 题目译文（答案字母不参与翻译）
+type Translation struct {
+	Title        string   `json:"title"`
+	Answers      []string `json:"answers"`
+	Explanations []string `json:"explanations"`
+	Hint         string   `json:"hint"`
+}
+
+// Explanation 题目解析（AI补写时使用）
+type Explanation struct {
+	Explanations []string `json:"explanations"`
+	Hint         string   `json:"hint"`
+	Reference    string   `json:"reference"`
 }
 type AILog struct {
     AIRes      QuestionResponses `json:"aiRes"`  
@@ -55,35 +252,7 @@ type AILog struct {
     AIStartTime string           `json:"aiStartTime"`
     AIEndTime   string           `json:"aiEndTime"`
     AICostTime  string           `json:"aiCostTime"`
-}
-
-func LoadConfig() (*AIConfig, error) {
-	_ = godotenv.Load() // 自动加载.env文件
-
-	cfg := &AIConfig{
-		DeepSeekKey: getEnv("DEEPSEEK_API_KEY"),
-		TongyiKey:   getEnv("TONGYI_API_KEY"),
-		Timeout:     getEnvAsDuration("API_TIMEOUT", 30*time.Second),
-	}
-
-	// 关键修改：只要配置了任一API密钥即可
-	if cfg.DeepSeekKey == "" && cfg.TongyiKey == "" {
-		return nil, fmt.Errorf("至少需要配置一个API密钥（DEEPSEEK_API_KEY或TONGYI_API_KEY）")
-	}
-
-	return cfg, nil
-}
-
-// 辅助函数
-func getEnv(key string) string {
-	return os.Getenv(key)
-}
-
-func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if parsed, err := time.ParseDuration(value); err == nil {
-			return parsed
-		}
-	}
-	return defaultValue
+    TraceID     string           `json:"traceId,omitempty"` // 链路追踪ID，可在追踪系统中查询本次调用
+    Cache       string           `json:"cache,omitempty"`   // hit 表示命中缓存，coalesced 表示与并发的相同请求合并
+    WorkspaceID int              `json:"workspaceId,omitempty"` // 发起调用的工作区，旧日志没有该字段，按默认工作区统计
 }
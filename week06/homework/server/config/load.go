@@ -0,0 +1,576 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 未指定配置文件时依次查找的默认文件
+var defaultConfigFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
+// 配置文件结构，文件中未出现的字段沿用默认值
+type fileConfig struct {
+	Server    fileServer      `yaml:"server" toml:"server"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+	Telemetry TelemetryConfig `yaml:"telemetry" toml:"telemetry"`
+	AI        fileAIConfig    `yaml:"ai" toml:"ai"`
+	Analytics fileAnalytics   `yaml:"analytics" toml:"analytics"`
+	Cache     fileCache       `yaml:"cache" toml:"cache"`
+	Exam      ExamConfig      `yaml:"exam" toml:"exam"`
+	Events    fileEvents      `yaml:"events" toml:"events"`
+	Backup    fileBackup      `yaml:"backup" toml:"backup"`
+	LTI       fileLTI         `yaml:"lti" toml:"lti"`
+	Embedding fileEmbedding   `yaml:"embedding" toml:"embedding"`
+	Retention fileRetention   `yaml:"retention" toml:"retention"`
+	Feedback  fileFeedback    `yaml:"feedback" toml:"feedback"`
+	Reload    fileReloadBlock `yaml:"reload" toml:"reload"`
+}
+
+type fileAIConfig struct {
+	DefaultModel string         `yaml:"default_model" toml:"default_model"`
+	Timeout      string         `yaml:"timeout" toml:"timeout"`
+	Temperature  float32        `yaml:"temperature" toml:"temperature"`
+	MaxTokens    int            `yaml:"max_tokens" toml:"max_tokens"`
+	DeepSeek     ProviderConfig `yaml:"deepseek" toml:"deepseek"`
+	Tongyi       ProviderConfig `yaml:"tongyi" toml:"tongyi"`
+	Prompt       PromptConfig   `yaml:"prompt" toml:"prompt"`
+}
+
+type fileServer struct {
+	ServerConfig    `yaml:",inline"`
+	ShutdownTimeout string `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type fileAnalytics struct {
+	CacheTTL string `yaml:"cache_ttl" toml:"cache_ttl"`
+}
+
+type fileCache struct {
+	Backend string `yaml:"backend" toml:"backend"`
+	TTL     string `yaml:"ttl" toml:"ttl"`
+}
+
+type fileEvents struct {
+	WebhookTimeout string `yaml:"webhook_timeout" toml:"webhook_timeout"`
+	MaxAttempts    int    `yaml:"max_attempts" toml:"max_attempts"`
+	RetryBase      string `yaml:"retry_base" toml:"retry_base"`
+	RetryMax       string `yaml:"retry_max" toml:"retry_max"`
+	Retention      string `yaml:"retention" toml:"retention"`
+
+	AllowPrivateTargets bool `yaml:"allow_private_targets" toml:"allow_private_targets"`
+}
+
+type fileBackup struct {
+	Dir        string `yaml:"dir" toml:"dir"`
+	Interval   string `yaml:"interval" toml:"interval"`
+	Keep       int    `yaml:"keep" toml:"keep"`
+	AdminToken string `yaml:"admin_token" toml:"admin_token"`
+}
+
+type fileLTI struct {
+	KeyFile    string `yaml:"key_file" toml:"key_file"`
+	BaseURL    string `yaml:"base_url" toml:"base_url"`
+	LaunchURL  string `yaml:"launch_url" toml:"launch_url"`
+	StateTTL   string `yaml:"state_ttl" toml:"state_ttl"`
+	SessionTTL string `yaml:"session_ttl" toml:"session_ttl"`
+}
+
+type fileEmbedding struct {
+	Provider     string `yaml:"provider" toml:"provider"`
+	Endpoint     string `yaml:"endpoint" toml:"endpoint"`
+	Model        string `yaml:"model" toml:"model"`
+	APIKey       string `yaml:"api_key" toml:"api_key"`
+	Dimensions   int    `yaml:"dimensions" toml:"dimensions"`
+	BatchSize    int    `yaml:"batch_size" toml:"batch_size"`
+	SyncInterval string `yaml:"sync_interval" toml:"sync_interval"`
+}
+
+type fileRetention struct {
+	Interval string `yaml:"interval" toml:"interval"`
+	KeepRuns int    `yaml:"keep_runs" toml:"keep_runs"`
+}
+
+type fileFeedback struct {
+	SuspendThreshold int `yaml:"suspend_threshold" toml:"suspend_threshold"`
+}
+
+type fileReloadBlock struct {
+	Interval string `yaml:"interval" toml:"interval"`
+}
+
+func defaultFileConfig() fileConfig {
+	return fileConfig{
+		Server: fileServer{
+			ServerConfig:    ServerConfig{Port: 8080, GRPCPort: 9090, CORSOrigin: "http://localhost:3000"},
+			ShutdownTimeout: "30s",
+		},
+		Storage: StorageConfig{DBPath: "question_service.db", LogDir: "log", AttachmentDir: "attachments"},
+		Telemetry: TelemetryConfig{
+			ServiceName: "question-service",
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+		AI: fileAIConfig{
+			DefaultModel: "tongyi",
+			Timeout:      "30s",
+			Temperature:  0.3,
+			MaxTokens:    2000,
+			DeepSeek:     ProviderConfig{Endpoint: "https://ai.forestsx.top/v1", Model: "deepseek-chat"},
+			Tongyi:       ProviderConfig{Endpoint: "https://dashscope.aliyuncs.com/compatible-mode/v1", Model: "qwen-turbo"},
+		},
+		Analytics: fileAnalytics{CacheTTL: "1m"},
+		Cache:     fileCache{Backend: "none", TTL: "30m"},
+		Events: fileEvents{
+			WebhookTimeout: "10s",
+			MaxAttempts:    8,
+			RetryBase:      "10s",
+			RetryMax:       "1h",
+			Retention:      "720h",
+		},
+		Backup:    fileBackup{Dir: "backup", Interval: "24h", Keep: 7},
+		LTI:       fileLTI{KeyFile: "lti_key.pem", BaseURL: "http://localhost:8080", StateTTL: "10m", SessionTTL: "4h"},
+		Embedding: fileEmbedding{Provider: "local", Dimensions: 512, BatchSize: 10, SyncInterval: "10m"},
+		Retention: fileRetention{Interval: "24h", KeepRuns: 100},
+		Feedback:  fileFeedback{SuspendThreshold: 3},
+		Reload:    fileReloadBlock{Interval: "5s"},
+	}
+}
+
+// LoadConfig 加载配置：默认值 < 配置文件 < 环境变量(.env)
+// path 为空时读取环境变量 CONFIG_FILE，仍为空则查找当前目录下的 config.yaml/config.yml/config.toml
+func LoadConfig(path string) (*AIConfig, error) {
+	_ = godotenv.Load() // 自动加载.env文件
+
+	fc := defaultFileConfig()
+
+	// 1. 配置文件
+	path, err := resolveConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if err := decodeFile(path, &fc); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. 环境变量覆盖
+	var problems []string
+	applyEnv(&fc, &problems)
+
+	// 3. 转换并校验
+	cfg := fc.build(&problems)
+	cfg.File = path
+	cfg.validate(&problems)
+	if len(problems) > 0 {
+		source := "环境变量"
+		if path != "" {
+			source = path + " 及环境变量"
+		}
+		return nil, fmt.Errorf("配置校验失败（%s）:\n  - %s", source, strings.Join(problems, "\n  - "))
+	}
+	return cfg, nil
+}
+
+func resolveConfigFile(path string) (string, error) {
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("配置文件不可用: %w", err)
+		}
+		return path, nil
+	}
+	for _, name := range defaultConfigFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+func decodeFile(path string, fc *fileConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, fc)
+	case ".toml":
+		err = toml.Unmarshal(data, fc)
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s（仅支持 .yaml/.yml/.toml）", path)
+	}
+	if err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv 环境变量优先于配置文件，变量名与旧版保持兼容
+func applyEnv(fc *fileConfig, problems *[]string) {
+	strs := map[string]*string{
+		"DEEPSEEK_API_KEY":       &fc.AI.DeepSeek.APIKey,
+		"DEEPSEEK_ENDPOINT":      &fc.AI.DeepSeek.Endpoint,
+		"DEEPSEEK_MODEL":         &fc.AI.DeepSeek.Model,
+		"TONGYI_API_KEY":         &fc.AI.Tongyi.APIKey,
+		"TONGYI_ENDPOINT":        &fc.AI.Tongyi.Endpoint,
+		"TONGYI_MODEL":           &fc.AI.Tongyi.Model,
+		"DEFAULT_MODEL":          &fc.AI.DefaultModel,
+		"API_TIMEOUT":            &fc.AI.Timeout,
+		"ANALYTICS_CACHE_TTL":    &fc.Analytics.CacheTTL,
+		"CORS_ORIGIN":            &fc.Server.CORSOrigin,
+		"DB_PATH":                &fc.Storage.DBPath,
+		"LOG_DIR":                &fc.Storage.LogDir,
+		"ATTACHMENT_DIR":         &fc.Storage.AttachmentDir,
+		"CONFIG_RELOAD_INTERVAL": &fc.Reload.Interval,
+		"SHUTDOWN_TIMEOUT":       &fc.Server.ShutdownTimeout,
+		"AI_CACHE":               &fc.Cache.Backend,
+		"AI_CACHE_TTL":           &fc.Cache.TTL,
+		"OTEL_SERVICE_NAME":      &fc.Telemetry.ServiceName,
+		"TRACE_EXPORTER":         &fc.Telemetry.Exporter,
+		"OTLP_ENDPOINT":          &fc.Telemetry.OTLPEndpoint,
+		"EXAM_FONT":              &fc.Exam.Font,
+		"EXAM_CODE_FONT":         &fc.Exam.CodeFont,
+		"WEBHOOK_TIMEOUT":        &fc.Events.WebhookTimeout,
+		"EVENT_RETENTION":        &fc.Events.Retention,
+		"BACKUP_DIR":             &fc.Backup.Dir,
+		"BACKUP_INTERVAL":        &fc.Backup.Interval,
+		"BACKUP_ADMIN_TOKEN":     &fc.Backup.AdminToken,
+		"LTI_KEY_FILE":           &fc.LTI.KeyFile,
+		"LTI_BASE_URL":           &fc.LTI.BaseURL,
+		"LTI_LAUNCH_URL":         &fc.LTI.LaunchURL,
+		"EMBEDDING_PROVIDER":     &fc.Embedding.Provider,
+		"EMBEDDING_ENDPOINT":     &fc.Embedding.Endpoint,
+		"EMBEDDING_MODEL":        &fc.Embedding.Model,
+		"EMBEDDING_API_KEY":      &fc.Embedding.APIKey,
+		"RETENTION_INTERVAL":     &fc.Retention.Interval,
+	}
+	for key, dest := range strs {
+		if value := os.Getenv(key); value != "" {
+			*dest = value
+		}
+	}
+
+	if value := os.Getenv("SERVER_PORT"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("SERVER_PORT 不是有效的整数: %q", value))
+		} else {
+			fc.Server.Port = port
+		}
+	}
+	if value := os.Getenv("GRPC_PORT"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("GRPC_PORT 不是有效的整数: %q", value))
+		} else {
+			fc.Server.GRPCPort = port
+		}
+	}
+	if value := os.Getenv("AI_TEMPERATURE"); value != "" {
+		t, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("AI_TEMPERATURE 不是有效的数字: %q", value))
+		} else {
+			fc.AI.Temperature = float32(t)
+		}
+	}
+	if value := os.Getenv("AI_MAX_TOKENS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("AI_MAX_TOKENS 不是有效的整数: %q", value))
+		} else {
+			fc.AI.MaxTokens = n
+		}
+	}
+	if value := os.Getenv("WEBHOOK_ALLOW_PRIVATE"); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("WEBHOOK_ALLOW_PRIVATE 不是有效的布尔值: %q", value))
+		} else {
+			fc.Events.AllowPrivateTargets = allow
+		}
+	}
+	if value := os.Getenv("FEEDBACK_SUSPEND_THRESHOLD"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("FEEDBACK_SUSPEND_THRESHOLD 不是有效的整数: %q", value))
+		} else {
+			fc.Feedback.SuspendThreshold = n
+		}
+	}
+}
+
+func (fc fileConfig) build(problems *[]string) *AIConfig {
+	// 解析失败时记录问题并使用默认值，避免同一字段重复报错
+	defaults := defaultFileConfig()
+	duration := func(name, value, fallback string) time.Duration {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s 不是有效的时长（如 30s、1m）: %q", name, value))
+			d, _ = time.ParseDuration(fallback)
+		}
+		return d
+	}
+
+	return &AIConfig{
+		DeepSeek:          fc.AI.DeepSeek,
+		Tongyi:            fc.AI.Tongyi,
+		DefaultModel:      fc.AI.DefaultModel,
+		Timeout:           duration("ai.timeout", fc.AI.Timeout, defaults.AI.Timeout),
+		Temperature:       fc.AI.Temperature,
+		MaxTokens:         fc.AI.MaxTokens,
+		Prompt:            fc.AI.Prompt,
+		AnalyticsCacheTTL: duration("analytics.cache_ttl", fc.Analytics.CacheTTL, defaults.Analytics.CacheTTL),
+		Server:            fc.Server.ServerConfig,
+		ShutdownTimeout:   duration("server.shutdown_timeout", fc.Server.ShutdownTimeout, defaults.Server.ShutdownTimeout),
+		Storage:           fc.Storage,
+		Telemetry:         fc.Telemetry,
+		Exam:              fc.Exam,
+		ReloadInterval:    duration("reload.interval", fc.Reload.Interval, defaults.Reload.Interval),
+		Cache: CacheConfig{
+			Backend: fc.Cache.Backend,
+			TTL:     duration("cache.ttl", fc.Cache.TTL, defaults.Cache.TTL),
+		},
+		Events: EventsConfig{
+			WebhookTimeout: duration("events.webhook_timeout", fc.Events.WebhookTimeout, defaults.Events.WebhookTimeout),
+			MaxAttempts:    fc.Events.MaxAttempts,
+			RetryBase:      duration("events.retry_base", fc.Events.RetryBase, defaults.Events.RetryBase),
+			RetryMax:       duration("events.retry_max", fc.Events.RetryMax, defaults.Events.RetryMax),
+			Retention:      duration("events.retention", fc.Events.Retention, defaults.Events.Retention),
+
+			AllowPrivateTargets: fc.Events.AllowPrivateTargets,
+		},
+		Backup: BackupConfig{
+			Dir:        fc.Backup.Dir,
+			Interval:   duration("backup.interval", fc.Backup.Interval, defaults.Backup.Interval),
+			Keep:       fc.Backup.Keep,
+			AdminToken: fc.Backup.AdminToken,
+		},
+		LTI: LTIConfig{
+			KeyFile:    fc.LTI.KeyFile,
+			BaseURL:    strings.TrimRight(fc.LTI.BaseURL, "/"),
+			LaunchURL:  fc.LTI.LaunchURL,
+			StateTTL:   duration("lti.state_ttl", fc.LTI.StateTTL, defaults.LTI.StateTTL),
+			SessionTTL: duration("lti.session_ttl", fc.LTI.SessionTTL, defaults.LTI.SessionTTL),
+		},
+		Embedding: fc.embedding(duration("embedding.sync_interval", fc.Embedding.SyncInterval, defaults.Embedding.SyncInterval)),
+		Retention: RetentionConfig{
+			Interval: duration("retention.interval", fc.Retention.Interval, defaults.Retention.Interval),
+			KeepRuns: fc.Retention.KeepRuns,
+		},
+		Feedback: FeedbackConfig{SuspendThreshold: fc.Feedback.SuspendThreshold},
+	}
+}
+
+// embedding tongyi 未单独配置地址与密钥时沿用出题使用的通义千问配置
+func (fc fileConfig) embedding(syncInterval time.Duration) EmbeddingConfig {
+	e := EmbeddingConfig{
+		Provider:     fc.Embedding.Provider,
+		Endpoint:     fc.Embedding.Endpoint,
+		Model:        fc.Embedding.Model,
+		APIKey:       fc.Embedding.APIKey,
+		Dimensions:   fc.Embedding.Dimensions,
+		BatchSize:    fc.Embedding.BatchSize,
+		SyncInterval: syncInterval,
+	}
+	if e.Provider == "tongyi" {
+		if e.Endpoint == "" {
+			e.Endpoint = fc.AI.Tongyi.Endpoint
+		}
+		if e.APIKey == "" {
+			e.APIKey = fc.AI.Tongyi.APIKey
+		}
+		if e.Model == "" {
+			e.Model = "text-embedding-v3"
+		}
+	}
+	e.Endpoint = strings.TrimRight(e.Endpoint, "/")
+	return e
+}
+
+func (cfg *AIConfig) validate(problems *[]string) {
+	add := func(format string, args ...interface{}) {
+		*problems = append(*problems, fmt.Sprintf(format, args...))
+	}
+
+	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
+		add("server.port 必须在 1-65535 之间，当前为 %d", cfg.Server.Port)
+	}
+	if cfg.Server.GRPCPort < 0 || cfg.Server.GRPCPort > 65535 {
+		add("server.grpc_port 必须在 0-65535 之间（0 表示不启动），当前为 %d", cfg.Server.GRPCPort)
+	} else if cfg.Server.GRPCPort == cfg.Server.Port {
+		add("server.grpc_port 不能与 server.port 相同")
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		add("server.shutdown_timeout 必须大于0")
+	}
+	if cfg.Storage.DBPath == "" {
+		add("storage.db_path 不能为空")
+	}
+	if cfg.Storage.LogDir == "" {
+		add("storage.log_dir 不能为空")
+	}
+	if cfg.Storage.AttachmentDir == "" {
+		add("storage.attachment_dir 不能为空")
+	}
+
+	// 关键修改：只要配置了任一API密钥即可
+	if cfg.DeepSeek.APIKey == "" && cfg.Tongyi.APIKey == "" {
+		add("至少需要配置一个API密钥（DEEPSEEK_API_KEY或TONGYI_API_KEY）")
+	}
+	providers := map[string]ProviderConfig{"deepseek": cfg.DeepSeek, "tongyi": cfg.Tongyi}
+	for _, name := range []string{"deepseek", "tongyi"} {
+		p := providers[name]
+		if u, err := url.Parse(p.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("ai.%s.endpoint 不是有效的 http(s) 地址: %q", name, p.Endpoint)
+		}
+		if p.Model == "" {
+			add("ai.%s.model 不能为空", name)
+		}
+		if p.PromptPrice < 0 || p.CompletionPrice < 0 {
+			add("ai.%s 的 prompt_price/completion_price 不能为负数", name)
+		}
+	}
+	if p, ok := providers[cfg.DefaultModel]; !ok {
+		add("ai.default_model 只能是 deepseek 或 tongyi，当前为 %q", cfg.DefaultModel)
+	} else if p.APIKey == "" {
+		// 默认模型未配置密钥时改用第一个配置了密钥的服务，与只配置一个密钥的旧版 .env 兼容
+		for _, name := range []string{"deepseek", "tongyi"} {
+			if providers[name].APIKey != "" {
+				log.Printf("[CONFIG] 默认模型 %s 未配置API密钥，改用 %s", cfg.DefaultModel, name)
+				cfg.DefaultModel = name
+				break
+			}
+		}
+	}
+
+	switch cfg.Telemetry.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if cfg.Telemetry.OTLPEndpoint == "" {
+			add("telemetry.otlp_endpoint 不能为空（exporter 为 otlp 时）")
+		}
+	default:
+		add("telemetry.exporter 只能是 none、stdout 或 otlp，当前为 %q", cfg.Telemetry.Exporter)
+	}
+	if cfg.Telemetry.SampleRatio < 0 || cfg.Telemetry.SampleRatio > 1 {
+		add("telemetry.sample_ratio 必须在 0-1 之间，当前为 %g", cfg.Telemetry.SampleRatio)
+	}
+
+	if cfg.Timeout <= 0 {
+		add("ai.timeout 必须大于0")
+	}
+	if cfg.Temperature < 0 || cfg.Temperature > 2 {
+		add("ai.temperature 必须在 0-2 之间，当前为 %g", cfg.Temperature)
+	}
+	if cfg.MaxTokens < 256 || cfg.MaxTokens > 8192 {
+		add("ai.max_tokens 必须在 256-8192 之间，当前为 %d", cfg.MaxTokens)
+	}
+	switch cfg.Cache.Backend {
+	case "none", "memory", "sqlite":
+	default:
+		add("cache.backend 只能是 none、memory 或 sqlite，当前为 %q", cfg.Cache.Backend)
+	}
+	if cfg.Cache.TTL <= 0 {
+		add("cache.ttl 必须大于0")
+	}
+	for name, path := range map[string]string{"exam.font": cfg.Exam.Font, "exam.code_font": cfg.Exam.CodeFont} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			add("%s 字体文件不可用: %v", name, err)
+		} else if ext := strings.ToLower(filepath.Ext(path)); ext != ".ttf" {
+			add("%s 只支持 .ttf 字体，当前为 %q", name, path)
+		}
+	}
+	if cfg.Events.WebhookTimeout <= 0 || cfg.Events.RetryBase <= 0 {
+		add("events.webhook_timeout 与 events.retry_base 必须大于0")
+	}
+	if cfg.Events.RetryMax < cfg.Events.RetryBase {
+		add("events.retry_max 不能小于 events.retry_base")
+	}
+	if cfg.Events.MaxAttempts < 1 || cfg.Events.MaxAttempts > 20 {
+		add("events.max_attempts 必须在 1-20 之间，当前为 %d", cfg.Events.MaxAttempts)
+	}
+	if cfg.Events.Retention < time.Hour {
+		add("events.retention 不能小于1小时")
+	}
+	if cfg.Backup.Dir == "" {
+		add("backup.dir 不能为空")
+	}
+	if cfg.Backup.Interval != 0 && cfg.Backup.Interval < time.Minute {
+		add("backup.interval 不能小于1分钟（0 表示不定时备份）")
+	}
+	if cfg.Backup.Keep < 1 {
+		add("backup.keep 至少为1，当前为 %d", cfg.Backup.Keep)
+	}
+	if cfg.Backup.AdminToken != "" && len(cfg.Backup.AdminToken) < 16 {
+		add("backup.admin_token 至少16个字符")
+	}
+	if cfg.LTI.KeyFile == "" {
+		add("lti.key_file 不能为空")
+	}
+	if u, err := url.Parse(cfg.LTI.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("lti.base_url 不是有效的 http(s) 地址: %q", cfg.LTI.BaseURL)
+	}
+	if cfg.LTI.LaunchURL != "" {
+		if u, err := url.Parse(cfg.LTI.LaunchURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("lti.launch_url 不是有效的 http(s) 地址: %q", cfg.LTI.LaunchURL)
+		}
+	}
+	if cfg.LTI.StateTTL < time.Minute || cfg.LTI.SessionTTL < time.Minute {
+		add("lti.state_ttl 与 lti.session_ttl 不能小于1分钟")
+	}
+	switch cfg.Embedding.Provider {
+	case "local":
+		if cfg.Embedding.Dimensions < 64 || cfg.Embedding.Dimensions > 8192 {
+			add("embedding.dimensions 必须在64-8192之间，当前为 %d", cfg.Embedding.Dimensions)
+		}
+	case "tongyi", "openai":
+		if u, err := url.Parse(cfg.Embedding.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("embedding.endpoint 不是有效的 http(s) 地址: %q", cfg.Embedding.Endpoint)
+		}
+		if cfg.Embedding.Model == "" || cfg.Embedding.APIKey == "" {
+			add("embedding.provider 为 %s 时需要配置 model 与 api_key", cfg.Embedding.Provider)
+		}
+	default:
+		add("embedding.provider 只能是 local/tongyi/openai，当前为 %q", cfg.Embedding.Provider)
+	}
+	if cfg.Embedding.BatchSize < 1 || cfg.Embedding.BatchSize > 100 {
+		add("embedding.batch_size 必须在1-100之间，当前为 %d", cfg.Embedding.BatchSize)
+	}
+	if cfg.Embedding.SyncInterval < 10*time.Second {
+		add("embedding.sync_interval 不能小于10秒")
+	}
+	if cfg.Retention.Interval != 0 && cfg.Retention.Interval < time.Minute {
+		add("retention.interval 不能小于1分钟（0 表示只能手动执行）")
+	}
+	if cfg.Retention.KeepRuns < 1 {
+		add("retention.keep_runs 至少为1，当前为 %d", cfg.Retention.KeepRuns)
+	}
+	if cfg.Feedback.SuspendThreshold < 0 {
+		add("feedback.suspend_threshold 不能为负数（0 表示不暂停）")
+	}
+	if cfg.AnalyticsCacheTTL < 0 {
+		add("analytics.cache_ttl 不能为负数")
+	}
+	if cfg.ReloadInterval < 0 {
+		add("reload.interval 不能为负数")
+	}
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher 收到SIGHUP或配置文件被修改时重新加载配置
+// 只有AI服务与提示词相关配置会热更新，端口、存储路径等修改需要重启后生效
+type Watcher struct {
+	mu       sync.Mutex
+	current  *AIConfig
+	modTime  time.Time
+	onReload func(*AIConfig)
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewWatcher(cfg *AIConfig, onReload func(*AIConfig)) *Watcher {
+	w := &Watcher{
+		current:  cfg,
+		onReload: onReload,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if cfg.File != "" {
+		if info, err := os.Stat(cfg.File); err == nil {
+			w.modTime = info.ModTime()
+		}
+	}
+	return w
+}
+
+// Start 在后台监听信号与文件修改
+func (w *Watcher) Start() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if w.current.File != "" && w.current.ReloadInterval > 0 {
+		ticker = time.NewTicker(w.current.ReloadInterval)
+		tick = ticker.C
+	}
+
+	go func() {
+		defer close(w.done)
+		defer signal.Stop(hup)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-hup:
+				w.Reload("收到SIGHUP")
+			case <-tick:
+				if w.fileChanged() {
+					w.Reload("配置文件已修改")
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止监听
+func (w *Watcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+// Current 当前生效的配置
+func (w *Watcher) Current() *AIConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+func (w *Watcher) fileChanged() bool {
+	info, err := os.Stat(w.current.File)
+	if err != nil {
+		return false
+	}
+	if info.ModTime().Equal(w.modTime) {
+		return false
+	}
+	w.modTime = info.ModTime()
+	return true
+}
+
+// Reload 重新加载配置，失败时保留当前配置
+func (w *Watcher) Reload(reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	next, err := LoadConfig(w.current.File)
+	if err != nil {
+		log.Printf("[CONFIG] %s，重新加载失败，继续使用当前配置: %v", reason, err)
+		return
+	}
+
+	// 需要重启才能生效的配置保持原值
+	if next.Server != w.current.Server || next.ShutdownTimeout != w.current.ShutdownTimeout || next.Storage != w.current.Storage || next.Telemetry != w.current.Telemetry || next.Exam != w.current.Exam || next.Events != w.current.Events || next.Backup != w.current.Backup ||
+		next.AnalyticsCacheTTL != w.current.AnalyticsCacheTTL || next.ReloadInterval != w.current.ReloadInterval ||
+		next.Cache.Backend != w.current.Cache.Backend {
+		log.Printf("[CONFIG] server/storage/telemetry/exam/events/backup/analytics/reload/cache.backend 配置的修改需重启服务后生效")
+	}
+	next.Server = w.current.Server
+	next.ShutdownTimeout = w.current.ShutdownTimeout
+	next.Storage = w.current.Storage
+	next.Backup = w.current.Backup
+	next.Telemetry = w.current.Telemetry
+	next.Exam = w.current.Exam
+	next.Events = w.current.Events
+	next.AnalyticsCacheTTL = w.current.AnalyticsCacheTTL
+	next.ReloadInterval = w.current.ReloadInterval
+	next.Cache.Backend = w.current.Cache.Backend
+
+	if reflect.DeepEqual(next, w.current) {
+		log.Printf("[CONFIG] %s，配置无变化", reason)
+		return
+	}
+	w.current = next
+	w.onReload(next)
+	log.Printf("[CONFIG] %s，已重新加载AI服务配置（默认模型 %s）", reason, next.DefaultModel)
+}
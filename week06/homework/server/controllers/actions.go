@@ -2,21 +2,20 @@ package controllers
 
 import (
 	"Server/api"
+	"Server/services"
 	"Server/storage"
-	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"Server/config"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jmoiron/sqlx"
 )
 
 type StatsHandler struct {
-	db *storage.Database
+	db          *storage.Database
+	attachments *services.AttachmentManager
+	questions   *services.QuestionService
 }
 
 // 分页请求结构体（新增搜索字段）
@@ -24,6 +23,8 @@ type PageRequest struct {
 	Page     int    `form:"page,default=1"`
 	PageSize int    `form:"pageSize,default=10"`
 	Search   string `form:"search"` // 新增搜索参数
+	Locale   string `form:"locale"` // 内容语言筛选，如 zh-CN、en-US
+	Status   string `form:"status"` // 状态筛选，默认不含已归档的题目，all 表示全部
 }
 
 type PageResult struct {
@@ -32,88 +33,65 @@ type PageResult struct {
 }
 
 type questionInfo struct {
-	ID    int    `json:"id"`
-	Title string `json:"title"`
-	Type  int    `json:"type"`
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	Type      int    `json:"type"`
+	Status    string `json:"status"`
+	OpenFlags int    `json:"open_flags"` // 未处理的学生反馈数
+	Suspended bool   `json:"suspended"`  // 暂停用于考试
 }
 
 type deleteRequest struct {
-	IDs []int `json:"ids" binding:"required,min=1"`
+	IDs   []int `json:"ids" binding:"required,min=1"`
+	Force bool  `json:"force"` // 删除被考试或测验引用的题目
 }
 
-func NewStatsHandler(db *storage.Database) *StatsHandler {
-	return &StatsHandler{db: db}
+type statusRequest struct {
+	IDs    []int  `json:"ids" binding:"required,min=1"`
+	Status string `json:"status" binding:"required"`
 }
 
-// 统一处理带搜索的分页请求
-func handlePagination(h *StatsHandler, c *gin.Context, typeCondition string) {
+func NewStatsHandler(db *storage.Database, attachments *services.AttachmentManager, questions *services.QuestionService) *StatsHandler {
+	return &StatsHandler{db: db, attachments: attachments, questions: questions}
+}
+
+// 统一处理带搜索的分页请求（questionType 为0表示全部题型）
+func handlePagination(h *StatsHandler, c *gin.Context, questionType int) {
 	var req PageRequest
 	if err := c.ShouldBindQuery(&req); err != nil {
 		api.Error(c, http.StatusBadRequest, "参数格式错误")
 		return
 	}
 
-	if req.Page < 1 || req.PageSize < 1 || req.PageSize > 100 {
-		api.Error(c, http.StatusBadRequest, "分页参数超出范围")
+	// 只查询当前工作区可见的题目
+	questions, total, err := h.questions.List(c, callerOf(c), storage.QuestionPage{
+		Type:     questionType,
+		Search:   req.Search,
+		Locale:   req.Locale,
+		Status:   req.Status,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	})
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// 构建动态查询条件
-	var conditions []string
-	var args []interface{}
-
-	// 添加类型条件
-	if typeCondition != "" {
-		conditions = append(conditions, typeCondition)
-	}
-
-	// 添加搜索条件
-	if req.Search != "" {
-		conditions = append(conditions, "title LIKE ?")
-		args = append(args, "%"+req.Search+"%")
+	infos := make([]questionInfo, len(questions))
+	for i, q := range questions {
+		infos[i] = questionInfo{ID: q.ID, Title: q.Title, Type: q.Type, Status: q.Status, OpenFlags: q.OpenFlags, Suspended: q.Suspended}
 	}
-
-	baseQuery := "FROM questions"
-	if len(conditions) > 0 {
-		baseQuery += " WHERE " + strings.Join(conditions, " AND ")
-	}
-
-	// 获取总数
-	countQuery := "SELECT COUNT(*) " + baseQuery
-	var total int
-	if err := h.db.Get(&total, countQuery, args...); err != nil {
-		api.Error(c, http.StatusInternalServerError, "获取总数失败")
-		return
-	}
-
-	// 分页查询
-	offset := (req.Page - 1) * req.PageSize
-	dataQuery := fmt.Sprintf(`
-		SELECT id, title, type 
-		%s 
-		ORDER BY id DESC 
-		LIMIT ? OFFSET ?`, baseQuery)
-
-	// 添加分页参数
-	args = append(args, req.PageSize, offset)
-
-	var questions []questionInfo
-	if err := h.db.Select(&questions, dataQuery, args...); err != nil {
-		api.Error(c, http.StatusInternalServerError, "获取题目列表失败")
-		return
-	}
-
 	api.Success(c, gin.H{
 		"total":     total,
-		"questions": questions,
+		"questions": infos,
 	})
 }
 
 // 各类型接口
-func (h *StatsHandler) Summary(c *gin.Context) { handlePagination(h, c, "") }
-func (h *StatsHandler) ByType1(c *gin.Context) { handlePagination(h, c, "type = 1") }
-func (h *StatsHandler) ByType2(c *gin.Context) { handlePagination(h, c, "type = 2") }
-func (h *StatsHandler) ByType3(c *gin.Context) { handlePagination(h, c, "type = 3") }
+func (h *StatsHandler) Summary(c *gin.Context) { handlePagination(h, c, 0) }
+func (h *StatsHandler) ByType1(c *gin.Context) { handlePagination(h, c, 1) }
+func (h *StatsHandler) ByType2(c *gin.Context) { handlePagination(h, c, 2) }
+func (h *StatsHandler) ByType3(c *gin.Context) { handlePagination(h, c, 3) }
 
 // 批量删除
 func (h *StatsHandler) BatchDelete(c *gin.Context) {
@@ -123,27 +101,36 @@ func (h *StatsHandler) BatchDelete(c *gin.Context) {
 		return
 	}
 
-	query, args, err := sqlx.In(`
-		DELETE FROM questions 
-		WHERE id IN (?)
-	`, req.IDs)
-
+	// 删除当前工作区的题目并记录 question.deleted 事件（共享进来的题目不会被删除），之后清理只被这些题目引用的附件。
+	// 被 LTI 活动或未结束的课堂测验引用的题目需要 force 才能删除
+	deleted, err := h.questions.Delete(c, callerOf(c), req.IDs, req.Force)
 	if err != nil {
-		api.Error(c, http.StatusInternalServerError, "生成查询失败")
-		return
-	}
-
-	if err := h.db.Exec(query, args...); err != nil {
-		api.Error(c, http.StatusInternalServerError, "删除操作失败")
+		respondError(c, err)
 		return
 	}
 
 	api.Success(c, gin.H{
-		"deleted_ids": req.IDs,
+		"deleted_ids": deleted,
 		"message":     "删除成功",
 	})
 }
 
+// SetStatus 修改题目状态：active/draft/rejected/archived，已归档的题目不参与练习、不计入题目数上限
+func (h *StatsHandler) SetStatus(c *gin.Context) {
+	var req statusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数格式错误: "+err.Error())
+		return
+	}
+
+	changed, err := h.questions.SetStatus(c, callerOf(c), req.IDs, req.Status)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	api.Success(c, gin.H{"status": req.Status, "changed_ids": changed})
+}
+
 // 自主生成题目
 func (h *StatsHandler) GenerateQuestion(c *gin.Context) {
 
@@ -153,19 +140,12 @@ func (h *StatsHandler) GenerateQuestion(c *gin.Context) {
 		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
 		return
 	}
-	id, err := h.db.CreateQuestion(&req)
-	if err != nil {
-		api.Error(c, http.StatusBadRequest, "数据库创建失败")
-	}
-
-	// 验证题目类型
-	if req.Type < 1 || req.Type > 3 {
-		api.Error(c, http.StatusBadRequest, "无效的题目类型")
-	}
 
-	// 验证选项数量
-	if len(req.Answers) != 4 {
-		api.Error(c, http.StatusBadRequest, "必须提供4个选项")
+	// 2. 校验题型、选项、Markdown、附件与工作区限制，通过后写入
+	id, err := h.questions.Create(c, callerOf(c), &req)
+	if err != nil {
+		respondError(c, err)
+		return
 	}
 
 	api.Success(c, gin.H{
@@ -189,37 +169,18 @@ func (h *StatsHandler) UpdateQuestion(c *gin.Context) {
 		return
 	}
 
-	// 2. 验证题目类型（匹配图片中的单选/多选类型）
-	if req.Type != 1 && req.Type != 2 { // 1-单选 2-多选
-		api.Error(c, http.StatusBadRequest, "无效的题目类型")
-		return
-	}
-
-	// 3. 验证选项完整性（图片中显示4个完整选项）
-	if len(req.Answers) != 4 {
-		api.Error(c, http.StatusBadRequest, "必须提供4个选项")
-		return
-	}
-
-	// 4. 验证答案有效性（匹配图片中的A/B/D多选情况）
-	validOptions := map[string]bool{"A": true, "B": true, "C": true, "D": true}
-	for _, ans := range req.Rights {
-		if !validOptions[ans] {
-			api.Error(c, http.StatusBadRequest, "存在无效选项标识")
-			return
-		}
-	}
-
-	// 5. 执行更新操作
-	affected, err := h.db.UpdateQuestion(&req)
+	// 2. 校验题型（1-单选 2-多选）、选项与答案标识、Markdown与附件后更新（只能修改当前工作区的题目，共享进来的题目只读），
+	// 题型与答案同步到其他语言版本
+	affected, synced, err := h.questions.Update(c, callerOf(c), &req)
 	if err != nil {
-		api.Error(c, http.StatusInternalServerError, "更新失败: "+err.Error())
+		respondError(c, err)
 		return
 	}
 
-	// 6. 返回结果（匹配图片中的数据结构）
+	// 3. 返回结果（匹配图片中的数据结构）
 	api.Success(c, gin.H{
-		"affected_rows": affected,
+		"affected_rows":   affected,
+		"synced_variants": synced,
 		"updated_data": gin.H{
 			"type":    req.Type,
 			"title":   req.Title,
@@ -238,50 +199,13 @@ func (h *StatsHandler) ById(c *gin.Context) {
 		return
 	}
 
-	// 2. 定义数据库接收结构体
-	type dbQuestion struct {
-		ID       int    `db:"id"`
-		Type     int    `db:"type"`
-		Title    string `db:"title"`
-		Language string `db:"language"`
-		Answers  string `db:"answers"`
-		Rights   string `db:"rights"`
-	}
-
-	// 3. 执行查询
-	var q dbQuestion
-	err = h.db.Get(&q, `
-        SELECT id, type, title,  language, answers, rights
-        FROM questions 
-        WHERE id = ?`,
-		id,
-	)
-
+	// 2. 查询完整题目（含解析、提示、参考链接及解析来源）
+	q, err := h.questions.Get(c, callerOf(c), id)
 	if err != nil {
-		api.Error(c, http.StatusNotFound, "题目不存在")
-		return
-	}
-
-	// 4. 解析JSON字段
-	var answers []string
-	if err := json.Unmarshal([]byte(q.Answers), &answers); err != nil {
-		api.Error(c, http.StatusInternalServerError, "选项解析失败")
-		return
-	}
-
-	var rights []string
-	if err := json.Unmarshal([]byte(q.Rights), &rights); err != nil {
-		api.Error(c, http.StatusInternalServerError, "答案解析失败")
+		respondError(c, err)
 		return
 	}
 
-	// 5. 返回完整数据
-	api.Success(c, gin.H{
-		"id":       q.ID,
-		"type":     q.Type,
-		"title":    q.Title,
-		"language": q.Language,
-		"answers":  answers,
-		"rights":   rights,
-	})
-}
+	// 3. 返回完整数据
+	api.Success(c, q)
+}
\ No newline at end of file
@@ -0,0 +1,411 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/config"
+	"Server/services"
+	"Server/storage"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnalyticsHandler 题库统计分析接口
+type AnalyticsHandler struct {
+	db    *storage.Database
+	logs  *storage.JSONStorage
+	cache *resultCache
+}
+
+// 导出CSV所需的表格形式
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// AIProviderStat 某个AI服务在某一天的调用统计
+type AIProviderStat struct {
+	Provider     string  `json:"provider"`
+	Date         string  `json:"date"`
+	Total        int     `json:"total"`
+	Success      int     `json:"success"`
+	Failed       int     `json:"failed"`
+	SuccessRate  float64 `json:"success_rate"`
+	AvgLatency   float64 `json:"avg_latency"` // 秒
+	MaxLatency   float64 `json:"max_latency"` // 秒
+	CacheHits    int     `json:"cache_hits"`  // 命中缓存或与相同请求合并，未单独调用AI
+	totalLatency float64
+}
+
+func NewAnalyticsHandler(db *storage.Database, logs *storage.JSONStorage, ttl time.Duration) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		db:    db,
+		logs:  logs,
+		cache: newResultCache(ttl),
+	}
+}
+
+// Overview 按题型、语言、标签、来源、状态统计当前工作区可见的题目数量
+func (h *AnalyticsHandler) Overview(c *gin.Context) {
+	db := h.db.WithContext(c)
+	wsID := currentWorkspace(c).ID
+	h.serve(c, "analytics_overview", func() (interface{}, table, error) {
+		total, err := db.CountTotal(wsID)
+		if err != nil {
+			return nil, table{}, err
+		}
+
+		dimensions := map[string][]storage.CountItem{}
+		for _, column := range []string{"type", "language", "source", "status"} {
+			items, err := db.CountBy(wsID, column)
+			if err != nil {
+				return nil, table{}, err
+			}
+			dimensions[column] = items
+		}
+		tags, err := db.CountByTag(wsID)
+		if err != nil {
+			return nil, table{}, err
+		}
+		dimensions["tag"] = tags
+
+		t := table{header: []string{"dimension", "name", "count"}}
+		for _, dim := range []string{"type", "language", "tag", "source", "status"} {
+			for _, item := range dimensions[dim] {
+				t.rows = append(t.rows, []string{dim, item.Name, strconv.Itoa(item.Count)})
+			}
+		}
+
+		return gin.H{
+			"total":      total,
+			"byType":     dimensions["type"],
+			"byLanguage": dimensions["language"],
+			"byTag":      dimensions["tag"],
+			"bySource":   dimensions["source"],
+			"byStatus":   dimensions["status"],
+		}, t, nil
+	})
+}
+
+// Daily 每日新增题目数
+func (h *AnalyticsHandler) Daily(c *gin.Context) {
+	from, to := c.Query("from"), c.Query("to")
+	h.serve(c, "analytics_daily", func() (interface{}, table, error) {
+		items, err := h.db.WithContext(c).CountByDay(currentWorkspace(c).ID, from, to)
+		if err != nil {
+			return nil, table{}, err
+		}
+
+		t := table{header: []string{"date", "count"}}
+		for _, item := range items {
+			t.rows = append(t.rows, []string{item.Date, strconv.Itoa(item.Count)})
+		}
+		return gin.H{"days": items}, t, nil
+	})
+}
+
+// AI 当前工作区AI出题成功率与耗时（按服务和日期统计，数据来自AI日志）
+func (h *AnalyticsHandler) AI(c *gin.Context) {
+	from, to := c.Query("from"), c.Query("to")
+	h.serve(c, "analytics_ai", func() (interface{}, table, error) {
+		logs, err := h.logs.ReadAll()
+		if err != nil {
+			return nil, table{}, err
+		}
+		logs = workspaceLogs(logs, currentWorkspace(c).ID)
+
+		stats := aggregateAILogs(logs, from, to)
+		t := table{header: []string{"provider", "date", "total", "success", "failed", "success_rate", "avg_latency_s", "max_latency_s", "cache_hits"}}
+		for _, s := range stats {
+			t.rows = append(t.rows, []string{
+				s.Provider, s.Date,
+				strconv.Itoa(s.Total), strconv.Itoa(s.Success), strconv.Itoa(s.Failed),
+				formatFloat(s.SuccessRate), formatFloat(s.AvgLatency), formatFloat(s.MaxLatency),
+				strconv.Itoa(s.CacheHits),
+			})
+		}
+		return gin.H{"stats": stats}, t, nil
+	})
+}
+
+// AILogs 当前工作区的AI出题调用日志（按写入顺序编号）。?after=<序号> 返回该序号之后的记录，用于持续跟踪；
+// 不传时返回最近 limit 条。status=success|failed 只返回对应状态的记录，next 为下次请求的 after
+func (h *AnalyticsHandler) AILogs(c *gin.Context) {
+	// 1. 参数校验
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 500 {
+		api.Error(c, http.StatusBadRequest, "limit 必须在1-500之间")
+		return
+	}
+	after := -1
+	if a := c.Query("after"); a != "" {
+		if after, err = strconv.Atoi(a); err != nil || after < 0 {
+			api.Error(c, http.StatusBadRequest, "无效的 after")
+			return
+		}
+	}
+	status := c.Query("status")
+
+	// 2. 读取日志并截取；日志被恢复或清理后序号超出范围时，重新返回最近的记录
+	logs, err := h.logs.ReadAll()
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logs = workspaceLogs(logs, currentWorkspace(c).ID)
+	start := len(logs) - limit
+	if after >= 0 && after <= len(logs) {
+		start = after
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + limit
+	if end > len(logs) {
+		end = len(logs)
+	}
+	entries := make([]config.AILog, 0, end-start)
+	for _, entry := range logs[start:end] {
+		if status == "" || entry.Status == status {
+			entries = append(entries, entry)
+		}
+	}
+	api.Success(c, gin.H{
+		"entries": entries,
+		"next":    end,
+		"total":   len(logs),
+	})
+}
+
+// Items 基于作答记录的题目难度(p值)与区分度
+func (h *AnalyticsHandler) Items(c *gin.Context) {
+	minAttempts, err := strconv.Atoi(c.DefaultQuery("min_attempts", "1"))
+	if err != nil || minAttempts < 1 {
+		api.Error(c, http.StatusBadRequest, "min_attempts 参数无效")
+		return
+	}
+
+	h.serve(c, "analytics_items", func() (interface{}, table, error) {
+		items, err := h.db.WithContext(c).ItemAnalysis(currentWorkspace(c).ID, minAttempts)
+		if err != nil {
+			return nil, table{}, err
+		}
+
+		t := table{header: []string{"question_id", "title", "type", "attempts", "correct", "p_value", "discrimination"}}
+		for _, item := range items {
+			discrimination := ""
+			if item.Discrimination != nil {
+				discrimination = formatFloat(*item.Discrimination)
+			}
+			t.rows = append(t.rows, []string{
+				strconv.Itoa(item.QuestionID), item.Title, strconv.Itoa(item.Type),
+				strconv.Itoa(item.Attempts), strconv.Itoa(item.Correct),
+				formatFloat(item.PValue), discrimination,
+			})
+		}
+		return gin.H{"items": items}, t, nil
+	})
+}
+
+// serve 统一处理缓存、刷新与CSV导出，各工作区的结果分别缓存
+// ?refresh=1 跳过缓存重新计算；?format=csv 以CSV文件导出
+func (h *AnalyticsHandler) serve(c *gin.Context, name string, compute func() (interface{}, table, error)) {
+	key := fmt.Sprintf("%d:%s?%s", currentWorkspace(c).ID, c.Request.URL.Path, cacheQuery(c))
+
+	entry, ok := h.cache.get(key)
+	if !ok || c.Query("refresh") == "1" {
+		data, t, err := compute()
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, "统计失败: "+err.Error())
+			return
+		}
+		entry = h.cache.set(key, data, t)
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(h.cache.ttl.Seconds())))
+	c.Header("Last-Modified", entry.computedAt.UTC().Format(http.TimeFormat))
+
+	if c.Query("format") == "csv" {
+		writeCSV(c, name, entry.table)
+		return
+	}
+	api.Success(c, gin.H{
+		"generated_at": entry.computedAt.Format("2006-01-02 15:04:05"),
+		"result":       entry.data,
+	})
+}
+
+// 缓存键只包含影响结果的参数，其余参数不产生新的缓存项
+func cacheQuery(c *gin.Context) string {
+	q := url.Values{}
+	for _, name := range cacheParams {
+		if v := c.Query(name); v != "" {
+			q.Set(name, v)
+		}
+	}
+	return q.Encode()
+}
+
+func writeCSV(c *gin.Context, name string, t table) {
+	filename := fmt.Sprintf("%s_%s.csv", name, time.Now().Format("20060102_150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// 写入BOM，保证Excel正确识别中文
+	c.Writer.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write(t.header)
+	_ = w.WriteAll(t.rows)
+}
+
+// workspaceLogs 工作区发起的AI调用，没有记录工作区的旧日志归入默认工作区
+func workspaceLogs(logs []config.AILog, workspaceID int) []config.AILog {
+	result := make([]config.AILog, 0, len(logs))
+	for _, entry := range logs {
+		id := entry.WorkspaceID
+		if id == 0 {
+			id = storage.DefaultWorkspaceID
+		}
+		if id == workspaceID {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func aggregateAILogs(logs []config.AILog, from, to string) []*AIProviderStat {
+	grouped := make(map[string]*AIProviderStat)
+	for _, entry := range logs {
+		if len(entry.AIStartTime) < 10 {
+			continue
+		}
+		date := entry.AIStartTime[:10]
+		if (from != "" && date < from) || (to != "" && date > to) {
+			continue
+		}
+
+		provider := entry.AIReq.Model
+		if provider == "" {
+			provider = services.DefaultModel
+		}
+
+		key := provider + "|" + date
+		stat, ok := grouped[key]
+		if !ok {
+			stat = &AIProviderStat{Provider: provider, Date: date}
+			grouped[key] = stat
+		}
+
+		stat.Total++
+		if entry.Status == "success" {
+			stat.Success++
+		} else {
+			stat.Failed++
+		}
+		// 耗时只统计实际调用AI的请求
+		if entry.Cache == services.CacheHit || entry.Cache == services.CacheCoalesced {
+			stat.CacheHits++
+			continue
+		}
+		if cost, err := time.ParseDuration(entry.AICostTime); err == nil {
+			stat.totalLatency += cost.Seconds()
+			if cost.Seconds() > stat.MaxLatency {
+				stat.MaxLatency = cost.Seconds()
+			}
+		}
+	}
+
+	stats := make([]*AIProviderStat, 0, len(grouped))
+	for _, stat := range grouped {
+		stat.SuccessRate = float64(stat.Success) / float64(stat.Total)
+		if called := stat.Total - stat.CacheHits; called > 0 {
+			stat.AvgLatency = stat.totalLatency / float64(called)
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Date != stats[j].Date {
+			return stats[i].Date < stats[j].Date
+		}
+		return stats[i].Provider < stats[j].Provider
+	})
+	return stats
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
+
+// 影响统计结果的查询参数
+var cacheParams = []string{"from", "to", "min_attempts"}
+
+// 统计结果缓存的最大条数，超过时先清理过期的，再淘汰最早计算的
+const maxCacheEntries = 256
+
+// resultCache 统计结果的内存缓存（带过期时间）
+type resultCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	data       interface{}
+	table      table
+	computedAt time.Time
+}
+
+func newResultCache(ttl time.Duration) *resultCache {
+	return &resultCache{
+		ttl:     ttl,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+func (rc *resultCache) get(key string) (*cacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[key]
+	if !ok || time.Since(entry.computedAt) > rc.ttl {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (rc *resultCache) set(key string, data interface{}, t table) *cacheEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if _, ok := rc.entries[key]; !ok && len(rc.entries) >= maxCacheEntries {
+		rc.evict()
+	}
+	entry := &cacheEntry{data: data, table: t, computedAt: time.Now()}
+	rc.entries[key] = entry
+	return entry
+}
+
+// evict 删除过期的缓存项，仍然已满时删除最早计算的一项，调用方持有锁
+func (rc *resultCache) evict() {
+	oldest := ""
+	for key, entry := range rc.entries {
+		if time.Since(entry.computedAt) > rc.ttl {
+			delete(rc.entries, key)
+			continue
+		}
+		if oldest == "" || entry.computedAt.Before(rc.entries[oldest].computedAt) {
+			oldest = key
+		}
+	}
+	if len(rc.entries) >= maxCacheEntries {
+		delete(rc.entries, oldest)
+	}
+}
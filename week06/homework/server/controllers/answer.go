@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/services"
+	"Server/storage"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnswerHandler struct {
+	db *storage.Database
+}
+
+// 作答提交请求
+type submitRequest struct {
+	StudentID string `json:"student_id" binding:"required"`
+	Answers   []struct {
+		QuestionID int      `json:"question_id" binding:"required"`
+		Selected   []string `json:"selected"`
+	} `json:"answers" binding:"required,min=1,dive"`
+}
+
+func NewAnswerHandler(db *storage.Database) *AnswerHandler {
+	return &AnswerHandler{db: db}
+}
+
+// Submit 提交作答并按标准答案自动判分，只能作答当前工作区可见的题目
+func (h *AnswerHandler) Submit(c *gin.Context) {
+	// 1. 参数绑定
+	var req submitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数格式错误: "+err.Error())
+		return
+	}
+
+	// 2. 逐题判分
+	ws := currentWorkspace(c)
+	records := make([]storage.AnswerRecord, 0, len(req.Answers))
+	for _, ans := range req.Answers {
+		rights, err := h.db.WithContext(c).GetRights(ws.ID, ans.QuestionID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				api.Error(c, http.StatusNotFound, "题目不存在")
+			} else {
+				api.Error(c, http.StatusInternalServerError, "读取答案失败")
+			}
+			return
+		}
+
+		selected := services.NormalizeOptions(ans.Selected)
+		records = append(records, storage.AnswerRecord{
+			QuestionID: ans.QuestionID,
+			StudentID:  req.StudentID,
+			Selected:   selected,
+			Correct:    services.GradeAnswer(rights, selected),
+		})
+	}
+
+	// 3. 保存作答记录
+	if err := h.db.WithContext(c).SaveAnswers(records); err != nil {
+		api.Error(c, http.StatusInternalServerError, "保存作答记录失败")
+		return
+	}
+
+	correct := 0
+	for _, r := range records {
+		if r.Correct {
+			correct++
+		}
+	}
+	api.Success(c, gin.H{
+		"records": records,
+		"correct": correct,
+		"total":   len(records),
+	})
+}
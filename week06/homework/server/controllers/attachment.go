@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/services"
+	"Server/storage"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 附件ID：32位十六进制
+var attachmentIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// AttachmentHandler 题目图片附件的上传、下载与管理
+type AttachmentHandler struct {
+	db      *storage.Database
+	manager *services.AttachmentManager
+}
+
+func NewAttachmentHandler(db *storage.Database, manager *services.AttachmentManager) *AttachmentHandler {
+	return &AttachmentHandler{db: db, manager: manager}
+}
+
+// attachmentView 附件信息及在Markdown中引用的写法
+type attachmentView struct {
+	storage.Attachment
+	URL      string `json:"url"`
+	Markdown string `json:"markdown"`
+}
+
+func newAttachmentView(a storage.Attachment) attachmentView {
+	return attachmentView{
+		Attachment: a,
+		URL:        services.AttachmentURL(a.ID),
+		Markdown:   fmt.Sprintf("![%s](%s%s)", altText(a.Filename), storage.AttachmentScheme, a.ID),
+	}
+}
+
+// Upload 上传图片到当前工作区（multipart 字段 file），返回在题目Markdown中引用的写法。
+// 上传后24小时内没有被任何题目引用的附件会被自动清理
+func (h *AttachmentHandler) Upload(c *gin.Context) {
+	// 1. 读取上传的文件
+	file, err := c.FormFile("file")
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "请上传图片（字段 file）")
+		return
+	}
+
+	// 2. 校验类型并保存
+	a, err := h.manager.Upload(c, currentWorkspace(c).ID, c.GetHeader(userHeader), file)
+	if errors.Is(err, services.ErrAttachmentType) {
+		api.Error(c, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "上传失败: "+err.Error())
+		return
+	}
+	api.Success(c, newAttachmentView(*a))
+}
+
+// List 当前工作区上传的附件，referenced 表示是否被题目引用
+func (h *AttachmentHandler) List(c *gin.Context) {
+	list, err := h.db.WithContext(c).ListAttachments(currentWorkspace(c).ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	views := make([]attachmentView, 0, len(list))
+	for _, a := range list {
+		views = append(views, newAttachmentView(a))
+	}
+	api.Success(c, views)
+}
+
+// Get 返回附件内容。附件ID是随机生成的，页面中的 <img> 无法携带工作区请求头，
+// 因此不检查工作区，知道ID即可访问（与 file-service 的下载方式相同）
+func (h *AttachmentHandler) Get(c *gin.Context) {
+	id := c.Param("id")
+	if !attachmentIDPattern.MatchString(id) {
+		api.Error(c, http.StatusNotFound, "附件不存在")
+		return
+	}
+	a, err := h.db.WithContext(c).GetAttachment(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		api.Error(c, http.StatusNotFound, "附件不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	f, err := h.manager.Files().Open(a.Path)
+	if err != nil {
+		log.Printf("[ATTACHMENT] 打开附件 %s 失败: %v", a.ID, err)
+		api.Error(c, http.StatusNotFound, "附件文件不存在")
+		return
+	}
+	defer f.Close()
+
+	// 内容不会改变，可以长期缓存；ServeContent 处理 If-None-Match 与 Range
+	c.Header("Content-Type", a.MimeType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", `"`+a.SHA256+`"`)
+	modTime, _ := time.ParseInLocation("2006-01-02 15:04:05", a.CreatedAt, time.Local)
+	http.ServeContent(c.Writer, c.Request, "", modTime, f)
+}
+
+// Delete 删除当前工作区上传、且没有被任何题目引用的附件
+func (h *AttachmentHandler) Delete(c *gin.Context) {
+	db := h.db.WithContext(c)
+	a, err := db.GetAttachment(c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && a.WorkspaceID != currentWorkspace(c).ID) {
+		api.Error(c, http.StatusNotFound, "附件不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if a.Referenced {
+		api.Error(c, http.StatusConflict, "附件仍被题目引用，请先修改或删除这些题目")
+		return
+	}
+	removed, err := h.manager.Collect(c, []string{a.ID})
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(removed) == 0 {
+		// 查询之后被新保存的题目引用
+		api.Error(c, http.StatusConflict, "附件仍被题目引用，请先修改或删除这些题目")
+		return
+	}
+	api.Success(c, gin.H{"deleted": a.ID})
+}
+
+// checkAttachmentRefs 检查文本中引用的附件是否都存在
+func checkAttachmentRefs(db *storage.Database, texts ...string) error {
+	return services.CheckAttachmentRefs(db, texts...)
+}
+
+// questionTexts 题目中可能引用附件的文本：标题、选项、解析与提示
+func questionTexts(title string, answers, explanations []string, hint string) []string {
+	return services.QuestionTexts(title, answers, explanations, hint)
+}
+
+// questionAttachmentRefs 工作区中这些题目引用的附件，修改或删除题目前查询，之后用于清理
+func questionAttachmentRefs(db *storage.Database, workspaceID int, ids []int) ([]string, error) {
+	return services.QuestionAttachmentRefs(db, workspaceID, ids)
+}
+
+// collectAttachments 删除或修改题目后清理不再被引用的附件，失败只记录日志
+func collectAttachments(c *gin.Context, manager *services.AttachmentManager, ids []string) {
+	services.CollectAttachments(c, manager, ids)
+}
+
+// altText 文件名去掉扩展名作为图片的替代文本
+func altText(filename string) string {
+	alt := strings.TrimSuffix(filename, filepath.Ext(filename))
+	return strings.NewReplacer("[", "", "]", "").Replace(alt)
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/config"
+	"Server/lifecycle"
+	"Server/services"
+	"Server/storage"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BackfillHandler AI批量补写解析，在后台逐题执行
+type BackfillHandler struct {
+	service services.AIService
+	db      *storage.Database
+	app     *lifecycle.Manager
+}
+
+func NewBackfillHandler(service services.AIService, db *storage.Database, app *lifecycle.Manager) *BackfillHandler {
+	return &BackfillHandler{service: service, db: db, app: app}
+}
+
+// 补写解析请求
+type backfillRequest struct {
+	Model     string `json:"model" binding:"omitempty,oneof=deepseek tongyi"`
+	IDs       []int  `json:"ids"`
+	Limit     int    `json:"limit" binding:"omitempty,min=1,max=50"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+// Create 让AI为已有的手写题目批量补写解析，在后台执行并返回任务ID，结果记录来源与模型
+func (h *BackfillHandler) Create(c *gin.Context) {
+	// 1. 参数绑定
+	var req backfillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	model := h.service.ResolveModel(workspaceModel(c, req.Model))
+
+	// 2. 查询当前工作区待补写的题目
+	ws := currentWorkspace(c)
+	questions, err := h.db.WithContext(c).ExplanationCandidates(ws.ID, req.IDs, req.Limit, req.Overwrite)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "查询题目失败: "+err.Error())
+		return
+	}
+	if len(questions) == 0 {
+		api.Error(c, http.StatusBadRequest, "没有需要补写解析的题目")
+		return
+	}
+
+	// 3. 创建任务并在后台执行，服务退出时不再发起新的AI调用
+	job := &storage.BackfillJob{
+		WorkspaceID: ws.ID,
+		Model:       model,
+		Overwrite:   req.Overwrite,
+		Status:      storage.BulkRunning,
+		Total:       len(questions),
+		Results:     make([]storage.BackfillResult, len(questions)),
+	}
+	for i, q := range questions {
+		job.Results[i] = storage.BackfillResult{ID: q.ID, Status: storage.BulkTaskPending}
+	}
+	if err := h.db.WithContext(c).CreateBackfillJob(job); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !h.app.Go(fmt.Sprintf("补写解析#%d", job.ID), func(ctx context.Context) {
+		h.execute(ctx, job, questions)
+	}) {
+		job.Status = storage.BulkCanceled
+		job.Canceled = len(questions)
+		job.FinishedAt = time.Now().Format("2006-01-02 15:04:05")
+		_ = h.db.WithContext(context.WithoutCancel(c)).UpdateBackfillJob(job)
+		api.Error(c, http.StatusServiceUnavailable, "服务正在关闭，请稍后重试")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, api.Response{
+		Code: 0,
+		Msg:  "已开始补写解析",
+		Data: gin.H{"id": job.ID, "model": model, "total": len(questions)},
+	})
+}
+
+// Get 任务进度与各题目的结果
+func (h *BackfillHandler) Get(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的任务ID")
+		return
+	}
+	job, err := h.db.WithContext(c).GetBackfillJob(id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if job == nil || job.WorkspaceID != currentWorkspace(c).ID {
+		api.Error(c, http.StatusNotFound, "任务不存在")
+		return
+	}
+	api.Success(c, job)
+}
+
+// List 当前工作区最近的补写解析任务
+func (h *BackfillHandler) List(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		api.Error(c, http.StatusBadRequest, "limit 必须在1-100之间")
+		return
+	}
+	jobs, err := h.db.WithContext(c).ListBackfillJobs(currentWorkspace(c).ID, limit)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, jobs)
+}
+
+// execute 逐题生成并保存解析，每道题完成后保存进度
+func (h *BackfillHandler) execute(ctx context.Context, job *storage.BackfillJob, questions []storage.Question) {
+	log.Printf("[BACKFILL] 任务#%d 开始：%d 道题，AI服务 %s", job.ID, len(questions), job.Model)
+	// 服务退出时也要写入已完成的结果
+	db := h.db.WithContext(context.WithoutCancel(ctx))
+	for i, q := range questions {
+		res := &job.Results[i]
+		if ctx.Err() != nil {
+			res.Status, res.Error = storage.BulkTaskCanceled, "服务退出，请求未发起"
+			job.Canceled++
+			continue
+		}
+		err := h.explain(ctx, db, job, q)
+		switch {
+		case err == nil:
+			res.Status = storage.BulkTaskSuccess
+			job.Succeeded++
+		case ctx.Err() != nil:
+			res.Status, res.Error = storage.BulkTaskCanceled, err.Error()
+			job.Canceled++
+		default:
+			res.Status, res.Error = storage.BulkTaskFailed, err.Error()
+			job.Failed++
+		}
+		if err := db.UpdateBackfillJob(job); err != nil {
+			log.Printf("[BACKFILL_WARN] %v", err)
+		}
+	}
+
+	job.Status = storage.BulkCompleted
+	if ctx.Err() != nil {
+		job.Status = storage.BulkCanceled
+	}
+	job.FinishedAt = time.Now().Format("2006-01-02 15:04:05")
+	if err := db.UpdateBackfillJob(job); err != nil {
+		log.Printf("[BACKFILL_WARN] %v", err)
+	}
+	log.Printf("[BACKFILL] 任务#%d %s：成功 %d，失败 %d，取消 %d", job.ID, job.Status, job.Succeeded, job.Failed, job.Canceled)
+}
+
+// explain 为一道题生成并保存解析。AI客户端或解析器 panic 时记为该题失败，继续处理后面的题目
+func (h *BackfillHandler) explain(ctx context.Context, db *storage.Database, job *storage.BackfillJob, q storage.Question) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("[BACKFILL_PANIC] 任务#%d 题目%d: %v\n%s", job.ID, q.ID, p, debug.Stack())
+			err = fmt.Errorf("内部错误：%v", p)
+		}
+	}()
+	exp, err := h.service.ExplainQuestion(ctx, job.Model, config.QuestionRequest1{
+		Id:       q.ID,
+		Type:     q.Type,
+		Title:    q.Title,
+		Language: q.Language,
+		Answers:  q.Answers,
+		Rights:   q.Rights,
+	})
+	if err != nil {
+		return err
+	}
+	return db.SaveExplanation(q.ID, exp, storage.ExplanationFromBackfill, job.Model)
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/services"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const adminTokenHeader = "X-Admin-Token"
+
+// BackupHandler 数据库备份、校验、恢复与快照导出的管理接口
+type BackupHandler struct {
+	manager *services.BackupManager
+	token   string
+}
+
+func NewBackupHandler(manager *services.BackupManager, token string) *BackupHandler {
+	return &BackupHandler{manager: manager, token: token}
+}
+
+// AdminOnly 管理接口需要 X-Admin-Token 与 backup.admin_token 一致，未配置令牌时禁用
+func (h *BackupHandler) AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.token == "" {
+			api.Error(c, http.StatusForbidden, "未配置 backup.admin_token，管理接口已禁用")
+			c.Abort()
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(adminTokenHeader)), []byte(h.token)) != 1 {
+			api.Error(c, http.StatusUnauthorized, "管理令牌无效")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// List 备份目录中的备份，最新的在前
+func (h *BackupHandler) List(c *gin.Context) {
+	list, err := h.manager.List()
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, list)
+}
+
+// Create 立即创建一个手动备份（不参与轮转）
+func (h *BackupHandler) Create(c *gin.Context) {
+	info, err := h.manager.Create(c, services.BackupManual)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, info)
+}
+
+// Verify 校验备份的完整性
+func (h *BackupHandler) Verify(c *gin.Context) {
+	path, ok := h.backupPath(c)
+	if !ok {
+		return
+	}
+	report, err := h.manager.Verify(c, path)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, report)
+}
+
+// Restore 从备份恢复当前数据库，恢复前的数据自动保存为 pre-restore 备份
+func (h *BackupHandler) Restore(c *gin.Context) {
+	path, ok := h.backupPath(c)
+	if !ok {
+		return
+	}
+	result, err := h.manager.Restore(c, path)
+	if err != nil {
+		// 未通过校验时返回校验报告，说明取消恢复的原因
+		if result != nil && result.Before != nil && !result.Before.OK {
+			c.JSON(http.StatusUnprocessableEntity, api.Response{Code: -1, Msg: err.Error(), Data: result})
+			return
+		}
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, result)
+}
+
+// Snapshot 下载数据库与AI日志的 tar.gz 快照
+func (h *BackupHandler) Snapshot(c *gin.Context) {
+	filename := fmt.Sprintf("question-service-snapshot-%s.tar.gz", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	// 开始写出后无法再返回错误响应，客户端得到的压缩包不完整，解压时会报错
+	if _, err := h.manager.Snapshot(c, c.Writer); err != nil {
+		log.Printf("[BACKUP] 导出快照失败: %v", err)
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			api.Error(c, http.StatusInternalServerError, err.Error())
+		}
+	}
+}
+
+// backupPath 路径参数中的备份名称对应的文件，失败时已写入响应
+func (h *BackupHandler) backupPath(c *gin.Context) (string, bool) {
+	path, err := h.manager.Path(c.Param("name"))
+	if errors.Is(err, os.ErrNotExist) {
+		api.Error(c, http.StatusNotFound, "备份不存在: "+c.Param("name"))
+		return "", false
+	}
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return path, true
+}
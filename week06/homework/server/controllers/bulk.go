@@ -0,0 +1,469 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/config"
+	"Server/lifecycle"
+	"Server/services"
+	"Server/storage"
+	"Server/telemetry"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	maxSyllabusSize = 1 << 20          // 大纲文件最大1MB
+	maxBulkTasks    = 200              // 单次最多发起的AI调用次数
+	bulkSaveTimeout = 10 * time.Second // 保存生成的题目的最长时间，服务退出时也会保存
+)
+
+// BulkHandler 按大纲批量出题
+type BulkHandler struct {
+	service services.AIService
+	storage storage.Storage
+	db      *storage.Database
+	app     *lifecycle.Manager
+}
+
+func NewBulkHandler(service services.AIService, storage storage.Storage, db *storage.Database, app *lifecycle.Manager) *BulkHandler {
+	return &BulkHandler{service: service, storage: storage, db: db, app: app}
+}
+
+// 批量出题参数（multipart表单，大纲文件字段为 file）
+type bulkRequest struct {
+	Model       string `form:"model" binding:"omitempty,oneof=deepseek tongyi"` // 只使用指定的AI服务
+	Concurrency int    `form:"concurrency" binding:"omitempty,min=1,max=8"`     // 每个AI服务的并发数，默认2
+	Type        int    `form:"type" binding:"omitempty,oneof=1 2 3"`            // 大纲未指定时的题型，默认单选
+	Count       int    `form:"count" binding:"omitempty,min=1,max=50"`          // 大纲未指定时每个知识点的题目数，默认5
+	Language    string `form:"language" binding:"omitempty,oneof=go java python javascript c++ css html"`
+	DryRun      bool   `form:"dry_run"` // 只解析大纲，返回将要发起的请求
+}
+
+// Create 上传大纲（Markdown/CSV）并在后台批量出题，返回任务ID
+func (h *BulkHandler) Create(c *gin.Context) {
+	// 1. 参数与大纲文件
+	var req bulkRequest
+	if err := c.ShouldBind(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if req.Concurrency == 0 {
+		req.Concurrency = 2
+	}
+	defaults := services.SyllabusDefaults{Type: req.Type, Count: req.Count, Language: req.Language}
+	if defaults.Type == 0 {
+		defaults.Type = config.SingleSelect
+	}
+	if defaults.Count == 0 {
+		defaults.Count = 5
+	}
+	if defaults.Language == "" {
+		defaults.Language = "go"
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "请上传大纲文件")
+		return
+	}
+	if file.Size > maxSyllabusSize {
+		api.Error(c, http.StatusBadRequest, fmt.Sprintf("大纲文件不能超过 %dKB", maxSyllabusSize>>10))
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "读取大纲文件失败: "+err.Error())
+		return
+	}
+	data, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "读取大纲文件失败: "+err.Error())
+		return
+	}
+
+	// 2. 解析大纲并展开为出题请求
+	items, err := services.ParseSyllabus(file.Filename, data, defaults)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	tasks := services.ExpandSyllabus(items)
+	if len(tasks) > maxBulkTasks {
+		api.Error(c, http.StatusBadRequest, fmt.Sprintf("大纲需要 %d 次AI调用，超过上限 %d，请拆分后上传", len(tasks), maxBulkTasks))
+		return
+	}
+	ws := currentWorkspace(c)
+	for _, it := range items {
+		if !languageAllowed(ws, it.Language) {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("知识点「%s」的语言 %s 不在工作区允许范围内", it.Topic, it.Language))
+			return
+		}
+	}
+
+	// 3. 确定参与出题的AI服务
+	providers := h.service.Providers()
+	if req.Model != "" {
+		if !slices.Contains(providers, req.Model) {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("AI服务 %s 未配置", req.Model))
+			return
+		}
+		providers = []string{req.Model}
+	}
+	if len(providers) == 0 {
+		api.Error(c, http.StatusServiceUnavailable, "没有可用的AI服务")
+		return
+	}
+
+	if req.DryRun {
+		api.Success(c, gin.H{
+			"items":     items,
+			"tasks":     tasks,
+			"providers": providers,
+		})
+		return
+	}
+
+	// 4. 占用工作区今天的AI调用次数，创建任务并在后台执行，服务退出时取消剩余请求
+	if !consumeAIQuota(c, h.db, ws, len(tasks)) {
+		return
+	}
+	job := &storage.BulkJob{
+		WorkspaceID: ws.ID,
+		Filename:    file.Filename,
+		Model:       req.Model,
+		Concurrency: req.Concurrency,
+		Status:      storage.BulkRunning,
+		TotalTasks:  len(tasks),
+		Results:     make([]storage.BulkTaskResult, len(tasks)),
+	}
+	for i, t := range tasks {
+		it := items[t.Item]
+		job.Results[i] = storage.BulkTaskResult{
+			Task:      i + 1,
+			Topic:     it.Topic,
+			Path:      it.Path,
+			Type:      it.Type,
+			Language:  it.Language,
+			Requested: t.Keep,
+			Status:    storage.BulkTaskPending,
+		}
+	}
+	if err := h.db.WithContext(c).CreateBulkJob(job); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	run := &bulkRun{handler: h, workspace: ws, job: job, items: items, tasks: tasks}
+	if !h.app.Go(fmt.Sprintf("批量出题#%d", job.ID), func(ctx context.Context) {
+		run.execute(ctx, providers, req.Concurrency)
+	}) {
+		job.Status = storage.BulkCanceled
+		job.Canceled = len(tasks)
+		job.FinishedAt = time.Now().Format("2006-01-02 15:04:05")
+		_ = h.db.WithContext(context.WithoutCancel(c)).UpdateBulkJob(job)
+		api.Error(c, http.StatusServiceUnavailable, "服务正在关闭，请稍后重试")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, api.Response{
+		Code: 0,
+		Msg:  "已开始批量出题",
+		Data: gin.H{"id": job.ID, "items": len(items), "tasks": len(tasks), "providers": providers},
+	})
+}
+
+// Get 任务进度与报告：各请求结果，以及按知识点、AI服务汇总的成功、失败与费用
+func (h *BulkHandler) Get(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的任务ID")
+		return
+	}
+	job, err := h.db.WithContext(c).GetBulkJob(id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if job == nil || job.WorkspaceID != currentWorkspace(c).ID {
+		api.Error(c, http.StatusNotFound, "任务不存在")
+		return
+	}
+	api.Success(c, gin.H{
+		"job":       job,
+		"topics":    summarizeTopics(job.Results),
+		"providers": summarizeProviders(job.Results),
+	})
+}
+
+// List 当前工作区最近的批量出题任务
+func (h *BulkHandler) List(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		api.Error(c, http.StatusBadRequest, "limit 必须在1-100之间")
+		return
+	}
+	jobs, err := h.db.WithContext(c).ListBulkJobs(currentWorkspace(c).ID, limit)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, jobs)
+}
+
+// bulkRun 一个正在执行的批量出题任务，结果由多个worker并发写入
+type bulkRun struct {
+	handler   *BulkHandler
+	workspace *storage.Workspace
+	job       *storage.BulkJob
+	items     []services.SyllabusItem
+	tasks     []services.BulkTask
+
+	mu sync.Mutex
+}
+
+// execute 每个AI服务启动 concurrency 个worker，从同一队列领取请求，
+// 响应快的服务自然承担更多请求
+func (r *bulkRun) execute(ctx context.Context, providers []string, concurrency int) {
+	ctx, span := telemetry.Start(ctx, "bulk.generate",
+		attribute.Int("bulk.job_id", r.job.ID),
+		attribute.Int("bulk.tasks", len(r.tasks)),
+	)
+	defer span.End()
+	log.Printf("[BULK] 任务#%d 开始：%d 个请求，AI服务 %v，每个服务并发 %d", r.job.ID, len(r.tasks), providers, concurrency)
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for _, provider := range providers {
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(provider string) {
+				defer wg.Done()
+				for idx := range queue {
+					r.runTask(ctx, idx, provider)
+				}
+			}(provider)
+		}
+	}
+	for idx := range r.tasks {
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+
+	r.mu.Lock()
+	r.job.Status = storage.BulkCompleted
+	if ctx.Err() != nil {
+		r.job.Status = storage.BulkCanceled
+	}
+	r.job.FinishedAt = time.Now().Format("2006-01-02 15:04:05")
+	r.saveLocked(ctx)
+	log.Printf("[BULK] 任务#%d %s：成功 %d，失败 %d，取消 %d，保存题目 %d 道，费用 %.4f 元",
+		r.job.ID, r.job.Status, r.job.Succeeded, r.job.Failed, r.job.Canceled, r.job.Questions, r.job.Cost)
+	r.mu.Unlock()
+}
+
+// runTask 调用AI出题并保存前 Keep 道题，标签为章节与知识点
+func (r *bulkRun) runTask(ctx context.Context, idx int, provider string) {
+	// AI客户端或解析器 panic 时记为失败，不影响其他请求，也不让任务停在执行中
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("[BULK_PANIC] 任务#%d 请求%d: %v\n%s", r.job.ID, idx+1, p, debug.Stack())
+			r.mu.Lock()
+			pending := r.job.Results[idx].Status == storage.BulkTaskPending
+			r.mu.Unlock()
+			if pending {
+				r.finish(ctx, idx, func(res *storage.BulkTaskResult) {
+					res.Provider = provider
+					res.Status = storage.BulkTaskFailed
+					res.Error = fmt.Sprintf("内部错误：%v", p)
+				})
+			}
+		}
+	}()
+
+	task := r.tasks[idx]
+	if ctx.Err() != nil {
+		r.finish(ctx, idx, func(res *storage.BulkTaskResult) {
+			res.Status = storage.BulkTaskCanceled
+			res.Error = "服务退出，请求未发起"
+		})
+		return
+	}
+
+	start := time.Now()
+	req := task.Request
+	req.Model = provider
+	resp, err := r.handler.service.GenerateQuestion(ctx, req)
+	logEntry := services.BuildAILog(ctx, r.workspace.ID, req, resp, err, start)
+	if saveErr := r.handler.storage.Save(logEntry); saveErr != nil {
+		log.Printf("日志存储失败: %v", saveErr)
+	}
+	if eventErr := r.handler.db.WithContext(ctx).RecordEvent(services.GeneratedEvent(r.workspace.ID, req, logEntry)); eventErr != nil {
+		log.Printf("事件记录失败: %v", eventErr)
+	}
+
+	var ids []int
+	if err == nil {
+		questions := resp.Questions
+		if len(questions) > task.Keep {
+			questions = questions[:task.Keep]
+		}
+		ids, err = r.save(ctx, req, questions, r.items[task.Item].Tags(), provider)
+	}
+
+	r.finish(ctx, idx, func(res *storage.BulkTaskResult) {
+		res.Provider = provider
+		res.Duration = fmt.Sprintf("%.2fs", time.Since(start).Seconds())
+		if err != nil {
+			res.Status = storage.BulkTaskFailed
+			res.Error = err.Error()
+			if ctx.Err() != nil {
+				res.Status = storage.BulkTaskCanceled
+			}
+			return
+		}
+		res.Status = storage.BulkTaskSuccess
+		res.QuestionIDs = ids
+		res.Cache = resp.Cache
+		// 命中缓存或与其他请求合并时没有产生新的费用
+		if resp.Usage != nil && resp.Cache != services.CacheHit && resp.Cache != services.CacheCoalesced {
+			res.PromptTokens = resp.Usage.PromptTokens
+			res.CompletionTokens = resp.Usage.CompletionTokens
+			res.Cost = resp.Usage.Cost
+		}
+	})
+}
+
+// save 在工作区题目数上限内保存生成的题目；检查与保存加锁，并发的worker不会超过上限。
+// 题目已经付费生成，服务退出时也要保存
+func (r *bulkRun) save(ctx context.Context, req config.QuestionRequest, questions []config.QuestionResponse, tags []string, provider string) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), bulkSaveTimeout)
+	defer cancel()
+	db := r.handler.db.WithContext(ctx)
+	ok, count, err := db.CheckQuestionQuota(r.workspace, len(questions))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("工作区已有 %d 道题，保存 %d 道将超过上限 %d", count, len(questions), r.workspace.Settings.MaxQuestions)
+	}
+	return db.SaveGeneratedQuestions(r.workspace.ID, req, questions, tags, provider)
+}
+
+// finish 记录一个请求的结果，更新汇总并保存进度
+func (r *bulkRun) finish(ctx context.Context, idx int, update func(res *storage.BulkTaskResult)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := &r.job.Results[idx]
+	update(res)
+
+	job := r.job
+	switch res.Status {
+	case storage.BulkTaskSuccess:
+		job.Succeeded++
+		job.Questions += len(res.QuestionIDs)
+		job.PromptTokens += res.PromptTokens
+		job.CompletionTokens += res.CompletionTokens
+		job.Cost += res.Cost
+	case storage.BulkTaskFailed:
+		job.Failed++
+	case storage.BulkTaskCanceled:
+		job.Canceled++
+	}
+	r.saveLocked(ctx)
+}
+
+// saveLocked 保存任务进度，服务退出时也要写入已完成的结果
+func (r *bulkRun) saveLocked(ctx context.Context) {
+	if err := r.handler.db.WithContext(context.WithoutCancel(ctx)).UpdateBulkJob(r.job); err != nil {
+		log.Printf("[BULK_WARN] %v", err)
+	}
+}
+
+// bulkTopicSummary 按知识点汇总
+type bulkTopicSummary struct {
+	Topic     string   `json:"topic"`
+	Path      []string `json:"path"`
+	Requested int      `json:"requested"`
+	Generated int      `json:"generated"`
+	Failed    int      `json:"failed"` // 失败或取消的请求数
+	Cost      float64  `json:"cost"`
+}
+
+// bulkProviderSummary 按AI服务汇总
+type bulkProviderSummary struct {
+	Provider         string  `json:"provider"`
+	Tasks            int     `json:"tasks"`
+	Succeeded        int     `json:"succeeded"`
+	Failed           int     `json:"failed"`
+	CacheHits        int     `json:"cacheHits"`
+	Questions        int     `json:"questions"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func summarizeTopics(results []storage.BulkTaskResult) []*bulkTopicSummary {
+	var topics []*bulkTopicSummary
+	index := make(map[string]*bulkTopicSummary)
+	for _, res := range results {
+		key := fmt.Sprint(res.Path, res.Topic)
+		s, ok := index[key]
+		if !ok {
+			s = &bulkTopicSummary{Topic: res.Topic, Path: res.Path}
+			index[key] = s
+			topics = append(topics, s)
+		}
+		s.Requested += res.Requested
+		s.Generated += len(res.QuestionIDs)
+		s.Cost += res.Cost
+		if res.Status == storage.BulkTaskFailed || res.Status == storage.BulkTaskCanceled {
+			s.Failed++
+		}
+	}
+	return topics
+}
+
+func summarizeProviders(results []storage.BulkTaskResult) []*bulkProviderSummary {
+	var providers []*bulkProviderSummary
+	index := make(map[string]*bulkProviderSummary)
+	for _, res := range results {
+		if res.Provider == "" {
+			continue // 未发起的请求
+		}
+		s, ok := index[res.Provider]
+		if !ok {
+			s = &bulkProviderSummary{Provider: res.Provider}
+			index[res.Provider] = s
+			providers = append(providers, s)
+		}
+		s.Tasks++
+		switch res.Status {
+		case storage.BulkTaskSuccess:
+			s.Succeeded++
+		case storage.BulkTaskFailed:
+			s.Failed++
+		}
+		if res.Cache == services.CacheHit || res.Cache == services.CacheCoalesced {
+			s.CacheHits++
+		}
+		s.Questions += len(res.QuestionIDs)
+		s.PromptTokens += res.PromptTokens
+		s.CompletionTokens += res.CompletionTokens
+		s.Cost += res.Cost
+	}
+	return providers
+}
@@ -0,0 +1,377 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/lifecycle"
+	"Server/services"
+	"Server/storage"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sseHeartbeat   = 15 * time.Second // 心跳间隔，防止代理断开空闲连接
+	maxEventReplay = 1000             // 断线重连时最多补发的事件数
+)
+
+// EventHandler 题库事件的SSE推送与Webhook管理
+type EventHandler struct {
+	db  *storage.Database
+	bus *services.EventBus
+	app *lifecycle.Manager
+}
+
+func NewEventHandler(db *storage.Database, bus *services.EventBus, app *lifecycle.Manager) *EventHandler {
+	return &EventHandler{db: db, bus: bus, app: app}
+}
+
+// Stream 以SSE推送当前工作区的题库事件。
+// types=question.created,question.* 只接收指定类型；
+// 重连时浏览器自动带上 Last-Event-ID（或手动传 since=<事件ID>），补发断开期间的事件
+func (h *EventHandler) Stream(c *gin.Context) {
+	// 1. 解析参数
+	var types []string
+	for _, t := range strings.Split(c.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("since")
+	}
+	var since int64 = -1
+	if lastID != "" {
+		n, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil || n < 0 {
+			api.Error(c, http.StatusBadRequest, "无效的事件ID: "+lastID)
+			return
+		}
+		since = n
+	}
+
+	// 2. 先订阅再补发，补发期间产生的事件在通道中等待，按ID去重
+	ws := currentWorkspace(c)
+	sub := h.bus.Subscribe(ws.ID, types)
+	defer h.bus.Unsubscribe(sub)
+	var backlog []storage.Event
+	if since >= 0 {
+		events, err := h.db.WithContext(c).EventsAfter(since, maxEventReplay)
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, ev := range events {
+			if ev.WorkspaceID == ws.ID && services.MatchEventType(types, ev.Type) {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	for _, ev := range backlog {
+		writeSSE(c, ev)
+		since = ev.ID
+	}
+	c.Writer.Flush()
+
+	// 3. 推送新事件，客户端断开、订阅被断开或服务退出时结束
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-h.app.Closing():
+			return
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return // 处理过慢被断开，客户端重连后从 Last-Event-ID 补发
+			}
+			if ev.ID <= since {
+				continue
+			}
+			writeSSE(c, ev)
+			since = ev.ID
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+// writeSSE 输出一条SSE消息，事件ID用于断线重连
+func writeSSE(c *gin.Context, ev storage.Event) {
+	data, _ := json.Marshal(ev)
+	fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+}
+
+// Webhook创建/修改参数
+type webhookRequest struct {
+	URL          string   `json:"url"`
+	Events       []string `json:"events"` // 为空表示订阅全部事件
+	Description  string   `json:"description"`
+	Active       *bool    `json:"active"`
+	Secret       string   `json:"secret"`        // 为空时自动生成
+	RotateSecret bool     `json:"rotate_secret"` // 修改时重新生成密钥
+}
+
+// validate 校验地址与订阅的事件类型
+func (r *webhookRequest) validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url 必须是有效的 http(s) 地址")
+	}
+	for _, p := range r.Events {
+		if !services.ValidEventPattern(p) {
+			return fmt.Errorf("未知的事件类型: %s（可选 %s，或 question.* 等通配）", p, strings.Join(storage.EventTypes, "、"))
+		}
+	}
+	if r.Secret != "" && len(r.Secret) < 16 {
+		return fmt.Errorf("secret 至少16个字符")
+	}
+	return nil
+}
+
+// CreateWebhook 为当前工作区注册Webhook，只在创建（及轮换密钥）时返回完整密钥
+func (h *EventHandler) CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.bus.CheckWebhookURL(c, req.URL); err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hook := &storage.Webhook{
+		WorkspaceID: currentWorkspace(c).ID,
+		URL:         req.URL,
+		Secret:      req.Secret,
+		Events:      req.Events,
+		Description: req.Description,
+		Active:      req.Active == nil || *req.Active,
+	}
+	if hook.Secret == "" {
+		hook.Secret = services.NewWebhookSecret()
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	if err := h.db.WithContext(c).CreateWebhook(hook); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, hook)
+}
+
+// ListWebhooks 当前工作区已注册的Webhook，密钥只显示前缀
+func (h *EventHandler) ListWebhooks(c *gin.Context) {
+	hooks, err := h.db.WithContext(c).ListWebhooks(currentWorkspace(c).ID, false)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range hooks {
+		hooks[i].Secret = maskSecret(hooks[i].Secret)
+	}
+	api.Success(c, hooks)
+}
+
+// UpdateWebhook 修改地址、订阅、说明与启用状态，rotate_secret=true 时重新生成密钥
+func (h *EventHandler) UpdateWebhook(c *gin.Context) {
+	hook, ok := h.loadWebhook(c)
+	if !ok {
+		return
+	}
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if req.URL == "" {
+		req.URL = hook.URL
+	}
+	if req.Events == nil {
+		req.Events = hook.Events
+	}
+	if err := req.validate(); err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.bus.CheckWebhookURL(c, req.URL); err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hook.URL = req.URL
+	hook.Events = req.Events
+	if req.Description != "" {
+		hook.Description = req.Description
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	rotated := req.RotateSecret || req.Secret != ""
+	if req.Secret != "" {
+		hook.Secret = req.Secret
+	} else if req.RotateSecret {
+		hook.Secret = services.NewWebhookSecret()
+	}
+	if err := h.db.WithContext(c).UpdateWebhook(hook); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !rotated {
+		hook.Secret = maskSecret(hook.Secret)
+	}
+	api.Success(c, hook)
+}
+
+// DeleteWebhook 删除Webhook及其投递记录
+func (h *EventHandler) DeleteWebhook(c *gin.Context) {
+	hook, ok := h.loadWebhook(c)
+	if !ok {
+		return
+	}
+	id := hook.ID
+	found, err := h.db.WithContext(c).DeleteWebhook(id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		api.Error(c, http.StatusNotFound, "Webhook不存在")
+		return
+	}
+	api.Success(c, gin.H{"deleted_id": id})
+}
+
+// PingWebhook 立即发送一个 ping 事件并返回结果，不入库、不重试
+func (h *EventHandler) PingWebhook(c *gin.Context) {
+	hook, ok := h.loadWebhook(c)
+	if !ok {
+		return
+	}
+	api.Success(c, h.bus.Ping(c, hook))
+}
+
+// ListDeliveries 最近的投递记录，status=pending/success/failed 筛选，limit 默认50
+func (h *EventHandler) ListDeliveries(c *gin.Context) {
+	hook, ok := h.loadWebhook(c)
+	if !ok {
+		return
+	}
+	status := c.Query("status")
+	switch status {
+	case "", storage.DeliveryPending, storage.DeliverySuccess, storage.DeliveryFailed:
+	default:
+		api.Error(c, http.StatusBadRequest, "status 只能是 pending、success 或 failed")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		api.Error(c, http.StatusBadRequest, "limit 必须在1-500之间")
+		return
+	}
+	deliveries, err := h.db.WithContext(c).ListDeliveries(hook.ID, status, limit)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, deliveries)
+}
+
+// GetDelivery 投递记录及每次尝试的状态码、错误与响应
+func (h *EventHandler) GetDelivery(c *gin.Context) {
+	webhookID, deliveryID, ok := h.deliveryParams(c)
+	if !ok {
+		return
+	}
+	delivery, err := h.db.WithContext(c).GetDelivery(webhookID, deliveryID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if delivery == nil {
+		api.Error(c, http.StatusNotFound, "投递记录不存在")
+		return
+	}
+	api.Success(c, delivery)
+}
+
+// RetryDelivery 立即重新投递（失败的记录重新计算重试次数）
+func (h *EventHandler) RetryDelivery(c *gin.Context) {
+	webhookID, deliveryID, ok := h.deliveryParams(c)
+	if !ok {
+		return
+	}
+	found, err := h.db.WithContext(c).RetryDelivery(webhookID, deliveryID, time.Now())
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		api.Error(c, http.StatusNotFound, "投递记录不存在")
+		return
+	}
+	api.Success(c, gin.H{"id": deliveryID, "status": storage.DeliveryPending})
+}
+
+// loadWebhook 按路径参数查询当前工作区的Webhook，失败时已写入响应
+func (h *EventHandler) loadWebhook(c *gin.Context) (*storage.Webhook, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的Webhook ID")
+		return nil, false
+	}
+	hook, err := h.db.WithContext(c).GetWebhook(id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if hook == nil || hook.WorkspaceID != currentWorkspace(c).ID {
+		api.Error(c, http.StatusNotFound, "Webhook不存在")
+		return nil, false
+	}
+	return hook, true
+}
+
+// deliveryParams 解析路径中的Webhook与投递记录ID，Webhook必须属于当前工作区
+func (h *EventHandler) deliveryParams(c *gin.Context) (int, int64, bool) {
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的投递记录ID")
+		return 0, 0, false
+	}
+	hook, ok := h.loadWebhook(c)
+	if !ok {
+		return 0, 0, false
+	}
+	return hook.ID, deliveryID, true
+}
+
+// maskSecret 只显示密钥前10个字符
+func maskSecret(secret string) string {
+	if len(secret) <= 10 {
+		return "****"
+	}
+	return secret[:10] + "****"
+}
@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/config"
+	"Server/services"
+	"Server/storage"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单份试卷最多的题目数
+const maxExamQuestions = 200
+
+// ExamHandler 试卷与答题卡导出
+type ExamHandler struct {
+	db          *storage.Database
+	renderer    *services.ExamRenderer
+	attachments *services.AttachmentManager
+}
+
+func NewExamHandler(db *storage.Database, renderer *services.ExamRenderer, attachments *services.AttachmentManager) *ExamHandler {
+	return &ExamHandler{db: db, renderer: renderer, attachments: attachments}
+}
+
+// 试卷格式
+var examFormats = map[string]struct {
+	contentType string
+	render      func(r *services.ExamRenderer, paper *services.ExamPaper) ([]byte, error)
+}{
+	"pdf":  {"application/pdf", (*services.ExamRenderer).RenderPDF},
+	"docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", (*services.ExamRenderer).RenderDOCX},
+}
+
+// Render 按ID或筛选条件组卷并导出PDF/DOCX
+// 筛选参数同题目导出（ids、type、locale、language、tag），未指定 locale 时只选中文题目，不选暂停用于考试的题目；
+// templates=1,2 加入由题目模板生成的题目，每份试卷取值不同，此时只按 ids 选取普通题目；
+// 其余参数：format=pdf|docx、title、course、date、duration（分钟）、variants（1-4）、
+// shuffle=1（A卷也打乱）、answer_key=1（附参考答案）、seed（随机种子）。
+// 多份试卷时返回zip，每份一个文件
+func (h *ExamHandler) Render(c *gin.Context) {
+	// 1. 解析参数
+	filter, err := parseQuestionFilter(c)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Locale == "" {
+		filter.Locale = config.LocaleZh // 避免同一题目的译本重复出现在试卷中
+	}
+	opts, err := parseExamOptions(c)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	ext := c.DefaultQuery("format", "pdf")
+	format, ok := examFormats[ext]
+	if !ok {
+		api.Error(c, http.StatusBadRequest, "不支持的试卷格式，可选 pdf 或 docx")
+		return
+	}
+
+	templateIDs, err := parseIDList(c.Query("templates"))
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的模板ID: "+err.Error())
+		return
+	}
+
+	// 2. 查询题目，按ID选题时保持传入的顺序
+	db := h.db.WithContext(c)
+	var questions []storage.Question
+	if len(templateIDs) == 0 || len(filter.IDs) > 0 {
+		if questions, err = db.ListQuestions(filter); err != nil {
+			api.Error(c, http.StatusInternalServerError, "查询题目失败: "+err.Error())
+			return
+		}
+	}
+	if len(filter.IDs) > 0 {
+		questions = orderByIDs(questions, filter.IDs)
+	}
+	// 未处理的学生反馈过多的题目暂停用于考试：按条件选题时跳过，按ID指定时提示
+	questions, suspended := services.SplitSuspended(questions)
+	if len(suspended) > 0 && len(filter.IDs) > 0 {
+		api.Error(c, http.StatusConflict, fmt.Sprintf("题目 %v 有较多未处理的学生反馈，已暂停用于考试", suspended))
+		return
+	}
+
+	// 3. 每份试卷由模板生成不同取值的题目
+	templates, err := h.compileTemplates(c, templateIDs)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	variants, err := services.ExamTemplateVariants(templates, opts.Seed, opts.Variants)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.PaperQuestions = make([][]storage.Question, len(variants))
+	for p, list := range variants {
+		for i, v := range list {
+			opts.PaperQuestions[p] = append(opts.PaperQuestions[p], services.VariantQuestion(templates[i].Template(), v))
+		}
+	}
+	total := len(questions) + len(templates)
+	if total == 0 {
+		api.Error(c, http.StatusNotFound, "没有符合条件的题目")
+		return
+	}
+	if total > maxExamQuestions {
+		api.Error(c, http.StatusBadRequest, fmt.Sprintf("共 %d 道题，超过单份试卷上限 %d，请缩小筛选范围", total, maxExamQuestions))
+		return
+	}
+
+	// 4. 组卷并排版，题目引用的图片嵌入试卷
+	papers := services.BuildExamPapers(questions, opts)
+	if err := services.LoadImages(c, h.attachments, papers); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	files := make([][]byte, len(papers))
+	for i, paper := range papers {
+		if files[i], err = format.render(h.renderer, paper); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, services.ErrExamFontMissing) {
+				status = http.StatusServiceUnavailable
+			}
+			api.Error(c, status, err.Error())
+			return
+		}
+	}
+
+	// 5. 记录每份试卷使用的模板实例，便于核对答案
+	var records []*storage.TemplateVariant
+	for p, list := range variants {
+		for _, v := range list {
+			v.Context, v.Paper = storage.VariantExam, papers[p].Variant
+			records = append(records, v)
+		}
+	}
+	if len(records) > 0 {
+		if err := db.SaveTemplateVariants(records); err != nil {
+			api.Error(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// 6. 输出文件，多份试卷打包为zip
+	name := "exam_" + time.Now().Format("20060102_150405")
+	c.Header("X-Exam-Seed", strconv.FormatInt(opts.Seed, 10))
+	if len(papers) == 1 {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+ext))
+		c.Data(http.StatusOK, format.contentType, files[0])
+		return
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i, paper := range papers {
+		f, err := zw.Create(fmt.Sprintf("%s_%s.%s", name, paper.Variant, ext))
+		if err == nil {
+			_, err = f.Write(files[i])
+		}
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, "打包试卷失败: "+err.Error())
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		api.Error(c, http.StatusInternalServerError, "打包试卷失败: "+err.Error())
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// parseExamOptions 解析试卷抬头与组卷参数，未指定种子时按当前时间生成
+func parseExamOptions(c *gin.Context) (services.ExamOptions, error) {
+	opts := services.ExamOptions{
+		Title:     c.DefaultQuery("title", "试卷"),
+		Course:    c.Query("course"),
+		Date:      c.DefaultQuery("date", time.Now().Format("2006-01-02")),
+		Variants:  1,
+		Shuffle:   c.Query("shuffle") == "1" || c.Query("shuffle") == "true",
+		AnswerKey: c.Query("answer_key") == "1" || c.Query("answer_key") == "true",
+		Seed:      time.Now().UnixNano() % 1000000,
+	}
+	if v := c.Query("duration"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 600 {
+			return opts, fmt.Errorf("无效的考试时长: %s（0-600分钟）", v)
+		}
+		opts.Duration = n
+	}
+	if v := c.Query("variants"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > services.MaxExamVariants {
+			return opts, fmt.Errorf("无效的试卷份数: %s（1-%d）", v, services.MaxExamVariants)
+		}
+		opts.Variants = n
+	}
+	if v := c.Query("seed"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("无效的随机种子: %s", v)
+		}
+		opts.Seed = n
+	}
+	return opts, nil
+}
+
+// orderByIDs 按传入的ID顺序排列题目
+func orderByIDs(questions []storage.Question, ids []int) []storage.Question {
+	byID := make(map[int]storage.Question, len(questions))
+	for _, q := range questions {
+		byID[q.ID] = q
+	}
+	ordered := make([]storage.Question, 0, len(questions))
+	for _, id := range ids {
+		if q, ok := byID[id]; ok {
+			ordered = append(ordered, q)
+			delete(byID, id)
+		}
+	}
+	return ordered
+}
+
+// compileTemplates 读取并编译当前工作区的模板，保持传入的顺序
+func (h *ExamHandler) compileTemplates(c *gin.Context, ids []int) ([]*services.CompiledTemplate, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	list, err := h.db.WithContext(c).ListTemplates(currentWorkspace(c).ID, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*storage.QuestionTemplate, len(list))
+	for i := range list {
+		byID[list[i].ID] = &list[i]
+	}
+	compiled := make([]*services.CompiledTemplate, 0, len(ids))
+	for _, id := range ids {
+		t, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("模板 %d 不存在", id)
+		}
+		ct, err := services.CompileTemplate(t)
+		if err != nil {
+			return nil, fmt.Errorf("模板 %d: %w", id, err)
+		}
+		compiled = append(compiled, ct)
+	}
+	return compiled, nil
+}
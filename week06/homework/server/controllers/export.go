@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/storage"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export 导出题目（含解析、提示与参考链接）
+// ?format=json|csv|zip，可选 type、locale、language、tag 与 ids（逗号分隔）筛选；
+// zip 包含 questions.json、attachments.json 与题目引用的附件文件
+func (h *StatsHandler) Export(c *gin.Context) {
+	// 1. 解析筛选条件
+	filter, err := parseQuestionFilter(c)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 2. 查询题目
+	questions, err := h.db.WithContext(c).ListQuestions(filter)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "查询题目失败: "+err.Error())
+		return
+	}
+
+	// 3. 按格式输出
+	name := "questions_" + time.Now().Format("20060102_150405")
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		data, _ := json.MarshalIndent(questions, "", "  ")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".json"))
+		c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+	case "csv":
+		writeCSV(c, "questions", questionsTable(questions))
+	case "zip":
+		h.exportBundle(c, name, questions)
+	default:
+		api.Error(c, http.StatusBadRequest, "不支持的导出格式")
+	}
+}
+
+// exportedAttachment 导出包中 attachments.json 的一项，file 为包内路径
+type exportedAttachment struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	File     string `json:"file"`
+}
+
+// exportBundle 将题目与其引用的附件打包为zip，题目中的 attachment:<id> 引用保持不变
+func (h *StatsHandler) exportBundle(c *gin.Context, name string, questions []storage.Question) {
+	// 1. 题目引用的附件
+	var refs []string
+	for i := range questions {
+		refs = append(refs, storage.QuestionAttachmentRefs(&questions[i])...)
+	}
+	attachments, err := h.db.WithContext(c).GetAttachments(refs)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "查询附件失败: "+err.Error())
+		return
+	}
+	index := make([]exportedAttachment, 0, len(attachments))
+	for _, a := range attachments {
+		index = append(index, exportedAttachment{
+			ID:       a.ID,
+			Filename: a.Filename,
+			MimeType: a.MimeType,
+			Size:     a.Size,
+			SHA256:   a.SHA256,
+			File:     "attachments/" + a.ID + strings.ToLower(filepath.Ext(a.Filename)),
+		})
+	}
+
+	// 2. 边打包边输出，开始写出后出错只能记录日志
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+	zw := zip.NewWriter(c.Writer)
+	questionsJSON, _ := json.MarshalIndent(questions, "", "  ")
+	indexJSON, _ := json.MarshalIndent(index, "", "  ")
+	err = writeZipFile(zw, "questions.json", bytes.NewReader(questionsJSON))
+	if err == nil {
+		err = writeZipFile(zw, "attachments.json", bytes.NewReader(indexJSON))
+	}
+	for i := 0; err == nil && i < len(attachments); i++ {
+		var f *os.File
+		if f, err = h.attachments.Files().Open(attachments[i].Path); err == nil {
+			err = writeZipFile(zw, index[i].File, f)
+			f.Close()
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		log.Printf("[EXPORT] 导出题目附件失败: %v", err)
+	}
+}
+
+func writeZipFile(zw *zip.Writer, name string, r io.Reader) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// parseQuestionFilter 解析 type、locale、language、tag 与 ids 查询参数，只查询当前工作区可见的题目
+func parseQuestionFilter(c *gin.Context) (storage.QuestionFilter, error) {
+	filter := storage.QuestionFilter{
+		WorkspaceID: currentWorkspace(c).ID,
+		Locale:      c.Query("locale"),
+		Language:    c.Query("language"),
+		Tag:         c.Query("tag"),
+	}
+	if t := c.Query("type"); t != "" {
+		typ, err := strconv.Atoi(t)
+		if err != nil || typ < 1 || typ > 3 {
+			return filter, fmt.Errorf("无效的题目类型: %s", t)
+		}
+		filter.Type = typ
+	}
+	ids, err := parseIDList(c.Query("ids"))
+	if err != nil {
+		return filter, fmt.Errorf("无效的题目ID: %v", err)
+	}
+	filter.IDs = ids
+	return filter, nil
+}
+
+// parseIDList 解析逗号分隔的ID列表，出错时返回无效的部分
+func parseIDList(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var ids []int
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || id <= 0 {
+			return nil, errors.New(part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// questionsTable 将题目转换为表格，选项与解析按字母展开为多列
+func questionsTable(questions []storage.Question) table {
+	options := 4
+	for _, q := range questions {
+		if len(q.Answers) > options {
+			options = len(q.Answers)
+		}
+	}
+
+	header := []string{"id", "group_id", "locale", "type", "language", "title"}
+	for i := 0; i < options; i++ {
+		header = append(header, "option_"+string(rune('A'+i)))
+	}
+	header = append(header, "rights", "tags")
+	for i := 0; i < options; i++ {
+		header = append(header, "explanation_"+string(rune('A'+i)))
+	}
+	header = append(header, "hint", "reference", "explanation_source", "explanation_model", "source", "status", "created_at")
+
+	t := table{header: header}
+	for _, q := range questions {
+		row := []string{strconv.Itoa(q.ID), strconv.Itoa(q.GroupID), q.Locale, strconv.Itoa(q.Type), q.Language, q.Title}
+		row = append(row, padStrings(q.Answers, options)...)
+		row = append(row, strings.Join(q.Rights, ","), strings.Join(q.Tags, ";"))
+		row = append(row, padStrings(q.Explanations, options)...)
+		createdAt := ""
+		if q.CreatedAt != nil {
+			createdAt = *q.CreatedAt
+		}
+		row = append(row, q.Hint, q.Reference, q.ExplanationSource, q.ExplanationModel, q.Source, q.Status, createdAt)
+		t.rows = append(t.rows, row)
+	}
+	return t
+}
+
+func padStrings(values []string, n int) []string {
+	padded := make([]string, n)
+	copy(padded, values)
+	return padded
+}
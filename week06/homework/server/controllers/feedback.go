@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/services"
+	"Server/storage"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultFeedbackLimit = 20
+	maxFeedbackLimit     = 100
+)
+
+// FeedbackHandler 学生反馈题目有误、老师的处理队列与题目的修订记录
+type FeedbackHandler struct {
+	db       *storage.Database
+	feedback *services.FeedbackService
+}
+
+// 学生提交反馈的请求
+type flagRequest struct {
+	QuestionID int    `json:"question_id" binding:"required"`
+	StudentID  string `json:"student_id" binding:"required"`
+	Reason     string `json:"reason" binding:"required"` // wrong_key/ambiguous/typo/other
+	Comment    string `json:"comment"`
+}
+
+// 处理反馈的请求，按反馈ID或按题目处理
+type handleFlagsRequest struct {
+	IDs        []int  `json:"ids"`
+	QuestionID int    `json:"question_id"` // 处理该题目的全部未处理反馈
+	Note       string `json:"note"`
+}
+
+func NewFeedbackHandler(db *storage.Database, feedback *services.FeedbackService) *FeedbackHandler {
+	return &FeedbackHandler{db: db, feedback: feedback}
+}
+
+// Submit 学生反馈题目有误（答案错误、表述有歧义、错别字等），返回该题目未处理的反馈数
+func (h *FeedbackHandler) Submit(c *gin.Context) {
+	var req flagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数格式错误: "+err.Error())
+		return
+	}
+	summary, err := h.feedback.Submit(c, &storage.QuestionFlag{
+		QuestionID: req.QuestionID,
+		StudentID:  req.StudentID,
+		Reason:     req.Reason,
+		Comment:    req.Comment,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	api.Success(c, summary)
+}
+
+// Queue 处理队列：按题目汇总反馈，反馈多的在前。
+// ?status= 默认 open，可选 resolved、dismissed；?reason= 只看某种原因；?limit= 默认20道题
+func (h *FeedbackHandler) Queue(c *gin.Context) {
+	status := c.DefaultQuery("status", storage.FlagOpen)
+	if status != storage.FlagOpen && status != storage.FlagResolved && status != storage.FlagDismissed {
+		api.Error(c, http.StatusBadRequest, "status 可选 open、resolved、dismissed")
+		return
+	}
+	reason := c.Query("reason")
+	if reason != "" && !slices.Contains(storage.FlagReasons, reason) {
+		api.Error(c, http.StatusBadRequest, "无效的反馈原因: "+reason)
+		return
+	}
+	limit := defaultFeedbackLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxFeedbackLimit {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("limit 必须在1-%d之间", maxFeedbackLimit))
+			return
+		}
+		limit = n
+	}
+	queue, err := h.db.WithContext(c).FlagQueue(currentWorkspace(c).ID, status, reason, limit)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{"total": len(queue), "questions": queue})
+}
+
+// Resolve 题目已修正，反馈关联到反馈之后的第一条修订记录
+func (h *FeedbackHandler) Resolve(c *gin.Context) {
+	h.handle(c, storage.FlagResolved)
+}
+
+// Dismiss 题目不需要修改
+func (h *FeedbackHandler) Dismiss(c *gin.Context) {
+	h.handle(c, storage.FlagDismissed)
+}
+
+func (h *FeedbackHandler) handle(c *gin.Context, status string) {
+	var req handleFlagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数格式错误: "+err.Error())
+		return
+	}
+	flags, restored, err := h.feedback.Handle(c, callerOf(c), req.IDs, req.QuestionID, status, req.Note)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	api.Success(c, gin.H{"status": status, "flags": flags, "restored_ids": restored})
+}
+
+// Question 题目的全部反馈（新的在前）、未处理的反馈数与是否暂停用于考试
+func (h *FeedbackHandler) Question(c *gin.Context) {
+	q, ok := h.visibleQuestion(c)
+	if !ok {
+		return
+	}
+	flags, err := h.db.WithContext(c).QuestionFlags(currentWorkspace(c).ID, q.ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{"question_id": q.ID, "open_flags": q.OpenFlags, "suspended": q.Suspended, "flags": flags})
+}
+
+// Revisions 题目的修订记录（新的在前），每条是一次修改前的内容，?limit= 默认20
+func (h *FeedbackHandler) Revisions(c *gin.Context) {
+	limit := defaultFeedbackLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxFeedbackLimit {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("limit 必须在1-%d之间", maxFeedbackLimit))
+			return
+		}
+		limit = n
+	}
+	q, ok := h.visibleQuestion(c)
+	if !ok {
+		return
+	}
+	revisions, err := h.db.WithContext(c).ListQuestionRevisions(q.ID, limit)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{"question_id": q.ID, "total": len(revisions), "revisions": revisions})
+}
+
+// visibleQuestion 读取当前工作区可见的题目，失败时已写入响应
+func (h *FeedbackHandler) visibleQuestion(c *gin.Context) (*storage.Question, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的题目ID")
+		return nil, false
+	}
+	q, err := h.db.WithContext(c).GetVisibleQuestion(currentWorkspace(c).ID, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			api.Error(c, http.StatusNotFound, "题目不存在")
+		} else {
+			api.Error(c, http.StatusInternalServerError, err.Error())
+		}
+		return nil, false
+	}
+	return q, true
+}
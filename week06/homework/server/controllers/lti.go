@@ -0,0 +1,593 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/services"
+	"Server/storage"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ltiSessionHeader = "X-LTI-Session" // 启动后答题页面携带的会话令牌，也可以用 lti_session 参数传递
+
+	ltiMaxQuestions = 200 // 一个活动最多的题目数
+)
+
+// LTIHandler LTI 1.3 工具接口：平台登记、考试与练习活动、登录发起、启动、Deep Linking 与学生答题
+type LTIHandler struct {
+	db  *storage.Database
+	lti *services.LTIService
+}
+
+func NewLTIHandler(db *storage.Database, lti *services.LTIService) *LTIHandler {
+	return &LTIHandler{db: db, lti: lti}
+}
+
+// 平台登记参数
+type ltiPlatformRequest struct {
+	Workspace     string   `json:"workspace"` // 学生作答的工作区ID或标识，默认工作区为空
+	Name          string   `json:"name"`
+	Issuer        string   `json:"issuer" binding:"required"`
+	ClientID      string   `json:"client_id" binding:"required"`
+	DeploymentIDs []string `json:"deployment_ids"`
+	AuthLoginURL  string   `json:"auth_login_url" binding:"required"`
+	AuthTokenURL  string   `json:"auth_token_url"`
+	JWKSURL       string   `json:"jwks_url"`
+	JWKS          string   `json:"jwks"` // 离线配置的平台公钥（JWK Set JSON）
+}
+
+// 活动创建参数
+type ltiActivityRequest struct {
+	Kind        string `json:"kind" binding:"required,oneof=exam practice"`
+	Title       string `json:"title" binding:"required,max=100"`
+	IDs         []int  `json:"ids" binding:"required,min=1"`
+	MaxAttempts *int   `json:"max_attempts"` // 默认考试1次、练习不限（0）
+}
+
+// 学生提交的作答
+type ltiSubmitRequest struct {
+	Answers []struct {
+		QuestionID int      `json:"question_id" binding:"required"`
+		Selected   []string `json:"selected"`
+	} `json:"answers" binding:"dive"`
+}
+
+// platform 按请求参数构造平台并校验，失败时已写入响应
+func (h *LTIHandler) platform(c *gin.Context, req *ltiPlatformRequest) (*storage.LTIPlatform, bool) {
+	ws, err := services.ResolveWorkspace(c, h.db, req.Workspace)
+	if err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+	p := &storage.LTIPlatform{
+		WorkspaceID:   ws.ID,
+		Name:          strings.TrimSpace(req.Name),
+		Issuer:        strings.TrimSpace(req.Issuer),
+		ClientID:      strings.TrimSpace(req.ClientID),
+		DeploymentIDs: req.DeploymentIDs,
+		AuthLoginURL:  req.AuthLoginURL,
+		AuthTokenURL:  req.AuthTokenURL,
+		JWKSURL:       req.JWKSURL,
+		JWKS:          strings.TrimSpace(req.JWKS),
+	}
+	if p.DeploymentIDs == nil {
+		p.DeploymentIDs = []string{}
+	}
+	if err := services.CheckLTIPlatform(p); err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+	return p, true
+}
+
+// CreatePlatform 登记平台，返回需要填写到平台中的工具地址
+func (h *LTIHandler) CreatePlatform(c *gin.Context) {
+	var req ltiPlatformRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	p, ok := h.platform(c, &req)
+	if !ok {
+		return
+	}
+
+	db := h.db.WithContext(c)
+	existing, err := db.FindLTIPlatforms(p.Issuer, p.ClientID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(existing) > 0 {
+		api.Error(c, http.StatusConflict, fmt.Sprintf("平台已登记: %s（client_id %s）", p.Issuer, p.ClientID))
+		return
+	}
+	if err := db.CreateLTIPlatform(p); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"platform": p,
+		"tool":     h.toolEndpoints(),
+	})
+}
+
+// ListPlatforms 登记的平台与工具地址
+func (h *LTIHandler) ListPlatforms(c *gin.Context) {
+	platforms, err := h.db.WithContext(c).ListLTIPlatforms()
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"platforms": platforms,
+		"tool":      h.toolEndpoints(),
+	})
+}
+
+// UpdatePlatform 修改平台配置（整体替换）
+func (h *LTIHandler) UpdatePlatform(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的平台ID")
+		return
+	}
+	var req ltiPlatformRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	p, ok := h.platform(c, &req)
+	if !ok {
+		return
+	}
+	p.ID = id
+
+	db := h.db.WithContext(c)
+	existing, err := db.FindLTIPlatforms(p.Issuer, p.ClientID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(existing) > 0 && existing[0].ID != id {
+		api.Error(c, http.StatusConflict, fmt.Sprintf("平台已登记: %s（client_id %s）", p.Issuer, p.ClientID))
+		return
+	}
+	found, err := db.UpdateLTIPlatform(p)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		api.Error(c, http.StatusNotFound, "平台不存在")
+		return
+	}
+	p, err = db.GetLTIPlatform(id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, p)
+}
+
+// DeletePlatform 删除平台及其会话，未完成的成绩回传标记为失败
+func (h *LTIHandler) DeletePlatform(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的平台ID")
+		return
+	}
+	found, err := h.db.WithContext(c).DeleteLTIPlatform(id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		api.Error(c, http.StatusNotFound, "平台不存在")
+		return
+	}
+	api.Success(c, gin.H{"message": "删除成功"})
+}
+
+// toolEndpoints 在平台中登记本工具时填写的地址
+func (h *LTIHandler) toolEndpoints() gin.H {
+	return gin.H{
+		"login_url":     h.lti.URL("/api/lti/login"),
+		"launch_url":    h.lti.URL("/api/lti/launch"),
+		"deep_link_url": h.lti.URL("/api/lti/launch"),
+		"jwks_url":      h.lti.URL("/api/lti/jwks"),
+	}
+}
+
+// CreateActivity 用当前工作区的题目创建考试或练习，之后可以在平台中通过 Deep Linking 选择
+func (h *LTIHandler) CreateActivity(c *gin.Context) {
+	// 1. 参数校验
+	var req ltiActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if len(req.IDs) > ltiMaxQuestions {
+		api.Error(c, http.StatusBadRequest, fmt.Sprintf("一个活动最多 %d 道题", ltiMaxQuestions))
+		return
+	}
+	maxAttempts := 0
+	if req.Kind == storage.LTIExam {
+		maxAttempts = 1
+	}
+	if req.MaxAttempts != nil {
+		maxAttempts = *req.MaxAttempts
+	}
+	if maxAttempts < 0 || maxAttempts > 100 {
+		api.Error(c, http.StatusBadRequest, "max_attempts 必须在0-100之间（0 表示不限）")
+		return
+	}
+
+	// 2. 题目必须在当前工作区可见且有标准答案
+	ws := currentWorkspace(c)
+	list, err := h.db.WithContext(c).ListQuestions(storage.QuestionFilter{WorkspaceID: ws.ID, IDs: req.IDs})
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	byID := make(map[int]*storage.Question, len(list))
+	for i := range list {
+		byID[list[i].ID] = &list[i]
+	}
+	seen := make(map[int]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("题目 %d 重复", id))
+			return
+		}
+		seen[id] = true
+		q, ok := byID[id]
+		if !ok {
+			api.Error(c, http.StatusNotFound, fmt.Sprintf("题目 %d 不存在", id))
+			return
+		}
+		if len(q.Rights) == 0 {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("题目 %d 没有标准答案", id))
+			return
+		}
+		if q.Suspended && req.Kind == storage.LTIExam {
+			api.Error(c, http.StatusConflict, fmt.Sprintf("题目 %d 有较多未处理的学生反馈，已暂停用于考试", id))
+			return
+		}
+	}
+
+	// 3. 保存
+	activity := &storage.LTIActivity{
+		WorkspaceID: ws.ID,
+		Kind:        req.Kind,
+		Title:       strings.TrimSpace(req.Title),
+		QuestionIDs: req.IDs,
+		MaxAttempts: maxAttempts,
+		CreatedBy:   c.GetHeader(userHeader),
+	}
+	if err := h.db.WithContext(c).CreateLTIActivity(activity); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, activity)
+}
+
+// ListActivities 当前工作区的考试与练习
+func (h *LTIHandler) ListActivities(c *gin.Context) {
+	activities, err := h.db.WithContext(c).ListLTIActivities(currentWorkspace(c).ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, activities)
+}
+
+// GetActivity 活动详情及学生的提交与成绩回传状态
+func (h *LTIHandler) GetActivity(c *gin.Context) {
+	activity, ok := h.loadActivity(c)
+	if !ok {
+		return
+	}
+	submissions, err := h.db.WithContext(c).ActivitySubmissions(activity.ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"activity":    activity,
+		"submissions": submissions,
+	})
+}
+
+// DeleteActivity 删除活动，已提交的成绩保留
+func (h *LTIHandler) DeleteActivity(c *gin.Context) {
+	activity, ok := h.loadActivity(c)
+	if !ok {
+		return
+	}
+	if _, err := h.db.WithContext(c).DeleteLTIActivity(activity.WorkspaceID, activity.ID); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{"message": "删除成功"})
+}
+
+// loadActivity 路径中的活动，必须属于当前工作区，失败时已写入响应
+func (h *LTIHandler) loadActivity(c *gin.Context) (*storage.LTIActivity, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的活动ID")
+		return nil, false
+	}
+	activity, err := h.db.WithContext(c).GetLTIActivity(currentWorkspace(c).ID, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if activity == nil {
+		api.Error(c, http.StatusNotFound, "活动不存在")
+		return nil, false
+	}
+	return activity, true
+}
+
+// JWKS 工具公钥
+func (h *LTIHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, h.lti.JWKS())
+}
+
+// Login OIDC 登录发起（平台以 GET 或 POST 表单调用），跳转到平台的授权地址
+func (h *LTIHandler) Login(c *gin.Context) {
+	var req services.LTILogin
+	if err := c.ShouldBind(&req); err != nil {
+		ltiErrorPage(c, http.StatusBadRequest, "登录参数错误: "+err.Error())
+		return
+	}
+	target, err := h.lti.Login(c, req)
+	if err != nil {
+		ltiError(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// Launch 平台 POST 的启动消息：学生进入答题页面，教师的 Deep Linking 请求进入活动选择页面
+func (h *LTIHandler) Launch(c *gin.Context) {
+	if msg := c.PostForm("error"); msg != "" {
+		ltiErrorPage(c, http.StatusBadRequest, "平台拒绝了登录: "+msg+" "+c.PostForm("error_description"))
+		return
+	}
+	session, err := h.lti.Launch(c, c.PostForm("id_token"), c.PostForm("state"))
+	if err != nil {
+		ltiError(c, err)
+		return
+	}
+	if session.MessageType == services.LTIDeepLinkingRequest {
+		c.Redirect(http.StatusSeeOther, h.lti.URL("/api/lti/deep-link?lti_session="+session.Token))
+		return
+	}
+	c.Redirect(http.StatusSeeOther, h.lti.LaunchURL(session.Token))
+}
+
+// DeepLinkPage 教师选择要放入课程的考试或练习
+func (h *LTIHandler) DeepLinkPage(c *gin.Context) {
+	session, ok := h.pageSession(c, services.LTIDeepLinkingRequest)
+	if !ok {
+		return
+	}
+	p, err := h.lti.Platform(c, session)
+	if err != nil {
+		ltiError(c, err)
+		return
+	}
+	activities, err := h.db.WithContext(c).ListLTIActivities(p.WorkspaceID)
+	if err != nil {
+		ltiError(c, err)
+		return
+	}
+	renderLTIPage(c, http.StatusOK, deepLinkPage, gin.H{
+		"Token":      session.Token,
+		"Course":     session.ContextTitle,
+		"Activities": activities,
+	})
+}
+
+// DeepLink 把选择的活动签名后以表单自动提交回平台
+func (h *LTIHandler) DeepLink(c *gin.Context) {
+	session, ok := h.pageSession(c, services.LTIDeepLinkingRequest)
+	if !ok {
+		return
+	}
+	p, err := h.lti.Platform(c, session)
+	if err != nil {
+		ltiError(c, err)
+		return
+	}
+	id, _ := strconv.Atoi(c.PostForm("activity_id"))
+	activity, err := h.db.WithContext(c).GetLTIActivity(p.WorkspaceID, id)
+	if err != nil {
+		ltiError(c, err)
+		return
+	}
+	if activity == nil {
+		ltiErrorPage(c, http.StatusNotFound, "请选择一个考试或练习")
+		return
+	}
+	returnURL, jwt, err := h.lti.DeepLinkResponse(c, session, activity)
+	if err != nil {
+		ltiError(c, err)
+		return
+	}
+	renderLTIPage(c, http.StatusOK, autoPostPage, gin.H{
+		"Action": returnURL,
+		"Fields": map[string]string{"JWT": jwt},
+	})
+}
+
+// Session 学生的会话、活动题目（不含答案与解析）与已有的提交，供 lti.launch_url 指向的前端页面使用
+func (h *LTIHandler) Session(c *gin.Context) {
+	session, err := h.lti.Session(c, ltiToken(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	activity, questions, err := h.lti.Activity(c, session)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	items, err := ltiQuestions(questions)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	submissions, err := h.db.WithContext(c).ListLTISubmissions(session.PlatformID, activity.ID, session.Subject)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"session":     session,
+		"activity":    activity,
+		"questions":   items,
+		"submissions": submissions,
+		"passback":    session.LineItem != "",
+	})
+}
+
+// Submit 提交作答，判分后返回得分，平台开通了成绩服务时异步回传
+func (h *LTIHandler) Submit(c *gin.Context) {
+	session, err := h.lti.Session(c, ltiToken(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var req ltiSubmitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	answers := make(map[int][]string, len(req.Answers))
+	for _, ans := range req.Answers {
+		answers[ans.QuestionID] = ans.Selected
+	}
+	sub, records, err := h.lti.Submit(c, session, answers)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	api.Success(c, gin.H{
+		"submission": sub,
+		"records":    records,
+	})
+}
+
+// Play 内置的答题页面（未配置 lti.launch_url 时使用），GET 显示题目，POST 提交后显示得分
+func (h *LTIHandler) Play(c *gin.Context) {
+	session, ok := h.pageSession(c, services.LTIResourceLinkRequest)
+	if !ok {
+		return
+	}
+	activity, questions, err := h.lti.Activity(c, session)
+	if err != nil {
+		ltiError(c, err)
+		return
+	}
+
+	data := gin.H{"Token": session.Token, "Name": session.Name, "Activity": activity}
+	if c.Request.Method == http.MethodPost {
+		// 表单中每道题的字段名为 q<题目ID>，多选题有多个值
+		answers := make(map[int][]string, len(questions))
+		for _, q := range questions {
+			answers[q.ID] = c.PostFormArray(fmt.Sprintf("q%d", q.ID))
+		}
+		sub, _, err := h.lti.Submit(c, session, answers)
+		if err != nil {
+			ltiError(c, err)
+			return
+		}
+		data["Submission"] = sub
+	}
+
+	submissions, err := h.db.WithContext(c).ListLTISubmissions(session.PlatformID, activity.ID, session.Subject)
+	if err != nil {
+		ltiError(c, err)
+		return
+	}
+	items, err := ltiQuestions(questions)
+	if err != nil {
+		ltiError(c, err)
+		return
+	}
+	data["Questions"] = items
+	data["Submissions"] = submissions
+	data["Closed"] = activity.MaxAttempts > 0 && len(submissions) >= activity.MaxAttempts
+	renderLTIPage(c, http.StatusOK, playPage, data)
+}
+
+// pageSession 页面中的会话必须是指定的消息类型，失败时已写入错误页面
+func (h *LTIHandler) pageSession(c *gin.Context, messageType string) (*storage.LTISession, bool) {
+	session, err := h.lti.Session(c, ltiToken(c))
+	if err != nil {
+		ltiError(c, err)
+		return nil, false
+	}
+	if session.MessageType != messageType {
+		ltiErrorPage(c, http.StatusBadRequest, "会话类型不匹配，请从课程中重新打开")
+		return nil, false
+	}
+	return session, true
+}
+
+// ltiToken 请求中的会话令牌：X-LTI-Session 请求头、表单或查询参数 lti_session
+func ltiToken(c *gin.Context) string {
+	if token := c.GetHeader(ltiSessionHeader); token != "" {
+		return token
+	}
+	if token := c.PostForm("lti_session"); token != "" {
+		return token
+	}
+	return c.Query("lti_session")
+}
+
+// ltiQuestion 学生看到的题目：渲染后的标题与选项，不含答案、解析与提示
+type ltiQuestion struct {
+	*RenderedQuestion
+	Multiple bool `json:"multiple"` // 是否多选
+}
+
+func ltiQuestions(questions []storage.Question) ([]ltiQuestion, error) {
+	items := make([]ltiQuestion, 0, len(questions))
+	for i := range questions {
+		rendered, err := renderQuestion(&questions[i])
+		if err != nil {
+			return nil, fmt.Errorf("渲染题目 %d 失败: %w", questions[i].ID, err)
+		}
+		rendered.Explanations, rendered.Hint = nil, ""
+		items = append(items, ltiQuestion{
+			RenderedQuestion: rendered,
+			Multiple:         questions[i].Type == 2 || len(questions[i].Rights) > 1,
+		})
+	}
+	return items, nil
+}
+
+// ltiError 在浏览器中显示业务错误
+func ltiError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch services.ErrorKindOf(err) {
+	case services.ErrInvalid:
+		status = http.StatusBadRequest
+	case services.ErrNotFound:
+		status = http.StatusNotFound
+	case services.ErrForbidden:
+		status = http.StatusForbidden
+	}
+	ltiErrorPage(c, status, err.Error())
+}
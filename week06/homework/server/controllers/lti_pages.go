@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LTI 页面在平台的 iframe 或新窗口中打开，会话令牌通过表单字段传递，不依赖 Cookie
+const ltiHead = `<!DOCTYPE html><html><head><meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<link rel="stylesheet" href="/api/render/highlight.css">
+<style>body{max-width:860px;margin:1.5em auto;padding:0 1em;font-family:sans-serif;line-height:1.5}
+.card{border:1px solid #ddd;border-radius:6px;padding:.8em 1em;margin:1em 0}
+.option{display:flex;gap:.5em;align-items:flex-start;margin:.3em 0}.option div p{margin:0}
+pre{padding:.6em;overflow:auto}.muted{color:#777}.error{color:#b00}
+button{padding:.5em 1.5em;font-size:1em}</style></head><body>`
+
+var (
+	ltiErrorTemplate = ltiPage(`<h2>无法打开</h2><p class="error">{{.Message}}</p>`)
+
+	deepLinkPage = ltiPage(`<h2>选择考试或练习</h2>{{if .Course}}<p class="muted">课程：{{.Course}}</p>{{end}}
+{{if .Activities}}<form method="post" action="/api/lti/deep-link"><input type="hidden" name="lti_session" value="{{.Token}}">
+{{range $i, $a := .Activities}}<label class="card option"><input type="radio" name="activity_id" value="{{$a.ID}}"{{if eq $i 0}} checked{{end}}>
+<div><strong>{{$a.Title}}</strong><br><span class="muted">{{if eq $a.Kind "exam"}}考试{{else}}练习{{end}} · {{len $a.QuestionIDs}} 题 ·
+{{if $a.MaxAttempts}}限提交 {{$a.MaxAttempts}} 次{{else}}不限次数{{end}}</span></div></label>{{end}}
+<button type="submit">添加到课程</button></form>
+{{else}}<p>当前工作区还没有考试或练习，请先通过 POST /api/lti/activities 创建。</p>{{end}}`)
+
+	autoPostPage = ltiPage(`<form id="f" method="post" action="{{.Action}}">{{range $k, $v := .Fields}}<input type="hidden" name="{{$k}}" value="{{$v}}">{{end}}
+<noscript><button type="submit">继续</button></noscript></form><p class="muted">正在返回课程…</p>
+<script>document.getElementById("f").submit()</script>`)
+
+	playPage = ltiPage(`<h2>{{.Activity.Title}}</h2>
+<p class="muted">{{if .Name}}{{.Name}} · {{end}}{{if eq .Activity.Kind "exam"}}考试{{else}}练习{{end}} · 共 {{len .Questions}} 题</p>
+{{with .Submission}}<div class="card"><strong>本次得分：{{.Correct}} / {{.Total}}</strong>
+{{if eq .PassbackStatus "pending"}}<br><span class="muted">成绩正在同步到课程</span>{{end}}</div>{{end}}
+{{if .Submissions}}<p class="muted">已提交 {{len .Submissions}} 次{{if .Activity.MaxAttempts}}（最多 {{.Activity.MaxAttempts}} 次）{{end}}，
+最近一次 {{(index .Submissions 0).Correct}} / {{(index .Submissions 0).Total}}</p>{{end}}
+{{if .Closed}}<p>已达到最多提交次数。</p>{{else}}
+<form method="post" action="/api/lti/play"><input type="hidden" name="lti_session" value="{{.Token}}">
+{{range $i, $q := .Questions}}<div class="card"><strong>{{inc $i}}.</strong> {{safe $q.Title}}
+{{range $q.Options}}<label class="option"><input type="{{if $q.Multiple}}checkbox{{else}}radio{{end}}" name="q{{$q.ID}}" value="{{.Label}}">
+<strong>{{.Label}}.</strong><div>{{safe .HTML}}</div></label>{{end}}</div>{{end}}
+<button type="submit">提交</button></form>{{end}}`)
+)
+
+// ltiPage 解析页面模板；渲染后的题目标题与选项已经过清洗，通过 safe 直接插入页面
+func ltiPage(body string) *template.Template {
+	funcs := template.FuncMap{
+		"inc":  func(i int) int { return i + 1 },
+		"safe": func(s string) template.HTML { return template.HTML(s) },
+	}
+	return template.Must(template.New("lti").Funcs(funcs).Parse(ltiHead + body + `</body></html>`))
+}
+
+// renderLTIPage 渲染页面，失败时记录日志并返回 500
+func renderLTIPage(c *gin.Context, status int, tmpl *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Printf("[LTI] 渲染页面失败: %v", err)
+		c.String(http.StatusInternalServerError, "页面渲染失败")
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// ltiErrorPage 在浏览器中显示错误（LTI 接口由平台跳转进入，返回页面而不是JSON）
+func ltiErrorPage(c *gin.Context, status int, message string) {
+	renderLTIPage(c, status, ltiErrorTemplate, gin.H{"Message": message})
+}
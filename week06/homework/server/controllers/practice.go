@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/storage"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	targetSuccess   = 0.7            // 期望答对概率（略有挑战的难度最利于学习）
+	recentWindow    = 24 * time.Hour // 该时间内练过的题不再推荐（错题复习除外）
+	repeatPenalty   = 0.15           // 同一知识点重复推荐的惩罚
+	maxPracticeSize = 20
+)
+
+type PracticeHandler struct {
+	db *storage.Database
+}
+
+type practiceRequest struct {
+	StudentID string `form:"student_id" binding:"required"`
+	Count     int    `form:"count,default=1"`
+	Type      int    `form:"type"`
+	Language  string `form:"language"`
+	Knowledge string `form:"knowledge"`
+	Locale    string `form:"locale"`
+}
+
+// 推荐给学生的练习题（不含答案）
+type practiceItem struct {
+	Question struct {
+		ID       int      `json:"id"`
+		Type     int      `json:"type"`
+		Title    string   `json:"title"`
+		Language string   `json:"language"`
+		Answers  []string `json:"answers"`
+		Tags     []string `json:"tags"`
+	} `json:"question"`
+	Mode            string  `json:"mode"` // review-错题复习 adaptive-自适应推荐
+	Knowledge       string  `json:"knowledge"`
+	StudentRating   float64 `json:"student_rating"`
+	QuestionRating  float64 `json:"question_rating"`
+	ExpectedCorrect float64 `json:"expected_correct"`
+	Reason          string  `json:"reason"`
+}
+
+func NewPracticeHandler(db *storage.Database) *PracticeHandler {
+	return &PracticeHandler{db: db}
+}
+
+// Next 为学生挑选下一道（或几道）练习题，并说明挑选原因
+// 优先安排到期的错题复习，其余名额按知识点掌握度与题目难度自适应选择
+func (h *PracticeHandler) Next(c *gin.Context) {
+	db := h.db.WithContext(c)
+	// 1. 参数校验
+	var req practiceRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if req.Count < 1 || req.Count > maxPracticeSize {
+		api.Error(c, http.StatusBadRequest, fmt.Sprintf("count 需在1-%d之间", maxPracticeSize))
+		return
+	}
+
+	// 2. 读取学生掌握度
+	masteries, err := db.GetMastery(req.StudentID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "读取掌握度失败")
+		return
+	}
+	mastery := make(map[string]storage.Mastery, len(masteries))
+	for _, m := range masteries {
+		mastery[m.Knowledge] = m
+	}
+
+	now := time.Now()
+	items := make([]practiceItem, 0, req.Count)
+	picked := make(map[int]bool) // 已选题目组，同一题目的不同语言版本只推荐一次
+
+	filter := storage.PracticeFilter{
+		WorkspaceID: currentWorkspace(c).ID,
+		Type:        req.Type,
+		Language:    req.Language,
+		Knowledge:   req.Knowledge,
+		Locale:      req.Locale,
+	}
+
+	// 3. 到期错题复习（与自适应推荐使用相同的练习范围）
+	reviews, err := db.DueReviews(req.StudentID, now, filter, req.Count)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "读取错题复习队列失败")
+		return
+	}
+	for _, r := range reviews {
+		q, err := db.GetCandidate(r.QuestionID)
+		if err != nil {
+			continue
+		}
+		knowledge, rating := weakestKnowledge(q.Knowledge, mastery)
+		item := newPracticeItem(q, "review", knowledge, rating)
+		item.Reason = fmt.Sprintf("错题复习：该题于%s答错，第%d轮间隔复习已于%s到期",
+			r.MissedAt, r.Box+1, r.DueAt)
+		items = append(items, item)
+		picked[q.GroupID] = true
+	}
+
+	// 4. 自适应推荐
+	if len(items) < req.Count {
+		candidates, err := db.PracticeCandidates(req.StudentID, now.Add(-recentWindow), filter)
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, "读取候选题目失败")
+			return
+		}
+
+		weakest := math.Inf(1)
+		for _, q := range candidates {
+			if _, rating := weakestKnowledge(q.Knowledge, mastery); rating < weakest {
+				weakest = rating
+			}
+		}
+
+		usedKnowledge := make(map[string]int)
+		for len(items) < req.Count {
+			best, bestScore := -1, math.Inf(1)
+			for i, q := range candidates {
+				if picked[q.GroupID] {
+					continue
+				}
+				knowledge, rating := weakestKnowledge(q.Knowledge, mastery)
+				expected := storage.ExpectedScore(rating, q.Rating)
+				// 越接近目标难度、知识点越薄弱，得分越低越优先
+				score := math.Abs(expected-targetSuccess) +
+					(rating-weakest)/400 +
+					repeatPenalty*float64(usedKnowledge[knowledge])
+				if score < bestScore || (score == bestScore && q.ID < candidates[best].ID) {
+					best, bestScore = i, score
+				}
+			}
+			if best < 0 {
+				break
+			}
+
+			q := candidates[best]
+			knowledge, rating := weakestKnowledge(q.Knowledge, mastery)
+			item := newPracticeItem(&q, "adaptive", knowledge, rating)
+			item.Reason = adaptiveReason(item, mastery[knowledge], q.Attempts)
+			items = append(items, item)
+			picked[q.GroupID] = true
+			usedKnowledge[knowledge]++
+		}
+	}
+
+	api.Success(c, gin.H{
+		"student_id": req.StudentID,
+		"items":      items,
+	})
+}
+
+// Mastery 学生各知识点掌握度
+func (h *PracticeHandler) Mastery(c *gin.Context) {
+	studentID := c.Query("student_id")
+	if studentID == "" {
+		api.Error(c, http.StatusBadRequest, "student_id 不能为空")
+		return
+	}
+
+	items, err := h.db.WithContext(c).GetMastery(studentID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "读取掌握度失败")
+		return
+	}
+	for i := range items {
+		items[i].Rating = math.Round(items[i].Rating*10) / 10
+	}
+
+	api.Success(c, gin.H{
+		"student_id": studentID,
+		"mastery":    items,
+	})
+}
+
+// weakestKnowledge 返回题目所属知识点中学生掌握最弱的一个
+func weakestKnowledge(knowledge []string, mastery map[string]storage.Mastery) (string, float64) {
+	sorted := append([]string(nil), knowledge...)
+	sort.Strings(sorted)
+
+	name, rating := "", math.Inf(1)
+	for _, k := range sorted {
+		r := storage.InitialRating
+		if m, ok := mastery[k]; ok {
+			r = m.Rating
+		}
+		if r < rating {
+			name, rating = k, r
+		}
+	}
+	return name, rating
+}
+
+func newPracticeItem(q *storage.PracticeCandidate, mode, knowledge string, rating float64) practiceItem {
+	item := practiceItem{
+		Mode:            mode,
+		Knowledge:       knowledge,
+		StudentRating:   math.Round(rating*10) / 10,
+		QuestionRating:  math.Round(q.Rating*10) / 10,
+		ExpectedCorrect: math.Round(storage.ExpectedScore(rating, q.Rating)*1000) / 1000,
+	}
+	item.Question.ID = q.ID
+	item.Question.Type = q.Type
+	item.Question.Title = q.Title
+	item.Question.Language = q.Language
+	_ = json.Unmarshal([]byte(q.Answers), &item.Question.Answers)
+	_ = json.Unmarshal([]byte(q.Tags), &item.Question.Tags)
+	return item
+}
+
+func adaptiveReason(item practiceItem, m storage.Mastery, questionAttempts int) string {
+	var parts []string
+	if m.Attempts == 0 {
+		parts = append(parts, fmt.Sprintf("知识点「%s」尚未练习过", item.Knowledge))
+	} else {
+		parts = append(parts, fmt.Sprintf("知识点「%s」是当前较薄弱的知识点（掌握度%.0f，已练习%d次）",
+			item.Knowledge, item.StudentRating, m.Attempts))
+	}
+	if questionAttempts == 0 {
+		parts = append(parts, "该题暂无作答数据，按默认难度估计")
+	} else {
+		parts = append(parts, fmt.Sprintf("该题难度%.0f（基于%d次历史作答估计）", item.QuestionRating, questionAttempts))
+	}
+	parts = append(parts, fmt.Sprintf("预计答对概率%.0f%%（目标%.0f%%）",
+		item.ExpectedCorrect*100, targetSuccess*100))
+	return strings.Join(parts, "；")
+}
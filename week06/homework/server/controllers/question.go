@@ -6,29 +6,28 @@ import (
 	"Server/storage"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type QuestionController struct {
-	service services.AIService
-	storage storage.Storage
-	db      *storage.Database
+	service   services.AIService
+	storage   storage.Storage
+	db        *storage.Database
+	questions *services.QuestionService
 }
 
-func NewController(service services.AIService, storage storage.Storage, db *storage.Database) *QuestionController {
+func NewController(service services.AIService, storage storage.Storage, db *storage.Database, questions *services.QuestionService) *QuestionController {
 	return &QuestionController{
-		service: service,
-		storage: storage,
-		db:      db,
+		service:   service,
+		storage:   storage,
+		db:        db,
+		questions: questions,
 	}
 }
 
 func (c *QuestionController) GenerateQuestion(ctx *gin.Context) {
-	startTime := time.Now()
 	var req config.QuestionRequest
 
 	// 参数绑定
@@ -37,15 +36,14 @@ func (c *QuestionController) GenerateQuestion(ctx *gin.Context) {
 		return
 	}
 
-	// 调用服务
-	resp, err := c.service.GenerateQuestion(ctx, req)
-	logEntry := buildLog(req, resp, err, startTime)
-	if saveErr := c.storage.Save(logEntry); saveErr != nil {
-		log.Printf("日志存储失败: %v", saveErr)
+	// 检查工作区允许的语言与每日AI调用次数后调用服务，写入AI日志与 ai.generated 事件
+	resp, _, err := c.questions.Generate(ctx, callerOf(ctx), req, nil)
+	if err != nil && services.ErrorKindOf(err) != services.ErrUpstream {
+		respondError(ctx, err)
+		return
 	}
 
-	//数据库操作被注释掉，封装在函数AddQuestions中
-	
+	// AI调用失败时 aiRes 为空，失败原因记录在AI日志中
 	ctx.JSON(http.StatusOK, gin.H{
 		"code":  0,
 		"msg":   "",
@@ -53,23 +51,6 @@ func (c *QuestionController) GenerateQuestion(ctx *gin.Context) {
 	})
 }
 
-func buildLog(req config.QuestionRequest, resp *config.QuestionResponses, err error, start time.Time) config.AILog {
-    logEntry := config.AILog{
-        AIStartTime: start.Format("2006-01-02 15:04:05"),
-        AIEndTime:   time.Now().Format("2006-01-02 15:04:05"),
-        AICostTime:  fmt.Sprintf("%.2fs", time.Since(start).Seconds()),
-        AIReq:       req,
-        Status:      "success",
-    }
-
-    if err != nil {
-        logEntry.Status = "failed"
-        logEntry.Error = err.Error()
-    } else {
-        logEntry.AIRes = *resp 
-    }
-    return logEntry
-}
 func sendError(ctx *gin.Context, code int, msg string) {
 	ctx.JSON(code, gin.H{
 		"code": code,
@@ -85,6 +66,13 @@ func (c *QuestionController) AddQuestions(ctx *gin.Context) {
         Language string `json:"language"`
         Answers  []string `json:"answers"`
         Rights   []string `json:"rights"`
+        Tags     []string `json:"tags"`
+        Source   string   `json:"source"`
+
+        Explanations []string `json:"explanations"`
+        Hint         string   `json:"hint"`
+        Reference    string   `json:"reference"`
+        Locale       string   `json:"locale"`
     }
 
     if err := ctx.ShouldBindJSON(&questions); err != nil {
@@ -92,27 +80,83 @@ func (c *QuestionController) AddQuestions(ctx *gin.Context) {
         return
     }
 
+    // 校验Markdown代码块是否闭合、引用的附件是否存在
+    ws := currentWorkspace(ctx)
+    for i, q := range questions {
+        if err := services.ValidateQuestionMarkdown(q.Title, q.Answers, q.Explanations, q.Hint); err != nil {
+            sendError(ctx, http.StatusBadRequest, fmt.Sprintf("第 %d 道题%s", i+1, err))
+            return
+        }
+        if !languageAllowed(ws, q.Language) {
+            sendError(ctx, http.StatusBadRequest, fmt.Sprintf("第 %d 道题的语言 %s 不在工作区允许范围内", i+1, q.Language))
+            return
+        }
+        if err := checkAttachmentRefs(c.db.WithContext(ctx), questionTexts(q.Title, q.Answers, q.Explanations, q.Hint)...); err != nil {
+            sendError(ctx, http.StatusBadRequest, fmt.Sprintf("第 %d 道题%s", i+1, err))
+            return
+        }
+    }
+
+    // 检查工作区题目数上限
+    if !checkQuestionQuota(ctx, c.db, ws, len(questions)) {
+        return
+    }
+
     // 开启事务
-    tx, err := c.db.Beginx()
+    tx, err := c.db.WithContext(ctx).Beginx()
     if err != nil {
         sendError(ctx, http.StatusInternalServerError, "服务不可用")
         return
     }
 
     // 批量插入
+    ids := make([]int, 0, len(questions))
     for _, q := range questions {
         answersJSON, _ := json.Marshal(q.Answers)
         rightsJSON, _ := json.Marshal(q.Rights)
+        // 批量插入主要用于保存AI生成结果，未指定来源时按AI处理
+        source := q.Source
+        if source == "" {
+            source = config.SourceAI
+        }
+        locale := q.Locale
+        if locale == "" {
+            locale = config.LocaleZh
+        }
+        explanationsJSON, _ := json.Marshal(q.Explanations)
+        if q.Explanations == nil {
+            explanationsJSON = []byte("[]")
+        }
+        explanationSource := ""
+        if len(q.Explanations) > 0 || q.Hint != "" {
+            explanationSource = storage.ExplanationFromHand
+            if source == config.SourceAI {
+                explanationSource = storage.ExplanationFromAI
+            }
+        }
         
-        _, err = tx.NamedExec(`
-            INSERT INTO questions (type, title, language, answers, rights)
-            VALUES (:type, :title, :language, :answers, :rights)`,
+        result, err := tx.NamedExec(`
+            INSERT INTO questions (type, title, language, answers, rights, tags, source, status, created_at,
+                explanations, hint, reference, explanation_source, explanation_at, locale, workspace_id)
+            VALUES (:type, :title, :language, :answers, :rights, :tags, :source, :status, datetime('now', 'localtime'),
+                :explanations, :hint, :reference, :explanation_source,
+                CASE WHEN :explanation_source = '' THEN '' ELSE datetime('now', 'localtime') END, :locale, :workspace_id)`,
             map[string]interface{}{
                 "type":     q.Type,
                 "title":    q.Title,
                 "language": q.Language,
                 "answers":  string(answersJSON),
                 "rights":   string(rightsJSON),
+                "tags":     storage.MarshalTags(q.Tags),
+                "source":   source,
+                "status":   config.StatusActive,
+
+                "explanations":       string(explanationsJSON),
+                "hint":               q.Hint,
+                "reference":          q.Reference,
+                "explanation_source": explanationSource,
+                "locale":             locale,
+                "workspace_id":       ws.ID,
             })
         
         if err != nil {
@@ -120,9 +164,14 @@ func (c *QuestionController) AddQuestions(ctx *gin.Context) {
             sendError(ctx, http.StatusInternalServerError, "存储失败")
             return
         }
+        id, _ := result.LastInsertId()
+        ids = append(ids, int(id))
     }
 
-    if err := tx.Commit(); err != nil {
+    // 与题目一起提交 question.imported 事件
+    event := storage.NewEvent(ws.ID, storage.EventQuestionImported, ids, map[string]interface{}{"count": len(ids)})
+    if err := c.db.WithContext(ctx).CommitWithEvent(tx, event); err != nil {
+        tx.Rollback()
         sendError(ctx, http.StatusInternalServerError, "事务提交失败")
         return
     }
@@ -130,5 +179,6 @@ func (c *QuestionController) AddQuestions(ctx *gin.Context) {
     ctx.JSON(http.StatusOK, gin.H{
         "code": 0,
         "msg":  "添加成功",
+        "data": gin.H{"ids": ids},
     })
-}
\ No newline at end of file
+}
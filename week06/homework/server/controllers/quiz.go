@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/lifecycle"
+	"Server/services"
+	"Server/storage"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	quizDefaultSeconds = 20
+	quizMaxQuestions   = 100
+	quizMaxMessage     = 4096             // 客户端消息的最大字节数
+	quizPongWait       = 60 * time.Second // 超过这一时间没有收到 pong 视为断线
+	quizPingPeriod     = 25 * time.Second
+	quizWriteWait      = 10 * time.Second
+)
+
+// QuizHandler 课堂实时测验：教师创建测验后通过WebSocket主持，学生凭加入码参加
+type QuizHandler struct {
+	db       *storage.Database
+	hub      *services.QuizHub
+	app      *lifecycle.Manager
+	upgrader websocket.Upgrader
+}
+
+func NewQuizHandler(db *storage.Database, hub *services.QuizHub, app *lifecycle.Manager, corsOrigin string) *QuizHandler {
+	h := &QuizHandler{db: db, hub: hub, app: app}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 4096,
+		// 只接受同源页面与 CORS 配置中允许的前端
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" || corsOrigin == "*" || origin == corsOrigin {
+				return true
+			}
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		},
+	}
+	return h
+}
+
+// 创建测验参数
+type quizCreateRequest struct {
+	IDs     []int  `json:"ids" binding:"required,min=1"`
+	Seconds int    `json:"seconds"` // 每题作答时间，默认20秒
+	Title   string `json:"title"`
+}
+
+// Create 用当前工作区的题目创建测验，返回学生加入码与主持人令牌（只返回这一次）
+func (h *QuizHandler) Create(c *gin.Context) {
+	// 1. 参数校验
+	var req quizCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if req.Seconds == 0 {
+		req.Seconds = quizDefaultSeconds
+	}
+	if req.Seconds < 5 || req.Seconds > 300 {
+		api.Error(c, http.StatusBadRequest, "seconds 必须在5-300之间")
+		return
+	}
+	if len(req.IDs) > quizMaxQuestions {
+		api.Error(c, http.StatusBadRequest, fmt.Sprintf("一场测验最多 %d 道题", quizMaxQuestions))
+		return
+	}
+	seen := make(map[int]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("题目 %d 重复", id))
+			return
+		}
+		seen[id] = true
+	}
+
+	// 2. 读取题目，按请求中的顺序出题
+	ws := currentWorkspace(c)
+	list, err := h.db.WithContext(c).ListQuestions(storage.QuestionFilter{WorkspaceID: ws.ID, IDs: req.IDs})
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	byID := make(map[int]*storage.Question, len(list))
+	for i := range list {
+		byID[list[i].ID] = &list[i]
+	}
+	questions := make([]services.QuizQuestion, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		q, ok := byID[id]
+		if !ok {
+			api.Error(c, http.StatusNotFound, fmt.Sprintf("题目 %d 不存在", id))
+			return
+		}
+		if len(q.Rights) == 0 {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("题目 %d 没有标准答案", id))
+			return
+		}
+		rendered, err := renderQuestion(q)
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, fmt.Sprintf("渲染题目 %d 失败: %v", id, err))
+			return
+		}
+		explanations := rendered.Explanations
+		// 作答期间不下发解析与提示，公布答案时再下发解析
+		rendered.Explanations, rendered.Hint = nil, ""
+		questions = append(questions, services.QuizQuestion{
+			ID:           q.ID,
+			Content:      rendered,
+			Rights:       q.Rights,
+			Explanations: explanations,
+		})
+	}
+
+	// 3. 打开房间
+	session := &storage.QuizSession{
+		WorkspaceID: ws.ID,
+		Title:       strings.TrimSpace(req.Title),
+		Host:        c.GetHeader(userHeader),
+		QuestionIDs: req.IDs,
+		Seconds:     req.Seconds,
+	}
+	room, err := h.hub.Open(c, session, questions)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"session":    session,
+		"host_token": room.HostToken(),
+	})
+}
+
+// List 当前工作区最近的测验
+func (h *QuizHandler) List(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		api.Error(c, http.StatusBadRequest, "limit 必须在1-100之间")
+		return
+	}
+	sessions, err := h.db.WithContext(c).ListQuizSessions(currentWorkspace(c).ID, limit)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, sessions)
+}
+
+// Get 测验结果：完整排行榜与逐题的作答分布，测验进行中时为当前进度
+func (h *QuizHandler) Get(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的测验ID")
+		return
+	}
+	db := h.db.WithContext(c)
+	session, err := db.GetQuizSession(currentWorkspace(c).ID, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if session == nil {
+		api.Error(c, http.StatusNotFound, "测验不存在")
+		return
+	}
+	results, err := db.GetQuizResults(session)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"session":     results.Session,
+		"live":        h.hub.Live(session.ID),
+		"leaderboard": results.Leaderboard,
+		"questions":   results.Questions,
+	})
+}
+
+// Connect 建立测验的WebSocket连接。
+// 教师：?code=<加入码>&host_token=<令牌>；学生：?code=<加入码>&name=<昵称>[&student_id=<学号>]，
+// 断线重连时带上 welcome 消息中的 participant=<参与者ID>
+func (h *QuizHandler) Connect(c *gin.Context) {
+	// 1. 升级连接前完成校验，错误以普通HTTP响应返回
+	room := h.hub.Room(c.Query("code"))
+	if room == nil {
+		api.Error(c, http.StatusNotFound, "测验不存在或已结束")
+		return
+	}
+	var client *services.QuizClient
+	var err error
+	if token := c.Query("host_token"); token != "" {
+		client, err = room.JoinHost(token)
+	} else {
+		name := strings.TrimSpace(c.Query("name"))
+		participant := c.Query("participant")
+		if participant == "" && name == "" {
+			api.Error(c, http.StatusBadRequest, "请填写昵称（name）")
+			return
+		}
+		if utf8.RuneCountInString(name) > services.QuizMaxNameLength {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("昵称最多 %d 个字", services.QuizMaxNameLength))
+			return
+		}
+		client, err = room.JoinStudent(name, strings.TrimSpace(c.Query("student_id")), participant)
+	}
+	switch {
+	case errors.Is(err, services.ErrQuizHostToken):
+		api.Error(c, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, services.ErrQuizFinished), errors.Is(err, services.ErrQuizParticipant):
+		api.Error(c, http.StatusGone, err.Error())
+		return
+	case err != nil:
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		client.Leave() // Upgrade 已写入错误响应
+		return
+	}
+
+	// 2. 读取客户端消息交给房间处理；返回前关闭连接并等待读取结束
+	done := make(chan struct{})
+	defer func() {
+		conn.Close()
+		<-done
+		client.Leave()
+	}()
+	conn.SetReadLimit(quizMaxMessage)
+	_ = conn.SetReadDeadline(time.Now().Add(quizPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(quizPongWait))
+	})
+	go func() {
+		defer close(done)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			client.Handle(data)
+		}
+	}()
+
+	// 3. 推送房间消息并定时 ping；客户端断开、测验结束或服务退出时返回
+	ping := time.NewTicker(quizPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-h.app.Closing():
+			closeQuizConn(conn, websocket.CloseGoingAway, "服务正在重启")
+			return
+		case msg, ok := <-client.Send():
+			if !ok {
+				closeQuizConn(conn, websocket.CloseNormalClosure, "")
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(quizWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(quizWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// closeQuizConn 发送关闭帧，客户端据此区分正常结束与网络断开
+func closeQuizConn(conn *websocket.Conn, code int, reason string) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(quizWriteWait))
+}
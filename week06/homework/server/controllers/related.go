@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/config"
+	"Server/services"
+	"Server/storage"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRelatedLimit = 10
+	maxRelatedLimit     = 50
+	maxSimilarTextSize  = 8 << 10
+)
+
+// RelatedHandler 基于题目向量的相关题目推荐、文本检索与覆盖分析
+type RelatedHandler struct {
+	db    *storage.Database
+	index *services.EmbeddingIndex
+}
+
+// 按文本检索相似题目的请求
+type similarRequest struct {
+	Text     string   `json:"text" binding:"required"`
+	Type     int      `json:"type"`
+	Language string   `json:"language"`
+	Limit    int      `json:"limit"`
+	MinScore *float64 `json:"min_score"`
+}
+
+// relatedItem 检索结果，附带题目的基本信息
+type relatedItem struct {
+	ID       int      `json:"id"`
+	Score    float64  `json:"score"`
+	Type     int      `json:"type"`
+	Language string   `json:"language"`
+	Title    string   `json:"title"`
+	Tags     []string `json:"tags"`
+}
+
+func NewRelatedHandler(db *storage.Database, index *services.EmbeddingIndex) *RelatedHandler {
+	return &RelatedHandler{db: db, index: index}
+}
+
+// Related 与题目内容最相似的题目（不含该题目的其他语言版本），可选 limit（默认10）、min_score（0-1）
+func (h *RelatedHandler) Related(c *gin.Context) {
+	// 1. 参数校验
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的题目ID")
+		return
+	}
+	filter := services.SearchFilter{WorkspaceID: currentWorkspace(c).ID, Limit: defaultRelatedLimit}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 || filter.Limit > maxRelatedLimit {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("limit 必须在1-%d之间", maxRelatedLimit))
+			return
+		}
+	}
+	if v := c.Query("min_score"); v != "" {
+		if filter.MinScore, err = strconv.ParseFloat(v, 64); err != nil || filter.MinScore < 0 || filter.MinScore > 1 {
+			api.Error(c, http.StatusBadRequest, "min_score 必须在0-1之间")
+			return
+		}
+	}
+
+	// 2. 题目必须在当前工作区可见
+	q, err := h.db.WithContext(c).GetVisibleQuestion(filter.WorkspaceID, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			api.Error(c, http.StatusNotFound, "题目不存在")
+		} else {
+			api.Error(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	// 3. 检索
+	results, err := h.index.Related(c, q, filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	h.respond(c, results)
+}
+
+// Similar 与一段文本最相似的题目，录题前可用来检查题库中是否已有相近的题目。
+// 可选按题型、编程语言筛选
+func (h *RelatedHandler) Similar(c *gin.Context) {
+	// 1. 参数校验
+	var req similarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数格式错误: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		api.Error(c, http.StatusBadRequest, "text 不能为空")
+		return
+	}
+	if len(req.Text) > maxSimilarTextSize {
+		api.Error(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("text 不能超过 %dKB", maxSimilarTextSize>>10))
+		return
+	}
+	if req.Type != 0 && (req.Type < config.SingleSelect || req.Type > config.Coding) {
+		api.Error(c, http.StatusBadRequest, "无效的题型")
+		return
+	}
+	filter := services.SearchFilter{
+		WorkspaceID: currentWorkspace(c).ID,
+		Type:        req.Type,
+		Language:    req.Language,
+		Limit:       req.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultRelatedLimit
+	}
+	if filter.Limit < 1 || filter.Limit > maxRelatedLimit {
+		api.Error(c, http.StatusBadRequest, fmt.Sprintf("limit 必须在1-%d之间", maxRelatedLimit))
+		return
+	}
+	if req.MinScore != nil {
+		if *req.MinScore < 0 || *req.MinScore > 1 {
+			api.Error(c, http.StatusBadRequest, "min_score 必须在0-1之间")
+			return
+		}
+		filter.MinScore = *req.MinScore
+	}
+
+	// 2. 检索
+	results, err := h.index.Search(c, req.Text, filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	h.respond(c, results)
+}
+
+// Coverage 按内容把工作区的题目聚类，并统计各标签（知识点）的题目数，标出过多（over）与不足（under）的方向。
+// 可选 k 指定聚类数（2-30，默认按题目数自动选择）
+func (h *RelatedHandler) Coverage(c *gin.Context) {
+	k := 0
+	if v := c.Query("k"); v != "" {
+		var err error
+		if k, err = strconv.Atoi(v); err != nil || k < 2 || k > 30 {
+			api.Error(c, http.StatusBadRequest, "k 必须在2-30之间")
+			return
+		}
+	}
+	report, err := h.index.Coverage(c, currentWorkspace(c).ID, k)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, report)
+}
+
+// respond 补充题目信息后返回检索结果
+func (h *RelatedHandler) respond(c *gin.Context, results []services.RelatedQuestion) {
+	ids := make([]int, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	items := make([]relatedItem, 0, len(results))
+	if len(ids) > 0 {
+		questions, err := h.db.WithContext(c).ListQuestions(storage.QuestionFilter{IDs: ids})
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		byID := make(map[int]*storage.Question, len(questions))
+		for i := range questions {
+			byID[questions[i].ID] = &questions[i]
+		}
+		for _, r := range results {
+			// 检索后被删除的题目直接跳过
+			if q, ok := byID[r.ID]; ok {
+				items = append(items, relatedItem{ID: q.ID, Score: r.Score, Type: q.Type, Language: q.Language, Title: q.Title, Tags: q.Tags})
+			}
+		}
+	}
+	api.Success(c, gin.H{"model": h.index.Model(), "indexed": h.index.Size(), "results": items})
+}
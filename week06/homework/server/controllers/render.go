@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/config"
+	"Server/services"
+	"Server/storage"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RenderHandler 题目Markdown渲染接口
+type RenderHandler struct {
+	db *storage.Database
+}
+
+func NewRenderHandler(db *storage.Database) *RenderHandler {
+	return &RenderHandler{db: db}
+}
+
+// RenderedOption 渲染后的选项
+type RenderedOption struct {
+	Label string `json:"label"`
+	HTML  string `json:"html"`
+}
+
+// RenderedQuestion 渲染后的题目（HTML已清洗，可直接插入页面）
+type RenderedQuestion struct {
+	ID           int              `json:"id"`
+	Type         int              `json:"type"`
+	Language     string           `json:"language"`
+	Title        string           `json:"title"`
+	Options      []RenderedOption `json:"options"`
+	Explanations []string         `json:"explanations"`
+	Hint         string           `json:"hint"`
+}
+
+type renderRequest struct {
+	Text     string `json:"text" binding:"required"`
+	Language string `json:"language"`
+}
+
+// Question 渲染题目的标题、选项、解析与提示
+// ?format=html 返回可直接预览的完整页面
+func (h *RenderHandler) Question(c *gin.Context) {
+	// 1. 获取并验证ID
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的题目ID: "+idStr)
+		return
+	}
+
+	// 2. 查询题目
+	q, err := h.db.WithContext(c).GetVisibleQuestion(currentWorkspace(c).ID, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			api.Error(c, http.StatusNotFound, "题目不存在")
+		} else {
+			api.Error(c, http.StatusInternalServerError, "查询题目失败: "+err.Error())
+		}
+		return
+	}
+
+	// 3. 渲染
+	rendered, err := renderQuestion(q)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if c.Query("format") == "html" {
+		css, err := services.HighlightCSS()
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, "生成样式失败: "+err.Error())
+			return
+		}
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.String(http.StatusOK, questionPage(rendered, css))
+		return
+	}
+	api.Success(c, rendered)
+}
+
+// Markdown 渲染任意Markdown文本（用于编辑时预览）
+func (h *RenderHandler) Markdown(c *gin.Context) {
+	var req renderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	html, err := services.RenderMarkdown(req.Text, req.Language)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"html":  html,
+		"error": fenceError(req.Text),
+	})
+}
+
+// CSS 代码高亮样式表
+func (h *RenderHandler) CSS(c *gin.Context) {
+	css, err := services.HighlightCSS()
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "生成样式失败: "+err.Error())
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "text/css; charset=utf-8", []byte(css))
+}
+
+func renderQuestion(q *storage.Question) (*RenderedQuestion, error) {
+	rendered := &RenderedQuestion{
+		ID:           q.ID,
+		Type:         q.Type,
+		Language:     q.Language,
+		Options:      make([]RenderedOption, 0, len(q.Answers)),
+		Explanations: make([]string, 0, len(q.Explanations)),
+	}
+
+	var err error
+	if rendered.Title, err = services.RenderMarkdown(q.Title, q.Language); err != nil {
+		return nil, err
+	}
+	for i, ans := range q.Answers {
+		label, body := services.StripOptionPrefix(ans)
+		if label == "" {
+			label = string(rune('A' + i))
+		}
+		// 旧数据中编程题选项是单行纯代码，按代码块渲染
+		if q.Type == config.Coding && !strings.Contains(body, "`") {
+			body = "```\n" + body + "\n```"
+		}
+		html, err := services.RenderMarkdown(body, q.Language)
+		if err != nil {
+			return nil, err
+		}
+		rendered.Options = append(rendered.Options, RenderedOption{Label: label, HTML: html})
+	}
+	for _, exp := range q.Explanations {
+		html, err := services.RenderMarkdown(exp, q.Language)
+		if err != nil {
+			return nil, err
+		}
+		rendered.Explanations = append(rendered.Explanations, html)
+	}
+	if q.Hint != "" {
+		if rendered.Hint, err = services.RenderMarkdown(q.Hint, q.Language); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// 代码块未闭合时返回提示，便于编辑器标红
+func fenceError(text string) string {
+	if err := services.CheckCodeFences(text); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// questionPage 组装预览页面，各片段均已清洗
+func questionPage(q *RenderedQuestion, css string) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html><html><head><meta charset=\"utf-8\">")
+	b.WriteString(fmt.Sprintf("<title>题目 %d</title><style>%s\n", q.ID, css))
+	b.WriteString("body{max-width:860px;margin:2em auto;font-family:sans-serif}.option{display:flex;gap:.5em}pre{padding:.6em;overflow:auto}</style></head><body>")
+	b.WriteString(q.Title)
+	for _, opt := range q.Options {
+		b.WriteString(fmt.Sprintf("<div class=\"option\"><strong>%s.</strong><div>%s</div></div>", template.HTMLEscapeString(opt.Label), opt.HTML))
+	}
+	if len(q.Explanations) > 0 {
+		b.WriteString("<h3>解析</h3>")
+		for _, exp := range q.Explanations {
+			b.WriteString(exp)
+		}
+	}
+	if q.Hint != "" {
+		b.WriteString("<h3>提示</h3>" + q.Hint)
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/services"
+	"Server/storage"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultRetentionRuns = 20
+
+// RetentionHandler 工作区的题库清理策略、试运行、手动执行与执行记录
+type RetentionHandler struct {
+	db      *storage.Database
+	manager *services.RetentionManager
+}
+
+// 清理策略请求，试运行时未填写的字段沿用已保存的策略
+type retentionPolicyRequest struct {
+	Enabled             *bool `json:"enabled"`
+	ArchiveUnusedMonths *int  `json:"archive_unused_months"`
+	PurgeRejectedDays   *int  `json:"purge_rejected_days"`
+}
+
+func NewRetentionHandler(db *storage.Database, manager *services.RetentionManager) *RetentionHandler {
+	return &RetentionHandler{db: db, manager: manager}
+}
+
+// GetPolicy 当前工作区的清理策略，未设置时各项为0且未启用
+func (h *RetentionHandler) GetPolicy(c *gin.Context) {
+	policy, err := h.db.WithContext(c).GetRetentionPolicy(currentWorkspace(c).ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, policy)
+}
+
+// UpdatePolicy 修改清理策略（有成员的工作区需要 owner），未填写的字段保持不变
+func (h *RetentionHandler) UpdatePolicy(c *gin.Context) {
+	if !requireRetentionOwner(c) {
+		return
+	}
+	policy, ok := h.policy(c)
+	if !ok {
+		return
+	}
+	policy.UpdatedBy = c.GetHeader(userHeader)
+	if err := h.db.WithContext(c).SaveRetentionPolicy(policy); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, policy)
+}
+
+// DryRun 试运行：列出按策略将被归档与删除的题目以及因被引用而跳过的题目，不做修改。
+// 请求体可临时覆盖策略的各项，用于保存前预览
+func (h *RetentionHandler) DryRun(c *gin.Context) {
+	policy, ok := h.policy(c)
+	if !ok {
+		return
+	}
+	plan, err := h.manager.Plan(c, *policy)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	api.Success(c, plan)
+}
+
+// Run 立即按已保存的策略执行一次清理（不要求启用定时执行），返回执行记录
+func (h *RetentionHandler) Run(c *gin.Context) {
+	if !requireRetentionOwner(c) {
+		return
+	}
+	ws := currentWorkspace(c)
+	policy, err := h.db.WithContext(c).GetRetentionPolicy(ws.ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if policy.ArchiveUnusedMonths == 0 && policy.PurgeRejectedDays == 0 {
+		api.Error(c, http.StatusBadRequest, "工作区还没有设置清理策略")
+		return
+	}
+	run, err := h.manager.Execute(c, ws, *policy, storage.RetentionManual)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, run)
+}
+
+// Runs 最近的执行记录（新的在前），?limit= 默认20
+func (h *RetentionHandler) Runs(c *gin.Context) {
+	limit := defaultRetentionRuns
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			api.Error(c, http.StatusBadRequest, "limit 必须在1-100之间")
+			return
+		}
+		limit = n
+	}
+	runs, err := h.db.WithContext(c).ListRetentionRuns(currentWorkspace(c).ID, limit)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{"total": len(runs), "runs": runs})
+}
+
+// policy 已保存的策略与请求体合并后的结果，请求体可以为空，失败时已写入响应
+func (h *RetentionHandler) policy(c *gin.Context) (*storage.RetentionPolicy, bool) {
+	var req retentionPolicyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.Error(c, http.StatusBadRequest, "参数格式错误: "+err.Error())
+			return nil, false
+		}
+	}
+	policy, err := h.db.WithContext(c).GetRetentionPolicy(currentWorkspace(c).ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.ArchiveUnusedMonths != nil {
+		policy.ArchiveUnusedMonths = *req.ArchiveUnusedMonths
+	}
+	if req.PurgeRejectedDays != nil {
+		policy.PurgeRejectedDays = *req.PurgeRejectedDays
+	}
+	if err := services.ValidatePolicy(policy); err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+	return policy, true
+}
+
+// requireRetentionOwner 修改策略与手动执行需要 owner 角色（开放的工作区除外），失败时已写入响应
+func requireRetentionOwner(c *gin.Context) bool {
+	if role := c.GetString(roleKey); role != "" && role != storage.RoleOwner {
+		api.Error(c, http.StatusForbidden, "只有 owner 可以修改清理策略或执行清理")
+		return false
+	}
+	return true
+}
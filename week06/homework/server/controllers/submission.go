@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/config"
+	"Server/services"
+	"Server/storage"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxCodeSize        = 64 << 10 // 单次提交的代码上限
+	maxCheckedStudents = 500      // 一次查重最多比对的学生数（取最近提交的学生）
+)
+
+// SubmissionHandler 编程题代码提交与查重
+type SubmissionHandler struct {
+	db *storage.Database
+}
+
+// 代码提交请求
+type codeSubmitRequest struct {
+	QuestionID int    `json:"question_id" binding:"required"`
+	StudentID  string `json:"student_id" binding:"required,max=64"`
+	Language   string `json:"language"` // 默认取题目的编程语言
+	Code       string `json:"code" binding:"required"`
+}
+
+func NewSubmissionHandler(db *storage.Database) *SubmissionHandler {
+	return &SubmissionHandler{db: db}
+}
+
+// Submit 学生提交编程题代码，只接受编程题，同一学生可以多次提交，查重时取最后一次
+func (h *SubmissionHandler) Submit(c *gin.Context) {
+	// 1. 参数校验
+	var req codeSubmitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数格式错误: "+err.Error())
+		return
+	}
+	if len(req.Code) > maxCodeSize {
+		api.Error(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("代码不能超过 %dKB", maxCodeSize>>10))
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		api.Error(c, http.StatusBadRequest, "代码不能为空")
+		return
+	}
+
+	// 2. 题目必须是当前工作区可见的编程题
+	ws := currentWorkspace(c)
+	q, err := h.db.WithContext(c).GetVisibleQuestion(ws.ID, req.QuestionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			api.Error(c, http.StatusNotFound, "题目不存在")
+		} else {
+			api.Error(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if q.Type != config.Coding {
+		api.Error(c, http.StatusBadRequest, "只有编程题可以提交代码")
+		return
+	}
+	lang := req.Language
+	if lang == "" {
+		lang = q.Language
+	}
+	lang, err = services.NormalizeCodeLanguage(lang)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// 3. 保存
+	sub := &storage.CodeSubmission{
+		QuestionID:  q.ID,
+		WorkspaceID: ws.ID, // 提交所在的工作区，共享题目的提交只在各自工作区查看
+		StudentID:   req.StudentID,
+		Language:    lang,
+		Code:        req.Code,
+	}
+	if err := h.db.WithContext(c).CreateCodeSubmission(sub); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sub.Code = ""
+	api.Success(c, sub)
+}
+
+// List 题目的代码提交（含代码），?student_id= 只看某个学生，?latest=1 每个学生只保留最后一次
+func (h *SubmissionHandler) List(c *gin.Context) {
+	q, ok := h.codingQuestion(c)
+	if !ok {
+		return
+	}
+	list, err := h.db.WithContext(c).ListCodeSubmissions(currentWorkspace(c).ID, q.ID, c.Query("student_id"), c.Query("latest") == "1")
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{"total": len(list), "submissions": list})
+}
+
+// Similarity 对题目的提交两两查重（每个学生取最后一次提交），返回相似度不低于 threshold 的提交对及相同片段的行号。
+// 可选 threshold（0-1，默认0.5）、kgram、window；?format=csv 导出报告
+func (h *SubmissionHandler) Similarity(c *gin.Context) {
+	// 1. 参数校验
+	q, ok := h.codingQuestion(c)
+	if !ok {
+		return
+	}
+	opts := services.SimilarityOptions{KGram: services.DefaultKGram, Window: services.DefaultWindow, Threshold: services.DefaultThreshold}
+	if v := c.Query("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 || t > 1 {
+			api.Error(c, http.StatusBadRequest, "threshold 必须在0-1之间")
+			return
+		}
+		opts.Threshold = t
+	}
+	for _, p := range []struct {
+		name     string
+		target   *int
+		min, max int
+	}{{"kgram", &opts.KGram, 3, 50}, {"window", &opts.Window, 1, 50}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < p.min || n > p.max {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("%s 必须在%d-%d之间", p.name, p.min, p.max))
+			return
+		}
+		*p.target = n
+	}
+
+	// 2. 查重
+	subs, err := h.db.WithContext(c).ListCodeSubmissions(currentWorkspace(c).ID, q.ID, "", true)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(subs) > maxCheckedStudents {
+		subs = subs[:maxCheckedStudents]
+	}
+	report := services.CheckSimilarity(q.ID, subs, opts)
+
+	// 3. 输出
+	if c.Query("format") == "csv" {
+		writeCSV(c, fmt.Sprintf("similarity_q%d", q.ID), similarityTable(report))
+		return
+	}
+	api.Success(c, report)
+}
+
+// codingQuestion 读取当前工作区可见的编程题，失败时已写入响应
+func (h *SubmissionHandler) codingQuestion(c *gin.Context) (*storage.Question, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的题目ID")
+		return nil, false
+	}
+	q, err := h.db.WithContext(c).GetVisibleQuestion(currentWorkspace(c).ID, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			api.Error(c, http.StatusNotFound, "题目不存在")
+		} else {
+			api.Error(c, http.StatusInternalServerError, err.Error())
+		}
+		return nil, false
+	}
+	if q.Type != config.Coding {
+		api.Error(c, http.StatusBadRequest, "只有编程题有代码提交")
+		return nil, false
+	}
+	return q, true
+}
+
+// similarityTable 查重报告的表格形式，每个提交对一行，相同片段写作 "A行-A行:B行-B行"，以分号分隔
+func similarityTable(r *services.SimilarityReport) table {
+	t := table{header: []string{
+		"question_id", "score", "student_a", "submission_a", "coverage_a",
+		"student_b", "submission_b", "coverage_b", "matched_tokens", "regions",
+	}}
+	for _, p := range r.Pairs {
+		tokens := 0
+		regions := make([]string, 0, len(p.Matches))
+		for _, m := range p.Matches {
+			tokens += m.Tokens
+			regions = append(regions, fmt.Sprintf("%d-%d:%d-%d", m.AStart, m.AEnd, m.BStart, m.BEnd))
+		}
+		t.rows = append(t.rows, []string{
+			strconv.Itoa(r.QuestionID), formatFloat(p.Score),
+			p.A.StudentID, strconv.Itoa(p.A.ID), formatFloat(p.CoverageA),
+			p.B.StudentID, strconv.Itoa(p.B.ID), formatFloat(p.CoverageB),
+			strconv.Itoa(tokens), strings.Join(regions, "; "),
+		})
+	}
+	return t
+}
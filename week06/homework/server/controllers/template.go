@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/services"
+	"Server/storage"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TemplateHandler 参数化题目模板：教师维护模板，练习与组卷时按种子生成具体的题目实例
+type TemplateHandler struct {
+	db *storage.Database
+}
+
+func NewTemplateHandler(db *storage.Database) *TemplateHandler {
+	return &TemplateHandler{db: db}
+}
+
+// 创建、修改模板参数
+type templateRequest struct {
+	Type     int      `json:"type" binding:"required"`
+	Language string   `json:"language"`
+	Title    string   `json:"title" binding:"required"`
+	Tags     []string `json:"tags"`
+	storage.TemplateSpec
+}
+
+// Create 创建模板，保存前编译并试生成一个实例
+func (h *TemplateHandler) Create(c *gin.Context) {
+	t, ok := h.bindTemplate(c)
+	if !ok {
+		return
+	}
+	t.WorkspaceID = currentWorkspace(c).ID
+	t.CreatedBy = c.GetHeader(userHeader)
+	if err := h.db.WithContext(c).CreateTemplate(t); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, t)
+}
+
+// List 当前工作区的模板
+func (h *TemplateHandler) List(c *gin.Context) {
+	list, err := h.db.WithContext(c).ListTemplates(currentWorkspace(c).ID, nil)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, list)
+}
+
+// Get 模板详情，space 为变量取值的组合数（未考虑约束）
+func (h *TemplateHandler) Get(c *gin.Context) {
+	t, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+	ct, err := services.CompileTemplate(t)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"template": t,
+		"space":    ct.SpaceSize(services.MaxTemplateSpace),
+	})
+}
+
+// Update 修改模板，已经生成的实例保持不变
+func (h *TemplateHandler) Update(c *gin.Context) {
+	existing, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+	t, ok := h.bindTemplate(c)
+	if !ok {
+		return
+	}
+	t.ID, t.WorkspaceID, t.CreatedBy, t.CreatedAt = existing.ID, existing.WorkspaceID, existing.CreatedBy, existing.CreatedAt
+	if err := h.db.WithContext(c).UpdateTemplate(t); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, t)
+}
+
+// Delete 删除模板，已生成的实例作为作答记录保留
+func (h *TemplateHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的模板ID")
+		return
+	}
+	deleted, err := h.db.WithContext(c).DeleteTemplate(currentWorkspace(c).ID, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !deleted {
+		api.Error(c, http.StatusNotFound, "模板不存在")
+		return
+	}
+	api.Success(c, gin.H{"id": id})
+}
+
+// Preview 预览模板生成的实例（含答案），不做记录。
+// ?count=5&seed=，不传 seed 时随机，返回使用的种子以便复现
+func (h *TemplateHandler) Preview(c *gin.Context) {
+	// 1. 参数校验
+	count, err := strconv.Atoi(c.DefaultQuery("count", "5"))
+	if err != nil || count < 1 || count > services.MaxTemplateVariants {
+		api.Error(c, http.StatusBadRequest, "count 必须在1-"+strconv.Itoa(services.MaxTemplateVariants)+"之间")
+		return
+	}
+	seed := rand.Int63n(1 << 31)
+	if s := c.Query("seed"); s != "" {
+		if seed, err = strconv.ParseInt(s, 10, 64); err != nil {
+			api.Error(c, http.StatusBadRequest, "无效的种子")
+			return
+		}
+	}
+	t, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+
+	// 2. 生成互不相同的实例，取值组合不足时返回的数量少于 count
+	ct, err := services.CompileTemplate(t)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	variants, err := ct.Variants(seed, count, nil)
+	if err != nil {
+		api.Error(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"seed":     seed,
+		"space":    ct.SpaceSize(services.MaxTemplateSpace),
+		"variants": variants,
+	})
+}
+
+// History 模板生成过的实例：练习中分配给学生的与组卷时使用的，?student_id= 只看某个学生
+func (h *TemplateHandler) History(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		api.Error(c, http.StatusBadRequest, "limit 必须在1-500之间")
+		return
+	}
+	t, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+	variants, err := h.db.WithContext(c).ListTemplateVariants(t.ID, strings.TrimSpace(c.Query("student_id")), limit)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, variants)
+}
+
+// 练习请求参数
+type templatePracticeRequest struct {
+	StudentID string `json:"student_id" binding:"required"`
+}
+
+// Practice 给学生生成一道该模板的新实例，优先选择学生没做过的取值；
+// 返回的题目不含答案与解析，作答后通过 Answer 判分
+func (h *TemplateHandler) Practice(c *gin.Context) {
+	// 1. 参数校验
+	var req templatePracticeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的模板ID")
+		return
+	}
+	db := h.db.WithContext(c)
+	t, err := db.GetTemplate(currentWorkspace(c).ID, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if t == nil {
+		api.Error(c, http.StatusNotFound, "模板不存在")
+		return
+	}
+
+	// 2. 生成学生没见过的实例，取值组合用完后允许重复
+	ct, err := services.CompileTemplate(t)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	seen, err := db.StudentVariantSignatures(t.ID, req.StudentID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	seed := rand.Int63n(1 << 31)
+	variants, err := ct.Variants(seed, 1, seen)
+	if err != nil {
+		api.Error(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	var v *storage.TemplateVariant
+	if len(variants) > 0 {
+		v = variants[0]
+	} else if v, err = ct.Instantiate(seed); err != nil {
+		api.Error(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	// 3. 记录实例后下发题目
+	v.TemplateID, v.WorkspaceID = t.ID, t.WorkspaceID
+	v.StudentID, v.Context = req.StudentID, storage.VariantPractice
+	q := services.VariantQuestion(t, v)
+	rendered, err := renderQuestion(&q)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "渲染题目失败: "+err.Error())
+		return
+	}
+	rendered.Explanations = nil
+	if err := db.SaveTemplateVariants([]*storage.TemplateVariant{v}); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"variant_id":  v.ID,
+		"template_id": t.ID,
+		"fresh":       len(variants) > 0,
+		"question":    rendered,
+	})
+}
+
+// 实例作答参数
+type variantAnswerRequest struct {
+	StudentID string   `json:"student_id" binding:"required"`
+	Selected  []string `json:"selected"`
+}
+
+// Answer 提交练习实例的作答，返回判分结果、标准答案与解析；每个实例只能作答一次
+func (h *TemplateHandler) Answer(c *gin.Context) {
+	// 1. 参数校验
+	var req variantAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的实例ID")
+		return
+	}
+	db := h.db.WithContext(c)
+	v, err := db.GetTemplateVariant(id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if v == nil || v.Context != storage.VariantPractice || v.StudentID != req.StudentID || v.WorkspaceID != currentWorkspace(c).ID {
+		api.Error(c, http.StatusNotFound, "题目实例不存在")
+		return
+	}
+
+	// 2. 判分并记录
+	selected := services.NormalizeOptions(req.Selected)
+	correct := services.GradeAnswer(v.Rights, selected)
+	saved, err := db.AnswerTemplateVariant(v.ID, selected, correct)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !saved {
+		api.Error(c, http.StatusConflict, "该题已作答")
+		return
+	}
+
+	// 3. 作答后下发解析
+	explanations := make([]string, 0, len(v.Explanations))
+	for _, e := range v.Explanations {
+		html, err := services.RenderMarkdown(e, "")
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, "渲染解析失败: "+err.Error())
+			return
+		}
+		explanations = append(explanations, html)
+	}
+	api.Success(c, gin.H{
+		"variant_id":   v.ID,
+		"correct":      correct,
+		"selected":     selected,
+		"rights":       v.Rights,
+		"explanations": explanations,
+	})
+}
+
+// bindTemplate 绑定模板参数并校验：能编译且至少能生成一个实例
+func (h *TemplateHandler) bindTemplate(c *gin.Context) (*storage.QuestionTemplate, bool) {
+	var req templateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return nil, false
+	}
+	t := &storage.QuestionTemplate{
+		Type:         req.Type,
+		Language:     strings.TrimSpace(req.Language),
+		Title:        req.Title,
+		TemplateSpec: req.TemplateSpec,
+		Tags:         req.Tags,
+	}
+	ct, err := services.CompileTemplate(t)
+	if err == nil {
+		_, err = ct.Instantiate(1)
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrTemplateUnsatisfiable) {
+			status = http.StatusUnprocessableEntity
+		}
+		api.Error(c, status, err.Error())
+		return nil, false
+	}
+	return t, true
+}
+
+// loadTemplate 读取路径参数中当前工作区的模板，出错时已写入响应
+func (h *TemplateHandler) loadTemplate(c *gin.Context) (*storage.QuestionTemplate, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(c, http.StatusBadRequest, "无效的模板ID")
+		return nil, false
+	}
+	t, err := h.db.WithContext(c).GetTemplate(currentWorkspace(c).ID, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if t == nil {
+		api.Error(c, http.StatusNotFound, "模板不存在")
+		return nil, false
+	}
+	return t, true
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/config"
+	"Server/storage"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type translateRequest struct {
+	Locale string `json:"locale" binding:"required,oneof=zh-CN en-US"`
+	Model  string `json:"model"`
+}
+
+// TranslateQuestion 将题目翻译为另一种语言，译本与原题关联并共享答案
+func (c *QuestionController) TranslateQuestion(ctx *gin.Context) {
+	db := c.db.WithContext(ctx)
+	// 1. 参数校验
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(ctx, http.StatusBadRequest, "无效的题目ID: "+ctx.Param("id"))
+		return
+	}
+	var req translateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		api.Error(ctx, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	model := c.service.ResolveModel(workspaceModel(ctx, req.Model))
+
+	// 2. 读取原题，共享进来的题目只读，不能添加译本
+	src, ok := c.loadQuestion(ctx, id)
+	if !ok {
+		return
+	}
+	if src.WorkspaceID != currentWorkspace(ctx).ID {
+		api.Error(ctx, http.StatusForbidden, "共享进来的题目只读，请先复制到当前工作区")
+		return
+	}
+	if src.Locale == req.Locale {
+		api.Error(ctx, http.StatusBadRequest, "题目已是目标语言")
+		return
+	}
+	// 从译本发起翻译时，目标语言不能是原题的语言（原题由人工编写，不会被译文覆盖）
+	if src.GroupID != src.ID {
+		original, err := db.GetQuestion(src.GroupID)
+		if err != nil {
+			api.Error(ctx, http.StatusInternalServerError, "查询原题失败: "+err.Error())
+			return
+		}
+		if original.Locale == req.Locale {
+			api.Error(ctx, http.StatusBadRequest, fmt.Sprintf("目标语言与原题 %d 相同，请直接编辑原题", original.ID))
+			return
+		}
+	}
+
+	// 3. 调用AI翻译（代码片段、选项前缀与数量在服务层校验）
+	tr, err := c.service.TranslateQuestion(ctx, model, config.QuestionRequest1{
+		Id:           src.ID,
+		Type:         src.Type,
+		Title:        src.Title,
+		Language:     src.Language,
+		Answers:      src.Answers,
+		Rights:       src.Rights,
+		Explanations: src.Explanations,
+		Hint:         src.Hint,
+	}, req.Locale)
+	if err != nil {
+		api.Error(ctx, http.StatusInternalServerError, "翻译失败: "+err.Error())
+		return
+	}
+
+	// 4. 保存译本
+	variantID, created, err := db.SaveVariant(src, req.Locale, tr, model)
+	if errors.Is(err, storage.ErrOriginalLocale) {
+		api.Error(ctx, http.StatusBadRequest, "目标语言与原题相同，请直接编辑原题")
+		return
+	}
+	if err != nil {
+		api.Error(ctx, http.StatusInternalServerError, "保存译本失败: "+err.Error())
+		return
+	}
+
+	// 5. 返回译本及同组一致性检查结果
+	variants, err := db.ListVariants(src.GroupID)
+	if err != nil {
+		api.Error(ctx, http.StatusInternalServerError, "查询语言版本失败: "+err.Error())
+		return
+	}
+	problems := storage.CheckVariantConsistency(variants)
+	api.Success(ctx, gin.H{
+		"id":         variantID,
+		"group_id":   src.GroupID,
+		"locale":     req.Locale,
+		"created":    created,
+		"model":      model,
+		"consistent": len(problems) == 0,
+		"problems":   problems,
+	})
+}
+
+// ListVariants 查询题目的全部语言版本，并检查各版本题型与答案是否一致
+func (c *QuestionController) ListVariants(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id <= 0 {
+		api.Error(ctx, http.StatusBadRequest, "无效的题目ID: "+ctx.Param("id"))
+		return
+	}
+
+	q, ok := c.loadQuestion(ctx, id)
+	if !ok {
+		return
+	}
+	variants, err := c.db.WithContext(ctx).ListVariants(q.GroupID)
+	if err != nil {
+		api.Error(ctx, http.StatusInternalServerError, "查询语言版本失败: "+err.Error())
+		return
+	}
+
+	problems := storage.CheckVariantConsistency(variants)
+	api.Success(ctx, gin.H{
+		"group_id":   q.GroupID,
+		"variants":   variants,
+		"consistent": len(problems) == 0,
+		"problems":   problems,
+	})
+}
+
+func (c *QuestionController) loadQuestion(ctx *gin.Context, id int) (*storage.Question, bool) {
+	q, err := c.db.WithContext(ctx).GetVisibleQuestion(currentWorkspace(ctx).ID, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			api.Error(ctx, http.StatusNotFound, "题目不存在")
+		} else {
+			api.Error(ctx, http.StatusInternalServerError, "查询题目失败: "+err.Error())
+		}
+		return nil, false
+	}
+	return q, true
+}
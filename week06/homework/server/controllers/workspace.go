@@ -0,0 +1,509 @@
+package controllers
+
+import (
+	"Server/api"
+	"Server/services"
+	"Server/storage"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	workspaceHeader = "X-Workspace" // 工作区ID或标识，未指定时使用默认工作区
+	userHeader      = "X-User"      // 当前用户，用于检查工作区成员角色
+
+	workspaceKey = "workspace"
+	roleKey      = "workspace_role"
+)
+
+var (
+	slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,31}$`)
+
+	// 与出题接口 language 参数的取值一致
+	supportedLanguages = []string{"go", "java", "python", "javascript", "c++", "css", "html"}
+)
+
+// WorkspaceHandler 工作区（课程/班级）的管理、成员与题目共享
+type WorkspaceHandler struct {
+	db *storage.Database
+}
+
+func NewWorkspaceHandler(db *storage.Database) *WorkspaceHandler {
+	return &WorkspaceHandler{db: db}
+}
+
+// Scope 解析请求所属的工作区并检查权限：
+// 没有成员的工作区对所有人开放；否则 X-User 必须是成员，viewer 只能发起 GET 请求
+func (h *WorkspaceHandler) Scope() gin.HandlerFunc {
+	return h.scope(func(c *gin.Context) bool { return c.Request.Method != http.MethodGet })
+}
+
+// StudentScope 作答与练习接口的工作区检查：只需要查看权限，
+// 开放的工作区对所有人开放，仅限成员的工作区 viewer 也可以作答
+func (h *WorkspaceHandler) StudentScope() gin.HandlerFunc {
+	return h.scope(func(*gin.Context) bool { return false })
+}
+
+// scope write 判断请求是否需要修改题目的权限
+func (h *WorkspaceHandler) scope(write func(*gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ref := c.GetHeader(workspaceHeader)
+		if ref == "" {
+			ref = c.Query("workspace")
+		}
+		ws, ok := h.lookup(c, ref)
+		if !ok {
+			c.Abort()
+			return
+		}
+		role, ok := h.authorize(c, ws, write(c))
+		if !ok {
+			c.Abort()
+			return
+		}
+		c.Set(workspaceKey, ws)
+		c.Set(roleKey, role)
+		c.Next()
+	}
+}
+
+// currentWorkspace 由 Scope 中间件解析的工作区，未经过中间件时返回默认工作区
+func currentWorkspace(c *gin.Context) *storage.Workspace {
+	if v, ok := c.Get(workspaceKey); ok {
+		return v.(*storage.Workspace)
+	}
+	return &storage.Workspace{ID: storage.DefaultWorkspaceID, Slug: "default"}
+}
+
+// callerOf 由 Scope 中间件解析的调用方，与 gRPC 拦截器解析的调用方一起传给服务层
+func callerOf(c *gin.Context) *services.Caller {
+	return &services.Caller{User: c.GetHeader(userHeader), Workspace: currentWorkspace(c), Role: c.GetString(roleKey)}
+}
+
+// lookup 按ID或标识查询工作区，ref 为空时返回默认工作区，失败时已写入响应
+func (h *WorkspaceHandler) lookup(c *gin.Context, ref string) (*storage.Workspace, bool) {
+	ws, err := services.ResolveWorkspace(c, h.db, ref)
+	if err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+	return ws, true
+}
+
+// authorize 检查 X-User 对工作区的访问权限，write 表示需要修改题目的权限，失败时已写入响应
+func (h *WorkspaceHandler) authorize(c *gin.Context, ws *storage.Workspace, write bool) (string, bool) {
+	role, err := services.Authorize(c, h.db, ws, c.GetHeader(userHeader), write)
+	if err != nil {
+		respondError(c, err)
+		return "", false
+	}
+	return role, true
+}
+
+// respondError 按业务错误的类别写入对应的HTTP状态码，其他错误按 500 处理
+func respondError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch services.ErrorKindOf(err) {
+	case services.ErrInvalid:
+		status = http.StatusBadRequest
+	case services.ErrNotFound:
+		status = http.StatusNotFound
+	case services.ErrForbidden:
+		status = http.StatusForbidden
+	case services.ErrQuota:
+		status = http.StatusTooManyRequests
+	case services.ErrUpstream:
+		status = http.StatusBadGateway
+	case services.ErrConflict:
+		status = http.StatusConflict
+	}
+	api.Error(c, status, err.Error())
+}
+
+// requireOwner 修改设置与成员需要 owner 角色（开放的工作区除外），失败时已写入响应
+func (h *WorkspaceHandler) requireOwner(c *gin.Context, ws *storage.Workspace) bool {
+	role, ok := h.authorize(c, ws, true)
+	if !ok {
+		return false
+	}
+	members, err := h.db.WithContext(c).WorkspaceMembers(ws.ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if len(members) > 0 && role != storage.RoleOwner {
+		api.Error(c, http.StatusForbidden, "只有 owner 可以修改工作区设置与成员")
+		return false
+	}
+	return true
+}
+
+// languageAllowed 工作区是否允许该编程语言
+func languageAllowed(ws *storage.Workspace, language string) bool {
+	return services.LanguageAllowed(ws, language)
+}
+
+// checkLanguages 检查题目语言是否在工作区允许的范围内，失败时已写入响应
+func checkLanguages(c *gin.Context, ws *storage.Workspace, languages ...string) bool {
+	if err := services.CheckLanguages(ws, languages...); err != nil {
+		respondError(c, err)
+		return false
+	}
+	return true
+}
+
+// checkQuestionQuota 检查新增 n 道题后是否超过工作区题目数上限，失败时已写入响应
+func checkQuestionQuota(c *gin.Context, db *storage.Database, ws *storage.Workspace, n int) bool {
+	if err := services.CheckQuestionQuota(c, db, ws, n); err != nil {
+		respondError(c, err)
+		return false
+	}
+	return true
+}
+
+// consumeAIQuota 占用工作区今天的 n 次AI出题调用，超过上限时已写入响应
+func consumeAIQuota(c *gin.Context, db *storage.Database, ws *storage.Workspace, n int) bool {
+	if err := services.ConsumeAIQuota(c, db, ws, n); err != nil {
+		respondError(c, err)
+		return false
+	}
+	return true
+}
+
+// workspaceModel 未指定AI服务时使用工作区的默认服务
+func workspaceModel(c *gin.Context, model string) string {
+	return services.WorkspaceModel(currentWorkspace(c), model)
+}
+
+// 工作区创建/修改参数
+type workspaceRequest struct {
+	Slug     string                     `json:"slug"`
+	Name     string                     `json:"name"`
+	Settings *storage.WorkspaceSettings `json:"settings"`
+}
+
+// validateSettings 校验工作区设置
+func validateSettings(s *storage.WorkspaceSettings) error {
+	for i, lang := range s.AllowedLanguages {
+		s.AllowedLanguages[i] = strings.ToLower(strings.TrimSpace(lang))
+		if !slices.Contains(supportedLanguages, s.AllowedLanguages[i]) {
+			return fmt.Errorf("不支持的编程语言: %s（可选 %s）", lang, strings.Join(supportedLanguages, "、"))
+		}
+	}
+	if s.AllowedLanguages == nil {
+		s.AllowedLanguages = []string{}
+	}
+	switch s.DefaultModel {
+	case "", "deepseek", "tongyi":
+	default:
+		return fmt.Errorf("default_model 只能是 deepseek 或 tongyi")
+	}
+	if s.MaxQuestions < 0 || s.DailyAIRequests < 0 {
+		return fmt.Errorf("max_questions 与 daily_ai_requests 不能为负数（0 表示不限）")
+	}
+	return nil
+}
+
+// Create 创建工作区，X-User 成为 owner
+func (h *WorkspaceHandler) Create(c *gin.Context) {
+	// 1. 参数校验
+	owner := c.GetHeader(userHeader)
+	if owner == "" {
+		api.Error(c, http.StatusBadRequest, "请通过 "+userHeader+" 指定创建者")
+		return
+	}
+	var req workspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if !slugPattern.MatchString(req.Slug) {
+		api.Error(c, http.StatusBadRequest, "slug 只能包含小写字母、数字与 -，长度2-32")
+		return
+	}
+	if _, err := strconv.Atoi(req.Slug); err == nil {
+		api.Error(c, http.StatusBadRequest, "slug 不能是纯数字")
+		return
+	}
+	if req.Name == "" {
+		req.Name = req.Slug
+	}
+	ws := &storage.Workspace{Slug: req.Slug, Name: req.Name}
+	if req.Settings != nil {
+		ws.Settings = *req.Settings
+	}
+	if err := validateSettings(&ws.Settings); err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 2. 标识不能重复
+	db := h.db.WithContext(c)
+	existing, err := db.GetWorkspaceBySlug(req.Slug)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if existing != nil {
+		api.Error(c, http.StatusConflict, "工作区已存在: "+req.Slug)
+		return
+	}
+
+	// 3. 创建
+	if err := db.CreateWorkspace(ws, owner); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, ws)
+}
+
+// List 所有工作区及 X-User 在其中的角色
+func (h *WorkspaceHandler) List(c *gin.Context) {
+	db := h.db.WithContext(c)
+	list, err := db.ListWorkspaces()
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	user := c.GetHeader(userHeader)
+	type item struct {
+		storage.Workspace
+		Role string `json:"role,omitempty"`
+		Open bool   `json:"open"`
+	}
+	items := make([]item, 0, len(list))
+	for _, ws := range list {
+		role, open, err := db.MemberRole(ws.ID, user)
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		items = append(items, item{Workspace: ws, Role: role, Open: open})
+	}
+	api.Success(c, items)
+}
+
+// Get 工作区详情：设置、成员与用量
+func (h *WorkspaceHandler) Get(c *gin.Context) {
+	ws, ok := h.lookup(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if _, ok := h.authorize(c, ws, false); !ok {
+		return
+	}
+	db := h.db.WithContext(c)
+	members, err := db.WorkspaceMembers(ws.ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	usage, err := db.GetWorkspaceUsage(ws.ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{
+		"workspace": ws,
+		"members":   members,
+		"usage":     usage,
+	})
+}
+
+// Update 修改名称与设置，settings 整体替换
+func (h *WorkspaceHandler) Update(c *gin.Context) {
+	ws, ok := h.lookup(c, c.Param("id"))
+	if !ok || !h.requireOwner(c, ws) {
+		return
+	}
+	var req workspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if req.Slug != "" && req.Slug != ws.Slug {
+		api.Error(c, http.StatusBadRequest, "slug 创建后不能修改")
+		return
+	}
+	if req.Name != "" {
+		ws.Name = req.Name
+	}
+	if req.Settings != nil {
+		if err := validateSettings(req.Settings); err != nil {
+			api.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		ws.Settings = *req.Settings
+	}
+	if err := h.db.WithContext(c).UpdateWorkspace(ws); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, ws)
+}
+
+// 成员添加/修改参数
+type memberRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+	Role   string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+// SetMember 添加成员或修改角色；开放的工作区第一个成员必须是 owner
+func (h *WorkspaceHandler) SetMember(c *gin.Context) {
+	ws, ok := h.lookup(c, c.Param("id"))
+	if !ok || !h.requireOwner(c, ws) {
+		return
+	}
+	var req memberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	db := h.db.WithContext(c)
+	current, open, err := db.MemberRole(ws.ID, req.UserID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if open && req.Role != storage.RoleOwner {
+		api.Error(c, http.StatusBadRequest, "工作区的第一个成员必须是 owner")
+		return
+	}
+	if current == storage.RoleOwner && req.Role != storage.RoleOwner {
+		if !h.keepsOwner(c, ws) {
+			return
+		}
+	}
+	if err := db.SetMember(ws.ID, req.UserID, req.Role); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{"workspace_id": ws.ID, "user_id": req.UserID, "role": req.Role})
+}
+
+// RemoveMember 移除成员，不能移除最后一个 owner
+func (h *WorkspaceHandler) RemoveMember(c *gin.Context) {
+	ws, ok := h.lookup(c, c.Param("id"))
+	if !ok || !h.requireOwner(c, ws) {
+		return
+	}
+	user := c.Param("user")
+	db := h.db.WithContext(c)
+	role, _, err := db.MemberRole(ws.ID, user)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if role == "" {
+		api.Error(c, http.StatusNotFound, "成员不存在: "+user)
+		return
+	}
+	if role == storage.RoleOwner && !h.keepsOwner(c, ws) {
+		return
+	}
+	if _, err := db.RemoveMember(ws.ID, user); err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{"workspace_id": ws.ID, "removed": user})
+}
+
+// keepsOwner 撤销一个 owner 后工作区是否仍有 owner，失败时已写入响应
+func (h *WorkspaceHandler) keepsOwner(c *gin.Context, ws *storage.Workspace) bool {
+	n, err := h.db.WithContext(c).CountOwners(ws.ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if n <= 1 {
+		api.Error(c, http.StatusBadRequest, "不能移除工作区的最后一个 owner")
+		return false
+	}
+	return true
+}
+
+// 共享/复制参数
+type shareRequest struct {
+	IDs       []int  `json:"ids" binding:"required,min=1"`
+	Workspace string `json:"workspace"` // 共享：目标工作区
+	From      string `json:"from"`      // 复制：来源工作区
+}
+
+// Share 将当前工作区的题目共享给目标工作区（只读），DELETE 取消共享
+func (h *WorkspaceHandler) Share(c *gin.Context) {
+	var req shareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	source := currentWorkspace(c)
+	target, ok := h.lookup(c, req.Workspace)
+	if !ok {
+		return
+	}
+	if target.ID == source.ID {
+		api.Error(c, http.StatusBadRequest, "不能共享给当前工作区")
+		return
+	}
+
+	db := h.db.WithContext(c)
+	if c.Request.Method == http.MethodDelete {
+		n, err := db.UnshareQuestions(source.ID, target.ID, req.IDs)
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		api.Success(c, gin.H{"workspace": target.Slug, "unshared": n})
+		return
+	}
+	shared, err := db.ShareQuestions(source.ID, target.ID, req.IDs)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{"workspace": target.Slug, "shared_ids": shared})
+}
+
+// Copy 将来源工作区可见的题目复制到当前工作区，需要来源工作区的查看权限
+func (h *WorkspaceHandler) Copy(c *gin.Context) {
+	// 1. 参数与权限
+	var req shareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	if req.From == "" {
+		api.Error(c, http.StatusBadRequest, "请通过 from 指定来源工作区")
+		return
+	}
+	target := currentWorkspace(c)
+	source, ok := h.lookup(c, req.From)
+	if !ok {
+		return
+	}
+	if source.ID == target.ID {
+		api.Error(c, http.StatusBadRequest, "来源与当前工作区相同")
+		return
+	}
+	if _, ok := h.authorize(c, source, false); !ok {
+		return
+	}
+	if !checkQuestionQuota(c, h.db, target, len(req.IDs)) {
+		return
+	}
+
+	// 2. 复制
+	copied, err := h.db.WithContext(c).CopyQuestions(source.ID, target.ID, req.IDs)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	api.Success(c, gin.H{"from": source.Slug, "copied_ids": copied})
+}
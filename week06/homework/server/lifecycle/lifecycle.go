@@ -0,0 +1,212 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"Server/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 取消根上下文后，继续等待请求与后台任务收尾（写日志、回滚事务）的最长时间
+const cancelGrace = 5 * time.Second
+
+// Manager 管理服务的启动与优雅退出。
+//
+// 收到 SIGINT/SIGTERM 后：
+//  1. 停止接收新连接，等待进行中的请求结束（最长 drain），gRPC 等其他服务同时收尾
+//  2. 超时仍未结束时取消根上下文，进行中的AI调用、上传等随之中断
+//  3. 等待请求与后台任务收尾（最长 cancelGrace）
+//  4. 按注册的逆序执行清理函数：刷新日志、导出span、关闭数据库等
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	drain  time.Duration
+
+	mu       sync.Mutex
+	closing  bool
+	closed   chan struct{}  // 开始退出时关闭，通知SSE等长连接结束
+	requests sync.WaitGroup // 进行中的HTTP请求
+	tasks    sync.WaitGroup // 后台任务（worker pool 等）
+	hooks    []hook
+	drains   []hook
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// New 创建生命周期管理器，drain 为退出时等待进行中请求的最长时间
+func New(drain time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel, drain: drain, closed: make(chan struct{})}
+}
+
+// Context 根上下文，服务退出时取消；所有请求与后台任务都派生自它
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Closing 开始退出时关闭。SSE等长连接不会自行结束，应在此时返回，否则会拖满 drain 时间
+func (m *Manager) Closing() <-chan struct{} {
+	return m.closed
+}
+
+// Go 启动一个后台任务，退出时会等待其结束；服务正在退出时不再启动并返回 false。
+// 任务应在 ctx 取消后尽快返回，新增的 worker pool 等都应通过它启动
+func (m *Manager) Go(name string, fn func(ctx context.Context)) bool {
+	if !m.enter(&m.tasks) {
+		log.Printf("[LIFECYCLE] 服务正在退出，后台任务 %s 未启动", name)
+		return false
+	}
+	go func() {
+		defer m.tasks.Done()
+		fn(m.ctx)
+	}()
+	return true
+}
+
+// OnShutdown 注册退出时执行的清理函数，按注册的逆序执行（先注册的资源最后关闭）
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// OnDrain 注册与HTTP服务同时停止的其他服务（如gRPC）：停止接收新调用并等待进行中的调用，
+// ctx 在 drain 超时后取消，此时应强制结束剩余调用
+func (m *Manager) OnDrain(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.drains = append(m.drains, hook{name: name, fn: fn})
+}
+
+// Middleware 记录进行中的请求；服务退出期间到达的请求直接返回503
+func (m *Manager) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.enter(&m.requests) {
+			c.Header("Connection", "close")
+			api.Error(c, http.StatusServiceUnavailable, "服务正在关闭，请稍后重试")
+			c.Abort()
+			return
+		}
+		defer m.requests.Done()
+		c.Next()
+	}
+}
+
+// enter 在未开始退出时登记一个请求或任务
+func (m *Manager) enter(wg *sync.WaitGroup) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		return false
+	}
+	wg.Add(1)
+	return true
+}
+
+// Serve 启动HTTP服务并阻塞，直到收到退出信号或服务异常退出，返回前完成优雅退出
+func (m *Manager) Serve(srv *http.Server) error {
+	srv.BaseContext = func(net.Listener) context.Context { return m.ctx }
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var serveErr error
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr = err
+		}
+	case sig := <-signals:
+		log.Printf("[LIFECYCLE] 收到信号 %s，开始优雅退出（最长等待 %s）", sig, m.drain)
+	}
+
+	m.shutdown(srv)
+	return serveErr
+}
+
+func (m *Manager) shutdown(srv *http.Server) {
+	m.mu.Lock()
+	m.closing = true
+	close(m.closed)
+	m.mu.Unlock()
+
+	// 1. 停止接收新连接，等待进行中的请求
+	drainCtx, cancel := context.WithTimeout(context.Background(), m.drain)
+	defer cancel()
+	m.mu.Lock()
+	drains := m.drains
+	m.mu.Unlock()
+	var drained sync.WaitGroup
+	for _, d := range drains {
+		drained.Add(1)
+		go func() {
+			defer drained.Done()
+			if err := d.fn(drainCtx); err != nil {
+				log.Printf("[LIFECYCLE] %s 未能等待进行中的调用结束: %v", d.name, err)
+			}
+		}()
+	}
+	if err := srv.Shutdown(drainCtx); err != nil {
+		log.Printf("[LIFECYCLE] 等待进行中的请求超时，取消剩余请求: %v", err)
+	}
+	drained.Wait()
+
+	// 2. 取消根上下文，中断仍在进行的AI调用与后台任务
+	m.cancel()
+
+	// 3. 等待请求与后台任务收尾
+	if !waitTimeout(&m.requests, cancelGrace) {
+		log.Printf("[LIFECYCLE] 仍有请求未结束，强制关闭连接")
+	}
+	_ = srv.Close()
+	if !waitTimeout(&m.tasks, cancelGrace) {
+		log.Printf("[LIFECYCLE] 仍有后台任务未结束")
+	}
+
+	// 4. 逆序执行清理函数
+	m.mu.Lock()
+	hooks := m.hooks
+	m.mu.Unlock()
+	hookCtx, hookCancel := context.WithTimeout(context.Background(), m.drain)
+	defer hookCancel()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].fn(hookCtx); err != nil {
+			log.Printf("[LIFECYCLE] %s 失败: %v", hooks[i].name, err)
+		}
+	}
+	log.Printf("[LIFECYCLE] 服务已退出")
+}
+
+// waitTimeout 等待 wg 归零，超时返回 false
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,468 @@
+// Package ltimock 模拟的 LTI 1.3 平台（LMS），供 cmd/ltimock 本地联调与 LTI 接入的测试共用。
+//
+// 它实现了平台一侧的 OIDC 授权、id_token 签发、JWKS、OAuth2 令牌（校验工具的 client_assertion）、
+// Deep Linking 返回与 AGS 成绩接收。测试可以直接用 LaunchClaims 与 IDToken 构造启动消息
+package ltimock
+
+import (
+	"Server/services"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// KID 平台签名密钥的 kid
+	KID       = "ltimock-1"
+	scoreType = "application/vnd.ims.lis.v1.score+json"
+)
+
+// Link 课程中放置的资源链接（Deep Linking 返回的内容）
+type Link struct {
+	ID       int               `json:"id"`
+	Title    string            `json:"title"`
+	URL      string            `json:"url"`
+	Custom   map[string]string `json:"custom"`
+	LineItem string            `json:"lineitem,omitempty"`
+	MaxScore float64           `json:"score_maximum,omitempty"`
+}
+
+// Score 收到的成绩
+type Score struct {
+	LineItem         string  `json:"lineitem"`
+	UserID           string  `json:"userId"`
+	ScoreGiven       float64 `json:"scoreGiven"`
+	ScoreMaximum     float64 `json:"scoreMaximum"`
+	ActivityProgress string  `json:"activityProgress"`
+	GradingProgress  string  `json:"gradingProgress"`
+	Timestamp        string  `json:"timestamp"`
+}
+
+// Config 平台参数
+type Config struct {
+	Base       string // 平台地址，同时作为 iss
+	Tool       string // 工具地址（lti.base_url）
+	ClientID   string // 分配给工具的 client_id
+	Deployment string // 部署ID
+	FailScores int    // 前 N 次成绩请求返回 503，用于测试重试
+}
+
+// Platform 模拟的平台，Handler 提供平台的全部接口
+type Platform struct {
+	base       string
+	tool       string
+	clientID   string
+	deployment string
+	key        *rsa.PrivateKey
+	client     *http.Client
+
+	mu         sync.Mutex
+	links      []Link
+	scores     []Score
+	tokens     map[string]time.Time // access_token -> 过期时间
+	failScores int
+}
+
+// New 生成平台签名密钥并创建平台
+func New(cfg Config) (*Platform, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &Platform{
+		base:       strings.TrimRight(cfg.Base, "/"),
+		tool:       strings.TrimRight(cfg.Tool, "/"),
+		clientID:   cfg.ClientID,
+		deployment: cfg.Deployment,
+		key:        key,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		tokens:     make(map[string]time.Time),
+		failScores: cfg.FailScores,
+	}, nil
+}
+
+// Handler 平台的页面与接口
+func (p *Platform) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", p.index)
+	mux.HandleFunc("GET /start", p.start)
+	mux.HandleFunc("GET /auth", p.auth)
+	mux.HandleFunc("POST /auth", p.auth)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("POST /lineitems/{id}/scores", p.receiveScore)
+	mux.HandleFunc("POST /deep-link/return", p.deepLinkReturn)
+	mux.HandleFunc("GET /links", func(w http.ResponseWriter, r *http.Request) { p.writeJSON(w, p.Links()) })
+	mux.HandleFunc("GET /scores", func(w http.ResponseWriter, r *http.Request) { p.writeJSON(w, p.Scores()) })
+	return mux
+}
+
+// Register 调用题库服务的管理接口登记本平台，offline 为 true 时直接提供平台公钥（JWKS）
+func (p *Platform) Register(token, workspace string, offline bool) error {
+	body := map[string]interface{}{
+		"workspace":      workspace,
+		"name":           "模拟平台",
+		"issuer":         p.base,
+		"client_id":      p.clientID,
+		"deployment_ids": []string{p.deployment},
+		"auth_login_url": p.base + "/auth",
+		"auth_token_url": p.base + "/token",
+	}
+	if offline {
+		jwks, _ := json.Marshal(p.JWKS())
+		body["jwks"] = string(jwks)
+	} else {
+		body["jwks_url"] = p.base + "/jwks"
+	}
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, p.tool+"/api/admin/lti/platforms", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-Token", token)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, respBody)
+	}
+	log.Printf("已在 %s 登记平台", p.tool)
+	return nil
+}
+
+var indexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>模拟 LTI 平台</title>
+<style>body{max-width:760px;margin:2em auto;font-family:sans-serif}li{margin:.4em 0}</style></head><body>
+<h2>模拟课程</h2>
+<p><a href="/start?user=teacher&role=Instructor&message=deep-link">以教师身份添加内容（Deep Linking）</a></p>
+<h3>课程内容</h3>
+{{if .}}<ul>{{range .}}<li>{{.Title}}：
+<a href="/start?user=student1&role=Learner&link={{.ID}}">student1</a>
+<a href="/start?user=student2&role=Learner&link={{.ID}}">student2</a>
+{{if .LineItem}}（成绩项 {{.LineItem}}）{{end}}</li>{{end}}</ul>
+{{else}}<p>还没有内容，请先以教师身份添加。</p>{{end}}
+<p><a href="/scores">收到的成绩</a></p></body></html>`))
+
+func (p *Platform) index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = indexPage.Execute(w, p.Links())
+}
+
+// start 平台发起第三方登录：浏览器跳转到工具的登录地址
+// 参数 user、role（Learner/Instructor）、link（资源链接ID）或 message=deep-link
+func (p *Platform) start(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	user, role := q.Get("user"), q.Get("role")
+	if user == "" {
+		user = "student1"
+	}
+	if role == "" {
+		role = "Learner"
+	}
+	hint := "deep-link"
+	if q.Get("message") != "deep-link" {
+		hint = "link:" + q.Get("link")
+	}
+	login := url.Values{
+		"iss":               {p.base},
+		"login_hint":        {user + "|" + role},
+		"target_link_uri":   {p.tool + "/api/lti/launch"},
+		"lti_message_hint":  {hint},
+		"client_id":         {p.clientID},
+		"lti_deployment_id": {p.deployment},
+	}
+	http.Redirect(w, r, p.tool+"/api/lti/login?"+login.Encode(), http.StatusFound)
+}
+
+var autoPost = template.Must(template.New("post").Parse(`<!DOCTYPE html><html><body>
+<form id="f" method="post" action="{{.Action}}">{{range $k, $v := .Fields}}<input type="hidden" name="{{$k}}" value="{{$v}}">{{end}}</form>
+<script>document.getElementById("f").submit()</script></body></html>`))
+
+// auth OIDC 授权：校验工具的授权请求，签发 id_token 并以表单 POST 到 redirect_uri
+func (p *Platform) auth(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	q := r.Form
+	if q.Get("client_id") != p.clientID || q.Get("response_type") != "id_token" || q.Get("scope") != "openid" ||
+		q.Get("response_mode") != "form_post" || q.Get("redirect_uri") != p.tool+"/api/lti/launch" || q.Get("nonce") == "" {
+		http.Error(w, "授权请求参数错误", http.StatusBadRequest)
+		return
+	}
+	user, role, _ := strings.Cut(q.Get("login_hint"), "|")
+	claims, err := p.LaunchClaims(user, role, q.Get("nonce"), q.Get("lti_message_hint"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	idToken, err := p.IDToken(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = autoPost.Execute(w, map[string]interface{}{
+		"Action": q.Get("redirect_uri"),
+		"Fields": map[string]string{"id_token": idToken, "state": q.Get("state")},
+	})
+}
+
+// LaunchClaims 平台为用户签发的启动消息声明，role 为 Learner/Instructor 等，
+// hint 为 deep-link（Deep Linking 请求）或 link:<资源链接ID>（打开课程中的链接）
+func (p *Platform) LaunchClaims(user, role, nonce, hint string) (jwt.MapClaims, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   p.base,
+		"aud":   p.clientID,
+		"azp":   p.clientID,
+		"sub":   user,
+		"name":  user,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+		"https://purl.imsglobal.org/spec/lti/claim/version":       "1.3.0",
+		"https://purl.imsglobal.org/spec/lti/claim/deployment_id": p.deployment,
+		"https://purl.imsglobal.org/spec/lti/claim/roles":         []string{"http://purl.imsglobal.org/vocab/lis/v2/membership#" + role},
+		"https://purl.imsglobal.org/spec/lti/claim/context":       map[string]string{"id": "course-1", "title": "模拟课程"},
+	}
+
+	if hint == "deep-link" {
+		claims["https://purl.imsglobal.org/spec/lti/claim/message_type"] = services.LTIDeepLinkingRequest
+		claims["https://purl.imsglobal.org/spec/lti/claim/target_link_uri"] = p.tool + "/api/lti/launch"
+		claims["https://purl.imsglobal.org/spec/lti-dl/claim/deep_linking_settings"] = map[string]interface{}{
+			"deep_link_return_url":                 p.base + "/deep-link/return",
+			"accept_types":                         []string{"ltiResourceLink"},
+			"accept_presentation_document_targets": []string{"iframe", "window"},
+			"data":                                 "mock-data-" + hex.EncodeToString(randomBytes(4)),
+		}
+		return claims, nil
+	}
+
+	id, _ := strconv.Atoi(strings.TrimPrefix(hint, "link:"))
+	l, ok := p.link(id)
+	if !ok {
+		return nil, errors.New("资源链接不存在")
+	}
+	claims["https://purl.imsglobal.org/spec/lti/claim/message_type"] = services.LTIResourceLinkRequest
+	claims["https://purl.imsglobal.org/spec/lti/claim/target_link_uri"] = l.URL
+	claims["https://purl.imsglobal.org/spec/lti/claim/resource_link"] = map[string]string{"id": strconv.Itoa(l.ID), "title": l.Title}
+	claims["https://purl.imsglobal.org/spec/lti/claim/custom"] = l.Custom
+	if l.LineItem != "" {
+		claims["https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"] = map[string]interface{}{
+			"scope":    []string{services.LTIScopeScore},
+			"lineitem": l.LineItem,
+		}
+	}
+	return claims, nil
+}
+
+// IDToken 用平台密钥签名启动消息
+func (p *Platform) IDToken(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KID
+	return token.SignedString(p.key)
+}
+
+// JWKS 平台公钥
+func (p *Platform) JWKS() map[string][]services.JWK {
+	return map[string][]services.JWK{"keys": {services.PublicJWK(KID, &p.key.PublicKey)}}
+}
+
+func (p *Platform) jwks(w http.ResponseWriter, r *http.Request) {
+	p.writeJSON(w, p.JWKS())
+}
+
+// verifyTool 用工具的 JWKS 校验工具签发的 JWT
+func (p *Platform) verifyTool(ctx context.Context, raw string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, p.tool+"/api/lti/jwks", nil)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	keys, err := services.ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, jwt.WithValidMethods([]string{"RS256"}), jwt.WithExpirationRequired())
+	_, err = jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		k, _ := t.Header["kid"].(string)
+		if key, ok := keys[k]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("工具公钥中没有 kid=%q", k)
+	}, opts...)
+	return err
+}
+
+// token OAuth2 client_credentials：校验工具签名的 client_assertion 后签发访问令牌
+func (p *Platform) token(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	if r.Form.Get("grant_type") != "client_credentials" ||
+		r.Form.Get("client_assertion_type") != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+		p.oauthError(w, "unsupported_grant_type")
+		return
+	}
+	var claims jwt.RegisteredClaims
+	err := p.verifyTool(r.Context(), r.Form.Get("client_assertion"), &claims,
+		jwt.WithIssuer(p.clientID), jwt.WithSubject(p.clientID), jwt.WithAudience(p.base+"/token"))
+	if err != nil {
+		log.Printf("[TOKEN] client_assertion 校验失败: %v", err)
+		p.oauthError(w, "invalid_client")
+		return
+	}
+	if !slices.Contains(strings.Fields(r.Form.Get("scope")), services.LTIScopeScore) {
+		p.oauthError(w, "invalid_scope")
+		return
+	}
+	value := hex.EncodeToString(randomBytes(16))
+	p.mu.Lock()
+	p.tokens[value] = time.Now().Add(time.Hour)
+	p.mu.Unlock()
+	p.writeJSON(w, map[string]interface{}{
+		"access_token": value,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"scope":        services.LTIScopeScore,
+	})
+}
+
+func (p *Platform) oauthError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// receiveScore AGS 成绩接收
+func (p *Platform) receiveScore(w http.ResponseWriter, r *http.Request) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	p.mu.Lock()
+	expires, ok := p.tokens[token]
+	fail := p.failScores > 0
+	if fail {
+		p.failScores--
+	}
+	p.mu.Unlock()
+	if !ok || time.Now().After(expires) {
+		http.Error(w, "访问令牌无效", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Type") != scoreType {
+		http.Error(w, "Content-Type 必须是 "+scoreType, http.StatusUnsupportedMediaType)
+		return
+	}
+	if fail {
+		log.Printf("[SCORE] 模拟故障，返回 503")
+		http.Error(w, "模拟故障", http.StatusServiceUnavailable)
+		return
+	}
+
+	var s Score
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil || s.UserID == "" {
+		http.Error(w, "成绩格式错误", http.StatusBadRequest)
+		return
+	}
+	s.LineItem = p.base + "/lineitems/" + r.PathValue("id")
+	p.mu.Lock()
+	p.scores = append(p.scores, s)
+	p.mu.Unlock()
+	log.Printf("[SCORE] %s 用户 %s 得分 %g/%g（%s，%s）", s.LineItem, s.UserID, s.ScoreGiven, s.ScoreMaximum, s.ActivityProgress, s.GradingProgress)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deepLinkReturn 接收工具返回的 LtiDeepLinkingResponse，把内容放入课程并为其创建成绩项
+func (p *Platform) deepLinkReturn(w http.ResponseWriter, r *http.Request) {
+	var claims struct {
+		jwt.RegisteredClaims
+		MessageType  string `json:"https://purl.imsglobal.org/spec/lti/claim/message_type"`
+		DeploymentID string `json:"https://purl.imsglobal.org/spec/lti/claim/deployment_id"`
+		Items        []struct {
+			Type     string            `json:"type"`
+			Title    string            `json:"title"`
+			URL      string            `json:"url"`
+			Custom   map[string]string `json:"custom"`
+			LineItem *struct {
+				ScoreMaximum float64 `json:"scoreMaximum"`
+			} `json:"lineItem"`
+		} `json:"https://purl.imsglobal.org/spec/lti-dl/claim/content_items"`
+	}
+	err := p.verifyTool(r.Context(), r.FormValue("JWT"), &claims, jwt.WithIssuer(p.clientID), jwt.WithAudience(p.base))
+	if err == nil && claims.MessageType != "LtiDeepLinkingResponse" {
+		err = errors.New("消息类型错误: " + claims.MessageType)
+	}
+	if err == nil && claims.DeploymentID != p.deployment {
+		err = errors.New("部署ID错误: " + claims.DeploymentID)
+	}
+	if err != nil {
+		http.Error(w, "Deep Linking 响应校验失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	for _, item := range claims.Items {
+		if item.Type != "ltiResourceLink" {
+			continue
+		}
+		l := Link{ID: len(p.links) + 1, Title: item.Title, URL: item.URL, Custom: item.Custom}
+		if item.LineItem != nil {
+			l.LineItem = fmt.Sprintf("%s/lineitems/%d", p.base, l.ID)
+			l.MaxScore = item.LineItem.ScoreMaximum
+		}
+		p.links = append(p.links, l)
+		log.Printf("[DEEP LINK] 添加内容 #%d %s（%v）", l.ID, l.Title, l.Custom)
+	}
+	p.mu.Unlock()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (p *Platform) link(id int) (Link, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, l := range p.links {
+		if l.ID == id {
+			return l, true
+		}
+	}
+	return Link{}, false
+}
+
+// Links 课程中已放置的资源链接
+func (p *Platform) Links() []Link {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Link{}, p.links...)
+}
+
+// Scores 收到的成绩
+func (p *Platform) Scores() []Score {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Score{}, p.scores...)
+}
+
+func (p *Platform) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomBytes(n int) []byte {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return buf
+}
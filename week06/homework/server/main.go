@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -9,36 +13,161 @@ import (
 
 	"Server/config"
 	"Server/controllers"
+	"Server/lifecycle"
+	"Server/rpc"
 	"Server/services"
 	"Server/storage"
+	"Server/telemetry"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	configFile := flag.String("config", "", "配置文件路径（YAML/TOML），默认读取 CONFIG_FILE 或当前目录下的 config.yaml")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "用法: %s [-config 文件] [命令]\n\n不带命令时启动服务。\n\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(flag.CommandLine.Output(), "\n"+commandUsage)
+	}
+	flag.Parse()
+
 	// 加载配置
-	cfg, err := config.LoadConfig()
+	cfg, err := config.LoadConfig(*configFile)
 	if err != nil {
 		log.Fatal("配置加载失败:", err)
 	}
+	if cfg.File != "" {
+		log.Printf("已加载配置文件: %s", cfg.File)
+	}
+
+	// 带命令时执行备份等管理命令后退出
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(cfg, flag.Args()))
+	}
 
-	// 初始化服务
-	aiService := services.NewAIService(cfg)
-	jsonStorage := storage.NewJSONStorage()
+	// 服务生命周期：退出时等待进行中的请求，再逆序执行下面注册的清理函数
+	app := lifecycle.New(cfg.ShutdownTimeout)
+
+	// 初始化链路追踪（退出前导出剩余span）
+	shutdownTracing, err := telemetry.SetupTracing(cfg.Telemetry)
+	if err != nil {
+		log.Fatal("链路追踪初始化失败: ", err)
+	}
+	app.OnShutdown("导出剩余span", shutdownTracing)
 
 	// 初始化数据库
-	db, err := storage.InitDB("question_service.db")
+	db, err := storage.InitDB(cfg.Storage.DBPath)
 	if err != nil {
 		log.Fatal("数据库初始化失败: ", err)
 	}
-	defer db.Close()
+	app.OnShutdown("关闭数据库", func(context.Context) error { return db.Close() })
+
+	// 初始化服务（按配置缓存相同请求的出题结果）
+	aiService := services.NewAIService(cfg, services.NewResponseCache(cfg.Cache, db))
+	jsonStorage := storage.NewJSONStorage(cfg.Storage.LogDir)
+	app.OnShutdown("关闭AI日志", func(context.Context) error { return jsonStorage.Close() })
+
+	// 配置文件修改或收到SIGHUP时热更新AI服务配置
+	watcher := config.NewWatcher(cfg, aiService.Reload)
+	watcher.Start()
+	app.OnShutdown("停止配置监听", func(context.Context) error {
+		watcher.Stop()
+		return nil
+	})
+
+	// 根据历史作答记录初始化自适应练习所需的学习状态
+	if replayed, err := db.RebuildLearningState(); err != nil {
+		log.Printf("学习状态重建失败: %v", err)
+	} else if replayed > 0 {
+		log.Printf("已根据 %d 条历史作答记录重建学习状态", replayed)
+	}
+
+	// 上次退出时仍在执行的批量出题与补写解析任务不会继续，标记为中断
+	if interrupted, err := db.MarkInterruptedBulkJobs(); err != nil {
+		log.Printf("批量出题任务状态更新失败: %v", err)
+	} else if interrupted > 0 {
+		log.Printf("已将 %d 个未完成的批量出题任务标记为中断", interrupted)
+	}
+	if interrupted, err := db.MarkInterruptedBackfillJobs(); err != nil {
+		log.Printf("补写解析任务状态更新失败: %v", err)
+	} else if interrupted > 0 {
+		log.Printf("已将 %d 个未完成的补写解析任务标记为中断", interrupted)
+	}
+
+	// 课堂测验的房间只保存在内存中，上次退出时未结束的测验无法继续
+	if interrupted, err := db.MarkInterruptedQuizSessions(); err != nil {
+		log.Printf("课堂测验状态更新失败: %v", err)
+	} else if interrupted > 0 {
+		log.Printf("已将 %d 个未结束的课堂测验标记为中断", interrupted)
+	}
+
+	// 题目向量索引：题目变更后增量计算向量，用于相关题目推荐与覆盖分析
+	embeddingIndex := services.NewEmbeddingIndex(db, cfg.Embedding)
+
+	// 题库事件分发：写入事件后唤醒，推送给SSE订阅者并投递Webhook
+	eventBus := services.NewEventBus(db, cfg.Events)
+	db.OnEvent(func() {
+		eventBus.Notify()
+		embeddingIndex.Notify()
+	})
+	app.Go("事件分发", eventBus.Run)
+	app.Go("题目向量索引", embeddingIndex.Run)
+
+	// 题目图片附件：按日期与ID前缀分目录存储，定时清理未被引用的附件
+	attachmentManager := services.NewAttachmentManager(db, storage.NewFileStore(cfg.Storage.AttachmentDir))
+	app.Go("附件清理", attachmentManager.Run)
+
+	// 课堂实时测验：推送倒计时，到时公布答案
+	quizHub := services.NewQuizHub(db)
+	app.Go("课堂测验", quizHub.Run)
+
+	// 定时备份数据库并按 backup.keep 轮转
+	backupManager := services.NewBackupManager(db, jsonStorage, attachmentManager.Files(), cfg.Backup)
+	app.Go("定时备份", backupManager.Run)
+
+	// LTI 1.3 工具：学生从课程平台单点登录答题，成绩通过 AGS 回传
+	ltiService, err := services.NewLTIService(db, cfg.LTI, cfg.Events)
+	if err != nil {
+		log.Fatal("LTI 初始化失败: ", err)
+	}
+	app.Go("LTI 成绩回传", ltiService.Run)
+
+	// 题目服务（HTTP 与 gRPC 共用）
+	questionService := services.NewQuestionService(db, aiService, jsonStorage, attachmentManager)
+
+	// 题库清理：按工作区的策略定时归档久未使用的题目、删除被驳回的草稿
+	retentionManager := services.NewRetentionManager(db, questionService, cfg.Retention)
+	app.Go("题库清理", retentionManager.Run)
 
 	// 创建控制器
-	ctrl := controllers.NewController(aiService, jsonStorage, db)
-	statsHandler := controllers.NewStatsHandler(db)
+	ctrl := controllers.NewController(aiService, jsonStorage, db, questionService)
+	statsHandler := controllers.NewStatsHandler(db, attachmentManager, questionService)
+	analyticsHandler := controllers.NewAnalyticsHandler(db, jsonStorage, cfg.AnalyticsCacheTTL)
+	answerHandler := controllers.NewAnswerHandler(db)
+	submissionHandler := controllers.NewSubmissionHandler(db)
+	relatedHandler := controllers.NewRelatedHandler(db, embeddingIndex)
+	retentionHandler := controllers.NewRetentionHandler(db, retentionManager)
+	feedbackHandler := controllers.NewFeedbackHandler(db, services.NewFeedbackService(db, cfg.Feedback))
+	practiceHandler := controllers.NewPracticeHandler(db)
+	renderHandler := controllers.NewRenderHandler(db)
+	bulkHandler := controllers.NewBulkHandler(aiService, jsonStorage, db, app)
+	backfillHandler := controllers.NewBackfillHandler(aiService, db, app)
+	examHandler := controllers.NewExamHandler(db, services.NewExamRenderer(cfg.Exam), attachmentManager)
+	eventHandler := controllers.NewEventHandler(db, eventBus, app)
+	workspaceHandler := controllers.NewWorkspaceHandler(db)
+	backupHandler := controllers.NewBackupHandler(backupManager, cfg.Backup.AdminToken)
+	attachmentHandler := controllers.NewAttachmentHandler(db, attachmentManager)
+	quizHandler := controllers.NewQuizHandler(db, quizHub, app, cfg.Server.CORSOrigin)
+	templateHandler := controllers.NewTemplateHandler(db)
+	ltiHandler := controllers.NewLTIHandler(db, ltiService)
+	scope := workspaceHandler.Scope()               // 按 X-Workspace 请求头限定工作区并检查成员权限
+	studentScope := workspaceHandler.StudentScope() // 作答与练习只需要查看权限
 
 	// 配置路由
 	router := gin.Default()
+	router.Use(app.Middleware())
+	router.ContextWithFallback = true // 处理函数直接使用gin.Context作为请求上下文（含trace）
+	router.Use(telemetry.Middleware())
 
 	// 获取项目根目录（关键修改）
 	_, mainPath, _, _ := runtime.Caller(0)
@@ -46,9 +175,10 @@ func main() {
 
 	// 通用CORS配置（开发和生产通用）
 	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
+		c.Writer.Header().Set("Access-Control-Allow-Origin", cfg.Server.CORSOrigin)
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "*") // 允许所有方法
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "*") // 允许所有头
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Trace-Id, X-Exam-Seed")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -70,16 +200,56 @@ func main() {
 	}
 
 	// API路由组
-	questionGroup := router.Group("/api/questions")
+	questionGroup := router.Group("/api/questions", scope)
 	{
 		questionGroup.POST("/CreateByAI", ctrl.GenerateQuestion)
 		questionGroup.POST("/batch-insert", ctrl.AddQuestions) 
 		questionGroup.POST("/CreateByHand", statsHandler.GenerateQuestion)
 		questionGroup.DELETE("/batch-delete", statsHandler.BatchDelete)
 		questionGroup.PUT("/update", statsHandler.UpdateQuestion)
+		questionGroup.PUT("/status", statsHandler.SetStatus)
+		questionGroup.POST("/backfill-explanations", backfillHandler.Create)
+		questionGroup.GET("/backfill-explanations", backfillHandler.List)
+		questionGroup.GET("/backfill-explanations/:id", backfillHandler.Get)
+		questionGroup.POST("/bulk-generate", bulkHandler.Create)
+		questionGroup.GET("/bulk-generate", bulkHandler.List)
+		questionGroup.GET("/bulk-generate/:id", bulkHandler.Get)
+		questionGroup.GET("/export", statsHandler.Export)
+		questionGroup.POST("/:id/translate", ctrl.TranslateQuestion)
+		questionGroup.GET("/:id/variants", ctrl.ListVariants)
+		questionGroup.GET("/:id/render", renderHandler.Question)
+		questionGroup.GET("/:id/submissions", submissionHandler.List)
+		questionGroup.GET("/:id/similarity", submissionHandler.Similarity)
+		questionGroup.GET("/:id/related", relatedHandler.Related)
+		questionGroup.GET("/:id/feedback", feedbackHandler.Question)
+		questionGroup.GET("/:id/revisions", feedbackHandler.Revisions)
+		questionGroup.POST("/similar", relatedHandler.Similar)
+		questionGroup.GET("/coverage", relatedHandler.Coverage)
+		questionGroup.POST("/share", workspaceHandler.Share)
+		questionGroup.DELETE("/share", workspaceHandler.Share)
+		questionGroup.POST("/copy", workspaceHandler.Copy)
+	}
+
+	retentionGroup := router.Group("/api/retention", scope)
+	{
+		retentionGroup.GET("/policy", retentionHandler.GetPolicy)
+		retentionGroup.PUT("/policy", retentionHandler.UpdatePolicy)
+		retentionGroup.POST("/dry-run", retentionHandler.DryRun)
+		retentionGroup.POST("/run", retentionHandler.Run)
+		retentionGroup.GET("/runs", retentionHandler.Runs)
 	}
 
-	statsGroup := router.Group("/api/stats")
+	workspaceGroup := router.Group("/api/workspaces")
+	{
+		workspaceGroup.POST("", workspaceHandler.Create)
+		workspaceGroup.GET("", workspaceHandler.List)
+		workspaceGroup.GET("/:id", workspaceHandler.Get)
+		workspaceGroup.PUT("/:id", workspaceHandler.Update)
+		workspaceGroup.PUT("/:id/members", workspaceHandler.SetMember)
+		workspaceGroup.DELETE("/:id/members/:user", workspaceHandler.RemoveMember)
+	}
+
+	statsGroup := router.Group("/api/stats", scope)
 	{
 		statsGroup.GET("/summary", statsHandler.Summary)
 		statsGroup.GET("/bytype1", statsHandler.ByType1)
@@ -88,15 +258,143 @@ func main() {
 		statsGroup.GET("/byid/:id", statsHandler.ById)
 	}
 
+	analyticsGroup := router.Group("/api/analytics", scope)
+	{
+		analyticsGroup.GET("/overview", analyticsHandler.Overview)
+		analyticsGroup.GET("/daily", analyticsHandler.Daily)
+		analyticsGroup.GET("/ai", analyticsHandler.AI)
+		analyticsGroup.GET("/ai/logs", analyticsHandler.AILogs)
+		analyticsGroup.GET("/items", analyticsHandler.Items)
+	}
+
+	router.POST("/api/answers", studentScope, answerHandler.Submit)
+	router.POST("/api/code-submissions", studentScope, submissionHandler.Submit)
+
+	feedbackGroup := router.Group("/api/feedback")
+	{
+		feedbackGroup.POST("", feedbackHandler.Submit) // 学生不是工作区成员，反馈由题目所属的工作区处理
+		feedbackGroup.GET("", scope, feedbackHandler.Queue)
+		feedbackGroup.POST("/resolve", scope, feedbackHandler.Resolve)
+		feedbackGroup.POST("/dismiss", scope, feedbackHandler.Dismiss)
+	}
+
+	practiceGroup := router.Group("/api/practice", studentScope)
+	{
+		practiceGroup.GET("/next", practiceHandler.Next)
+		practiceGroup.GET("/mastery", practiceHandler.Mastery)
+		practiceGroup.POST("/templates/:id", templateHandler.Practice)
+		practiceGroup.POST("/variants/:id/answer", templateHandler.Answer)
+	}
+
+	renderGroup := router.Group("/api/render")
+	{
+		renderGroup.POST("/markdown", renderHandler.Markdown)
+		renderGroup.GET("/highlight.css", renderHandler.CSS)
+	}
+
+	attachmentGroup := router.Group("/api/attachments")
+	{
+		attachmentGroup.POST("", scope, attachmentHandler.Upload)
+		attachmentGroup.GET("", scope, attachmentHandler.List)
+		attachmentGroup.GET("/:id", attachmentHandler.Get) // 供页面中的 <img> 直接引用，不经过工作区检查
+		attachmentGroup.DELETE("/:id", scope, attachmentHandler.Delete)
+	}
+
+	router.GET("/api/exams/render", scope, examHandler.Render)
+
+	templateGroup := router.Group("/api/templates", scope)
+	{
+		templateGroup.POST("", templateHandler.Create)
+		templateGroup.GET("", templateHandler.List)
+		templateGroup.GET("/:id", templateHandler.Get)
+		templateGroup.PUT("/:id", templateHandler.Update)
+		templateGroup.DELETE("/:id", templateHandler.Delete)
+		templateGroup.GET("/:id/variants", templateHandler.Preview)
+		templateGroup.GET("/:id/history", templateHandler.History)
+	}
+
+	quizGroup := router.Group("/api/quiz")
+	{
+		quizGroup.POST("/sessions", scope, quizHandler.Create)
+		quizGroup.GET("/sessions", scope, quizHandler.List)
+		quizGroup.GET("/sessions/:id", scope, quizHandler.Get)
+		quizGroup.GET("/ws", quizHandler.Connect) // 学生不是工作区成员，凭加入码连接
+	}
+
+	router.GET("/api/events", scope, eventHandler.Stream)
+	webhookGroup := router.Group("/api/webhooks", scope)
+	{
+		webhookGroup.POST("", eventHandler.CreateWebhook)
+		webhookGroup.GET("", eventHandler.ListWebhooks)
+		webhookGroup.PUT("/:id", eventHandler.UpdateWebhook)
+		webhookGroup.DELETE("/:id", eventHandler.DeleteWebhook)
+		webhookGroup.POST("/:id/ping", eventHandler.PingWebhook)
+		webhookGroup.GET("/:id/deliveries", eventHandler.ListDeliveries)
+		webhookGroup.GET("/:id/deliveries/:deliveryId", eventHandler.GetDelivery)
+		webhookGroup.POST("/:id/deliveries/:deliveryId/retry", eventHandler.RetryDelivery)
+	}
+
+	adminGroup := router.Group("/api/admin", backupHandler.AdminOnly())
+	{
+		adminGroup.GET("/backups", backupHandler.List)
+		adminGroup.POST("/backups", backupHandler.Create)
+		adminGroup.POST("/backups/:name/verify", backupHandler.Verify)
+		adminGroup.POST("/backups/:name/restore", backupHandler.Restore)
+		adminGroup.GET("/snapshot", backupHandler.Snapshot)
+		adminGroup.POST("/lti/platforms", ltiHandler.CreatePlatform)
+		adminGroup.GET("/lti/platforms", ltiHandler.ListPlatforms)
+		adminGroup.PUT("/lti/platforms/:id", ltiHandler.UpdatePlatform)
+		adminGroup.DELETE("/lti/platforms/:id", ltiHandler.DeletePlatform)
+	}
+
+	// LTI 1.3：登录发起、启动与 Deep Linking 由平台跳转进入，答题页面凭会话令牌访问
+	ltiGroup := router.Group("/api/lti")
+	{
+		ltiGroup.GET("/jwks", ltiHandler.JWKS)
+		ltiGroup.GET("/login", ltiHandler.Login)
+		ltiGroup.POST("/login", ltiHandler.Login)
+		ltiGroup.POST("/launch", ltiHandler.Launch)
+		ltiGroup.GET("/deep-link", ltiHandler.DeepLinkPage)
+		ltiGroup.POST("/deep-link", ltiHandler.DeepLink)
+		ltiGroup.GET("/play", ltiHandler.Play)
+		ltiGroup.POST("/play", ltiHandler.Play)
+		ltiGroup.GET("/session", ltiHandler.Session)
+		ltiGroup.POST("/session/submit", ltiHandler.Submit)
+		ltiGroup.POST("/activities", scope, ltiHandler.CreateActivity)
+		ltiGroup.GET("/activities", scope, ltiHandler.ListActivities)
+		ltiGroup.GET("/activities/:id", scope, ltiHandler.GetActivity)
+		ltiGroup.DELETE("/activities/:id", scope, ltiHandler.DeleteActivity)
+	}
+
+	// Prometheus 指标
+	router.GET("/metrics", telemetry.MetricsHandler())
+
 	// 健康检查
 	router.GET("/api/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	// gRPC 服务：与HTTP接口共用服务层，随HTTP服务一起优雅退出
+	if cfg.Server.GRPCPort > 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.GRPCPort))
+		if err != nil {
+			log.Fatal("gRPC 服务启动失败: ", err)
+		}
+		grpcServer := rpc.NewServer(db, questionService)
+		log.Printf("gRPC 服务启动于 %s", lis.Addr())
+		app.OnDrain("gRPC 服务", rpc.Drain(grpcServer))
+		app.Go("gRPC 服务", func(context.Context) {
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Printf("[GRPC] 服务异常退出: %v", err)
+			}
+		})
+	}
+
 	// 启动服务
-	port := "8080"
-	log.Printf("服务启动于 :%s", port)
-	if err := router.Run(":" + port); err != nil {
+	addr := fmt.Sprintf(":%d", cfg.Server.Port)
+	log.Printf("服务启动于 %s", addr)
+	srv := &http.Server{Addr: addr, Handler: router}
+	if err := app.Serve(srv); err != nil {
 		log.Fatal("服务启动失败:", err)
 	}
 }
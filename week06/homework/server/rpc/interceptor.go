@@ -0,0 +1,176 @@
+package rpc
+
+import (
+	"Server/services"
+	"Server/storage"
+	"Server/telemetry"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 与 HTTP 请求头 X-Workspace、X-User 对应的 metadata 键
+const (
+	workspaceKey = "x-workspace"
+	userKey      = "x-user"
+)
+
+// 只读方法，viewer 可以调用；其他方法需要修改题目的权限
+var readOnlyMethods = map[string]bool{
+	"GetQuestion":   true,
+	"ListQuestions": true,
+}
+
+type callerKey struct{}
+
+// callerFrom 拦截器解析的调用方
+func callerFrom(ctx context.Context) *services.Caller {
+	return ctx.Value(callerKey{}).(*services.Caller)
+}
+
+// interceptor 每个调用的链路追踪、工作区权限检查、日志与指标，与 HTTP 的中间件对应
+type interceptor struct {
+	db *storage.Database
+}
+
+func (i *interceptor) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var resp interface{}
+	err := i.intercept(ctx, info.FullMethod, func(ctx context.Context) error {
+		var err error
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (i *interceptor) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return i.intercept(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	})
+}
+
+// recoverUnary 把处理函数中的 panic 转换为 codes.Internal，避免整个进程退出；
+// 放在 interceptor 之后，panic 的调用同样记录日志与指标
+func recoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer recoverPanic(info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func recoverStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer recoverPanic(info.FullMethod, &err)
+	return handler(srv, ss)
+}
+
+// recoverPanic 记录 panic 与调用栈，返回给客户端的错误不包含内部细节
+func recoverPanic(fullMethod string, err *error) {
+	if r := recover(); r != nil {
+		log.Printf("[GRPC_PANIC] %s: %v\n%s", path.Base(fullMethod), r, debug.Stack())
+		*err = status.Error(codes.Internal, fmt.Sprintf("%s 内部错误", path.Base(fullMethod)))
+	}
+}
+
+// intercept 创建服务端span并按 metadata 解析调用方，调用结束后记录日志与指标
+func (i *interceptor) intercept(ctx context.Context, fullMethod string, call func(ctx context.Context) error) error {
+	start := time.Now()
+	method := path.Base(fullMethod)
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx, span := telemetry.StartServer(ctx, "gRPC "+method, metadataCarrier(md),
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.method", method))
+	defer span.End()
+
+	// 1. 解析工作区并检查权限
+	ref, user := first(md, workspaceKey), first(md, userKey)
+	caller, err := services.ResolveCaller(ctx, i.db, ref, user, !readOnlyMethods[method])
+	if err == nil {
+		err = call(context.WithValue(ctx, callerKey{}, caller))
+	}
+	err = toStatus(err)
+
+	// 2. 记录日志、指标与span状态
+	code := status.Code(err)
+	cost := time.Since(start)
+	telemetry.ObserveRPC(method, code.String(), cost)
+	span.SetAttributes(attribute.String("rpc.grpc.status_code", code.String()))
+	if err != nil {
+		if code == codes.Internal || code == codes.Unknown {
+			span.SetStatus(otelcodes.Error, err.Error())
+		}
+		log.Printf("[GRPC] %s %s %.3fs workspace=%q user=%q: %s", method, code, cost.Seconds(), ref, user, status.Convert(err).Message())
+	} else {
+		log.Printf("[GRPC] %s %s %.3fs workspace=%q user=%q", method, code, cost.Seconds(), ref, user)
+	}
+	return err
+}
+
+// toStatus 把服务层的错误转换为gRPC状态码，与 HTTP 接口的状态码一一对应
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch services.ErrorKindOf(err) {
+	case services.ErrInvalid:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case services.ErrNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case services.ErrForbidden:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case services.ErrQuota:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case services.ErrUpstream:
+		return status.Error(codes.Unavailable, err.Error())
+	case services.ErrConflict:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// contextStream 替换流的上下文，处理函数从中取得调用方与span
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context { return s.ctx }
+
+// metadataCarrier 从gRPC metadata中读取 traceparent 等链路信息
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string { return first(metadata.MD(c), key) }
+
+func (c metadataCarrier) Set(key, value string) { metadata.MD(c).Set(key, value) }
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
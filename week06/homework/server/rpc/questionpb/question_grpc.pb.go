@@ -0,0 +1,336 @@
+// 题库 gRPC 接口，与 HTTP 接口共用服务层：校验规则、工作区权限、配额与AI日志完全一致。
+//
+// 身份通过 metadata 传递，与 HTTP 请求头对应：
+//   x-workspace  工作区ID或标识，未指定时使用默认工作区
+//   x-user       当前用户，用于检查工作区成员角色
+//
+// 修改 proto 后重新生成代码（在 server 目录执行）：
+//   protoc --go_out=. --go_opt=module=Server --go-grpc_out=. --go-grpc_opt=module=Server proto/question.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: proto/question.proto
+
+package questionpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	QuestionService_GetQuestion_FullMethodName       = "/questionbank.v1.QuestionService/GetQuestion"
+	QuestionService_ListQuestions_FullMethodName     = "/questionbank.v1.QuestionService/ListQuestions"
+	QuestionService_CreateQuestion_FullMethodName    = "/questionbank.v1.QuestionService/CreateQuestion"
+	QuestionService_UpdateQuestion_FullMethodName    = "/questionbank.v1.QuestionService/UpdateQuestion"
+	QuestionService_DeleteQuestions_FullMethodName   = "/questionbank.v1.QuestionService/DeleteQuestions"
+	QuestionService_GenerateQuestions_FullMethodName = "/questionbank.v1.QuestionService/GenerateQuestions"
+)
+
+// QuestionServiceClient is the client API for QuestionService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type QuestionServiceClient interface {
+	// 查询工作区可见的一道题
+	GetQuestion(ctx context.Context, in *GetQuestionRequest, opts ...grpc.CallOption) (*Question, error)
+	// 按题型、标题关键词与内容语言分页查询
+	ListQuestions(ctx context.Context, in *ListQuestionsRequest, opts ...grpc.CallOption) (*ListQuestionsResponse, error)
+	// 手动录入一道题，返回保存后的题目
+	CreateQuestion(ctx context.Context, in *CreateQuestionRequest, opts ...grpc.CallOption) (*Question, error)
+	// 修改本工作区的单选/多选题，题型与答案同步到其他语言版本
+	UpdateQuestion(ctx context.Context, in *UpdateQuestionRequest, opts ...grpc.CallOption) (*UpdateQuestionResponse, error)
+	// 删除本工作区的题目（共享进来的题目不会被删除）
+	DeleteQuestions(ctx context.Context, in *DeleteQuestionsRequest, opts ...grpc.CallOption) (*DeleteQuestionsResponse, error)
+	// AI出题（结果不入库）：先返回 started，AI返回后逐题推送 question，最后是 finished
+	GenerateQuestions(ctx context.Context, in *GenerateQuestionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GenerateQuestionsResponse], error)
+}
+
+type questionServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewQuestionServiceClient(cc grpc.ClientConnInterface) QuestionServiceClient {
+	return &questionServiceClient{cc}
+}
+
+func (c *questionServiceClient) GetQuestion(ctx context.Context, in *GetQuestionRequest, opts ...grpc.CallOption) (*Question, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Question)
+	err := c.cc.Invoke(ctx, QuestionService_GetQuestion_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *questionServiceClient) ListQuestions(ctx context.Context, in *ListQuestionsRequest, opts ...grpc.CallOption) (*ListQuestionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListQuestionsResponse)
+	err := c.cc.Invoke(ctx, QuestionService_ListQuestions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *questionServiceClient) CreateQuestion(ctx context.Context, in *CreateQuestionRequest, opts ...grpc.CallOption) (*Question, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Question)
+	err := c.cc.Invoke(ctx, QuestionService_CreateQuestion_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *questionServiceClient) UpdateQuestion(ctx context.Context, in *UpdateQuestionRequest, opts ...grpc.CallOption) (*UpdateQuestionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateQuestionResponse)
+	err := c.cc.Invoke(ctx, QuestionService_UpdateQuestion_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *questionServiceClient) DeleteQuestions(ctx context.Context, in *DeleteQuestionsRequest, opts ...grpc.CallOption) (*DeleteQuestionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteQuestionsResponse)
+	err := c.cc.Invoke(ctx, QuestionService_DeleteQuestions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *questionServiceClient) GenerateQuestions(ctx context.Context, in *GenerateQuestionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GenerateQuestionsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &QuestionService_ServiceDesc.Streams[0], QuestionService_GenerateQuestions_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GenerateQuestionsRequest, GenerateQuestionsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type QuestionService_GenerateQuestionsClient = grpc.ServerStreamingClient[GenerateQuestionsResponse]
+
+// QuestionServiceServer is the server API for QuestionService service.
+// All implementations must embed UnimplementedQuestionServiceServer
+// for forward compatibility.
+type QuestionServiceServer interface {
+	// 查询工作区可见的一道题
+	GetQuestion(context.Context, *GetQuestionRequest) (*Question, error)
+	// 按题型、标题关键词与内容语言分页查询
+	ListQuestions(context.Context, *ListQuestionsRequest) (*ListQuestionsResponse, error)
+	// 手动录入一道题，返回保存后的题目
+	CreateQuestion(context.Context, *CreateQuestionRequest) (*Question, error)
+	// 修改本工作区的单选/多选题，题型与答案同步到其他语言版本
+	UpdateQuestion(context.Context, *UpdateQuestionRequest) (*UpdateQuestionResponse, error)
+	// 删除本工作区的题目（共享进来的题目不会被删除）
+	DeleteQuestions(context.Context, *DeleteQuestionsRequest) (*DeleteQuestionsResponse, error)
+	// AI出题（结果不入库）：先返回 started，AI返回后逐题推送 question，最后是 finished
+	GenerateQuestions(*GenerateQuestionsRequest, grpc.ServerStreamingServer[GenerateQuestionsResponse]) error
+	mustEmbedUnimplementedQuestionServiceServer()
+}
+
+// UnimplementedQuestionServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedQuestionServiceServer struct{}
+
+func (UnimplementedQuestionServiceServer) GetQuestion(context.Context, *GetQuestionRequest) (*Question, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQuestion not implemented")
+}
+func (UnimplementedQuestionServiceServer) ListQuestions(context.Context, *ListQuestionsRequest) (*ListQuestionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListQuestions not implemented")
+}
+func (UnimplementedQuestionServiceServer) CreateQuestion(context.Context, *CreateQuestionRequest) (*Question, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateQuestion not implemented")
+}
+func (UnimplementedQuestionServiceServer) UpdateQuestion(context.Context, *UpdateQuestionRequest) (*UpdateQuestionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateQuestion not implemented")
+}
+func (UnimplementedQuestionServiceServer) DeleteQuestions(context.Context, *DeleteQuestionsRequest) (*DeleteQuestionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteQuestions not implemented")
+}
+func (UnimplementedQuestionServiceServer) GenerateQuestions(*GenerateQuestionsRequest, grpc.ServerStreamingServer[GenerateQuestionsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method GenerateQuestions not implemented")
+}
+func (UnimplementedQuestionServiceServer) mustEmbedUnimplementedQuestionServiceServer() {}
+func (UnimplementedQuestionServiceServer) testEmbeddedByValue()                         {}
+
+// UnsafeQuestionServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to QuestionServiceServer will
+// result in compilation errors.
+type UnsafeQuestionServiceServer interface {
+	mustEmbedUnimplementedQuestionServiceServer()
+}
+
+func RegisterQuestionServiceServer(s grpc.ServiceRegistrar, srv QuestionServiceServer) {
+	// If the following call pancis, it indicates UnimplementedQuestionServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&QuestionService_ServiceDesc, srv)
+}
+
+func _QuestionService_GetQuestion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetQuestionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuestionServiceServer).GetQuestion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: QuestionService_GetQuestion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuestionServiceServer).GetQuestion(ctx, req.(*GetQuestionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _QuestionService_ListQuestions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQuestionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuestionServiceServer).ListQuestions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: QuestionService_ListQuestions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuestionServiceServer).ListQuestions(ctx, req.(*ListQuestionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _QuestionService_CreateQuestion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateQuestionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuestionServiceServer).CreateQuestion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: QuestionService_CreateQuestion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuestionServiceServer).CreateQuestion(ctx, req.(*CreateQuestionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _QuestionService_UpdateQuestion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateQuestionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuestionServiceServer).UpdateQuestion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: QuestionService_UpdateQuestion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuestionServiceServer).UpdateQuestion(ctx, req.(*UpdateQuestionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _QuestionService_DeleteQuestions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteQuestionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuestionServiceServer).DeleteQuestions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: QuestionService_DeleteQuestions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuestionServiceServer).DeleteQuestions(ctx, req.(*DeleteQuestionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _QuestionService_GenerateQuestions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GenerateQuestionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QuestionServiceServer).GenerateQuestions(m, &grpc.GenericServerStream[GenerateQuestionsRequest, GenerateQuestionsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type QuestionService_GenerateQuestionsServer = grpc.ServerStreamingServer[GenerateQuestionsResponse]
+
+// QuestionService_ServiceDesc is the grpc.ServiceDesc for QuestionService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var QuestionService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "questionbank.v1.QuestionService",
+	HandlerType: (*QuestionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetQuestion",
+			Handler:    _QuestionService_GetQuestion_Handler,
+		},
+		{
+			MethodName: "ListQuestions",
+			Handler:    _QuestionService_ListQuestions_Handler,
+		},
+		{
+			MethodName: "CreateQuestion",
+			Handler:    _QuestionService_CreateQuestion_Handler,
+		},
+		{
+			MethodName: "UpdateQuestion",
+			Handler:    _QuestionService_UpdateQuestion_Handler,
+		},
+		{
+			MethodName: "DeleteQuestions",
+			Handler:    _QuestionService_DeleteQuestions_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GenerateQuestions",
+			Handler:       _QuestionService_GenerateQuestions_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/question.proto",
+}
@@ -0,0 +1,245 @@
+// Package rpc 题库的 gRPC 服务，与 HTTP 接口在同一进程中运行并共用 services 中的服务层
+package rpc
+
+import (
+	"Server/config"
+	"Server/rpc/questionpb"
+	"Server/services"
+	"Server/storage"
+	"context"
+
+	"github.com/gin-gonic/gin/binding"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Server 实现 questionbank.v1.QuestionService
+type Server struct {
+	questionpb.UnimplementedQuestionServiceServer
+	questions *services.QuestionService
+}
+
+// NewServer 创建注册了题库服务与反射服务（供 grpcurl 等工具查看接口）的 gRPC 服务
+func NewServer(db *storage.Database, questions *services.QuestionService) *grpc.Server {
+	i := &interceptor{db: db}
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(i.unary, recoverUnary),
+		grpc.ChainStreamInterceptor(i.stream, recoverStream),
+	)
+	questionpb.RegisterQuestionServiceServer(srv, &Server{questions: questions})
+	reflection.Register(srv)
+	return srv
+}
+
+// Drain 停止接收新调用并等待进行中的调用结束，ctx 取消时强制关闭剩余调用
+func Drain(srv *grpc.Server) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			srv.Stop()
+			<-stopped
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Server) GetQuestion(ctx context.Context, req *questionpb.GetQuestionRequest) (*questionpb.Question, error) {
+	q, err := s.questions.Get(ctx, callerFrom(ctx), int(req.GetId()))
+	if err != nil {
+		return nil, err
+	}
+	return toQuestion(q), nil
+}
+
+func (s *Server) ListQuestions(ctx context.Context, req *questionpb.ListQuestionsRequest) (*questionpb.ListQuestionsResponse, error) {
+	// 与 HTTP 接口的默认值一致
+	page := storage.QuestionPage{
+		Type:     int(req.GetType()),
+		Search:   req.GetSearch(),
+		Locale:   req.GetLocale(),
+		Page:     int(req.GetPage()),
+		PageSize: int(req.GetPageSize()),
+	}
+	if page.Page == 0 {
+		page.Page = 1
+	}
+	if page.PageSize == 0 {
+		page.PageSize = 10
+	}
+	questions, total, err := s.questions.List(ctx, callerFrom(ctx), page)
+	if err != nil {
+		return nil, err
+	}
+	resp := &questionpb.ListQuestionsResponse{Total: int32(total), Questions: make([]*questionpb.Question, len(questions))}
+	for i := range questions {
+		resp.Questions[i] = toQuestion(&questions[i])
+	}
+	return resp, nil
+}
+
+func (s *Server) CreateQuestion(ctx context.Context, req *questionpb.CreateQuestionRequest) (*questionpb.Question, error) {
+	input, err := fromInput(0, req.GetQuestion())
+	if err != nil {
+		return nil, err
+	}
+	caller := callerFrom(ctx)
+	id, err := s.questions.Create(ctx, caller, input)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.questions.Get(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	return toQuestion(q), nil
+}
+
+func (s *Server) UpdateQuestion(ctx context.Context, req *questionpb.UpdateQuestionRequest) (*questionpb.UpdateQuestionResponse, error) {
+	input, err := fromInput(int(req.GetId()), req.GetQuestion())
+	if err != nil {
+		return nil, err
+	}
+	affected, synced, err := s.questions.Update(ctx, callerFrom(ctx), input)
+	if err != nil {
+		return nil, err
+	}
+	return &questionpb.UpdateQuestionResponse{AffectedRows: affected, SyncedVariants: synced}, nil
+}
+
+func (s *Server) DeleteQuestions(ctx context.Context, req *questionpb.DeleteQuestionsRequest) (*questionpb.DeleteQuestionsResponse, error) {
+	ids := make([]int, len(req.GetIds()))
+	for i, id := range req.GetIds() {
+		ids[i] = int(id)
+	}
+	// 被考试或测验引用的题目只能通过 HTTP 接口强制删除
+	deleted, err := s.questions.Delete(ctx, callerFrom(ctx), ids, false)
+	if err != nil {
+		return nil, err
+	}
+	resp := &questionpb.DeleteQuestionsResponse{DeletedIds: make([]int32, len(deleted))}
+	for i, id := range deleted {
+		resp.DeletedIds[i] = int32(id)
+	}
+	return resp, nil
+}
+
+// GenerateQuestions 通过检查后先发送 started，AI返回后逐题发送，最后发送 finished
+func (s *Server) GenerateQuestions(req *questionpb.GenerateQuestionsRequest, stream grpc.ServerStreamingServer[questionpb.GenerateQuestionsResponse]) error {
+	ctx := stream.Context()
+	// 1. 与 HTTP 接口相同的参数校验
+	aiReq := config.QuestionRequest{
+		Model:    req.GetModel(),
+		Language: req.GetLanguage(),
+		Count:    int(req.GetCount()),
+		Type:     int(req.GetType()),
+		Keyword:  req.GetKeyword(),
+	}
+	if req.GetBypassCache() {
+		aiReq.Cache = "bypass"
+	}
+	if err := validate(&aiReq); err != nil {
+		return err
+	}
+
+	// 2. 调用AI（写入AI日志与事件），开始前通知客户端
+	var sendErr error
+	resp, entry, err := s.questions.Generate(ctx, callerFrom(ctx), aiReq, func(model string) {
+		sendErr = stream.Send(&questionpb.GenerateQuestionsResponse{
+			Event: &questionpb.GenerateQuestionsResponse_Started{Started: &questionpb.GenerationStarted{Model: model}},
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+
+	// 3. 逐题发送
+	for _, q := range resp.Questions {
+		if err := stream.Send(&questionpb.GenerateQuestionsResponse{
+			Event: &questionpb.GenerateQuestionsResponse_Question{Question: &questionpb.GeneratedQuestion{
+				Title:        q.Title,
+				Answers:      q.Answers,
+				Rights:       q.Rights,
+				Explanations: q.Explanations,
+				Hint:         q.Hint,
+				Reference:    q.Reference,
+			}},
+		}); err != nil {
+			return err
+		}
+	}
+	return stream.Send(&questionpb.GenerateQuestionsResponse{
+		Event: &questionpb.GenerateQuestionsResponse_Finished{Finished: &questionpb.GenerationFinished{
+			Count:    int32(len(resp.Questions)),
+			Cache:    entry.Cache,
+			CostTime: entry.AICostTime,
+			TraceId:  entry.TraceID,
+		}},
+	})
+}
+
+// validate 使用与 gin ShouldBindJSON 相同的校验器和 binding 标签
+func validate(obj interface{}) error {
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		return status.Error(codes.InvalidArgument, "参数错误: "+err.Error())
+	}
+	return nil
+}
+
+// fromInput 录入或修改的题目内容
+func fromInput(id int, in *questionpb.QuestionInput) (*config.QuestionRequest1, error) {
+	if in == nil {
+		return nil, status.Error(codes.InvalidArgument, "参数错误: 缺少 question")
+	}
+	req := &config.QuestionRequest1{
+		Id:           id,
+		Type:         int(in.GetType()),
+		Title:        in.GetTitle(),
+		Language:     in.GetLanguage(),
+		Answers:      in.GetAnswers(),
+		Rights:       in.GetRights(),
+		Tags:         in.GetTags(),
+		Explanations: in.GetExplanations(),
+		Hint:         in.GetHint(),
+		Reference:    in.GetReference(),
+		Locale:       in.GetLocale(),
+	}
+	return req, validate(req)
+}
+
+func toQuestion(q *storage.Question) *questionpb.Question {
+	pb := &questionpb.Question{
+		Id:                int32(q.ID),
+		Type:              questionpb.QuestionType(q.Type),
+		Title:             q.Title,
+		Language:          q.Language,
+		Answers:           q.Answers,
+		Rights:            q.Rights,
+		Tags:              q.Tags,
+		Explanations:      q.Explanations,
+		Hint:              q.Hint,
+		Reference:         q.Reference,
+		ExplanationSource: q.ExplanationSource,
+		ExplanationModel:  q.ExplanationModel,
+		Source:            q.Source,
+		Status:            q.Status,
+		Locale:            q.Locale,
+		GroupId:           int32(q.GroupID),
+		WorkspaceId:       int32(q.WorkspaceID),
+	}
+	if q.CreatedAt != nil {
+		pb.CreatedAt = *q.CreatedAt
+	}
+	return pb
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"Server/storage"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	MaxAttachmentSize = 5 << 20 // 单个附件最大5MB，与 file-service 一致
+
+	// 上传后超过这一时间仍未被任何题目引用的附件会被清理（给编辑题目留出时间）
+	attachmentGrace = 24 * time.Hour
+	// 清理未引用附件的间隔
+	attachmentSweepInterval = time.Hour
+)
+
+// 题目附件只接受浏览器、PDF与Word都能显示的图片；SVG 可以携带脚本，不允许上传
+var allowedAttachmentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// ErrAttachmentType 附件类型不允许或内容与扩展名不符
+var ErrAttachmentType = errors.New("只支持 JPEG、PNG、GIF、WebP 图片")
+
+// AttachmentManager 题目附件的上传、读取与垃圾回收；文件保存在 FileStore，元数据保存在 attachments 表
+type AttachmentManager struct {
+	db    *storage.Database
+	files *storage.FileStore
+}
+
+func NewAttachmentManager(db *storage.Database, files *storage.FileStore) *AttachmentManager {
+	return &AttachmentManager{db: db, files: files}
+}
+
+// Files 附件的文件存储
+func (m *AttachmentManager) Files() *storage.FileStore {
+	return m.files
+}
+
+// ValidateAttachmentType 按扩展名判断附件的MIME类型（与 file-service 的 ValidateFileType 相同），返回主类型
+func ValidateAttachmentType(fileHeader *multipart.FileHeader) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	primary, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	return primary, allowedAttachmentTypes[primary]
+}
+
+// Upload 校验类型后写入文件存储并记录元数据。除扩展名外还检查文件头，
+// 避免把其他内容改个扩展名上传后以图片类型返回给浏览器
+func (m *AttachmentManager) Upload(ctx context.Context, workspaceID int, user string, fileHeader *multipart.FileHeader) (*storage.Attachment, error) {
+	// 1. 扩展名与文件内容
+	mimeType, ok := ValidateAttachmentType(fileHeader)
+	if !ok {
+		return nil, ErrAttachmentType
+	}
+	if fileHeader.Size > MaxAttachmentSize {
+		return nil, fmt.Errorf("附件不能超过 %dMB", MaxAttachmentSize>>20)
+	}
+	src, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(src, head)
+	if sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n])); sniffed != mimeType {
+		return nil, ErrAttachmentType
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// 2. 写入文件存储
+	id := generateUUID()
+	saved, err := m.files.Save(ctx, id, src, MaxAttachmentSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 记录元数据，失败时删除已写入的文件
+	a := &storage.Attachment{
+		ID:          id,
+		WorkspaceID: workspaceID,
+		Filename:    filepath.Base(fileHeader.Filename),
+		MimeType:    mimeType,
+		Size:        saved.Size,
+		SHA256:      saved.SHA256,
+		Path:        saved.Path,
+		UploadedBy:  user,
+	}
+	if err := m.db.WithContext(ctx).CreateAttachment(a); err != nil {
+		_ = m.files.Delete(saved.Path)
+		return nil, fmt.Errorf("保存附件失败: %w", err)
+	}
+	return a, nil
+}
+
+// Read 读取附件内容（供PDF、Word与导出打包使用）
+func (m *AttachmentManager) Read(ctx context.Context, id string) (*storage.Attachment, []byte, error) {
+	a, err := m.db.WithContext(ctx).GetAttachment(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := m.files.Open(a.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	return a, data, err
+}
+
+// Collect 删除 ids 中已没有题目引用的附件及其文件，在删除或修改题目后调用，返回删除的附件ID
+func (m *AttachmentManager) Collect(ctx context.Context, ids []string) ([]string, error) {
+	deleted, err := m.db.WithContext(ctx).DeleteUnreferencedAttachments(ids)
+	if err != nil {
+		return nil, fmt.Errorf("清理附件失败: %w", err)
+	}
+	removed := make([]string, 0, len(deleted))
+	for _, a := range deleted {
+		if err := m.files.Delete(a.Path); err != nil {
+			log.Printf("[ATTACHMENT] 删除附件文件 %s 失败: %v", a.Path, err)
+		}
+		removed = append(removed, a.ID)
+	}
+	return removed, nil
+}
+
+// Sweep 清理上传后超过 attachmentGrace 仍未被引用的附件
+func (m *AttachmentManager) Sweep(ctx context.Context) ([]string, error) {
+	ids, err := m.db.WithContext(ctx).StaleAttachments(time.Now().Add(-attachmentGrace))
+	if err != nil {
+		return nil, fmt.Errorf("查询未引用的附件失败: %w", err)
+	}
+	return m.Collect(ctx, ids)
+}
+
+// Run 定时清理未引用的附件，由 lifecycle.Manager 作为后台任务启动
+func (m *AttachmentManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(attachmentSweepInterval)
+	defer ticker.Stop()
+	for {
+		if removed, err := m.Sweep(ctx); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[ATTACHMENT] %v", err)
+			}
+		} else if len(removed) > 0 {
+			log.Printf("[ATTACHMENT] 已清理 %d 个未被引用的附件", len(removed))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// generateUUID 32位十六进制的随机UUID（版本4），与 file-service 的 GenerateUUID 相同
+func generateUUID() string {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		panic("UUID生成失败: " + err.Error())
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40 // 版本4
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // 变体位
+	return hex.EncodeToString(uuid)
+}
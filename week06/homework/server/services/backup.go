@@ -0,0 +1,467 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"Server/telemetry"
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 备份类型，体现在文件名前缀中
+const (
+	BackupAuto       = "auto"        // 定时备份，超过 backup.keep 份后自动删除最旧的
+	BackupManual     = "manual"      // 手动备份，不会自动删除
+	BackupPreRestore = "pre-restore" // 恢复前自动保存的当前数据库
+)
+
+const backupTimeLayout = "20060102-150405"
+
+var (
+	// 备份文件名：<类型>-<时间>[-序号].db
+	backupNamePattern = regexp.MustCompile(`^(auto|manual|pre-restore)-(\d{8}-\d{6})(-\d+)?\.db$`)
+	// 允许通过接口指定的文件名，不能包含路径
+	backupFilePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*\.db$`)
+)
+
+// BackupInfo 备份目录中的一个备份文件
+type BackupInfo struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind,omitempty"` // auto/manual/pre-restore，其他方式放入目录的文件为空
+	Size      int64  `json:"size"`
+	CreatedAt string `json:"created_at"`
+}
+
+// RestoreResult 一次恢复的结果
+type RestoreResult struct {
+	Source       string                   `json:"source"`        // 恢复所用的备份
+	SafetyBackup *BackupInfo              `json:"safety_backup"` // 恢复前保存的当前数据库，可用于撤销
+	Before       *storage.IntegrityReport `json:"before"`        // 备份的校验结果
+	After        *storage.IntegrityReport `json:"after"`         // 恢复后当前数据库的校验结果
+}
+
+// SnapshotManifest 快照包中的 manifest.json
+type SnapshotManifest struct {
+	CreatedAt string                   `json:"created_at"`
+	Database  SnapshotFile             `json:"database"`
+	Integrity *storage.IntegrityReport `json:"integrity"`
+	Logs      []SnapshotFile           `json:"logs"`
+	// 附件文件，路径与附件目录中的相同（attachments/日期/ID前缀/ID）
+	Attachments []SnapshotFile `json:"attachments"`
+}
+
+// SnapshotFile 快照包中的一个文件及其校验和
+type SnapshotFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BackupManager 数据库的备份、轮转、恢复与快照导出；服务与命令行共用
+type BackupManager struct {
+	db    *storage.Database
+	logs  *storage.JSONStorage
+	files *storage.FileStore // 题目附件
+	cfg   config.BackupConfig
+
+	mu sync.Mutex // 备份、恢复与轮转互斥，避免恢复时正在写出备份
+}
+
+func NewBackupManager(db *storage.Database, logs *storage.JSONStorage, files *storage.FileStore, cfg config.BackupConfig) *BackupManager {
+	return &BackupManager{db: db, logs: logs, files: files, cfg: cfg}
+}
+
+// Create 立即备份到备份目录，备份完成后校验一次
+func (m *BackupManager) Create(ctx context.Context, kind string) (*BackupInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	info, err := m.create(ctx, kind)
+	telemetry.Backup(kind, err)
+	return info, err
+}
+
+func (m *BackupManager) create(ctx context.Context, kind string) (*BackupInfo, error) {
+	// 1. 生成不重复的文件名
+	if err := os.MkdirAll(m.cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建备份目录失败: %w", err)
+	}
+	base := kind + "-" + time.Now().Format(backupTimeLayout)
+	name := base + ".db"
+	for i := 2; fileExists(filepath.Join(m.cfg.Dir, name)); i++ {
+		name = fmt.Sprintf("%s-%d.db", base, i)
+	}
+	path := filepath.Join(m.cfg.Dir, name)
+
+	// 2. 写出并校验，校验不通过的备份直接删除
+	if err := m.db.WithContext(ctx).BackupTo(path); err != nil {
+		return nil, err
+	}
+	report, err := storage.VerifyDatabase(ctx, path)
+	if err == nil && !report.OK {
+		err = fmt.Errorf("备份校验失败: %v", report.Problems)
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return backupInfo(path)
+}
+
+// List 备份目录中的全部备份，最新的在前
+func (m *BackupManager) List() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(m.cfg.Dir)
+	if os.IsNotExist(err) {
+		return []BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取备份目录失败: %w", err)
+	}
+	list := []BackupInfo{}
+	for _, e := range entries {
+		if e.IsDir() || !backupFilePattern.MatchString(e.Name()) {
+			continue
+		}
+		info, err := backupInfo(filepath.Join(m.cfg.Dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt != list[j].CreatedAt {
+			return list[i].CreatedAt > list[j].CreatedAt
+		}
+		return list[i].Name > list[j].Name
+	})
+	return list, nil
+}
+
+// Rotate 只保留最近 backup.keep 份定时备份，返回删除的文件名
+func (m *BackupManager) Rotate() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	removed := []string{}
+	kept := 0
+	for _, b := range list {
+		if b.Kind != BackupAuto {
+			continue
+		}
+		if kept < m.cfg.Keep {
+			kept++
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.cfg.Dir, b.Name)); err != nil {
+			return removed, fmt.Errorf("删除旧备份失败: %w", err)
+		}
+		removed = append(removed, b.Name)
+	}
+	return removed, nil
+}
+
+// Path 备份目录中文件名对应的路径，名称不合法或文件不存在时返回错误
+func (m *BackupManager) Path(name string) (string, error) {
+	if !backupFilePattern.MatchString(name) {
+		return "", fmt.Errorf("无效的备份名称: %s", name)
+	}
+	path := filepath.Join(m.cfg.Dir, name)
+	if !fileExists(path) {
+		return "", os.ErrNotExist
+	}
+	return path, nil
+}
+
+// Verify 校验备份文件
+func (m *BackupManager) Verify(ctx context.Context, path string) (*storage.IntegrityReport, error) {
+	return storage.VerifyDatabase(ctx, path)
+}
+
+// Restore 从备份恢复：先校验备份，再把当前数据库保存为 pre-restore 备份，最后在线覆盖当前数据库。
+// 备份未通过校验时不做任何修改，返回的结果中包含校验报告
+func (m *BackupManager) Restore(ctx context.Context, path string) (*RestoreResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 1. 校验备份
+	result := &RestoreResult{Source: filepath.Base(path)}
+	report, err := storage.VerifyDatabase(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	result.Before = report
+	if !report.OK {
+		return result, fmt.Errorf("备份未通过完整性校验，已取消恢复")
+	}
+
+	// 2. 保存当前数据库，恢复错误时可以撤销
+	safety, err := m.create(ctx, BackupPreRestore)
+	telemetry.Backup(BackupPreRestore, err)
+	if err != nil {
+		return result, fmt.Errorf("保存当前数据库失败，已取消恢复: %w", err)
+	}
+	result.SafetyBackup = safety
+
+	// 3. 恢复并再次校验
+	db := m.db.WithContext(ctx)
+	if err := db.RestoreFrom(path); err != nil {
+		return result, err
+	}
+	after, err := db.Verify()
+	if err != nil {
+		return result, err
+	}
+	result.After = after
+	log.Printf("[BACKUP] 已从 %s 恢复数据库，恢复前的数据保存在 %s", result.Source, safety.Name)
+	return result, nil
+}
+
+// Snapshot 将数据库的一致快照、AI日志与附件打包为 tar.gz 写入 w，
+// 包含 manifest.json（文件校验和与完整性报告）、question_service.db、log/*.json 与 attachments/
+func (m *BackupManager) Snapshot(ctx context.Context, w io.Writer) (*SnapshotManifest, error) {
+	// 1. 数据库快照写入临时文件
+	if err := os.MkdirAll(m.cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建备份目录失败: %w", err)
+	}
+	tmp := filepath.Join(m.cfg.Dir, fmt.Sprintf(".snapshot-%d.db", time.Now().UnixNano()))
+	defer os.Remove(tmp)
+	if err := m.db.WithContext(ctx).BackupTo(tmp); err != nil {
+		return nil, err
+	}
+	report, err := storage.VerifyDatabase(ctx, tmp)
+	if err != nil {
+		return nil, err
+	}
+	dbFile, err := fileSum("question_service.db", tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. AI日志（与写入互斥读取）
+	logs, err := m.logs.ReadFiles()
+	if err != nil {
+		return nil, err
+	}
+	manifest := &SnapshotManifest{
+		CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
+		Database:  dbFile,
+		Integrity: report,
+		Logs:      make([]SnapshotFile, 0, len(logs)),
+	}
+	for _, f := range logs {
+		sum := sha256.Sum256(f.Data)
+		manifest.Logs = append(manifest.Logs, SnapshotFile{
+			Name:   "log/" + f.Name,
+			Size:   int64(len(f.Data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	// 3. 附件文件（数据库快照之后上传的附件不在其中，不影响一致性）
+	attachments, err := m.attachmentFiles()
+	if err != nil {
+		return nil, err
+	}
+	manifest.Attachments = attachments
+
+	// 4. 打包，manifest 放在最前面便于查看
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	manifestJSON, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := writeTarBytes(tw, "manifest.json", manifestJSON, now); err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tw, dbFile.Name, tmp, now); err != nil {
+		return nil, err
+	}
+	for i, f := range logs {
+		if err := writeTarBytes(tw, manifest.Logs[i].Name, f.Data, now); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range attachments {
+		path := filepath.Join(m.files.Dir(), filepath.FromSlash(strings.TrimPrefix(f.Name, "attachments/")))
+		if err := writeTarFile(tw, f.Name, path, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// attachmentFiles 附件目录中的全部文件及校验和，目录不存在时为空
+func (m *BackupManager) attachmentFiles() ([]SnapshotFile, error) {
+	files := []SnapshotFile{}
+	root := m.files.Dir()
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil // 目录不存在或文件已被清理
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		f, err := fileSum("attachments/"+filepath.ToSlash(rel), path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		files = append(files, f)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取附件目录失败: %w", err)
+	}
+	return files, nil
+}
+
+// Run 按 backup.interval 定时备份并轮转，由 lifecycle.Manager 作为后台任务启动；
+// 启动时距上次定时备份已超过间隔则立即备份
+func (m *BackupManager) Run(ctx context.Context) {
+	if m.cfg.Interval == 0 {
+		return
+	}
+	for {
+		wait := m.cfg.Interval
+		if last, ok := m.lastAuto(); ok {
+			wait -= time.Since(last)
+		} else {
+			wait = 0
+		}
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		info, err := m.Create(ctx, BackupAuto)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[BACKUP] 定时备份失败: %v", err)
+				// 失败后等待一个间隔的十分之一再重试，避免反复失败刷屏
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(m.cfg.Interval / 10):
+				}
+			}
+			continue
+		}
+		log.Printf("[BACKUP] 已完成定时备份 %s（%d 字节）", info.Name, info.Size)
+		if removed, err := m.Rotate(); err != nil {
+			log.Printf("[BACKUP] %v", err)
+		} else if len(removed) > 0 {
+			log.Printf("[BACKUP] 已删除 %d 份旧备份", len(removed))
+		}
+	}
+}
+
+// lastAuto 最近一次定时备份的时间
+func (m *BackupManager) lastAuto() (time.Time, bool) {
+	list, err := m.List()
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, b := range list {
+		if b.Kind == BackupAuto {
+			t, err := time.ParseInLocation("2006-01-02 15:04:05", b.CreatedAt, time.Local)
+			return t, err == nil
+		}
+	}
+	return time.Time{}, false
+}
+
+// backupInfo 读取备份文件信息，按文件名中的时间作为创建时间，其他文件使用修改时间
+func backupInfo(path string) (*BackupInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取备份失败: %w", err)
+	}
+	info := &BackupInfo{
+		Name:      stat.Name(),
+		Size:      stat.Size(),
+		CreatedAt: stat.ModTime().Format("2006-01-02 15:04:05"),
+	}
+	if match := backupNamePattern.FindStringSubmatch(stat.Name()); match != nil {
+		info.Kind = match[1]
+		if t, err := time.ParseInLocation(backupTimeLayout, match[2], time.Local); err == nil {
+			info.CreatedAt = t.Format("2006-01-02 15:04:05")
+		}
+	}
+	return info, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// fileSum 计算文件大小与SHA-256
+func fileSum(name, path string) (SnapshotFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return SnapshotFile{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return SnapshotFile{}, err
+	}
+	return SnapshotFile{Name: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func writeTarBytes(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeTarFile(tw *tar.Writer, name, path string, modTime time.Time) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: stat.Size(), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
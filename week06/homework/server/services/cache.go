@@ -0,0 +1,225 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"Server/telemetry"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PromptVersion 出题提示词模板的版本，修改 buildDeepseekPrompt/buildTongyiPrompt 时递增，使旧缓存失效
+const PromptVersion = 1
+
+// 缓存状态，写入返回结果与AI日志
+const (
+	CacheHit       = "hit"       // 命中缓存，未调用AI
+	CacheCoalesced = "coalesced" // 与进行中的相同请求合并，共用其结果
+	CacheMiss      = "miss"      // 未命中，调用AI后写入缓存
+	CacheBypass    = "bypass"    // 请求要求跳过缓存
+)
+
+// ResponseCache AI出题结果缓存
+type ResponseCache interface {
+	Get(ctx context.Context, key string) (*config.QuestionResponses, bool)
+	Set(ctx context.Context, entry storage.CachedResponse)
+}
+
+// NewResponseCache 按配置创建缓存，backend 为 none 时返回 nil
+func NewResponseCache(cfg config.CacheConfig, db *storage.Database) ResponseCache {
+	switch cfg.Backend {
+	case "memory":
+		return newMemoryCache()
+	case "sqlite":
+		if purged, err := db.PurgeCachedResponses(time.Now()); err != nil {
+			log.Printf("[CACHE_WARN] %v", err)
+		} else if purged > 0 {
+			log.Printf("[CACHE] 已清理 %d 条过期的AI缓存", purged)
+		}
+		return &sqliteCache{db: db}
+	default:
+		return nil
+	}
+}
+
+// cacheKeyFields 参与缓存键计算的字段：归一化后的请求、实际使用的模型与提示词
+type cacheKeyFields struct {
+	Provider      string   `json:"provider"`
+	Model         string   `json:"model"`
+	Type          int      `json:"type"`
+	Language      string   `json:"language"`
+	Count         int      `json:"count"`
+	Keyword       string   `json:"keyword"`
+	PromptVersion int      `json:"promptVersion"`
+	System        string   `json:"system,omitempty"`
+	ExtraRules    []string `json:"extraRules,omitempty"`
+	Temperature   float32  `json:"temperature"`
+	MaxTokens     int      `json:"maxTokens"`
+}
+
+// cacheKey 返回缓存键及归一化后的请求。关键词忽略大小写与多余空白，
+// 提示词配置或模板版本变化后键随之改变
+func cacheKey(req config.QuestionRequest, settings modelSettings) (string, string) {
+	fields := cacheKeyFields{
+		Provider:      settings.provider,
+		Model:         settings.model,
+		Type:          req.Type,
+		Language:      strings.ToLower(req.Language),
+		Count:         req.Count,
+		Keyword:       strings.ToLower(strings.Join(strings.Fields(req.Keyword), " ")),
+		PromptVersion: PromptVersion,
+		System:        settings.prompt.System,
+		ExtraRules:    settings.prompt.ExtraRules,
+		Temperature:   settings.temperature,
+		MaxTokens:     settings.maxTokens,
+	}
+	data, _ := json.Marshal(fields)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), string(data)
+}
+
+// generateCached 先查缓存，未命中时合并并发的相同请求，只有一个请求真正调用AI
+func (s *AIServiceImpl) generateCached(ctx context.Context, set *providerSet, req config.QuestionRequest) (*config.QuestionResponses, error) {
+	name := req.Model
+	if name == "" {
+		name = set.defaultModel
+	}
+	settings, ok := set.settings[name]
+	if !ok {
+		// 模型不可用，交给 observe 返回错误
+		return s.generate(ctx, req)
+	}
+
+	key, normalized := cacheKey(req, settings)
+	if resp, ok := s.cache.Get(ctx, key); ok {
+		telemetry.AICache(name, CacheHit)
+		return withCacheStatus(resp, CacheHit), nil
+	}
+
+	// 共用的AI调用不随发起请求取消（合并的请求仍在等待结果），也不引用发起请求的上下文：
+	// 处理函数传入的 gin.Context 在请求结束后会被复用，这里只保留 trace 关联，超时沿用模型设置
+	spanCtx := trace.SpanContextFromContext(ctx)
+
+	// singleflight 对发起者也标记 Shared，用 leader 区分实际调用AI的请求
+	leader := false
+	ch := s.inflight.DoChan(key, func() (val interface{}, err error) {
+		leader = true
+		// DoChan 在新的 goroutine 中重新抛出 panic，调用方无法恢复，这里转为错误返回
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[AI_PANIC] %s 出题时发生 panic: %v\n%s", name, r, debug.Stack())
+				val, err = nil, fmt.Errorf("AI出题内部错误：%v", r)
+			}
+		}()
+		callCtx, cancel := context.WithTimeout(trace.ContextWithSpanContext(context.Background(), spanCtx), settings.timeout)
+		defer cancel()
+		resp, err := s.generate(callCtx, req)
+		if err != nil {
+			return nil, err
+		}
+		// 输出被截断、题目数量不足时不缓存，下次请求重新生成
+		if len(resp.Questions) < req.Count {
+			return resp, nil
+		}
+		s.cache.Set(callCtx, storage.CachedResponse{
+			Key:           key,
+			Model:         name,
+			PromptVersion: PromptVersion,
+			Request:       normalized,
+			Response:      resp,
+			ExpiresAt:     time.Now().Add(set.cacheTTL),
+		})
+		return resp, nil
+	})
+
+	// 合并的请求各自响应取消，不必等待发起者
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		status := CacheMiss
+		if !leader {
+			status = CacheCoalesced
+		}
+		telemetry.AICache(name, status)
+		return withCacheStatus(res.Val.(*config.QuestionResponses), status), nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("等待相同请求的结果时取消：%w", ctx.Err())
+	}
+}
+
+// withCacheStatus 返回带缓存状态的副本，缓存中的结果与合并请求共享的结果不会被修改
+func withCacheStatus(resp *config.QuestionResponses, status string) *config.QuestionResponses {
+	out := *resp
+	out.Cache = status
+	return &out
+}
+
+// memoryCache 进程内缓存，重启后清空
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]storage.CachedResponse
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: make(map[string]storage.CachedResponse)}
+}
+
+func (m *memoryCache) Get(_ context.Context, key string) (*config.QuestionResponses, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.ExpiresAt) {
+		delete(m.entries, key)
+		return nil, false
+	}
+	return entry.Response, true
+}
+
+func (m *memoryCache) Set(_ context.Context, entry storage.CachedResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 写入时顺带清理过期条目，避免长期运行后占用内存
+	now := time.Now()
+	for key, e := range m.entries {
+		if now.After(e.ExpiresAt) {
+			delete(m.entries, key)
+		}
+	}
+	m.entries[entry.Key] = entry
+}
+
+// sqliteCache 缓存保存在数据库中，重启后仍然有效
+type sqliteCache struct {
+	db *storage.Database
+}
+
+func (c *sqliteCache) Get(ctx context.Context, key string) (*config.QuestionResponses, bool) {
+	resp, err := c.db.WithContext(ctx).GetCachedResponse(key, time.Now())
+	if err != nil {
+		log.Printf("[CACHE_WARN] %v", err)
+		return nil, false
+	}
+	return resp, resp != nil
+}
+
+func (c *sqliteCache) Set(ctx context.Context, entry storage.CachedResponse) {
+	// 请求已取消时仍然写入，结果已经付费生成
+	if err := c.db.WithContext(context.WithoutCancel(ctx)).SaveCachedResponse(entry, time.Now()); err != nil {
+		log.Printf("[CACHE_WARN] %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"Server/config"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// panicProvider 出题时 panic，模拟 AI 客户端或解析器中的错误
+type panicProvider struct{}
+
+func (panicProvider) Generate(context.Context, config.QuestionRequest) (*config.QuestionResponses, error) {
+	var answers []string
+	_ = answers[3]
+	return nil, nil
+}
+
+func (panicProvider) Explain(context.Context, config.QuestionRequest1) (*config.Explanation, error) {
+	return nil, nil
+}
+
+func (panicProvider) Translate(context.Context, config.QuestionRequest1, string) (*config.Translation, error) {
+	return nil, nil
+}
+
+func TestGenerateCachedRecoversPanic(t *testing.T) {
+	s := &AIServiceImpl{cache: newMemoryCache()}
+	s.current.Store(&providerSet{
+		clients:      map[string]provider{"fake": panicProvider{}},
+		settings:     map[string]modelSettings{"fake": {provider: "fake", timeout: time.Second}},
+		defaultModel: "fake",
+		cacheTTL:     time.Minute,
+	})
+
+	// singleflight 在新的 goroutine 中重新抛出 panic，未恢复时整个测试进程会退出
+	for i := 0; i < 2; i++ {
+		resp, err := s.GenerateQuestion(context.Background(), config.QuestionRequest{Keyword: "panic"})
+		if err == nil || resp != nil {
+			t.Fatalf("resp = %v, err = %v, want error", resp, err)
+		}
+		if !strings.Contains(err.Error(), "内部错误") {
+			t.Errorf("err = %v", err)
+		}
+	}
+	if n := len(s.cache.(*memoryCache).entries); n != 0 {
+		t.Errorf("cached %d entries, want none", n)
+	}
+}
@@ -4,22 +4,182 @@ import (
 	"Server/config"
 	"context"
 	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"Server/telemetry"
+
+	openai "github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/sync/singleflight"
 )
 
+// DefaultModel 旧版日志未记录模型时对应的AI服务
+const DefaultModel = "tongyi"
+
 type AIService interface {
 	GenerateQuestion(ctx context.Context, req config.QuestionRequest) (*config.QuestionResponses, error) 
+	ExplainQuestion(ctx context.Context, model string, q config.QuestionRequest1) (*config.Explanation, error)
+	TranslateQuestion(ctx context.Context, model string, q config.QuestionRequest1, locale string) (*config.Translation, error)
+	ResolveModel(model string) string
+	Providers() []string
+	Reload(cfg *config.AIConfig)
+}
+
+// provider 各AI服务客户端需实现的能力
+type provider interface {
+	Generate(ctx context.Context, req config.QuestionRequest) (*config.QuestionResponses, error)
+	Explain(ctx context.Context, q config.QuestionRequest1) (*config.Explanation, error)
+	Translate(ctx context.Context, q config.QuestionRequest1, locale string) (*config.Translation, error)
+}
+
+// providerSet 按一份配置创建的全部客户端。重新加载配置时整体替换，
+// 进行中的请求继续使用开始时取到的客户端，不受影响
+type providerSet struct {
+	clients      map[string]provider // 未配置API密钥的服务不在其中
+	settings     map[string]modelSettings
+	defaultModel string
+	cacheTTL     time.Duration
 }
 
 type AIServiceImpl struct {
-	deepseek *DeepSeekClient
-	tongyi   *TongyiClient
+	current  atomic.Pointer[providerSet]
+	cache    ResponseCache      // 为 nil 时不缓存出题结果
+	inflight singleflight.Group // 合并并发的相同出题请求
+}
+
+// modelSettings 调用模型时使用的参数
+type modelSettings struct {
+	provider    string // deepseek/tongyi，用于监控标签
+	model       string
+	timeout     time.Duration
+	temperature float32
+	maxTokens   int
+	prompt      config.PromptConfig
+
+	promptPrice     float64 // 每千token价格（元）
+	completionPrice float64
+}
+
+func newModelSettings(name string, p config.ProviderConfig, cfg *config.AIConfig) modelSettings {
+	return modelSettings{
+		provider:    name,
+		model:       p.Model,
+		timeout:     cfg.Timeout,
+		temperature: cfg.Temperature,
+		maxTokens:   cfg.MaxTokens,
+		prompt:      cfg.Prompt,
+
+		promptPrice:     p.PromptPrice,
+		completionPrice: p.CompletionPrice,
+	}
+}
+
+// usage 按配置的单价估算一次调用的费用
+func (m modelSettings) usage(u openai.Usage) *config.TokenUsage {
+	return &config.TokenUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		Cost:             (float64(u.PromptTokens)*m.promptPrice + float64(u.CompletionTokens)*m.completionPrice) / 1000,
+	}
+}
+
+// NewAIService 创建AI服务，cache 为 nil 时不缓存出题结果
+func NewAIService(cfg *config.AIConfig, cache ResponseCache) AIService {
+	s := &AIServiceImpl{cache: cache}
+	s.Reload(cfg)
+	return s
+}
+
+// Reload 按新配置重建客户端
+func (s *AIServiceImpl) Reload(cfg *config.AIConfig) {
+	set := &providerSet{
+		clients:      make(map[string]provider),
+		settings:     make(map[string]modelSettings),
+		defaultModel: cfg.DefaultModel,
+		cacheTTL:     cfg.Cache.TTL,
+	}
+	if cfg.DeepSeek.APIKey != "" {
+		set.settings["deepseek"] = newModelSettings("deepseek", cfg.DeepSeek, cfg)
+		set.clients["deepseek"] = NewDeepSeekClient(cfg.DeepSeek, set.settings["deepseek"])
+	}
+	if cfg.Tongyi.APIKey != "" {
+		set.settings["tongyi"] = newModelSettings("tongyi", cfg.Tongyi, cfg)
+		set.clients["tongyi"] = NewTongyiClient(cfg.Tongyi, set.settings["tongyi"])
+	}
+	s.current.Store(set)
+}
+
+// ResolveModel 未指定模型时返回配置的默认模型
+func (s *AIServiceImpl) ResolveModel(model string) string {
+	if model == "" {
+		return s.current.Load().defaultModel
+	}
+	return model
+}
+
+// Providers 已配置API密钥、可以调用的AI服务
+func (s *AIServiceImpl) Providers() []string {
+	set := s.current.Load()
+	names := make([]string, 0, len(set.clients))
+	for name := range set.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func NewAIService(cfg *config.AIConfig) AIService {
-	return &AIServiceImpl{
-		deepseek: NewDeepSeekClient(cfg.DeepSeekKey, cfg.Timeout),
-		tongyi:   NewTongyiClient(cfg.TongyiKey, cfg.Timeout),
+func (s *AIServiceImpl) provider(model string) (string, provider, error) {
+	set := s.current.Load()
+	if model == "" {
+		model = set.defaultModel
 	}
+	p, ok := set.clients[model]
+	if !ok {
+		if model == "deepseek" || model == "tongyi" {
+			return model, nil, fmt.Errorf("AI模型 %s 未配置API密钥", model)
+		}
+		return model, nil, errors.New("不支持的AI模型")
+	}
+	return model, p, nil
+}
+
+// observe 为一次AI调用创建span并记录耗时、失败原因
+func (s *AIServiceImpl) observe(ctx context.Context, model, operation string, call func(ctx context.Context, p provider) error) error {
+	name, p, err := s.provider(model)
+	ctx, span := telemetry.Start(ctx, "ai."+operation,
+		attribute.String("ai.provider", name),
+		attribute.String("ai.operation", operation))
+	defer span.End()
+
+	if err != nil {
+		telemetry.ObserveAI(name, operation, 0, "config")
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	start := time.Now()
+	err = call(ctx, p)
+	if err == nil {
+		telemetry.ObserveAI(name, operation, time.Since(start), "")
+		return nil
+	}
+
+	reason := failureReason(err)
+	telemetry.ObserveAI(name, operation, time.Since(start), reason)
+	var validation *ValidationError
+	if errors.As(err, &validation) {
+		telemetry.AIValidationFailure(name, operation, validation.Reason)
+		span.SetAttributes(attribute.String("ai.validation_reason", validation.Reason))
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, reason)
+	return err
 }
 
 func (s *AIServiceImpl) GenerateQuestion(ctx context.Context, req config.QuestionRequest) (*config.QuestionResponses, error) {
@@ -32,14 +192,83 @@ func (s *AIServiceImpl) GenerateQuestion(ctx context.Context, req config.Questio
 	if req.Count == 0 {
 		req.Count = 3        
 	}
-	switch req.Model {
-	case "deepseek":
-		return s.deepseek.Generate(ctx, req)
-	case "tongyi":
-		return s.tongyi.Generate(ctx, req)
-	case "": 
-		return s.tongyi.Generate(ctx, req)
-	default:
-		return nil, errors.New("不支持的AI模型")
-	}
-}
\ No newline at end of file
+
+	// 未启用缓存或请求要求跳过缓存时直接调用AI
+	if s.cache == nil {
+		return s.generate(ctx, req)
+	}
+	if req.Cache == CacheBypass {
+		resp, err := s.generate(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return withCacheStatus(resp, CacheBypass), nil
+	}
+	return s.generateCached(ctx, s.current.Load(), req)
+}
+
+func (s *AIServiceImpl) generate(ctx context.Context, req config.QuestionRequest) (*config.QuestionResponses, error) {
+	var resp *config.QuestionResponses
+	err := s.observe(ctx, req.Model, "generate", func(ctx context.Context, p provider) (err error) {
+		resp, err = p.Generate(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// ExplainQuestion 为已有题目生成解析、提示与参考链接
+func (s *AIServiceImpl) ExplainQuestion(ctx context.Context, model string, q config.QuestionRequest1) (*config.Explanation, error) {
+	var exp *config.Explanation
+	err := s.observe(ctx, model, "explain", func(ctx context.Context, p provider) (err error) {
+		exp, err = p.Explain(ctx, q)
+		return err
+	})
+	return exp, err
+}
+
+// TranslateQuestion 将题目翻译为目标语言，代码片段与选项前缀保持不变
+func (s *AIServiceImpl) TranslateQuestion(ctx context.Context, model string, q config.QuestionRequest1, locale string) (*config.Translation, error) {
+	var tr *config.Translation
+	err := s.observe(ctx, model, "translate", func(ctx context.Context, p provider) (err error) {
+		tr, err = p.Translate(ctx, q, locale)
+		return err
+	})
+	return tr, err
+}
+
+// newOpenAIClient 创建兼容OpenAI接口的客户端
+func newOpenAIClient(p config.ProviderConfig) *openai.Client {
+	cfg := openai.DefaultConfig(p.APIKey)
+	cfg.BaseURL = p.Endpoint
+	cfg.HTTPClient = telemetry.HTTPClient()
+	return openai.NewClientWithConfig(cfg)
+}
+
+// systemPrompt 配置了自定义system提示词时优先使用
+func (m modelSettings) systemPrompt(fallback string) string {
+	if m.prompt.System != "" {
+		return m.prompt.System
+	}
+	return fallback
+}
+
+// appendExtraRules 将配置中的附加规则接在"必须遵守"列表之后，编号从next开始
+func appendExtraRules(prompt string, rules []string, next int) string {
+	var builder strings.Builder
+	builder.WriteString(prompt)
+	for i, rule := range rules {
+		builder.WriteString(fmt.Sprintf("%d. %s\n", next+i, rule))
+	}
+	return builder.String()
+}
+
+// normalizeExplanations 解析数量与选项数量不一致时丢弃解析（可通过补写解析接口重新生成）
+func normalizeExplanations(items []config.QuestionResponse) {
+	for i := range items {
+		if len(items[i].Explanations) > 0 && len(items[i].Explanations) != len(items[i].Answers) {
+			log.Printf("[EXPLANATION_WARN] 题目「%s」解析数量(%d)与选项数量(%d)不一致，已丢弃",
+				items[i].Title, len(items[i].Explanations), len(items[i].Answers))
+			items[i].Explanations = nil
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"go/scanner"
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 支持查重的代码语言
+const (
+	CodeGo     = "go"
+	CodePython = "python"
+)
+
+// 归一化后的标记：标识符、字面量不区分具体内容，改名、改常量不影响比对
+const (
+	codeIdent  = "ID"
+	codeNumber = "NUM"
+	codeString = "STR"
+	codeIndent = "INDENT"
+	codeDedent = "DEDENT"
+)
+
+// codeToken 归一化后的标记及其在源码中的行号
+type codeToken struct {
+	Kind string
+	Line int
+}
+
+// NormalizeCodeLanguage 统一语言名称，只支持 Go 与 Python
+func NormalizeCodeLanguage(lang string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(lang)) {
+	case "go", "golang":
+		return CodeGo, nil
+	case "python", "py", "python3":
+		return CodePython, nil
+	}
+	return "", serviceError(ErrInvalid, "代码查重只支持 Go 与 Python，不支持 %q", lang)
+}
+
+// tokenizeCode 按语言切分代码，忽略注释、空白与分号，标识符与字面量归一化
+func tokenizeCode(lang, src string) []codeToken {
+	if lang == CodePython {
+		return tokenizePython(src)
+	}
+	return tokenizeGo(src)
+}
+
+// tokenizeGo 使用标准库的词法分析器，语法错误不影响切分
+func tokenizeGo(src string) []codeToken {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, 0)
+
+	var tokens []codeToken
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		kind := tok.String()
+		switch tok {
+		case token.SEMICOLON:
+			// 包括换行处自动插入的分号，代码排版不影响结果
+			continue
+		case token.IDENT:
+			kind = codeIdent
+		case token.INT, token.FLOAT, token.IMAG:
+			kind = codeNumber
+		case token.STRING, token.CHAR:
+			kind = codeString
+		}
+		tokens = append(tokens, codeToken{Kind: kind, Line: file.Line(pos)})
+	}
+	return tokens
+}
+
+var pythonKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true, "async": true,
+	"await": true, "break": true, "class": true, "continue": true, "def": true, "del": true, "elif": true,
+	"else": true, "except": true, "finally": true, "for": true, "from": true, "global": true, "if": true,
+	"import": true, "in": true, "is": true, "lambda": true, "nonlocal": true, "not": true, "or": true,
+	"pass": true, "raise": true, "return": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+// 按长度从长到短排列，优先匹配最长的运算符
+var pythonOperators = []string{
+	"**=", "//=", ">>=", "<<=", "...",
+	"->", ":=", "**", "//", "<<", ">>", "<=", ">=", "==", "!=",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "@=",
+}
+
+// tokenizePython 简单的 Python 词法分析：缩进变化记为 INDENT/DEDENT（缩进宽度不影响结果），
+// 括号内的换行与续行符不产生标记
+func tokenizePython(src string) []codeToken {
+	var (
+		tokens  []codeToken
+		indents = []int{0}
+		line    = 1
+		depth   = 0 // 括号嵌套层数
+		start   = true
+	)
+	emit := func(kind string, at int) { tokens = append(tokens, codeToken{Kind: kind, Line: at}) }
+
+	for i := 0; i < len(src); {
+		// 逻辑行开头：计算缩进，空行与纯注释行不影响缩进
+		if start && depth == 0 {
+			width, j := 0, i
+			for j < len(src) && (src[j] == ' ' || src[j] == '\t' || src[j] == '\f') {
+				if src[j] == '\t' {
+					width = width/8*8 + 8
+				} else if src[j] == ' ' {
+					width++
+				}
+				j++
+			}
+			i, start = j, false
+			if i >= len(src) || src[i] == '\n' || src[i] == '\r' || src[i] == '#' {
+				continue
+			}
+			if width > indents[len(indents)-1] {
+				indents = append(indents, width)
+				emit(codeIndent, line)
+			}
+			for width < indents[len(indents)-1] {
+				indents = indents[:len(indents)-1]
+				emit(codeDedent, line)
+			}
+			continue
+		}
+
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+			start = depth == 0
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '\\' && i+1 < len(src) && (src[i+1] == '\n' || src[i+1] == '\r'):
+			// 续行符：下一行接在当前逻辑行后面
+			i++
+			if src[i] == '\r' && i+1 < len(src) && src[i+1] == '\n' {
+				i++
+			}
+			i++
+			line++
+		case c == '"' || c == '\'':
+			at := line
+			i, line = skipPythonString(src, i, line)
+			emit(codeString, at)
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			i = skipPythonNumber(src, i)
+			emit(codeNumber, line)
+		case c == '_' || c >= utf8.RuneSelf || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(src) {
+				r, size := utf8.DecodeRuneInString(src[j:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			if j == i {
+				// 无法识别的非 ASCII 字符
+				_, size := utf8.DecodeRuneInString(src[i:])
+				i += size
+				continue
+			}
+			word := src[i:j]
+			// 带前缀的字符串，如 f"..."、rb'...'
+			if j < len(src) && (src[j] == '"' || src[j] == '\'') && len(word) <= 2 && strings.Trim(strings.ToLower(word), "rbuf") == "" {
+				at := line
+				i, line = skipPythonString(src, j, line)
+				emit(codeString, at)
+				continue
+			}
+			i = j
+			if pythonKeywords[word] {
+				emit(word, line)
+			} else {
+				emit(codeIdent, line)
+			}
+		default:
+			op := string(c)
+			for _, candidate := range pythonOperators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			switch op {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				if depth > 0 {
+					depth--
+				}
+			}
+			i += len(op)
+			emit(op, line)
+		}
+	}
+	for len(indents) > 1 {
+		indents = indents[:len(indents)-1]
+		emit(codeDedent, line)
+	}
+	return tokens
+}
+
+// skipPythonString 跳过从 i 开始的字符串（含三引号字符串），返回结束位置与结束时的行号
+func skipPythonString(src string, i, line int) (int, int) {
+	quote := src[i : i+1]
+	if strings.HasPrefix(src[i:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	i += len(quote)
+	for i < len(src) {
+		switch {
+		case src[i] == '\\':
+			if i+1 < len(src) && src[i+1] == '\n' {
+				line++
+			}
+			i += 2
+		case strings.HasPrefix(src[i:], quote):
+			return i + len(quote), line
+		case src[i] == '\n':
+			if len(quote) == 1 {
+				// 未闭合的单行字符串到行尾结束
+				return i, line
+			}
+			line++
+			i++
+		default:
+			i++
+		}
+	}
+	return len(src), line
+}
+
+// skipPythonNumber 跳过数字字面量（含十六进制、下划线分隔、小数、指数与复数后缀）
+func skipPythonNumber(src string, i int) int {
+	hex := strings.HasPrefix(strings.ToLower(src[i:]), "0x")
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '.':
+			i++
+		case (c == '+' || c == '-') && (src[i-1] == 'e' || src[i-1] == 'E') && !hex:
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
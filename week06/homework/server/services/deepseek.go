@@ -3,31 +3,24 @@ package services
 import (
 	"Server/config"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"sort"
 	"strings"
-	"time"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
-const deepseekEndpoint = "https://ai.forestsx.top/v1"
-
 type DeepSeekClient struct {
-	client  *openai.Client
-	timeout time.Duration
+	client   *openai.Client
+	settings modelSettings
 }
 
-func NewDeepSeekClient(apiKey string, timeout time.Duration) *DeepSeekClient {
-	config := openai.DefaultConfig(apiKey)
-	config.BaseURL = deepseekEndpoint
-
+func NewDeepSeekClient(p config.ProviderConfig, settings modelSettings) *DeepSeekClient {
 	return &DeepSeekClient{
-		client:  openai.NewClientWithConfig(config),
-		timeout: timeout,
+		client:   newOpenAIClient(p),
+		settings: settings,
 	}
 }
 
@@ -59,7 +52,15 @@ func buildDeepseekPrompt(req config.QuestionRequest) string {
 					"C: WaitGroup的Add()必须在goroutine外调用",
 					"D: map的并发读写需要加锁"
 				],
-				"rights": ["D"]  //有且仅有一个正确答案
+				"rights": ["D"],  //有且仅有一个正确答案
+				"explanations": [
+					"A错误：channel可以传递任意类型，包括结构体、指针和函数",
+					"B错误：读多写少场景更适合使用sync.RWMutex",
+					"C错误：Add()通常在启动goroutine前调用以避免竞态，但并非语法强制要求",
+					"D正确：map不是并发安全的，并发读写会触发fatal error，需要加锁或使用sync.Map"
+				],
+				"hint": "想一想哪些内置类型不是并发安全的",
+				"reference": "https://go.dev/ref/mem"
 			},
 			{
                 "title": "Go语言切片行为相关说法",
@@ -127,35 +128,37 @@ func buildDeepseekPrompt(req config.QuestionRequest) string {
 	builder.WriteString("4. 选项前缀严格按顺序生成\n")
 	builder.WriteString("5. 保证题目和选项不重复\n")
 	builder.WriteString("6. 生成题目title必须是提问句,以？结尾\n")
+	builder.WriteString("7. 每道题必须包含explanations数组，与answers一一对应，逐条说明该选项正确或错误的原因（answers为null时explanations也设为null）\n")
+	builder.WriteString("8. 每道题必须包含hint（不超过30字的提示，不得直接透露答案）和reference（官方文档等参考链接，没有合适链接时填空字符串）\n")
+	builder.WriteString("9. title、answers、explanations、hint均使用Markdown格式：行内代码用`包裹，多行代码放入标注语言的```代码块（如\"A: \\n```go\\nfunc f() {}\\n```\"），代码块必须成对闭合\n")
 
 	return builder.String()
 }
 
 func parseDeepseekResponse(content string, req config.QuestionRequest) (*config.QuestionResponses, error) {
-	// 预处理：去除可能存在的杂项
-	content = strings.TrimSpace(content)
-	if !strings.HasPrefix(content, "[") || !strings.HasSuffix(content, "]") {
-		return nil, fmt.Errorf("响应内容不是有效的JSON数组")
-	}
-
-	var items []config.QuestionResponse
-	if err := json.Unmarshal([]byte(content), &items); err != nil {
-		fmt.Printf("[DEBUG] 原始错误响应内容: %s\n", content)
-		return nil, fmt.Errorf("响应解析失败: %w", err)
+	// 预处理：去除代码块标记、注释与多余的逗号，取出包装对象中的题目数组
+	items, repairs, err := extractQuestions(content)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(items) != req.Count {
-		return nil, fmt.Errorf("题目数量错误，预期 %d 道，实际 %d 道", req.Count, len(items))
+	if err := checkQuestionCount(items, req.Count, repairs); err != nil {
+		return nil, err
 	}
 
 	switch req.Type {
 	case config.SingleSelect, config.MultiSelect:
 		for _, question := range items {
+			// 验证选项数量，answers 缺失或不足4个时不能逐个检查前缀
+			if len(question.Answers) != 4 {
+				return nil, invalid("option_count", "选项数量错误，预期 4 个，实际 %d 个", len(question.Answers))
+			}
+
 			// 验证选项前缀
 			for i := 0; i < 4; i++ {
 				expected := fmt.Sprintf("%s:", string(rune('A'+i)))
 				if !strings.HasPrefix(question.Answers[i], expected) {
-					return nil, fmt.Errorf("选项 %d 前缀错误，应以 '%s' 开头", i+1, expected)
+					return nil, invalid("option_prefix", "选项 %d 前缀错误，应以 '%s' 开头", i+1, expected)
 				}
 			}
 
@@ -163,7 +166,7 @@ func parseDeepseekResponse(content string, req config.QuestionRequest) (*config.
 			seen := make(map[string]bool)
 			for _, r := range question.Rights {
 				if seen[r] {
-					return nil, fmt.Errorf("答案重复：%s", r)
+					return nil, invalid("duplicate_answer", "答案重复：%s", r)
 				}
 				seen[r] = true
 			}
@@ -173,20 +176,26 @@ func parseDeepseekResponse(content string, req config.QuestionRequest) (*config.
 				copy(sorted, question.Rights)
 				sort.Strings(sorted)
 				if !reflect.DeepEqual(sorted, question.Rights) {
-					return nil, fmt.Errorf("答案必须按字母顺序排列，当前顺序：%v", question.Rights)
+					return nil, invalid("answer_order", "答案必须按字母顺序排列，当前顺序：%v", question.Rights)
 				}
 			}
 		}
 	default:
 	}
 
+	normalizeExplanations(items)
+	if err := validateResponseMarkdown(items); err != nil {
+		return nil, err
+	}
+
 	return &config.QuestionResponses{
 		Questions: items,
+		Repairs:   repairs.notes,
 	}, nil
 }
 
 func (c *DeepSeekClient) Generate(ctx context.Context, req config.QuestionRequest) (*config.QuestionResponses, error) {
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	ctx, cancel := context.WithTimeout(ctx, c.settings.timeout)
 	defer cancel()
 
 	if req.Keyword == "" {
@@ -199,14 +208,14 @@ func (c *DeepSeekClient) Generate(ctx context.Context, req config.QuestionReques
 		return nil, errors.New("单次生成题目数量不能超过10道")
 	}
 
-	prompt := buildDeepseekPrompt(req)
+	prompt := appendExtraRules(buildDeepseekPrompt(req), c.settings.prompt.ExtraRules, 10)
 
 	request := openai.ChatCompletionRequest{
-		Model: "deepseek-chat",
+		Model: c.settings.model,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleSystem,
-				Content: "你是一个非常专业的编程题库生成助手，严格遵循用户的格式要求",
+				Content: c.settings.systemPrompt("你是一个非常专业的编程题库生成助手，严格遵循用户的格式要求"),
 			},
 			{
 				Role:    openai.ChatMessageRoleUser,
@@ -214,35 +223,23 @@ func (c *DeepSeekClient) Generate(ctx context.Context, req config.QuestionReques
 			},
 		},
 		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: "json_object"},
-		Temperature:    0.3,
-		MaxTokens:      2000,
-	}
-
-	maxRetries := 3
-	var resp openai.ChatCompletionResponse
-	var err error
-
-	for i := 0; i < maxRetries; i++ {
-		resp, err = c.client.CreateChatCompletion(ctx, request)
-		if err == nil {
-			break
-		}
-
-		if isRetriableError(err) {
-			wait := time.Duration(i+1) * 2 * time.Second
-			fmt.Printf("[DEEPSEEK_WARN] 请求失败，%s后重试... 错误：%v\n", wait, err)
-			time.Sleep(wait)
-			continue
-		}
-		break
+		Temperature:    c.settings.temperature,
+		MaxTokens:      c.settings.maxTokens,
 	}
 
+	resp, err := createWithRetry(ctx, c.client, c.settings, "generate", request)
 	if err != nil {
-		return nil, fmt.Errorf("API请求失败（尝试%d次）：%w", maxRetries, err)
+		return nil, err
 	}
 
 	rawResponse := resp.Choices[0].Message.Content
-	return parseDeepseekResponse(rawResponse, req)
+	result, err := parseDeepseekResponse(rawResponse, req)
+	if err != nil {
+		return nil, err
+	}
+	logRepairs(c.settings.model, "generate", result.Repairs)
+	result.Usage = c.settings.usage(resp.Usage)
+	return result, nil
 }
 
 func getQuestionTypeText(t int) string {
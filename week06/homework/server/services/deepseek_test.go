@@ -0,0 +1,48 @@
+package services
+
+import (
+	"Server/config"
+	"errors"
+	"testing"
+)
+
+func TestParseDeepseekResponse(t *testing.T) {
+	content := "```json\n" + `[{"title":"a？","answers":["A: 1","B: 2","C: 3","D: 4"],"rights":["A","C"]}]` + "\n```"
+	resp, err := parseDeepseekResponse(content, config.QuestionRequest{Type: config.MultiSelect, Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Questions) != 1 || len(resp.Questions[0].Answers) != 4 {
+		t.Errorf("questions = %+v", resp.Questions)
+	}
+}
+
+func TestParseDeepseekResponseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     int
+		content string
+		reason  string
+	}{
+		// 选项不足或缺失时曾经越界 panic
+		{"short answers", config.SingleSelect, `[{"title":"a？","answers":["A: 1","B: 2","C: 3"],"rights":["A"]}]`, "option_count"},
+		{"null answers", config.SingleSelect, `[{"title":"a？","answers":null,"rights":["A"]}]`, "option_count"},
+		{"missing answers", config.MultiSelect, `{"title":"a？","rights":["A"]}`, "option_count"},
+		{"too many answers", config.SingleSelect, `[{"title":"a？","answers":["A: 1","B: 2","C: 3","D: 4","E: 5"],"rights":["A"]}]`, "option_count"},
+		{"prefix", config.SingleSelect, `[{"title":"a？","answers":["A: 1","B: 2","D: 3","C: 4"],"rights":["A"]}]`, "option_prefix"},
+		{"duplicate answer", config.MultiSelect, `[{"title":"a？","answers":["A: 1","B: 2","C: 3","D: 4"],"rights":["A","A"]}]`, "duplicate_answer"},
+		{"answer order", config.MultiSelect, `[{"title":"a？","answers":["A: 1","B: 2","C: 3","D: 4"],"rights":["C","A"]}]`, "answer_order"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDeepseekResponse(tt.content, config.QuestionRequest{Type: tt.typ, Count: 1})
+			var validation *ValidationError
+			if !errors.As(err, &validation) {
+				t.Fatalf("err = %v, want ValidationError", err)
+			}
+			if validation.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q (%v)", validation.Reason, tt.reason, err)
+			}
+		})
+	}
+}
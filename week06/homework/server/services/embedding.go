@@ -0,0 +1,137 @@
+package services
+
+import (
+	"Server/config"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Embedder 把文本转换为向量，Model 写入索引，变化时全部重新计算
+type Embedder interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder 按配置创建向量计算方式
+func NewEmbedder(cfg config.EmbeddingConfig) Embedder {
+	if cfg.Provider == "local" {
+		return &HashingEmbedder{dim: cfg.Dimensions}
+	}
+	return &openAIEmbedder{
+		client: newOpenAIClient(config.ProviderConfig{Endpoint: cfg.Endpoint, APIKey: cfg.APIKey}),
+		name:   cfg.Provider,
+		model:  cfg.Model,
+	}
+}
+
+// HashingEmbedder 本地向量：词项哈希到固定维度，值为对数词频，IDF 在索引中按全部题目计算。
+// 英文与代码按单词切分，中文按相邻两个字切分，不需要网络与分词词典
+type HashingEmbedder struct {
+	dim int
+}
+
+func (e *HashingEmbedder) Model() string {
+	return fmt.Sprintf("local:hash-tf:%d", e.dim)
+}
+
+func (e *HashingEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		counts := make(map[string]int)
+		for _, term := range textTerms(text) {
+			counts[term]++
+		}
+		vec := make([]float32, e.dim)
+		for term, n := range counts {
+			h := fnv.New32a()
+			h.Write([]byte(term))
+			sum := h.Sum32()
+			// 用哈希的最高位决定符号，不同词项落到同一维时相互抵消而不是累加
+			weight := float32(1 + math.Log(float64(n)))
+			if sum>>31 == 1 {
+				weight = -weight
+			}
+			vec[int(sum&0x7fffffff)%e.dim] += weight
+		}
+		vectors[i] = vec
+	}
+	return vectors, nil
+}
+
+// textTerms 切分词项：连续的字母数字下划线为一个词（至少两个字符，转小写），汉字取相邻两字，单个汉字单独成词
+func textTerms(text string) []string {
+	var terms []string
+	var word []rune
+	var han []rune
+	flushWord := func() {
+		if len(word) >= 2 {
+			terms = append(terms, string(word))
+		}
+		word = word[:0]
+	}
+	flushHan := func() {
+		if len(han) == 1 {
+			terms = append(terms, string(han))
+		}
+		for i := 0; i+1 < len(han); i++ {
+			terms = append(terms, string(han[i:i+2]))
+		}
+		han = han[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return terms
+}
+
+// openAIEmbedder 兼容 OpenAI 的 embeddings 接口（通义千问兼容模式、OpenAI 等）
+type openAIEmbedder struct {
+	client *openai.Client
+	name   string
+	model  string
+}
+
+func (e *openAIEmbedder) Model() string {
+	return e.name + ":" + e.model
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input:          texts,
+		Model:          openai.EmbeddingModel(e.model),
+		EncodingFormat: openai.EmbeddingEncodingFormatFloat,
+	})
+	if err != nil {
+		return nil, serviceError(ErrUpstream, "计算向量失败: %v", err)
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index >= 0 && d.Index < len(vectors) {
+			vectors[d.Index] = d.Embedding
+		}
+	}
+	for i, v := range vectors {
+		if len(v) == 0 {
+			return nil, serviceError(ErrUpstream, "向量接口没有返回第 %d 条结果", i+1)
+		}
+	}
+	return vectors, nil
+}
@@ -0,0 +1,414 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"Server/telemetry"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	eventPollInterval   = time.Second // 没有新事件通知时检查到期重试的间隔
+	eventBatchSize      = 100         // 每轮分发的事件数
+	deliveryBatchSize   = 20          // 每轮投递的记录数
+	deliveryConcurrency = 4           // 同时进行的投递请求数
+	subscriberBuffer    = 64          // SSE订阅者的缓冲事件数，写满时断开，客户端重连后从库中补发
+	maxResponseLog      = 512         // 投递日志保存的响应体长度
+)
+
+// EventBus 分发题库事件：从 events 表读取新事件，推送给SSE订阅者，
+// 并为订阅的Webhook创建投递记录，按指数退避重试直到成功或次数用尽
+type EventBus struct {
+	db     *storage.Database
+	cfg    config.EventsConfig
+	client *http.Client
+	wake   chan struct{}
+
+	mu          sync.Mutex
+	subscribers map[*EventSubscriber]struct{}
+}
+
+// EventSubscriber 一个SSE连接的订阅，Events 关闭表示订阅被断开（缓冲写满）
+type EventSubscriber struct {
+	events      chan storage.Event
+	workspaceID int
+	types       []string
+}
+
+// Events 推送给该订阅者的事件
+func (s *EventSubscriber) Events() <-chan storage.Event {
+	return s.events
+}
+
+func NewEventBus(db *storage.Database, cfg config.EventsConfig) *EventBus {
+	return &EventBus{
+		db:          db,
+		cfg:         cfg,
+		client:      newWebhookClient(cfg),
+		wake:        make(chan struct{}, 1),
+		subscribers: make(map[*EventSubscriber]struct{}),
+	}
+}
+
+// newWebhookClient 投递用的HTTP客户端：不跟随重定向、不使用代理，
+// 连接前检查实际连接的地址，不能访问本机、内网与链路本地地址（除非配置允许）
+func newWebhookClient(cfg config.EventsConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.WebhookTimeout}
+	if !cfg.AllowPrivateTargets {
+		dialer.Control = webhookDialControl
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // 经过代理时检查的是代理的地址
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   cfg.WebhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse // 3xx 作为投递失败记录，不访问重定向的地址
+		},
+	}
+}
+
+// errPrivateTarget Webhook 地址指向不允许访问的地址
+var errPrivateTarget = errors.New("Webhook 地址不能指向本机、内网或链路本地地址")
+
+// blockedIP 本机、内网、链路本地（含云服务器元数据地址）、组播与未指定地址
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// webhookDialControl 在建立连接前检查解析后的地址，域名解析到内网地址时同样拒绝
+func webhookDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+		return fmt.Errorf("%w: %s", errPrivateTarget, host)
+	}
+	return nil
+}
+
+// CheckWebhookURL 注册或修改 Webhook 时检查地址：IP 或解析后的地址不能是本机、内网等地址。
+// 解析失败时不拒绝，投递连接前还会再检查
+func (b *EventBus) CheckWebhookURL(ctx context.Context, rawURL string) error {
+	if b.cfg.AllowPrivateTargets {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if blockedIP(ip) {
+			return errPrivateTarget
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if blockedIP(addr.IP) {
+			return fmt.Errorf("%w（%s 解析为 %s）", errPrivateTarget, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// Notify 有新事件写入或投递被重置时唤醒分发，不阻塞
+func (b *EventBus) Notify() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Subscribe 订阅工作区的事件，types 为空表示全部，支持 question.* 通配
+func (b *EventBus) Subscribe(workspaceID int, types []string) *EventSubscriber {
+	sub := &EventSubscriber{events: make(chan storage.Event, subscriberBuffer), workspaceID: workspaceID, types: types}
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe 取消订阅
+func (b *EventBus) Unsubscribe(sub *EventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// broadcast 推送给匹配的订阅者，处理不过来的订阅者直接断开，避免拖慢分发
+func (b *EventBus) broadcast(ev storage.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		if sub.workspaceID != ev.WorkspaceID || !MatchEventType(sub.types, ev.Type) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Run 分发循环，直到 ctx 取消；由 lifecycle.Manager 作为后台任务启动
+func (b *EventBus) Run(ctx context.Context) {
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		b.dispatch(ctx)
+		b.deliver(ctx)
+		if time.Since(lastPrune) > time.Hour {
+			b.prune(ctx)
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch 将新事件推送给SSE订阅者，并为订阅的Webhook创建投递记录
+func (b *EventBus) dispatch(ctx context.Context) {
+	db := b.db.WithContext(ctx)
+	for ctx.Err() == nil {
+		events, err := db.UndispatchedEvents(eventBatchSize)
+		if err != nil {
+			log.Printf("[EVENTS] 读取事件失败: %v", err)
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+		hooks, err := db.ListWebhooks(0, true)
+		if err != nil {
+			log.Printf("[EVENTS] 读取Webhook失败: %v", err)
+			return
+		}
+
+		for _, ev := range events {
+			var targets []int
+			for _, hook := range hooks {
+				if hook.WorkspaceID == ev.WorkspaceID && MatchEventType(hook.Events, ev.Type) {
+					targets = append(targets, hook.ID)
+				}
+			}
+			if err := db.DispatchEvent(ev.ID, targets, time.Now()); err != nil {
+				log.Printf("[EVENTS] 分发事件#%d 失败: %v", ev.ID, err)
+				return
+			}
+			b.broadcast(ev)
+		}
+	}
+}
+
+// deliver 并发投递到期的记录，等本轮全部结束后再领取下一批，避免同一记录重复投递
+func (b *EventBus) deliver(ctx context.Context) {
+	db := b.db.WithContext(ctx)
+	for ctx.Err() == nil {
+		due, err := db.DueDeliveries(time.Now(), deliveryBatchSize)
+		if err != nil {
+			log.Printf("[EVENTS] 读取待投递记录失败: %v", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+
+		sem := make(chan struct{}, deliveryConcurrency)
+		var wg sync.WaitGroup
+		for _, d := range due {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(d storage.PendingDelivery) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				b.attempt(ctx, d)
+			}(d)
+		}
+		wg.Wait()
+	}
+}
+
+// attempt 投递一次并记录结果；服务退出导致的中断不计入次数，重启后继续投递
+func (b *EventBus) attempt(ctx context.Context, d storage.PendingDelivery) {
+	result := b.post(ctx, d.URL, d.Secret, d.ID, d.Event)
+	if ctx.Err() != nil {
+		return
+	}
+	result.Attempt = d.Attempts + 1
+
+	status, next := storage.DeliverySuccess, time.Now()
+	outcome := "success"
+	if result.Error != "" {
+		status, next = storage.DeliveryPending, time.Now().Add(b.retryDelay(result.Attempt))
+		outcome = "retry"
+		if result.Attempt >= b.cfg.MaxAttempts {
+			status = storage.DeliveryFailed
+			outcome = "failed"
+			log.Printf("[EVENTS] Webhook#%d 投递#%d（事件#%d）在 %d 次尝试后失败: %s",
+				d.WebhookID, d.ID, d.Event.ID, result.Attempt, result.Error)
+		}
+	}
+	telemetry.WebhookDelivery(outcome)
+	if err := b.db.WithContext(ctx).RecordDeliveryAttempt(d.ID, result, status, next); err != nil {
+		log.Printf("[EVENTS] 记录投递#%d 结果失败: %v", d.ID, err)
+	}
+}
+
+// retryDelay 第 attempt 次失败后的等待时间
+func (b *EventBus) retryDelay(attempt int) time.Duration {
+	return retryDelay(b.cfg, attempt)
+}
+
+// retryDelay 第 attempt 次失败后的等待时间：retry_base 起每次翻倍，不超过 retry_max，附加最多10%的随机抖动。
+// Webhook投递与 LTI 成绩回传共用
+func retryDelay(cfg config.EventsConfig, attempt int) time.Duration {
+	delay := cfg.RetryBase
+	for i := 1; i < attempt && delay < cfg.RetryMax; i++ {
+		delay *= 2
+	}
+	if delay > cfg.RetryMax {
+		delay = cfg.RetryMax
+	}
+	return delay + time.Duration(mathrand.Int63n(int64(delay)/10+1))
+}
+
+// post 发送一次签名的投递请求，2xx 视为成功，其余记录错误
+func (b *EventBus) post(ctx context.Context, url, secret string, deliveryID int64, ev storage.Event) storage.WebhookAttempt {
+	start := time.Now()
+	result := storage.WebhookAttempt{AttemptedAt: start.Format("2006-01-02 15:04:05")}
+	defer func() { result.DurationMs = time.Since(start).Milliseconds() }()
+
+	body, _ := json.Marshal(ev)
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "question-service-webhook/1.0")
+	req.Header.Set("X-Webhook-Event", ev.Type)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhook(secret, timestamp, body))
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseLog))
+	result.StatusCode = resp.StatusCode
+	result.Response = strings.ToValidUTF8(string(snippet), "")
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+	return result
+}
+
+// Ping 立即向Webhook发送一个 ping 事件（不入库、不重试），用于验证地址与签名
+func (b *EventBus) Ping(ctx context.Context, hook *storage.Webhook) storage.WebhookAttempt {
+	ev := storage.NewEvent(hook.WorkspaceID, "ping", nil, map[string]interface{}{"webhook_id": hook.ID})
+	ev.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+	result := b.post(ctx, hook.URL, hook.Secret, 0, ev)
+	result.Attempt = 1
+	return result
+}
+
+// prune 清理超过保留时间的事件与投递记录
+func (b *EventBus) prune(ctx context.Context) {
+	n, err := b.db.WithContext(ctx).PruneEvents(time.Now().Add(-b.cfg.Retention))
+	if err != nil {
+		log.Printf("[EVENTS] %v", err)
+	} else if n > 0 {
+		log.Printf("[EVENTS] 已清理 %d 个过期事件", n)
+	}
+}
+
+// SignWebhook 计算签名：HMAC-SHA256(secret, timestamp + "." + body)，格式为 sha256=<hex>
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewWebhookSecret 生成随机签名密钥
+func NewWebhookSecret() string {
+	buf := make([]byte, 24)
+	_, _ = rand.Read(buf)
+	return "whsec_" + hex.EncodeToString(buf)
+}
+
+// MatchEventType 判断事件类型是否在订阅列表中，列表为空或含 * 表示全部，question.* 匹配同一前缀
+func MatchEventType(patterns []string, typ string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if p == "*" || p == typ {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok && strings.HasPrefix(typ, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidEventPattern 订阅项必须是已知事件类型、* 或某个已知类型前缀加 *（如 question.*）
+func ValidEventPattern(p string) bool {
+	if p == "*" {
+		return true
+	}
+	for _, typ := range storage.EventTypes {
+		if p == typ {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok && strings.HasPrefix(typ, prefix) {
+			return true
+		}
+	}
+	return false
+}
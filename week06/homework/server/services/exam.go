@@ -0,0 +1,302 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // 注册 image.Decode 使用的解码器
+	_ "image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 最多生成的试卷份数（A-D卷）
+const MaxExamVariants = 4
+
+// ExamOptions 组卷参数
+type ExamOptions struct {
+	Title     string
+	Course    string
+	Date      string
+	Duration  int   // 考试时长（分钟），0表示不显示
+	Variants  int   // 试卷份数，多于一份时B卷起打乱题目与选项顺序
+	Shuffle   bool  // A卷也打乱顺序
+	AnswerKey bool  // 在试卷末尾附参考答案
+	Seed      int64 // 打乱顺序使用的随机种子，相同种子得到相同试卷
+
+	PaperQuestions [][]storage.Question // 每份试卷各自的题目（由模板生成的实例），与公共题目一起按题型分组
+}
+
+// ExamPaper 排版前的一份试卷
+type ExamPaper struct {
+	Title     string
+	Course    string
+	Date      string
+	Duration  int
+	Variant   string // A/B/C/D，只有一份试卷时为空
+	AnswerKey bool
+	Sections  []ExamSection
+	Images    map[string]*ExamImage // 题目引用的附件图片，由 LoadImages 读取
+}
+
+// ExamSection 按题型分组的大题
+type ExamSection struct {
+	Title     string
+	Questions []ExamQuestion
+}
+
+// ExamQuestion 试卷中的一道题，选项与答案已按本卷顺序重新编号
+type ExamQuestion struct {
+	Number  int
+	ID      int
+	Title   []TextBlock
+	Options []ExamOption
+	Answer  []string
+}
+
+// ExamOption 试卷中的选项
+type ExamOption struct {
+	Label string
+	Body  []TextBlock
+}
+
+// TextBlock 题目文本片段：普通段落、代码块或图片
+type TextBlock struct {
+	Code  bool
+	Text  string // 图片时为替代文本
+	Image string // 引用的附件ID
+}
+
+// ExamImage 排版用的图片，JPEG 或 8位PNG
+type ExamImage struct {
+	Type          string // png/jpg
+	Data          []byte
+	Width, Height int // 像素
+}
+
+// Markdown中引用附件的图片
+var examImagePattern = regexp.MustCompile(`!\[([^\]]*)\]\(` + storage.AttachmentScheme + `([0-9a-f]{32})\)`)
+
+var examSectionNames = map[int]string{
+	config.SingleSelect: "单选题",
+	config.MultiSelect:  "多选题",
+	config.Coding:       "编程题",
+}
+
+var chineseNumbers = []string{"一", "二", "三", "四", "五"}
+
+// BuildExamPapers 按题型分组组卷，返回每一份试卷（A卷、B卷……）
+func BuildExamPapers(questions []storage.Question, opts ExamOptions) []*ExamPaper {
+	variants := opts.Variants
+	if variants < 1 {
+		variants = 1
+	}
+
+	papers := make([]*ExamPaper, 0, variants)
+	for v := 0; v < variants; v++ {
+		paper := &ExamPaper{
+			Title:     opts.Title,
+			Course:    opts.Course,
+			Date:      opts.Date,
+			Duration:  opts.Duration,
+			AnswerKey: opts.AnswerKey,
+		}
+		if variants > 1 {
+			paper.Variant = string(rune('A' + v))
+		}
+		// 每份试卷使用独立的随机序列，增减份数不影响前面试卷的顺序
+		var rng *rand.Rand
+		if v > 0 || opts.Shuffle {
+			rng = rand.New(rand.NewSource(opts.Seed + int64(v)))
+		}
+		paperQuestions := questions
+		if v < len(opts.PaperQuestions) {
+			paperQuestions = append(append([]storage.Question{}, questions...), opts.PaperQuestions[v]...)
+		}
+		paper.Sections = buildSections(paperQuestions, rng)
+		papers = append(papers, paper)
+	}
+	return papers
+}
+
+// buildSections 按单选、多选、编程的顺序分组并连续编号，rng 不为空时打乱题目与选项
+func buildSections(questions []storage.Question, rng *rand.Rand) []ExamSection {
+	byType := make(map[int][]storage.Question)
+	for _, q := range questions {
+		byType[q.Type] = append(byType[q.Type], q)
+	}
+
+	var sections []ExamSection
+	number := 0
+	for _, typ := range []int{config.SingleSelect, config.MultiSelect, config.Coding} {
+		group := byType[typ]
+		if len(group) == 0 {
+			continue
+		}
+		if rng != nil {
+			rng.Shuffle(len(group), func(i, j int) { group[i], group[j] = group[j], group[i] })
+		}
+		section := ExamSection{
+			Title: fmt.Sprintf("%s、%s（共%d题）", chineseNumbers[len(sections)], examSectionNames[typ], len(group)),
+		}
+		for _, q := range group {
+			number++
+			section.Questions = append(section.Questions, buildExamQuestion(q, number, rng))
+		}
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+// buildExamQuestion 拆分题目文本，打乱选项后按新顺序重新编号答案
+func buildExamQuestion(q storage.Question, number int, rng *rand.Rand) ExamQuestion {
+	order := make([]int, len(q.Answers))
+	for i := range order {
+		order[i] = i
+	}
+	if rng != nil {
+		rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+
+	// 原选项字母 -> 本卷选项字母
+	relabel := make(map[string]string, len(order))
+	item := ExamQuestion{Number: number, ID: q.ID, Title: SplitMarkdown(q.Title)}
+	for pos, orig := range order {
+		_, body := StripOptionPrefix(q.Answers[orig])
+		label := string(rune('A' + pos))
+		relabel[string(rune('A'+orig))] = label
+
+		blocks := SplitMarkdown(body)
+		// 旧数据中编程题选项是单行纯代码，按代码块排版
+		if q.Type == config.Coding && !strings.Contains(body, "`") {
+			blocks = []TextBlock{{Code: true, Text: body}}
+		}
+		item.Options = append(item.Options, ExamOption{Label: label, Body: blocks})
+	}
+	for _, right := range q.Rights {
+		if label, ok := relabel[strings.ToUpper(strings.TrimSpace(right))]; ok {
+			item.Answer = append(item.Answer, label)
+		}
+	}
+	sort.Strings(item.Answer)
+	return item
+}
+
+// SplitMarkdown 将Markdown拆分为段落、代码块与附件图片，段落去掉行内代码与加粗标记，
+// 供PDF/DOCX等不渲染HTML的格式排版
+func SplitMarkdown(text string) []TextBlock {
+	var blocks []TextBlock
+	var buf []string
+	var open *codeFence
+	flush := func(code bool) {
+		content := strings.Join(buf, "\n")
+		buf = buf[:0]
+		if !code {
+			content = strings.TrimSpace(plainInline(content))
+		}
+		if content != "" {
+			blocks = append(blocks, TextBlock{Code: code, Text: content})
+		}
+	}
+
+	for i, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		marker, info, ok := parseFence(line)
+		switch {
+		case ok && open == nil:
+			flush(false)
+			open = &codeFence{marker: marker, line: i + 1}
+		case ok && info == "" && marker[0] == open.marker[0] && len(marker) >= len(open.marker):
+			flush(true)
+			open = nil
+		case open == nil && examImagePattern.MatchString(line):
+			// 图片单独成块，前后的文字各自成段
+			last := 0
+			for _, m := range examImagePattern.FindAllStringSubmatchIndex(line, -1) {
+				buf = append(buf, line[last:m[0]])
+				flush(false)
+				blocks = append(blocks, TextBlock{Text: line[m[2]:m[3]], Image: line[m[4]:m[5]]})
+				last = m[1]
+			}
+			buf = append(buf, line[last:])
+		default:
+			buf = append(buf, strings.ReplaceAll(line, "\t", "    "))
+		}
+	}
+	// 未闭合的代码块按代码处理
+	flush(open != nil)
+	return blocks
+}
+
+// plainInline 去掉行内代码与加粗/斜体标记
+func plainInline(text string) string {
+	return strings.NewReplacer("`", "", "**", "", "__", "").Replace(text)
+}
+
+// LoadImages 读取试卷中引用的附件图片，同一组试卷共用。JPEG 以外的图片统一转为PNG；
+// 附件不存在或无法解码（如 WebP）时不加入，排版时显示替代文本
+func LoadImages(ctx context.Context, attachments *AttachmentManager, papers []*ExamPaper) error {
+	images := make(map[string]*ExamImage)
+	for _, paper := range papers {
+		paper.Images = images
+		for _, section := range paper.Sections {
+			for _, q := range section.Questions {
+				blocks := append([]TextBlock{}, q.Title...)
+				for _, opt := range q.Options {
+					blocks = append(blocks, opt.Body...)
+				}
+				for _, block := range blocks {
+					if block.Image == "" {
+						continue
+					}
+					if _, done := images[block.Image]; done {
+						continue
+					}
+					img, err := loadExamImage(ctx, attachments, block.Image)
+					if err != nil {
+						return err
+					}
+					images[block.Image] = img
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func loadExamImage(ctx context.Context, attachments *AttachmentManager, id string) (*ExamImage, error) {
+	_, data, err := attachments.Read(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取附件 %s 失败: %w", id, err)
+	}
+	decoded, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil
+	}
+	bounds := decoded.Bounds()
+	img := &ExamImage{Type: "jpg", Data: data, Width: bounds.Dx(), Height: bounds.Dy()}
+	if format == "jpeg" {
+		return img, nil
+	}
+	// PDF库不支持隔行扫描与16位的PNG，统一转为8位非隔行的PNG
+	rgba := image.NewNRGBA(bounds)
+	draw.Draw(rgba, bounds, decoded, bounds.Min, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, rgba); err != nil {
+		return nil, nil
+	}
+	img.Type, img.Data = "png", buf.Bytes()
+	return img, nil
+}
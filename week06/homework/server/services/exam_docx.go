@@ -0,0 +1,293 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// DOCX 是一组 OOXML 文件的 zip 包，这里只生成试卷用到的最小集合：
+// 正文、样式、页脚（页码）与题目中的图片，Word/WPS/LibreOffice 均可打开
+var docxStaticParts = map[string]string{
+	"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Default Extension="png" ContentType="image/png"/>
+<Default Extension="jpg" ContentType="image/jpeg"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+<Override PartName="/word/footer1.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.footer+xml"/>
+</Types>`,
+	"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+</Relationships>`,
+	"word/styles.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:docDefaults>
+<w:rPrDefault><w:rPr><w:rFonts w:ascii="Times New Roman" w:hAnsi="Times New Roman" w:eastAsia="宋体"/><w:sz w:val="22"/><w:szCs w:val="22"/><w:lang w:val="en-US" w:eastAsia="zh-CN"/></w:rPr></w:rPrDefault>
+<w:pPrDefault><w:pPr><w:spacing w:after="60" w:line="300" w:lineRule="auto"/></w:pPr></w:pPrDefault>
+</w:docDefaults>
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style>
+<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:basedOn w:val="Normal"/><w:pPr><w:jc w:val="center"/><w:spacing w:after="120"/></w:pPr><w:rPr><w:rFonts w:eastAsia="黑体"/><w:b/><w:sz w:val="36"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Info"><w:name w:val="Info"/><w:basedOn w:val="Normal"/><w:pPr><w:jc w:val="center"/></w:pPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="240" w:after="120"/></w:pPr><w:rPr><w:rFonts w:eastAsia="黑体"/><w:b/><w:sz w:val="26"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Question"><w:name w:val="Question"/><w:basedOn w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="120"/><w:ind w:left="360" w:hanging="360"/></w:pPr></w:style>
+<w:style w:type="paragraph" w:styleId="Option"><w:name w:val="Option"/><w:basedOn w:val="Normal"/><w:pPr><w:ind w:left="840" w:hanging="360"/></w:pPr></w:style>
+<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F2F2F2"/><w:spacing w:after="0" w:line="240" w:lineRule="auto"/><w:ind w:left="360"/></w:pPr><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="19"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Footer"><w:name w:val="footer"/><w:basedOn w:val="Normal"/><w:pPr><w:jc w:val="center"/></w:pPr><w:rPr><w:sz w:val="18"/></w:rPr></w:style>
+</w:styles>`,
+}
+
+// 正文的关系：样式、页脚与图片（rId3 起）
+const docxDocumentRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/footer" Target="footer1.xml"/>
+%s</Relationships>`
+
+// 嵌入的图片（行内），尺寸单位为EMU
+const docxImage = `<w:p><w:pPr><w:ind w:left="%d"/></w:pPr><w:r><w:drawing><wp:inline distT="0" distB="0" distL="0" distR="0">` +
+	`<wp:extent cx="%[2]d" cy="%[3]d"/><wp:docPr id="%[4]d" name="图片 %[4]d" descr="%[5]s"/>` +
+	`<a:graphic xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture">` +
+	`<pic:pic xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:nvPicPr><pic:cNvPr id="%[4]d" name="image%[4]d"/><pic:cNvPicPr/></pic:nvPicPr>` +
+	`<pic:blipFill><a:blip r:embed="%[6]s"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>` +
+	`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%[2]d" cy="%[3]d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr></pic:pic>` +
+	`</a:graphicData></a:graphic></wp:inline></w:drawing></w:r></w:p>`
+
+// 96dpi 下每像素的EMU，版心宽度（A4 去掉左右各2cm）
+const (
+	docxEMUPerPixel = 9525
+	docxTextWidth   = 6120130
+)
+
+const docxFooter = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:ftr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:p><w:pPr><w:pStyle w:val="Footer"/></w:pPr>
+<w:r><w:t xml:space="preserve">%s  第 </w:t></w:r>
+<w:r><w:fldChar w:fldCharType="begin"/></w:r><w:r><w:instrText xml:space="preserve"> PAGE </w:instrText></w:r><w:r><w:fldChar w:fldCharType="separate"/></w:r><w:r><w:t>1</w:t></w:r><w:r><w:fldChar w:fldCharType="end"/></w:r>
+<w:r><w:t xml:space="preserve"> 页 / 共 </w:t></w:r>
+<w:r><w:fldChar w:fldCharType="begin"/></w:r><w:r><w:instrText xml:space="preserve"> NUMPAGES </w:instrText></w:r><w:r><w:fldChar w:fldCharType="separate"/></w:r><w:r><w:t>1</w:t></w:r><w:r><w:fldChar w:fldCharType="end"/></w:r>
+<w:r><w:t xml:space="preserve"> 页</w:t></w:r>
+</w:p>
+</w:ftr>`
+
+// A4 纸，页边距2cm（单位为1/20磅）
+const docxSectPr = `<w:sectPr><w:footerReference w:type="default" r:id="rId2"/><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1134" w:right="1134" w:bottom="1134" w:left="1134" w:header="567" w:footer="567" w:gutter="0"/></w:sectPr>`
+
+// RenderDOCX 生成一份试卷的Word文档，需要时在末尾分页附参考答案
+func (r *ExamRenderer) RenderDOCX(paper *ExamPaper) ([]byte, error) {
+	body := docxBody{images: paper.Images}
+	body.paragraph("Title", paperTitle(paper))
+	if info := paperInfo(paper); info != "" {
+		body.paragraph("Info", info)
+	}
+	body.paragraph("Info", "姓名：____________    学号：____________    班级：____________    得分：________")
+
+	for _, section := range paper.Sections {
+		body.paragraph("Heading1", section.Title)
+		for _, q := range section.Questions {
+			body.labeled("Question", fmt.Sprintf("%d.", q.Number), q.Title)
+			for _, opt := range q.Options {
+				body.labeled("Option", opt.Label+".", opt.Body)
+			}
+		}
+	}
+
+	if paper.AnswerKey {
+		body.pageBreak()
+		body.paragraph("Title", "参考答案 — "+paperTitle(paper))
+		for _, section := range paper.Sections {
+			body.paragraph("Heading1", section.Title)
+			body.answerTable(section.Questions)
+		}
+	}
+
+	document := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"><w:body>` +
+		body.String() + docxSectPr + `</w:body></w:document>`
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var rels strings.Builder
+	for _, m := range body.media {
+		fmt.Fprintf(&rels, `<Relationship Id="%s" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="%s"/>`+"\n", m.rID, m.target)
+	}
+	parts := map[string]string{
+		"word/document.xml":            document,
+		"word/footer1.xml":             fmt.Sprintf(docxFooter, escapeXML(paperTitle(paper))),
+		"word/_rels/document.xml.rels": fmt.Sprintf(docxDocumentRels, rels.String()),
+	}
+	for name, content := range docxStaticParts {
+		parts[name] = content
+	}
+	// [Content_Types].xml 放在第一个，部分程序依赖这一顺序识别格式
+	names := []string{"[Content_Types].xml", "_rels/.rels", "word/_rels/document.xml.rels", "word/styles.xml", "word/footer1.xml", "word/document.xml"}
+	for _, m := range body.media {
+		names = append(names, "word/"+m.target)
+		parts["word/"+m.target] = string(m.data)
+	}
+	for _, name := range names {
+		f, err := zw.Create(name)
+		if err != nil {
+			return nil, fmt.Errorf("生成DOCX失败: %w", err)
+		}
+		if _, err := f.Write([]byte(parts[name])); err != nil {
+			return nil, fmt.Errorf("生成DOCX失败: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("生成DOCX失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// docxBody 拼接 document.xml 的正文，记录用到的图片
+type docxBody struct {
+	strings.Builder
+	images   map[string]*ExamImage
+	media    []docxMedia
+	drawings int // 文档中图片的序号，docPr 的 id 须唯一
+}
+
+// docxMedia 嵌入文档的图片文件，同一附件只嵌入一次
+type docxMedia struct {
+	id     string // 附件ID
+	rID    string
+	target string // media/imageN.png
+	data   []byte
+}
+
+func (b *docxBody) paragraph(style, text string) {
+	fmt.Fprintf(b, `<w:p><w:pPr><w:pStyle w:val="%s"/></w:pPr>%s</w:p>`, style, docxRuns(text, ""))
+}
+
+// labeled 题号或选项字母与第一段正文在同一段落（悬挂缩进），其余段落与代码块缩进对齐
+func (b *docxBody) labeled(style, label string, blocks []TextBlock) {
+	first := label + "\t"
+	switch {
+	case len(blocks) == 0:
+		b.paragraph(style, first)
+	case !blocks[0].Code && blocks[0].Image == "":
+		b.paragraph(style, first+blocks[0].Text)
+		blocks = blocks[1:]
+	case blocks[0].Code && !strings.Contains(blocks[0].Text, "\n"):
+		// 单行代码（如编程题选项）与字母放在同一行
+		fmt.Fprintf(b, `<w:p><w:pPr><w:pStyle w:val="%s"/></w:pPr>%s%s</w:p>`, style, docxRuns(first, ""), docxRuns(blocks[0].Text, docxCodeRun))
+		blocks = blocks[1:]
+	default:
+		b.paragraph(style, first)
+	}
+	indent := 360
+	if style == "Option" {
+		indent = 840
+	}
+	for _, block := range blocks {
+		if block.Code {
+			for _, line := range strings.Split(block.Text, "\n") {
+				fmt.Fprintf(b, `<w:p><w:pPr><w:pStyle w:val="Code"/><w:ind w:left="%d"/></w:pPr>%s</w:p>`, indent, docxRuns(line, ""))
+			}
+			continue
+		}
+		if block.Image != "" && b.image(block, indent) {
+			continue
+		}
+		fmt.Fprintf(b, `<w:p><w:pPr><w:ind w:left="%d"/></w:pPr>%s</w:p>`, indent, docxRuns(blockText(block), ""))
+	}
+}
+
+// image 按96dpi嵌入图片，超出版心时等比缩小；图片不可用时返回 false，改为输出替代文本
+func (b *docxBody) image(block TextBlock, indent int) bool {
+	img := b.images[block.Image]
+	if img == nil || img.Width == 0 || img.Height == 0 {
+		return false
+	}
+	var media *docxMedia
+	for i := range b.media {
+		if b.media[i].id == block.Image {
+			media = &b.media[i]
+		}
+	}
+	if media == nil {
+		n := len(b.media) + 1
+		b.media = append(b.media, docxMedia{
+			id:     block.Image,
+			rID:    fmt.Sprintf("rId%d", n+2),
+			target: fmt.Sprintf("media/image%d.%s", n, img.Type),
+			data:   img.Data,
+		})
+		media = &b.media[n-1]
+	}
+
+	maxWidth := docxTextWidth - indent*635 // 1/20磅 = 635 EMU
+	cx, cy := img.Width*docxEMUPerPixel, img.Height*docxEMUPerPixel
+	if cx > maxWidth {
+		cx, cy = maxWidth, cy*maxWidth/cx
+	}
+	b.drawings++
+	fmt.Fprintf(b, docxImage, indent, cx, cy, b.drawings, escapeXML(block.Text), media.rID)
+	return true
+}
+
+func (b *docxBody) pageBreak() {
+	b.WriteString(`<w:p><w:r><w:br w:type="page"/></w:r></w:p>`)
+}
+
+// answerTable 参考答案表格，每行5题
+func (b *docxBody) answerTable(questions []ExamQuestion) {
+	const cols = 5
+	b.WriteString(`<w:tbl><w:tblPr><w:tblW w:w="5000" w:type="pct"/><w:tblBorders>`)
+	for _, side := range []string{"top", "left", "bottom", "right", "insideH", "insideV"} {
+		fmt.Fprintf(b, `<w:%s w:val="single" w:sz="4" w:space="0" w:color="999999"/>`, side)
+	}
+	b.WriteString(`</w:tblBorders></w:tblPr><w:tblGrid>`)
+	for i := 0; i < cols; i++ {
+		b.WriteString(`<w:gridCol w:w="1927"/>`)
+	}
+	b.WriteString(`</w:tblGrid>`)
+	for start := 0; start < len(questions); start += cols {
+		b.WriteString(`<w:tr>`)
+		for i := start; i < start+cols; i++ {
+			text := ""
+			if i < len(questions) {
+				text = fmt.Sprintf("%d. %s", questions[i].Number, strings.Join(questions[i].Answer, ""))
+			}
+			fmt.Fprintf(b, `<w:tc><w:tcPr><w:tcW w:w="1000" w:type="pct"/></w:tcPr><w:p>%s</w:p></w:tc>`, docxRuns(text, ""))
+		}
+		b.WriteString(`</w:tr>`)
+	}
+	b.WriteString(`</w:tbl>`)
+}
+
+// 行内代码的字符格式，与 Code 样式一致
+const docxCodeRun = `<w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="19"/><w:shd w:val="clear" w:color="auto" w:fill="F2F2F2"/></w:rPr>`
+
+// docxRuns 将文本转为 run，换行与制表符转为对应元素，rPr 为字符格式
+func docxRuns(text, rPr string) string {
+	var b strings.Builder
+	b.WriteString("<w:r>" + rPr)
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			b.WriteString("<w:br/>")
+		}
+		for j, part := range strings.Split(line, "\t") {
+			if j > 0 {
+				b.WriteString("<w:tab/>")
+			}
+			if part != "" {
+				fmt.Fprintf(&b, `<w:t xml:space="preserve">%s</w:t>`, escapeXML(part))
+			}
+		}
+	}
+	b.WriteString("</w:r>")
+	return b.String()
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
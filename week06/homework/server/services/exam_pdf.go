@@ -0,0 +1,310 @@
+package services
+
+import (
+	"Server/config"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// 未配置 exam.font 时依次查找的中文字体（须为 .ttf，不支持 .ttc/.otf）
+var examFontCandidates = []string{
+	"fonts/NotoSansSC-Regular.ttf",
+	"fonts/SourceHanSansSC-Regular.ttf",
+	"/usr/share/fonts/truetype/droid/DroidSansFallbackFull.ttf",
+	"/usr/share/fonts/truetype/wqy/wqy-microhei.ttf",
+	"/Library/Fonts/Arial Unicode.ttf",
+	"C:\\Windows\\Fonts\\simhei.ttf",
+}
+
+// ErrExamFontMissing 没有可用的中文字体，无法生成PDF
+var ErrExamFontMissing = errors.New("未找到中文字体，请在 exam.font（环境变量 EXAM_FONT）中配置 .ttf 字体文件，如 Noto Sans SC")
+
+// A4 版面（毫米）
+const (
+	pdfMargin     = 20.0
+	pdfLineHeight = 6.5
+	pdfCodeHeight = 5.0
+	pdfIndent     = 7.0
+)
+
+// ExamRenderer 将试卷排版为PDF或DOCX，字体文件只读取一次
+type ExamRenderer struct {
+	cfg config.ExamConfig
+
+	mu       sync.Mutex
+	font     []byte
+	codeFont []byte
+}
+
+func NewExamRenderer(cfg config.ExamConfig) *ExamRenderer {
+	return &ExamRenderer{cfg: cfg}
+}
+
+// loadFonts 读取正文与代码字体，代码字体未配置时返回 nil
+func (r *ExamRenderer) loadFonts() ([]byte, []byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.font != nil {
+		return r.font, r.codeFont, nil
+	}
+
+	path := r.cfg.Font
+	if path == "" {
+		for _, candidate := range examFontCandidates {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+	if path == "" {
+		return nil, nil, ErrExamFontMissing
+	}
+	font, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取字体失败: %w", err)
+	}
+	if r.cfg.CodeFont != "" {
+		if r.codeFont, err = os.ReadFile(r.cfg.CodeFont); err != nil {
+			return nil, nil, fmt.Errorf("读取代码字体失败: %w", err)
+		}
+	}
+	r.font = font
+	return r.font, r.codeFont, nil
+}
+
+// RenderPDF 生成一份试卷的PDF，需要时在末尾另起一页附参考答案
+func (r *ExamRenderer) RenderPDF(paper *ExamPaper) ([]byte, error) {
+	font, codeFont, err := r.loadFonts()
+	if err != nil {
+		return nil, err
+	}
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.SetTitle(paperTitle(paper), true)
+	pdf.SetCreator("question-service", true)
+	pdf.AddUTF8FontFromBytes("body", "", font)
+	w := &pdfWriter{pdf: pdf, codeFamily: "Courier", images: paper.Images}
+	if codeFont != nil {
+		pdf.AddUTF8FontFromBytes("code", "", codeFont)
+		w.codeFamily = "code"
+		w.codeUTF8 = true
+	}
+
+	pdf.AliasNbPages("{nb}")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin + 5)
+		pdf.SetFont("body", "", 9)
+		pdf.CellFormat(0, 5, fmt.Sprintf("%s  第 %d 页 / 共 {nb} 页", paperTitle(paper), pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+	w.header(paper)
+	for _, section := range paper.Sections {
+		w.section(section.Title)
+		for _, q := range section.Questions {
+			w.question(q)
+		}
+	}
+	if paper.AnswerKey {
+		pdf.AddPage()
+		w.answerKey(paper)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("生成PDF失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfWriter 试卷各部分的排版
+type pdfWriter struct {
+	pdf        *fpdf.Fpdf
+	codeFamily string
+	codeUTF8   bool // 代码字体是否支持中文等非ASCII字符
+	images     map[string]*ExamImage
+}
+
+func (w *pdfWriter) header(paper *ExamPaper) {
+	pdf := w.pdf
+	pdf.SetFont("body", "", 18)
+	pdf.MultiCell(0, 10, paperTitle(paper), "", "C", false)
+
+	pdf.SetFont("body", "", 11)
+	if info := paperInfo(paper); info != "" {
+		pdf.CellFormat(0, 8, info, "", 1, "C", false, 0, "")
+	}
+	pdf.CellFormat(0, 10, "姓名：____________    学号：____________    班级：____________    得分：________", "", 1, "C", false, 0, "")
+
+	pageWidth, _ := pdf.GetPageSize()
+	y := pdf.GetY() + 1
+	pdf.Line(pdfMargin, y, pageWidth-pdfMargin, y)
+	pdf.Ln(4)
+}
+
+func (w *pdfWriter) section(title string) {
+	w.pdf.Ln(2)
+	w.pdf.SetFont("body", "", 13)
+	w.pdf.MultiCell(0, 9, title, "", "L", false)
+}
+
+func (w *pdfWriter) question(q ExamQuestion) {
+	pdf := w.pdf
+	pdf.SetFont("body", "", 11)
+	w.labeled(fmt.Sprintf("%d.", q.Number), q.Title, 0)
+	for _, opt := range q.Options {
+		w.labeled(opt.Label+".", opt.Body, pdfIndent)
+	}
+	pdf.Ln(3)
+}
+
+// labeled 在左侧输出题号或选项字母，正文与代码块整体缩进到其后
+func (w *pdfWriter) labeled(label string, blocks []TextBlock, indent float64) {
+	pdf := w.pdf
+	left := pdfMargin + indent
+	pdf.SetX(left)
+	pdf.SetFont("body", "", 11)
+	labelWidth := pdf.GetStringWidth(label) + 2
+	pdf.CellFormat(labelWidth, pdfLineHeight, label, "", 0, "L", false, 0, "")
+
+	pdf.SetLeftMargin(left + labelWidth)
+	defer pdf.SetLeftMargin(pdfMargin)
+	if len(blocks) == 0 {
+		pdf.Ln(pdfLineHeight)
+	}
+	for i, block := range blocks {
+		if i > 0 {
+			pdf.SetX(left + labelWidth)
+		}
+		if block.Code {
+			w.code(block.Text)
+			continue
+		}
+		if block.Image != "" && w.image(block) {
+			continue
+		}
+		pdf.SetFont("body", "", 11)
+		pdf.MultiCell(0, pdfLineHeight, blockText(block), "", "L", false)
+	}
+}
+
+// blockText 段落的文字，无法显示的图片输出替代文本
+func blockText(block TextBlock) string {
+	if block.Image != "" {
+		return "[图片：" + block.Text + "]"
+	}
+	return block.Text
+}
+
+// code 等宽字体、浅灰底色输出代码块；Courier 不含中文，含非ASCII字符的行改用正文字体
+func (w *pdfWriter) code(text string) {
+	pdf := w.pdf
+	pdf.SetFillColor(242, 242, 242)
+	x := pdf.GetX()
+	pdf.Ln(1)
+	for _, line := range strings.Split(text, "\n") {
+		pdf.SetX(x)
+		if w.codeUTF8 || isASCII(line) {
+			pdf.SetFont(w.codeFamily, "", 9.5)
+		} else {
+			pdf.SetFont("body", "", 9.5)
+		}
+		if line == "" {
+			line = " " // 空行也保留底色
+		}
+		pdf.MultiCell(0, pdfCodeHeight, line, "", "L", true)
+	}
+	pdf.Ln(1)
+}
+
+// image 按96dpi输出图片，超出版心时等比缩小到版心宽度；图片不可用时返回 false，改为输出替代文本
+func (w *pdfWriter) image(block TextBlock) bool {
+	img := w.images[block.Image]
+	if img == nil {
+		return false
+	}
+	pdf := w.pdf
+	options := fpdf.ImageOptions{ImageType: img.Type}
+	pdf.RegisterImageOptionsReader(block.Image, options, bytes.NewReader(img.Data))
+	if pdf.Err() {
+		return false
+	}
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	maxWidth := pageWidth - right - left
+	width := float64(img.Width) * 25.4 / 96
+	if width > maxWidth {
+		width = maxWidth
+	}
+	pdf.Ln(1)
+	pdf.ImageOptions(block.Image, left, -1, width, 0, true, options, 0, "")
+	pdf.Ln(1)
+	return true
+}
+
+// answerKey 参考答案：每行5题
+func (w *pdfWriter) answerKey(paper *ExamPaper) {
+	pdf := w.pdf
+	pdf.SetFont("body", "", 16)
+	pdf.MultiCell(0, 10, "参考答案 — "+paperTitle(paper), "", "C", false)
+	pdf.Ln(3)
+
+	pageWidth, _ := pdf.GetPageSize()
+	cellWidth := (pageWidth - 2*pdfMargin) / 5
+	for _, section := range paper.Sections {
+		w.section(section.Title)
+		pdf.SetFont("body", "", 11)
+		for i, q := range section.Questions {
+			ln := 0
+			if i%5 == 4 || i == len(section.Questions)-1 {
+				ln = 1
+			}
+			pdf.CellFormat(cellWidth, 8, fmt.Sprintf("%d. %s", q.Number, strings.Join(q.Answer, "")), "1", ln, "L", false, 0, "")
+		}
+	}
+}
+
+// paperTitle 标题后附卷别，如 "期末考试（A卷）"
+func paperTitle(paper *ExamPaper) string {
+	title := paper.Title
+	if title == "" {
+		title = "试卷"
+	}
+	if paper.Variant != "" {
+		title += fmt.Sprintf("（%s卷）", paper.Variant)
+	}
+	return title
+}
+
+// paperInfo 课程、日期与考试时长
+func paperInfo(paper *ExamPaper) string {
+	var parts []string
+	if paper.Course != "" {
+		parts = append(parts, "课程："+paper.Course)
+	}
+	if paper.Date != "" {
+		parts = append(parts, "日期："+paper.Date)
+	}
+	if paper.Duration > 0 {
+		parts = append(parts, fmt.Sprintf("考试时长：%d 分钟", paper.Duration))
+	}
+	return strings.Join(parts, "    ")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"Server/config"
+	"Server/telemetry"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func buildExplainPrompt(q config.QuestionRequest1) string {
+	var builder strings.Builder
+
+	builder.WriteString(fmt.Sprintf("请为以下%s（%s）编写解析：\n", getQuestionTypeText(q.Type), q.Language))
+	builder.WriteString(fmt.Sprintf("题目：%s\n", q.Title))
+	for i, ans := range q.Answers {
+		builder.WriteString(fmt.Sprintf("%s: %s\n", string(rune('A'+i)), stripOptionPrefix(ans)))
+	}
+	builder.WriteString(fmt.Sprintf("正确答案：%s\n", strings.Join(q.Rights, ",")))
+
+	builder.WriteString("\n请严格遵循以下JSON格式返回：\n")
+	builder.WriteString(`{
+	"explanations": [
+		"A错误：……",
+		"B正确：……",
+		"C错误：……",
+		"D错误：……"
+	],
+	"hint": "不直接透露答案的简短提示",
+	"reference": "https://go.dev/doc/effective_go"
+}`)
+
+	builder.WriteString("\n\n必须遵守：\n")
+	builder.WriteString(fmt.Sprintf("1. explanations必须有%d条，按选项顺序逐条说明正确或错误的原因\n", len(q.Answers)))
+	builder.WriteString("2. 解析必须与给定的正确答案一致，不得修改答案\n")
+	builder.WriteString("3. hint不超过30字，不得直接透露答案\n")
+	builder.WriteString("4. reference填写官方文档等权威链接，没有合适链接时填空字符串\n")
+	builder.WriteString("5. 解析使用Markdown格式，代码用`包裹或放入标注语言的```代码块，代码块必须成对闭合\n")
+
+	return builder.String()
+}
+
+// stripOptionPrefix 去掉选项中可能存在的 "A: " 前缀，避免重复编号
+func stripOptionPrefix(option string) string {
+	if len(option) >= 2 && option[0] >= 'A' && option[0] <= 'Z' && (option[1] == ':' || option[1] == '.') {
+		return strings.TrimSpace(option[2:])
+	}
+	return option
+}
+
+// parseExplanation 解析补写的解析，同时返回解析响应时所做的修复
+func parseExplanation(content string, q config.QuestionRequest1) (*config.Explanation, []string, error) {
+	data, repairs, err := extractJSON(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var exp config.Explanation
+	if err := json.Unmarshal(data, &exp); err != nil {
+		return nil, nil, invalid("invalid_json", "解析结果解析失败: %w", err)
+	}
+	if len(exp.Explanations) != len(q.Answers) {
+		return nil, nil, invalid("count_mismatch", "解析数量错误，预期 %d 条，实际 %d 条", len(q.Answers), len(exp.Explanations))
+	}
+	if err := ValidateQuestionMarkdown("", nil, exp.Explanations, exp.Hint); err != nil {
+		return nil, nil, invalid("code_fence", "%s", err)
+	}
+	return &exp, repairs.notes, nil
+}
+
+// requestExplanation 调用兼容OpenAI接口的模型为已有题目补写解析
+func requestExplanation(ctx context.Context, client *openai.Client, settings modelSettings, q config.QuestionRequest1) (*config.Explanation, error) {
+	ctx, cancel := context.WithTimeout(ctx, settings.timeout)
+	defer cancel()
+
+	if len(q.Answers) == 0 {
+		return nil, fmt.Errorf("题目没有选项，无法生成解析")
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model: settings.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "你是一位经验丰富的编程课程助教，擅长为选择题编写准确、简洁的解析",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: buildExplainPrompt(q),
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: "json_object"},
+		Temperature:    settings.temperature,
+		MaxTokens:      settings.maxTokens,
+	}
+
+	resp, err := createWithRetry(ctx, client, settings, "explain", request)
+	if err != nil {
+		return nil, err
+	}
+	exp, repairs, err := parseExplanation(resp.Choices[0].Message.Content, q)
+	if err != nil {
+		return nil, err
+	}
+	logRepairs(settings.model, "explain", repairs)
+	return exp, nil
+}
+
+// createWithRetry 请求失败且可重试时按递增间隔重试，重试次数计入监控
+func createWithRetry(ctx context.Context, client *openai.Client, settings modelSettings, operation string, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	maxRetries := 3
+	tag := strings.ToUpper(settings.provider + "_" + operation + "_WARN")
+	var resp openai.ChatCompletionResponse
+	var err error
+
+	for i := 0; i < maxRetries; i++ {
+		resp, err = client.CreateChatCompletion(ctx, request)
+		if err == nil {
+			break
+		}
+
+		if isRetriableError(err) && i < maxRetries-1 {
+			wait := time.Duration(i+1) * 2 * time.Second
+			log.Printf("[%s] 请求失败，%s后重试... 错误：%v", tag, wait, err)
+			telemetry.AIRetry(settings.provider, operation)
+			// 等待重试期间服务退出或请求取消时立即返回
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return resp, fmt.Errorf("API请求已取消：%w", ctx.Err())
+			}
+			continue
+		}
+		break
+	}
+
+	if err != nil {
+		return resp, fmt.Errorf("API请求失败（尝试%d次）：%w", maxRetries, err)
+	}
+	if len(resp.Choices) == 0 {
+		return resp, fmt.Errorf("API返回结果为空")
+	}
+	return resp, nil
+}
+
+func (c *DeepSeekClient) Explain(ctx context.Context, q config.QuestionRequest1) (*config.Explanation, error) {
+	return requestExplanation(ctx, c.client, c.settings, q)
+}
+
+func (c *TongyiClient) Explain(ctx context.Context, q config.QuestionRequest1) (*config.Explanation, error) {
+	return requestExplanation(ctx, c.client, c.settings, q)
+}
@@ -0,0 +1,553 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 模板表达式：题目模板中的约束条件与 {{...}} 中的公式。
+// 支持数字、字符串（单/双引号）、true/false、变量，
+// 运算符 + - * / % == != < <= > >= && || ! 与括号，以及 exprFuncs 中的函数。
+// 数字统一按 float64 计算，/ 为浮点除法，整数除法（与Go相同，向零取整）用 idiv(a, b)
+
+// errExprRuntime 除零等与变量取值有关的错误，换一组取值可能就能通过
+var errExprRuntime = errors.New("表达式计算失败")
+
+// Expr 解析后的表达式
+type Expr struct {
+	src  string
+	root exprNode
+	vars []string
+}
+
+type exprNode interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+// ParseExpr 解析表达式
+func ParseExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src, seen: make(map[string]bool)}
+	if err := p.scan(); err != nil {
+		return nil, fmt.Errorf("表达式 %q: %w", src, err)
+	}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("多余的 %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("表达式 %q: %w", src, err)
+	}
+	return &Expr{src: src, root: root, vars: p.vars}, nil
+}
+
+// Vars 表达式引用的变量，按首次出现的顺序
+func (e *Expr) Vars() []string {
+	return e.vars
+}
+
+// Eval 按变量取值计算表达式
+func (e *Expr) Eval(vars map[string]interface{}) (interface{}, error) {
+	v, err := e.root.eval(vars)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.src, err)
+	}
+	return v, nil
+}
+
+// FormatValue 表达式结果转为题目文本：整数不带小数点，小数最多保留6位
+func FormatValue(v interface{}) string {
+	switch x := v.(type) {
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1e15 {
+			return strconv.FormatInt(int64(x), 10)
+		}
+		return strconv.FormatFloat(math.Round(x*1e6)/1e6, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	case string:
+		return x
+	}
+	return fmt.Sprint(v)
+}
+
+// truthy 约束条件的结果：布尔值，或非零数字、非空字符串
+func truthy(v interface{}) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	}
+	return false
+}
+
+// ---- 词法分析 ----
+
+type exprTokenKind int
+
+const (
+	tokNumber exprTokenKind = iota
+	tokString
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	num  float64
+}
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	pos    int
+	vars   []string
+	seen   map[string]bool
+}
+
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")", ","}
+
+func (p *exprParser) scan() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9' || r == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return fmt.Errorf("无效的数字 %q", s[i:j])
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokNumber, text: s[i:j], num: n})
+			i = j
+		case r == '_' || unicode.IsLetter(r):
+			j := i
+			for j < len(s) {
+				r, size := utf8.DecodeRuneInString(s[j:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokIdent, text: s[i:j]})
+			i = j
+		case r == '"' || r == '\'':
+			j := strings.IndexByte(s[i+1:], byte(r))
+			if j < 0 {
+				return errors.New("字符串缺少结束引号")
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokString, text: s[i+1 : i+1+j]})
+			i += j + 2
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, exprToken{kind: tokOp, text: op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("无法识别的字符 %q", r)
+			}
+		}
+	}
+	if len(p.tokens) == 0 {
+		return errors.New("表达式为空")
+	}
+	return nil
+}
+
+// ---- 语法分析（按优先级递归下降） ----
+
+func (p *exprParser) peekOp(ops ...string) string {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokOp {
+		return ""
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *exprParser) binary(next func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peekOp(ops...)
+		if op == "" {
+			return left, nil
+		}
+		p.pos++
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.binary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.binary(p.parseCompare, "&&")
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	return p.binary(p.parseAdd, "==", "!=", "<=", ">=", "<", ">")
+}
+
+func (p *exprParser) parseAdd() (exprNode, error) {
+	return p.binary(p.parseMul, "+", "-")
+}
+
+func (p *exprParser) parseMul() (exprNode, error) {
+	return p.binary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op := p.peekOp("-", "!"); op != "" {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("表达式不完整")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	switch tok.kind {
+	case tokNumber:
+		return constNode{tok.num}, nil
+	case tokString:
+		return constNode{tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return constNode{true}, nil
+		case "false":
+			return constNode{false}, nil
+		}
+		if p.peekOp("(") != "" {
+			return p.parseCall(tok.text)
+		}
+		if !p.seen[tok.text] {
+			p.seen[tok.text] = true
+			p.vars = append(p.vars, tok.text)
+		}
+		return varNode(tok.text), nil
+	}
+	if tok.text == "(" {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peekOp(")") == "" {
+			return nil, errors.New("缺少右括号")
+		}
+		p.pos++
+		return inner, nil
+	}
+	return nil, fmt.Errorf("意外的 %q", tok.text)
+}
+
+func (p *exprParser) parseCall(name string) (exprNode, error) {
+	fn, ok := exprFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的函数 %s", name)
+	}
+	p.pos++ // (
+	call := &callNode{name: name, fn: fn}
+	if p.peekOp(")") == "" {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if p.peekOp(",") == "" {
+				break
+			}
+			p.pos++
+		}
+	}
+	if p.peekOp(")") == "" {
+		return nil, fmt.Errorf("函数 %s 缺少右括号", name)
+	}
+	p.pos++
+	if fn.arity >= 0 && len(call.args) != fn.arity {
+		return nil, fmt.Errorf("函数 %s 需要 %d 个参数", name, fn.arity)
+	}
+	if fn.arity < 0 && len(call.args) == 0 {
+		return nil, fmt.Errorf("函数 %s 至少需要1个参数", name)
+	}
+	return call, nil
+}
+
+// ---- 求值 ----
+
+type constNode struct{ v interface{} }
+
+func (n constNode) eval(map[string]interface{}) (interface{}, error) { return n.v, nil }
+
+type varNode string
+
+func (n varNode) eval(vars map[string]interface{}) (interface{}, error) {
+	v, ok := vars[string(n)]
+	if !ok {
+		return nil, fmt.Errorf("未定义的变量 %s", string(n))
+	}
+	return v, nil
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n *unaryNode) eval(vars map[string]interface{}) (interface{}, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(v), nil
+	}
+	x, err := toNumber(v)
+	if err != nil {
+		return nil, err
+	}
+	return -x, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(vars map[string]interface{}) (interface{}, error) {
+	l, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	// 逻辑运算短路
+	switch n.op {
+	case "&&":
+		if !truthy(l) {
+			return false, nil
+		}
+	case "||":
+		if truthy(l) {
+			return true, nil
+		}
+	}
+	r, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "&&", "||":
+		return truthy(r), nil
+	case "==":
+		return valuesEqual(l, r), nil
+	case "!=":
+		return !valuesEqual(l, r), nil
+	}
+
+	// 字符串拼接与比较
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if lok || rok {
+		if n.op == "+" {
+			return FormatValue(l) + FormatValue(r), nil
+		}
+		if lok && rok {
+			switch n.op {
+			case "<":
+				return ls < rs, nil
+			case "<=":
+				return ls <= rs, nil
+			case ">":
+				return ls > rs, nil
+			case ">=":
+				return ls >= rs, nil
+			}
+		}
+		return nil, fmt.Errorf("字符串不支持运算 %s", n.op)
+	}
+
+	x, err := toNumber(l)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toNumber(r)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, fmt.Errorf("%w: 除数为0", errExprRuntime)
+		}
+		return x / y, nil
+	case "%":
+		if y == 0 {
+			return nil, fmt.Errorf("%w: 除数为0", errExprRuntime)
+		}
+		return math.Mod(x, y), nil
+	case "<":
+		return x < y, nil
+	case "<=":
+		return x <= y, nil
+	case ">":
+		return x > y, nil
+	case ">=":
+		return x >= y, nil
+	}
+	return nil, fmt.Errorf("不支持的运算 %s", n.op)
+}
+
+type callNode struct {
+	name string
+	fn   exprFunc
+	args []exprNode
+}
+
+func (n *callNode) eval(vars map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return n.fn.call(args)
+}
+
+// exprFunc 模板可用的函数，arity 为 -1 表示可变参数
+type exprFunc struct {
+	arity int
+	call  func(args []interface{}) (interface{}, error)
+}
+
+var exprFuncs = map[string]exprFunc{
+	"abs":   numberFunc(math.Abs),
+	"floor": numberFunc(math.Floor),
+	"ceil":  numberFunc(math.Ceil),
+	"round": numberFunc(math.Round),
+	"sqrt":  numberFunc(math.Sqrt),
+	"pow": {2, func(args []interface{}) (interface{}, error) {
+		x, y, err := twoNumbers(args)
+		if err != nil {
+			return nil, err
+		}
+		return math.Pow(x, y), nil
+	}},
+	"idiv": {2, func(args []interface{}) (interface{}, error) {
+		x, y, err := twoNumbers(args)
+		if err != nil {
+			return nil, err
+		}
+		if y == 0 {
+			return nil, fmt.Errorf("%w: 除数为0", errExprRuntime)
+		}
+		return math.Trunc(x / y), nil
+	}},
+	"min": {-1, func(args []interface{}) (interface{}, error) { return extremum(args, -1) }},
+	"max": {-1, func(args []interface{}) (interface{}, error) { return extremum(args, 1) }},
+	"len": {1, func(args []interface{}) (interface{}, error) {
+		return float64(utf8.RuneCountInString(FormatValue(args[0]))), nil
+	}},
+}
+
+func numberFunc(f func(float64) float64) exprFunc {
+	return exprFunc{1, func(args []interface{}) (interface{}, error) {
+		x, err := toNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return f(x), nil
+	}}
+}
+
+func twoNumbers(args []interface{}) (float64, float64, error) {
+	x, err := toNumber(args[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := toNumber(args[1])
+	return x, y, err
+}
+
+func extremum(args []interface{}, sign float64) (interface{}, error) {
+	best, err := toNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range args[1:] {
+		x, err := toNumber(a)
+		if err != nil {
+			return nil, err
+		}
+		if (x-best)*sign > 0 {
+			best = x
+		}
+	}
+	return best, nil
+}
+
+func toNumber(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%v 不是数字", v)
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if x, err := toNumber(a); err == nil {
+		if y, err := toNumber(b); err == nil {
+			return x == y
+		}
+	}
+	return FormatValue(a) == FormatValue(b)
+}
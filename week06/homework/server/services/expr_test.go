@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExprEval(t *testing.T) {
+	vars := map[string]interface{}{"a": 7.0, "b": 2.0, "name": "go", "ok": true}
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"a / b", 3.5},
+		{"idiv(a, b)", 3.0},
+		{"idiv(-a, b)", -3.0},
+		{"a % b", 1.0},
+		{"-a + 1", -6.0},
+		{"a > b && b > 0", true},
+		{"a < b || !ok", false},
+		{"a == 7 && name == 'go'", true},
+		{"name != \"java\"", true},
+		{"name + a", "go7"},
+		{"'a' < 'b'", true},
+		{"ok + 1", 2.0},
+		{"max(a, b, 10)", 10.0},
+		{"min(a, b)", 2.0},
+		{"pow(b, 3) + sqrt(16) + abs(-1)", 13.0},
+		{"round(2.5) + floor(1.9) + ceil(1.1)", 6.0},
+		{"len(name) + len(a * 100)", 5.0},
+		// 短路：右侧的除零不会被计算
+		{"b == 0 && a / 0 > 1", false},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.src)
+		if err != nil {
+			t.Errorf("ParseExpr(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := e.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v (%T), want %v (%T)", tt.src, got, got, tt.want, tt.want)
+		}
+	}
+}
+
+func TestExprVars(t *testing.T) {
+	e, err := ParseExpr("b * a + max(a, c) - b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Vars(); !reflect.DeepEqual(got, []string{"b", "a", "c"}) {
+		t.Errorf("Vars() = %v", got)
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // 错误信息应包含的内容
+	}{
+		{"1 +", "表达式不完整"},
+		{"(1 + 2", "缺少右括号"},
+		{"1 2", "多余的"},
+		{"foo(1)", "未知的函数 foo"},
+		{"pow(1)", "需要 2 个参数"},
+		{"max()", "至少需要1个参数"},
+		{"max(1, 2", "缺少右括号"},
+		{"'abc", ""},
+		{"a # b", ""},
+	}
+	for _, tt := range tests {
+		_, err := ParseExpr(tt.src)
+		if err == nil {
+			t.Errorf("ParseExpr(%q): expected error", tt.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseExpr(%q) error %q does not contain %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestExprEvalErrors(t *testing.T) {
+	vars := map[string]interface{}{"a": 1.0, "zero": 0.0, "s": "x"}
+	tests := []struct {
+		src     string
+		runtime bool // 换一组取值可能通过的错误
+	}{
+		{"a / zero", true},
+		{"a % zero", true},
+		{"idiv(a, zero)", true},
+		{"s - 1", false},
+		{"s * s", false},
+		{"-s", false},
+		{"missing + 1", false},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.src)
+		if err != nil {
+			t.Errorf("ParseExpr(%q): %v", tt.src, err)
+			continue
+		}
+		_, err = e.Eval(vars)
+		if err == nil {
+			t.Errorf("Eval(%q): expected error", tt.src)
+			continue
+		}
+		if errors.Is(err, errExprRuntime) != tt.runtime {
+			t.Errorf("Eval(%q) error %q runtime = %v, want %v", tt.src, err, !tt.runtime, tt.runtime)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{3.0, "3"},
+		{-12.0, "-12"},
+		{0.1 + 0.2, "0.3"},
+		{1.0 / 3, "0.333333"},
+		{true, "true"},
+		{"go", "go"},
+	}
+	for _, tt := range tests {
+		if got := FormatValue(tt.v); got != tt.want {
+			t.Errorf("FormatValue(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxFlagComment = 500 // 学生反馈说明的最大字数
+	maxFlagNote    = 500 // 处理说明的最大字数
+)
+
+// FeedbackService 学生对题目的反馈与老师的处理。
+// 同一道题作答过该题的学生未处理的反馈达到 feedback.suspend_threshold 时暂停用于考试，处理到低于阈值后恢复；
+// 没有作答记录的学生也可以反馈，但只进入处理队列，避免任何人凭 student_id 就能让题目暂停
+type FeedbackService struct {
+	db  *storage.Database
+	cfg config.FeedbackConfig
+}
+
+func NewFeedbackService(db *storage.Database, cfg config.FeedbackConfig) *FeedbackService {
+	return &FeedbackService{db: db, cfg: cfg}
+}
+
+// Submit 保存学生的反馈，由题目所属的工作区处理，学生作答过该题时反馈计入暂停阈值。
+// 同一学生对同一道题有未处理的反馈时返回 ErrConflict
+func (s *FeedbackService) Submit(ctx context.Context, f *storage.QuestionFlag) (*storage.FlagSummary, error) {
+	// 1. 原因与说明
+	f.StudentID = strings.TrimSpace(f.StudentID)
+	f.Comment = strings.TrimSpace(f.Comment)
+	if f.StudentID == "" {
+		return nil, serviceError(ErrInvalid, "请提供 student_id")
+	}
+	if !slices.Contains(storage.FlagReasons, f.Reason) {
+		return nil, serviceError(ErrInvalid, "无效的反馈原因: %s（可选 %s）", f.Reason, strings.Join(storage.FlagReasons, "/"))
+	}
+	if f.Reason == storage.FlagOther && f.Comment == "" {
+		return nil, serviceError(ErrInvalid, "原因为 other 时请填写说明")
+	}
+	if utf8.RuneCountInString(f.Comment) > maxFlagComment {
+		return nil, serviceError(ErrInvalid, "说明不能超过%d字", maxFlagComment)
+	}
+
+	// 2. 题目必须存在且未归档
+	db := s.db.WithContext(ctx)
+	q, err := db.GetQuestion(f.QuestionID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && q.Status == config.StatusArchived) {
+		return nil, serviceError(ErrNotFound, "题目不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询题目失败: %w", err)
+	}
+	f.WorkspaceID = q.WorkspaceID
+	if f.Verified, err = db.HasAttempted(f.StudentID, f.QuestionID); err != nil {
+		return nil, err
+	}
+
+	summary, err := db.CreateQuestionFlag(f, s.cfg.SuspendThreshold)
+	if errors.Is(err, storage.ErrFlagExists) {
+		return nil, serviceError(ErrConflict, "已经反馈过这道题，请等待老师处理")
+	}
+	return summary, err
+}
+
+// Handle 处理本工作区的反馈：按反馈ID处理，或处理 questionID 的全部未处理反馈。
+// 标记为已解决（resolved）要求题目在反馈之后修改过，反馈关联到对应的修订记录；
+// 不需要修改时标记为 dismissed。返回处理的反馈与恢复用于考试的题目ID
+func (s *FeedbackService) Handle(ctx context.Context, caller *Caller, ids []int, questionID int, status, note string) ([]storage.QuestionFlag, []int, error) {
+	if status != storage.FlagResolved && status != storage.FlagDismissed {
+		return nil, nil, serviceError(ErrInvalid, "无效的处理方式: %s", status)
+	}
+	if len(ids) == 0 && questionID <= 0 {
+		return nil, nil, serviceError(ErrInvalid, "请指定反馈ID或题目ID")
+	}
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > maxFlagNote {
+		return nil, nil, serviceError(ErrInvalid, "处理说明不能超过%d字", maxFlagNote)
+	}
+
+	db := s.db.WithContext(ctx)
+	ws := caller.Workspace
+	flags, err := db.OpenFlags(ws.ID, ids, questionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(flags) == 0 {
+		return nil, nil, serviceError(ErrNotFound, "没有待处理的反馈")
+	}
+	if status == storage.FlagResolved {
+		var unfixed []int
+		for _, f := range flags {
+			if f.RevisionID == 0 && !slices.Contains(unfixed, f.QuestionID) {
+				unfixed = append(unfixed, f.QuestionID)
+			}
+		}
+		if len(unfixed) > 0 {
+			return nil, nil, serviceError(ErrConflict, "题目 %v 在反馈之后没有修改过，修改后再标记为已解决，不需要修改请使用 dismiss", unfixed)
+		}
+	}
+	return db.CloseQuestionFlags(ws.ID, flags, status, note, caller.User, s.cfg.SuspendThreshold)
+}
+
+// SplitSuspended 去掉暂停用于考试的题目，返回其余题目与被去掉的题目ID
+func SplitSuspended(questions []storage.Question) ([]storage.Question, []int) {
+	kept := make([]storage.Question, 0, len(questions))
+	var suspended []int
+	for _, q := range questions {
+		if q.Suspended {
+			suspended = append(suspended, q.ID)
+			continue
+		}
+		kept = append(kept, q)
+	}
+	return kept, suspended
+}
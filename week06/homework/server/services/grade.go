@@ -0,0 +1,36 @@
+package services
+
+import (
+	"sort"
+	"strings"
+)
+
+// NormalizeOptions 统一选项格式：去空白、转大写、去重并排序
+func NormalizeOptions(options []string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(options))
+	for _, opt := range options {
+		opt = strings.ToUpper(strings.TrimSpace(opt))
+		if opt == "" || seen[opt] {
+			continue
+		}
+		seen[opt] = true
+		result = append(result, opt)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// GradeAnswer 所选选项（已经过 NormalizeOptions）与标准答案完全一致才算正确
+func GradeAnswer(rights, selected []string) bool {
+	expected := NormalizeOptions(rights)
+	if len(expected) == 0 || len(expected) != len(selected) {
+		return false
+	}
+	for i := range expected {
+		if expected[i] != selected[i] {
+			return false
+		}
+	}
+	return true
+}
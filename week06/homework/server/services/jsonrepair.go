@@ -0,0 +1,359 @@
+package services
+
+import (
+	"Server/config"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// 题目数组在包装对象中常用的字段名，按优先级排列
+var questionArrayKeys = []string{"questions", "items", "data", "result", "results"}
+
+// 题目自身的数组字段，单道题目的对象中这些字段不是题目数组
+var questionOwnArrays = map[string]bool{"answers": true, "rights": true, "explanations": true}
+
+// jsonRepairs 修复AI响应时所做的修改
+type jsonRepairs struct {
+	notes     []string // 每项修复的说明，返回给调用方并写入日志
+	truncated bool     // 输出被截断，只保留了完整的部分
+}
+
+func (r *jsonRepairs) add(format string, args ...interface{}) {
+	r.notes = append(r.notes, fmt.Sprintf(format, args...))
+}
+
+// jsonCut 截断时可以回退到的位置：一个数组元素（对象）刚好结束
+type jsonCut struct {
+	pos   int
+	stack []byte
+}
+
+// 最多尝试的JSON起始位置，说明文字中的括号通常只有几处
+const maxJSONStarts = 16
+
+// jsonScan 从某个起始位置复制出的JSON及其中的修复
+type jsonScan struct {
+	start    int
+	end      int // JSON 结束后的位置，截断时为 -1
+	out      []byte
+	cuts     []jsonCut
+	comments int
+	commas   int
+	newlines int
+}
+
+// extractJSON 从模型响应中取出JSON值并修复常见问题：Markdown 代码块与前后的说明文字、
+// 注释、多余的逗号、字符串中未转义的换行，以及因 max_tokens 截断而未闭合的结构
+// （回退到最后一个完整的数组元素后补全括号）。说明文字中也可能有括号（如“[注意]”），
+// 因此依次尝试可能的起始位置，取第一个能得到有效JSON的。返回修复后的JSON与所做修复的说明
+func extractJSON(content string) ([]byte, *jsonRepairs, error) {
+	repairs := &jsonRepairs{}
+	content = strings.TrimPrefix(strings.TrimSpace(content), "\ufeff")
+	starts := jsonStarts(content)
+	if len(starts) == 0 {
+		return nil, repairs, invalid("not_json", "响应内容中没有JSON")
+	}
+
+	// 1. 逐个起始位置尝试，都不是有效JSON时按第一个位置报告错误。
+	// 不尝试无效JSON内部的位置，避免格式有误的数组只取出其中一道题
+	var (
+		sc       *jsonScan
+		out      []byte
+		cutDepth int
+		rejected [][2]int
+	)
+	for i, start := range starts {
+		if slices.ContainsFunc(rejected, func(span [2]int) bool { return start > span[0] && start < span[1] }) {
+			continue
+		}
+		candidate := scanJSON(content, start)
+		data, depth := candidate.out, 0
+		if candidate.end < 0 {
+			data, depth = candidate.complete()
+		}
+		valid := data != nil && json.Valid(data)
+		if i == 0 || valid {
+			sc, out, cutDepth = candidate, data, depth
+		}
+		if valid {
+			break
+		}
+		end := candidate.end
+		if end < 0 {
+			end = len(content)
+		}
+		rejected = append(rejected, [2]int{start, end})
+	}
+
+	fenced := false
+	if prefix := strings.TrimSpace(content[:sc.start]); prefix != "" {
+		if strings.Contains(prefix, "```") {
+			fenced = true
+			prefix = strings.TrimSpace(prefix[:strings.LastIndex(prefix, "```")])
+		}
+		if prefix != "" {
+			repairs.add("去除 JSON 前的说明文字")
+		}
+	}
+	if sc.comments > 0 {
+		repairs.add("删除 %d 处注释", sc.comments)
+	}
+	if sc.commas > 0 {
+		repairs.add("删除 %d 处多余的逗号", sc.commas)
+	}
+	if sc.newlines > 0 {
+		repairs.add("转义字符串中的 %d 个换行符或制表符", sc.newlines)
+	}
+
+	// 2. JSON 之后的内容：代码块结束标记或说明文字
+	truncated := sc.end < 0
+	if !truncated {
+		rest := strings.TrimSpace(content[sc.end:])
+		if strings.HasPrefix(rest, "```") {
+			fenced = true
+			rest = strings.TrimSpace(strings.TrimPrefix(rest, "```"))
+		}
+		if rest != "" {
+			repairs.add("去除 JSON 后的多余内容")
+		}
+	}
+	if fenced {
+		repairs.notes = append([]string{"去除 Markdown 代码块标记"}, repairs.notes...)
+	}
+	if !truncated {
+		return out, repairs, nil
+	}
+
+	// 3. 输出被截断：已回退到层级最浅的最后一个完整元素并补全括号
+	if out == nil {
+		return nil, repairs, invalid("truncated", "响应内容被截断，没有可以保留的完整内容")
+	}
+	repairs.truncated = true
+	repairs.add("输出被截断（可能超过 max_tokens），去掉末尾不完整的内容并补全 %d 个括号", cutDepth)
+	return out, repairs, nil
+}
+
+// jsonStarts 可能的JSON起始位置，依次为：代码块开头、行首的括号、其他括号
+func jsonStarts(content string) []int {
+	var fenced, lineStart, other []int
+	if i := strings.Index(content, "```"); i >= 0 {
+		if n := strings.IndexByte(content[i:], '\n'); n >= 0 {
+			p := i + n + 1
+			for p < len(content) && strings.IndexByte(" \t\r\n", content[p]) >= 0 {
+				p++
+			}
+			if p < len(content) && (content[p] == '[' || content[p] == '{') {
+				fenced = append(fenced, p)
+			}
+		}
+	}
+	for i := 0; i < len(content); i++ {
+		if content[i] != '[' && content[i] != '{' {
+			continue
+		}
+		if strings.TrimSpace(content[strings.LastIndexByte(content[:i], '\n')+1:i]) == "" {
+			lineStart = append(lineStart, i)
+		} else {
+			other = append(other, i)
+		}
+	}
+
+	starts := make([]int, 0, maxJSONStarts)
+	seen := make(map[int]bool)
+	for _, list := range [][]int{fenced, lineStart, other} {
+		for _, p := range list {
+			if len(starts) == maxJSONStarts {
+				return starts
+			}
+			if !seen[p] {
+				seen[p] = true
+				starts = append(starts, p)
+			}
+		}
+	}
+	return starts
+}
+
+// scanJSON 从 start 开始逐字符复制一个JSON值，跳过注释与多余的逗号，记录每个数组元素结束的位置
+func scanJSON(content string, start int) *jsonScan {
+	sc := &jsonScan{start: start, end: -1, out: make([]byte, 0, len(content)-start)}
+	var (
+		stack    []byte
+		inString bool
+		escaped  bool
+	)
+	for i := start; i < len(content) && sc.end < 0; i++ {
+		ch := content[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+			case ch == '\n':
+				sc.out = append(sc.out, '\\', 'n')
+				sc.newlines++
+				continue
+			case ch == '\r':
+				continue
+			case ch == '\t':
+				sc.out = append(sc.out, '\\', 't')
+				sc.newlines++
+				continue
+			}
+			sc.out = append(sc.out, ch)
+			continue
+		}
+		switch ch {
+		case '"':
+			inString = true
+		case '/':
+			if i+1 < len(content) && content[i+1] == '/' {
+				if n := strings.IndexByte(content[i:], '\n'); n >= 0 {
+					i += n - 1
+				} else {
+					i = len(content)
+				}
+				sc.comments++
+				continue
+			}
+			if i+1 < len(content) && content[i+1] == '*' {
+				if n := strings.Index(content[i+2:], "*/"); n >= 0 {
+					i += n + 3
+				} else {
+					i = len(content)
+				}
+				sc.comments++
+				continue
+			}
+		case '{', '[':
+			stack = append(stack, ch)
+		case '}', ']':
+			if trimmed := bytes.TrimRight(sc.out, " \t\r\n"); len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				sc.out = trimmed[:len(trimmed)-1]
+				sc.commas++
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			sc.out = append(sc.out, ch)
+			if len(stack) == 0 {
+				sc.end = i + 1
+				continue
+			}
+			if ch == '}' && stack[len(stack)-1] == '[' {
+				sc.cuts = append(sc.cuts, jsonCut{pos: len(sc.out), stack: append([]byte(nil), stack...)})
+			}
+			continue
+		}
+		sc.out = append(sc.out, ch)
+	}
+	return sc
+}
+
+// complete 截断的JSON回退到层级最浅的最后一个完整元素，再补全括号；没有完整元素时返回 nil
+func (sc *jsonScan) complete() ([]byte, int) {
+	if len(sc.cuts) == 0 {
+		return nil, 0
+	}
+	cut := sc.cuts[len(sc.cuts)-1]
+	for i := len(sc.cuts) - 2; i >= 0; i-- {
+		if len(sc.cuts[i].stack) < len(cut.stack) {
+			cut = sc.cuts[i]
+		}
+	}
+	out := append([]byte(nil), sc.out[:cut.pos]...)
+	for i := len(cut.stack) - 1; i >= 0; i-- {
+		if cut.stack[i] == '{' {
+			out = append(out, '}')
+		} else {
+			out = append(out, ']')
+		}
+	}
+	return out, len(cut.stack)
+}
+
+// extractQuestions 从出题响应中取出题目数组，接受 {"questions": [...]} 等包装对象与单道题目的对象
+func extractQuestions(content string) ([]config.QuestionResponse, *jsonRepairs, error) {
+	data, repairs, err := extractJSON(content)
+	if err != nil {
+		return nil, repairs, err
+	}
+	if data[0] == '{' {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, repairs, invalid("invalid_json", "响应解析失败: %w", err)
+		}
+		key := arrayKey(obj)
+		switch {
+		case key != "":
+			data = obj[key]
+			repairs.add("从 {\"%s\": [...]} 中取出题目数组", key)
+		case obj["title"] != nil:
+			data = append(append([]byte{'['}, data...), ']')
+			repairs.add("单道题目的对象包装为数组")
+		default:
+			keys := make([]string, 0, len(obj))
+			for k := range obj {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return nil, repairs, invalid("not_json_array", "响应内容不是有效的JSON数组，对象中没有题目数组（字段：%s）", strings.Join(keys, "、"))
+		}
+	}
+
+	var items []config.QuestionResponse
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, repairs, invalid("invalid_json", "响应解析失败: %w", err)
+	}
+	return items, repairs, nil
+}
+
+// arrayKey 包装对象中题目数组的字段：优先常用字段名，否则取唯一的数组字段（题目自身的数组字段除外）
+func arrayKey(obj map[string]json.RawMessage) string {
+	isArray := func(raw json.RawMessage) bool {
+		raw = bytes.TrimSpace(raw)
+		return len(raw) > 0 && raw[0] == '['
+	}
+	for _, key := range questionArrayKeys {
+		if isArray(obj[key]) {
+			return key
+		}
+	}
+	found := ""
+	for key, raw := range obj {
+		if isArray(raw) && !questionOwnArrays[key] {
+			if found != "" {
+				return ""
+			}
+			found = key
+		}
+	}
+	return found
+}
+
+// logRepairs 记录修复过的AI响应，便于发现需要调整的提示词
+func logRepairs(model, operation string, notes []string) {
+	if len(notes) > 0 {
+		log.Printf("[AI] %s %s 响应已修复：%s", model, operation, strings.Join(notes, "；"))
+	}
+}
+
+// checkQuestionCount 题目数量必须与请求一致，输出被截断时接受已经完整生成的题目
+func checkQuestionCount(items []config.QuestionResponse, count int, repairs *jsonRepairs) error {
+	switch {
+	case len(items) == count:
+		return nil
+	case repairs.truncated && len(items) > 0 && len(items) < count:
+		repairs.add("只保留 %d 道完整的题目（请求 %d 道）", len(items), count)
+		return nil
+	}
+	return invalid("count_mismatch", "题目数量错误，预期 %d 道，实际 %d 道", count, len(items))
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"Server/config"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		want      string
+		notes     []string // 修复说明应包含的内容
+		truncated bool
+	}{
+		{
+			name:    "plain",
+			content: `[{"title":"a"}]`,
+			want:    `[{"title":"a"}]`,
+		},
+		{
+			name:    "fenced",
+			content: "```json\n[{\"title\":\"a\"}]\n```",
+			want:    `[{"title":"a"}]`,
+			notes:   []string{"去除 Markdown 代码块标记"},
+		},
+		{
+			name:    "fenced with prose",
+			content: "以下是生成的题目：\n```json\n[{\"title\":\"a\"}]\n```\n希望对你有帮助",
+			want:    `[{"title":"a"}]`,
+			notes:   []string{"去除 Markdown 代码块标记", "去除 JSON 前的说明文字", "去除 JSON 后的多余内容"},
+		},
+		{
+			name:    "bom",
+			content: "\ufeff{\"title\":\"a\"}",
+			want:    `{"title":"a"}`,
+		},
+		{
+			name:    "line comments",
+			content: "[\n  {\"title\": \"a\"}, // 第一题\n  {\"title\": \"http://x\"} // 字符串中的 // 不是注释\n]",
+			want:    "[\n  {\"title\": \"a\"}, \n  {\"title\": \"http://x\"} \n]",
+			notes:   []string{"删除 2 处注释"},
+		},
+		{
+			name:    "block comments",
+			content: `[/* 题目 */{"title": "a" /* 标题 */}]`,
+			want:    `[{"title": "a" }]`,
+			notes:   []string{"删除 2 处注释"},
+		},
+		{
+			name:    "trailing commas",
+			content: "[{\"answers\": [\"A\", \"B\",],},\n]",
+			want:    `[{"answers": ["A", "B"]}]`,
+			notes:   []string{"删除 3 处多余的逗号"},
+		},
+		{
+			name:    "newlines in strings",
+			content: "[{\"title\": \"第一行\n第二行\tx\"}]",
+			want:    `[{"title": "第一行\n第二行\tx"}]`,
+			notes:   []string{"转义字符串中的 2 个换行符或制表符"},
+		},
+		{
+			name:    "object wrapper",
+			content: `{"questions": [{"title":"a"}]}`,
+			want:    `{"questions": [{"title":"a"}]}`,
+		},
+		{
+			name:      "truncated array",
+			content:   "```json\n[{\"title\":\"a\",\"answers\":[\"x\"]},{\"title\":\"b\"},{\"title\":\"c\",\"ans",
+			want:      `[{"title":"a","answers":["x"]},{"title":"b"}]`,
+			notes:     []string{"去除 Markdown 代码块标记", "补全 1 个括号"},
+			truncated: true,
+		},
+		{
+			name:      "truncated wrapper",
+			content:   `{"questions": [{"title":"a"},{"title":"b`,
+			want:      `{"questions": [{"title":"a"}]}`,
+			notes:     []string{"补全 2 个括号"},
+			truncated: true,
+		},
+		{
+			name:    "bracket in prose",
+			content: "[注意] 以下是 3 道题目：\n[{\"title\":\"a\"}]",
+			want:    `[{"title":"a"}]`,
+			notes:   []string{"去除 JSON 前的说明文字"},
+		},
+		{
+			name:    "brace in prose",
+			content: "按照 {count} 道题的要求生成如下：[{\"title\":\"a\"}]",
+			want:    `[{"title":"a"}]`,
+			notes:   []string{"去除 JSON 前的说明文字"},
+		},
+		{
+			name:    "valid json in prose before fence",
+			content: "共 [1] 组题目：\n```json\n[{\"title\":\"a\"}]\n```",
+			want:    `[{"title":"a"}]`,
+			notes:   []string{"去除 Markdown 代码块标记", "去除 JSON 前的说明文字"},
+		},
+		{
+			name:      "truncated after bracket in prose",
+			content:   "[提示] 输出较长\n[{\"title\":\"a\"},{\"title\":\"b",
+			want:      `[{"title":"a"}]`,
+			notes:     []string{"去除 JSON 前的说明文字", "补全 1 个括号"},
+			truncated: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, repairs, err := extractJSON(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("data = %s, want %s", data, tt.want)
+			}
+			if repairs.truncated != tt.truncated {
+				t.Errorf("truncated = %v, want %v", repairs.truncated, tt.truncated)
+			}
+			notes := strings.Join(repairs.notes, "；")
+			for _, n := range tt.notes {
+				if !strings.Contains(notes, n) {
+					t.Errorf("notes %q do not contain %q", notes, n)
+				}
+			}
+			if len(tt.notes) == 0 && len(repairs.notes) > 0 {
+				t.Errorf("unexpected notes %q", notes)
+			}
+		})
+	}
+}
+
+func TestExtractJSONErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		reason  string
+	}{
+		{"no json", "抱歉，我无法生成这些题目。", "not_json"},
+		{"truncated without complete element", `[{"title":"a`, "truncated"},
+		{"truncated in prose bracket", "以下是题目 [{\"title\"", "truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := extractJSON(tt.content)
+			var validation *ValidationError
+			if !errors.As(err, &validation) {
+				t.Fatalf("err = %v, want ValidationError", err)
+			}
+			if validation.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q", validation.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestExtractQuestions(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		titles    []string
+		notes     []string
+		truncated bool
+	}{
+		{
+			name:    "array",
+			content: `[{"title":"a","answers":["x","y"],"rights":["x"]},{"title":"b"}]`,
+			titles:  []string{"a", "b"},
+		},
+		{
+			name:    "questions wrapper",
+			content: "```json\n{\"questions\": [{\"title\":\"a\"}, {\"title\":\"b\"},]}\n```",
+			titles:  []string{"a", "b"},
+			notes:   []string{`从 {"questions": [...]} 中取出题目数组`, "删除 1 处多余的逗号"},
+		},
+		{
+			name:    "other array field",
+			content: `{"count": 1, "list": [{"title":"a"}]}`,
+			titles:  []string{"a"},
+			notes:   []string{`从 {"list": [...]} 中取出题目数组`},
+		},
+		{
+			name:    "single object",
+			content: `{"title":"a","answers":["x"]}`,
+			titles:  []string{"a"},
+			notes:   []string{"单道题目的对象包装为数组"},
+		},
+		{
+			name:      "truncated",
+			content:   `[{"title":"a"},{"title":"b"},{"title":"c`,
+			titles:    []string{"a", "b"},
+			truncated: true,
+		},
+		{
+			name:    "bracket in prose",
+			content: "[说明] 题目如下\n// 共两道\n[{\"title\":\"a\"},{\"title\":\"b\"}]",
+			titles:  []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, repairs, err := extractQuestions(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var titles []string
+			for _, item := range items {
+				titles = append(titles, item.Title)
+			}
+			if !reflect.DeepEqual(titles, tt.titles) {
+				t.Errorf("titles = %v, want %v", titles, tt.titles)
+			}
+			if repairs.truncated != tt.truncated {
+				t.Errorf("truncated = %v, want %v", repairs.truncated, tt.truncated)
+			}
+			notes := strings.Join(repairs.notes, "；")
+			for _, n := range tt.notes {
+				if !strings.Contains(notes, n) {
+					t.Errorf("notes %q do not contain %q", notes, n)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractQuestionsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		reason  string
+	}{
+		{"object without questions", `{"error": "quota", "code": 429}`, "not_json_array"},
+		{"ambiguous arrays", `{"a": [1], "b": [2]}`, "not_json_array"},
+		{"unquoted keys", `[{title: "a"}]`, "invalid_json"},
+		// 格式有误的数组不会只取出其中一道题
+		{"invalid array", `[{"title":"a"}, {"title": b}]`, "invalid_json"},
+		{"wrong types", `[{"title": 1}]`, "invalid_json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := extractQuestions(tt.content)
+			var validation *ValidationError
+			if !errors.As(err, &validation) {
+				t.Fatalf("err = %v, want ValidationError", err)
+			}
+			if validation.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q (%v)", validation.Reason, tt.reason, err)
+			}
+		})
+	}
+}
+
+func TestCheckQuestionCount(t *testing.T) {
+	items := make([]config.QuestionResponse, 2)
+	if err := checkQuestionCount(items, 2, &jsonRepairs{}); err != nil {
+		t.Errorf("exact count: %v", err)
+	}
+	if err := checkQuestionCount(items, 3, &jsonRepairs{}); err == nil {
+		t.Error("missing questions without truncation should fail")
+	}
+	repairs := &jsonRepairs{truncated: true}
+	if err := checkQuestionCount(items, 3, repairs); err != nil || len(repairs.notes) != 1 {
+		t.Errorf("truncated: err = %v, notes = %v", err, repairs.notes)
+	}
+	if err := checkQuestionCount(items, 1, &jsonRepairs{truncated: true}); err == nil {
+		t.Error("more questions than requested should fail")
+	}
+}
@@ -0,0 +1,923 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"Server/telemetry"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// LTI 1.3 / Deep Linking 2.0 / AGS 2.0 的消息类型、声明与权限范围
+const (
+	LTIResourceLinkRequest = "LtiResourceLinkRequest"
+	LTIDeepLinkingRequest  = "LtiDeepLinkingRequest"
+	ltiDeepLinkingResponse = "LtiDeepLinkingResponse"
+	ltiVersion             = "1.3.0"
+
+	claimMessageType  = "https://purl.imsglobal.org/spec/lti/claim/message_type"
+	claimVersion      = "https://purl.imsglobal.org/spec/lti/claim/version"
+	claimDeploymentID = "https://purl.imsglobal.org/spec/lti/claim/deployment_id"
+	claimContentItems = "https://purl.imsglobal.org/spec/lti-dl/claim/content_items"
+	claimDeepLinkData = "https://purl.imsglobal.org/spec/lti-dl/claim/data"
+
+	LTIScopeScore = "https://purl.imsglobal.org/spec/lti-ags/scope/score"
+
+	ltiClockSkew        = time.Minute      // 允许的平台时钟偏差
+	ltiJWKSCacheTTL     = time.Hour        // 平台公钥缓存时间
+	ltiJWKSRefetchAfter = 10 * time.Second // 找不到 kid 时重新获取公钥的最短间隔
+	ltiPollInterval     = 5 * time.Second  // 没有新成绩时检查到期重试的间隔
+	ltiPassbackBatch    = 20               // 每轮回传的成绩数
+)
+
+// 具有这些角色的用户可以通过 Deep Linking 选择活动
+var ltiInstructorRoles = []string{"#Instructor", "#Administrator", "#ContentDeveloper"}
+
+// LTIService LTI 1.3 工具：OIDC 登录发起、启动消息校验、Deep Linking 响应与成绩回传（AGS）。
+// 工具私钥从 lti.key_file 加载，平台通过 JWKS 接口获取公钥
+type LTIService struct {
+	db     *storage.Database
+	cfg    config.LTIConfig
+	retry  config.EventsConfig
+	key    *rsa.PrivateKey
+	kid    string
+	client *http.Client
+	wake   chan struct{}
+
+	mu     sync.Mutex
+	jwks   map[string]*cachedJWKS // jwks_url -> 平台公钥
+	tokens map[int]cachedToken    // 平台ID -> 成绩服务访问令牌
+}
+
+type cachedJWKS struct {
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+type cachedToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewLTIService 加载工具私钥，文件不存在时生成并保存（0600）；成绩回传失败时按 events 的重试策略重试
+func NewLTIService(db *storage.Database, cfg config.LTIConfig, retry config.EventsConfig) (*LTIService, error) {
+	key, err := loadLTIKey(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key.PublicKey.N.Bytes())
+	return &LTIService{
+		db:     db,
+		cfg:    cfg,
+		retry:  retry,
+		key:    key,
+		kid:    base64.RawURLEncoding.EncodeToString(sum[:12]),
+		client: &http.Client{Timeout: retry.WebhookTimeout},
+		wake:   make(chan struct{}, 1),
+		jwks:   make(map[string]*cachedJWKS),
+		tokens: make(map[int]cachedToken),
+	}, nil
+}
+
+func loadLTIKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("生成 LTI 私钥失败: %w", err)
+		}
+		der, _ := x509.MarshalPKCS8PrivateKey(key)
+		if dir := filepath.Dir(path); dir != "." {
+			if err := os.MkdirAll(dir, 0o700); err != nil {
+				return nil, fmt.Errorf("创建 LTI 私钥目录失败: %w", err)
+			}
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			return nil, fmt.Errorf("保存 LTI 私钥失败: %w", err)
+		}
+		log.Printf("[LTI] 已生成工具私钥 %s", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 LTI 私钥失败: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("LTI 私钥 %s 不是 PEM 格式", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析 LTI 私钥失败: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("LTI 私钥 %s 不是 RSA 密钥", path)
+	}
+	return key, nil
+}
+
+// URL 本服务对外的地址
+func (s *LTIService) URL(path string) string {
+	return s.cfg.BaseURL + path
+}
+
+// LaunchURL 启动成功后浏览器跳转的答题页面，未配置 lti.launch_url 时使用内置页面
+func (s *LTIService) LaunchURL(token string) string {
+	target := s.cfg.LaunchURL
+	if target == "" {
+		target = s.URL("/api/lti/play")
+	}
+	sep := "?"
+	if strings.Contains(target, "?") {
+		sep = "&"
+	}
+	return target + sep + "lti_session=" + url.QueryEscape(token)
+}
+
+// JWK RSA 公钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// PublicJWK 把 RSA 公钥编码为 JWK
+func PublicJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// JWKS 工具公钥，平台用来校验 Deep Linking 响应与获取令牌时的签名
+func (s *LTIService) JWKS() map[string][]JWK {
+	return map[string][]JWK{"keys": {PublicJWK(s.kid, &s.key.PublicKey)}}
+}
+
+// ParseJWKS 解析 JWK Set 中的 RSA 公钥，按 kid 索引
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("JWKS 不是有效的 JSON: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.N, "="))
+		e, errE := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.E, "="))
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("JWKS 中的密钥 %q 格式错误", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS 中没有可用于签名校验的 RSA 公钥")
+	}
+	return keys, nil
+}
+
+// CheckLTIPlatform 校验平台配置：地址格式，离线公钥可以解析，没有离线公钥时必须提供 jwks_url
+func CheckLTIPlatform(p *storage.LTIPlatform) error {
+	if p.Issuer == "" || p.ClientID == "" {
+		return serviceError(ErrInvalid, "issuer 与 client_id 不能为空")
+	}
+	for name, raw := range map[string]string{"auth_login_url": p.AuthLoginURL, "auth_token_url": p.AuthTokenURL, "jwks_url": p.JWKSURL} {
+		if raw == "" && name != "auth_login_url" {
+			continue
+		}
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return serviceError(ErrInvalid, "%s 不是有效的 http(s) 地址: %q", name, raw)
+		}
+	}
+	if p.JWKS != "" {
+		if _, err := ParseJWKS([]byte(p.JWKS)); err != nil {
+			return &ServiceError{Kind: ErrInvalid, Msg: err.Error()}
+		}
+	} else if p.JWKSURL == "" {
+		return serviceError(ErrInvalid, "jwks 与 jwks_url 至少提供一个")
+	}
+	return nil
+}
+
+// LTILogin OIDC 第三方登录发起的参数（平台以 GET 或 POST 表单传入）
+type LTILogin struct {
+	Issuer         string `form:"iss" binding:"required"`
+	LoginHint      string `form:"login_hint" binding:"required"`
+	TargetLinkURI  string `form:"target_link_uri" binding:"required"`
+	LTIMessageHint string `form:"lti_message_hint"`
+	ClientID       string `form:"client_id"`
+	DeploymentID   string `form:"lti_deployment_id"`
+}
+
+// Login 处理登录发起：生成一次性的 state 与 nonce，返回跳转到平台授权地址的 URL
+func (s *LTIService) Login(ctx context.Context, req LTILogin) (string, error) {
+	db := s.db.WithContext(ctx)
+	// 1. 按 iss 与 client_id 找到平台
+	platforms, err := db.FindLTIPlatforms(req.Issuer, req.ClientID)
+	if err != nil {
+		return "", err
+	}
+	if len(platforms) == 0 {
+		return "", serviceError(ErrNotFound, "平台未登记: %s", req.Issuer)
+	}
+	if len(platforms) > 1 {
+		return "", serviceError(ErrInvalid, "平台 %s 登记了多个 client_id，登录请求需携带 client_id", req.Issuer)
+	}
+	p := platforms[0]
+	if req.DeploymentID != "" && len(p.DeploymentIDs) > 0 && !slices.Contains(p.DeploymentIDs, req.DeploymentID) {
+		return "", serviceError(ErrForbidden, "部署 %s 未在平台 %s 中登记", req.DeploymentID, p.Issuer)
+	}
+	if !strings.HasPrefix(req.TargetLinkURI, s.cfg.BaseURL+"/") {
+		return "", serviceError(ErrInvalid, "target_link_uri 不属于本工具: %s", req.TargetLinkURI)
+	}
+
+	// 2. 保存 state 与 nonce
+	state := &storage.LTIState{
+		State:      randomToken(),
+		Nonce:      randomToken(),
+		PlatformID: p.ID,
+		ExpiresAt:  time.Now().Add(s.cfg.StateTTL).Format("2006-01-02 15:04:05"),
+	}
+	if err := db.SaveLTIState(state); err != nil {
+		return "", err
+	}
+
+	// 3. 跳转到平台的授权地址，平台将 id_token 以表单 POST 到启动地址
+	q := url.Values{
+		"scope":         {"openid"},
+		"response_type": {"id_token"},
+		"response_mode": {"form_post"},
+		"prompt":        {"none"},
+		"client_id":     {p.ClientID},
+		"redirect_uri":  {s.URL("/api/lti/launch")},
+		"login_hint":    {req.LoginHint},
+		"state":         {state.State},
+		"nonce":         {state.Nonce},
+	}
+	if req.LTIMessageHint != "" {
+		q.Set("lti_message_hint", req.LTIMessageHint)
+	}
+	sep := "?"
+	if strings.Contains(p.AuthLoginURL, "?") {
+		sep = "&"
+	}
+	return p.AuthLoginURL + sep + q.Encode(), nil
+}
+
+// launchClaims 启动消息（id_token）中用到的声明
+type launchClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string         `json:"nonce"`
+	AZP           string         `json:"azp"`
+	Name          string         `json:"name"`
+	GivenName     string         `json:"given_name"`
+	FamilyName    string         `json:"family_name"`
+	MessageType   string         `json:"https://purl.imsglobal.org/spec/lti/claim/message_type"`
+	Version       string         `json:"https://purl.imsglobal.org/spec/lti/claim/version"`
+	DeploymentID  string         `json:"https://purl.imsglobal.org/spec/lti/claim/deployment_id"`
+	TargetLinkURI string         `json:"https://purl.imsglobal.org/spec/lti/claim/target_link_uri"`
+	Roles         []string       `json:"https://purl.imsglobal.org/spec/lti/claim/roles"`
+	Custom        map[string]any `json:"https://purl.imsglobal.org/spec/lti/claim/custom"`
+	ResourceLink  *struct {
+		ID string `json:"id"`
+	} `json:"https://purl.imsglobal.org/spec/lti/claim/resource_link"`
+	Context *struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	} `json:"https://purl.imsglobal.org/spec/lti/claim/context"`
+	AGS *struct {
+		Scope    []string `json:"scope"`
+		LineItem string   `json:"lineitem"`
+	} `json:"https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"`
+	DeepLinking *struct {
+		ReturnURL   string   `json:"deep_link_return_url"`
+		AcceptTypes []string `json:"accept_types"`
+		Data        string   `json:"data"`
+	} `json:"https://purl.imsglobal.org/spec/lti-dl/claim/deep_linking_settings"`
+}
+
+// Launch 校验平台 POST 的 id_token 并创建答题或选择活动的会话：
+// state 只能使用一次，签名（RS256，平台公钥）、iss、aud/azp、exp、nonce、版本、部署ID与消息类型都必须正确
+func (s *LTIService) Launch(ctx context.Context, idToken, state string) (*storage.LTISession, error) {
+	db := s.db.WithContext(ctx)
+	// 1. 取出登录发起时保存的 state，确定平台
+	st, err := db.ConsumeLTIState(state, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return nil, serviceError(ErrInvalid, "登录状态无效或已过期，请从课程中重新打开")
+	}
+	p, err := db.GetLTIPlatform(st.PlatformID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, serviceError(ErrNotFound, "平台不存在")
+	}
+
+	// 2. 校验签名与标准声明
+	var claims launchClaims
+	_, err = jwt.ParseWithClaims(idToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return s.platformKey(ctx, p, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(ltiClockSkew),
+	)
+	if err != nil {
+		return nil, serviceError(ErrForbidden, "id_token 校验失败: %v", err)
+	}
+	if (len(claims.Audience) > 1 || claims.AZP != "") && claims.AZP != p.ClientID {
+		return nil, serviceError(ErrForbidden, "id_token 的 azp 与 client_id 不一致")
+	}
+	if claims.Nonce != st.Nonce {
+		return nil, serviceError(ErrForbidden, "id_token 的 nonce 不匹配")
+	}
+	if claims.Subject == "" {
+		return nil, serviceError(ErrInvalid, "id_token 缺少 sub（不支持匿名启动）")
+	}
+
+	// 3. LTI 声明
+	if claims.Version != ltiVersion {
+		return nil, serviceError(ErrInvalid, "不支持的 LTI 版本: %q", claims.Version)
+	}
+	if claims.DeploymentID == "" || (len(p.DeploymentIDs) > 0 && !slices.Contains(p.DeploymentIDs, claims.DeploymentID)) {
+		return nil, serviceError(ErrForbidden, "部署 %q 未在平台中登记", claims.DeploymentID)
+	}
+
+	now := time.Now()
+	session := &storage.LTISession{
+		Token:        randomToken(),
+		PlatformID:   p.ID,
+		MessageType:  claims.MessageType,
+		DeploymentID: claims.DeploymentID,
+		Subject:      claims.Subject,
+		StudentID:    fmt.Sprintf("lti:%d:%s", p.ID, claims.Subject),
+		Name:         strings.TrimSpace(claims.Name),
+		Roles:        claims.Roles,
+		ExpiresAt:    now.Add(s.cfg.SessionTTL).Format("2006-01-02 15:04:05"),
+	}
+	if session.Name == "" {
+		session.Name = strings.TrimSpace(claims.GivenName + " " + claims.FamilyName)
+	}
+	if claims.Context != nil {
+		session.ContextTitle = claims.Context.Title
+	}
+
+	switch claims.MessageType {
+	case LTIResourceLinkRequest:
+		// 4. 课程中的链接：活动由 Deep Linking 时写入的自定义参数 activity_id 指定
+		if claims.ResourceLink == nil || claims.ResourceLink.ID == "" {
+			return nil, serviceError(ErrInvalid, "启动消息缺少 resource_link")
+		}
+		id, _ := strconv.Atoi(fmt.Sprint(claims.Custom["activity_id"]))
+		if id <= 0 {
+			return nil, serviceError(ErrInvalid, "该链接未关联考试或练习，请教师通过“添加内容”（Deep Linking）重新选择")
+		}
+		activity, err := db.GetLTIActivity(p.WorkspaceID, id)
+		if err != nil {
+			return nil, err
+		}
+		if activity == nil {
+			return nil, serviceError(ErrNotFound, "链接关联的活动 %d 已删除", id)
+		}
+		session.ActivityID = activity.ID
+		// 平台开通了成绩服务并为链接创建了成绩项时回传成绩
+		if claims.AGS != nil && claims.AGS.LineItem != "" && slices.Contains(claims.AGS.Scope, LTIScopeScore) {
+			session.LineItem = claims.AGS.LineItem
+			session.AGSScopes = claims.AGS.Scope
+		}
+	case LTIDeepLinkingRequest:
+		// 5. 教师选择要放入课程的活动
+		if claims.DeepLinking == nil || claims.DeepLinking.ReturnURL == "" {
+			return nil, serviceError(ErrInvalid, "Deep Linking 请求缺少 deep_link_return_url")
+		}
+		if len(claims.DeepLinking.AcceptTypes) > 0 && !slices.Contains(claims.DeepLinking.AcceptTypes, "ltiResourceLink") {
+			return nil, serviceError(ErrInvalid, "平台不接受 ltiResourceLink 类型的内容")
+		}
+		if !IsLTIInstructor(claims.Roles) {
+			return nil, serviceError(ErrForbidden, "只有教师可以选择考试或练习")
+		}
+		session.DeepLinkReturnURL = claims.DeepLinking.ReturnURL
+		session.DeepLinkData = claims.DeepLinking.Data
+	default:
+		return nil, serviceError(ErrInvalid, "不支持的消息类型: %q", claims.MessageType)
+	}
+
+	if err := db.CreateLTISession(session); err != nil {
+		return nil, err
+	}
+	log.Printf("[LTI] 平台#%d %s 启动 %s（活动#%d）", p.ID, session.StudentID, session.MessageType, session.ActivityID)
+	return session, nil
+}
+
+// IsLTIInstructor 角色中是否有教师、管理员或内容开发者（含机构角色）
+func IsLTIInstructor(roles []string) bool {
+	for _, role := range roles {
+		for _, suffix := range ltiInstructorRoles {
+			if strings.HasSuffix(role, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// platformKey 按 kid 查找平台公钥：优先使用离线配置的 JWKS，否则从 jwks_url 获取并缓存
+func (s *LTIService) platformKey(ctx context.Context, p *storage.LTIPlatform, kid string) (*rsa.PublicKey, error) {
+	if p.JWKS != "" {
+		keys, err := ParseJWKS([]byte(p.JWKS))
+		if err != nil {
+			return nil, err
+		}
+		return pickKey(keys, kid)
+	}
+
+	s.mu.Lock()
+	cached := s.jwks[p.JWKSURL]
+	s.mu.Unlock()
+	if cached != nil && time.Since(cached.fetchedAt) < ltiJWKSCacheTTL {
+		if key, err := pickKey(cached.keys, kid); err == nil || time.Since(cached.fetchedAt) < ltiJWKSRefetchAfter {
+			return key, err
+		}
+		// 平台可能轮换了密钥，重新获取
+	}
+	keys, err := s.fetchJWKS(ctx, p.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.jwks[p.JWKSURL] = &cachedJWKS{keys: keys, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return pickKey(keys, kid)
+}
+
+func (s *LTIService) fetchJWKS(ctx context.Context, jwksURL string) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("获取平台公钥失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取平台公钥失败: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("获取平台公钥失败: %w", err)
+	}
+	return ParseJWKS(data)
+}
+
+// pickKey kid 为空且只有一个公钥时直接使用
+func pickKey(keys map[string]*rsa.PublicKey, kid string) (*rsa.PublicKey, error) {
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("平台公钥中没有 kid=%q", kid)
+}
+
+// Session 查询未过期的会话
+func (s *LTIService) Session(ctx context.Context, token string) (*storage.LTISession, error) {
+	if token == "" {
+		return nil, serviceError(ErrForbidden, "缺少 LTI 会话")
+	}
+	session, err := s.db.WithContext(ctx).GetLTISession(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, serviceError(ErrForbidden, "LTI 会话无效或已过期，请从课程中重新打开")
+	}
+	return session, nil
+}
+
+// Platform 会话所属的平台
+func (s *LTIService) Platform(ctx context.Context, session *storage.LTISession) (*storage.LTIPlatform, error) {
+	p, err := s.db.WithContext(ctx).GetLTIPlatform(session.PlatformID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, serviceError(ErrNotFound, "平台不存在")
+	}
+	return p, nil
+}
+
+// Activity 学生会话对应的活动及其题目（按活动中的顺序，考试不含暂停用于考试的题目）
+func (s *LTIService) Activity(ctx context.Context, session *storage.LTISession) (*storage.LTIActivity, []storage.Question, error) {
+	if session.MessageType != LTIResourceLinkRequest {
+		return nil, nil, serviceError(ErrInvalid, "该会话用于选择活动，不能答题")
+	}
+	p, err := s.Platform(ctx, session)
+	if err != nil {
+		return nil, nil, err
+	}
+	db := s.db.WithContext(ctx)
+	activity, err := db.GetLTIActivity(p.WorkspaceID, session.ActivityID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if activity == nil {
+		return nil, nil, serviceError(ErrNotFound, "活动已删除")
+	}
+	list, err := db.ListQuestions(storage.QuestionFilter{WorkspaceID: p.WorkspaceID, IDs: activity.QuestionIDs})
+	if err != nil {
+		return nil, nil, err
+	}
+	if activity.Kind == storage.LTIExam {
+		list, _ = SplitSuspended(list) // 考试中不出现暂停的题目，也不计入成绩
+	}
+	byID := make(map[int]storage.Question, len(list))
+	for _, q := range list {
+		byID[q.ID] = q
+	}
+	questions := make([]storage.Question, 0, len(activity.QuestionIDs))
+	for _, id := range activity.QuestionIDs {
+		if q, ok := byID[id]; ok {
+			questions = append(questions, q)
+		}
+	}
+	return activity, questions, nil
+}
+
+// Submit 判分并保存学生的作答，有成绩项时排队回传成绩；未作答的题目按答错计算。
+// 考试默认只能提交一次，超过活动的提交次数时返回 ErrForbidden
+func (s *LTIService) Submit(ctx context.Context, session *storage.LTISession, answers map[int][]string) (*storage.LTISubmission, []storage.AnswerRecord, error) {
+	// 1. 活动与题目，只接受活动中的题目
+	activity, questions, err := s.Activity(ctx, session)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(questions) == 0 {
+		return nil, nil, serviceError(ErrInvalid, "活动中没有可作答的题目")
+	}
+	inActivity := make(map[int]bool, len(questions))
+	for _, q := range questions {
+		inActivity[q.ID] = true
+	}
+	for id := range answers {
+		if !inActivity[id] {
+			return nil, nil, serviceError(ErrInvalid, "题目 %d 不在该活动中", id)
+		}
+	}
+
+	// 2. 逐题判分
+	sub := &storage.LTISubmission{
+		PlatformID: session.PlatformID,
+		ActivityID: activity.ID,
+		Subject:    session.Subject,
+		StudentID:  session.StudentID,
+		Total:      len(questions),
+		LineItem:   session.LineItem,
+	}
+	records := make([]storage.AnswerRecord, 0, len(questions))
+	for _, q := range questions {
+		selected := NormalizeOptions(answers[q.ID])
+		correct := len(selected) > 0 && GradeAnswer(q.Rights, selected)
+		if correct {
+			sub.Correct++
+		}
+		records = append(records, storage.AnswerRecord{
+			QuestionID: q.ID,
+			StudentID:  session.StudentID,
+			Selected:   selected,
+			Correct:    correct,
+		})
+	}
+
+	// 3. 保存作答记录与提交记录
+	ok, err := s.db.WithContext(ctx).SaveLTISubmission(sub, records, activity.MaxAttempts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, serviceError(ErrForbidden, "已达到最多提交次数（%d 次）", activity.MaxAttempts)
+	}
+	if sub.PassbackStatus == storage.PassbackPending {
+		s.Notify()
+	}
+	return sub, records, nil
+}
+
+// LTIContentItem Deep Linking 返回给平台的内容
+type LTIContentItem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Text     string            `json:"text,omitempty"`
+	URL      string            `json:"url"`
+	Custom   map[string]string `json:"custom"`
+	LineItem *LTILineItem      `json:"lineItem,omitempty"`
+}
+
+// LTILineItem 平台为链接创建的成绩项
+type LTILineItem struct {
+	ScoreMaximum float64 `json:"scoreMaximum"`
+	Label        string  `json:"label"`
+	ResourceID   string  `json:"resourceId"`
+}
+
+// DeepLinkResponse 把教师选择的活动签名为 LtiDeepLinkingResponse，返回平台的接收地址与 JWT；
+// 会话随即失效，不能重复提交
+func (s *LTIService) DeepLinkResponse(ctx context.Context, session *storage.LTISession, activity *storage.LTIActivity) (string, string, error) {
+	if session.MessageType != LTIDeepLinkingRequest {
+		return "", "", serviceError(ErrInvalid, "该会话不是 Deep Linking 请求")
+	}
+	p, err := s.Platform(ctx, session)
+	if err != nil {
+		return "", "", err
+	}
+
+	kind := "练习"
+	if activity.Kind == storage.LTIExam {
+		kind = "考试"
+	}
+	item := LTIContentItem{
+		Type:   "ltiResourceLink",
+		Title:  activity.Title,
+		Text:   fmt.Sprintf("%s，共 %d 题", kind, len(activity.QuestionIDs)),
+		URL:    s.URL("/api/lti/launch"),
+		Custom: map[string]string{"activity_id": strconv.Itoa(activity.ID)},
+		LineItem: &LTILineItem{
+			ScoreMaximum: float64(len(activity.QuestionIDs)),
+			Label:        activity.Title,
+			ResourceID:   "activity-" + strconv.Itoa(activity.ID),
+		},
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":             p.ClientID,
+		"aud":             p.Issuer,
+		"iat":             now.Unix(),
+		"exp":             now.Add(5 * time.Minute).Unix(),
+		"nonce":           randomToken(),
+		claimMessageType:  ltiDeepLinkingResponse,
+		claimVersion:      ltiVersion,
+		claimDeploymentID: session.DeploymentID,
+		claimContentItems: []LTIContentItem{item},
+	}
+	if session.DeepLinkData != "" {
+		claims[claimDeepLinkData] = session.DeepLinkData
+	}
+	signed, err := s.sign(claims)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.db.WithContext(ctx).DeleteLTISession(session.Token); err != nil {
+		return "", "", err
+	}
+	log.Printf("[LTI] 平台#%d %s 选择了活动#%d", p.ID, session.StudentID, activity.ID)
+	return session.DeepLinkReturnURL, signed, nil
+}
+
+func (s *LTIService) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("签名失败: %w", err)
+	}
+	return signed, nil
+}
+
+// Notify 有新成绩等待回传时唤醒回传任务，不阻塞
+func (s *LTIService) Notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 回传到期的成绩并定期清理过期的会话，直到 ctx 取消
+func (s *LTIService) Run(ctx context.Context) {
+	ticker := time.NewTicker(ltiPollInterval)
+	defer ticker.Stop()
+	var lastPrune time.Time
+	for {
+		s.passback(ctx)
+		if time.Since(lastPrune) > time.Hour {
+			if n, err := s.db.WithContext(ctx).PruneLTISessions(time.Now()); err != nil {
+				log.Printf("[LTI] %v", err)
+			} else if n > 0 {
+				log.Printf("[LTI] 已清理 %d 个过期会话", n)
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// passback 逐个回传到期的成绩；服务退出导致的中断不计入次数，重启后继续回传
+func (s *LTIService) passback(ctx context.Context) {
+	db := s.db.WithContext(ctx)
+	for ctx.Err() == nil {
+		due, err := db.DuePassbacks(time.Now(), ltiPassbackBatch)
+		if err != nil {
+			log.Printf("[LTI] 读取待回传成绩失败: %v", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+		for i := range due {
+			sub := &due[i]
+			err := s.postScore(ctx, sub)
+			if ctx.Err() != nil {
+				return
+			}
+			status, next, outcome, msg := storage.PassbackSent, time.Now(), "success", ""
+			if err != nil {
+				attempt := sub.PassbackAttempts + 1
+				status, next, outcome, msg = storage.PassbackPending, time.Now().Add(retryDelay(s.retry, attempt)), "retry", err.Error()
+				if attempt >= s.retry.MaxAttempts {
+					status, outcome = storage.PassbackFailed, "failed"
+					log.Printf("[LTI] 提交#%d 的成绩在 %d 次尝试后回传失败: %v", sub.ID, attempt, err)
+				}
+			}
+			telemetry.LTIPassback(outcome)
+			if err := db.RecordPassback(sub.ID, status, msg, next); err != nil {
+				log.Printf("[LTI] 记录提交#%d 的回传结果失败: %v", sub.ID, err)
+				return
+			}
+		}
+	}
+}
+
+// postScore 按 AGS 把一次提交的得分发送到成绩项的 /scores
+func (s *LTIService) postScore(ctx context.Context, sub *storage.LTISubmission) error {
+	p, err := s.db.WithContext(ctx).GetLTIPlatform(sub.PlatformID)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return errors.New("平台已删除")
+	}
+	token, err := s.accessToken(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	submitted, _ := time.ParseInLocation("2006-01-02 15:04:05", sub.SubmittedAt, time.Local)
+	body, _ := json.Marshal(map[string]interface{}{
+		"userId":           sub.Subject,
+		"scoreGiven":       sub.Correct,
+		"scoreMaximum":     sub.Total,
+		"activityProgress": "Completed",
+		"gradingProgress":  "FullyGraded",
+		"timestamp":        submitted.Format(time.RFC3339),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, scoresURL(sub.LineItem), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.ims.lis.v1.score+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseLog))
+	if resp.StatusCode == http.StatusUnauthorized {
+		// 令牌可能已被平台吊销，下次重新获取
+		s.mu.Lock()
+		delete(s.tokens, p.ID)
+		s.mu.Unlock()
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.ToValidUTF8(string(snippet), ""))
+	}
+	return nil
+}
+
+// scoresURL 成绩项地址后追加 /scores，保留查询参数
+func scoresURL(lineItem string) string {
+	u, err := url.Parse(lineItem)
+	if err != nil {
+		return lineItem + "/scores"
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/scores"
+	return u.String()
+}
+
+// accessToken 用签名的 client_assertion 向平台获取成绩服务的访问令牌（OAuth2 client_credentials），缓存到过期前1分钟
+func (s *LTIService) accessToken(ctx context.Context, p *storage.LTIPlatform) (string, error) {
+	s.mu.Lock()
+	cached, ok := s.tokens[p.ID]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+	if p.AuthTokenURL == "" {
+		return "", errors.New("平台未配置 auth_token_url")
+	}
+
+	now := time.Now()
+	assertion, err := s.sign(jwt.MapClaims{
+		"iss": p.ClientID,
+		"sub": p.ClientID,
+		"aud": p.AuthTokenURL,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"jti": randomToken(),
+	})
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {assertion},
+		"scope":                 {LTIScopeScore},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.AuthTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("获取访问令牌失败: %w", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result)
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", fmt.Errorf("获取访问令牌失败: HTTP %d %s", resp.StatusCode, result.Error)
+	}
+	if result.ExpiresIn <= 0 {
+		result.ExpiresIn = 3600
+	}
+	s.mu.Lock()
+	s.tokens[p.ID] = cachedToken{value: result.AccessToken, expiresAt: now.Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)}
+	s.mu.Unlock()
+	return result.AccessToken, nil
+}
+
+// randomToken 32位十六进制随机串，用于 state、nonce 与会话
+func randomToken() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
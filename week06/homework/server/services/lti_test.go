@@ -0,0 +1,333 @@
+package services_test
+
+import (
+	"Server/config"
+	"Server/ltimock"
+	"Server/services"
+	"Server/storage"
+	"context"
+	"encoding/json"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ltiClientID   = "mock-client"
+	ltiDeployment = "mock-deployment"
+)
+
+// ltiEnv 工具（LTIService 与提供 JWKS 的 HTTP 服务）和模拟平台
+type ltiEnv struct {
+	svc      *services.LTIService
+	db       *storage.Database
+	mock     *ltimock.Platform
+	platform *storage.LTIPlatform
+	activity *storage.LTIActivity
+	tool     string
+	base     string
+}
+
+func newLTIEnv(t *testing.T) *ltiEnv {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := storage.InitDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	e := &ltiEnv{db: db}
+
+	// 平台获取令牌与接收 Deep Linking 响应时从工具的 JWKS 接口校验签名
+	toolMux := http.NewServeMux()
+	toolMux.HandleFunc("GET /api/lti/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(e.svc.JWKS())
+	})
+	tool := httptest.NewServer(toolMux)
+	t.Cleanup(tool.Close)
+	platformMux := http.NewServeMux()
+	platform := httptest.NewServer(platformMux)
+	t.Cleanup(platform.Close)
+	e.tool, e.base = tool.URL, platform.URL
+
+	e.svc, err = services.NewLTIService(db, config.LTIConfig{
+		KeyFile:    filepath.Join(dir, "lti.pem"),
+		BaseURL:    e.tool,
+		StateTTL:   time.Minute,
+		SessionTTL: time.Hour,
+	}, config.EventsConfig{WebhookTimeout: 5 * time.Second, MaxAttempts: 3, RetryBase: time.Second, RetryMax: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.mock, err = ltimock.New(ltimock.Config{Base: e.base, Tool: e.tool, ClientID: ltiClientID, Deployment: ltiDeployment})
+	if err != nil {
+		t.Fatal(err)
+	}
+	platformMux.Handle("/", e.mock.Handler())
+
+	e.platform = &storage.LTIPlatform{
+		WorkspaceID:   storage.DefaultWorkspaceID,
+		Name:          "模拟平台",
+		Issuer:        e.base,
+		ClientID:      ltiClientID,
+		DeploymentIDs: []string{ltiDeployment},
+		AuthLoginURL:  e.base + "/auth",
+		AuthTokenURL:  e.base + "/token",
+		JWKSURL:       e.base + "/jwks",
+	}
+	if err := db.CreateLTIPlatform(e.platform); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	for _, title := range []string{"a？", "b？"} {
+		id, err := db.CreateQuestion(storage.DefaultWorkspaceID, &config.QuestionRequest1{
+			Type:     config.SingleSelect,
+			Title:    title,
+			Language: "go",
+			Answers:  []string{"A: 1", "B: 2", "C: 3", "D: 4"},
+			Rights:   []string{"A"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	e.activity = &storage.LTIActivity{WorkspaceID: storage.DefaultWorkspaceID, Kind: storage.LTIPractice, Title: "练习", QuestionIDs: ids}
+	if err := db.CreateLTIActivity(e.activity); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// login 发起登录，返回跳转到平台的授权地址及其中的 state 与 nonce
+func (e *ltiEnv) login(t *testing.T, user, role, hint string) (string, string, string) {
+	t.Helper()
+	authURL, err := e.svc.Login(context.Background(), services.LTILogin{
+		Issuer:         e.base,
+		LoginHint:      user + "|" + role,
+		TargetLinkURI:  e.tool + "/api/lti/launch",
+		LTIMessageHint: hint,
+		ClientID:       ltiClientID,
+		DeploymentID:   ltiDeployment,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authURL, u.Query().Get("state"), u.Query().Get("nonce")
+}
+
+// deepLink 教师通过 Deep Linking 把活动放入课程，返回平台中的链接
+func (e *ltiEnv) deepLink(t *testing.T) ltimock.Link {
+	t.Helper()
+	ctx := context.Background()
+	_, state, nonce := e.login(t, "teacher", "Instructor", "deep-link")
+	claims, err := e.mock.LaunchClaims("teacher", "Instructor", nonce, "deep-link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := e.mock.IDToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := e.svc.Launch(ctx, idToken, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.MessageType != services.LTIDeepLinkingRequest || session.DeepLinkReturnURL != e.base+"/deep-link/return" {
+		t.Fatalf("session = %+v", session)
+	}
+
+	returnURL, signed, err := e.svc.DeepLinkResponse(ctx, session, e.activity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.PostForm(returnURL, url.Values{"JWT": {signed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("deep link return: HTTP %d", resp.StatusCode)
+	}
+	links := e.mock.Links()
+	if len(links) != 1 {
+		t.Fatalf("links = %+v", links)
+	}
+	return links[0]
+}
+
+var autoPostField = regexp.MustCompile(`name="(id_token|state)" value="([^"]*)"`)
+
+func TestLTIDeepLinkAndScorePassback(t *testing.T) {
+	e := newLTIEnv(t)
+	ctx := context.Background()
+
+	// 1. Deep Linking：平台用工具公钥校验响应，为链接创建成绩项
+	link := e.deepLink(t)
+	if link.Custom["activity_id"] != strconv.Itoa(e.activity.ID) || link.LineItem == "" || link.MaxScore != 2 {
+		t.Fatalf("link = %+v", link)
+	}
+
+	// 2. 学生打开链接：经过平台的授权接口取得 id_token
+	authURL, _, _ := e.login(t, "student1", "Learner", "link:"+strconv.Itoa(link.ID))
+	resp, err := http.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	form := map[string]string{}
+	for _, m := range autoPostField.FindAllStringSubmatch(string(page), -1) {
+		form[m[1]] = html.UnescapeString(m[2])
+	}
+	if form["id_token"] == "" || form["state"] == "" {
+		t.Fatalf("auth page: HTTP %d %s", resp.StatusCode, page)
+	}
+	session, err := e.svc.Launch(ctx, form["id_token"], form["state"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.ActivityID != e.activity.ID || session.LineItem != link.LineItem || session.Subject != "student1" {
+		t.Fatalf("session = %+v", session)
+	}
+
+	// 3. 提交后回传成绩：工具用 client_assertion 取得令牌，再向成绩项发送得分
+	sub, _, err := e.svc.Submit(ctx, session, map[int][]string{e.activity.QuestionIDs[0]: {"A"}, e.activity.QuestionIDs[1]: {"B"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Correct != 1 || sub.Total != 2 || sub.PassbackStatus != storage.PassbackPending {
+		t.Fatalf("submission = %+v", sub)
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		e.svc.Run(runCtx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(e.mock.Scores()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	scores := e.mock.Scores()
+	if len(scores) != 1 {
+		t.Fatalf("scores = %+v", scores)
+	}
+	s := scores[0]
+	if s.LineItem != link.LineItem || s.UserID != "student1" || s.ScoreGiven != 1 || s.ScoreMaximum != 2 || s.GradingProgress != "FullyGraded" {
+		t.Errorf("score = %+v", s)
+	}
+}
+
+func TestLTILaunchRejects(t *testing.T) {
+	e := newLTIEnv(t)
+	other, err := ltimock.New(ltimock.Config{Base: e.base, Tool: e.tool, ClientID: ltiClientID, Deployment: ltiDeployment})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		role   string
+		modify func(claims jwt.MapClaims)
+		signer *ltimock.Platform
+		kind   services.ErrorKind
+	}{
+		// 同一 kid 但由其他密钥签名
+		{name: "signature", signer: other, kind: services.ErrForbidden},
+		{name: "issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://other.example" }, kind: services.ErrForbidden},
+		{name: "audience", modify: func(c jwt.MapClaims) { c["aud"] = "other-client" }, kind: services.ErrForbidden},
+		{name: "azp", modify: func(c jwt.MapClaims) { c["azp"] = "other-client" }, kind: services.ErrForbidden},
+		{name: "expired", modify: func(c jwt.MapClaims) {
+			c["iat"] = time.Now().Add(-time.Hour).Unix()
+			c["exp"] = time.Now().Add(-10 * time.Minute).Unix()
+		}, kind: services.ErrForbidden},
+		{name: "no exp", modify: func(c jwt.MapClaims) { delete(c, "exp") }, kind: services.ErrForbidden},
+		{name: "nonce", modify: func(c jwt.MapClaims) { c["nonce"] = "other-nonce" }, kind: services.ErrForbidden},
+		{name: "deployment", modify: func(c jwt.MapClaims) {
+			c["https://purl.imsglobal.org/spec/lti/claim/deployment_id"] = "other-deployment"
+		}, kind: services.ErrForbidden},
+		{name: "version", modify: func(c jwt.MapClaims) {
+			c["https://purl.imsglobal.org/spec/lti/claim/version"] = "1.1"
+		}, kind: services.ErrInvalid},
+		{name: "learner deep link", role: "Learner", kind: services.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := tt.role
+			if role == "" {
+				role = "Instructor"
+			}
+			_, state, nonce := e.login(t, "teacher", role, "deep-link")
+			claims, err := e.mock.LaunchClaims("teacher", role, nonce, "deep-link")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			signer := e.mock
+			if tt.signer != nil {
+				signer = tt.signer
+			}
+			idToken, err := signer.IDToken(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = e.svc.Launch(context.Background(), idToken, state)
+			if kind := services.ErrorKindOf(err); kind != tt.kind {
+				t.Errorf("err = %v (kind %v), want kind %v", err, kind, tt.kind)
+			}
+		})
+	}
+}
+
+func TestLTILaunchStateReplay(t *testing.T) {
+	e := newLTIEnv(t)
+	ctx := context.Background()
+	_, state, nonce := e.login(t, "teacher", "Instructor", "deep-link")
+	claims, err := e.mock.LaunchClaims("teacher", "Instructor", nonce, "deep-link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := e.mock.IDToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.svc.Launch(ctx, idToken, state); err != nil {
+		t.Fatal(err)
+	}
+
+	// state 只能使用一次，重放同一个 id_token 被拒绝
+	if _, err := e.svc.Launch(ctx, idToken, state); services.ErrorKindOf(err) != services.ErrInvalid {
+		t.Errorf("replay: err = %v, want ErrInvalid", err)
+	}
+	if _, err := e.svc.Launch(ctx, idToken, "unknown-state"); services.ErrorKindOf(err) != services.ErrInvalid {
+		t.Errorf("unknown state: err = %v, want ErrInvalid", err)
+	}
+
+	// 另一次登录的 state 不能搭配这个 id_token 中的 nonce 使用
+	_, state2, _ := e.login(t, "teacher", "Instructor", "deep-link")
+	if _, err := e.svc.Launch(ctx, idToken, state2); services.ErrorKindOf(err) != services.ErrForbidden {
+		t.Errorf("nonce of another login: err = %v, want ErrForbidden", err)
+	}
+}
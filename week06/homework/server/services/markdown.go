@@ -0,0 +1,199 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// 代码高亮使用的配色
+const highlightStyle = "github"
+
+// 附件的下载地址前缀
+const attachmentURLPrefix = "/api/attachments/"
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(
+		extension.GFM,
+		highlighting.NewHighlighting(
+			highlighting.WithStyle(highlightStyle),
+			highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+		),
+	),
+	goldmark.WithParserOptions(parser.WithASTTransformers(util.Prioritized(attachmentLinks{}, 100))),
+)
+
+// AttachmentURL 附件的下载地址
+func AttachmentURL(id string) string {
+	return attachmentURLPrefix + id
+}
+
+// attachmentLinks 将图片与链接中的 attachment:<id> 改写为附件的下载地址
+type attachmentLinks struct{}
+
+func (attachmentLinks) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Image:
+			node.Destination = rewriteAttachment(node.Destination)
+		case *ast.Link:
+			node.Destination = rewriteAttachment(node.Destination)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func rewriteAttachment(dest []byte) []byte {
+	if id, ok := bytes.CutPrefix(dest, []byte(storage.AttachmentScheme)); ok {
+		return []byte(AttachmentURL(string(id)))
+	}
+	return dest
+}
+
+// 渲染结果的白名单：在UGC策略基础上保留代码高亮所需的class
+var sanitizer = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w\- ]+$`)).OnElements("pre", "code", "span")
+	return p
+}()
+
+// codeFence 一个代码块的开始标记
+type codeFence struct {
+	marker string // ``` 或 ~~~（可能更长）
+	line   int
+}
+
+// parseFence 判断一行是否为代码块标记，返回标记与其后的语言信息
+func parseFence(line string) (marker, info string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return "", "", false
+	}
+	ch := trimmed[0]
+	if ch != '`' && ch != '~' {
+		return "", "", false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == ch {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	info = strings.TrimSpace(trimmed[n:])
+	if ch == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return trimmed[:n], info, true
+}
+
+// scanFences 逐行扫描代码块，返回未闭合的代码块（nil表示全部闭合）
+// defaultLang 非空时，为没有标注语言的代码块补上语言，返回补全后的文本
+func scanFences(text, defaultLang string) (string, *codeFence) {
+	lines := strings.Split(text, "\n")
+	var open *codeFence
+	for i, line := range lines {
+		marker, info, ok := parseFence(line)
+		if !ok {
+			continue
+		}
+		if open == nil {
+			open = &codeFence{marker: marker, line: i + 1}
+			if info == "" && defaultLang != "" {
+				lines[i] = strings.TrimRight(line, " ") + defaultLang
+			}
+			continue
+		}
+		// 闭合标记须与开始标记字符相同、长度不短于开始标记，且不带语言信息
+		if info == "" && marker[0] == open.marker[0] && len(marker) >= len(open.marker) {
+			open = nil
+		}
+	}
+	return strings.Join(lines, "\n"), open
+}
+
+// CheckCodeFences 检查文本中的代码块是否成对闭合
+func CheckCodeFences(text string) error {
+	if _, open := scanFences(text, ""); open != nil {
+		return fmt.Errorf("第%d行开始的代码块（%s）未闭合", open.line, open.marker)
+	}
+	return nil
+}
+
+// ValidateQuestionMarkdown 校验题目标题、选项、解析与提示中的代码块均已闭合
+func ValidateQuestionMarkdown(title string, answers, explanations []string, hint string) error {
+	if err := CheckCodeFences(title); err != nil {
+		return fmt.Errorf("题目标题%s", err)
+	}
+	for i, ans := range answers {
+		if err := CheckCodeFences(ans); err != nil {
+			return fmt.Errorf("选项 %d %s", i+1, err)
+		}
+	}
+	for i, exp := range explanations {
+		if err := CheckCodeFences(exp); err != nil {
+			return fmt.Errorf("解析 %d %s", i+1, err)
+		}
+	}
+	if err := CheckCodeFences(hint); err != nil {
+		return fmt.Errorf("提示%s", err)
+	}
+	return nil
+}
+
+// validateResponseMarkdown AI返回的每道题都必须通过代码块校验
+func validateResponseMarkdown(items []config.QuestionResponse) error {
+	for i, q := range items {
+		if err := ValidateQuestionMarkdown(q.Title, q.Answers, q.Explanations, q.Hint); err != nil {
+			return invalid("code_fence", "第 %d 道题%s", i+1, err)
+		}
+	}
+	return nil
+}
+
+// RenderMarkdown 将Markdown渲染为经过清洗的HTML，代码块按语言做语法高亮
+// language 为未标注语言的代码块使用的默认语言（通常是题目的编程语言）
+func RenderMarkdown(text, language string) (string, error) {
+	text, _ = scanFences(text, strings.ToLower(language))
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(text), &buf); err != nil {
+		return "", fmt.Errorf("Markdown渲染失败: %w", err)
+	}
+	return sanitizer.Sanitize(buf.String()), nil
+}
+
+// HighlightCSS 代码高亮样式表（渲染结果使用class标注高亮）
+func HighlightCSS() (string, error) {
+	var buf bytes.Buffer
+	if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, styles.Get(highlightStyle)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// StripOptionPrefix 去掉选项的字母前缀，返回字母与正文
+func StripOptionPrefix(option string) (label, body string) {
+	body = stripOptionPrefix(option)
+	if body != option {
+		label = option[:1]
+	}
+	return label, body
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"Server/telemetry"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// QuestionService 题目的查询、录入、修改、删除与AI出题。
+// HTTP 接口与 gRPC 服务共用，校验、权限与日志保持一致
+type QuestionService struct {
+	db          *storage.Database
+	ai          AIService
+	logs        storage.Storage
+	attachments *AttachmentManager
+}
+
+func NewQuestionService(db *storage.Database, ai AIService, logs storage.Storage, attachments *AttachmentManager) *QuestionService {
+	return &QuestionService{db: db, ai: ai, logs: logs, attachments: attachments}
+}
+
+// Get 工作区可见的完整题目（含解析、提示、参考链接及解析来源）
+func (s *QuestionService) Get(ctx context.Context, caller *Caller, id int) (*storage.Question, error) {
+	if id <= 0 {
+		return nil, serviceError(ErrInvalid, "无效的题目ID: %d", id)
+	}
+	q, err := s.db.WithContext(ctx).GetVisibleQuestion(caller.Workspace.ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, serviceError(ErrNotFound, "题目不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询题目失败: %w", err)
+	}
+	return q, nil
+}
+
+// List 按题型、标题关键词与内容语言分页查询工作区可见的题目，返回当前页与总数
+func (s *QuestionService) List(ctx context.Context, caller *Caller, page storage.QuestionPage) ([]storage.Question, int, error) {
+	if page.Page < 1 || page.PageSize < 1 || page.PageSize > 100 {
+		return nil, 0, serviceError(ErrInvalid, "分页参数超出范围")
+	}
+	if page.Type < 0 || page.Type > 3 {
+		return nil, 0, serviceError(ErrInvalid, "无效的题目类型")
+	}
+	if page.Status != "" && page.Status != "all" && !slices.Contains(storage.QuestionStatuses, page.Status) {
+		return nil, 0, serviceError(ErrInvalid, "无效的题目状态: %s", page.Status)
+	}
+	return s.db.WithContext(ctx).PageQuestions(caller.Workspace.ID, page)
+}
+
+// Create 手动录入一道题，校验全部通过后才写入
+func (s *QuestionService) Create(ctx context.Context, caller *Caller, req *config.QuestionRequest1) (int, error) {
+	// 1. 题型与选项
+	if req.Type < 1 || req.Type > 3 {
+		return 0, serviceError(ErrInvalid, "无效的题目类型")
+	}
+	if len(req.Answers) != 4 {
+		return 0, serviceError(ErrInvalid, "必须提供4个选项")
+	}
+
+	// 2. Markdown代码块是否闭合、引用的附件是否存在
+	if err := s.checkContent(ctx, req); err != nil {
+		return 0, err
+	}
+
+	// 3. 工作区允许的语言与题目数上限
+	ws := caller.Workspace
+	if err := CheckLanguages(ws, req.Language); err != nil {
+		return 0, err
+	}
+	if err := CheckQuestionQuota(ctx, s.db, ws, 1); err != nil {
+		return 0, err
+	}
+
+	// 4. 写入题目与 question.created 事件
+	id, err := s.db.WithContext(ctx).CreateQuestion(ws.ID, req)
+	if err != nil {
+		return 0, fmt.Errorf("数据库创建失败: %w", err)
+	}
+	return id, nil
+}
+
+// Update 修改本工作区的单选/多选题（共享进来的题目只读），题型与答案同步到其他语言版本，
+// 返回修改的行数与同步的语言版本数
+func (s *QuestionService) Update(ctx context.Context, caller *Caller, req *config.QuestionRequest1) (affected, synced int64, err error) {
+	db := s.db.WithContext(ctx)
+	// 1. 题型、选项与答案标识
+	if req.Type != 1 && req.Type != 2 { // 1-单选 2-多选
+		return 0, 0, serviceError(ErrInvalid, "无效的题目类型")
+	}
+	if len(req.Answers) != 4 {
+		return 0, 0, serviceError(ErrInvalid, "必须提供4个选项")
+	}
+	validOptions := map[string]bool{"A": true, "B": true, "C": true, "D": true}
+	for _, ans := range req.Rights {
+		if !validOptions[ans] {
+			return 0, 0, serviceError(ErrInvalid, "存在无效选项标识")
+		}
+	}
+
+	// 2. Markdown代码块是否闭合、引用的附件是否存在
+	if err := s.checkContent(ctx, req); err != nil {
+		return 0, 0, err
+	}
+
+	// 3. 更新后清理不再被引用的附件
+	ws := caller.Workspace
+	refs, err := QuestionAttachmentRefs(db, ws.ID, []int{req.Id})
+	if err != nil {
+		return 0, 0, fmt.Errorf("查询题目失败: %w", err)
+	}
+	if affected, err = db.UpdateQuestion(ws.ID, req, caller.User); err != nil {
+		return 0, 0, fmt.Errorf("更新失败: %w", err)
+	}
+	if affected == 0 {
+		return 0, 0, nil
+	}
+	CollectAttachments(ctx, s.attachments, refs)
+
+	// 4. 题型与答案同步到其他语言版本
+	if synced, err = db.SyncVariantRights(req.Id); err != nil {
+		return affected, 0, fmt.Errorf("同步语言版本失败: %w", err)
+	}
+	return affected, synced, nil
+}
+
+// Delete 删除本工作区的题目并记录 question.deleted 事件（共享进来的题目不会被删除），返回实际删除的ID。
+// 题目被 LTI 活动或未结束的课堂测验引用时返回 ErrConflict，force 为 true 时仍然删除
+func (s *QuestionService) Delete(ctx context.Context, caller *Caller, ids []int, force bool) ([]int, error) {
+	if len(ids) == 0 {
+		return nil, serviceError(ErrInvalid, "请指定要删除的题目")
+	}
+	db := s.db.WithContext(ctx)
+	ws := caller.Workspace
+	if !force {
+		refs, err := db.QuestionReferences(ws.ID, ids)
+		if err != nil {
+			return nil, err
+		}
+		if len(refs) > 0 {
+			return nil, serviceError(ErrConflict, "%s，确认删除请使用 force", describeReferences(refs))
+		}
+	}
+	refs, err := QuestionAttachmentRefs(db, ws.ID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("查询题目失败: %w", err)
+	}
+	deleted, err := db.DeleteQuestions(ws.ID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("删除操作失败: %w", err)
+	}
+	CollectAttachments(ctx, s.attachments, refs)
+	return deleted, nil
+}
+
+// SetStatus 修改本工作区题目的状态，返回实际修改的ID。恢复已归档的题目会重新计入题目数上限
+func (s *QuestionService) SetStatus(ctx context.Context, caller *Caller, ids []int, status string) ([]int, error) {
+	if len(ids) == 0 {
+		return nil, serviceError(ErrInvalid, "请指定题目")
+	}
+	if !slices.Contains(storage.QuestionStatuses, status) {
+		return nil, serviceError(ErrInvalid, "无效的题目状态: %s（可选 %s）", status, strings.Join(storage.QuestionStatuses, "/"))
+	}
+	db := s.db.WithContext(ctx)
+	ws := caller.Workspace
+	if status != config.StatusArchived {
+		questions, err := db.ListQuestions(storage.QuestionFilter{IDs: ids})
+		if err != nil {
+			return nil, fmt.Errorf("查询题目失败: %w", err)
+		}
+		restored := 0
+		for _, q := range questions {
+			if q.WorkspaceID == ws.ID && q.Status == config.StatusArchived {
+				restored++
+			}
+		}
+		if restored > 0 {
+			if err := CheckQuestionQuota(ctx, s.db, ws, restored); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return db.SetQuestionStatus(ws.ID, ids, status)
+}
+
+// Generate 调用AI出题（结果不入库），未指定模型时使用工作区的默认服务。
+// 通过检查、开始调用AI前调用 started（可以为 nil），用于流式接口先通知客户端；
+// 每次调用都写入AI日志与 ai.generated 事件，AI调用失败时返回 ErrUpstream，日志中有失败原因
+func (s *QuestionService) Generate(ctx context.Context, caller *Caller, req config.QuestionRequest, started func(model string)) (*config.QuestionResponses, config.AILog, error) {
+	// 1. 工作区允许的语言与每日AI调用次数
+	ws := caller.Workspace
+	if err := CheckLanguages(ws, req.Language); err != nil {
+		return nil, config.AILog{}, err
+	}
+	if err := ConsumeAIQuota(ctx, s.db, ws, 1); err != nil {
+		return nil, config.AILog{}, err
+	}
+
+	// 2. 调用AI服务（记录实际使用的模型）
+	start := time.Now()
+	req.Model = s.ai.ResolveModel(WorkspaceModel(ws, req.Model))
+	if started != nil {
+		started(req.Model)
+	}
+	resp, err := s.ai.GenerateQuestion(ctx, req)
+
+	// 3. 写入AI日志与事件
+	entry := s.RecordGeneration(ctx, ws.ID, req, resp, err, start)
+	if err != nil {
+		return nil, entry, &ServiceError{Kind: ErrUpstream, Msg: err.Error()}
+	}
+	return resp, entry, nil
+}
+
+// RecordGeneration 写入一次AI出题调用的日志与 ai.generated 事件，失败只记录到服务日志
+func (s *QuestionService) RecordGeneration(ctx context.Context, workspaceID int, req config.QuestionRequest, resp *config.QuestionResponses, err error, start time.Time) config.AILog {
+	entry := BuildAILog(ctx, workspaceID, req, resp, err, start)
+	_, span := telemetry.Start(ctx, "storage.SaveAILog")
+	if saveErr := s.logs.Save(entry); saveErr != nil {
+		log.Printf("日志存储失败: %v", saveErr)
+		span.RecordError(saveErr)
+	}
+	span.End()
+
+	if eventErr := s.db.WithContext(ctx).RecordEvent(GeneratedEvent(workspaceID, req, entry)); eventErr != nil {
+		log.Printf("事件记录失败: %v", eventErr)
+	}
+	return entry
+}
+
+// BuildAILog 一次AI出题调用的日志
+func BuildAILog(ctx context.Context, workspaceID int, req config.QuestionRequest, resp *config.QuestionResponses, err error, start time.Time) config.AILog {
+	entry := config.AILog{
+		WorkspaceID: workspaceID,
+		AIStartTime: start.Format("2006-01-02 15:04:05"),
+		AIEndTime:   time.Now().Format("2006-01-02 15:04:05"),
+		AICostTime:  fmt.Sprintf("%.2fs", time.Since(start).Seconds()),
+		AIReq:       req,
+		Status:      "success",
+		TraceID:     telemetry.TraceID(ctx),
+	}
+	if err != nil {
+		entry.Status = "failed"
+		entry.Error = err.Error()
+	} else {
+		entry.AIRes = *resp
+		entry.Cache = resp.Cache
+	}
+	return entry
+}
+
+// GeneratedEvent 一次AI出题调用的 ai.generated 事件，题目尚未入库，question_ids 为空
+func GeneratedEvent(workspaceID int, req config.QuestionRequest, entry config.AILog) storage.Event {
+	return storage.NewEvent(workspaceID, storage.EventAIGenerated, nil, map[string]interface{}{
+		"model":     req.Model,
+		"type":      req.Type,
+		"language":  req.Language,
+		"keyword":   req.Keyword,
+		"status":    entry.Status,
+		"error":     entry.Error,
+		"questions": len(entry.AIRes.Questions),
+		"cache":     entry.Cache,
+		"cost_time": entry.AICostTime,
+		"trace_id":  entry.TraceID,
+	})
+}
+
+// checkContent 校验题目Markdown与引用的附件
+func (s *QuestionService) checkContent(ctx context.Context, req *config.QuestionRequest1) error {
+	if err := ValidateQuestionMarkdown(req.Title, req.Answers, req.Explanations, req.Hint); err != nil {
+		return &ServiceError{Kind: ErrInvalid, Msg: err.Error()}
+	}
+	return CheckAttachmentRefs(s.db.WithContext(ctx), QuestionTexts(req.Title, req.Answers, req.Explanations, req.Hint)...)
+}
+
+// CheckAttachmentRefs 检查文本中引用的附件是否都存在，db 需已绑定请求的上下文
+func CheckAttachmentRefs(db *storage.Database, texts ...string) error {
+	refs := storage.AttachmentRefs(texts...)
+	if len(refs) == 0 {
+		return nil
+	}
+	missing, err := db.MissingAttachments(refs)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return serviceError(ErrInvalid, "引用的附件不存在: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// QuestionTexts 题目中可能引用附件的文本：标题、选项、解析与提示
+func QuestionTexts(title string, answers, explanations []string, hint string) []string {
+	texts := append([]string{title, hint}, answers...)
+	return append(texts, explanations...)
+}
+
+// QuestionAttachmentRefs 工作区中这些题目引用的附件，修改或删除题目前查询，之后用于清理
+func QuestionAttachmentRefs(db *storage.Database, workspaceID int, ids []int) ([]string, error) {
+	questions, err := db.ListQuestions(storage.QuestionFilter{WorkspaceID: workspaceID, IDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for i := range questions {
+		refs = append(refs, storage.QuestionAttachmentRefs(&questions[i])...)
+	}
+	return refs, nil
+}
+
+// CollectAttachments 删除或修改题目后清理不再被引用的附件，失败只记录日志
+func CollectAttachments(ctx context.Context, manager *AttachmentManager, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	removed, err := manager.Collect(ctx, ids)
+	if err != nil {
+		log.Printf("[ATTACHMENT] %v", err)
+		return
+	}
+	if len(removed) > 0 {
+		log.Printf("[ATTACHMENT] 已清理 %d 个不再被引用的附件", len(removed))
+	}
+}
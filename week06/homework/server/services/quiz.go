@@ -0,0 +1,695 @@
+package services
+
+import (
+	"Server/storage"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	quizCodeLength      = 6
+	quizCodeAlphabet    = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // 去掉容易混淆的 I、O、0、1
+	quizClientBuffer    = 32                                 // 每个连接缓冲的消息数，写满时断开（学生可凭ID重连）
+	quizTickInterval    = time.Second                        // 倒计时推送间隔
+	quizLeaderboardSize = 10                                 // 每题公布答案后广播的排行榜人数
+	quizBasePoints      = 500                                // 答对的基础分，另按剩余时间比例最多再加 500
+	QuizMaxNameLength   = 20
+)
+
+// 房间所处阶段
+const (
+	quizPhaseLobby    = "lobby"    // 等待学生加入
+	quizPhaseQuestion = "question" // 正在作答
+	quizPhaseReveal   = "reveal"   // 已公布答案，等待下一题
+	quizPhaseFinished = "finished"
+)
+
+var (
+	ErrQuizFinished    = errors.New("测验已结束")
+	ErrQuizHostToken   = errors.New("主持人令牌错误")
+	ErrQuizParticipant = errors.New("参与者不存在，请重新加入")
+)
+
+// QuizQuestion 测验中的一道题。Content 是下发给学生的题目（不含答案与解析），
+// Rights 只用于服务端判分，公布答案时与解析一起下发
+type QuizQuestion struct {
+	ID           int
+	Content      interface{}
+	Rights       []string
+	Explanations []string
+}
+
+// QuizHub 课堂实时测验的房间管理。房间只保存在内存中，
+// 作答与得分随时写入数据库，服务退出时未结束的测验标记为中断
+type QuizHub struct {
+	db *storage.Database
+
+	mu    sync.Mutex
+	rooms map[string]*QuizRoom // 按加入码索引
+}
+
+func NewQuizHub(db *storage.Database) *QuizHub {
+	return &QuizHub{db: db, rooms: make(map[string]*QuizRoom)}
+}
+
+// Open 保存测验并打开房间，生成学生加入码与主持人令牌
+func (h *QuizHub) Open(ctx context.Context, session *storage.QuizSession, questions []QuizQuestion) (*QuizRoom, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// 1. 加入码在进行中的测验里唯一
+	for {
+		session.Code = newQuizCode()
+		if _, exists := h.rooms[session.Code]; !exists {
+			break
+		}
+	}
+	session.Status = storage.QuizWaiting
+	session.Current = -1
+	if err := h.db.WithContext(ctx).CreateQuizSession(session); err != nil {
+		return nil, err
+	}
+
+	// 2. 打开房间
+	room := &QuizRoom{
+		hub:       h,
+		session:   session,
+		questions: questions,
+		hostToken: generateUUID(),
+		phase:     quizPhaseLobby,
+		clients:   make(map[*QuizClient]struct{}),
+		players:   make(map[string]*storage.QuizParticipant),
+	}
+	h.rooms[session.Code] = room
+	return room, nil
+}
+
+// Room 按加入码查找进行中的测验，不区分大小写
+func (h *QuizHub) Room(code string) *QuizRoom {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.rooms[strings.ToUpper(strings.TrimSpace(code))]
+}
+
+// Live 测验是否仍在进行（房间未关闭）
+func (h *QuizHub) Live(sessionID int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.rooms {
+		if r.session.ID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// Run 每秒推送倒计时并在到时后公布答案，由 lifecycle.Manager 作为后台任务启动；
+// 服务退出时结束所有房间并将测验标记为中断
+func (h *QuizHub) Run(ctx context.Context) {
+	ticker := time.NewTicker(quizTickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			for _, r := range h.snapshot() {
+				r.mu.Lock()
+				r.finish(storage.QuizInterrupted)
+				r.mu.Unlock()
+			}
+			return
+		case now := <-ticker.C:
+			for _, r := range h.snapshot() {
+				r.tick(now)
+			}
+		}
+	}
+}
+
+func (h *QuizHub) snapshot() []*QuizRoom {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rooms := make([]*QuizRoom, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		rooms = append(rooms, r)
+	}
+	return rooms
+}
+
+func (h *QuizHub) remove(r *QuizRoom) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[r.session.Code] == r {
+		delete(h.rooms, r.session.Code)
+	}
+}
+
+// QuizRoom 一场进行中的测验，所有状态由 mu 保护
+type QuizRoom struct {
+	hub       *QuizHub
+	session   *storage.QuizSession
+	questions []QuizQuestion
+	hostToken string
+
+	mu         sync.Mutex
+	phase      string
+	clients    map[*QuizClient]struct{}
+	players    map[string]*storage.QuizParticipant
+	askedAt    time.Time
+	deadline   time.Time
+	answers    map[string]*storage.QuizAnswer // 当前题目的作答，按参与者ID索引
+	lastReveal []byte                         // 最近一次公布答案的消息，重连时补发
+}
+
+// HostToken 主持人（教师）连接时使用的令牌，只在创建测验时返回
+func (r *QuizRoom) HostToken() string {
+	return r.hostToken
+}
+
+// QuizClient 一个WebSocket连接：主持人或学生
+type QuizClient struct {
+	room   *QuizRoom
+	send   chan []byte
+	host   bool
+	player *storage.QuizParticipant
+	closed bool // 由 room.mu 保护
+}
+
+// Send 推送给该连接的消息，关闭表示连接应断开（测验结束或处理过慢）
+func (c *QuizClient) Send() <-chan []byte {
+	return c.send
+}
+
+// quizData 消息内容（与 gin.H 相同，services 不依赖 gin）
+type quizData map[string]interface{}
+
+// quizMessage 推送给客户端的消息
+type quizMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// quizCommand 客户端发送的消息：主持人 start/next/reveal/end，学生 answer
+type quizCommand struct {
+	Type     string   `json:"type"`
+	Selected []string `json:"selected"`
+}
+
+// quizRank 排行榜条目，不包含参与者ID（重连凭证）与学号
+type quizRank struct {
+	id      string
+	Rank    int    `json:"rank"`
+	Name    string `json:"name"`
+	Score   int    `json:"score"`
+	Correct int    `json:"correct"`
+}
+
+func encodeQuiz(typ string, data interface{}) []byte {
+	msg, _ := json.Marshal(quizMessage{Type: typ, Data: data})
+	return msg
+}
+
+// JoinHost 主持人加入，可以有多个主持人连接（如教师机与投影）
+func (r *QuizRoom) JoinHost(token string) (*QuizClient, error) {
+	if subtle.ConstantTimeCompare([]byte(token), []byte(r.hostToken)) != 1 {
+		return nil, ErrQuizHostToken
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.phase == quizPhaseFinished {
+		return nil, ErrQuizFinished
+	}
+	client := r.attach(&QuizClient{room: r, host: true})
+	r.deliver(client, r.stateMessages(client)...)
+	return client, nil
+}
+
+// JoinStudent 学生加入；participantID 不为空时恢复之前的身份（断线重连），得分与已作答的题目保留
+func (r *QuizRoom) JoinStudent(name, studentID, participantID string) (*QuizClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.phase == quizPhaseFinished {
+		return nil, ErrQuizFinished
+	}
+
+	// 1. 重连或创建参与者
+	player := r.players[participantID]
+	if participantID != "" && player == nil {
+		return nil, ErrQuizParticipant
+	}
+	if player == nil {
+		player = &storage.QuizParticipant{
+			SessionID: r.session.ID,
+			ID:        generateUUID(),
+			Name:      name,
+			StudentID: studentID,
+		}
+		if err := r.hub.db.AddQuizParticipant(player); err != nil {
+			return nil, err
+		}
+		r.players[player.ID] = player
+	}
+
+	// 2. 推送当前状态，并通知其他人
+	client := r.attach(&QuizClient{room: r, player: player})
+	r.deliver(client, r.stateMessages(client)...)
+	lobby := encodeQuiz("lobby", r.lobby())
+	for other := range r.clients {
+		if other != client {
+			r.deliver(other, lobby)
+		}
+	}
+	return client, nil
+}
+
+// Leave 连接断开；学生的身份保留，可以重连
+func (c *QuizClient) Leave() {
+	r := c.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c.closed {
+		return
+	}
+	r.detach(c)
+	if c.host {
+		return
+	}
+	r.broadcast(encodeQuiz("lobby", r.lobby()))
+	// 剩下的在线学生都已作答时不必等到倒计时结束
+	if r.phase == quizPhaseQuestion && r.allAnswered() {
+		r.reveal()
+	}
+}
+
+// Handle 处理客户端发送的消息
+func (c *QuizClient) Handle(data []byte) {
+	var cmd quizCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		c.room.reply(c, fmt.Errorf("消息格式错误: %v", err))
+		return
+	}
+
+	r := c.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c.closed {
+		return
+	}
+	var err error
+	switch {
+	case c.host && cmd.Type == "start":
+		err = r.start()
+	case c.host && cmd.Type == "next":
+		err = r.next()
+	case c.host && cmd.Type == "reveal":
+		if r.phase != quizPhaseQuestion {
+			err = errors.New("当前没有正在作答的题目")
+		} else {
+			r.reveal()
+		}
+	case c.host && cmd.Type == "end":
+		r.finish(storage.QuizFinished)
+	case !c.host && cmd.Type == "answer":
+		err = r.answer(c, cmd.Selected)
+	default:
+		err = fmt.Errorf("不支持的消息类型: %s", cmd.Type)
+	}
+	if err != nil {
+		r.deliver(c, encodeQuiz("error", quizData{"message": err.Error()}))
+	}
+}
+
+func (r *QuizRoom) reply(c *QuizClient, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliver(c, encodeQuiz("error", quizData{"message": err.Error()}))
+}
+
+// start 开始测验，推送第一题
+func (r *QuizRoom) start() error {
+	if r.phase != quizPhaseLobby {
+		return errors.New("测验已经开始")
+	}
+	r.session.StartedAt = time.Now().Format("2006-01-02 15:04:05")
+	r.ask(0)
+	return nil
+}
+
+// next 公布答案后进入下一题，最后一题之后结束测验
+func (r *QuizRoom) next() error {
+	switch r.phase {
+	case quizPhaseLobby:
+		return r.start()
+	case quizPhaseQuestion:
+		return errors.New("请先公布本题答案")
+	}
+	if r.session.Current+1 >= len(r.questions) {
+		r.finish(storage.QuizFinished)
+		return nil
+	}
+	r.ask(r.session.Current + 1)
+	return nil
+}
+
+// ask 推送第 index 题并开始倒计时
+func (r *QuizRoom) ask(index int) {
+	now := time.Now()
+	r.phase = quizPhaseQuestion
+	r.session.Status = storage.QuizRunning
+	r.session.Current = index
+	r.askedAt = now
+	r.deadline = now.Add(time.Duration(r.session.Seconds) * time.Second)
+	r.answers = make(map[string]*storage.QuizAnswer)
+	r.lastReveal = nil
+	if err := r.hub.db.UpdateQuizSession(r.session); err != nil {
+		log.Printf("[QUIZ] %v", err)
+	}
+	r.broadcast(r.questionMessage())
+}
+
+// tick 推送倒计时，到时公布答案
+func (r *QuizRoom) tick(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.phase != quizPhaseQuestion {
+		return
+	}
+	remaining := int(math.Ceil(r.deadline.Sub(now).Seconds()))
+	if remaining <= 0 {
+		r.reveal()
+		return
+	}
+	r.broadcast(encodeQuiz("countdown", quizData{
+		"index":     r.session.Current,
+		"remaining": remaining,
+		"answered":  len(r.answers),
+		"online":    r.online(),
+	}))
+}
+
+// answer 判分并保存学生对当前题目的作答。答对得 500 分，另按剩余时间比例最多加 500 分
+func (r *QuizRoom) answer(c *QuizClient, selected []string) error {
+	// 1. 只能在倒计时内作答一次
+	if r.phase != quizPhaseQuestion {
+		return errors.New("当前没有正在作答的题目")
+	}
+	now := time.Now()
+	if now.After(r.deadline) {
+		return errors.New("作答时间已到")
+	}
+	if _, done := r.answers[c.player.ID]; done {
+		return errors.New("本题已经作答")
+	}
+	selected = NormalizeOptions(selected)
+	if len(selected) == 0 {
+		return errors.New("请选择答案")
+	}
+
+	// 2. 判分并保存
+	q := r.questions[r.session.Current]
+	total := r.deadline.Sub(r.askedAt)
+	ans := &storage.QuizAnswer{
+		SessionID:     r.session.ID,
+		QuestionID:    q.ID,
+		ParticipantID: c.player.ID,
+		Selected:      selected,
+		Correct:       GradeAnswer(q.Rights, selected),
+		ElapsedMs:     now.Sub(r.askedAt).Milliseconds(),
+	}
+	if ans.Correct {
+		ans.Points = quizBasePoints + int(float64(quizBasePoints)*float64(r.deadline.Sub(now))/float64(total))
+	}
+	if err := r.hub.db.SaveQuizAnswer(ans, c.player.StudentID); err != nil {
+		log.Printf("[QUIZ] %v", err)
+		return errors.New("保存作答失败，请重试")
+	}
+	r.answers[c.player.ID] = ans
+	c.player.Score += ans.Points
+	if ans.Correct {
+		c.player.Correct++
+	}
+
+	// 3. 确认收到（结果在公布答案时下发），通知主持人作答进度
+	for client := range r.clients {
+		if client.player == c.player {
+			r.deliver(client, encodeQuiz("ack", quizData{"index": r.session.Current, "selected": selected}))
+		}
+	}
+	r.toHosts(encodeQuiz("answered", quizData{
+		"index":    r.session.Current,
+		"answered": len(r.answers),
+		"online":   r.online(),
+	}))
+	if r.allAnswered() {
+		r.reveal()
+	}
+	return nil
+}
+
+// reveal 公布答案：广播答案、解析、选项分布与排行榜，并向每个学生推送本题结果
+func (r *QuizRoom) reveal() {
+	q := r.questions[r.session.Current]
+	r.phase = quizPhaseReveal
+
+	distribution := make(map[string]int)
+	correct := 0
+	for _, ans := range r.answers {
+		for _, opt := range ans.Selected {
+			distribution[opt]++
+		}
+		if ans.Correct {
+			correct++
+		}
+	}
+	ranking := r.ranking()
+	top := ranking
+	if len(top) > quizLeaderboardSize {
+		top = top[:quizLeaderboardSize]
+	}
+	r.lastReveal = encodeQuiz("reveal", quizData{
+		"index":        r.session.Current,
+		"question_id":  q.ID,
+		"rights":       NormalizeOptions(q.Rights),
+		"explanations": q.Explanations,
+		"answered":     len(r.answers),
+		"correct":      correct,
+		"distribution": distribution,
+		"leaderboard":  top,
+		"last":         r.session.Current+1 >= len(r.questions),
+	})
+	r.broadcast(r.lastReveal)
+	for client := range r.clients {
+		if !client.host {
+			r.deliver(client, r.resultMessage(client.player, ranking))
+		}
+	}
+}
+
+// finish 结束测验：保存状态，推送完整排行榜后断开所有连接并关闭房间
+func (r *QuizRoom) finish(status string) {
+	if r.phase == quizPhaseFinished {
+		return
+	}
+	r.phase = quizPhaseFinished
+	r.session.Status = status
+	r.session.FinishedAt = time.Now().Format("2006-01-02 15:04:05")
+	if err := r.hub.db.UpdateQuizSession(r.session); err != nil {
+		log.Printf("[QUIZ] %v", err)
+	}
+	r.broadcast(encodeQuiz("finished", quizData{"status": status, "leaderboard": r.ranking()}))
+	for client := range r.clients {
+		r.detach(client)
+	}
+	r.hub.remove(r)
+}
+
+// stateMessages 新连接（或重连）需要的消息：欢迎信息，以及正在进行的题目或刚公布的答案
+func (r *QuizRoom) stateMessages(c *QuizClient) [][]byte {
+	welcome := quizData{
+		"session_id": r.session.ID,
+		"code":       r.session.Code,
+		"title":      r.session.Title,
+		"total":      len(r.questions),
+		"seconds":    r.session.Seconds,
+		"phase":      r.phase,
+		"current":    r.session.Current,
+	}
+	if c.host {
+		welcome["role"] = "host"
+	} else {
+		welcome["role"] = "student"
+		welcome["participant_id"] = c.player.ID // 断线后凭此重连
+		welcome["name"] = c.player.Name
+		welcome["score"] = c.player.Score
+	}
+	msgs := [][]byte{encodeQuiz("welcome", welcome), encodeQuiz("lobby", r.lobby())}
+	switch r.phase {
+	case quizPhaseQuestion:
+		msgs = append(msgs, r.questionMessage())
+		if !c.host {
+			if ans, ok := r.answers[c.player.ID]; ok {
+				msgs = append(msgs, encodeQuiz("ack", quizData{"index": r.session.Current, "selected": ans.Selected}))
+			}
+		}
+	case quizPhaseReveal:
+		msgs = append(msgs, r.lastReveal)
+		if !c.host {
+			msgs = append(msgs, r.resultMessage(c.player, r.ranking()))
+		}
+	}
+	return msgs
+}
+
+func (r *QuizRoom) questionMessage() []byte {
+	q := r.questions[r.session.Current]
+	return encodeQuiz("question", quizData{
+		"index":     r.session.Current,
+		"total":     len(r.questions),
+		"seconds":   r.session.Seconds,
+		"remaining": int(math.Ceil(time.Until(r.deadline).Seconds())),
+		"question":  q.Content,
+	})
+}
+
+// resultMessage 学生本题的结果与当前名次
+func (r *QuizRoom) resultMessage(p *storage.QuizParticipant, ranking []quizRank) []byte {
+	data := quizData{"index": r.session.Current, "answered": false, "correct": false, "points": 0, "score": p.Score}
+	if ans, ok := r.answers[p.ID]; ok {
+		data["answered"] = true
+		data["correct"] = ans.Correct
+		data["points"] = ans.Points
+	}
+	for _, rank := range ranking {
+		if rank.id == p.ID {
+			data["rank"] = rank.Rank
+			break
+		}
+	}
+	data["participants"] = len(ranking)
+	return encodeQuiz("result", data)
+}
+
+// sortedPlayers 按排行榜顺序排列的参与者
+func (r *QuizRoom) sortedPlayers() []storage.QuizParticipant {
+	list := make([]storage.QuizParticipant, 0, len(r.players))
+	for _, p := range r.players {
+		list = append(list, *p)
+	}
+	storage.SortQuizLeaderboard(list)
+	return list
+}
+
+// ranking 排行榜，同分同名次
+func (r *QuizRoom) ranking() []quizRank {
+	players := r.sortedPlayers()
+	ranking := make([]quizRank, len(players))
+	for i, p := range players {
+		rank := i + 1
+		if i > 0 && p.Score == players[i-1].Score && p.Correct == players[i-1].Correct {
+			rank = ranking[i-1].Rank
+		}
+		ranking[i] = quizRank{id: p.ID, Rank: rank, Name: p.Name, Score: p.Score, Correct: p.Correct}
+	}
+	return ranking
+}
+
+// lobby 参与人数与在线学生名单
+func (r *QuizRoom) lobby() quizData {
+	names := []string{}
+	for _, p := range r.onlinePlayers() {
+		names = append(names, p.Name)
+	}
+	return quizData{"participants": len(r.players), "online": len(names), "names": names}
+}
+
+// onlinePlayers 在线的学生（同一学生多个连接只计一次）
+func (r *QuizRoom) onlinePlayers() []*storage.QuizParticipant {
+	seen := make(map[string]bool)
+	var players []*storage.QuizParticipant
+	for c := range r.clients {
+		if !c.host && !seen[c.player.ID] {
+			seen[c.player.ID] = true
+			players = append(players, c.player)
+		}
+	}
+	return players
+}
+
+func (r *QuizRoom) online() int {
+	return len(r.onlinePlayers())
+}
+
+// allAnswered 在线学生是否都已作答
+func (r *QuizRoom) allAnswered() bool {
+	players := r.onlinePlayers()
+	for _, p := range players {
+		if _, ok := r.answers[p.ID]; !ok {
+			return false
+		}
+	}
+	return len(players) > 0
+}
+
+func (r *QuizRoom) attach(c *QuizClient) *QuizClient {
+	c.send = make(chan []byte, quizClientBuffer)
+	r.clients[c] = struct{}{}
+	return c
+}
+
+func (r *QuizRoom) detach(c *QuizClient) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.send)
+	delete(r.clients, c)
+}
+
+// deliver 不阻塞地推送消息，缓冲写满说明连接处理过慢，直接断开
+func (r *QuizRoom) deliver(c *QuizClient, msgs ...[]byte) {
+	for _, msg := range msgs {
+		if c.closed {
+			return
+		}
+		select {
+		case c.send <- msg:
+		default:
+			log.Printf("[QUIZ] 测验 %d 的连接处理过慢，已断开", r.session.ID)
+			r.detach(c)
+		}
+	}
+}
+
+func (r *QuizRoom) broadcast(msg []byte) {
+	for c := range r.clients {
+		r.deliver(c, msg)
+	}
+}
+
+func (r *QuizRoom) toHosts(msg []byte) {
+	for c := range r.clients {
+		if c.host {
+			r.deliver(c, msg)
+		}
+	}
+}
+
+// newQuizCode 随机生成学生加入码
+func newQuizCode() string {
+	buf := make([]byte, quizCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		panic("加入码生成失败: " + err.Error())
+	}
+	for i, b := range buf {
+		buf[i] = quizCodeAlphabet[int(b)%len(quizCodeAlphabet)]
+	}
+	return string(buf)
+}
@@ -0,0 +1,616 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	embeddingDebounce  = 2 * time.Second // 收到题目变更后等待片刻再核对，合并连续的变更
+	maxCoverageCluster = 30
+	kmeansIterations   = 25
+	summaryLength      = 60 // 聚类代表题目的标题摘要长度
+)
+
+// EmbeddingIndex 题目向量索引：向量保存在 question_embeddings 表中，内存中保留一份用于检索。
+// 后台任务按题目内容摘要增量更新，只为新增或修改过的题目计算向量
+type EmbeddingIndex struct {
+	db       *storage.Database
+	embedder Embedder
+	cfg      config.EmbeddingConfig
+	wake     chan struct{}
+
+	mu      sync.RWMutex
+	entries map[int]*indexedQuestion
+	idf     []float32 // 本地向量的逆文档频率，远程向量为 nil
+}
+
+// indexedQuestion 内存中的索引项，vec 为加权并归一化后的向量
+type indexedQuestion struct {
+	id, workspaceID, group, typ int
+	language                    string
+	tags                        []string
+	summary                     string
+	raw                         []float32
+	vec                         []float32
+}
+
+// RelatedQuestion 检索结果
+type RelatedQuestion struct {
+	ID    int     `json:"id"`
+	Score float64 `json:"score"` // 余弦相似度
+}
+
+// SearchFilter 检索条件，工作区必填，其余为空时不限
+type SearchFilter struct {
+	WorkspaceID int
+	Type        int
+	Language    string
+	Limit       int
+	MinScore    float64
+	Exclude     int // 排除该题目及其所有语言版本
+}
+
+func NewEmbeddingIndex(db *storage.Database, cfg config.EmbeddingConfig) *EmbeddingIndex {
+	return &EmbeddingIndex{
+		db:       db,
+		embedder: NewEmbedder(cfg),
+		cfg:      cfg,
+		wake:     make(chan struct{}, 1),
+		entries:  make(map[int]*indexedQuestion),
+	}
+}
+
+// Model 当前使用的向量模型
+func (x *EmbeddingIndex) Model() string {
+	return x.embedder.Model()
+}
+
+// Size 已建立索引的题目数
+func (x *EmbeddingIndex) Size() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.entries)
+}
+
+// Notify 题目有变更时唤醒核对，不阻塞
+func (x *EmbeddingIndex) Notify() {
+	select {
+	case x.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 启动时核对一次，之后在题目变更或每隔 sync_interval 时核对
+func (x *EmbeddingIndex) Run(ctx context.Context) {
+	x.sync(ctx)
+	ticker := time.NewTicker(x.cfg.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-x.wake:
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(embeddingDebounce):
+			}
+		case <-ticker.C:
+		}
+		x.sync(ctx)
+	}
+}
+
+// sync 核对题目与索引：计算新增或内容变化的题目的向量，删除已不存在的题目，然后刷新内存中的索引
+func (x *EmbeddingIndex) sync(ctx context.Context) {
+	if err := x.Sync(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("[EMBEDDING] 更新向量索引失败: %v", err)
+	}
+}
+
+// Sync 同步执行一次核对
+func (x *EmbeddingIndex) Sync(ctx context.Context) error {
+	db := x.db.WithContext(ctx)
+	questions, err := db.ListQuestions(storage.QuestionFilter{})
+	if err != nil {
+		return err
+	}
+	states, err := db.EmbeddingStates()
+	if err != nil {
+		return err
+	}
+
+	// 1. 找出需要计算的题目
+	model := x.embedder.Model()
+	var pending []storage.QuestionEmbedding
+	var texts []string
+	exists := make(map[int]bool, len(questions))
+	for i := range questions {
+		q := &questions[i]
+		exists[q.ID] = true
+		text := embeddingText(q)
+		hash := contentHash(text)
+		if s, ok := states[q.ID]; ok && s.Model == model && s.ContentHash == hash {
+			continue
+		}
+		pending = append(pending, storage.QuestionEmbedding{QuestionID: q.ID, Model: model, ContentHash: hash})
+		texts = append(texts, text)
+	}
+	var removed []int
+	for id := range states {
+		if !exists[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	x.mu.RLock()
+	loaded := len(x.entries) > 0 || len(questions) == 0
+	x.mu.RUnlock()
+	if len(pending) == 0 && len(removed) == 0 && loaded {
+		return nil
+	}
+
+	// 2. 分批计算并保存，失败时已保存的批次保留，下次只计算剩余部分
+	var embedErr error
+	for start := 0; start < len(pending); start += x.cfg.BatchSize {
+		end := min(start+x.cfg.BatchSize, len(pending))
+		vectors, err := x.embedder.Embed(ctx, texts[start:end])
+		if err != nil {
+			embedErr = err
+			break
+		}
+		for i := range vectors {
+			pending[start+i].Vector = vectors[i]
+		}
+		if err := db.SaveEmbeddings(pending[start:end]); err != nil {
+			return err
+		}
+	}
+	if err := db.DeleteEmbeddings(removed); err != nil {
+		return err
+	}
+	if len(pending) > 0 || len(removed) > 0 {
+		log.Printf("[EMBEDDING] 索引已更新：计算 %d 道，删除 %d 道（%s）", len(pending), len(removed), model)
+	}
+
+	// 3. 刷新内存中的索引（向量计算失败时仍刷新已保存的部分）
+	if err := x.reload(ctx, questions); err != nil {
+		return err
+	}
+	return embedErr
+}
+
+// reload 从数据库读取当前模型的全部向量，重建内存中的索引
+func (x *EmbeddingIndex) reload(ctx context.Context, questions []storage.Question) error {
+	stored, err := x.db.WithContext(ctx).LoadEmbeddings(x.embedder.Model())
+	if err != nil {
+		return err
+	}
+	meta := make(map[int]*storage.Question, len(questions))
+	for i := range questions {
+		meta[questions[i].ID] = &questions[i]
+	}
+
+	entries := make(map[int]*indexedQuestion, len(stored))
+	for _, e := range stored {
+		q, ok := meta[e.QuestionID]
+		if !ok {
+			continue
+		}
+		entries[q.ID] = &indexedQuestion{
+			id: q.ID, workspaceID: q.WorkspaceID, group: q.GroupID, typ: q.Type,
+			language: q.Language, tags: q.Tags, summary: summarize(q.Title), raw: e.Vector,
+		}
+	}
+
+	// 本地向量按全部题目计算 IDF：出现在越多题目中的词项权重越低
+	var idf []float32
+	if _, local := x.embedder.(*HashingEmbedder); local && len(entries) > 0 {
+		var dim int
+		for _, e := range entries {
+			dim = len(e.raw)
+			break
+		}
+		df := make([]int, dim)
+		for _, e := range entries {
+			for i, v := range e.raw {
+				if v != 0 && i < dim {
+					df[i]++
+				}
+			}
+		}
+		idf = make([]float32, dim)
+		for i := range idf {
+			idf[i] = float32(math.Log(float64(len(entries)+1)/float64(df[i]+1)) + 1)
+		}
+	}
+	for _, e := range entries {
+		e.vec = weigh(e.raw, idf)
+	}
+
+	x.mu.Lock()
+	x.entries, x.idf = entries, idf
+	x.mu.Unlock()
+	return nil
+}
+
+// Related 与题目最相似的题目。题目尚未建立索引时按其内容即时计算向量
+func (x *EmbeddingIndex) Related(ctx context.Context, q *storage.Question, filter SearchFilter) ([]RelatedQuestion, error) {
+	x.mu.RLock()
+	e, ok := x.entries[q.ID]
+	var vec []float32
+	if ok {
+		vec = e.vec
+	}
+	x.mu.RUnlock()
+	if !ok {
+		var err error
+		if vec, err = x.queryVector(ctx, embeddingText(q)); err != nil {
+			return nil, err
+		}
+	}
+	filter.Exclude = q.GroupID
+	return x.search(ctx, vec, filter)
+}
+
+// Search 与一段文本最相似的题目，可用于录题前查重
+func (x *EmbeddingIndex) Search(ctx context.Context, text string, filter SearchFilter) ([]RelatedQuestion, error) {
+	vec, err := x.queryVector(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return x.search(ctx, vec, filter)
+}
+
+func (x *EmbeddingIndex) queryVector(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := x.embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return weigh(vectors[0], x.idf), nil
+}
+
+func (x *EmbeddingIndex) search(ctx context.Context, vec []float32, filter SearchFilter) ([]RelatedQuestion, error) {
+	visible, err := x.db.WithContext(ctx).VisibleQuestionIDs(filter.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同一题目的多个语言版本只保留最相似的一个
+	best := make(map[int]RelatedQuestion)
+	x.mu.RLock()
+	for _, e := range x.entries {
+		if !visible[e.id] || (filter.Exclude != 0 && e.group == filter.Exclude) ||
+			(filter.Type != 0 && e.typ != filter.Type) || (filter.Language != "" && !strings.EqualFold(e.language, filter.Language)) {
+			continue
+		}
+		score := cosine(vec, e.vec)
+		if score < filter.MinScore {
+			continue
+		}
+		if b, ok := best[e.group]; !ok || score > b.Score {
+			best[e.group] = RelatedQuestion{ID: e.id, Score: score}
+		}
+	}
+	x.mu.RUnlock()
+
+	results := make([]RelatedQuestion, 0, len(best))
+	for _, r := range best {
+		r.Score = math.Round(r.Score*1000) / 1000
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if filter.Limit > 0 && len(results) > filter.Limit {
+		results = results[:filter.Limit]
+	}
+	return results, nil
+}
+
+// CoverageCluster 一组内容相近的题目
+type CoverageCluster struct {
+	Size      int            `json:"size"`
+	Share     float64        `json:"share"`     // 占全部题目的比例
+	Status    string         `json:"status"`    // over/under/balanced，与平均每组题数相比
+	Cohesion  float64        `json:"cohesion"`  // 组内题目与中心的平均相似度，越高内容越集中
+	Tags      []CountedLabel `json:"tags"`      // 组内最常见的标签（知识点）
+	Languages []CountedLabel `json:"languages"` // 组内的编程语言分布
+	Examples  []ClusterItem  `json:"examples"`  // 最接近中心的几道题
+}
+
+// CountedLabel 标签及出现次数
+type CountedLabel struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// ClusterItem 聚类的代表题目
+type ClusterItem struct {
+	ID      int    `json:"id"`
+	Summary string `json:"summary"`
+}
+
+// CoverageReport 工作区题目的覆盖情况
+type CoverageReport struct {
+	Model     string            `json:"model"`
+	Questions int               `json:"questions"` // 参与统计的题目数（多语言版本只计一次）
+	Clusters  []CoverageCluster `json:"clusters"`
+	Tags      []TagCoverage     `json:"tags"` // 按标签（知识点）统计的题目数
+}
+
+// TagCoverage 一个知识点的题目数，Status 与平均每个知识点的题目数相比
+type TagCoverage struct {
+	Name   string `json:"name"`
+	Count  int    `json:"count"`
+	Status string `json:"status"`
+}
+
+// Coverage 按向量把工作区的题目聚为 k 组（k<=0 时按题目数自动选择），
+// 题数明显多于或少于平均值的组提示该方向的题目过多或不足。同一题目的多个语言版本只计一次
+func (x *EmbeddingIndex) Coverage(ctx context.Context, workspaceID, k int) (*CoverageReport, error) {
+	visible, err := x.db.WithContext(ctx).VisibleQuestionIDs(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	x.mu.RLock()
+	groups := make(map[int]*indexedQuestion)
+	for _, e := range x.entries {
+		if !visible[e.id] {
+			continue
+		}
+		if g, ok := groups[e.group]; !ok || e.id < g.id {
+			groups[e.group] = e
+		}
+	}
+	x.mu.RUnlock()
+	items := make([]*indexedQuestion, 0, len(groups))
+	for _, e := range groups {
+		items = append(items, e)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].id < items[j].id })
+	report := &CoverageReport{Model: x.embedder.Model(), Questions: len(items), Clusters: []CoverageCluster{}, Tags: []TagCoverage{}}
+	if len(items) == 0 {
+		return report, nil
+	}
+
+	if k <= 0 {
+		k = int(math.Round(math.Sqrt(float64(len(items)) / 2)))
+	}
+	k = max(1, min(k, maxCoverageCluster, len(items)))
+	assign, centroids := kmeans(items, k)
+
+	// 汇总每组的规模、标签与代表题目
+	clusters := make([]CoverageCluster, k)
+	members := make([][]*indexedQuestion, k)
+	for i, c := range assign {
+		members[c] = append(members[c], items[i])
+	}
+	expected := float64(len(items)) / float64(k)
+	for c := range clusters {
+		list := members[c]
+		cl := CoverageCluster{Size: len(list), Share: math.Round(float64(len(list))/float64(len(items))*1000) / 1000}
+		cl.Status = coverageStatus(len(list), expected)
+		tags, languages := map[string]int{}, map[string]int{}
+		total := 0.0
+		for _, e := range list {
+			for _, t := range e.tags {
+				tags[t]++
+			}
+			languages[e.language]++
+			total += cosine(e.vec, centroids[c])
+		}
+		if len(list) > 0 {
+			cl.Cohesion = math.Round(total/float64(len(list))*1000) / 1000
+		}
+		cl.Tags = topLabels(tags, 5)
+		cl.Languages = topLabels(languages, 5)
+		sort.Slice(list, func(i, j int) bool {
+			return cosine(list[i].vec, centroids[c]) > cosine(list[j].vec, centroids[c])
+		})
+		cl.Examples = []ClusterItem{}
+		for _, e := range list[:min(3, len(list))] {
+			cl.Examples = append(cl.Examples, ClusterItem{ID: e.id, Summary: e.summary})
+		}
+		clusters[c] = cl
+	}
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Size > clusters[j].Size })
+	report.Clusters = clusters
+
+	// 按标签统计，没有标签的题目不参与
+	tagCounts := make(map[string]int)
+	for _, e := range items {
+		for _, t := range e.tags {
+			tagCounts[t]++
+		}
+	}
+	if len(tagCounts) > 0 {
+		total := 0
+		for _, n := range tagCounts {
+			total += n
+		}
+		mean := float64(total) / float64(len(tagCounts))
+		for _, l := range topLabels(tagCounts, len(tagCounts)) {
+			report.Tags = append(report.Tags, TagCoverage{Name: l.Name, Count: l.Count, Status: coverageStatus(l.Count, mean)})
+		}
+	}
+	return report, nil
+}
+
+// coverageStatus 超过平均值1.5倍为 over，不足一半为 under
+func coverageStatus(n int, mean float64) string {
+	switch {
+	case float64(n) > mean*1.5:
+		return "over"
+	case float64(n) < mean*0.5:
+		return "under"
+	default:
+		return "balanced"
+	}
+}
+
+// kmeans 球面 k-means（向量已归一化，按余弦相似度分配），k-means++ 初始化，随机种子固定以保证结果稳定
+func kmeans(items []*indexedQuestion, k int) ([]int, [][]float32) {
+	rng := rand.New(rand.NewSource(1))
+	centroids := [][]float32{items[rng.Intn(len(items))].vec}
+	dist := make([]float64, len(items))
+	for len(centroids) < k {
+		sum := 0.0
+		for i, e := range items {
+			d := 2.0
+			for _, c := range centroids {
+				d = math.Min(d, 1-cosine(e.vec, c))
+			}
+			dist[i] = d * d
+			sum += dist[i]
+		}
+		next := rng.Intn(len(items))
+		if sum > 0 {
+			r := rng.Float64() * sum
+			for i, d := range dist {
+				if r -= d; r <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, items[next].vec)
+	}
+
+	assign := make([]int, len(items))
+	for iter := 0; iter < kmeansIterations; iter++ {
+		changed := false
+		for i, e := range items {
+			bestC, bestS := 0, math.Inf(-1)
+			for c, centroid := range centroids {
+				if s := cosine(e.vec, centroid); s > bestS {
+					bestC, bestS = c, s
+				}
+			}
+			if assign[i] != bestC {
+				assign[i] = bestC
+				changed = true
+			}
+		}
+		if !changed && iter > 0 {
+			break
+		}
+		// 重新计算中心，空组保留原中心
+		dim := len(centroids[0])
+		sums := make([][]float32, k)
+		for i, e := range items {
+			c := assign[i]
+			if sums[c] == nil {
+				sums[c] = make([]float32, dim)
+			}
+			for j := 0; j < dim && j < len(e.vec); j++ {
+				sums[c][j] += e.vec[j]
+			}
+		}
+		for c := range centroids {
+			if sums[c] != nil {
+				centroids[c] = weigh(sums[c], nil)
+			}
+		}
+	}
+	return assign, centroids
+}
+
+// embeddingText 参与计算向量的题目内容：标题、选项、标签与编程语言
+func embeddingText(q *storage.Question) string {
+	var b strings.Builder
+	b.WriteString(q.Title)
+	for _, a := range q.Answers {
+		b.WriteString("\n")
+		b.WriteString(a)
+	}
+	if len(q.Tags) > 0 {
+		b.WriteString("\n")
+		b.WriteString(strings.Join(q.Tags, " "))
+	}
+	b.WriteString("\n")
+	b.WriteString(q.Language)
+	return b.String()
+}
+
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// weigh 按 IDF 加权（idf 为 nil 时不加权）并归一化为单位向量
+func weigh(raw []float32, idf []float32) []float32 {
+	vec := make([]float32, len(raw))
+	norm := 0.0
+	for i, v := range raw {
+		if idf != nil && i < len(idf) {
+			v *= idf[i]
+		}
+		vec[i] = v
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vec {
+			vec[i] *= scale
+		}
+	}
+	return vec
+}
+
+// cosine 两个单位向量的余弦相似度，维度不同（模型不一致）时为0
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	sum := 0.0
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func topLabels(counts map[string]int, n int) []CountedLabel {
+	labels := make([]CountedLabel, 0, len(counts))
+	for name, count := range counts {
+		if name != "" {
+			labels = append(labels, CountedLabel{Name: name, Count: count})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].Count != labels[j].Count {
+			return labels[i].Count > labels[j].Count
+		}
+		return labels[i].Name < labels[j].Name
+	})
+	if len(labels) > n {
+		labels = labels[:n]
+	}
+	return labels
+}
+
+// summarize 标题的单行摘要
+func summarize(title string) string {
+	s := strings.Join(strings.Fields(title), " ")
+	if utf8.RuneCountInString(s) <= summaryLength {
+		return s
+	}
+	return string([]rune(s)[:summaryLength]) + "…"
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	retentionCheckPeriod = time.Minute // 检查各工作区是否到了定时执行时间的间隔
+	maxArchiveMonths     = 120
+	maxPurgeDays         = 3650
+)
+
+// RetentionManager 按工作区的策略归档久未使用的题目、删除被驳回的草稿，
+// 被 LTI 活动或未结束的课堂测验引用的题目不会被处理
+type RetentionManager struct {
+	db        *storage.Database
+	questions *QuestionService
+	cfg       config.RetentionConfig
+	mu        sync.Mutex // 同一时间只执行一次清理，避免定时与手动执行重复处理
+}
+
+// RetentionPlan 按策略将要处理的题目
+type RetentionPlan struct {
+	Policy  storage.RetentionPolicy      `json:"policy"`
+	Archive []storage.RetentionCandidate `json:"archive"` // 将被归档的题目
+	Purge   []storage.RetentionCandidate `json:"purge"`   // 将被删除的草稿
+	Skipped []SkippedQuestion            `json:"skipped"` // 被引用而跳过的题目
+}
+
+// SkippedQuestion 被考试或测验引用而跳过的题目
+type SkippedQuestion struct {
+	storage.RetentionCandidate
+	Action     string                      `json:"action"` // archive/purge
+	References []storage.QuestionReference `json:"references"`
+}
+
+func NewRetentionManager(db *storage.Database, questions *QuestionService, cfg config.RetentionConfig) *RetentionManager {
+	return &RetentionManager{db: db, questions: questions, cfg: cfg}
+}
+
+// ValidatePolicy 检查策略的取值范围
+func ValidatePolicy(p *storage.RetentionPolicy) error {
+	if p.ArchiveUnusedMonths < 0 || p.ArchiveUnusedMonths > maxArchiveMonths {
+		return serviceError(ErrInvalid, "archive_unused_months 必须在0-%d之间", maxArchiveMonths)
+	}
+	if p.PurgeRejectedDays < 0 || p.PurgeRejectedDays > maxPurgeDays {
+		return serviceError(ErrInvalid, "purge_rejected_days 必须在0-%d之间", maxPurgeDays)
+	}
+	if p.Enabled && p.ArchiveUnusedMonths == 0 && p.PurgeRejectedDays == 0 {
+		return serviceError(ErrInvalid, "启用定时执行时至少设置 archive_unused_months 或 purge_rejected_days")
+	}
+	return nil
+}
+
+// Plan 试运行：按策略列出将被归档与删除的题目，不做任何修改
+func (m *RetentionManager) Plan(ctx context.Context, policy storage.RetentionPolicy) (*RetentionPlan, error) {
+	db := m.db.WithContext(ctx)
+	now := time.Now()
+	plan := &RetentionPlan{
+		Policy:  policy,
+		Archive: []storage.RetentionCandidate{},
+		Purge:   []storage.RetentionCandidate{},
+		Skipped: []SkippedQuestion{},
+	}
+
+	// 1. 按策略选出题目
+	var archive, purge []storage.RetentionCandidate
+	var err error
+	if policy.ArchiveUnusedMonths > 0 {
+		if archive, err = db.ArchiveCandidates(policy.WorkspaceID, now.AddDate(0, -policy.ArchiveUnusedMonths, 0)); err != nil {
+			return nil, err
+		}
+	}
+	if policy.PurgeRejectedDays > 0 {
+		if purge, err = db.RejectedCandidates(policy.WorkspaceID, now.AddDate(0, 0, -policy.PurgeRejectedDays)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. 排除被引用的题目
+	ids := make([]int, 0, len(archive)+len(purge))
+	for _, list := range [][]storage.RetentionCandidate{archive, purge} {
+		for _, c := range list {
+			ids = append(ids, c.ID)
+		}
+	}
+	refs, err := db.QuestionReferences(policy.WorkspaceID, ids)
+	if err != nil {
+		return nil, err
+	}
+	byQuestion := make(map[int][]storage.QuestionReference)
+	for _, r := range refs {
+		byQuestion[r.QuestionID] = append(byQuestion[r.QuestionID], r)
+	}
+	for _, step := range []struct {
+		action string
+		list   []storage.RetentionCandidate
+		dest   *[]storage.RetentionCandidate
+	}{{"archive", archive, &plan.Archive}, {"purge", purge, &plan.Purge}} {
+		for _, c := range step.list {
+			if r := byQuestion[c.ID]; len(r) > 0 {
+				plan.Skipped = append(plan.Skipped, SkippedQuestion{RetentionCandidate: c, Action: step.action, References: r})
+				continue
+			}
+			*step.dest = append(*step.dest, c)
+		}
+	}
+	return plan, nil
+}
+
+// Execute 按策略执行一次清理并记录结果，清理中途失败时已处理的题目保留，错误写入记录
+func (m *RetentionManager) Execute(ctx context.Context, ws *storage.Workspace, policy storage.RetentionPolicy, trigger string) (*storage.RetentionRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run := &storage.RetentionRun{
+		WorkspaceID:         ws.ID,
+		Trigger:             trigger,
+		ArchiveUnusedMonths: policy.ArchiveUnusedMonths,
+		PurgeRejectedDays:   policy.PurgeRejectedDays,
+		Archived:            []int{},
+		Purged:              []int{},
+		StartedAt:           time.Now().Format(time.DateTime),
+	}
+	err := m.execute(ctx, ws, policy, run)
+	if err != nil {
+		run.Error = err.Error()
+	}
+	run.FinishedAt = time.Now().Format(time.DateTime)
+	// 请求被取消时仍然记录已完成的部分
+	if saveErr := m.db.WithContext(context.WithoutCancel(ctx)).CreateRetentionRun(run, m.cfg.KeepRuns); saveErr != nil {
+		return nil, saveErr
+	}
+	if len(run.Archived) > 0 || len(run.Purged) > 0 || err != nil {
+		log.Printf("[RETENTION] 工作区 %s：归档 %d 道，删除 %d 道，跳过 %d 道%s",
+			ws.Slug, len(run.Archived), len(run.Purged), run.Skipped, errorSuffix(err))
+	}
+	return run, nil
+}
+
+func (m *RetentionManager) execute(ctx context.Context, ws *storage.Workspace, policy storage.RetentionPolicy, run *storage.RetentionRun) error {
+	plan, err := m.Plan(ctx, policy)
+	if err != nil {
+		return err
+	}
+	run.Skipped = len(plan.Skipped)
+
+	if len(plan.Archive) > 0 {
+		archived, err := m.db.WithContext(ctx).SetQuestionStatus(ws.ID, candidateIDs(plan.Archive), config.StatusArchived)
+		if err != nil {
+			return err
+		}
+		run.Archived = archived
+	}
+	if len(plan.Purge) > 0 {
+		// 通过题目服务删除，同时清理附件并记录 question.deleted 事件；
+		// 计划与删除之间新增的引用会使删除失败，下次执行时再跳过
+		caller := &Caller{User: "retention", Workspace: ws}
+		purged, err := m.questions.Delete(ctx, caller, candidateIDs(plan.Purge), false)
+		if err != nil {
+			return err
+		}
+		run.Purged = purged
+	}
+	return nil
+}
+
+// Run 定时检查启用了清理策略的工作区，距上次定时执行超过 retention.interval 时执行一次
+func (m *RetentionManager) Run(ctx context.Context) {
+	if m.cfg.Interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(retentionCheckPeriod)
+	defer ticker.Stop()
+	for {
+		m.runDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *RetentionManager) runDue(ctx context.Context) {
+	db := m.db.WithContext(ctx)
+	policies, err := db.EnabledRetentionPolicies()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[RETENTION] %v", err)
+		}
+		return
+	}
+	for _, p := range policies {
+		if ctx.Err() != nil {
+			return
+		}
+		last, err := db.LastRetentionRun(p.WorkspaceID, storage.RetentionScheduled)
+		if err != nil {
+			log.Printf("[RETENTION] 查询上次执行时间失败: %v", err)
+			continue
+		}
+		if !last.IsZero() && time.Since(last) < m.cfg.Interval {
+			continue
+		}
+		ws, err := db.GetWorkspace(p.WorkspaceID)
+		if err != nil {
+			log.Printf("[RETENTION] 查询工作区 %d 失败: %v", p.WorkspaceID, err)
+			continue
+		}
+		if _, err := m.Execute(ctx, ws, p, storage.RetentionScheduled); err != nil && ctx.Err() == nil {
+			log.Printf("[RETENTION] 工作区 %s 清理失败: %v", ws.Slug, err)
+		}
+	}
+}
+
+// describeReferences 引用说明，最多列出前几项
+func describeReferences(refs []storage.QuestionReference) string {
+	const shown = 3
+	parts := make([]string, 0, shown)
+	for _, r := range refs[:min(shown, len(refs))] {
+		kind := "课堂测验"
+		if strings.HasPrefix(r.Kind, "lti_") {
+			kind = "LTI 活动"
+		}
+		parts = append(parts, fmt.Sprintf("题目 %d 被%s #%d（%s）引用", r.QuestionID, kind, r.ID, r.Title))
+	}
+	msg := strings.Join(parts, "；")
+	if len(refs) > shown {
+		msg += fmt.Sprintf(" 等 %d 处", len(refs))
+	}
+	return msg
+}
+
+func candidateIDs(list []storage.RetentionCandidate) []int {
+	ids := make([]int, len(list))
+	for i, c := range list {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+func errorSuffix(err error) string {
+	if err == nil {
+		return ""
+	}
+	return "，失败: " + err.Error()
+}
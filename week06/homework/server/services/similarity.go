@@ -0,0 +1,302 @@
+package services
+
+import (
+	"Server/storage"
+	"hash/fnv"
+	"sort"
+)
+
+// 查重参数：连续 DefaultKGram 个标记组成一个 k-gram，每 DefaultWindow 个 k-gram 至少选一个指纹，
+// 因此长度不少于 k+w-1 个标记的相同片段一定能被发现
+const (
+	DefaultKGram     = 12
+	DefaultWindow    = 8
+	DefaultThreshold = 0.5
+	minCodeTokens    = 30 // 标记太少的提交（如只写了函数签名）不参与比对
+	maxSeedsPerHash  = 16 // 同一指纹在一份代码中出现过多次时只取前几处，避免重复的模板代码拖慢比对
+)
+
+// SimilarityOptions 查重参数
+type SimilarityOptions struct {
+	KGram     int
+	Window    int
+	Threshold float64 // 相似度不低于该值的提交对才会出现在报告中
+}
+
+// SimilarityReport 一道编程题的查重报告
+type SimilarityReport struct {
+	QuestionID  int               `json:"question_id"`
+	Submissions int               `json:"submissions"` // 参与比对的提交数（每个学生最后一次提交）
+	KGram       int               `json:"kgram"`
+	Window      int               `json:"window"`
+	Threshold   float64           `json:"threshold"`
+	Pairs       []SimilarPair     `json:"pairs"`
+	Skipped     []SubmissionBrief `json:"skipped"` // 代码太短未参与比对的提交
+}
+
+// SubmissionBrief 报告中引用的提交
+type SubmissionBrief struct {
+	ID          int    `json:"id"`
+	StudentID   string `json:"student_id"`
+	Language    string `json:"language"`
+	SubmittedAt string `json:"submitted_at"`
+	Tokens      int    `json:"tokens"`
+}
+
+// SimilarPair 相似的两份提交，Score 为两份代码中被匹配的标记占比
+type SimilarPair struct {
+	A         SubmissionBrief `json:"a"`
+	B         SubmissionBrief `json:"b"`
+	Score     float64         `json:"score"`
+	CoverageA float64         `json:"coverage_a"` // A 中与 B 相同部分的占比
+	CoverageB float64         `json:"coverage_b"`
+	Matches   []MatchRegion   `json:"matches"`
+}
+
+// MatchRegion 一段相同的代码在两份提交中的行号范围（闭区间）
+type MatchRegion struct {
+	AStart int `json:"a_start"`
+	AEnd   int `json:"a_end"`
+	BStart int `json:"b_start"`
+	BEnd   int `json:"b_end"`
+	Tokens int `json:"tokens"`
+}
+
+// fingerprint 选中的 k-gram 哈希及其起始标记下标
+type fingerprint struct {
+	hash uint64
+	pos  int
+}
+
+// codeFile 一份提交的标记与指纹
+type codeFile struct {
+	brief  SubmissionBrief
+	tokens []codeToken
+	prints []fingerprint
+	index  map[uint64][]int // 指纹 -> 起始标记下标
+}
+
+// CheckSimilarity 对同一道题的提交两两查重。先用指纹倒排索引找出有共同指纹的提交对，
+// 再从共同指纹出发向两侧扩展为最长的相同片段，按长度贪心选取互不重叠的片段计算覆盖率
+func CheckSimilarity(questionID int, subs []storage.CodeSubmission, opts SimilarityOptions) *SimilarityReport {
+	if opts.KGram <= 0 {
+		opts.KGram = DefaultKGram
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultWindow
+	}
+	report := &SimilarityReport{
+		QuestionID:  questionID,
+		Submissions: len(subs),
+		KGram:       opts.KGram,
+		Window:      opts.Window,
+		Threshold:   opts.Threshold,
+		Pairs:       []SimilarPair{},
+		Skipped:     []SubmissionBrief{},
+	}
+
+	// 1. 切分并生成指纹
+	files := make([]*codeFile, 0, len(subs))
+	for _, sub := range subs {
+		f := &codeFile{
+			brief:  SubmissionBrief{ID: sub.ID, StudentID: sub.StudentID, Language: sub.Language, SubmittedAt: sub.SubmittedAt},
+			tokens: tokenizeCode(sub.Language, sub.Code),
+		}
+		f.brief.Tokens = len(f.tokens)
+		if len(f.tokens) < max(minCodeTokens, opts.KGram) {
+			report.Skipped = append(report.Skipped, f.brief)
+			continue
+		}
+		f.prints = winnow(f.tokens, opts.KGram, opts.Window)
+		f.index = make(map[uint64][]int, len(f.prints))
+		for _, fp := range f.prints {
+			f.index[fp.hash] = append(f.index[fp.hash], fp.pos)
+		}
+		files = append(files, f)
+	}
+
+	// 2. 倒排索引找出候选提交对（只比较同一语言）
+	owners := make(map[uint64][]int)
+	for i, f := range files {
+		for h := range f.index {
+			owners[h] = append(owners[h], i)
+		}
+	}
+	candidates := make(map[[2]int]bool)
+	for _, list := range owners {
+		for x := 0; x < len(list); x++ {
+			for y := x + 1; y < len(list); y++ {
+				if files[list[x]].brief.Language == files[list[y]].brief.Language {
+					candidates[[2]int{list[x], list[y]}] = true
+				}
+			}
+		}
+	}
+
+	// 3. 逐对比较
+	for pair := range candidates {
+		// 先提交的一方作为 A
+		a, b := files[pair[0]], files[pair[1]]
+		if a.brief.ID > b.brief.ID {
+			a, b = b, a
+		}
+		p := comparePair(a, b, opts.KGram)
+		if p != nil && p.Score >= opts.Threshold {
+			report.Pairs = append(report.Pairs, *p)
+		}
+	}
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		if report.Pairs[i].Score != report.Pairs[j].Score {
+			return report.Pairs[i].Score > report.Pairs[j].Score
+		}
+		if report.Pairs[i].A.ID != report.Pairs[j].A.ID {
+			return report.Pairs[i].A.ID < report.Pairs[j].A.ID
+		}
+		return report.Pairs[i].B.ID < report.Pairs[j].B.ID
+	})
+	return report
+}
+
+// winnow 计算所有 k-gram 的哈希，在每个长度为 w 的窗口中选最小值（相同时取最右边）作为指纹
+func winnow(tokens []codeToken, k, w int) []fingerprint {
+	if len(tokens) < k {
+		return nil
+	}
+	hashes := make([]uint64, len(tokens)-k+1)
+	for i := range hashes {
+		h := fnv.New64a()
+		for _, t := range tokens[i : i+k] {
+			h.Write([]byte(t.Kind))
+			h.Write([]byte{0})
+		}
+		hashes[i] = h.Sum64()
+	}
+	if w > len(hashes) {
+		w = len(hashes)
+	}
+
+	var prints []fingerprint
+	last := -1
+	for start := 0; start+w <= len(hashes); start++ {
+		minPos := start
+		for i := start + 1; i < start+w; i++ {
+			if hashes[i] <= hashes[minPos] {
+				minPos = i
+			}
+		}
+		if minPos != last {
+			prints = append(prints, fingerprint{hash: hashes[minPos], pos: minPos})
+			last = minPos
+		}
+	}
+	return prints
+}
+
+// tokenRun 两份代码中一段相同的标记序列
+type tokenRun struct {
+	a, b, length int
+}
+
+// comparePair 比较两份提交，没有相同片段时返回 nil
+func comparePair(a, b *codeFile, k int) *SimilarPair {
+	// 1. 从共同指纹出发，核对标记（排除哈希碰撞）并向两侧扩展为最长的相同片段
+	seen := make(map[[2]int]bool)
+	var runs []tokenRun
+	for _, fp := range a.prints {
+		positions := b.index[fp.hash]
+		if len(positions) > maxSeedsPerHash {
+			positions = positions[:maxSeedsPerHash]
+		}
+		for _, j := range positions {
+			i := fp.pos
+			if !sameTokens(a.tokens[i:i+k], b.tokens[j:j+k]) {
+				continue
+			}
+			for i > 0 && j > 0 && a.tokens[i-1].Kind == b.tokens[j-1].Kind {
+				i--
+				j--
+			}
+			if seen[[2]int{i, j}] {
+				continue
+			}
+			seen[[2]int{i, j}] = true
+			n := 0
+			for i+n < len(a.tokens) && j+n < len(b.tokens) && a.tokens[i+n].Kind == b.tokens[j+n].Kind {
+				n++
+			}
+			runs = append(runs, tokenRun{a: i, b: j, length: n})
+		}
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+
+	// 2. 按长度从长到短选取在两份代码中都不重叠的片段
+	sort.Slice(runs, func(x, y int) bool {
+		if runs[x].length != runs[y].length {
+			return runs[x].length > runs[y].length
+		}
+		if runs[x].a != runs[y].a {
+			return runs[x].a < runs[y].a
+		}
+		return runs[x].b < runs[y].b
+	})
+	usedA := make([]bool, len(a.tokens))
+	usedB := make([]bool, len(b.tokens))
+	var matched []tokenRun
+	for _, r := range runs {
+		if overlaps(usedA, r.a, r.length) || overlaps(usedB, r.b, r.length) {
+			continue
+		}
+		for n := 0; n < r.length; n++ {
+			usedA[r.a+n] = true
+			usedB[r.b+n] = true
+		}
+		matched = append(matched, r)
+	}
+
+	// 3. 计算覆盖率并把片段换算为行号
+	sort.Slice(matched, func(x, y int) bool { return matched[x].a < matched[y].a })
+	pair := &SimilarPair{A: a.brief, B: b.brief, Matches: make([]MatchRegion, 0, len(matched))}
+	total := 0
+	for _, r := range matched {
+		total += r.length
+		pair.Matches = append(pair.Matches, MatchRegion{
+			AStart: a.tokens[r.a].Line,
+			AEnd:   a.tokens[r.a+r.length-1].Line,
+			BStart: b.tokens[r.b].Line,
+			BEnd:   b.tokens[r.b+r.length-1].Line,
+			Tokens: r.length,
+		})
+	}
+	pair.CoverageA = roundScore(float64(total) / float64(len(a.tokens)))
+	pair.CoverageB = roundScore(float64(total) / float64(len(b.tokens)))
+	pair.Score = roundScore(float64(2*total) / float64(len(a.tokens)+len(b.tokens)))
+	return pair
+}
+
+func sameTokens(a, b []codeToken) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Kind != b[i].Kind {
+			return false
+		}
+	}
+	return true
+}
+
+func overlaps(used []bool, start, length int) bool {
+	for i := start; i < start+length; i++ {
+		if used[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// roundScore 保留三位小数
+func roundScore(v float64) float64 {
+	return float64(int(v*1000+0.5)) / 1000
+}
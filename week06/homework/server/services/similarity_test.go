@@ -0,0 +1,227 @@
+package services
+
+import (
+	"Server/storage"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// randomTokens 从少量标记中随机生成序列，让 k-gram 哈希有足够的重复
+func randomTokens(r *rand.Rand, n int) []codeToken {
+	kinds := []string{codeIdent, codeNumber, "(", ")", "+", "=", "{", "}"}
+	tokens := make([]codeToken, n)
+	for i := range tokens {
+		tokens[i] = codeToken{Kind: kinds[r.Intn(len(kinds))], Line: i + 1}
+	}
+	return tokens
+}
+
+func TestWinnowWindows(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, tt := range []struct{ n, k, w int }{{200, 12, 8}, {50, 5, 4}, {20, 3, 1}, {15, 12, 8}} {
+		tokens := randomTokens(r, tt.n)
+		prints := winnow(tokens, tt.k, tt.w)
+		grams := tt.n - tt.k + 1
+		w := min(tt.w, grams)
+
+		// 指纹位置严格递增，且每个窗口中至少选中一个
+		selected := make(map[int]bool)
+		for i, fp := range prints {
+			if i > 0 && fp.pos <= prints[i-1].pos {
+				t.Fatalf("n=%d k=%d w=%d: positions not increasing: %v", tt.n, tt.k, tt.w, prints)
+			}
+			selected[fp.pos] = true
+		}
+		for start := 0; start+w <= grams; start++ {
+			found := false
+			for i := start; i < start+w; i++ {
+				found = found || selected[i]
+			}
+			if !found {
+				t.Fatalf("n=%d k=%d w=%d: window %d has no fingerprint", tt.n, tt.k, tt.w, start)
+			}
+		}
+
+		// 结果是确定的
+		if again := winnow(tokens, tt.k, tt.w); !reflect.DeepEqual(prints, again) {
+			t.Fatalf("n=%d k=%d w=%d: winnow is not deterministic", tt.n, tt.k, tt.w)
+		}
+	}
+
+	if prints := winnow(randomTokens(r, 5), 12, 8); prints != nil {
+		t.Errorf("tokens shorter than k: got %v, want nil", prints)
+	}
+}
+
+func TestWinnowSharedFragment(t *testing.T) {
+	// 长度为 k+w-1 的相同片段，无论前后是什么代码都至少有一个共同指纹
+	r := rand.New(rand.NewSource(2))
+	k, w := DefaultKGram, DefaultWindow
+	for round := 0; round < 20; round++ {
+		shared := randomTokens(r, k+w-1)
+		a := append(append(randomTokens(r, r.Intn(40)), shared...), randomTokens(r, r.Intn(40))...)
+		b := append(append(randomTokens(r, r.Intn(40)), shared...), randomTokens(r, r.Intn(40))...)
+
+		hashes := make(map[uint64]bool)
+		for _, fp := range winnow(a, k, w) {
+			hashes[fp.hash] = true
+		}
+		found := false
+		for _, fp := range winnow(b, k, w) {
+			found = found || hashes[fp.hash]
+		}
+		if !found {
+			t.Fatalf("round %d: shared fragment of %d tokens has no common fingerprint", round, k+w-1)
+		}
+	}
+}
+
+func TestTokenizeNormalizes(t *testing.T) {
+	tests := []struct {
+		lang, a, b string
+	}{
+		{CodeGo,
+			"func add(a, b int) int {\n\treturn a + b // 求和\n}\n",
+			"func sum(x, y int) int { /* 改名 */ return x + y; }"},
+		{CodeGo,
+			`fmt.Println("hello", 1)`,
+			"fmt.Println(`world`, 2.5)"},
+		{CodePython,
+			"def add(a, b):\n    # 求和\n    return a + b\n",
+			"def total(x, y):\n\n\treturn x + y  # 缩进宽度不同\n"},
+		{CodePython,
+			"s = 'abc' + \"\"\"多行\n字符串\"\"\"\n",
+			"t = \"x\" + 'y'\n"},
+	}
+	for _, tt := range tests {
+		a, b := tokenizeCode(tt.lang, tt.a), tokenizeCode(tt.lang, tt.b)
+		if !sameTokens(a, b) {
+			t.Errorf("%s: %q and %q tokenize differently:\n%v\n%v", tt.lang, tt.a, tt.b, a, b)
+		}
+	}
+}
+
+func TestTokenizePythonIndent(t *testing.T) {
+	src := "if x:\n    if y:\n        z = 1\nw = (1,\n  2)\n"
+	var kinds []string
+	for _, tok := range tokenizePython(src) {
+		kinds = append(kinds, tok.Kind)
+	}
+	want := []string{
+		"if", codeIdent, ":", codeIndent,
+		"if", codeIdent, ":", codeIndent,
+		codeIdent, "=", codeNumber,
+		codeDedent, codeDedent,
+		codeIdent, "=", "(", codeNumber, ",", codeNumber, ")",
+	}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("tokens =\n%v\nwant\n%v", kinds, want)
+	}
+}
+
+const similarityGoSource = `package main
+
+import "fmt"
+
+func bubbleSort(nums []int) []int {
+	n := len(nums)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n-i-1; j++ {
+			if nums[j] > nums[j+1] {
+				nums[j], nums[j+1] = nums[j+1], nums[j]
+			}
+		}
+	}
+	return nums
+}
+
+func main() {
+	fmt.Println(bubbleSort([]int{5, 3, 1, 4}))
+}
+`
+
+func TestCheckSimilarity(t *testing.T) {
+	// 改变量名、改常量、删注释、重新排版后应判定为完全相同
+	renamed := strings.NewReplacer("bubbleSort", "sortIt", "nums", "arr", "5, 3, 1, 4", "9, 8, 7, 6", "\n\n", "\n").Replace(similarityGoSource)
+	different := `package main
+
+import "strings"
+
+func reverseWords(s string) string {
+	words := strings.Fields(s)
+	out := make([]string, 0, len(words))
+	for k := len(words) - 1; k >= 0; k-- {
+		out = append(out, words[k])
+	}
+	return strings.Join(out, " ")
+}
+`
+	subs := []storage.CodeSubmission{
+		{ID: 1, StudentID: "s1", Language: CodeGo, Code: similarityGoSource},
+		{ID: 2, StudentID: "s2", Language: CodeGo, Code: renamed},
+		{ID: 3, StudentID: "s3", Language: CodeGo, Code: different},
+		{ID: 4, StudentID: "s4", Language: CodeGo, Code: "package main\nfunc f() {}\n"},
+		// 不同语言的提交不互相比对
+		{ID: 5, StudentID: "s5", Language: CodePython, Code: strings.Repeat("x = y + 1\n", 20)},
+	}
+	report := CheckSimilarity(7, subs, SimilarityOptions{Threshold: DefaultThreshold})
+
+	if report.KGram != DefaultKGram || report.Window != DefaultWindow || report.Submissions != len(subs) {
+		t.Errorf("report options = %d/%d/%d", report.KGram, report.Window, report.Submissions)
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].ID != 4 {
+		t.Errorf("skipped = %+v, want submission 4", report.Skipped)
+	}
+	if len(report.Pairs) != 1 {
+		t.Fatalf("pairs = %+v, want one pair", report.Pairs)
+	}
+	p := report.Pairs[0]
+	if p.A.ID != 1 || p.B.ID != 2 || p.Score != 1 || p.CoverageA != 1 || p.CoverageB != 1 {
+		t.Errorf("pair = %+v, want 1/2 with score 1", p)
+	}
+	if len(p.Matches) != 1 || p.Matches[0].Tokens != p.A.Tokens || p.Matches[0].AStart != 1 || p.Matches[0].BStart != 1 {
+		t.Errorf("matches = %+v", p.Matches)
+	}
+
+	// 阈值为0时列出所有有共同片段的提交对，仍然不包括不同语言的提交
+	report = CheckSimilarity(7, subs, SimilarityOptions{})
+	for _, p := range report.Pairs {
+		if p.A.Language != p.B.Language {
+			t.Errorf("compared %s with %s", p.A.Language, p.B.Language)
+		}
+		if p.Score < 0 || p.Score > 1 {
+			t.Errorf("score %v out of range", p.Score)
+		}
+	}
+}
+
+func TestComparePairPartialCopy(t *testing.T) {
+	// B 在自己写的函数后面抄了 A 除 package 声明外的全部代码：A 几乎全部被覆盖，B 的覆盖率更低
+	extra := "\nfunc helper(a, b string) bool {\n\treturn len(a) > len(b) && a != b\n}\n"
+	a := &codeFile{brief: SubmissionBrief{ID: 1}, tokens: tokenizeCode(CodeGo, similarityGoSource)}
+	b := &codeFile{brief: SubmissionBrief{ID: 2}, tokens: tokenizeCode(CodeGo, extra+strings.TrimPrefix(similarityGoSource, "package main\n"))}
+	for _, f := range []*codeFile{a, b} {
+		f.prints = winnow(f.tokens, DefaultKGram, DefaultWindow)
+		f.index = make(map[uint64][]int)
+		for _, fp := range f.prints {
+			f.index[fp.hash] = append(f.index[fp.hash], fp.pos)
+		}
+	}
+
+	p := comparePair(a, b, DefaultKGram)
+	if p == nil {
+		t.Fatal("expected a match")
+	}
+	copied := len(a.tokens) - 2 // 没有抄 package main
+	if p.Matches[0].Tokens != copied {
+		t.Errorf("matched %d tokens, want %d", p.Matches[0].Tokens, copied)
+	}
+	if p.CoverageA >= 1 || p.CoverageA < 0.9 || p.CoverageB >= p.CoverageA {
+		t.Errorf("coverage = %v/%v", p.CoverageA, p.CoverageB)
+	}
+	if p.Matches[0].BStart <= 4 {
+		t.Errorf("match in B starts at line %d, want after helper", p.Matches[0].BStart)
+	}
+}
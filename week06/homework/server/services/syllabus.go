@@ -0,0 +1,366 @@
+package services
+
+import (
+	"Server/config"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 单次AI调用的题目数量范围，与 QuestionRequest.Count 的校验一致
+const (
+	minRequestCount = 3
+	maxRequestCount = 10
+)
+
+// 单个知识点最多生成的题目数量
+const maxTopicCount = 50
+
+// SupportedLanguages 可以出题的编程语言，与 QuestionRequest.Language 的校验一致
+var SupportedLanguages = []string{"go", "java", "python", "javascript", "c++", "css", "html"}
+
+// SyllabusItem 大纲中的一个知识点
+type SyllabusItem struct {
+	Topic    string   `json:"topic"` // 出题关键词
+	Path     []string `json:"path"`  // 所在章节（由外到内），与知识点一起作为题目标签
+	Type     int      `json:"type"`
+	Count    int      `json:"count"`
+	Language string   `json:"language"`
+	Line     int      `json:"line"` // 在文件中的行号，便于定位问题
+}
+
+// Tags 题目标签：章节与知识点
+func (it SyllabusItem) Tags() []string {
+	return append(append([]string{}, it.Path...), it.Topic)
+}
+
+// SyllabusDefaults 大纲中未指定时使用的题型、数量与语言
+type SyllabusDefaults struct {
+	Type     int
+	Count    int
+	Language string
+}
+
+// BulkTask 展开后的一次出题请求
+type BulkTask struct {
+	Item    int                    `json:"item"` // 对应的知识点序号
+	Request config.QuestionRequest `json:"request"`
+	Keep    int                    `json:"keep"` // 保存的题目数量，知识点要求少于3道时只保留前几道
+}
+
+// ParseSyllabus 按扩展名解析 Markdown 大纲（.md/.markdown）或 CSV（.csv），
+// 所有问题一起返回，便于一次改完
+func ParseSyllabus(filename string, data []byte, defaults SyllabusDefaults) ([]SyllabusItem, error) {
+	var items []SyllabusItem
+	var problems []string
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".md", ".markdown":
+		items, problems = parseMarkdownSyllabus(data, defaults)
+	case ".csv":
+		items, problems = parseCSVSyllabus(data, defaults)
+	default:
+		return nil, fmt.Errorf("不支持的大纲格式: %s（仅支持 .md/.markdown/.csv）", filename)
+	}
+
+	if len(problems) == 0 && len(items) == 0 {
+		problems = append(problems, "大纲中没有找到知识点")
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("大纲解析失败:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return items, nil
+}
+
+// ExpandSyllabus 将知识点拆分为多次出题请求，每次3-10道
+func ExpandSyllabus(items []SyllabusItem) []BulkTask {
+	var tasks []BulkTask
+	for i, it := range items {
+		for part, n := range splitCount(it.Count) {
+			keep := n
+			if n < minRequestCount {
+				n = minRequestCount
+			}
+			req := config.QuestionRequest{
+				Keyword:  it.Topic,
+				Type:     it.Type,
+				Count:    n,
+				Language: it.Language,
+			}
+			// 同一知识点拆分出的请求参数相同，跳过缓存，避免合并后得到重复的题目
+			if part > 0 {
+				req.Cache = CacheBypass
+			}
+			tasks = append(tasks, BulkTask{Item: i, Request: req, Keep: keep})
+		}
+	}
+	return tasks
+}
+
+// splitCount 将数量均匀拆分为不超过10的若干份（数量超过10时每份至少5道）
+func splitCount(count int) []int {
+	parts := (count + maxRequestCount - 1) / maxRequestCount
+	sizes := make([]int, parts)
+	for i := range sizes {
+		sizes[i] = count / parts
+		if i < count%parts {
+			sizes[i]++
+		}
+	}
+	return sizes
+}
+
+// 行尾的属性，如 "goroutine [type=多选 count=12 language=go]"
+var attrPattern = regexp.MustCompile(`\s*[\[【]([^\]】]*)[\]】]\s*$`)
+
+var (
+	headingPattern  = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+	listItemPattern = regexp.MustCompile(`^(\s*)(?:[-*+]|\d+[.)])\s+(.+)$`)
+)
+
+// outlineNode Markdown大纲中的标题或列表项
+type outlineNode struct {
+	text     string
+	attrs    map[string]string
+	level    int // 标题为#个数，列表项为100+缩进，数值越大层级越深
+	line     int
+	parent   *outlineNode
+	children int
+}
+
+// parseMarkdownSyllabus 标题与列表项组成大纲树，没有子项的节点即为知识点，
+// 上级节点作为章节；节点的属性对其下所有知识点生效
+func parseMarkdownSyllabus(data []byte, defaults SyllabusDefaults) ([]SyllabusItem, []string) {
+	var nodes []*outlineNode
+	var stack []*outlineNode
+	inFence := false
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if _, _, ok := parseFence(line); ok {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		var node *outlineNode
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			node = &outlineNode{text: m[2], level: len(m[1])}
+		} else if m := listItemPattern.FindStringSubmatch(line); m != nil {
+			indent := strings.ReplaceAll(m[1], "\t", "    ")
+			node = &outlineNode{text: m[2], level: 100 + len(indent)}
+		} else {
+			continue
+		}
+		node.line = i + 1
+		node.text, node.attrs = splitAttrs(node.text)
+		if node.text == "" {
+			continue
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].level >= node.level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 {
+			node.parent = stack[len(stack)-1]
+			node.parent.children++
+		}
+		stack = append(stack, node)
+		nodes = append(nodes, node)
+	}
+
+	var items []SyllabusItem
+	var problems []string
+	for _, node := range nodes {
+		if node.children > 0 {
+			continue
+		}
+		// 由外到内收集章节与属性，内层属性覆盖外层
+		var chain []*outlineNode
+		for n := node; n != nil; n = n.parent {
+			chain = append([]*outlineNode{n}, chain...)
+		}
+		attrs := make(map[string]string)
+		var path []string
+		for _, n := range chain {
+			for k, v := range n.attrs {
+				attrs[k] = v
+			}
+			if n != node {
+				path = append(path, n.text)
+			}
+		}
+
+		item, errs := buildSyllabusItem(node.text, path, attrs, defaults, node.line)
+		problems = append(problems, errs...)
+		if len(errs) == 0 {
+			items = append(items, item)
+		}
+	}
+	return items, problems
+}
+
+// splitAttrs 拆出行尾 [key=value ...] 属性
+func splitAttrs(text string) (string, map[string]string) {
+	m := attrPattern.FindStringSubmatchIndex(text)
+	if m == nil {
+		return strings.TrimSpace(text), nil
+	}
+	attrs := make(map[string]string)
+	for _, field := range strings.FieldsFunc(text[m[2]:m[3]], func(r rune) bool {
+		return r == ' ' || r == ',' || r == '，' || r == ';'
+	}) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			key, value, ok = strings.Cut(field, ":")
+		}
+		if ok {
+			attrs[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return strings.TrimSpace(text[:m[0]]), attrs
+}
+
+// CSV 表头别名
+var csvColumns = map[string]string{
+	"topic": "topic", "keyword": "topic", "知识点": "topic", "主题": "topic",
+	"type": "type", "题型": "type",
+	"count": "count", "数量": "count",
+	"language": "language", "语言": "language",
+	"chapter": "chapter", "章节": "chapter",
+}
+
+// parseCSVSyllabus 列为 topic,type,count,language（可选 chapter，多级章节用/分隔）；
+// 第一行是表头时按表头识别列，否则按上述顺序
+func parseCSVSyllabus(data []byte, defaults SyllabusDefaults) ([]SyllabusItem, []string) {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	columns := []string{"topic", "type", "count", "language", "chapter"}
+	var items []SyllabusItem
+	var problems []string
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("CSV格式错误: %v", err))
+			break
+		}
+		line, _ := r.FieldPos(0)
+		if first {
+			if header, ok := csvHeader(record); ok {
+				columns = header
+				continue
+			}
+		}
+
+		attrs := make(map[string]string)
+		for i, value := range record {
+			if i < len(columns) && columns[i] != "" {
+				attrs[columns[i]] = strings.TrimSpace(value)
+			}
+		}
+		topic := attrs["topic"]
+		if topic == "" && strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue // 空行
+		}
+		var path []string
+		for _, p := range strings.Split(attrs["chapter"], "/") {
+			if p = strings.TrimSpace(p); p != "" {
+				path = append(path, p)
+			}
+		}
+
+		item, errs := buildSyllabusItem(topic, path, attrs, defaults, line)
+		problems = append(problems, errs...)
+		if len(errs) == 0 {
+			items = append(items, item)
+		}
+	}
+	return items, problems
+}
+
+func csvHeader(record []string) ([]string, bool) {
+	columns := make([]string, len(record))
+	found := false
+	for i, name := range record {
+		if col, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			columns[i] = col
+			found = found || col == "topic"
+		}
+	}
+	return columns, found
+}
+
+// buildSyllabusItem 合并默认值并校验题型、数量与语言
+func buildSyllabusItem(topic string, path []string, attrs map[string]string, defaults SyllabusDefaults, line int) (SyllabusItem, []string) {
+	item := SyllabusItem{
+		Topic:    topic,
+		Path:     path,
+		Type:     defaults.Type,
+		Count:    defaults.Count,
+		Language: defaults.Language,
+		Line:     line,
+	}
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("第%d行 %s", line, fmt.Sprintf(format, args...)))
+	}
+
+	if item.Topic == "" {
+		add("缺少知识点")
+	}
+	if v := attrs["type"]; v != "" {
+		t, ok := parseQuestionType(v)
+		if !ok {
+			add("题型无效: %q（可用 1/2/3、单选/多选/编程）", v)
+		}
+		item.Type = t
+	}
+	if v := attrs["count"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTopicCount {
+			add("数量无效: %q（1-%d）", v, maxTopicCount)
+		}
+		item.Count = n
+	}
+	if v := attrs["language"]; v != "" {
+		item.Language = strings.ToLower(v)
+	}
+	if !contains(SupportedLanguages, item.Language) {
+		add("不支持的编程语言: %q", item.Language)
+	}
+	return item, problems
+}
+
+// parseQuestionType 支持数字与中英文题型名称
+func parseQuestionType(v string) (int, bool) {
+	switch strings.ToLower(strings.TrimSuffix(v, "题")) {
+	case "1", "单选", "single":
+		return config.SingleSelect, true
+	case "2", "多选", "multi", "multiple":
+		return config.MultiSelect, true
+	case "3", "编程", "code", "coding":
+		return config.Coding, true
+	}
+	return 0, false
+}
+
+func contains(list []string, target string) bool {
+	for _, v := range list {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
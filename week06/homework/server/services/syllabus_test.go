@@ -0,0 +1,160 @@
+package services
+
+import (
+	"Server/config"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testSyllabusDefaults = SyllabusDefaults{Type: config.SingleSelect, Count: 5, Language: "go"}
+
+func TestSplitCount(t *testing.T) {
+	tests := []struct {
+		count int
+		want  []int
+	}{
+		{1, []int{1}},
+		{3, []int{3}},
+		{10, []int{10}},
+		{11, []int{6, 5}},
+		{20, []int{10, 10}},
+		{21, []int{7, 7, 7}},
+		{50, []int{10, 10, 10, 10, 10}},
+	}
+	for _, tt := range tests {
+		got := splitCount(tt.count)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCount(%d) = %v, want %v", tt.count, got, tt.want)
+		}
+		sum := 0
+		for _, n := range got {
+			sum += n
+			if n > maxRequestCount {
+				t.Errorf("splitCount(%d) part %d exceeds %d", tt.count, n, maxRequestCount)
+			}
+		}
+		if sum != tt.count {
+			t.Errorf("splitCount(%d) sums to %d", tt.count, sum)
+		}
+	}
+}
+
+func TestExpandSyllabus(t *testing.T) {
+	items := []SyllabusItem{
+		{Topic: "channel", Type: config.SingleSelect, Count: 2, Language: "go"},
+		{Topic: "goroutine", Type: config.MultiSelect, Count: 12, Language: "go"},
+	}
+	tasks := ExpandSyllabus(items)
+	if len(tasks) != 3 {
+		t.Fatalf("got %d tasks, want 3", len(tasks))
+	}
+
+	// 少于3道时按3道请求，只保留所需数量
+	if tasks[0].Request.Count != minRequestCount || tasks[0].Keep != 2 {
+		t.Errorf("task 0 count/keep = %d/%d, want %d/2", tasks[0].Request.Count, tasks[0].Keep, minRequestCount)
+	}
+	// 拆分出的后续请求跳过缓存
+	if tasks[1].Request.Cache != "" || tasks[2].Request.Cache != CacheBypass {
+		t.Errorf("cache = %q/%q, want \"\"/%q", tasks[1].Request.Cache, tasks[2].Request.Cache, CacheBypass)
+	}
+	if tasks[1].Item != 1 || tasks[1].Request.Count+tasks[2].Request.Count != 12 {
+		t.Errorf("goroutine tasks = %+v, %+v", tasks[1], tasks[2])
+	}
+}
+
+func TestParseMarkdownSyllabus(t *testing.T) {
+	data := "# Go 基础 [language=go]\n" +
+		"## 并发 [type=多选]\n" +
+		"- goroutine [count=12]\n" +
+		"- channel\n" +
+		"  - 无缓冲 channel [count=3 type=单选]\n" +
+		"```\n" +
+		"- 代码块中的列表不是知识点\n" +
+		"```\n" +
+		"## 接口\n" +
+		"1. 类型断言 【language=java】\n"
+	items, err := ParseSyllabus("outline.md", []byte(data), testSyllabusDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SyllabusItem{
+		{Topic: "goroutine", Path: []string{"Go 基础", "并发"}, Type: config.MultiSelect, Count: 12, Language: "go", Line: 3},
+		{Topic: "无缓冲 channel", Path: []string{"Go 基础", "并发", "channel"}, Type: config.SingleSelect, Count: 3, Language: "go", Line: 5},
+		{Topic: "类型断言", Path: []string{"Go 基础", "接口"}, Type: config.SingleSelect, Count: 5, Language: "java", Line: 10},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("items =\n%+v\nwant\n%+v", items, want)
+	}
+	if tags := items[1].Tags(); !reflect.DeepEqual(tags, []string{"Go 基础", "并发", "channel", "无缓冲 channel"}) {
+		t.Errorf("tags = %v", tags)
+	}
+}
+
+func TestParseCSVSyllabus(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []SyllabusItem
+	}{
+		{
+			name: "header",
+			data: "\xEF\xBB\xBF知识点,数量,章节\ngoroutine,8,Go/并发\n,,\nchannel,,\n",
+			want: []SyllabusItem{
+				{Topic: "goroutine", Path: []string{"Go", "并发"}, Type: config.SingleSelect, Count: 8, Language: "go", Line: 2},
+				{Topic: "channel", Type: config.SingleSelect, Count: 5, Language: "go", Line: 4},
+			},
+		},
+		{
+			name: "positional",
+			data: "闭包,编程,4,Python\n",
+			want: []SyllabusItem{
+				{Topic: "闭包", Type: config.Coding, Count: 4, Language: "python", Line: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := ParseSyllabus("outline.csv", []byte(tt.data), testSyllabusDefaults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(items, tt.want) {
+				t.Errorf("items =\n%+v\nwant\n%+v", items, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSyllabusErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+		want     []string // 错误信息应包含的内容
+	}{
+		{"unsupported format", "outline.txt", "- goroutine", []string{"不支持的大纲格式"}},
+		{"empty", "outline.md", "没有标题和列表\n", []string{"没有找到知识点"}},
+		{
+			name:     "all problems reported",
+			filename: "outline.md",
+			data:     "- a [type=判断]\n- b [count=0]\n- c [language=rust]\n",
+			want:     []string{"第1行 题型无效", "第2行 数量无效", "第3行 不支持的编程语言"},
+		},
+		{"csv missing topic", "outline.csv", "topic,count\n,3\n", []string{"第2行 缺少知识点"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSyllabus(tt.filename, []byte(tt.data), testSyllabusDefaults)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not contain %q", err, w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"Server/config"
+	"Server/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxTemplateVariables = 10
+	maxTemplateValues    = 1000    // 单个变量最多的取值个数
+	maxTemplateOptions   = 6       // 正确选项加干扰项的总数
+	maxTemplateAttempts  = 500     // 生成一个实例时最多尝试的取值组数
+	MaxTemplateVariants  = 100     // 一次最多生成的实例数
+	MaxTemplateSpace     = 1000000 // 取值组合数超过这一数值时只报告上限
+)
+
+// ErrTemplateUnsatisfiable 多次取值仍找不到满足约束、选项互不相同的组合
+var ErrTemplateUnsatisfiable = errors.New("找不到满足约束且选项互不相同的变量取值，请放宽约束或调整干扰项")
+
+var (
+	templateVarName     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	templatePlaceholder = regexp.MustCompile(`\{\{(.*?)\}\}`)
+)
+
+// CompiledTemplate 校验并解析过表达式的模板，可按种子生成题目实例
+type CompiledTemplate struct {
+	t           *storage.QuestionTemplate
+	domains     [][]interface{} // 与 t.Variables 一一对应的取值
+	constraints []*Expr
+	title       templateText
+	options     []templateText // 第一个为正确选项，其余为干扰项
+	explains    []templateText
+	hint        templateText
+}
+
+// templateText 由文本片段与 {{公式}} 组成的模板文本
+type templateText []templatePart
+
+type templatePart struct {
+	text string
+	expr *Expr
+}
+
+// CompileTemplate 校验模板：题型、变量定义、表达式语法与引用的变量，以及代码块是否闭合
+func CompileTemplate(t *storage.QuestionTemplate) (*CompiledTemplate, error) {
+	// 1. 基本字段
+	if t.Type != config.SingleSelect && t.Type != config.Coding {
+		return nil, errors.New("模板只支持单选题（1）与编程题（3）")
+	}
+	if strings.TrimSpace(t.Title) == "" {
+		return nil, errors.New("模板标题不能为空")
+	}
+	if strings.TrimSpace(t.Answer) == "" {
+		return nil, errors.New("正确选项 answer 不能为空")
+	}
+	if len(t.Distractors) == 0 || len(t.Distractors)+1 > maxTemplateOptions {
+		return nil, fmt.Errorf("干扰项 distractors 需要 1-%d 个", maxTemplateOptions-1)
+	}
+	if len(t.Explanations) > len(t.Distractors)+1 {
+		return nil, errors.New("解析 explanations 与正确选项、干扰项依次对应，数量不能多于选项")
+	}
+	if err := ValidateQuestionMarkdown(t.Title, append([]string{t.Answer}, t.Distractors...), t.Explanations, t.Hint); err != nil {
+		return nil, err
+	}
+
+	// 2. 变量取值
+	if len(t.Variables) == 0 || len(t.Variables) > maxTemplateVariables {
+		return nil, fmt.Errorf("模板需要 1-%d 个变量", maxTemplateVariables)
+	}
+	ct := &CompiledTemplate{t: t}
+	known := make(map[string]bool, len(t.Variables))
+	for _, v := range t.Variables {
+		if !templateVarName.MatchString(v.Name) || exprFuncs[v.Name].call != nil || v.Name == "true" || v.Name == "false" {
+			return nil, fmt.Errorf("无效的变量名: %q", v.Name)
+		}
+		if known[v.Name] {
+			return nil, fmt.Errorf("变量 %s 重复定义", v.Name)
+		}
+		known[v.Name] = true
+		domain, err := variableDomain(v)
+		if err != nil {
+			return nil, err
+		}
+		ct.domains = append(ct.domains, domain)
+	}
+
+	// 3. 约束与文本中的公式，只能引用已定义的变量
+	for _, src := range t.Constraints {
+		e, err := ParseExpr(src)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkVars(e, known); err != nil {
+			return nil, err
+		}
+		ct.constraints = append(ct.constraints, e)
+	}
+	var err error
+	if ct.title, err = parseTemplateText(t.Title, known); err != nil {
+		return nil, fmt.Errorf("标题: %w", err)
+	}
+	for i, src := range append([]string{t.Answer}, t.Distractors...) {
+		text, err := parseTemplateText(src, known)
+		if err != nil {
+			return nil, fmt.Errorf("选项 %d: %w", i+1, err)
+		}
+		ct.options = append(ct.options, text)
+	}
+	for i, src := range t.Explanations {
+		text, err := parseTemplateText(src, known)
+		if err != nil {
+			return nil, fmt.Errorf("解析 %d: %w", i+1, err)
+		}
+		ct.explains = append(ct.explains, text)
+	}
+	if ct.hint, err = parseTemplateText(t.Hint, known); err != nil {
+		return nil, fmt.Errorf("提示: %w", err)
+	}
+	return ct, nil
+}
+
+// variableDomain 展开变量的全部取值
+func variableDomain(v storage.TemplateVariable) ([]interface{}, error) {
+	if len(v.Values) > 0 {
+		if len(v.Values) > maxTemplateValues {
+			return nil, fmt.Errorf("变量 %s 最多 %d 个取值", v.Name, maxTemplateValues)
+		}
+		domain := make([]interface{}, 0, len(v.Values))
+		for _, val := range v.Values {
+			switch x := val.(type) {
+			case float64, string, bool:
+				domain = append(domain, x)
+			default:
+				return nil, fmt.Errorf("变量 %s 的取值只能是数字、字符串或布尔值", v.Name)
+			}
+		}
+		return domain, nil
+	}
+	step := v.Step
+	if step == 0 {
+		step = 1
+	}
+	if step < 0 || v.Max < v.Min {
+		return nil, fmt.Errorf("变量 %s 的取值范围无效（min ≤ max，step > 0）", v.Name)
+	}
+	// 在无符号整数上计算区间长度，min、max 接近整数边界时也不会溢出
+	span := uint64(v.Max) - uint64(v.Min)
+	if span/uint64(step) >= maxTemplateValues {
+		return nil, fmt.Errorf("变量 %s 最多 %d 个取值，请缩小范围或增大 step", v.Name, maxTemplateValues)
+	}
+	n := int(span/uint64(step)) + 1
+	domain := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		domain = append(domain, float64(v.Min+i*step))
+	}
+	return domain, nil
+}
+
+func checkVars(e *Expr, known map[string]bool) error {
+	for _, name := range e.Vars() {
+		if !known[name] {
+			return fmt.Errorf("表达式 %q 引用了未定义的变量 %s", e.src, name)
+		}
+	}
+	return nil
+}
+
+// parseTemplateText 拆分文本中的 {{公式}}
+func parseTemplateText(src string, known map[string]bool) (templateText, error) {
+	var text templateText
+	last := 0
+	for _, m := range templatePlaceholder.FindAllStringSubmatchIndex(src, -1) {
+		e, err := ParseExpr(src[m[2]:m[3]])
+		if err != nil {
+			return nil, err
+		}
+		if err := checkVars(e, known); err != nil {
+			return nil, err
+		}
+		text = append(text, templatePart{text: src[last:m[0]]}, templatePart{expr: e})
+		last = m[1]
+	}
+	return append(text, templatePart{text: src[last:]}), nil
+}
+
+func (t templateText) render(vars map[string]interface{}) (string, error) {
+	var sb strings.Builder
+	for _, p := range t {
+		if p.expr == nil {
+			sb.WriteString(p.text)
+			continue
+		}
+		v, err := p.expr.Eval(vars)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(FormatValue(v))
+	}
+	return sb.String(), nil
+}
+
+// SpaceSize 变量取值的组合数（未考虑约束），超过 limit 时返回 limit
+func (ct *CompiledTemplate) SpaceSize(limit int) int {
+	size := 1
+	for _, d := range ct.domains {
+		size *= len(d)
+		if size >= limit {
+			return limit
+		}
+	}
+	return size
+}
+
+// Instantiate 按种子生成一个题目实例，相同种子得到相同的取值与选项顺序
+func (ct *CompiledTemplate) Instantiate(seed int64) (*storage.TemplateVariant, error) {
+	rng := rand.New(rand.NewSource(seed))
+	var lastErr error
+	for attempt := 0; attempt < maxTemplateAttempts; attempt++ {
+		vars := make(map[string]interface{}, len(ct.domains))
+		values := make([]interface{}, len(ct.domains))
+		for i, d := range ct.domains {
+			values[i] = d[rng.Intn(len(d))]
+			vars[ct.t.Variables[i].Name] = values[i]
+		}
+		v, err := ct.build(vars, rng)
+		if err != nil {
+			if !errors.Is(err, errExprRuntime) && !errors.Is(err, errTemplateRejected) {
+				return nil, err // 类型错误等与取值无关，换取值也不会通过
+			}
+			lastErr = err
+			continue
+		}
+		signature, _ := json.Marshal(values)
+		v.Seed, v.Signature, v.Values = seed, string(signature), vars
+		return v, nil
+	}
+	if lastErr != nil && errors.Is(lastErr, errExprRuntime) {
+		return nil, fmt.Errorf("%w（%v）", ErrTemplateUnsatisfiable, lastErr)
+	}
+	return nil, ErrTemplateUnsatisfiable
+}
+
+// errTemplateRejected 取值不满足约束或选项重复
+var errTemplateRejected = errors.New("取值不满足要求")
+
+// build 检查约束并生成题目内容，选项按 rng 打乱
+func (ct *CompiledTemplate) build(vars map[string]interface{}, rng *rand.Rand) (*storage.TemplateVariant, error) {
+	// 1. 约束
+	for _, c := range ct.constraints {
+		ok, err := c.Eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		if !truthy(ok) {
+			return nil, errTemplateRejected
+		}
+	}
+
+	// 2. 选项必须互不相同（忽略首尾空白）
+	options := make([]string, len(ct.options))
+	seen := make(map[string]bool, len(options))
+	for i, text := range ct.options {
+		rendered, err := text.render(vars)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.TrimSpace(rendered)
+		if key == "" || seen[key] {
+			return nil, errTemplateRejected
+		}
+		seen[key] = true
+		options[i] = rendered
+	}
+
+	// 3. 标题、解析与提示，解析与选项一一对应
+	v := &storage.TemplateVariant{TemplateID: ct.t.ID, WorkspaceID: ct.t.WorkspaceID}
+	var err error
+	if v.Title, err = ct.title.render(vars); err != nil {
+		return nil, err
+	}
+	explanations := make([]string, len(options))
+	for i, text := range ct.explains {
+		if explanations[i], err = text.render(vars); err != nil {
+			return nil, err
+		}
+	}
+	if v.Hint, err = ct.hint.render(vars); err != nil {
+		return nil, err
+	}
+
+	// 4. 打乱选项（解析随选项移动），记录正确选项的字母
+	for pos, orig := range rng.Perm(len(options)) {
+		v.Answers = append(v.Answers, options[orig])
+		if len(ct.explains) > 0 {
+			v.Explanations = append(v.Explanations, explanations[orig])
+		}
+		if orig == 0 {
+			v.Rights = []string{string(rune('A' + pos))}
+		}
+	}
+	return v, nil
+}
+
+// Variants 从种子开始生成最多 n 个取值互不相同的实例，跳过 exclude 中的取值（如学生已经做过的）
+func (ct *CompiledTemplate) Variants(seed int64, n int, exclude map[string]bool) ([]*storage.TemplateVariant, error) {
+	variants := make([]*storage.TemplateVariant, 0, n)
+	seen := make(map[string]bool, len(exclude)+n)
+	for s := range exclude {
+		seen[s] = true
+	}
+	for i := 0; len(variants) < n && i < n*20; i++ {
+		v, err := ct.Instantiate(seed + int64(i))
+		if err != nil {
+			return nil, err
+		}
+		if seen[v.Signature] {
+			continue
+		}
+		seen[v.Signature] = true
+		variants = append(variants, v)
+	}
+	return variants, nil
+}
+
+// VariantQuestion 把实例转为题目，供组卷与渲染使用
+func VariantQuestion(t *storage.QuestionTemplate, v *storage.TemplateVariant) storage.Question {
+	return storage.Question{
+		Type:         t.Type,
+		Title:        v.Title,
+		Language:     t.Language,
+		Answers:      v.Answers,
+		Rights:       v.Rights,
+		Tags:         t.Tags,
+		Explanations: v.Explanations,
+		Hint:         v.Hint,
+		Locale:       config.LocaleZh,
+		WorkspaceID:  t.WorkspaceID,
+	}
+}
+
+// ExamTemplateVariants 为每份试卷生成模板题目的实例：同一模板在各份试卷中尽量取不同的值，
+// 相同种子得到相同的试卷
+func ExamTemplateVariants(templates []*CompiledTemplate, seed int64, papers int) ([][]*storage.TemplateVariant, error) {
+	result := make([][]*storage.TemplateVariant, papers)
+	for _, ct := range templates {
+		used := make(map[string]bool)
+		for p := 0; p < papers; p++ {
+			// 种子由试卷种子、试卷序号与模板ID组成，增减模板不影响其他模板的取值
+			base := seed*7919 + int64(p)*104729 + int64(ct.t.ID)
+			variants, err := ct.Variants(base, 1, used)
+			if err != nil {
+				return nil, fmt.Errorf("模板 %d: %w", ct.t.ID, err)
+			}
+			var v *storage.TemplateVariant
+			if len(variants) > 0 {
+				v = variants[0]
+			} else if v, err = ct.Instantiate(base); err != nil { // 取值组合用完时允许重复
+				return nil, fmt.Errorf("模板 %d: %w", ct.t.ID, err)
+			}
+			used[v.Signature] = true
+			result[p] = append(result[p], v)
+		}
+	}
+	return result, nil
+}
+
+// Template 编译前的模板
+func (ct *CompiledTemplate) Template() *storage.QuestionTemplate {
+	return ct.t
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"Server/storage"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVariableDomain(t *testing.T) {
+	tests := []struct {
+		name string
+		v    storage.TemplateVariable
+		want []interface{}
+	}{
+		{"default step", storage.TemplateVariable{Name: "a", Min: 1, Max: 4}, []interface{}{1.0, 2.0, 3.0, 4.0}},
+		{"step", storage.TemplateVariable{Name: "a", Min: -5, Max: 6, Step: 5}, []interface{}{-5.0, 0.0, 5.0}},
+		{"single", storage.TemplateVariable{Name: "a", Min: 3, Max: 3}, []interface{}{3.0}},
+		{"values", storage.TemplateVariable{Name: "a", Values: []interface{}{"x", 2.0, true}}, []interface{}{"x", 2.0, true}},
+		{"max values", storage.TemplateVariable{Name: "a", Min: 1, Max: maxTemplateValues}, nil},
+		// 接近整数边界的范围，步长足够大时也能展开且不会溢出
+		{"int bounds", storage.TemplateVariable{Name: "a", Min: math.MinInt, Max: math.MaxInt, Step: math.MaxInt}, []interface{}{float64(math.MinInt), -1.0, float64(math.MaxInt - 1)}},
+		{"near max", storage.TemplateVariable{Name: "a", Min: math.MaxInt - 2, Max: math.MaxInt}, []interface{}{float64(math.MaxInt - 2), float64(math.MaxInt - 1), float64(math.MaxInt)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := variableDomain(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if len(got) != maxTemplateValues {
+					t.Errorf("got %d values, want %d", len(got), maxTemplateValues)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariableDomainErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		v    storage.TemplateVariable
+		want string // 错误信息应包含的内容
+	}{
+		{"max < min", storage.TemplateVariable{Name: "a", Min: 5, Max: 1}, "取值范围无效"},
+		{"negative step", storage.TemplateVariable{Name: "a", Min: 1, Max: 5, Step: -1}, "取值范围无效"},
+		{"too many", storage.TemplateVariable{Name: "a", Min: 0, Max: maxTemplateValues}, "最多"},
+		// 区间长度超出 int 范围时曾经溢出为负数，绕过上限后死循环
+		{"overflow", storage.TemplateVariable{Name: "a", Min: math.MinInt, Max: math.MaxInt}, "最多"},
+		{"overflow step", storage.TemplateVariable{Name: "a", Min: -1, Max: math.MaxInt, Step: 2}, "最多"},
+		{"values too many", storage.TemplateVariable{Name: "a", Values: make([]interface{}, maxTemplateValues+1)}, "最多"},
+		{"invalid value", storage.TemplateVariable{Name: "a", Values: []interface{}{[]interface{}{1.0}}}, "只能是数字、字符串或布尔值"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := variableDomain(tt.v)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -3,32 +3,24 @@ package services
 import (
 	"Server/config"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"sort"
 	"strings"
-	"time"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
-const tongyiEndpoint = "https://dashscope.aliyuncs.com/compatible-mode/v1"
-
 type TongyiClient struct {
-	client  *openai.Client
-	timeout time.Duration
+	client   *openai.Client
+	settings modelSettings
 }
 
-func NewTongyiClient(apiKey string, timeout time.Duration) *TongyiClient {
-	config := openai.DefaultConfig(apiKey)
-	config.BaseURL = tongyiEndpoint
-	config.APIVersion = "" 
-
+func NewTongyiClient(p config.ProviderConfig, settings modelSettings) *TongyiClient {
 	return &TongyiClient{
-		client:  openai.NewClientWithConfig(config),
-		timeout: timeout,
+		client:   newOpenAIClient(p),
+		settings: settings,
 	}
 }
 
@@ -61,7 +53,15 @@ func buildTongyiPrompt(req config.QuestionRequest) string {
 					"C: WaitGroup的Add()必须在goroutine外调用",
 					"D: map的并发读写需要加锁"
 				],
-				"rights": ["D"]  //有且仅有一个正确答案
+				"rights": ["D"],  //有且仅有一个正确答案
+				"explanations": [
+					"A错误：channel可以传递任意类型，包括结构体、指针和函数",
+					"B错误：读多写少场景更适合使用sync.RWMutex",
+					"C错误：Add()通常在启动goroutine前调用以避免竞态，但并非语法强制要求",
+					"D正确：map不是并发安全的，并发读写会触发fatal error，需要加锁或使用sync.Map"
+				],
+				"hint": "想一想哪些内置类型不是并发安全的",
+				"reference": "https://go.dev/ref/mem"
 			},
 			{
                 "title": "Go语言切片行为相关说法",
@@ -129,23 +129,22 @@ func buildTongyiPrompt(req config.QuestionRequest) string {
 	builder.WriteString("4. 编程题的ABCD四个选项必须是纯代码段\n")
 	builder.WriteString("5. 严格保证每次生成的题目的标题和选项都不同\n")
 	builder.WriteString("6. 生成题目title必须是提问句,以？结尾\n")
+	builder.WriteString("7. 每道题必须包含explanations数组，与answers一一对应，逐条说明该选项正确或错误的原因（answers为null时explanations也设为null）\n")
+	builder.WriteString("8. 每道题必须包含hint（不超过30字的提示，不得直接透露答案）和reference（官方文档等参考链接，没有合适链接时填空字符串）\n")
+	builder.WriteString("9. title、answers、explanations、hint均使用Markdown格式：行内代码用`包裹，多行代码放入标注语言的```代码块（如\"A: \\n```go\\nfunc f() {}\\n```\"），代码块必须成对闭合\n")
 
 	return builder.String()
 }
 
 func parseTongyiResponse(content string, req config.QuestionRequest) (*config.QuestionResponses, error) {
-	// 预处理：去除可能存在的杂项
-    content = strings.TrimSpace(content)
-    if !strings.HasPrefix(content, "[") || !strings.HasSuffix(content, "]") {
-        return nil, fmt.Errorf("响应内容不是有效的JSON数组")
-    }
-    var response []config.QuestionResponse
-	if err := json.Unmarshal([]byte(content), &response); err != nil {
-		return nil, fmt.Errorf("响应解析失败: %w", err)
+	// 预处理：去除代码块标记、注释与多余的逗号，取出包装对象中的题目数组
+	response, repairs, err := extractQuestions(content)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(response) != req.Count {
-		return nil, fmt.Errorf("题目数量错误，预期 %d 道，实际 %d 道", req.Count, len(response))
+	if err := checkQuestionCount(response, req.Count, repairs); err != nil {
+		return nil, err
 	}
 
 	switch req.Type {
@@ -156,7 +155,7 @@ func parseTongyiResponse(content string, req config.QuestionRequest) (*config.Qu
 			seen := make(map[string]bool)
 			for _, r := range question.Rights {
 				if seen[r] {
-					return nil, fmt.Errorf("答案重复：%s", r)
+					return nil, invalid("duplicate_answer", "答案重复：%s", r)
 				}
 				seen[r] = true
 			}
@@ -166,7 +165,7 @@ func parseTongyiResponse(content string, req config.QuestionRequest) (*config.Qu
 				copy(sorted, question.Rights)
 				sort.Strings(sorted)
 				if !reflect.DeepEqual(sorted, question.Rights) {
-					return nil, fmt.Errorf("答案必须按字母顺序排列，当前顺序：%v", question.Rights)
+					return nil, invalid("answer_order", "答案必须按字母顺序排列，当前顺序：%v", question.Rights)
 				}
 			}
 		}
@@ -174,13 +173,19 @@ func parseTongyiResponse(content string, req config.QuestionRequest) (*config.Qu
 		// 编程题校验逻辑（可根据需要补充）
 	}
 
+	normalizeExplanations(response)
+	if err := validateResponseMarkdown(response); err != nil {
+		return nil, err
+	}
+
 	return &config.QuestionResponses{
         Questions: response,
+        Repairs:   repairs.notes,
     }, nil
 }
 
 func (c *TongyiClient) Generate(ctx context.Context, req config.QuestionRequest) (*config.QuestionResponses, error) {
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	ctx, cancel := context.WithTimeout(ctx, c.settings.timeout)
 	defer cancel()
 
 	if req.Keyword == "" {
@@ -190,14 +195,14 @@ func (c *TongyiClient) Generate(ctx context.Context, req config.QuestionRequest)
 		return nil, errors.New("编程语言必须指定")
 	}
 
-	prompt := buildTongyiPrompt(req)
+	prompt := appendExtraRules(buildTongyiPrompt(req), c.settings.prompt.ExtraRules, 10)
 
 	request := openai.ChatCompletionRequest{
-		Model: "qwen-turbo",
+		Model: c.settings.model,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleSystem,
-				Content: "你是一个严格遵循格式要求的编程题库生成助手",
+				Content: c.settings.systemPrompt("你是一个严格遵循格式要求的编程题库生成助手"),
 			},
 			{
 				Role:    openai.ChatMessageRoleUser,
@@ -205,36 +210,24 @@ func (c *TongyiClient) Generate(ctx context.Context, req config.QuestionRequest)
 			},
 		},
 		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: "json_object"},
-		Temperature:    0.3,
-		MaxTokens:      2000,
-	}
-
-	maxRetries := 3
-	var resp openai.ChatCompletionResponse
-	var err error // 修复：修正变量名拼写错误
-
-	for i := 0; i < maxRetries; i++ {
-		resp, err = c.client.CreateChatCompletion(ctx, request)
-		if err == nil {
-			break
-		}
-
-		if isRetriableError(err) {
-			wait := time.Duration(i+1) * 2 * time.Second
-			fmt.Printf("[TONGYI_WARN] 请求失败，%s后重试... 错误：%v\n", wait, err)
-			time.Sleep(wait)
-			continue
-		}
-		break
+		Temperature:    c.settings.temperature,
+		MaxTokens:      c.settings.maxTokens,
 	}
 
+	resp, err := createWithRetry(ctx, c.client, c.settings, "generate", request)
 	if err != nil {
-		return nil, fmt.Errorf("API请求失败（尝试%d次）：%w", maxRetries, err)
+		return nil, err
 	}
 
 	rawResponse := resp.Choices[0].Message.Content
 
-	return parseTongyiResponse(rawResponse, req)
+	result, err := parseTongyiResponse(rawResponse, req)
+	if err != nil {
+		return nil, err
+	}
+	logRepairs(c.settings.model, "generate", result.Repairs)
+	result.Usage = c.settings.usage(resp.Usage)
+	return result, nil
 }
 
 func isRetriableError(err error) bool {
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"Server/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+var localeNames = map[string]string{
+	config.LocaleZh: "简体中文",
+	config.LocaleEn: "英文（English）",
+}
+
+// 代码块与行内代码，翻译时必须原样保留
+var codePattern = regexp.MustCompile("(?s)```.*?```|`[^`\n]+`")
+
+// 选项前缀，如 "A: "、"B."
+var optionPrefixPattern = regexp.MustCompile(`^[A-Z][:.：]\s*`)
+
+func buildTranslatePrompt(q config.QuestionRequest1, locale string) string {
+	var builder strings.Builder
+
+	builder.WriteString(fmt.Sprintf("请将以下%s翻译为%s：\n", getQuestionTypeText(q.Type), localeNames[locale]))
+	source := config.Translation{
+		Title:        q.Title,
+		Answers:      q.Answers,
+		Explanations: q.Explanations,
+		Hint:         q.Hint,
+	}
+	data, _ := json.MarshalIndent(source, "", "  ")
+	builder.Write(data)
+
+	builder.WriteString("\n\n请返回与上面结构完全相同的JSON对象（title、answers、explanations、hint）。\n")
+	builder.WriteString("\n必须遵守：\n")
+	builder.WriteString("1. 只翻译自然语言文字，代码块（```包裹的内容）和行内代码（`包裹的内容）必须原样保留\n")
+	builder.WriteString("2. 编程题选项若是纯代码，必须原样保留，不得改写\n")
+	builder.WriteString("3. 选项顺序不得调整，选项开头的字母前缀（如\"A: \"）必须原样保留\n")
+	builder.WriteString(fmt.Sprintf("4. answers必须有%d项，explanations必须有%d项\n", len(q.Answers), len(q.Explanations)))
+	builder.WriteString("5. 关键字、函数名、类型名等编程术语保持原文\n")
+
+	return builder.String()
+}
+
+// parseTranslation 解析译文，同时返回解析响应时所做的修复
+func parseTranslation(content string, q config.QuestionRequest1) (*config.Translation, []string, error) {
+	data, repairs, err := extractJSON(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tr config.Translation
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return nil, nil, invalid("invalid_json", "译文解析失败: %w", err)
+	}
+	if err := validateTranslation(q, &tr); err != nil {
+		return nil, nil, err
+	}
+	return &tr, repairs.notes, nil
+}
+
+// validateTranslation 校验译文结构与原题一致：标题非空、选项与解析数量相同、
+// 选项字母前缀不变、代码片段原样保留
+func validateTranslation(q config.QuestionRequest1, tr *config.Translation) error {
+	if strings.TrimSpace(tr.Title) == "" {
+		return invalid("empty_title", "译文标题为空")
+	}
+	if len(tr.Answers) != len(q.Answers) {
+		return invalid("count_mismatch", "译文选项数量错误，预期 %d 个，实际 %d 个", len(q.Answers), len(tr.Answers))
+	}
+	if len(q.Explanations) > 0 && len(tr.Explanations) != len(q.Explanations) {
+		return invalid("count_mismatch", "译文解析数量错误，预期 %d 条，实际 %d 条", len(q.Explanations), len(tr.Explanations))
+	}
+	if len(q.Explanations) == 0 {
+		tr.Explanations = nil
+	}
+
+	for i := range q.Answers {
+		srcPrefix := optionPrefixPattern.FindString(q.Answers[i])
+		if srcPrefix == "" {
+			continue
+		}
+		if strings.TrimSpace(optionPrefixPattern.FindString(tr.Answers[i])) != strings.TrimSpace(srcPrefix) {
+			return invalid("option_prefix", "选项 %d 前缀被修改，应以 '%s' 开头", i+1, strings.TrimSpace(srcPrefix))
+		}
+	}
+
+	pairs := [][2]string{{q.Title, tr.Title}, {q.Hint, tr.Hint}}
+	for i := range q.Answers {
+		pairs = append(pairs, [2]string{q.Answers[i], tr.Answers[i]})
+	}
+	for i := range q.Explanations {
+		pairs = append(pairs, [2]string{q.Explanations[i], tr.Explanations[i]})
+	}
+	for _, p := range pairs {
+		for _, code := range codePattern.FindAllString(p[0], -1) {
+			if !strings.Contains(p[1], code) {
+				return invalid("code_changed", "译文未原样保留代码片段: %s", code)
+			}
+		}
+	}
+	return nil
+}
+
+// requestTranslation 调用兼容OpenAI接口的模型翻译题目
+func requestTranslation(ctx context.Context, client *openai.Client, settings modelSettings, q config.QuestionRequest1, locale string) (*config.Translation, error) {
+	ctx, cancel := context.WithTimeout(ctx, settings.timeout)
+	defer cancel()
+
+	if _, ok := localeNames[locale]; !ok {
+		return nil, fmt.Errorf("不支持的目标语言: %s", locale)
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model: settings.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "你是一名专业的技术翻译，负责翻译编程题库，严格保留代码与格式",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: buildTranslatePrompt(q, locale),
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: "json_object"},
+		Temperature:    0.1, // 翻译要求忠实原文，使用较低温度
+		MaxTokens:      settings.maxTokens,
+	}
+
+	resp, err := createWithRetry(ctx, client, settings, "translate", request)
+	if err != nil {
+		return nil, err
+	}
+	tr, repairs, err := parseTranslation(resp.Choices[0].Message.Content, q)
+	if err != nil {
+		return nil, err
+	}
+	logRepairs(settings.model, "translate", repairs)
+	return tr, nil
+}
+
+func (c *DeepSeekClient) Translate(ctx context.Context, q config.QuestionRequest1, locale string) (*config.Translation, error) {
+	return requestTranslation(ctx, c.client, c.settings, q, locale)
+}
+
+func (c *TongyiClient) Translate(ctx context.Context, q config.QuestionRequest1, locale string) (*config.Translation, error) {
+	return requestTranslation(ctx, c.client, c.settings, q, locale)
+}
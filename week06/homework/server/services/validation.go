@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ValidationError AI返回内容未通过校验，Reason 用于监控统计
+type ValidationError struct {
+	Reason string
+	Err    error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// invalid 构造校验错误，reason 取值如 invalid_json、count_mismatch、option_count、option_prefix
+func invalid(reason, format string, args ...interface{}) error {
+	return &ValidationError{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// failureReason 将AI调用错误归类，用于失败次数统计
+func failureReason(err error) string {
+	var validation *ValidationError
+	var apiErr *openai.APIError
+	switch {
+	case errors.As(err, &validation):
+		return "validation"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &apiErr):
+		return "api_error"
+	default:
+		return "network"
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"Server/storage"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrorKind 业务错误的类别，HTTP 与 gRPC 分别映射为各自的状态码
+type ErrorKind int
+
+const (
+	ErrInvalid   ErrorKind = iota + 1 // 参数不合法
+	ErrNotFound                       // 资源不存在或不可见
+	ErrForbidden                      // 没有权限
+	ErrQuota                          // 超过工作区配额
+	ErrUpstream                       // AI服务调用失败
+	ErrConflict                       // 与现有数据冲突，如删除被考试引用的题目
+)
+
+// ServiceError 可以直接展示给调用方的业务错误，其他错误按内部错误处理
+type ServiceError struct {
+	Kind ErrorKind
+	Msg  string
+}
+
+func (e *ServiceError) Error() string { return e.Msg }
+
+func serviceError(kind ErrorKind, format string, args ...interface{}) error {
+	return &ServiceError{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// ErrorKindOf 错误的类别，不是 ServiceError 时返回 0
+func ErrorKindOf(err error) ErrorKind {
+	var se *ServiceError
+	if errors.As(err, &se) {
+		return se.Kind
+	}
+	return 0
+}
+
+// Caller 一次请求的调用方：所属工作区与成员角色（开放的工作区角色为空）
+type Caller struct {
+	User      string
+	Workspace *storage.Workspace
+	Role      string
+}
+
+// ResolveWorkspace 按ID或标识查询工作区，ref 为空时返回默认工作区
+func ResolveWorkspace(ctx context.Context, db *storage.Database, ref string) (*storage.Workspace, error) {
+	db = db.WithContext(ctx)
+	var ws *storage.Workspace
+	var err error
+	if ref == "" {
+		ws, err = db.GetWorkspace(storage.DefaultWorkspaceID)
+	} else if id, convErr := strconv.Atoi(ref); convErr == nil {
+		ws, err = db.GetWorkspace(id)
+	} else {
+		ws, err = db.GetWorkspaceBySlug(ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		return nil, serviceError(ErrNotFound, "工作区不存在: %s", ref)
+	}
+	return ws, nil
+}
+
+// Authorize 检查用户对工作区的访问权限，write 表示需要修改题目的权限，返回成员角色。
+// 没有成员的工作区对所有人开放；否则用户必须是成员，viewer 只能查看
+func Authorize(ctx context.Context, db *storage.Database, ws *storage.Workspace, user string, write bool) (string, error) {
+	role, open, err := db.WithContext(ctx).MemberRole(ws.ID, user)
+	if err != nil {
+		return "", err
+	}
+	if open {
+		return "", nil
+	}
+	if role == "" {
+		if user == "" {
+			return "", serviceError(ErrForbidden, "工作区 %s 仅限成员访问，请通过 X-User 指定用户", ws.Slug)
+		}
+		return "", serviceError(ErrForbidden, "用户 %s 不是工作区 %s 的成员", user, ws.Slug)
+	}
+	if write && role == storage.RoleViewer {
+		return "", serviceError(ErrForbidden, "viewer 只能查看题目")
+	}
+	return role, nil
+}
+
+// ResolveCaller 解析工作区并检查权限，HTTP 的 Scope 中间件与 gRPC 拦截器共用
+func ResolveCaller(ctx context.Context, db *storage.Database, ref, user string, write bool) (*Caller, error) {
+	ws, err := ResolveWorkspace(ctx, db, ref)
+	if err != nil {
+		return nil, err
+	}
+	role, err := Authorize(ctx, db, ws, user, write)
+	if err != nil {
+		return nil, err
+	}
+	return &Caller{User: user, Workspace: ws, Role: role}, nil
+}
+
+// LanguageAllowed 工作区是否允许该编程语言
+func LanguageAllowed(ws *storage.Workspace, language string) bool {
+	allowed := ws.Settings.AllowedLanguages
+	return len(allowed) == 0 || slices.Contains(allowed, strings.ToLower(language))
+}
+
+// CheckLanguages 检查题目语言是否在工作区允许的范围内
+func CheckLanguages(ws *storage.Workspace, languages ...string) error {
+	for _, lang := range languages {
+		if !LanguageAllowed(ws, lang) {
+			return serviceError(ErrInvalid, "工作区 %s 不允许 %s 题目（允许 %s）",
+				ws.Slug, lang, strings.Join(ws.Settings.AllowedLanguages, "、"))
+		}
+	}
+	return nil
+}
+
+// CheckQuestionQuota 检查新增 n 道题后是否超过工作区题目数上限
+func CheckQuestionQuota(ctx context.Context, db *storage.Database, ws *storage.Workspace, n int) error {
+	ok, count, err := db.WithContext(ctx).CheckQuestionQuota(ws, n)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return serviceError(ErrQuota, "工作区 %s 已有 %d 道题，新增 %d 道将超过上限 %d",
+			ws.Slug, count, n, ws.Settings.MaxQuestions)
+	}
+	return nil
+}
+
+// ConsumeAIQuota 占用工作区今天的 n 次AI出题调用
+func ConsumeAIQuota(ctx context.Context, db *storage.Database, ws *storage.Workspace, n int) error {
+	ok, used, err := db.WithContext(ctx).ConsumeAIQuota(ws, n)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return serviceError(ErrQuota, "工作区 %s 今天已调用AI出题 %d 次，再调用 %d 次将超过上限 %d",
+			ws.Slug, used, n, ws.Settings.DailyAIRequests)
+	}
+	return nil
+}
+
+// WorkspaceModel 未指定AI服务时使用工作区的默认服务
+func WorkspaceModel(ws *storage.Workspace, model string) string {
+	if model == "" {
+		return ws.Settings.DefaultModel
+	}
+	return model
+}
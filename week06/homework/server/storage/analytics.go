@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CountItem 分组计数结果
+type CountItem struct {
+	Name  string `json:"name" db:"name"`
+	Count int    `json:"count" db:"count"`
+}
+
+// DailyCount 按天计数结果
+type DailyCount struct {
+	Date  string `json:"date" db:"date"`
+	Count int    `json:"count" db:"count"`
+}
+
+// ItemStat 单题作答分析结果
+type ItemStat struct {
+	QuestionID     int      `json:"question_id"`
+	Title          string   `json:"title"`
+	Type           int      `json:"type"`
+	Attempts       int      `json:"attempts"`
+	Correct        int      `json:"correct"`
+	PValue         float64  `json:"p_value"`        // 难度（答对比例）
+	Discrimination *float64 `json:"discrimination"` // 区分度，样本不足时为空
+}
+
+// 区分度计算时高分组/低分组所占比例
+const discriminationGroupRatio = 0.27
+
+// 工作区可见题目的ID，用于与其他表联合查询时避免字段名冲突，参数为工作区ID两次
+const visibleQuestionIDs = `SELECT id FROM questions WHERE ` + VisibleInWorkspace
+
+// CountBy 按指定字段分组计数，只统计工作区可见的题目
+func (d *Database) CountBy(workspaceID int, column string) ([]CountItem, error) {
+	allowed := map[string]bool{"type": true, "language": true, "source": true, "status": true}
+	if !allowed[column] {
+		return nil, fmt.Errorf("不支持的统计字段: %s", column)
+	}
+
+	items := make([]CountItem, 0)
+	query := fmt.Sprintf(`
+		SELECT CAST(%[1]s AS TEXT) AS name, COUNT(*) AS count
+		FROM questions
+		WHERE %[2]s
+		GROUP BY %[1]s
+		ORDER BY count DESC`, column, VisibleInWorkspace)
+	if err := d.db.SelectContext(d.ctx, &items, query, workspaceID, workspaceID); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// CountByTag 按标签分组计数（一道题可属于多个标签），只统计工作区可见的题目
+func (d *Database) CountByTag(workspaceID int) ([]CountItem, error) {
+	items := make([]CountItem, 0)
+	err := d.db.SelectContext(d.ctx, &items, `
+		SELECT t.value AS name, COUNT(*) AS count
+		FROM questions, json_each(questions.tags) AS t
+		WHERE questions.id IN (`+visibleQuestionIDs+`)
+		GROUP BY t.value
+		ORDER BY count DESC`, workspaceID, workspaceID)
+	return items, err
+}
+
+// CountTotal 工作区可见的题目总数
+func (d *Database) CountTotal(workspaceID int) (int, error) {
+	var total int
+	err := d.db.GetContext(d.ctx, &total, "SELECT COUNT(*) FROM questions WHERE "+VisibleInWorkspace, workspaceID, workspaceID)
+	return total, err
+}
+
+// CountByDay 工作区每日新增题目数，无创建时间的旧数据不计入
+func (d *Database) CountByDay(workspaceID int, from, to string) ([]DailyCount, error) {
+	query := `
+		SELECT substr(created_at, 1, 10) AS date, COUNT(*) AS count
+		FROM questions
+		WHERE created_at IS NOT NULL AND ` + VisibleInWorkspace
+	args := []interface{}{workspaceID, workspaceID}
+	if from != "" {
+		query += " AND substr(created_at, 1, 10) >= ?"
+		args = append(args, from)
+	}
+	if to != "" {
+		query += " AND substr(created_at, 1, 10) <= ?"
+		args = append(args, to)
+	}
+	query += " GROUP BY date ORDER BY date"
+
+	items := make([]DailyCount, 0)
+	err := d.db.SelectContext(d.ctx, &items, query, args...)
+	return items, err
+}
+
+// ItemAnalysis 根据作答记录计算每道题的难度(p值)与区分度
+// 区分度采用高低分组法：按学生总体正确率排序，取前后27%，D = P高 - P低
+// 只统计工作区可见的题目，学生分组也只按这些题目的作答计算
+func (d *Database) ItemAnalysis(workspaceID, minAttempts int) ([]ItemStat, error) {
+	// 1. 读取工作区题目的作答记录
+	// 同一题目的各语言版本共享统计，按组（原题ID）汇总
+	var records []struct {
+		QuestionID int    `db:"question_id"`
+		StudentID  string `db:"student_id"`
+		Correct    bool   `db:"correct"`
+	}
+	if err := d.db.SelectContext(d.ctx, &records, `
+		SELECT COALESCE(q.group_id, q.id) AS question_id, a.student_id, a.correct
+		FROM answer_records a
+		JOIN questions q ON q.id = a.question_id
+		WHERE q.id IN (`+visibleQuestionIDs+`)`, workspaceID, workspaceID); err != nil {
+		return nil, err
+	}
+
+	// 2. 计算学生总体正确率并划分高低分组
+	type score struct{ correct, total int }
+	students := make(map[string]*score)
+	for _, r := range records {
+		s, ok := students[r.StudentID]
+		if !ok {
+			s = &score{}
+			students[r.StudentID] = s
+		}
+		s.total++
+		if r.Correct {
+			s.correct++
+		}
+	}
+	ranked := make([]string, 0, len(students))
+	for id := range students {
+		ranked = append(ranked, id)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := students[ranked[i]], students[ranked[j]]
+		ra := float64(a.correct) / float64(a.total)
+		rb := float64(b.correct) / float64(b.total)
+		if ra != rb {
+			return ra > rb
+		}
+		return ranked[i] < ranked[j]
+	})
+	groupSize := int(float64(len(ranked)) * discriminationGroupRatio)
+	upper := make(map[string]bool)
+	lower := make(map[string]bool)
+	if groupSize > 0 {
+		for _, id := range ranked[:groupSize] {
+			upper[id] = true
+		}
+		for _, id := range ranked[len(ranked)-groupSize:] {
+			lower[id] = true
+		}
+	}
+
+	// 3. 按题目汇总
+	type counter struct {
+		attempts, correct  int
+		upTotal, upRight   int
+		lowTotal, lowRight int
+	}
+	byQuestion := make(map[int]*counter)
+	for _, r := range records {
+		c, ok := byQuestion[r.QuestionID]
+		if !ok {
+			c = &counter{}
+			byQuestion[r.QuestionID] = c
+		}
+		c.attempts++
+		if r.Correct {
+			c.correct++
+		}
+		if upper[r.StudentID] {
+			c.upTotal++
+			if r.Correct {
+				c.upRight++
+			}
+		}
+		if lower[r.StudentID] {
+			c.lowTotal++
+			if r.Correct {
+				c.lowRight++
+			}
+		}
+	}
+
+	// 4. 补充题目信息
+	var questions []struct {
+		ID    int    `db:"id"`
+		Title string `db:"title"`
+		Type  int    `db:"type"`
+	}
+	if err := d.db.SelectContext(d.ctx, &questions, "SELECT id, title, type FROM questions WHERE group_id IS NULL AND "+VisibleInWorkspace+" ORDER BY id", workspaceID, workspaceID); err != nil {
+		return nil, err
+	}
+
+	stats := make([]ItemStat, 0)
+	for _, q := range questions {
+		c, ok := byQuestion[q.ID]
+		if !ok || c.attempts < minAttempts {
+			continue
+		}
+		stat := ItemStat{
+			QuestionID: q.ID,
+			Title:      q.Title,
+			Type:       q.Type,
+			Attempts:   c.attempts,
+			Correct:    c.correct,
+			PValue:     float64(c.correct) / float64(c.attempts),
+		}
+		if c.upTotal > 0 && c.lowTotal > 0 {
+			dv := float64(c.upRight)/float64(c.upTotal) - float64(c.lowRight)/float64(c.lowTotal)
+			stat.Discrimination = &dv
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AnswerRecord 学生作答记录
+type AnswerRecord struct {
+	ID         int      `json:"id" db:"id"`
+	QuestionID int      `json:"question_id" db:"question_id"`
+	StudentID  string   `json:"student_id" db:"student_id"`
+	Selected   []string `json:"selected" db:"-"`
+	Correct    bool     `json:"correct" db:"correct"`
+	AnsweredAt string   `json:"answered_at" db:"answered_at"`
+}
+
+// GetRights 读取工作区可见题目的标准答案，题目不可见时返回 sql.ErrNoRows
+func (d *Database) GetRights(workspaceID, questionID int) ([]string, error) {
+	var raw string
+	if err := d.db.GetContext(d.ctx, &raw, "SELECT rights FROM questions WHERE id = ? AND "+VisibleInWorkspace,
+		questionID, workspaceID, workspaceID); err != nil {
+		return nil, err
+	}
+	var rights []string
+	if err := json.Unmarshal([]byte(raw), &rights); err != nil {
+		return nil, fmt.Errorf("答案解析失败: %w", err)
+	}
+	return rights, nil
+}
+
+// SaveAnswers 批量写入作答记录并同步更新学习状态（事务内完成）
+func (d *Database) SaveAnswers(records []AnswerRecord) error {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for i := range records {
+		selectedJSON, _ := json.Marshal(records[i].Selected)
+		err := tx.QueryRow(`
+			INSERT INTO answer_records (question_id, student_id, selected, correct, answered_at)
+			VALUES (?, ?, ?, ?, datetime('now', 'localtime'))
+			RETURNING id, answered_at`,
+			records[i].QuestionID,
+			records[i].StudentID,
+			string(selectedJSON),
+			records[i].Correct,
+		).Scan(&records[i].ID, &records[i].AnsweredAt)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("写入作答记录失败: %w", err)
+		}
+
+		if err := applyLearning(tx, records[i], time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
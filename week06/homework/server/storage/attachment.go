@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const createAttachmentTableSQL = `
+CREATE TABLE IF NOT EXISTS attachments (
+    id TEXT PRIMARY KEY,
+    workspace_id INTEGER NOT NULL DEFAULT 1,
+    filename TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    path TEXT NOT NULL,
+    uploaded_by TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_workspace ON attachments(workspace_id);
+`
+
+// AttachmentScheme Markdown中引用附件的地址前缀，如 ![二叉树](attachment:<id>)
+const AttachmentScheme = "attachment:"
+
+// 附件ID为32位十六进制的UUID（与 file-service 相同）
+var attachmentRefPattern = regexp.MustCompile(AttachmentScheme + `([0-9a-f]{32})`)
+
+// 题目中任一字段包含附件ID即视为引用（变体与共享、复制的题目也在 questions 表中）
+const attachmentReferenced = `EXISTS (SELECT 1 FROM questions q WHERE instr(q.title, a.id) > 0 OR instr(q.answers, a.id) > 0
+    OR instr(q.explanations, a.id) > 0 OR instr(q.hint, a.id) > 0)`
+
+// Attachment 上传到题库的图片
+type Attachment struct {
+	ID          string `json:"id" db:"id"`
+	WorkspaceID int    `json:"workspace_id" db:"workspace_id"`
+	Filename    string `json:"filename" db:"filename"`
+	MimeType    string `json:"mime_type" db:"mime_type"`
+	Size        int64  `json:"size" db:"size"`
+	SHA256      string `json:"sha256" db:"sha256"`
+	Path        string `json:"-" db:"path"`
+	UploadedBy  string `json:"uploaded_by" db:"uploaded_by"`
+	CreatedAt   string `json:"created_at" db:"created_at"`
+	Referenced  bool   `json:"referenced" db:"referenced"`
+}
+
+// AttachmentRefs 文本中引用的附件ID（去重，按出现顺序）
+func AttachmentRefs(texts ...string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, text := range texts {
+		for _, m := range attachmentRefPattern.FindAllStringSubmatch(text, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				ids = append(ids, m[1])
+			}
+		}
+	}
+	return ids
+}
+
+// QuestionAttachmentRefs 题目标题、选项、解析与提示中引用的附件ID
+func QuestionAttachmentRefs(q *Question) []string {
+	texts := append([]string{q.Title, q.Hint}, q.Answers...)
+	return AttachmentRefs(append(texts, q.Explanations...)...)
+}
+
+// CreateAttachment 记录已写入文件存储的附件
+func (d *Database) CreateAttachment(a *Attachment) error {
+	a.CreatedAt = time.Now().Format(timeLayout)
+	_, err := d.db.NamedExecContext(d.ctx, `
+		INSERT INTO attachments (id, workspace_id, filename, mime_type, size, sha256, path, uploaded_by, created_at)
+		VALUES (:id, :workspace_id, :filename, :mime_type, :size, :sha256, :path, :uploaded_by, :created_at)`, a)
+	return err
+}
+
+// GetAttachment 按ID查询附件，不存在时返回 sql.ErrNoRows
+func (d *Database) GetAttachment(id string) (*Attachment, error) {
+	var a Attachment
+	err := d.db.GetContext(d.ctx, &a, `SELECT a.*, `+attachmentReferenced+` AS referenced FROM attachments a WHERE a.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListAttachments 工作区上传的附件，最新的在前
+func (d *Database) ListAttachments(workspaceID int) ([]Attachment, error) {
+	list := []Attachment{}
+	err := d.db.SelectContext(d.ctx, &list, `
+		SELECT a.*, `+attachmentReferenced+` AS referenced FROM attachments a
+		WHERE a.workspace_id = ? ORDER BY a.created_at DESC, a.id`, workspaceID)
+	return list, err
+}
+
+// GetAttachments 按ID批量查询附件，不存在的ID不返回
+func (d *Database) GetAttachments(ids []string) ([]Attachment, error) {
+	list := []Attachment{}
+	if len(ids) == 0 {
+		return list, nil
+	}
+	query, args, err := sqlx.In(`SELECT a.*, 0 AS referenced FROM attachments a WHERE a.id IN (?)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	err = d.db.SelectContext(d.ctx, &list, query, args...)
+	return list, err
+}
+
+// MissingAttachments 不存在的附件ID
+func (d *Database) MissingAttachments(ids []string) ([]string, error) {
+	found, err := d.GetAttachments(ids)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(found))
+	for _, a := range found {
+		exists[a.ID] = true
+	}
+	var missing []string
+	for _, id := range ids {
+		if !exists[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+// DeleteUnreferencedAttachments 删除 ids 中没有被任何题目引用的附件记录，返回被删除的附件（用于删除文件）。
+// 判断与删除在同一条语句中完成，不会误删刚被新题目引用的附件
+func (d *Database) DeleteUnreferencedAttachments(ids []string) ([]Attachment, error) {
+	deleted := []Attachment{}
+	if len(ids) == 0 {
+		return deleted, nil
+	}
+	query, args, err := sqlx.In(`DELETE FROM attachments AS a WHERE a.id IN (?) AND NOT `+attachmentReferenced+`
+		RETURNING id, workspace_id, filename, mime_type, size, sha256, path, uploaded_by, created_at`, ids)
+	if err != nil {
+		return nil, err
+	}
+	err = d.db.SelectContext(d.ctx, &deleted, query, args...)
+	return deleted, err
+}
+
+// StaleAttachments 早于 before 上传、至今没有被任何题目引用的附件ID（上传后未保存题目）
+func (d *Database) StaleAttachments(before time.Time) ([]string, error) {
+	var ids []string
+	err := d.db.SelectContext(d.ctx, &ids, `
+		SELECT a.id FROM attachments a WHERE a.created_at < ? AND NOT `+attachmentReferenced, before.Format(timeLayout))
+	return ids, err
+}
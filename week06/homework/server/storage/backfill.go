@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const createBackfillTableSQL = `
+CREATE TABLE IF NOT EXISTS backfill_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL,
+    model TEXT NOT NULL,
+    overwrite INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    total INTEGER NOT NULL,
+    succeeded INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    canceled INTEGER NOT NULL DEFAULT 0,
+    results TEXT NOT NULL DEFAULT '[]',
+    created_at TEXT NOT NULL,
+    finished_at TEXT NOT NULL DEFAULT ''
+);
+`
+
+// BackfillJob 一次AI批量补写解析，任务与各题目的状态与批量出题相同
+type BackfillJob struct {
+	ID          int              `json:"id" db:"id"`
+	WorkspaceID int              `json:"workspaceId" db:"workspace_id"`
+	Model       string           `json:"model" db:"model"`
+	Overwrite   bool             `json:"overwrite" db:"overwrite"` // 覆盖已有解析
+	Status      string           `json:"status" db:"status"`
+	Total       int              `json:"total" db:"total"`
+	Succeeded   int              `json:"succeeded" db:"succeeded"`
+	Failed      int              `json:"failed" db:"failed"`
+	Canceled    int              `json:"canceled" db:"canceled"`
+	CreatedAt   string           `json:"createdAt" db:"created_at"`
+	FinishedAt  string           `json:"finishedAt" db:"finished_at"`
+	Results     []BackfillResult `json:"results,omitempty" db:"-"`
+}
+
+// BackfillResult 单道题目的补写结果
+type BackfillResult struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CreateBackfillJob 保存新任务并回填ID
+func (d *Database) CreateBackfillJob(job *BackfillJob) error {
+	results, _ := json.Marshal(job.Results)
+	job.CreatedAt = time.Now().Format(timeLayout)
+	err := d.db.QueryRowContext(d.ctx, `
+		INSERT INTO backfill_jobs (workspace_id, model, overwrite, status, total, results, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		job.WorkspaceID, job.Model, job.Overwrite, job.Status, job.Total, string(results), job.CreatedAt,
+	).Scan(&job.ID)
+	if err != nil {
+		return fmt.Errorf("创建补写解析任务失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateBackfillJob 保存任务进度与各题目的结果
+func (d *Database) UpdateBackfillJob(job *BackfillJob) error {
+	results, _ := json.Marshal(job.Results)
+	_, err := d.db.ExecContext(d.ctx, `
+		UPDATE backfill_jobs SET status = ?, succeeded = ?, failed = ?, canceled = ?, results = ?, finished_at = ?
+		WHERE id = ?`,
+		job.Status, job.Succeeded, job.Failed, job.Canceled, string(results), job.FinishedAt, job.ID)
+	if err != nil {
+		return fmt.Errorf("更新补写解析任务失败: %w", err)
+	}
+	return nil
+}
+
+// GetBackfillJob 查询任务及各题目的结果，不存在时返回 nil
+func (d *Database) GetBackfillJob(id int) (*BackfillJob, error) {
+	var row struct {
+		BackfillJob
+		ResultsJSON string `db:"results"`
+	}
+	err := d.db.GetContext(d.ctx, &row, `SELECT * FROM backfill_jobs WHERE id = ?`, id)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询补写解析任务失败: %w", err)
+	}
+	job := row.BackfillJob
+	if err := json.Unmarshal([]byte(row.ResultsJSON), &job.Results); err != nil {
+		return nil, fmt.Errorf("解析补写解析结果失败: %w", err)
+	}
+	return &job, nil
+}
+
+// ListBackfillJobs 工作区最近的任务（不含各题目的结果）
+func (d *Database) ListBackfillJobs(workspaceID, limit int) ([]BackfillJob, error) {
+	jobs := []BackfillJob{}
+	err := d.db.SelectContext(d.ctx, &jobs, `
+		SELECT id, workspace_id, model, overwrite, status, total, succeeded, failed, canceled, created_at, finished_at
+		FROM backfill_jobs WHERE workspace_id = ? ORDER BY id DESC LIMIT ?`, workspaceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询补写解析任务失败: %w", err)
+	}
+	return jobs, nil
+}
+
+// MarkInterruptedBackfillJobs 启动时将上次未正常结束的任务标记为中断
+func (d *Database) MarkInterruptedBackfillJobs() (int64, error) {
+	result, err := d.db.ExecContext(d.ctx, `
+		UPDATE backfill_jobs SET status = ?, finished_at = ?
+		WHERE status = ?`, BulkInterrupted, time.Now().Format(timeLayout), BulkRunning)
+	if err != nil {
+		return 0, fmt.Errorf("标记中断的补写解析任务失败: %w", err)
+	}
+	return result.RowsAffected()
+}
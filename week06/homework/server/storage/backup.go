@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// 恢复时等待其他连接释放锁的最长时间
+const restoreBusyTimeout = 30 * time.Second
+
+// 校验备份时统计行数的表，questions 必须存在
+var integrityTables = []string{"questions", "answer_records", "workspaces", "bulk_jobs", "events", "attachments", "quiz_sessions", "question_templates"}
+
+// IntegrityReport 数据库完整性检查结果
+type IntegrityReport struct {
+	OK       bool           `json:"ok"`
+	Problems []string       `json:"problems,omitempty"` // integrity_check 报告的问题或缺少的表
+	Tables   map[string]int `json:"tables"`             // 关键表的行数，不存在的表不列出
+}
+
+// BackupTo 在线备份到 path：VACUUM INTO 在一个读事务中写出一致的快照，不阻塞其他读写。
+// 先写入临时文件并落盘，完成后再重命名，中途失败不会留下不完整的备份
+func (d *Database) BackupTo(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("备份文件已存在: %s", path)
+	}
+	tmp := path + ".tmp"
+	_ = os.Remove(tmp) // 上次中断留下的临时文件
+
+	if _, err := d.db.ExecContext(d.ctx, `VACUUM INTO ?`, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("备份数据库失败: %w", err)
+	}
+	if err := syncFile(tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("保存备份失败: %w", err)
+	}
+	return nil
+}
+
+// RestoreFrom 用SQLite在线备份接口将 path 的内容整体复制到当前数据库，
+// 复制期间其他连接的写入会等待，完成后补齐旧备份缺少的字段与表。调用前应先校验备份
+func (d *Database) RestoreFrom(path string) error {
+	conn, err := d.db.Conn(d.ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(dc interface{}) error {
+		if u, ok := dc.(interface{ Unwrap() driver.Conn }); ok {
+			dc = u.Unwrap()
+		}
+		restorer, ok := dc.(interface {
+			NewRestore(string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return fmt.Errorf("数据库驱动不支持在线恢复")
+		}
+		backup, err := restorer.NewRestore(readOnlyURI(path))
+		if err != nil {
+			return err
+		}
+		deadline := time.Now().Add(restoreBusyTimeout)
+		for {
+			more, err := backup.Step(-1)
+			if err != nil && isBusy(err) && time.Now().Before(deadline) {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			if err != nil {
+				_ = backup.Finish()
+				return err
+			}
+			if !more {
+				return backup.Finish()
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("恢复数据库失败: %w", err)
+	}
+	return migrate(d.db)
+}
+
+// Verify 检查当前数据库的完整性
+func (d *Database) Verify() (*IntegrityReport, error) {
+	return checkIntegrity(d.ctx, d.db)
+}
+
+// VerifyDatabase 以只读方式打开数据库文件并检查完整性，文件不是SQLite数据库时报告问题而不是返回错误
+func VerifyDatabase(ctx context.Context, path string) (*IntegrityReport, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("备份文件不可用: %w", err)
+	}
+	db, err := sqlx.Open("sqlite", readOnlyURI(path))
+	if err != nil {
+		return nil, fmt.Errorf("打开备份失败: %w", err)
+	}
+	defer db.Close()
+	return checkIntegrity(ctx, db)
+}
+
+func checkIntegrity(ctx context.Context, db *sqlx.DB) (*IntegrityReport, error) {
+	report := &IntegrityReport{Problems: []string{}, Tables: map[string]int{}}
+
+	// 1. 页面与索引的完整性
+	var results []string
+	if err := db.SelectContext(ctx, &results, `PRAGMA integrity_check`); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		report.Problems = append(report.Problems, err.Error())
+		return report, nil
+	}
+	for _, r := range results {
+		if r != "ok" {
+			report.Problems = append(report.Problems, r)
+		}
+	}
+
+	// 2. 关键表及行数
+	var existing []string
+	if err := db.SelectContext(ctx, &existing, `SELECT name FROM sqlite_master WHERE type = 'table'`); err != nil {
+		return nil, fmt.Errorf("读取表结构失败: %w", err)
+	}
+	has := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		has[name] = true
+	}
+	for _, table := range integrityTables {
+		if !has[table] {
+			continue
+		}
+		var n int
+		if err := db.GetContext(ctx, &n, `SELECT COUNT(*) FROM `+table); err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("读取 %s 失败: %v", table, err))
+			continue
+		}
+		report.Tables[table] = n
+	}
+	if !has["questions"] {
+		report.Problems = append(report.Problems, "缺少 questions 表，不是题库数据库")
+	}
+
+	report.OK = len(report.Problems) == 0
+	return report, nil
+}
+
+// readOnlyURI 以只读方式打开数据库文件的URI
+func readOnlyURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return "file:" + filepath.ToSlash(path) + "?mode=ro"
+}
+
+// isBusy 数据库被其他连接锁定，稍后重试即可
+func isBusy(err error) bool {
+	var se *sqlite.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+	code := se.Code() & 0xff // 扩展错误码的低8位为主错误码
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// syncFile 将文件内容落盘，避免断电后留下空的备份
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("备份落盘失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"Server/config"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const createBulkTableSQL = `
+CREATE TABLE IF NOT EXISTS bulk_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    filename TEXT NOT NULL,
+    model TEXT NOT NULL DEFAULT '',
+    concurrency INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    total_tasks INTEGER NOT NULL,
+    succeeded INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    canceled INTEGER NOT NULL DEFAULT 0,
+    questions INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    cost REAL NOT NULL DEFAULT 0,
+    results TEXT NOT NULL DEFAULT '[]',
+    created_at TEXT NOT NULL,
+    finished_at TEXT NOT NULL DEFAULT '',
+    workspace_id INTEGER NOT NULL DEFAULT 1
+);
+`
+
+// 旧版 bulk_jobs 表缺少的字段
+var bulkColumns = []struct {
+	name string
+	ddl  string
+}{
+	{"workspace_id", "workspace_id INTEGER NOT NULL DEFAULT 1"},
+}
+
+// 批量出题任务状态
+const (
+	BulkRunning     = "running"
+	BulkCompleted   = "completed"
+	BulkCanceled    = "canceled"    // 服务退出时仍未完成
+	BulkInterrupted = "interrupted" // 进程异常退出，重启后发现仍为 running
+)
+
+// 单个出题请求的结果状态
+const (
+	BulkTaskPending  = "pending"
+	BulkTaskSuccess  = "success"
+	BulkTaskFailed   = "failed"
+	BulkTaskCanceled = "canceled"
+)
+
+// BulkJob 一次按大纲批量出题
+type BulkJob struct {
+	ID               int              `json:"id" db:"id"`
+	WorkspaceID      int              `json:"workspaceId" db:"workspace_id"`
+	Filename         string           `json:"filename" db:"filename"`
+	Model            string           `json:"model" db:"model"` // 指定的AI服务，为空表示使用所有可用服务
+	Concurrency      int              `json:"concurrency" db:"concurrency"`
+	Status           string           `json:"status" db:"status"`
+	TotalTasks       int              `json:"totalTasks" db:"total_tasks"`
+	Succeeded        int              `json:"succeeded" db:"succeeded"`
+	Failed           int              `json:"failed" db:"failed"`
+	Canceled         int              `json:"canceled" db:"canceled"`
+	Questions        int              `json:"questions" db:"questions"` // 已保存的题目数
+	PromptTokens     int              `json:"promptTokens" db:"prompt_tokens"`
+	CompletionTokens int              `json:"completionTokens" db:"completion_tokens"`
+	Cost             float64          `json:"cost" db:"cost"`
+	CreatedAt        string           `json:"createdAt" db:"created_at"`
+	FinishedAt       string           `json:"finishedAt" db:"finished_at"`
+	Results          []BulkTaskResult `json:"results,omitempty" db:"-"`
+}
+
+// BulkTaskResult 单个出题请求的结果
+type BulkTaskResult struct {
+	Task             int      `json:"task"`
+	Topic            string   `json:"topic"`
+	Path             []string `json:"path"`
+	Type             int      `json:"type"`
+	Language         string   `json:"language"`
+	Requested        int      `json:"requested"` // 需要保存的题目数
+	Provider         string   `json:"provider,omitempty"`
+	Status           string   `json:"status"`
+	Error            string   `json:"error,omitempty"`
+	QuestionIDs      []int    `json:"questionIds,omitempty"`
+	Cache            string   `json:"cache,omitempty"`
+	PromptTokens     int      `json:"promptTokens"`
+	CompletionTokens int      `json:"completionTokens"`
+	Cost             float64  `json:"cost"` // 命中缓存或合并请求时为0
+	Duration         string   `json:"duration,omitempty"`
+}
+
+// CreateBulkJob 保存新任务并回填ID
+func (d *Database) CreateBulkJob(job *BulkJob) error {
+	results, _ := json.Marshal(job.Results)
+	job.CreatedAt = time.Now().Format(timeLayout)
+	err := d.db.QueryRowContext(d.ctx, `
+		INSERT INTO bulk_jobs (workspace_id, filename, model, concurrency, status, total_tasks, results, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		job.WorkspaceID, job.Filename, job.Model, job.Concurrency, job.Status, job.TotalTasks, string(results), job.CreatedAt,
+	).Scan(&job.ID)
+	if err != nil {
+		return fmt.Errorf("创建批量出题任务失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateBulkJob 保存任务进度与各请求的结果
+func (d *Database) UpdateBulkJob(job *BulkJob) error {
+	results, _ := json.Marshal(job.Results)
+	_, err := d.db.ExecContext(d.ctx, `
+		UPDATE bulk_jobs SET
+			status = ?, succeeded = ?, failed = ?, canceled = ?, questions = ?,
+			prompt_tokens = ?, completion_tokens = ?, cost = ?, results = ?, finished_at = ?
+		WHERE id = ?`,
+		job.Status, job.Succeeded, job.Failed, job.Canceled, job.Questions,
+		job.PromptTokens, job.CompletionTokens, job.Cost, string(results), job.FinishedAt,
+		job.ID)
+	if err != nil {
+		return fmt.Errorf("更新批量出题任务失败: %w", err)
+	}
+	return nil
+}
+
+// GetBulkJob 查询任务及各请求的结果，不存在时返回 nil
+func (d *Database) GetBulkJob(id int) (*BulkJob, error) {
+	var row struct {
+		BulkJob
+		ResultsJSON string `db:"results"`
+	}
+	err := d.db.GetContext(d.ctx, &row, `SELECT * FROM bulk_jobs WHERE id = ?`, id)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询批量出题任务失败: %w", err)
+	}
+	job := row.BulkJob
+	if err := json.Unmarshal([]byte(row.ResultsJSON), &job.Results); err != nil {
+		return nil, fmt.Errorf("解析批量出题结果失败: %w", err)
+	}
+	return &job, nil
+}
+
+// ListBulkJobs 工作区最近的任务（不含各请求的结果）
+func (d *Database) ListBulkJobs(workspaceID, limit int) ([]BulkJob, error) {
+	jobs := []BulkJob{}
+	err := d.db.SelectContext(d.ctx, &jobs, `
+		SELECT id, workspace_id, filename, model, concurrency, status, total_tasks, succeeded, failed, canceled,
+			questions, prompt_tokens, completion_tokens, cost, created_at, finished_at
+		FROM bulk_jobs WHERE workspace_id = ? ORDER BY id DESC LIMIT ?`, workspaceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询批量出题任务失败: %w", err)
+	}
+	return jobs, nil
+}
+
+// MarkInterruptedBulkJobs 启动时将上次未正常结束的任务标记为中断
+func (d *Database) MarkInterruptedBulkJobs() (int64, error) {
+	result, err := d.db.ExecContext(d.ctx, `
+		UPDATE bulk_jobs SET status = ?, finished_at = ?
+		WHERE status = ?`, BulkInterrupted, time.Now().Format(timeLayout), BulkRunning)
+	if err != nil {
+		return 0, fmt.Errorf("标记中断的批量出题任务失败: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SaveGeneratedQuestions 在一个事务中将AI生成的题目保存到工作区，返回新题目ID
+func (d *Database) SaveGeneratedQuestions(workspaceID int, req config.QuestionRequest, items []config.QuestionResponse, tags []string, model string) ([]int, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int, 0, len(items))
+	tagsJSON := MarshalTags(tags)
+	for _, q := range items {
+		answersJSON, _ := json.Marshal(q.Answers)
+		rightsJSON, _ := json.Marshal(q.Rights)
+		explanationSource := ""
+		if len(q.Explanations) > 0 || q.Hint != "" {
+			explanationSource = ExplanationFromAI
+		}
+
+		var id int
+		err := tx.QueryRowContext(d.ctx, `
+			INSERT INTO questions (type, title, language, answers, rights, tags, source, status, created_at,
+				explanations, hint, reference, explanation_source, explanation_model, explanation_at, locale, workspace_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, datetime('now', 'localtime'),
+				?, ?, ?, ?, ?, CASE WHEN ? = '' THEN '' ELSE datetime('now', 'localtime') END, ?, ?)
+			RETURNING id`,
+			req.Type, q.Title, req.Language, string(answersJSON), string(rightsJSON), tagsJSON,
+			config.SourceAI, config.StatusActive,
+			marshalStrings(q.Explanations), q.Hint, q.Reference, explanationSource, model, explanationSource,
+			config.LocaleZh, workspaceID,
+		).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("保存题目失败: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	event := NewEvent(workspaceID, EventQuestionCreated, ids, map[string]interface{}{
+		"source":   config.SourceAI,
+		"model":    model,
+		"type":     req.Type,
+		"language": req.Language,
+		"keyword":  req.Keyword,
+		"tags":     tags,
+	})
+	if err := d.CommitWithEvent(tx, event); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"Server/config"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const createCacheTableSQL = `
+CREATE TABLE IF NOT EXISTS ai_response_cache (
+    cache_key TEXT PRIMARY KEY,
+    model TEXT NOT NULL,
+    prompt_version INTEGER NOT NULL,
+    request TEXT NOT NULL,
+    response TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ai_response_cache_expires ON ai_response_cache(expires_at);
+`
+
+// CachedResponse 缓存的AI出题结果
+type CachedResponse struct {
+	Key           string
+	Model         string
+	PromptVersion int
+	Request       string // 归一化后的请求，便于排查
+	Response      *config.QuestionResponses
+	ExpiresAt     time.Time
+}
+
+// GetCachedResponse 读取未过期的缓存，不存在或已过期时返回 nil
+func (d *Database) GetCachedResponse(key string, now time.Time) (*config.QuestionResponses, error) {
+	var raw string
+	err := d.db.GetContext(d.ctx, &raw, `
+		SELECT response FROM ai_response_cache
+		WHERE cache_key = ? AND expires_at > ?`, key, now.Format(timeLayout))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取AI缓存失败: %w", err)
+	}
+
+	var resp config.QuestionResponses
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		return nil, fmt.Errorf("解析AI缓存失败: %w", err)
+	}
+	return &resp, nil
+}
+
+// SaveCachedResponse 写入缓存，同一键已存在时覆盖
+func (d *Database) SaveCachedResponse(entry CachedResponse, now time.Time) error {
+	data, err := json.Marshal(entry.Response)
+	if err != nil {
+		return fmt.Errorf("序列化AI缓存失败: %w", err)
+	}
+	_, err = d.db.ExecContext(d.ctx, `
+		INSERT INTO ai_response_cache (cache_key, model, prompt_version, request, response, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(cache_key) DO UPDATE SET
+			response = excluded.response,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at`,
+		entry.Key, entry.Model, entry.PromptVersion, entry.Request, string(data),
+		now.Format(timeLayout), entry.ExpiresAt.Format(timeLayout))
+	if err != nil {
+		return fmt.Errorf("写入AI缓存失败: %w", err)
+	}
+	return nil
+}
+
+// PurgeCachedResponses 删除已过期的缓存，返回删除条数
+func (d *Database) PurgeCachedResponses(now time.Time) (int64, error) {
+	result, err := d.db.ExecContext(d.ctx,
+		`DELETE FROM ai_response_cache WHERE expires_at <= ?`, now.Format(timeLayout))
+	if err != nil {
+		return 0, fmt.Errorf("清理AI缓存失败: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -1,14 +1,19 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite"
 
 	"Server/config"
+	"Server/telemetry"
 )
 
 const createTableSQL = `
@@ -18,28 +23,162 @@ CREATE TABLE IF NOT EXISTS questions (
     type INTEGER NOT NULL,
 	language TEXT NOT NULL,
     answers TEXT COMMENT NOT NULL,
-	rights TEXT COMMENT NOT NULL
+	rights TEXT COMMENT NOT NULL,
+	tags TEXT NOT NULL DEFAULT '[]',
+	source TEXT NOT NULL DEFAULT 'hand',
+	status TEXT NOT NULL DEFAULT 'active',
+	status_at TEXT NOT NULL DEFAULT '',
+	suspended INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT,
+	explanations TEXT NOT NULL DEFAULT '[]',
+	hint TEXT NOT NULL DEFAULT '',
+	reference TEXT NOT NULL DEFAULT '',
+	explanation_source TEXT NOT NULL DEFAULT '',
+	explanation_model TEXT NOT NULL DEFAULT '',
+	explanation_at TEXT NOT NULL DEFAULT '',
+	locale TEXT NOT NULL DEFAULT 'zh-CN',
+	group_id INTEGER,
+	workspace_id INTEGER NOT NULL DEFAULT 1
 );
+
+CREATE TABLE IF NOT EXISTS answer_records (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    question_id INTEGER NOT NULL,
+    student_id TEXT NOT NULL,
+    selected TEXT NOT NULL,
+    correct INTEGER NOT NULL,
+    answered_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_answer_records_question ON answer_records(question_id);
+CREATE INDEX IF NOT EXISTS idx_answer_records_student ON answer_records(student_id);
+CREATE INDEX IF NOT EXISTS idx_questions_group ON questions(group_id);
 `
 
+// 旧版数据库缺少的字段，启动时通过 ALTER TABLE 补齐
+var questionColumns = []struct {
+	name string
+	ddl  string
+}{
+	{"tags", "tags TEXT NOT NULL DEFAULT '[]'"},
+	{"source", "source TEXT NOT NULL DEFAULT 'hand'"},
+	{"status", "status TEXT NOT NULL DEFAULT 'active'"},
+	{"status_at", "status_at TEXT NOT NULL DEFAULT ''"},
+	{"suspended", "suspended INTEGER NOT NULL DEFAULT 0"},
+	{"created_at", "created_at TEXT"},
+	{"explanations", "explanations TEXT NOT NULL DEFAULT '[]'"},
+	{"hint", "hint TEXT NOT NULL DEFAULT ''"},
+	{"reference", "reference TEXT NOT NULL DEFAULT ''"},
+	{"explanation_source", "explanation_source TEXT NOT NULL DEFAULT ''"},
+	{"explanation_model", "explanation_model TEXT NOT NULL DEFAULT ''"},
+	{"explanation_at", "explanation_at TEXT NOT NULL DEFAULT ''"},
+	{"locale", "locale TEXT NOT NULL DEFAULT 'zh-CN'"},
+	{"group_id", "group_id INTEGER"},
+	{"workspace_id", "workspace_id INTEGER NOT NULL DEFAULT 1"},
+}
+
 // Database 包装器结构体
 type Database struct {
-	db *sqlx.DB
+	db  *sqlx.DB
+	ctx context.Context // 请求上下文，用于链路追踪与取消
+
+	onEvent func() // 写入事件后唤醒分发，见 OnEvent
 }
 
 // InitDB 返回自定义 Database 类型
 func InitDB(dsn string) (*Database, error) {
-	db, err := sqlx.Connect("sqlite", dsn)
+	// 使用带监控的驱动，记录每条语句的耗时
+	driverName, err := telemetry.InstrumentDriver("sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("数据库驱动初始化失败: %w", err)
+	}
+	sqlx.BindDriver(driverName, sqlx.QUESTION)
+
+	// 并发写入（如批量出题的多个worker）时等待锁释放，而不是立即返回 SQLITE_BUSY
+	if !strings.Contains(dsn, "busy_timeout") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_pragma=busy_timeout(5000)"
+	}
+
+	db, err := sqlx.Connect(driverName, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("数据库连接失败: %w", err)
 	}
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
+	return &Database{db: db, ctx: context.Background()}, nil
+}
 
-	// 执行建表语句
-	if _, err := db.Exec(createTableSQL); err != nil {
-		return nil, fmt.Errorf("初始化表失败: %w", err)
+// migrate 先补齐旧表字段，再执行建表语句；启动时与从备份恢复后执行
+func migrate(db *sqlx.DB) error {
+	for _, m := range []struct {
+		table   string
+		columns []struct {
+			name string
+			ddl  string
+		}
+	}{
+		{"questions", questionColumns},
+		{"bulk_jobs", bulkColumns},
+		{"events", eventColumns},
+		{"webhooks", webhookColumns},
+		{"question_flags", feedbackColumns},
+	} {
+		if err := migrateColumns(db, m.table, m.columns); err != nil {
+			return err
+		}
+	}
+	for _, ddl := range []string{createTableSQL, createPracticeTableSQL, createCacheTableSQL, createBulkTableSQL, createEventTableSQL, createWorkspaceTableSQL, createAttachmentTableSQL, createQuizTableSQL, createTemplateTableSQL, createLTITableSQL, createSubmissionTableSQL, createEmbeddingTableSQL, createRetentionTableSQL, createRevisionTableSQL, createFeedbackTableSQL, createBackfillTableSQL} {
+		if _, err := db.Exec(ddl); err != nil {
+			return fmt.Errorf("初始化表失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// WithContext 返回使用指定上下文执行语句的副本（共享同一连接池）
+func (d *Database) WithContext(ctx context.Context) *Database {
+	return &Database{db: d.db, ctx: ctx, onEvent: d.onEvent}
+}
+
+// migrateColumns 为已存在的表补齐缺失字段，表不存在时直接跳过
+func migrateColumns(db *sqlx.DB, table string, columns []struct {
+	name string
+	ddl  string
+}) error {
+	var existing []struct {
+		Name string `db:"name"`
+	}
+	if err := db.Select(&existing, "SELECT name FROM pragma_table_info(?)", table); err != nil {
+		return fmt.Errorf("读取表结构失败: %w", err)
+	}
+	if len(existing) == 0 {
+		return nil
 	}
 
-	return &Database{db: db}, nil
+	has := make(map[string]bool, len(existing))
+	for _, col := range existing {
+		has[col.Name] = true
+	}
+	for _, col := range columns {
+		if has[col.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, col.ddl)); err != nil {
+			return fmt.Errorf("补齐字段 %s.%s 失败: %w", table, col.name, err)
+		}
+	}
+	return nil
+}
+
+// 判断是否为查询无结果
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
 }
 
 // 补充数据库操作方法
@@ -49,53 +188,81 @@ func (d *Database) Close() error {
 
 // 在 Database 结构体中添加事务方法
 func (d *Database) Beginx() (*sqlx.Tx, error) {
-	return d.db.Beginx()
+	return d.db.BeginTxx(d.ctx, nil)
 }
 
 // Select 查询多条记录
 func (d *Database) Select(dest interface{}, query string, args ...interface{}) error {
-	return d.db.Select(dest, query, args...)
+	return d.db.SelectContext(d.ctx, dest, query, args...)
 }
 
 // Get 查询单条记录
 func (d *Database) Get(dest interface{}, query string, args ...interface{}) error {
 
-	return d.db.Get(dest, query, args...)
+	return d.db.GetContext(d.ctx, dest, query, args...)
 
 }
 
 // Exec 删除多条数据
 func (d *Database) Exec(query string, args ...interface{}) error {
-	_, err := d.db.Exec(query, args...)
+	_, err := d.db.ExecContext(d.ctx, query, args...)
 	return err
 }
 
-// 添加数据库操作
-func (d *Database) CreateQuestion(q *config.QuestionRequest1) (int, error) {
+// 添加数据库操作（题目属于指定工作区）
+func (d *Database) CreateQuestion(workspaceID int, q *config.QuestionRequest1) (int, error) {
 	const query = `
         INSERT INTO questions 
-        (title,type ,language, answers, rights)
-        VALUES ($1, $2, $3, $4, $5)
+        (title,type ,language, answers, rights, tags, source, status, created_at,
+         explanations, hint, reference, explanation_source, explanation_at, locale, workspace_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, datetime('now', 'localtime'),
+         $9, $10, $11, $12, CASE WHEN $12 = '' THEN '' ELSE datetime('now', 'localtime') END, $13, $14)
         RETURNING id`
 
 	answersJSON, _ := json.Marshal(q.Answers)
 	rightsJSON, _ := json.Marshal(q.Rights)
+	tagsJSON := MarshalTags(q.Tags)
+	explanationsJSON := marshalStrings(q.Explanations)
+
+	// 手动录入时填写了解析，记录来源为手动
+	explanationSource := ""
+	if len(q.Explanations) > 0 || q.Hint != "" {
+		explanationSource = ExplanationFromHand
+	}
+
+	// 题目与 question.created 事件在同一事务中写入
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
 	var id int
-	err := d.db.QueryRow(
+	err = tx.QueryRowContext(d.ctx,
 		query,
 		q.Title,
 		q.Type,
 		q.Language,
 		string(answersJSON),
 		string(rightsJSON),
+		tagsJSON,
+		config.SourceHand,
+		config.StatusActive,
+		explanationsJSON,
+		q.Hint,
+		q.Reference,
+		explanationSource,
+		defaultLocale(q.Locale),
+		workspaceID,
 	).Scan(&id)
-
-	return id, err
+	if err != nil {
+		return 0, err
+	}
+	return id, d.CommitWithEvent(tx, NewEvent(workspaceID, EventQuestionCreated, []int{id}, questionEventData(q, config.SourceHand)))
 }
 
-// UpdateQuestion 更新题目
-func (db *Database) UpdateQuestion(req *config.QuestionRequest1) (int64, error) {
+// UpdateQuestion 更新题目（只能更新本工作区的题目，共享进来的题目只读），修改前的内容保存为修订记录
+func (db *Database) UpdateQuestion(workspaceID int, req *config.QuestionRequest1, editor string) (int64, error) {
 	// 1. 数据格式转换（匹配图片中的选项结构）
 	optionsJSON, err := json.Marshal(req.Answers)
 	if err != nil {
@@ -109,21 +276,42 @@ func (db *Database) UpdateQuestion(req *config.QuestionRequest1) (int64, error)
 		return 0, fmt.Errorf("答案序列化失败: %v", err)
 	}
 
-	// 3. 执行SQL更新（包含图片中的所有字段）
-	result, err := db.db.Exec(`
+	// 3. 执行SQL更新（包含图片中的所有字段），与 question.updated 事件在同一事务中提交
+	tx, err := db.db.BeginTxx(db.ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("开启事务失败: %v", err)
+	}
+	defer tx.Rollback()
+	if err := saveRevision(db, tx, workspaceID, req.Id, editor); err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(db.ctx, `
         UPDATE questions SET
             title = ?,
             type = ?,
             language = ?,
             answers = ?,
-            rights = ?
-        WHERE id = ?`,
+            rights = ?,
+            tags = COALESCE(?, tags),
+            explanations = COALESCE(?, explanations),
+            hint = CASE WHEN ? THEN ? ELSE hint END,
+            reference = CASE WHEN ? THEN ? ELSE reference END,
+            locale = COALESCE(NULLIF(?, ''), locale)
+        WHERE id = ? AND workspace_id = ?`,
 		req.Title,
 		req.Type,
 		req.Language,
 		string(optionsJSON),
 		string(answersJSON),
+		nullableTags(req.Tags),
+		nullableStrings(req.Explanations),
+		req.HintSet || req.Hint != "",
+		req.Hint,
+		req.ReferenceSet || req.Reference != "",
+		req.Reference,
+		req.Locale,
 		req.Id,
+		workspaceID,
 	)
 
 	if err != nil {
@@ -135,5 +323,74 @@ func (db *Database) UpdateQuestion(req *config.QuestionRequest1) (int64, error)
 	if err != nil {
 		return 0, fmt.Errorf("获取影响行数失败: %v", err)
 	}
+
+	// 5. 手动修改了解析时更新解析来源
+	if req.Explanations != nil && rowsAffected > 0 {
+		if _, err := tx.ExecContext(db.ctx, `
+			UPDATE questions SET
+				explanation_source = ?,
+				explanation_model = '',
+				explanation_at = datetime('now', 'localtime')
+			WHERE id = ?`, ExplanationFromHand, req.Id); err != nil {
+			return 0, fmt.Errorf("更新解析来源失败: %v", err)
+		}
+	}
+
+	// 6. 题目不存在时不记录事件
+	if rowsAffected == 0 {
+		return 0, nil
+	}
+	if err := db.CommitWithEvent(tx, NewEvent(workspaceID, EventQuestionUpdated, []int{req.Id}, questionEventData(req, ""))); err != nil {
+		return 0, err
+	}
 	return rowsAffected, nil
 }
+
+// MarshalTags 将标签序列化为JSON数组，去除空白与重复项
+func MarshalTags(tags []string) string {
+	cleaned := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		cleaned = append(cleaned, t)
+	}
+	data, _ := json.Marshal(cleaned)
+	return string(data)
+}
+
+// 未指定语言时按中文处理
+func defaultLocale(locale string) string {
+	if locale == "" {
+		return config.LocaleZh
+	}
+	return locale
+}
+
+// marshalStrings 序列化字符串数组，nil按空数组处理
+func marshalStrings(values []string) string {
+	if values == nil {
+		return "[]"
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+// 更新时未传对应字段则保留原值
+func nullableStrings(values []string) interface{} {
+	if values == nil {
+		return nil
+	}
+	return marshalStrings(values)
+}
+
+// 更新时未传标签则保留原值
+func nullableTags(tags []string) interface{} {
+	if tags == nil {
+		return nil
+	}
+	return MarshalTags(tags)
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const createEmbeddingTableSQL = `
+CREATE TABLE IF NOT EXISTS question_embeddings (
+    question_id INTEGER PRIMARY KEY,
+    model TEXT NOT NULL,
+    content_hash TEXT NOT NULL,
+    vector BLOB NOT NULL,
+    updated_at TEXT NOT NULL
+);
+`
+
+// QuestionEmbedding 题目的向量，Model 为计算向量的模型标识，ContentHash 为参与计算的题目内容摘要，
+// 两者与当前一致时无需重新计算
+type QuestionEmbedding struct {
+	QuestionID  int
+	Model       string
+	ContentHash string
+	Vector      []float32
+}
+
+// EmbeddingStates 已索引题目的模型与内容摘要（不含向量）
+func (d *Database) EmbeddingStates() (map[int]QuestionEmbedding, error) {
+	var rows []struct {
+		QuestionID  int    `db:"question_id"`
+		Model       string `db:"model"`
+		ContentHash string `db:"content_hash"`
+	}
+	if err := d.db.SelectContext(d.ctx, &rows, `SELECT question_id, model, content_hash FROM question_embeddings`); err != nil {
+		return nil, fmt.Errorf("查询向量索引失败: %w", err)
+	}
+	states := make(map[int]QuestionEmbedding, len(rows))
+	for _, r := range rows {
+		states[r.QuestionID] = QuestionEmbedding{QuestionID: r.QuestionID, Model: r.Model, ContentHash: r.ContentHash}
+	}
+	return states, nil
+}
+
+// SaveEmbeddings 写入或覆盖题目的向量
+func (d *Database) SaveEmbeddings(list []QuestionEmbedding) error {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format(timeLayout)
+	for _, e := range list {
+		_, err := tx.ExecContext(d.ctx, `
+			INSERT INTO question_embeddings (question_id, model, content_hash, vector, updated_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(question_id) DO UPDATE SET
+				model = excluded.model, content_hash = excluded.content_hash,
+				vector = excluded.vector, updated_at = excluded.updated_at`,
+			e.QuestionID, e.Model, e.ContentHash, encodeVector(e.Vector), now)
+		if err != nil {
+			return fmt.Errorf("保存向量失败: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteEmbeddings 删除已不存在的题目的向量
+func (d *Database) DeleteEmbeddings(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(`DELETE FROM question_embeddings WHERE question_id IN (?)`, ids)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.ExecContext(d.ctx, query, args...)
+	return err
+}
+
+// LoadEmbeddings 读取指定模型计算的全部向量
+func (d *Database) LoadEmbeddings(model string) ([]QuestionEmbedding, error) {
+	var rows []struct {
+		QuestionID  int    `db:"question_id"`
+		ContentHash string `db:"content_hash"`
+		Vector      []byte `db:"vector"`
+	}
+	err := d.db.SelectContext(d.ctx, &rows,
+		`SELECT question_id, content_hash, vector FROM question_embeddings WHERE model = ?`, model)
+	if err != nil {
+		return nil, fmt.Errorf("读取向量失败: %w", err)
+	}
+	list := make([]QuestionEmbedding, 0, len(rows))
+	for _, r := range rows {
+		list = append(list, QuestionEmbedding{QuestionID: r.QuestionID, Model: model, ContentHash: r.ContentHash, Vector: decodeVector(r.Vector)})
+	}
+	return list, nil
+}
+
+// VisibleQuestionIDs 工作区可见的全部题目ID（含共享进来的题目）
+func (d *Database) VisibleQuestionIDs(workspaceID int) (map[int]bool, error) {
+	var ids []int
+	if err := d.db.SelectContext(d.ctx, &ids, `SELECT id FROM questions WHERE `+VisibleInWorkspace, workspaceID, workspaceID); err != nil {
+		return nil, err
+	}
+	visible := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		visible[id] = true
+	}
+	return visible, nil
+}
+
+// 向量按 float32 小端序保存
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
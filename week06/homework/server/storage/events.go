@@ -0,0 +1,533 @@
+package storage
+
+import (
+	"Server/config"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const createEventTableSQL = `
+CREATE TABLE IF NOT EXISTS events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    question_ids TEXT NOT NULL DEFAULT '[]',
+    data TEXT NOT NULL DEFAULT '{}',
+    created_at TEXT NOT NULL,
+    dispatched INTEGER NOT NULL DEFAULT 0,
+    workspace_id INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL DEFAULT '[]',
+    description TEXT NOT NULL DEFAULT '',
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL,
+    workspace_id INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL,
+    event_id INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TEXT NOT NULL,
+    last_status_code INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    delivered_at TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    delivery_id INTEGER NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    response TEXT NOT NULL DEFAULT '',
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    attempted_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_dispatched ON events(dispatched, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_attempts_delivery ON webhook_attempts(delivery_id);
+`
+
+// 旧版 events/webhooks 表缺少的字段
+var (
+	eventColumns = []struct {
+		name string
+		ddl  string
+	}{
+		{"workspace_id", "workspace_id INTEGER NOT NULL DEFAULT 1"},
+	}
+	webhookColumns = eventColumns
+)
+
+// 事件类型
+const (
+	EventQuestionCreated         = "question.created"          // 手动录入或批量出题保存
+	EventQuestionUpdated         = "question.updated"          // 编辑题目
+	EventQuestionDeleted         = "question.deleted"          // 批量删除
+	EventQuestionImported        = "question.imported"         // 批量插入（保存AI生成结果或导入）
+	EventQuestionStatusChanged   = "question.status_changed"   // 归档、驳回等状态变更
+	EventQuestionFlagged         = "question.flagged"          // 学生反馈题目有误
+	EventQuestionFeedbackHandled = "question.feedback_handled" // 老师处理反馈
+	EventAIGenerated             = "ai.generated"              // 一次AI出题调用结束（成功或失败）
+)
+
+// EventTypes 所有事件类型，用于校验Webhook订阅
+var EventTypes = []string{EventQuestionCreated, EventQuestionUpdated, EventQuestionDeleted, EventQuestionImported, EventQuestionStatusChanged, EventQuestionFlagged, EventQuestionFeedbackHandled, EventAIGenerated}
+
+// Webhook投递状态
+const (
+	DeliveryPending = "pending" // 等待首次投递或重试
+	DeliverySuccess = "success"
+	DeliveryFailed  = "failed" // 重试次数用尽
+)
+
+// Event 题库变更事件，与变更在同一事务中写入 events 表（outbox），由后台分发
+type Event struct {
+	ID          int64           `json:"id" db:"id"`
+	Type        string          `json:"type" db:"type"`
+	WorkspaceID int             `json:"workspace_id" db:"workspace_id"`
+	QuestionIDs []int           `json:"question_ids" db:"-"`
+	Data        json.RawMessage `json:"data" db:"-"`
+	CreatedAt   string          `json:"created_at" db:"created_at"`
+}
+
+// NewEvent 创建工作区的事件，data 序列化为JSON对象
+func NewEvent(workspaceID int, typ string, questionIDs []int, data map[string]interface{}) Event {
+	if questionIDs == nil {
+		questionIDs = []int{}
+	}
+	raw, _ := json.Marshal(data)
+	if data == nil {
+		raw = []byte("{}")
+	}
+	return Event{Type: typ, WorkspaceID: workspaceID, QuestionIDs: questionIDs, Data: raw}
+}
+
+// questionEventData 题目事件的摘要；更新时未传的标签、语言不输出，完整内容可按ID查询
+func questionEventData(q *config.QuestionRequest1, source string) map[string]interface{} {
+	data := map[string]interface{}{
+		"type":     q.Type,
+		"title":    q.Title,
+		"language": q.Language,
+	}
+	if q.Locale != "" {
+		data["locale"] = q.Locale
+	}
+	if q.Tags != nil {
+		data["tags"] = q.Tags
+	}
+	if source != "" {
+		data["source"] = source
+	}
+	return data
+}
+
+// Webhook 订阅题库事件的外部地址
+type Webhook struct {
+	ID          int      `json:"id" db:"id"`
+	WorkspaceID int      `json:"workspace_id" db:"workspace_id"` // 只接收该工作区的事件
+	URL         string   `json:"url" db:"url"`
+	Secret      string   `json:"secret,omitempty" db:"secret"`
+	Events      []string `json:"events" db:"-"` // 订阅的事件类型，支持 question.* 通配，为空表示全部
+	Description string   `json:"description" db:"description"`
+	Active      bool     `json:"active" db:"active"`
+	CreatedAt   string   `json:"created_at" db:"created_at"`
+}
+
+// WebhookDelivery 一个事件向一个Webhook的投递记录
+type WebhookDelivery struct {
+	ID             int64            `json:"id" db:"id"`
+	WebhookID      int              `json:"webhook_id" db:"webhook_id"`
+	EventID        int64            `json:"event_id" db:"event_id"`
+	EventType      string           `json:"event_type" db:"event_type"`
+	Status         string           `json:"status" db:"status"`
+	Attempts       int              `json:"attempts" db:"attempts"`
+	NextAttemptAt  string           `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatusCode int              `json:"last_status_code" db:"last_status_code"`
+	LastError      string           `json:"last_error" db:"last_error"`
+	CreatedAt      string           `json:"created_at" db:"created_at"`
+	DeliveredAt    string           `json:"delivered_at" db:"delivered_at"`
+	AttemptLog     []WebhookAttempt `json:"attempt_log,omitempty" db:"-"`
+}
+
+// WebhookAttempt 一次投递尝试
+type WebhookAttempt struct {
+	Attempt     int    `json:"attempt" db:"attempt"`
+	StatusCode  int    `json:"status_code" db:"status_code"` // 0 表示未收到响应
+	Error       string `json:"error" db:"error"`
+	Response    string `json:"response" db:"response"` // 响应体前512字节
+	DurationMs  int64  `json:"duration_ms" db:"duration_ms"`
+	AttemptedAt string `json:"attempted_at" db:"attempted_at"`
+}
+
+// PendingDelivery 到期待投递的记录及其Webhook与事件
+type PendingDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+	Event  Event
+}
+
+// eventRow events 表中的一行
+type eventRow struct {
+	Event
+	QuestionIDsJSON string `db:"question_ids"`
+	DataJSON        string `db:"data"`
+}
+
+func (r eventRow) event() Event {
+	ev := r.Event
+	_ = json.Unmarshal([]byte(r.QuestionIDsJSON), &ev.QuestionIDs)
+	ev.Data = json.RawMessage(r.DataJSON)
+	return ev
+}
+
+// OnEvent 设置事件写入后的回调，用于唤醒分发；须在启动时、处理请求前设置
+func (d *Database) OnEvent(fn func()) {
+	d.onEvent = fn
+}
+
+// CommitWithEvent 在事务中写入事件后提交，提交成功后唤醒分发
+func (d *Database) CommitWithEvent(tx *sqlx.Tx, ev Event) error {
+	ids, _ := json.Marshal(ev.QuestionIDs)
+	if _, err := tx.ExecContext(d.ctx, `
+		INSERT INTO events (type, workspace_id, question_ids, data, created_at) VALUES (?, ?, ?, ?, ?)`,
+		ev.Type, ev.WorkspaceID, string(ids), string(ev.Data), time.Now().Format(timeLayout)); err != nil {
+		return fmt.Errorf("记录事件失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	if d.onEvent != nil {
+		d.onEvent()
+	}
+	return nil
+}
+
+// RecordEvent 单独记录一个与数据变更无关的事件（如AI出题调用）
+func (d *Database) RecordEvent(ev Event) error {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return d.CommitWithEvent(tx, ev)
+}
+
+// UndispatchedEvents 尚未分发的事件，按写入顺序
+func (d *Database) UndispatchedEvents(limit int) ([]Event, error) {
+	return d.selectEvents(`SELECT id, type, workspace_id, question_ids, data, created_at FROM events WHERE dispatched = 0 ORDER BY id LIMIT ?`, limit)
+}
+
+// EventsAfter 已分发的、ID大于 after 的事件，用于SSE断线重连后补发
+func (d *Database) EventsAfter(after int64, limit int) ([]Event, error) {
+	return d.selectEvents(`SELECT id, type, workspace_id, question_ids, data, created_at FROM events WHERE dispatched = 1 AND id > ? ORDER BY id LIMIT ?`, after, limit)
+}
+
+func (d *Database) selectEvents(query string, args ...interface{}) ([]Event, error) {
+	var rows []eventRow
+	if err := d.db.SelectContext(d.ctx, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("查询事件失败: %w", err)
+	}
+	events := make([]Event, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, row.event())
+	}
+	return events, nil
+}
+
+// DispatchEvent 为订阅了该事件的Webhook创建投递记录，并将事件标记为已分发
+func (d *Database) DispatchEvent(eventID int64, webhookIDs []int, now time.Time) error {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	at := now.Format(timeLayout)
+	for _, id := range webhookIDs {
+		if _, err := tx.ExecContext(d.ctx, `
+			INSERT INTO webhook_deliveries (webhook_id, event_id, status, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, ?)`, id, eventID, DeliveryPending, at, at); err != nil {
+			return fmt.Errorf("创建投递记录失败: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(d.ctx, `UPDATE events SET dispatched = 1 WHERE id = ?`, eventID); err != nil {
+		return fmt.Errorf("更新事件状态失败: %w", err)
+	}
+	return tx.Commit()
+}
+
+// PruneEvents 删除早于 before 的已分发事件及其已结束的投递记录，返回删除的事件数
+func (d *Database) PruneEvents(before time.Time) (int64, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	cutoff := before.Format(timeLayout)
+	// 仍在重试中的投递保留其事件
+	const expired = `SELECT id FROM events WHERE dispatched = 1 AND created_at < ?
+		AND id NOT IN (SELECT event_id FROM webhook_deliveries WHERE status = '` + DeliveryPending + `')`
+	for _, query := range []string{
+		`DELETE FROM webhook_attempts WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE event_id IN (` + expired + `))`,
+		`DELETE FROM webhook_deliveries WHERE event_id IN (` + expired + `)`,
+	} {
+		if _, err := tx.ExecContext(d.ctx, query, cutoff); err != nil {
+			return 0, fmt.Errorf("清理投递记录失败: %w", err)
+		}
+	}
+	result, err := tx.ExecContext(d.ctx, `DELETE FROM events WHERE id IN (`+expired+`)`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("清理事件失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// webhookRow webhooks 表中的一行
+type webhookRow struct {
+	Webhook
+	EventsJSON string `db:"events"`
+}
+
+func (r webhookRow) webhook() Webhook {
+	w := r.Webhook
+	_ = json.Unmarshal([]byte(r.EventsJSON), &w.Events)
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	return w
+}
+
+// CreateWebhook 保存Webhook并回填ID
+func (d *Database) CreateWebhook(w *Webhook) error {
+	events := marshalStrings(w.Events)
+	w.CreatedAt = time.Now().Format(timeLayout)
+	err := d.db.QueryRowContext(d.ctx, `
+		INSERT INTO webhooks (workspace_id, url, secret, events, description, active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`, w.WorkspaceID, w.URL, w.Secret, events, w.Description, w.Active, w.CreatedAt).Scan(&w.ID)
+	if err != nil {
+		return fmt.Errorf("创建Webhook失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateWebhook 更新地址、订阅、说明、启用状态与密钥
+func (d *Database) UpdateWebhook(w *Webhook) error {
+	_, err := d.db.ExecContext(d.ctx, `
+		UPDATE webhooks SET url = ?, secret = ?, events = ?, description = ?, active = ?
+		WHERE id = ?`, w.URL, w.Secret, marshalStrings(w.Events), w.Description, w.Active, w.ID)
+	if err != nil {
+		return fmt.Errorf("更新Webhook失败: %w", err)
+	}
+	return nil
+}
+
+// GetWebhook 查询Webhook（含密钥），不存在时返回 nil
+func (d *Database) GetWebhook(id int) (*Webhook, error) {
+	var row webhookRow
+	err := d.db.GetContext(d.ctx, &row, `SELECT * FROM webhooks WHERE id = ?`, id)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询Webhook失败: %w", err)
+	}
+	w := row.webhook()
+	return &w, nil
+}
+
+// ListWebhooks 工作区的Webhook（含密钥，返回给客户端前需隐去），workspaceID 为0时返回所有工作区的，
+// activeOnly 时只返回启用的
+func (d *Database) ListWebhooks(workspaceID int, activeOnly bool) ([]Webhook, error) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	if workspaceID != 0 {
+		conditions = append(conditions, "workspace_id = ?")
+		args = append(args, workspaceID)
+	}
+	if activeOnly {
+		conditions = append(conditions, "active = 1")
+	}
+	var rows []webhookRow
+	if err := d.db.SelectContext(d.ctx, &rows, `SELECT * FROM webhooks WHERE `+strings.Join(conditions, " AND ")+` ORDER BY id`, args...); err != nil {
+		return nil, fmt.Errorf("查询Webhook失败: %w", err)
+	}
+	hooks := make([]Webhook, 0, len(rows))
+	for _, row := range rows {
+		hooks = append(hooks, row.webhook())
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook 删除Webhook及其投递记录，返回是否存在
+func (d *Database) DeleteWebhook(id int) (bool, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(d.ctx, `
+		DELETE FROM webhook_attempts WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE webhook_id = ?)`, id); err != nil {
+		return false, fmt.Errorf("删除投递记录失败: %w", err)
+	}
+	if _, err := tx.ExecContext(d.ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+		return false, fmt.Errorf("删除投递记录失败: %w", err)
+	}
+	result, err := tx.ExecContext(d.ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("删除Webhook失败: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, tx.Commit()
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.event_id, e.type AS event_type, d.status, d.attempts,
+	d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at`
+
+// DueDeliveries 到期待投递的记录（只含启用的Webhook），按到期时间排序
+func (d *Database) DueDeliveries(now time.Time, limit int) ([]PendingDelivery, error) {
+	var rows []struct {
+		WebhookDelivery
+		URL             string `db:"url"`
+		Secret          string `db:"secret"`
+		WorkspaceID     int    `db:"workspace_id"`
+		QuestionIDsJSON string `db:"question_ids"`
+		DataJSON        string `db:"data"`
+		EventCreatedAt  string `db:"event_created_at"`
+	}
+	err := d.db.SelectContext(d.ctx, &rows, `
+		SELECT `+deliveryColumns+`, w.url, w.secret, e.workspace_id, e.question_ids, e.data, e.created_at AS event_created_at
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		JOIN events e ON e.id = d.event_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? AND w.active = 1
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?`, DeliveryPending, now.Format(timeLayout), limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询待投递记录失败: %w", err)
+	}
+
+	pending := make([]PendingDelivery, 0, len(rows))
+	for _, row := range rows {
+		ev := eventRow{
+			Event:           Event{ID: row.EventID, Type: row.EventType, WorkspaceID: row.WorkspaceID, CreatedAt: row.EventCreatedAt},
+			QuestionIDsJSON: row.QuestionIDsJSON,
+			DataJSON:        row.DataJSON,
+		}
+		pending = append(pending, PendingDelivery{
+			WebhookDelivery: row.WebhookDelivery,
+			URL:             row.URL,
+			Secret:          row.Secret,
+			Event:           ev.event(),
+		})
+	}
+	return pending, nil
+}
+
+// RecordDeliveryAttempt 记录一次投递尝试并更新投递状态，status 为 pending 时在 next 重试
+func (d *Database) RecordDeliveryAttempt(deliveryID int64, attempt WebhookAttempt, status string, next time.Time) error {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(d.ctx, `
+		INSERT INTO webhook_attempts (delivery_id, attempt, status_code, error, response, duration_ms, attempted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		deliveryID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.Response, attempt.DurationMs, attempt.AttemptedAt); err != nil {
+		return fmt.Errorf("记录投递尝试失败: %w", err)
+	}
+	deliveredAt := ""
+	if status == DeliverySuccess {
+		deliveredAt = attempt.AttemptedAt
+	}
+	if _, err := tx.ExecContext(d.ctx, `
+		UPDATE webhook_deliveries SET
+			status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?, delivered_at = ?
+		WHERE id = ?`,
+		status, attempt.Attempt, next.Format(timeLayout), attempt.StatusCode, attempt.Error, deliveredAt, deliveryID); err != nil {
+		return fmt.Errorf("更新投递状态失败: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListDeliveries Webhook最近的投递记录，status 为空时不筛选
+func (d *Database) ListDeliveries(webhookID int, status string, limit int) ([]WebhookDelivery, error) {
+	conditions := []string{"d.webhook_id = ?"}
+	args := []interface{}{webhookID}
+	if status != "" {
+		conditions = append(conditions, "d.status = ?")
+		args = append(args, status)
+	}
+	args = append(args, limit)
+
+	deliveries := []WebhookDelivery{}
+	err := d.db.SelectContext(d.ctx, &deliveries, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries d JOIN events e ON e.id = d.event_id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY d.id DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询投递记录失败: %w", err)
+	}
+	return deliveries, nil
+}
+
+// GetDelivery 查询投递记录及每次尝试的结果，不存在时返回 nil
+func (d *Database) GetDelivery(webhookID int, id int64) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := d.db.GetContext(d.ctx, &delivery, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries d JOIN events e ON e.id = d.event_id
+		WHERE d.id = ? AND d.webhook_id = ?`, id, webhookID)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询投递记录失败: %w", err)
+	}
+	delivery.AttemptLog = []WebhookAttempt{}
+	if err := d.db.SelectContext(d.ctx, &delivery.AttemptLog, `
+		SELECT attempt, status_code, error, response, duration_ms, attempted_at
+		FROM webhook_attempts WHERE delivery_id = ? ORDER BY id`, id); err != nil {
+		return nil, fmt.Errorf("查询投递尝试失败: %w", err)
+	}
+	return &delivery, nil
+}
+
+// RetryDelivery 将投递记录重新置为待投递并清零次数，立即重试
+func (d *Database) RetryDelivery(webhookID int, id int64, now time.Time) (bool, error) {
+	result, err := d.db.ExecContext(d.ctx, `
+		UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?
+		WHERE id = ? AND webhook_id = ?`, DeliveryPending, now.Format(timeLayout), id, webhookID)
+	if err != nil {
+		return false, fmt.Errorf("重置投递记录失败: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	if n > 0 && d.onEvent != nil {
+		d.onEvent()
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"Server/config"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 解析来源
+const (
+	ExplanationFromHand     = "hand"     // 手动录入或编辑
+	ExplanationFromAI       = "ai"       // AI出题时一并生成
+	ExplanationFromBackfill = "backfill" // 对已有题目批量补写
+)
+
+// SaveExplanation 保存题目解析并记录来源（来源、模型与时间）
+func (d *Database) SaveExplanation(id int, exp *config.Explanation, source, model string) error {
+	_, err := d.db.ExecContext(d.ctx, `
+		UPDATE questions SET
+			explanations = ?,
+			hint = ?,
+			reference = ?,
+			explanation_source = ?,
+			explanation_model = ?,
+			explanation_at = datetime('now', 'localtime')
+		WHERE id = ?`,
+		marshalStrings(exp.Explanations),
+		exp.Hint,
+		exp.Reference,
+		source,
+		model,
+		id,
+	)
+	return err
+}
+
+// ExplanationCandidates 工作区中需要补写解析的题目
+// 默认只选择没有解析的手写题；指定ID时按ID选择，overwrite为true时覆盖已有解析
+func (d *Database) ExplanationCandidates(workspaceID int, ids []int, limit int, overwrite bool) ([]Question, error) {
+	conditions := []string{"workspace_id = ?"}
+	args := []interface{}{workspaceID}
+	if len(ids) > 0 {
+		conditions = append(conditions, "id IN (?)")
+		args = append(args, ids)
+	} else {
+		conditions = append(conditions, "source = ?")
+		args = append(args, config.SourceHand)
+	}
+	if !overwrite {
+		conditions = append(conditions, "explanations = '[]'")
+	}
+
+	query, args, err := sqlx.In(
+		"SELECT "+questionColumnsSQL+" FROM questions WHERE "+strings.Join(conditions, " AND ")+" ORDER BY id LIMIT ?",
+		append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []questionRow
+	if err := d.db.SelectContext(d.ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	questions := make([]Question, 0, len(rows))
+	for _, row := range rows {
+		q, err := row.toQuestion()
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, *q)
+	}
+	return questions, nil
+}
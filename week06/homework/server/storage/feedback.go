@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const createFeedbackTableSQL = `
+CREATE TABLE IF NOT EXISTS question_flags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    question_id INTEGER NOT NULL,
+    workspace_id INTEGER NOT NULL,
+    student_id TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open',
+    note TEXT NOT NULL DEFAULT '',
+    handled_by TEXT NOT NULL DEFAULT '',
+    handled_at TEXT NOT NULL DEFAULT '',
+    revision_id INTEGER NOT NULL DEFAULT 0,
+    verified INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_question_flags_question ON question_flags(question_id, status);
+CREATE INDEX IF NOT EXISTS idx_question_flags_workspace ON question_flags(workspace_id, status, question_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_question_flags_open ON question_flags(question_id, student_id) WHERE status = 'open';
+`
+
+// 旧版 question_flags 表缺少的字段
+var feedbackColumns = []struct {
+	name string
+	ddl  string
+}{
+	{"verified", "verified INTEGER NOT NULL DEFAULT 0"},
+}
+
+// 反馈原因
+const (
+	FlagWrongKey  = "wrong_key" // 答案错误
+	FlagAmbiguous = "ambiguous" // 表述有歧义
+	FlagTypo      = "typo"      // 错别字
+	FlagOther     = "other"     // 其他，需要说明
+)
+
+// FlagReasons 学生可以选择的反馈原因
+var FlagReasons = []string{FlagWrongKey, FlagAmbiguous, FlagTypo, FlagOther}
+
+// 反馈状态
+const (
+	FlagOpen      = "open"      // 等待处理
+	FlagResolved  = "resolved"  // 已修正题目
+	FlagDismissed = "dismissed" // 不需要修改
+)
+
+// ErrFlagExists 同一学生对同一道题已有未处理的反馈
+var ErrFlagExists = errors.New("已有未处理的反馈")
+
+// QuestionFlag 学生对题目的一条反馈
+type QuestionFlag struct {
+	ID          int    `json:"id" db:"id"`
+	QuestionID  int    `json:"question_id" db:"question_id"`
+	WorkspaceID int    `json:"workspace_id" db:"workspace_id"` // 题目所属的工作区，由该工作区处理
+	StudentID   string `json:"student_id" db:"student_id"`
+	Reason      string `json:"reason" db:"reason"`
+	Comment     string `json:"comment" db:"comment"`
+	Status      string `json:"status" db:"status"`
+	Note        string `json:"note" db:"note"` // 处理说明
+	HandledBy   string `json:"handled_by" db:"handled_by"`
+	HandledAt   string `json:"handled_at" db:"handled_at"`
+	RevisionID  int    `json:"revision_id" db:"revision_id"` // 已解决时对应的修订记录，即反馈之后的第一次修改
+	Verified    bool   `json:"verified" db:"verified"`       // 提交时学生作答过该题，只有这样的反馈计入暂停阈值
+	CreatedAt   string `json:"created_at" db:"created_at"`
+}
+
+// FlagSummary 提交反馈后题目的反馈情况
+type FlagSummary struct {
+	ID            int  `json:"id"`
+	Verified      bool `json:"verified"` // 本条反馈是否计入暂停阈值
+	OpenFlags     int  `json:"open_flags"`
+	VerifiedFlags int  `json:"verified_flags"` // 未处理的反馈中作答过该题的学生提交的数量
+	Suspended     bool `json:"suspended"`      // 题目是否已暂停用于考试
+}
+
+// FlaggedQuestion 处理队列中的一道题及其反馈
+type FlaggedQuestion struct {
+	QuestionID int            `json:"question_id"`
+	Title      string         `json:"title"`
+	Suspended  bool           `json:"suspended"`
+	Reasons    map[string]int `json:"reasons"`  // 各原因的反馈数
+	Verified   int            `json:"verified"` // 作答过该题的学生提交的反馈数
+	Flags      []QuestionFlag `json:"flags"`
+}
+
+// CreateQuestionFlag 保存学生的反馈并记录 question.flagged 事件。
+// 作答过该题的学生（f.Verified）未处理的反馈达到 threshold 时题目暂停用于考试，threshold 为 0 时不暂停；
+// 其他反馈只进入处理队列，由老师判断
+func (d *Database) CreateQuestionFlag(f *QuestionFlag, threshold int) (*FlagSummary, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 1. 同一学生每道题只保留一条未处理的反馈
+	var exists int
+	if err := tx.GetContext(d.ctx, &exists, `
+		SELECT COUNT(*) FROM question_flags WHERE question_id = ? AND student_id = ? AND status = ?`,
+		f.QuestionID, f.StudentID, FlagOpen); err != nil {
+		return nil, fmt.Errorf("查询反馈失败: %w", err)
+	}
+	if exists > 0 {
+		return nil, ErrFlagExists
+	}
+	f.Status = FlagOpen
+	f.CreatedAt = time.Now().Format(timeLayout)
+	if err := tx.GetContext(d.ctx, &f.ID, `
+		INSERT INTO question_flags (question_id, workspace_id, student_id, reason, comment, status, verified, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		f.QuestionID, f.WorkspaceID, f.StudentID, f.Reason, f.Comment, f.Status, f.Verified, f.CreatedAt); err != nil {
+		return nil, fmt.Errorf("保存反馈失败: %w", err)
+	}
+
+	// 2. 达到阈值时暂停用于考试
+	summary := &FlagSummary{ID: f.ID, Verified: f.Verified}
+	if err := tx.QueryRowxContext(d.ctx, `
+		SELECT COUNT(*), COALESCE(SUM(verified), 0) FROM question_flags WHERE question_id = ? AND status = ?`,
+		f.QuestionID, FlagOpen).Scan(&summary.OpenFlags, &summary.VerifiedFlags); err != nil {
+		return nil, fmt.Errorf("统计反馈失败: %w", err)
+	}
+	if f.Verified && threshold > 0 && summary.VerifiedFlags >= threshold {
+		if _, err := tx.ExecContext(d.ctx, `UPDATE questions SET suspended = 1 WHERE id = ?`, f.QuestionID); err != nil {
+			return nil, fmt.Errorf("暂停题目失败: %w", err)
+		}
+	}
+	if err := tx.GetContext(d.ctx, &summary.Suspended, `SELECT suspended FROM questions WHERE id = ?`, f.QuestionID); err != nil {
+		return nil, fmt.Errorf("查询题目失败: %w", err)
+	}
+
+	event := NewEvent(f.WorkspaceID, EventQuestionFlagged, []int{f.QuestionID}, map[string]interface{}{
+		"reason": f.Reason, "verified": f.Verified, "open_flags": summary.OpenFlags,
+		"verified_flags": summary.VerifiedFlags, "suspended": summary.Suspended,
+	})
+	if err := d.CommitWithEvent(tx, event); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// HasAttempted 学生是否作答过题目（含同一题目的其他语言版本）：作答记录（含 LTI 作业）或编程题的代码提交
+func (d *Database) HasAttempted(studentID string, questionID int) (bool, error) {
+	var attempted bool
+	err := d.db.GetContext(d.ctx, &attempted, `
+		SELECT EXISTS (
+			SELECT 1 FROM answer_records a JOIN questions q ON q.id = a.question_id
+			WHERE a.student_id = ? AND COALESCE(q.group_id, q.id) = (SELECT COALESCE(group_id, id) FROM questions WHERE id = ?)
+		) OR EXISTS (
+			SELECT 1 FROM code_submissions WHERE student_id = ? AND question_id = ?
+		)`, studentID, questionID, studentID, questionID)
+	if err != nil {
+		return false, fmt.Errorf("查询作答记录失败: %w", err)
+	}
+	return attempted, nil
+}
+
+// FlagQueue 工作区中有该状态反馈的题目，作答过该题的学生反馈多的在前，其次是反馈总数，最多 limit 道题
+func (d *Database) FlagQueue(workspaceID int, status, reason string, limit int) ([]FlaggedQuestion, error) {
+	query := `
+		SELECT f.*, q.title, q.suspended FROM question_flags f JOIN questions q ON q.id = f.question_id
+		WHERE f.workspace_id = ? AND f.status = ?`
+	args := []interface{}{workspaceID, status}
+	if reason != "" {
+		query += " AND f.reason = ?"
+		args = append(args, reason)
+	}
+	var rows []struct {
+		QuestionFlag
+		Title     string `db:"title"`
+		Suspended bool   `db:"suspended"`
+	}
+	if err := d.db.SelectContext(d.ctx, &rows, query+" ORDER BY f.id", args...); err != nil {
+		return nil, fmt.Errorf("查询反馈失败: %w", err)
+	}
+
+	byQuestion := make(map[int]*FlaggedQuestion)
+	queue := []*FlaggedQuestion{}
+	for _, r := range rows {
+		item, ok := byQuestion[r.QuestionID]
+		if !ok {
+			item = &FlaggedQuestion{QuestionID: r.QuestionID, Title: r.Title, Suspended: r.Suspended, Reasons: map[string]int{}}
+			byQuestion[r.QuestionID] = item
+			queue = append(queue, item)
+		}
+		item.Reasons[r.Reason]++
+		if r.Verified {
+			item.Verified++
+		}
+		item.Flags = append(item.Flags, r.QuestionFlag)
+	}
+	// 反馈数相同时先反馈的在前（rows 按反馈ID升序）
+	sort.SliceStable(queue, func(i, j int) bool {
+		if queue[i].Verified != queue[j].Verified {
+			return queue[i].Verified > queue[j].Verified
+		}
+		return len(queue[i].Flags) > len(queue[j].Flags)
+	})
+
+	list := make([]FlaggedQuestion, 0, min(limit, len(queue)))
+	for _, item := range queue[:min(limit, len(queue))] {
+		list = append(list, *item)
+	}
+	return list, nil
+}
+
+// QuestionFlags 工作区中某道题的全部反馈（新的在前）
+func (d *Database) QuestionFlags(workspaceID, questionID int) ([]QuestionFlag, error) {
+	flags := []QuestionFlag{}
+	err := d.db.SelectContext(d.ctx, &flags, `
+		SELECT * FROM question_flags WHERE workspace_id = ? AND question_id = ? ORDER BY id DESC`, workspaceID, questionID)
+	if err != nil {
+		return nil, fmt.Errorf("查询反馈失败: %w", err)
+	}
+	return flags, nil
+}
+
+// OpenFlags 工作区中未处理的反馈：按ID选取，或选取 questionID 的全部未处理反馈。
+// RevisionID 为反馈之后的第一次修改，没有修改过时为 0
+func (d *Database) OpenFlags(workspaceID int, ids []int, questionID int) ([]QuestionFlag, error) {
+	query := `
+		SELECT f.id, f.question_id, f.workspace_id, f.student_id, f.reason, f.comment, f.status, f.note,
+			f.handled_by, f.handled_at, f.verified, f.created_at,
+			COALESCE((SELECT MIN(r.id) FROM question_revisions r
+				WHERE r.question_id = f.question_id AND r.created_at >= f.created_at), 0) AS revision_id
+		FROM question_flags f
+		WHERE f.workspace_id = ? AND f.status = ?`
+	args := []interface{}{workspaceID, FlagOpen}
+	if len(ids) > 0 {
+		query += " AND f.id IN (?)"
+		args = append(args, ids)
+	} else {
+		query += " AND f.question_id = ?"
+		args = append(args, questionID)
+	}
+	query, args, err := sqlx.In(query+" ORDER BY f.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	flags := []QuestionFlag{}
+	if err := d.db.SelectContext(d.ctx, &flags, query, args...); err != nil {
+		return nil, fmt.Errorf("查询反馈失败: %w", err)
+	}
+	return flags, nil
+}
+
+// CloseQuestionFlags 将未处理的反馈标记为已解决（关联到对应的修订记录）或不需要修改，
+// 并记录 question.feedback_handled 事件。题目计入阈值的未处理反馈少于 threshold（为 0 时不论多少）时
+// 恢复用于考试，返回实际处理的反馈与恢复的题目ID
+func (d *Database) CloseQuestionFlags(workspaceID int, flags []QuestionFlag, status, note, user string, threshold int) ([]QuestionFlag, []int, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// 1. 逐条处理，已被其他人处理的反馈跳过
+	now := time.Now().Format(timeLayout)
+	closed := make([]QuestionFlag, 0, len(flags))
+	var questionIDs []int
+	seen := make(map[int]bool)
+	for _, f := range flags {
+		if status != FlagResolved {
+			f.RevisionID = 0
+		}
+		result, err := tx.ExecContext(d.ctx, `
+			UPDATE question_flags SET status = ?, note = ?, handled_by = ?, handled_at = ?, revision_id = ?
+			WHERE id = ? AND workspace_id = ? AND status = ?`,
+			status, note, user, now, f.RevisionID, f.ID, workspaceID, FlagOpen)
+		if err != nil {
+			return nil, nil, fmt.Errorf("处理反馈失败: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+		f.Status, f.Note, f.HandledBy, f.HandledAt = status, note, user, now
+		closed = append(closed, f)
+		if !seen[f.QuestionID] {
+			seen[f.QuestionID] = true
+			questionIDs = append(questionIDs, f.QuestionID)
+		}
+	}
+	if len(closed) == 0 {
+		return closed, []int{}, nil
+	}
+
+	// 2. 未处理的反馈不再达到阈值的题目恢复用于考试
+	query, args, err := sqlx.In(`
+		UPDATE questions SET suspended = 0
+		WHERE id IN (?) AND suspended = 1 AND (? = 0 OR (
+			SELECT COUNT(*) FROM question_flags f WHERE f.question_id = questions.id AND f.status = ? AND f.verified = 1) < ?)
+		RETURNING id`, questionIDs, threshold, FlagOpen, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	restored := []int{}
+	if err := tx.SelectContext(d.ctx, &restored, query, args...); err != nil {
+		return nil, nil, fmt.Errorf("恢复题目失败: %w", err)
+	}
+	sort.Ints(restored)
+
+	event := NewEvent(workspaceID, EventQuestionFeedbackHandled, questionIDs, map[string]interface{}{
+		"status": status, "count": len(closed), "restored": restored,
+	})
+	if err := d.CommitWithEvent(tx, event); err != nil {
+		return nil, nil, err
+	}
+	return closed, restored, nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileStore 附件文件存储，目录结构与 file-service 相同：<根目录>/YYYY-MM-DD/<uuid前两位>/<uuid>，
+// 防止单个目录文件过多。文件的相对路径记录在 attachments 表中，读取时不需要按日期查找
+type FileStore struct {
+	basePath string
+}
+
+func NewFileStore(basePath string) *FileStore {
+	return &FileStore{basePath: basePath}
+}
+
+// Dir 存储根目录
+func (fs *FileStore) Dir() string {
+	return fs.basePath
+}
+
+// SavedFile 写入完成的文件
+type SavedFile struct {
+	Path   string // 相对存储根目录的路径
+	Size   int64
+	SHA256 string
+}
+
+// Save 写入文件，超过 maxSize 字节或 ctx 取消（客户端断开、服务退出）时中止并删除不完整的文件
+func (fs *FileStore) Save(ctx context.Context, uuid string, src io.Reader, maxSize int64) (*SavedFile, error) {
+	if len(uuid) < 2 {
+		return nil, fmt.Errorf("无效的文件ID: %s", uuid)
+	}
+	rel := filepath.Join(time.Now().Format("2006-01-02"), uuid[:2], uuid)
+	dst := filepath.Join(fs.basePath, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return nil, fmt.Errorf("创建目录失败: %w", err)
+	}
+	file, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	// 多读一个字节用于判断是否超过大小限制
+	n, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(&contextReader{ctx: ctx, r: src}, maxSize+1))
+	if err == nil && n > maxSize {
+		err = fmt.Errorf("文件不能超过 %dMB", maxSize>>20)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return nil, err
+	}
+	return &SavedFile{Path: filepath.ToSlash(rel), Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Open 打开相对路径对应的文件
+func (fs *FileStore) Open(rel string) (*os.File, error) {
+	return os.Open(fs.abs(rel))
+}
+
+// Delete 删除文件并清理变空的目录，文件已不存在时不报错
+func (fs *FileStore) Delete(rel string) error {
+	path := fs.abs(rel)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除失败: %w", err)
+	}
+	// 依次清理 <uuid前两位> 与日期目录
+	for dir := filepath.Dir(path); dir != filepath.Clean(fs.basePath); dir = filepath.Dir(dir) {
+		if empty, _ := isDirEmpty(dir); !empty {
+			break
+		}
+		_ = os.Remove(dir)
+	}
+	return nil
+}
+
+func (fs *FileStore) abs(rel string) string {
+	return filepath.Join(fs.basePath, filepath.FromSlash(rel))
+}
+
+// contextReader 每次读取前检查 ctx 是否已取消
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+func isDirEmpty(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	_, err = f.Readdirnames(1)
+	return err == io.EOF, nil
+}
@@ -0,0 +1,549 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const createLTITableSQL = `
+CREATE TABLE IF NOT EXISTS lti_platforms (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL DEFAULT 1,
+    name TEXT NOT NULL DEFAULT '',
+    issuer TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    deployment_ids TEXT NOT NULL DEFAULT '[]',
+    auth_login_url TEXT NOT NULL,
+    auth_token_url TEXT NOT NULL DEFAULT '',
+    jwks_url TEXT NOT NULL DEFAULT '',
+    jwks TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    UNIQUE (issuer, client_id)
+);
+
+CREATE TABLE IF NOT EXISTS lti_activities (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL DEFAULT 1,
+    kind TEXT NOT NULL,
+    title TEXT NOT NULL,
+    question_ids TEXT NOT NULL,
+    max_attempts INTEGER NOT NULL DEFAULT 0,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_lti_activities_workspace ON lti_activities(workspace_id);
+
+CREATE TABLE IF NOT EXISTS lti_states (
+    state TEXT PRIMARY KEY,
+    nonce TEXT NOT NULL,
+    platform_id INTEGER NOT NULL,
+    expires_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS lti_sessions (
+    token TEXT PRIMARY KEY,
+    platform_id INTEGER NOT NULL,
+    message_type TEXT NOT NULL,
+    deployment_id TEXT NOT NULL,
+    activity_id INTEGER NOT NULL DEFAULT 0,
+    subject TEXT NOT NULL,
+    student_id TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    roles TEXT NOT NULL DEFAULT '[]',
+    context_title TEXT NOT NULL DEFAULT '',
+    lineitem TEXT NOT NULL DEFAULT '',
+    ags_scopes TEXT NOT NULL DEFAULT '[]',
+    deep_link_return_url TEXT NOT NULL DEFAULT '',
+    deep_link_data TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS lti_submissions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    platform_id INTEGER NOT NULL,
+    activity_id INTEGER NOT NULL,
+    subject TEXT NOT NULL,
+    student_id TEXT NOT NULL,
+    correct INTEGER NOT NULL,
+    total INTEGER NOT NULL,
+    lineitem TEXT NOT NULL DEFAULT '',
+    passback_status TEXT NOT NULL,
+    passback_attempts INTEGER NOT NULL DEFAULT 0,
+    passback_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TEXT NOT NULL,
+    submitted_at TEXT NOT NULL,
+    passed_back_at TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_lti_submissions_student ON lti_submissions(activity_id, platform_id, subject);
+CREATE INDEX IF NOT EXISTS idx_lti_submissions_due ON lti_submissions(passback_status, next_attempt_at);
+`
+
+// LTI 活动类型
+const (
+	LTIExam     = "exam"     // 考试：默认只能提交一次
+	LTIPractice = "practice" // 练习：可以反复提交，每次都回传成绩
+)
+
+// 成绩回传状态
+const (
+	PassbackNone    = "none"    // 平台未开通成绩服务或链接没有成绩项
+	PassbackPending = "pending" // 等待首次回传或重试
+	PassbackSent    = "sent"
+	PassbackFailed  = "failed" // 重试次数用尽
+)
+
+// LTIPlatform 登记的 LTI 1.3 平台（LMS），启动的学生在对应工作区中作答
+type LTIPlatform struct {
+	ID            int      `json:"id" db:"id"`
+	WorkspaceID   int      `json:"workspace_id" db:"workspace_id"`
+	Name          string   `json:"name" db:"name"`
+	Issuer        string   `json:"issuer" db:"issuer"`                 // 平台的 iss
+	ClientID      string   `json:"client_id" db:"client_id"`           // 平台为本工具分配的 client_id（aud）
+	DeploymentIDs []string `json:"deployment_ids" db:"-"`              // 允许的部署ID，为空表示不限制
+	AuthLoginURL  string   `json:"auth_login_url" db:"auth_login_url"` // OIDC 授权地址
+	AuthTokenURL  string   `json:"auth_token_url" db:"auth_token_url"` // 获取成绩服务访问令牌的地址
+	JWKSURL       string   `json:"jwks_url" db:"jwks_url"`             // 平台公钥地址
+	JWKS          string   `json:"jwks,omitempty" db:"jwks"`           // 离线配置的平台公钥（JWK Set JSON），优先于 jwks_url
+	CreatedAt     string   `json:"created_at" db:"created_at"`
+}
+
+// LTIActivity 可以通过 Deep Linking 放入课程的考试或练习
+type LTIActivity struct {
+	ID          int    `json:"id" db:"id"`
+	WorkspaceID int    `json:"workspace_id" db:"workspace_id"`
+	Kind        string `json:"kind" db:"kind"`
+	Title       string `json:"title" db:"title"`
+	QuestionIDs []int  `json:"question_ids" db:"-"`
+	MaxAttempts int    `json:"max_attempts" db:"max_attempts"` // 最多提交次数，0 表示不限
+	CreatedBy   string `json:"created_by" db:"created_by"`
+	CreatedAt   string `json:"created_at" db:"created_at"`
+}
+
+// LTIState OIDC 登录发起时生成的 state 与 nonce，启动时校验后删除
+type LTIState struct {
+	State      string `db:"state"`
+	Nonce      string `db:"nonce"`
+	PlatformID int    `db:"platform_id"`
+	ExpiresAt  string `db:"expires_at"`
+}
+
+// LTISession 一次启动校验通过后的会话，浏览器凭 token 答题或选择活动
+type LTISession struct {
+	Token             string   `json:"-" db:"token"`
+	PlatformID        int      `json:"platform_id" db:"platform_id"`
+	MessageType       string   `json:"message_type" db:"message_type"`
+	DeploymentID      string   `json:"deployment_id" db:"deployment_id"`
+	ActivityID        int      `json:"activity_id" db:"activity_id"`
+	Subject           string   `json:"subject" db:"subject"`       // 平台中的用户ID（sub）
+	StudentID         string   `json:"student_id" db:"student_id"` // 作答记录使用的学号：lti:<平台ID>:<sub>
+	Name              string   `json:"name" db:"name"`
+	Roles             []string `json:"roles" db:"-"`
+	ContextTitle      string   `json:"context_title" db:"context_title"`
+	LineItem          string   `json:"-" db:"lineitem"`
+	AGSScopes         []string `json:"-" db:"-"`
+	DeepLinkReturnURL string   `json:"-" db:"deep_link_return_url"`
+	DeepLinkData      string   `json:"-" db:"deep_link_data"`
+	CreatedAt         string   `json:"created_at" db:"created_at"`
+	ExpiresAt         string   `json:"expires_at" db:"expires_at"`
+}
+
+// LTISubmission 一次通过 LTI 提交的作答及其成绩回传状态
+type LTISubmission struct {
+	ID               int64  `json:"id" db:"id"`
+	PlatformID       int    `json:"platform_id" db:"platform_id"`
+	ActivityID       int    `json:"activity_id" db:"activity_id"`
+	Subject          string `json:"subject" db:"subject"`
+	StudentID        string `json:"student_id" db:"student_id"`
+	Correct          int    `json:"correct" db:"correct"`
+	Total            int    `json:"total" db:"total"`
+	LineItem         string `json:"-" db:"lineitem"`
+	PassbackStatus   string `json:"passback_status" db:"passback_status"`
+	PassbackAttempts int    `json:"passback_attempts" db:"passback_attempts"`
+	PassbackError    string `json:"passback_error" db:"passback_error"`
+	NextAttemptAt    string `json:"-" db:"next_attempt_at"`
+	SubmittedAt      string `json:"submitted_at" db:"submitted_at"`
+	PassedBackAt     string `json:"passed_back_at" db:"passed_back_at"`
+}
+
+type ltiPlatformRow struct {
+	LTIPlatform
+	DeploymentIDsJSON string `db:"deployment_ids"`
+}
+
+func (r ltiPlatformRow) platform() LTIPlatform {
+	p := r.LTIPlatform
+	_ = json.Unmarshal([]byte(r.DeploymentIDsJSON), &p.DeploymentIDs)
+	if p.DeploymentIDs == nil {
+		p.DeploymentIDs = []string{}
+	}
+	return p
+}
+
+// CreateLTIPlatform 登记平台并回填ID，同一 issuer 与 client_id 只能登记一次
+func (d *Database) CreateLTIPlatform(p *LTIPlatform) error {
+	p.CreatedAt = time.Now().Format(timeLayout)
+	err := d.db.QueryRowContext(d.ctx, `
+		INSERT INTO lti_platforms (workspace_id, name, issuer, client_id, deployment_ids, auth_login_url, auth_token_url, jwks_url, jwks, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		p.WorkspaceID, p.Name, p.Issuer, p.ClientID, marshalStrings(p.DeploymentIDs),
+		p.AuthLoginURL, p.AuthTokenURL, p.JWKSURL, p.JWKS, p.CreatedAt,
+	).Scan(&p.ID)
+	if err != nil {
+		return fmt.Errorf("登记平台失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateLTIPlatform 更新平台配置，返回是否存在
+func (d *Database) UpdateLTIPlatform(p *LTIPlatform) (bool, error) {
+	result, err := d.db.ExecContext(d.ctx, `
+		UPDATE lti_platforms SET workspace_id = ?, name = ?, issuer = ?, client_id = ?, deployment_ids = ?,
+			auth_login_url = ?, auth_token_url = ?, jwks_url = ?, jwks = ?
+		WHERE id = ?`,
+		p.WorkspaceID, p.Name, p.Issuer, p.ClientID, marshalStrings(p.DeploymentIDs),
+		p.AuthLoginURL, p.AuthTokenURL, p.JWKSURL, p.JWKS, p.ID)
+	if err != nil {
+		return false, fmt.Errorf("更新平台失败: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteLTIPlatform 删除平台及其会话，已提交的作答与成绩记录保留
+func (d *Database) DeleteLTIPlatform(id int) (bool, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"lti_states", "lti_sessions"} {
+		if _, err := tx.ExecContext(d.ctx, `DELETE FROM `+table+` WHERE platform_id = ?`, id); err != nil {
+			return false, fmt.Errorf("删除平台会话失败: %w", err)
+		}
+	}
+	// 未完成的成绩回传无法再获取访问令牌
+	if _, err := tx.ExecContext(d.ctx, `
+		UPDATE lti_submissions SET passback_status = ?, passback_error = '平台已删除'
+		WHERE platform_id = ? AND passback_status = ?`, PassbackFailed, id, PassbackPending); err != nil {
+		return false, fmt.Errorf("更新成绩回传状态失败: %w", err)
+	}
+	result, err := tx.ExecContext(d.ctx, `DELETE FROM lti_platforms WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("删除平台失败: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, tx.Commit()
+}
+
+// GetLTIPlatform 查询平台，不存在时返回 nil
+func (d *Database) GetLTIPlatform(id int) (*LTIPlatform, error) {
+	var row ltiPlatformRow
+	err := d.db.GetContext(d.ctx, &row, `SELECT * FROM lti_platforms WHERE id = ?`, id)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询平台失败: %w", err)
+	}
+	p := row.platform()
+	return &p, nil
+}
+
+// FindLTIPlatforms 按 issuer 查询平台，clientID 不为空时只返回该客户端
+func (d *Database) FindLTIPlatforms(issuer, clientID string) ([]LTIPlatform, error) {
+	query, args := `SELECT * FROM lti_platforms WHERE issuer = ?`, []interface{}{issuer}
+	if clientID != "" {
+		query += ` AND client_id = ?`
+		args = append(args, clientID)
+	}
+	return d.selectLTIPlatforms(query+` ORDER BY id`, args...)
+}
+
+// ListLTIPlatforms 所有登记的平台
+func (d *Database) ListLTIPlatforms() ([]LTIPlatform, error) {
+	return d.selectLTIPlatforms(`SELECT * FROM lti_platforms ORDER BY id`)
+}
+
+func (d *Database) selectLTIPlatforms(query string, args ...interface{}) ([]LTIPlatform, error) {
+	var rows []ltiPlatformRow
+	if err := d.db.SelectContext(d.ctx, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("查询平台失败: %w", err)
+	}
+	platforms := make([]LTIPlatform, 0, len(rows))
+	for _, row := range rows {
+		platforms = append(platforms, row.platform())
+	}
+	return platforms, nil
+}
+
+type ltiActivityRow struct {
+	LTIActivity
+	QuestionIDsJSON string `db:"question_ids"`
+}
+
+func (r ltiActivityRow) activity() LTIActivity {
+	a := r.LTIActivity
+	_ = json.Unmarshal([]byte(r.QuestionIDsJSON), &a.QuestionIDs)
+	return a
+}
+
+// CreateLTIActivity 保存考试或练习并回填ID
+func (d *Database) CreateLTIActivity(a *LTIActivity) error {
+	ids, _ := json.Marshal(a.QuestionIDs)
+	a.CreatedAt = time.Now().Format(timeLayout)
+	err := d.db.QueryRowContext(d.ctx, `
+		INSERT INTO lti_activities (workspace_id, kind, title, question_ids, max_attempts, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		a.WorkspaceID, a.Kind, a.Title, string(ids), a.MaxAttempts, a.CreatedBy, a.CreatedAt,
+	).Scan(&a.ID)
+	if err != nil {
+		return fmt.Errorf("创建活动失败: %w", err)
+	}
+	return nil
+}
+
+// GetLTIActivity 查询工作区的活动，不存在时返回 nil
+func (d *Database) GetLTIActivity(workspaceID, id int) (*LTIActivity, error) {
+	var row ltiActivityRow
+	err := d.db.GetContext(d.ctx, &row, `SELECT * FROM lti_activities WHERE id = ? AND workspace_id = ?`, id, workspaceID)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询活动失败: %w", err)
+	}
+	a := row.activity()
+	return &a, nil
+}
+
+// ListLTIActivities 工作区的活动，按创建时间倒序
+func (d *Database) ListLTIActivities(workspaceID int) ([]LTIActivity, error) {
+	var rows []ltiActivityRow
+	if err := d.db.SelectContext(d.ctx, &rows, `
+		SELECT * FROM lti_activities WHERE workspace_id = ? ORDER BY id DESC`, workspaceID); err != nil {
+		return nil, fmt.Errorf("查询活动失败: %w", err)
+	}
+	activities := make([]LTIActivity, 0, len(rows))
+	for _, row := range rows {
+		activities = append(activities, row.activity())
+	}
+	return activities, nil
+}
+
+// DeleteLTIActivity 删除工作区的活动，返回是否存在；课程中已放置的链接启动时会提示活动不存在
+func (d *Database) DeleteLTIActivity(workspaceID, id int) (bool, error) {
+	result, err := d.db.ExecContext(d.ctx, `DELETE FROM lti_activities WHERE id = ? AND workspace_id = ?`, id, workspaceID)
+	if err != nil {
+		return false, fmt.Errorf("删除活动失败: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// SaveLTIState 保存登录发起时的 state
+func (d *Database) SaveLTIState(s *LTIState) error {
+	_, err := d.db.NamedExecContext(d.ctx, `
+		INSERT INTO lti_states (state, nonce, platform_id, expires_at)
+		VALUES (:state, :nonce, :platform_id, :expires_at)`, s)
+	if err != nil {
+		return fmt.Errorf("保存登录状态失败: %w", err)
+	}
+	return nil
+}
+
+// ConsumeLTIState 取出并删除未过期的 state，每个 state 只能使用一次，不存在或已过期时返回 nil
+func (d *Database) ConsumeLTIState(state string, now time.Time) (*LTIState, error) {
+	var s LTIState
+	err := d.db.GetContext(d.ctx, &s, `
+		DELETE FROM lti_states WHERE state = ? RETURNING state, nonce, platform_id, expires_at`, state)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取登录状态失败: %w", err)
+	}
+	if s.ExpiresAt < now.Format(timeLayout) {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+type ltiSessionRow struct {
+	LTISession
+	RolesJSON  string `db:"roles"`
+	ScopesJSON string `db:"ags_scopes"`
+}
+
+// CreateLTISession 保存启动会话
+func (d *Database) CreateLTISession(s *LTISession) error {
+	s.CreatedAt = time.Now().Format(timeLayout)
+	_, err := d.db.ExecContext(d.ctx, `
+		INSERT INTO lti_sessions (token, platform_id, message_type, deployment_id, activity_id, subject, student_id, name, roles,
+			context_title, lineitem, ags_scopes, deep_link_return_url, deep_link_data, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.Token, s.PlatformID, s.MessageType, s.DeploymentID, s.ActivityID, s.Subject, s.StudentID, s.Name,
+		marshalStrings(s.Roles), s.ContextTitle, s.LineItem, marshalStrings(s.AGSScopes),
+		s.DeepLinkReturnURL, s.DeepLinkData, s.CreatedAt, s.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("保存会话失败: %w", err)
+	}
+	return nil
+}
+
+// GetLTISession 查询未过期的会话，不存在或已过期时返回 nil
+func (d *Database) GetLTISession(token string, now time.Time) (*LTISession, error) {
+	var row ltiSessionRow
+	err := d.db.GetContext(d.ctx, &row, `
+		SELECT * FROM lti_sessions WHERE token = ? AND expires_at >= ?`, token, now.Format(timeLayout))
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询会话失败: %w", err)
+	}
+	s := row.LTISession
+	_ = json.Unmarshal([]byte(row.RolesJSON), &s.Roles)
+	_ = json.Unmarshal([]byte(row.ScopesJSON), &s.AGSScopes)
+	return &s, nil
+}
+
+// DeleteLTISession 删除会话（Deep Linking 完成后不能再次使用）
+func (d *Database) DeleteLTISession(token string) error {
+	if _, err := d.db.ExecContext(d.ctx, `DELETE FROM lti_sessions WHERE token = ?`, token); err != nil {
+		return fmt.Errorf("删除会话失败: %w", err)
+	}
+	return nil
+}
+
+// PruneLTISessions 清理过期的 state 与会话，返回清理的会话数
+func (d *Database) PruneLTISessions(now time.Time) (int64, error) {
+	at := now.Format(timeLayout)
+	if _, err := d.db.ExecContext(d.ctx, `DELETE FROM lti_states WHERE expires_at < ?`, at); err != nil {
+		return 0, fmt.Errorf("清理登录状态失败: %w", err)
+	}
+	result, err := d.db.ExecContext(d.ctx, `DELETE FROM lti_sessions WHERE expires_at < ?`, at)
+	if err != nil {
+		return 0, fmt.Errorf("清理会话失败: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SaveLTISubmission 在一个事务中写入作答记录（同时更新学习状态）与提交记录；
+// maxAttempts 大于0时检查该学生已提交的次数，超过时返回 false 且不写入
+func (d *Database) SaveLTISubmission(sub *LTISubmission, records []AnswerRecord, maxAttempts int) (bool, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// 1. 提交次数
+	if maxAttempts > 0 {
+		var count int
+		if err := tx.GetContext(d.ctx, &count, `
+			SELECT COUNT(*) FROM lti_submissions WHERE activity_id = ? AND platform_id = ? AND subject = ?`,
+			sub.ActivityID, sub.PlatformID, sub.Subject); err != nil {
+			return false, fmt.Errorf("查询提交次数失败: %w", err)
+		}
+		if count >= maxAttempts {
+			return false, nil
+		}
+	}
+
+	// 2. 作答记录与学习状态
+	now := time.Now()
+	at := now.Format(timeLayout)
+	for i := range records {
+		selectedJSON, _ := json.Marshal(records[i].Selected)
+		records[i].AnsweredAt = at
+		err := tx.QueryRowContext(d.ctx, `
+			INSERT INTO answer_records (question_id, student_id, selected, correct, answered_at)
+			VALUES (?, ?, ?, ?, ?)
+			RETURNING id`,
+			records[i].QuestionID, records[i].StudentID, string(selectedJSON), records[i].Correct, at,
+		).Scan(&records[i].ID)
+		if err != nil {
+			return false, fmt.Errorf("写入作答记录失败: %w", err)
+		}
+		if err := applyLearning(tx, records[i], now); err != nil {
+			return false, err
+		}
+	}
+
+	// 3. 提交记录，有成绩项时等待回传
+	sub.SubmittedAt, sub.NextAttemptAt = at, at
+	sub.PassbackStatus = PassbackNone
+	if sub.LineItem != "" {
+		sub.PassbackStatus = PassbackPending
+	}
+	err = tx.QueryRowContext(d.ctx, `
+		INSERT INTO lti_submissions (platform_id, activity_id, subject, student_id, correct, total, lineitem,
+			passback_status, next_attempt_at, submitted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		sub.PlatformID, sub.ActivityID, sub.Subject, sub.StudentID, sub.Correct, sub.Total, sub.LineItem,
+		sub.PassbackStatus, sub.NextAttemptAt, sub.SubmittedAt,
+	).Scan(&sub.ID)
+	if err != nil {
+		return false, fmt.Errorf("保存提交记录失败: %w", err)
+	}
+	return true, tx.Commit()
+}
+
+// ListLTISubmissions 学生在该活动中的提交，最近的在前
+func (d *Database) ListLTISubmissions(platformID, activityID int, subject string) ([]LTISubmission, error) {
+	subs := []LTISubmission{}
+	err := d.db.SelectContext(d.ctx, &subs, `
+		SELECT * FROM lti_submissions WHERE platform_id = ? AND activity_id = ? AND subject = ?
+		ORDER BY id DESC`, platformID, activityID, subject)
+	if err != nil {
+		return nil, fmt.Errorf("查询提交记录失败: %w", err)
+	}
+	return subs, nil
+}
+
+// ActivitySubmissions 活动的全部提交，教师查看成绩与回传状态
+func (d *Database) ActivitySubmissions(activityID int) ([]LTISubmission, error) {
+	subs := []LTISubmission{}
+	err := d.db.SelectContext(d.ctx, &subs, `
+		SELECT * FROM lti_submissions WHERE activity_id = ? ORDER BY id DESC`, activityID)
+	if err != nil {
+		return nil, fmt.Errorf("查询提交记录失败: %w", err)
+	}
+	return subs, nil
+}
+
+// DuePassbacks 到期待回传的成绩
+func (d *Database) DuePassbacks(now time.Time, limit int) ([]LTISubmission, error) {
+	var subs []LTISubmission
+	err := d.db.SelectContext(d.ctx, &subs, `
+		SELECT * FROM lti_submissions WHERE passback_status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id LIMIT ?`, PassbackPending, now.Format(timeLayout), limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询待回传成绩失败: %w", err)
+	}
+	return subs, nil
+}
+
+// RecordPassback 记录一次回传结果，errMsg 为空表示成功
+func (d *Database) RecordPassback(id int64, status, errMsg string, next time.Time) error {
+	passedBack := ""
+	if status == PassbackSent {
+		passedBack = time.Now().Format(timeLayout)
+	}
+	_, err := d.db.ExecContext(d.ctx, `
+		UPDATE lti_submissions SET passback_status = ?, passback_attempts = passback_attempts + 1,
+			passback_error = ?, next_attempt_at = ?, passed_back_at = ?
+		WHERE id = ?`, status, errMsg, next.Format(timeLayout), passedBack, id)
+	if err != nil {
+		return fmt.Errorf("记录成绩回传失败: %w", err)
+	}
+	return nil
+}
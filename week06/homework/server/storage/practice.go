@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"Server/config"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const createPracticeTableSQL = `
+CREATE TABLE IF NOT EXISTS student_mastery (
+    student_id TEXT NOT NULL,
+    knowledge TEXT NOT NULL,
+    rating REAL NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    updated_at TEXT NOT NULL,
+    PRIMARY KEY (student_id, knowledge)
+);
+
+CREATE TABLE IF NOT EXISTS question_ratings (
+    question_id INTEGER PRIMARY KEY,
+    rating REAL NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS review_queue (
+    student_id TEXT NOT NULL,
+    question_id INTEGER NOT NULL,
+    box INTEGER NOT NULL,
+    due_at TEXT NOT NULL,
+    missed_at TEXT NOT NULL,
+    PRIMARY KEY (student_id, question_id)
+);
+`
+
+const (
+	InitialRating = 1500.0 // Elo初始分
+	eloK          = 32.0   // Elo更新系数
+	timeLayout    = "2006-01-02 15:04:05"
+)
+
+// 错题复习间隔（Leitner盒子），答对一次进入下一个盒子，全部通过后移出复习队列
+var reviewIntervals = []time.Duration{
+	10 * time.Minute,
+	24 * time.Hour,
+	3 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	15 * 24 * time.Hour,
+}
+
+// Mastery 学生在某个知识点上的掌握度
+type Mastery struct {
+	Knowledge string  `json:"knowledge" db:"knowledge"`
+	Rating    float64 `json:"rating" db:"rating"`
+	Attempts  int     `json:"attempts" db:"attempts"`
+	UpdatedAt string  `json:"updated_at" db:"updated_at"`
+}
+
+// PracticeCandidate 候选练习题
+type PracticeCandidate struct {
+	ID        int      `db:"id"`
+	GroupID   int      `db:"group_key"`
+	Type      int      `db:"type"`
+	Title     string   `db:"title"`
+	Language  string   `db:"language"`
+	Answers   string   `db:"answers"`
+	Tags      string   `db:"tags"`
+	Rating    float64  `db:"rating"`
+	Attempts  int      `db:"attempts"`
+	Knowledge []string `db:"-"`
+}
+
+// DueReview 到期的错题复习项
+type DueReview struct {
+	QuestionID int    `db:"question_id"`
+	Box        int    `db:"box"`
+	DueAt      string `db:"due_at"`
+	MissedAt   string `db:"missed_at"`
+}
+
+// KnowledgePoints 题目所属知识点：优先使用标签，无标签时按编程语言归类
+func KnowledgePoints(tagsJSON, language string) []string {
+	var tags []string
+	_ = json.Unmarshal([]byte(tagsJSON), &tags)
+	if len(tags) > 0 {
+		return tags
+	}
+	if language == "" {
+		return []string{"未分类"}
+	}
+	return []string{language}
+}
+
+// ExpectedScore Elo模型下学生答对题目的预期概率
+func ExpectedScore(studentRating, questionRating float64) float64 {
+	return 1 / (1 + math.Pow(10, (questionRating-studentRating)/400))
+}
+
+// applyLearning 根据一条作答记录更新知识点掌握度、题目难度与错题复习队列
+func applyLearning(tx *sqlx.Tx, rec AnswerRecord, at time.Time) error {
+	// 1. 读取题目知识点与当前难度
+	// 同一题目的不同语言版本共享难度，按组（原题ID）记录
+	var q struct {
+		GroupID  int     `db:"group_key"`
+		Tags     string  `db:"tags"`
+		Language string  `db:"language"`
+		Rating   float64 `db:"rating"`
+	}
+	err := tx.Get(&q, `
+		SELECT COALESCE(q.group_id, q.id) AS group_key, q.tags, q.language, COALESCE(r.rating, ?) AS rating
+		FROM questions q
+		LEFT JOIN question_ratings r ON r.question_id = COALESCE(q.group_id, q.id)
+		WHERE q.id = ?`, InitialRating, rec.QuestionID)
+	if err != nil {
+		return fmt.Errorf("读取题目失败: %w", err)
+	}
+	knowledge := KnowledgePoints(q.Tags, q.Language)
+
+	actual := 0.0
+	if rec.Correct {
+		actual = 1
+	}
+	now := at.Format(timeLayout)
+
+	// 2. 逐个知识点更新学生掌握度，题目难度按各知识点的平均变化反向调整
+	var questionDelta float64
+	for _, k := range knowledge {
+		rating := InitialRating
+		if err := tx.Get(&rating, `
+			SELECT rating FROM student_mastery
+			WHERE student_id = ? AND knowledge = ?`, rec.StudentID, k); err != nil && !isNoRows(err) {
+			return err
+		}
+
+		delta := eloK * (actual - ExpectedScore(rating, q.Rating))
+		questionDelta -= delta / float64(len(knowledge))
+
+		if _, err := tx.Exec(`
+			INSERT INTO student_mastery (student_id, knowledge, rating, attempts, updated_at)
+			VALUES (?, ?, ?, 1, ?)
+			ON CONFLICT(student_id, knowledge) DO UPDATE SET
+				rating = excluded.rating,
+				attempts = attempts + 1,
+				updated_at = excluded.updated_at`,
+			rec.StudentID, k, rating+delta, now); err != nil {
+			return fmt.Errorf("更新掌握度失败: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO question_ratings (question_id, rating, attempts)
+		VALUES (?, ?, 1)
+		ON CONFLICT(question_id) DO UPDATE SET
+			rating = excluded.rating,
+			attempts = attempts + 1`,
+		q.GroupID, q.Rating+questionDelta); err != nil {
+		return fmt.Errorf("更新题目难度失败: %w", err)
+	}
+
+	// 3. 维护错题复习队列
+	if !rec.Correct {
+		_, err := tx.Exec(`
+			INSERT INTO review_queue (student_id, question_id, box, due_at, missed_at)
+			VALUES (?, ?, 0, ?, ?)
+			ON CONFLICT(student_id, question_id) DO UPDATE SET
+				box = 0,
+				due_at = excluded.due_at,
+				missed_at = excluded.missed_at`,
+			rec.StudentID, rec.QuestionID, at.Add(reviewIntervals[0]).Format(timeLayout), now)
+		return err
+	}
+
+	var box int
+	err = tx.Get(&box, `
+		SELECT box FROM review_queue
+		WHERE student_id = ? AND question_id = ?`, rec.StudentID, rec.QuestionID)
+	if isNoRows(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	box++
+	if box >= len(reviewIntervals) {
+		_, err = tx.Exec(`DELETE FROM review_queue WHERE student_id = ? AND question_id = ?`,
+			rec.StudentID, rec.QuestionID)
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE review_queue SET box = ?, due_at = ?
+		WHERE student_id = ? AND question_id = ?`,
+		box, at.Add(reviewIntervals[box]).Format(timeLayout), rec.StudentID, rec.QuestionID)
+	return err
+}
+
+// RebuildLearningState 学习状态表为空而已有作答记录时，按时间顺序重放历史作答
+func (d *Database) RebuildLearningState() (int, error) {
+	var rated int
+	if err := d.db.GetContext(d.ctx, &rated, "SELECT COUNT(*) FROM question_ratings"); err != nil {
+		return 0, err
+	}
+	if rated > 0 {
+		return 0, nil
+	}
+
+	var records []struct {
+		AnswerRecord
+		Selected string `db:"selected"`
+	}
+	if err := d.db.SelectContext(d.ctx, &records, `
+		SELECT id, question_id, student_id, selected, correct, answered_at
+		FROM answer_records
+		WHERE question_id IN (SELECT id FROM questions)
+		ORDER BY id`); err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	for _, table := range []string{"student_mastery", "review_queue"} {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	for _, r := range records {
+		at, err := time.ParseInLocation(timeLayout, r.AnsweredAt, time.Local)
+		if err != nil {
+			at = time.Now()
+		}
+		if err := applyLearning(tx, r.AnswerRecord, at); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	return len(records), tx.Commit()
+}
+
+// GetMastery 学生全部知识点掌握度（由弱到强）
+func (d *Database) GetMastery(studentID string) ([]Mastery, error) {
+	items := make([]Mastery, 0)
+	err := d.db.SelectContext(d.ctx, &items, `
+		SELECT knowledge, rating, attempts, updated_at
+		FROM student_mastery
+		WHERE student_id = ?
+		ORDER BY rating ASC`, studentID)
+	return items, err
+}
+
+// DueReviews 已到复习时间且在练习范围内的错题，最早到期的排在前面
+func (d *Database) DueReviews(studentID string, now time.Time, filter PracticeFilter, limit int) ([]DueReview, error) {
+	conditions, args := filter.conditions()
+	query := `
+		SELECT rq.question_id, rq.box, rq.due_at, rq.missed_at, q.language, q.tags
+		FROM review_queue rq
+		JOIN questions q ON q.id = rq.question_id
+		WHERE rq.student_id = ? AND rq.due_at <= ?`
+	for _, cond := range conditions {
+		query += " AND " + cond
+	}
+	query += " ORDER BY rq.due_at ASC"
+	args = append([]interface{}{studentID, now.Format(timeLayout)}, args...)
+	// 知识点由标签计算，按知识点筛选时在读取后过滤
+	if filter.Knowledge == "" {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	var rows []struct {
+		DueReview
+		Language string `db:"language"`
+		Tags     string `db:"tags"`
+	}
+	if err := d.db.SelectContext(d.ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	items := make([]DueReview, 0, min(limit, len(rows)))
+	for _, r := range rows {
+		if len(items) == limit {
+			break
+		}
+		if filter.Knowledge != "" && !contains(KnowledgePoints(r.Tags, r.Language), filter.Knowledge) {
+			continue
+		}
+		items = append(items, r.DueReview)
+	}
+	return items, nil
+}
+
+// PracticeCandidates 可供自适应练习的题目（附带难度），排除近期已练习过的题目
+func (d *Database) PracticeCandidates(studentID string, since time.Time, filter PracticeFilter) ([]PracticeCandidate, error) {
+	conditions := []string{`COALESCE(q.group_id, q.id) NOT IN (
+		SELECT COALESCE(aq.group_id, aq.id)
+		FROM answer_records a
+		JOIN questions aq ON aq.id = a.question_id
+		WHERE a.student_id = ? AND a.answered_at >= ?)`}
+	args := []interface{}{InitialRating, studentID, since.Format(timeLayout)}
+	filterConditions, filterArgs := filter.conditions()
+	conditions = append(conditions, filterConditions...)
+	args = append(args, filterArgs...)
+
+	query := `
+		SELECT q.id, COALESCE(q.group_id, q.id) AS group_key, q.type, q.title, q.language, q.answers, q.tags,
+			COALESCE(r.rating, ?) AS rating, COALESCE(r.attempts, 0) AS attempts
+		FROM questions q
+		LEFT JOIN question_ratings r ON r.question_id = COALESCE(q.group_id, q.id)
+		WHERE ` + strings.Join(conditions, " AND ")
+
+	var items []PracticeCandidate
+	if err := d.db.SelectContext(d.ctx, &items, query, args...); err != nil {
+		return nil, err
+	}
+
+	result := items[:0]
+	for _, item := range items {
+		item.Knowledge = KnowledgePoints(item.Tags, item.Language)
+		if filter.Knowledge != "" && !contains(item.Knowledge, filter.Knowledge) {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// GetCandidate 按ID读取单道题目（用于错题复习）
+func (d *Database) GetCandidate(questionID int) (*PracticeCandidate, error) {
+	var item PracticeCandidate
+	err := d.db.GetContext(d.ctx, &item, `
+		SELECT q.id, COALESCE(q.group_id, q.id) AS group_key, q.type, q.title, q.language, q.answers, q.tags,
+			COALESCE(r.rating, ?) AS rating, COALESCE(r.attempts, 0) AS attempts
+		FROM questions q
+		LEFT JOIN question_ratings r ON r.question_id = COALESCE(q.group_id, q.id)
+		WHERE q.id = ?`, InitialRating, questionID)
+	if err != nil {
+		return nil, err
+	}
+	item.Knowledge = KnowledgePoints(item.Tags, item.Language)
+	return &item, nil
+}
+
+// PracticeFilter 练习范围
+type PracticeFilter struct {
+	WorkspaceID int // 只练习工作区可见的题目
+	Type        int
+	Language    string
+	Knowledge   string
+	Locale      string
+}
+
+// conditions 工作区、状态、题型、语言与语种的查询条件（题目表别名为 q），知识点需要读取后过滤。
+// 只练习、复习正常状态的题目，草稿与已归档的题目不会出现在练习与错题复习中
+func (f PracticeFilter) conditions() ([]string, []interface{}) {
+	conditions := []string{"q.id IN (" + visibleQuestionIDs + ")", "q.status = ?"}
+	args := []interface{}{f.WorkspaceID, f.WorkspaceID, config.StatusActive}
+	if f.Type != 0 {
+		conditions = append(conditions, "q.type = ?")
+		args = append(args, f.Type)
+	}
+	if f.Language != "" {
+		conditions = append(conditions, "q.language = ?")
+		args = append(args, f.Language)
+	}
+	if f.Locale != "" {
+		conditions = append(conditions, "q.locale = ?")
+		args = append(args, f.Locale)
+	}
+	return conditions, args
+}
+
+func contains(list []string, target string) bool {
+	for _, v := range list {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"Server/config"
+	"testing"
+	"time"
+)
+
+func TestDueReviewsSkipsArchived(t *testing.T) {
+	db := newTestDB(t)
+	var ids []int
+	for _, title := range []string{"a？", "b？"} {
+		id, err := db.CreateQuestion(1, &config.QuestionRequest1{
+			Type:     config.SingleSelect,
+			Title:    title,
+			Language: "go",
+			Answers:  []string{"A: 1", "B: 2", "C: 3", "D: 4"},
+			Rights:   []string{"A"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	// 两道题都答错，进入错题复习队列
+	if err := db.SaveAnswers([]AnswerRecord{
+		{QuestionID: ids[0], StudentID: "s1", Selected: []string{"B"}},
+		{QuestionID: ids[1], StudentID: "s1", Selected: []string{"C"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	due := func() []int {
+		items, err := db.DueReviews("s1", time.Now().Add(30*24*time.Hour), PracticeFilter{WorkspaceID: 1}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, item := range items {
+			got = append(got, item.QuestionID)
+		}
+		return got
+	}
+	if got := due(); len(got) != 2 {
+		t.Fatalf("due = %v, want both questions", got)
+	}
+
+	if _, err := db.SetQuestionStatus(1, ids[:1], config.StatusArchived); err != nil {
+		t.Fatal(err)
+	}
+	if got := due(); len(got) != 1 || got[0] != ids[1] {
+		t.Errorf("after archiving %d: due = %v, want [%d]", ids[0], got, ids[1])
+	}
+
+	// 恢复后重新出现在复习中
+	if _, err := db.SetQuestionStatus(1, ids[:1], config.StatusActive); err != nil {
+		t.Fatal(err)
+	}
+	if got := due(); len(got) != 2 {
+		t.Errorf("after restoring: due = %v, want both questions", got)
+	}
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"Server/config"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Question 完整题目信息（JSON字段已解析）
+type Question struct {
+	ID                int      `json:"id"`
+	Type              int      `json:"type"`
+	Title             string   `json:"title"`
+	Language          string   `json:"language"`
+	Answers           []string `json:"answers"`
+	Rights            []string `json:"rights"`
+	Tags              []string `json:"tags"`
+	Explanations      []string `json:"explanations"`
+	Hint              string   `json:"hint"`
+	Reference         string   `json:"reference"`
+	ExplanationSource string   `json:"explanation_source"` // 解析来源 hand/ai/backfill
+	ExplanationModel  string   `json:"explanation_model"`
+	ExplanationAt     string   `json:"explanation_at"`
+	Source            string   `json:"source"`
+	Status            string   `json:"status"`
+	StatusAt          string   `json:"status_at"`  // 最近一次修改状态的时间
+	Suspended         bool     `json:"suspended"`  // 未处理的反馈过多，暂停用于考试
+	OpenFlags         int      `json:"open_flags"` // 未处理的学生反馈数
+	CreatedAt         *string  `json:"created_at"`
+	Locale            string   `json:"locale"`
+	GroupID           int      `json:"group_id"` // 多语言版本所属组（原题ID）
+	WorkspaceID       int      `json:"workspace_id"`
+}
+
+// 数据库行结构，JSON字段以字符串形式存储
+type questionRow struct {
+	ID                int     `db:"id"`
+	Type              int     `db:"type"`
+	Title             string  `db:"title"`
+	Language          string  `db:"language"`
+	Answers           string  `db:"answers"`
+	Rights            string  `db:"rights"`
+	Tags              string  `db:"tags"`
+	Explanations      string  `db:"explanations"`
+	Hint              string  `db:"hint"`
+	Reference         string  `db:"reference"`
+	ExplanationSource string  `db:"explanation_source"`
+	ExplanationModel  string  `db:"explanation_model"`
+	ExplanationAt     string  `db:"explanation_at"`
+	Source            string  `db:"source"`
+	Status            string  `db:"status"`
+	StatusAt          string  `db:"status_at"`
+	Suspended         bool    `db:"suspended"`
+	OpenFlags         int     `db:"open_flags"`
+	CreatedAt         *string `db:"created_at"`
+	Locale            string  `db:"locale"`
+	GroupID           int     `db:"group_key"`
+	WorkspaceID       int     `db:"workspace_id"`
+}
+
+const questionColumnsSQL = `id, type, title, language, answers, rights, tags,
+	explanations, hint, reference, explanation_source, explanation_model, explanation_at,
+	source, status, status_at, suspended,
+	(SELECT COUNT(*) FROM question_flags f WHERE f.question_id = questions.id AND f.status = 'open') AS open_flags,
+	created_at, locale, COALESCE(group_id, id) AS group_key, workspace_id`
+
+func (r questionRow) toQuestion() (*Question, error) {
+	q := &Question{
+		ID:                r.ID,
+		Type:              r.Type,
+		Title:             r.Title,
+		Language:          r.Language,
+		Hint:              r.Hint,
+		Reference:         r.Reference,
+		ExplanationSource: r.ExplanationSource,
+		ExplanationModel:  r.ExplanationModel,
+		ExplanationAt:     r.ExplanationAt,
+		Source:            r.Source,
+		Status:            r.Status,
+		StatusAt:          r.StatusAt,
+		Suspended:         r.Suspended,
+		OpenFlags:         r.OpenFlags,
+		CreatedAt:         r.CreatedAt,
+		Locale:            r.Locale,
+		GroupID:           r.GroupID,
+		WorkspaceID:       r.WorkspaceID,
+	}
+	fields := []struct {
+		name string
+		raw  string
+		dest *[]string
+	}{
+		{"选项", r.Answers, &q.Answers},
+		{"答案", r.Rights, &q.Rights},
+		{"标签", r.Tags, &q.Tags},
+		{"解析", r.Explanations, &q.Explanations},
+	}
+	for _, f := range fields {
+		if f.raw == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(f.raw), f.dest); err != nil {
+			return nil, fmt.Errorf("题目%d%s解析失败: %w", r.ID, f.name, err)
+		}
+	}
+	return q, nil
+}
+
+// GetQuestion 按ID读取完整题目
+func (d *Database) GetQuestion(id int) (*Question, error) {
+	var row questionRow
+	if err := d.db.GetContext(d.ctx, &row, "SELECT "+questionColumnsSQL+" FROM questions WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return row.toQuestion()
+}
+
+// QuestionFilter 题目列表筛选条件
+type QuestionFilter struct {
+	WorkspaceID int // 只返回该工作区可见的题目（含共享进来的），0 表示不限
+	IDs         []int
+	Type        int
+	Locale      string
+	Language    string // 编程语言
+	Tag         string // 包含该标签
+}
+
+// ListQuestions 按条件读取完整题目（按ID升序）
+func (d *Database) ListQuestions(filter QuestionFilter) ([]Question, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.WorkspaceID != 0 {
+		conditions = append(conditions, VisibleInWorkspace)
+		args = append(args, filter.WorkspaceID, filter.WorkspaceID)
+	}
+	if len(filter.IDs) > 0 {
+		conditions = append(conditions, "id IN (?)")
+		args = append(args, filter.IDs)
+	}
+	if filter.Type != 0 {
+		conditions = append(conditions, "type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Locale != "" {
+		conditions = append(conditions, "locale = ?")
+		args = append(args, filter.Locale)
+	}
+	if filter.Language != "" {
+		conditions = append(conditions, "language = ?")
+		args = append(args, filter.Language)
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(tags) WHERE value = ?)")
+		args = append(args, filter.Tag)
+	}
+
+	query := "SELECT " + questionColumnsSQL + " FROM questions"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id"
+
+	query, args, err := sqlx.In(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []questionRow
+	if err := d.db.SelectContext(d.ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	questions := make([]Question, 0, len(rows))
+	for _, row := range rows {
+		q, err := row.toQuestion()
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, *q)
+	}
+	return questions, nil
+}
+
+// QuestionPage 题目分页查询条件
+type QuestionPage struct {
+	Type     int    // 0 表示全部题型
+	Search   string // 标题包含的关键词
+	Locale   string
+	Status   string // 为空时不含已归档的题目，all 表示全部状态
+	Page     int
+	PageSize int
+}
+
+// PageQuestions 工作区可见题目中的一页（按ID倒序）及符合条件的总数
+func (d *Database) PageQuestions(workspaceID int, page QuestionPage) ([]Question, int, error) {
+	conditions := []string{VisibleInWorkspace}
+	args := []interface{}{workspaceID, workspaceID}
+	if page.Type != 0 {
+		conditions = append(conditions, "type = ?")
+		args = append(args, page.Type)
+	}
+	if page.Search != "" {
+		conditions = append(conditions, "title LIKE ?")
+		args = append(args, "%"+page.Search+"%")
+	}
+	if page.Locale != "" {
+		conditions = append(conditions, "locale = ?")
+		args = append(args, page.Locale)
+	}
+	switch page.Status {
+	case "":
+		conditions = append(conditions, "status != ?")
+		args = append(args, config.StatusArchived)
+	case "all":
+	default:
+		conditions = append(conditions, "status = ?")
+		args = append(args, page.Status)
+	}
+	base := " FROM questions WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	if err := d.db.GetContext(d.ctx, &total, "SELECT COUNT(*)"+base, args...); err != nil {
+		return nil, 0, fmt.Errorf("获取总数失败: %w", err)
+	}
+	var rows []questionRow
+	args = append(args, page.PageSize, (page.Page-1)*page.PageSize)
+	if err := d.db.SelectContext(d.ctx, &rows, "SELECT "+questionColumnsSQL+base+" ORDER BY id DESC LIMIT ? OFFSET ?", args...); err != nil {
+		return nil, 0, fmt.Errorf("获取题目列表失败: %w", err)
+	}
+	questions := make([]Question, 0, len(rows))
+	for _, row := range rows {
+		q, err := row.toQuestion()
+		if err != nil {
+			return nil, 0, err
+		}
+		questions = append(questions, *q)
+	}
+	return questions, total, nil
+}
+
+// DeleteQuestions 删除本工作区的题目及其共享、反馈与修订记录并记录 question.deleted 事件，返回实际删除的ID
+func (d *Database) DeleteQuestions(workspaceID int, ids []int) ([]int, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted, err := ownedQuestions(d, tx, workspaceID, ids)
+	if err != nil || len(deleted) == 0 {
+		return deleted, err
+	}
+	for _, stmt := range []string{
+		`DELETE FROM question_shares WHERE question_id IN (?)`,
+		`DELETE FROM question_flags WHERE question_id IN (?)`,
+		`DELETE FROM question_revisions WHERE question_id IN (?)`,
+		`DELETE FROM questions WHERE id IN (?)`,
+	} {
+		query, args, _ := sqlx.In(stmt, deleted)
+		if _, err := tx.ExecContext(d.ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("删除题目失败: %w", err)
+		}
+	}
+	event := NewEvent(workspaceID, EventQuestionDeleted, deleted, map[string]interface{}{"count": len(deleted)})
+	if err := d.CommitWithEvent(tx, event); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const createQuizTableSQL = `
+CREATE TABLE IF NOT EXISTS quiz_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL DEFAULT 1,
+    code TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    host TEXT NOT NULL DEFAULT '',
+    question_ids TEXT NOT NULL,
+    seconds INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    current INTEGER NOT NULL DEFAULT -1,
+    created_at TEXT NOT NULL,
+    started_at TEXT NOT NULL DEFAULT '',
+    finished_at TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_quiz_sessions_workspace ON quiz_sessions(workspace_id);
+
+CREATE TABLE IF NOT EXISTS quiz_participants (
+    session_id INTEGER NOT NULL,
+    id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    student_id TEXT NOT NULL DEFAULT '',
+    score INTEGER NOT NULL DEFAULT 0,
+    correct INTEGER NOT NULL DEFAULT 0,
+    joined_at TEXT NOT NULL,
+    PRIMARY KEY (session_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS quiz_answers (
+    session_id INTEGER NOT NULL,
+    question_id INTEGER NOT NULL,
+    participant_id TEXT NOT NULL,
+    selected TEXT NOT NULL,
+    correct INTEGER NOT NULL,
+    points INTEGER NOT NULL,
+    elapsed_ms INTEGER NOT NULL,
+    answered_at TEXT NOT NULL,
+    PRIMARY KEY (session_id, question_id, participant_id)
+);
+`
+
+// 课堂测验状态
+const (
+	QuizWaiting     = "waiting"     // 等待学生加入
+	QuizRunning     = "running"     // 已开始答题
+	QuizFinished    = "finished"    // 教师结束或全部题目已完成
+	QuizInterrupted = "interrupted" // 服务退出或重启时仍未结束
+)
+
+// QuizSession 一场课堂实时测验
+type QuizSession struct {
+	ID          int    `json:"id" db:"id"`
+	WorkspaceID int    `json:"workspace_id" db:"workspace_id"`
+	Code        string `json:"code" db:"code"` // 学生加入时输入的短码，只在测验进行中有效
+	Title       string `json:"title" db:"title"`
+	Host        string `json:"host" db:"host"`
+	QuestionIDs []int  `json:"question_ids" db:"-"`
+	Seconds     int    `json:"seconds" db:"seconds"` // 每题作答时间
+	Status      string `json:"status" db:"status"`
+	Current     int    `json:"current" db:"current"` // 当前题目序号，从0开始，未开始为-1
+	CreatedAt   string `json:"created_at" db:"created_at"`
+	StartedAt   string `json:"started_at" db:"started_at"`
+	FinishedAt  string `json:"finished_at" db:"finished_at"`
+}
+
+// QuizParticipant 测验参与者及累计得分
+type QuizParticipant struct {
+	SessionID int    `json:"-" db:"session_id"`
+	ID        string `json:"id" db:"id"` // 重连时凭此恢复身份
+	Name      string `json:"name" db:"name"`
+	StudentID string `json:"student_id,omitempty" db:"student_id"` // 填写后作答计入学习记录
+	Score     int    `json:"score" db:"score"`
+	Correct   int    `json:"correct" db:"correct"`
+	JoinedAt  string `json:"joined_at" db:"joined_at"`
+}
+
+// QuizAnswer 参与者对一道题的作答
+type QuizAnswer struct {
+	SessionID     int      `json:"session_id" db:"session_id"`
+	QuestionID    int      `json:"question_id" db:"question_id"`
+	ParticipantID string   `json:"participant_id" db:"participant_id"`
+	Selected      []string `json:"selected" db:"-"`
+	Correct       bool     `json:"correct" db:"correct"`
+	Points        int      `json:"points" db:"points"`
+	ElapsedMs     int64    `json:"elapsed_ms" db:"elapsed_ms"`
+	AnsweredAt    string   `json:"answered_at" db:"answered_at"`
+}
+
+// QuizQuestionResult 一道题的作答统计，Distribution 为各选项被选择的人数
+type QuizQuestionResult struct {
+	QuestionID   int            `json:"question_id"`
+	Answered     int            `json:"answered"`
+	Correct      int            `json:"correct"`
+	Distribution map[string]int `json:"distribution"`
+}
+
+// QuizResults 测验结果：排行榜与逐题统计
+type QuizResults struct {
+	Session     *QuizSession         `json:"session"`
+	Leaderboard []QuizParticipant    `json:"leaderboard"`
+	Questions   []QuizQuestionResult `json:"questions"`
+}
+
+// quizSessionRow 数据库行，题目ID以JSON字符串存储
+type quizSessionRow struct {
+	QuizSession
+	QuestionIDsJSON string `db:"question_ids"`
+}
+
+func (r *quizSessionRow) toSession() (*QuizSession, error) {
+	s := r.QuizSession
+	if err := json.Unmarshal([]byte(r.QuestionIDsJSON), &s.QuestionIDs); err != nil {
+		return nil, fmt.Errorf("解析测验题目失败: %w", err)
+	}
+	return &s, nil
+}
+
+// CreateQuizSession 保存新测验并回填ID
+func (d *Database) CreateQuizSession(s *QuizSession) error {
+	ids, _ := json.Marshal(s.QuestionIDs)
+	s.CreatedAt = time.Now().Format(timeLayout)
+	err := d.db.QueryRowContext(d.ctx, `
+		INSERT INTO quiz_sessions (workspace_id, code, title, host, question_ids, seconds, status, current, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		s.WorkspaceID, s.Code, s.Title, s.Host, string(ids), s.Seconds, s.Status, s.Current, s.CreatedAt,
+	).Scan(&s.ID)
+	if err != nil {
+		return fmt.Errorf("创建测验失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateQuizSession 保存测验进度
+func (d *Database) UpdateQuizSession(s *QuizSession) error {
+	_, err := d.db.ExecContext(d.ctx, `
+		UPDATE quiz_sessions SET status = ?, current = ?, started_at = ?, finished_at = ? WHERE id = ?`,
+		s.Status, s.Current, s.StartedAt, s.FinishedAt, s.ID)
+	if err != nil {
+		return fmt.Errorf("更新测验失败: %w", err)
+	}
+	return nil
+}
+
+// GetQuizSession 查询工作区的测验，不存在时返回 nil
+func (d *Database) GetQuizSession(workspaceID, id int) (*QuizSession, error) {
+	var row quizSessionRow
+	err := d.db.GetContext(d.ctx, &row, `SELECT * FROM quiz_sessions WHERE id = ? AND workspace_id = ?`, id, workspaceID)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询测验失败: %w", err)
+	}
+	return row.toSession()
+}
+
+// ListQuizSessions 工作区最近的测验
+func (d *Database) ListQuizSessions(workspaceID, limit int) ([]QuizSession, error) {
+	var rows []quizSessionRow
+	err := d.db.SelectContext(d.ctx, &rows, `
+		SELECT * FROM quiz_sessions WHERE workspace_id = ? ORDER BY id DESC LIMIT ?`, workspaceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询测验失败: %w", err)
+	}
+	list := make([]QuizSession, 0, len(rows))
+	for i := range rows {
+		s, err := rows[i].toSession()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *s)
+	}
+	return list, nil
+}
+
+// AddQuizParticipant 记录加入测验的学生
+func (d *Database) AddQuizParticipant(p *QuizParticipant) error {
+	p.JoinedAt = time.Now().Format(timeLayout)
+	_, err := d.db.NamedExecContext(d.ctx, `
+		INSERT INTO quiz_participants (session_id, id, name, student_id, score, correct, joined_at)
+		VALUES (:session_id, :id, :name, :student_id, :score, :correct, :joined_at)`, p)
+	if err != nil {
+		return fmt.Errorf("保存参与者失败: %w", err)
+	}
+	return nil
+}
+
+// SaveQuizAnswer 在一个事务中保存作答、累加参与者得分；
+// 参与者填写了学号时同时写入作答记录并更新学习状态（与 /api/answers 相同）
+func (d *Database) SaveQuizAnswer(ans *QuizAnswer, studentID string) error {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 1. 作答明细，同一题重复提交由主键拒绝
+	selectedJSON, _ := json.Marshal(ans.Selected)
+	now := time.Now()
+	ans.AnsweredAt = now.Format(timeLayout)
+	_, err = tx.ExecContext(d.ctx, `
+		INSERT INTO quiz_answers (session_id, question_id, participant_id, selected, correct, points, elapsed_ms, answered_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		ans.SessionID, ans.QuestionID, ans.ParticipantID, string(selectedJSON), ans.Correct, ans.Points, ans.ElapsedMs, ans.AnsweredAt)
+	if err != nil {
+		return fmt.Errorf("保存作答失败: %w", err)
+	}
+
+	// 2. 累计得分
+	correct := 0
+	if ans.Correct {
+		correct = 1
+	}
+	_, err = tx.ExecContext(d.ctx, `
+		UPDATE quiz_participants SET score = score + ?, correct = correct + ? WHERE session_id = ? AND id = ?`,
+		ans.Points, correct, ans.SessionID, ans.ParticipantID)
+	if err != nil {
+		return fmt.Errorf("更新得分失败: %w", err)
+	}
+
+	// 3. 计入学生的作答记录
+	if studentID != "" {
+		rec := AnswerRecord{QuestionID: ans.QuestionID, StudentID: studentID, Selected: ans.Selected, Correct: ans.Correct}
+		_, err = tx.ExecContext(d.ctx, `
+			INSERT INTO answer_records (question_id, student_id, selected, correct, answered_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			rec.QuestionID, rec.StudentID, string(selectedJSON), rec.Correct, ans.AnsweredAt)
+		if err != nil {
+			return fmt.Errorf("写入作答记录失败: %w", err)
+		}
+		if err := applyLearning(tx, rec, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetQuizResults 测验排行榜（按得分、答对数降序）与逐题的作答分布
+func (d *Database) GetQuizResults(s *QuizSession) (*QuizResults, error) {
+	results := &QuizResults{Session: s, Leaderboard: []QuizParticipant{}}
+	err := d.db.SelectContext(d.ctx, &results.Leaderboard, `
+		SELECT * FROM quiz_participants WHERE session_id = ?
+		ORDER BY score DESC, correct DESC, joined_at, id`, s.ID)
+	if err != nil {
+		return nil, fmt.Errorf("查询参与者失败: %w", err)
+	}
+
+	var answers []struct {
+		QuestionID int    `db:"question_id"`
+		Selected   string `db:"selected"`
+		Correct    bool   `db:"correct"`
+	}
+	err = d.db.SelectContext(d.ctx, &answers, `
+		SELECT question_id, selected, correct FROM quiz_answers WHERE session_id = ?`, s.ID)
+	if err != nil {
+		return nil, fmt.Errorf("查询作答失败: %w", err)
+	}
+	byQuestion := make(map[int]*QuizQuestionResult, len(s.QuestionIDs))
+	results.Questions = make([]QuizQuestionResult, len(s.QuestionIDs))
+	for i, id := range s.QuestionIDs {
+		results.Questions[i] = QuizQuestionResult{QuestionID: id, Distribution: map[string]int{}}
+		byQuestion[id] = &results.Questions[i]
+	}
+	for _, a := range answers {
+		q, ok := byQuestion[a.QuestionID]
+		if !ok {
+			continue
+		}
+		q.Answered++
+		if a.Correct {
+			q.Correct++
+		}
+		var selected []string
+		_ = json.Unmarshal([]byte(a.Selected), &selected)
+		for _, opt := range selected {
+			q.Distribution[opt]++
+		}
+	}
+	return results, nil
+}
+
+// MarkInterruptedQuizSessions 启动时将上次未结束的测验标记为中断（房间只保存在内存中，无法继续）
+func (d *Database) MarkInterruptedQuizSessions() (int64, error) {
+	result, err := d.db.ExecContext(d.ctx, `
+		UPDATE quiz_sessions SET status = ?, finished_at = ?
+		WHERE status IN (?, ?)`, QuizInterrupted, time.Now().Format(timeLayout), QuizWaiting, QuizRunning)
+	if err != nil {
+		return 0, fmt.Errorf("标记中断的测验失败: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SortQuizLeaderboard 按得分、答对数降序排列，与 GetQuizResults 的顺序一致
+func SortQuizLeaderboard(list []QuizParticipant) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		if list[i].Correct != list[j].Correct {
+			return list[i].Correct > list[j].Correct
+		}
+		return list[i].JoinedAt < list[j].JoinedAt
+	})
+}
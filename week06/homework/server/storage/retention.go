@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"Server/config"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const createRetentionTableSQL = `
+CREATE TABLE IF NOT EXISTS retention_policies (
+    workspace_id INTEGER PRIMARY KEY,
+    enabled INTEGER NOT NULL DEFAULT 0,
+    archive_unused_months INTEGER NOT NULL DEFAULT 0,
+    purge_rejected_days INTEGER NOT NULL DEFAULT 0,
+    updated_by TEXT NOT NULL DEFAULT '',
+    updated_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL,
+    triggered_by TEXT NOT NULL,
+    archive_unused_months INTEGER NOT NULL,
+    purge_rejected_days INTEGER NOT NULL,
+    archived TEXT NOT NULL DEFAULT '[]',
+    purged TEXT NOT NULL DEFAULT '[]',
+    skipped INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    started_at TEXT NOT NULL,
+    finished_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_retention_runs_workspace ON retention_runs(workspace_id, id);
+`
+
+// 执行方式
+const (
+	RetentionScheduled = "schedule" // 后台定时执行
+	RetentionManual    = "manual"   // 通过接口手动执行
+)
+
+// QuestionStatuses 题目可以设置的状态
+var QuestionStatuses = []string{config.StatusActive, config.StatusDraft, config.StatusRejected, config.StatusArchived}
+
+// RetentionPolicy 工作区的题库清理策略，0 表示不执行对应的清理
+type RetentionPolicy struct {
+	WorkspaceID         int    `json:"workspace_id" db:"workspace_id"`
+	Enabled             bool   `json:"enabled" db:"enabled"`                             // 是否定时执行，关闭时仍可试运行与手动执行
+	ArchiveUnusedMonths int    `json:"archive_unused_months" db:"archive_unused_months"` // 归档超过 N 个月没有作答与提交的题目
+	PurgeRejectedDays   int    `json:"purge_rejected_days" db:"purge_rejected_days"`     // 删除被驳回超过 N 天的草稿
+	UpdatedBy           string `json:"updated_by" db:"updated_by"`
+	UpdatedAt           string `json:"updated_at" db:"updated_at"`
+}
+
+// RetentionCandidate 清理策略选中的题目
+type RetentionCandidate struct {
+	ID         int    `json:"id" db:"id"`
+	Title      string `json:"title" db:"title"`
+	Status     string `json:"status" db:"status"`
+	LastUsedAt string `json:"last_used_at" db:"last_used_at"` // 最近一次作答、提交、创建或状态变更的时间
+}
+
+// QuestionReference 引用题目的考试或测验
+type QuestionReference struct {
+	QuestionID int    `json:"question_id" db:"question_id"`
+	Kind       string `json:"kind" db:"kind"` // lti_exam/lti_practice/quiz
+	ID         int    `json:"id" db:"ref_id"`
+	Title      string `json:"title" db:"title"`
+}
+
+// RetentionRun 一次清理的执行记录
+type RetentionRun struct {
+	ID                  int    `json:"id" db:"id"`
+	WorkspaceID         int    `json:"workspace_id" db:"workspace_id"`
+	Trigger             string `json:"trigger" db:"triggered_by"`
+	ArchiveUnusedMonths int    `json:"archive_unused_months" db:"archive_unused_months"`
+	PurgeRejectedDays   int    `json:"purge_rejected_days" db:"purge_rejected_days"`
+	Archived            []int  `json:"archived" db:"-"`
+	Purged              []int  `json:"purged" db:"-"`
+	Skipped             int    `json:"skipped" db:"skipped"` // 被考试或测验引用而跳过的题目数
+	Error               string `json:"error" db:"error"`
+	StartedAt           string `json:"started_at" db:"started_at"`
+	FinishedAt          string `json:"finished_at" db:"finished_at"`
+}
+
+// GetRetentionPolicy 工作区的清理策略，未设置时返回未启用的空策略
+func (d *Database) GetRetentionPolicy(workspaceID int) (*RetentionPolicy, error) {
+	var p RetentionPolicy
+	err := d.db.GetContext(d.ctx, &p, `SELECT * FROM retention_policies WHERE workspace_id = ?`, workspaceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &RetentionPolicy{WorkspaceID: workspaceID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询清理策略失败: %w", err)
+	}
+	return &p, nil
+}
+
+// SaveRetentionPolicy 保存工作区的清理策略
+func (d *Database) SaveRetentionPolicy(p *RetentionPolicy) error {
+	p.UpdatedAt = time.Now().Format(timeLayout)
+	_, err := d.db.ExecContext(d.ctx, `
+		INSERT INTO retention_policies (workspace_id, enabled, archive_unused_months, purge_rejected_days, updated_by, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(workspace_id) DO UPDATE SET
+			enabled = excluded.enabled, archive_unused_months = excluded.archive_unused_months,
+			purge_rejected_days = excluded.purge_rejected_days, updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+		p.WorkspaceID, p.Enabled, p.ArchiveUnusedMonths, p.PurgeRejectedDays, p.UpdatedBy, p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("保存清理策略失败: %w", err)
+	}
+	return nil
+}
+
+// EnabledRetentionPolicies 启用了定时执行的清理策略
+func (d *Database) EnabledRetentionPolicies() ([]RetentionPolicy, error) {
+	policies := []RetentionPolicy{}
+	err := d.db.SelectContext(d.ctx, &policies, `
+		SELECT p.* FROM retention_policies p JOIN workspaces w ON w.id = p.workspace_id
+		WHERE p.enabled = 1 ORDER BY p.workspace_id`)
+	if err != nil {
+		return nil, fmt.Errorf("查询清理策略失败: %w", err)
+	}
+	return policies, nil
+}
+
+// ArchiveCandidates 本工作区中 before 之后没有使用过的正常题目。作答、代码提交、课堂测验作答、
+// 创建与状态变更都算作使用，共享到其他工作区后的作答也计入
+func (d *Database) ArchiveCandidates(workspaceID int, before time.Time) ([]RetentionCandidate, error) {
+	list := []RetentionCandidate{}
+	err := d.db.SelectContext(d.ctx, &list, `
+		SELECT id, title, status, last_used_at FROM (
+			SELECT q.id, q.title, q.status, MAX(
+				COALESCE(q.created_at, ''), q.status_at,
+				COALESCE((SELECT MAX(answered_at) FROM answer_records WHERE question_id = q.id), ''),
+				COALESCE((SELECT MAX(submitted_at) FROM code_submissions WHERE question_id = q.id), ''),
+				COALESCE((SELECT MAX(answered_at) FROM quiz_answers WHERE question_id = q.id), '')
+			) AS last_used_at
+			FROM questions q
+			WHERE q.workspace_id = ? AND q.status = ?
+		)
+		WHERE last_used_at < ?
+		ORDER BY id`, workspaceID, config.StatusActive, before.Format(timeLayout))
+	if err != nil {
+		return nil, fmt.Errorf("查询待归档题目失败: %w", err)
+	}
+	return list, nil
+}
+
+// RejectedCandidates 本工作区中在 before 之前被驳回的草稿
+func (d *Database) RejectedCandidates(workspaceID int, before time.Time) ([]RetentionCandidate, error) {
+	list := []RetentionCandidate{}
+	err := d.db.SelectContext(d.ctx, &list, `
+		SELECT id, title, status, COALESCE(NULLIF(status_at, ''), created_at, '') AS last_used_at
+		FROM questions
+		WHERE workspace_id = ? AND status = ? AND COALESCE(NULLIF(status_at, ''), created_at, '') < ?
+		ORDER BY id`, workspaceID, config.StatusRejected, before.Format(timeLayout))
+	if err != nil {
+		return nil, fmt.Errorf("查询待删除草稿失败: %w", err)
+	}
+	return list, nil
+}
+
+// QuestionReferences 本工作区的这些题目被哪些 LTI 活动（考试与练习）与未结束的课堂测验引用
+func (d *Database) QuestionReferences(workspaceID int, ids []int) ([]QuestionReference, error) {
+	refs := []QuestionReference{}
+	if len(ids) == 0 {
+		return refs, nil
+	}
+	query, args, err := sqlx.In(`
+		WITH owned AS (SELECT id FROM questions WHERE id IN (?) AND workspace_id = ?)
+		SELECT CAST(j.value AS INTEGER) AS question_id, 'lti_' || a.kind AS kind, a.id AS ref_id, a.title
+		FROM lti_activities a, json_each(a.question_ids) j
+		WHERE CAST(j.value AS INTEGER) IN (SELECT id FROM owned)
+		UNION ALL
+		SELECT CAST(j.value AS INTEGER), 'quiz', s.id, s.title
+		FROM quiz_sessions s, json_each(s.question_ids) j
+		WHERE s.status IN (?, ?) AND CAST(j.value AS INTEGER) IN (SELECT id FROM owned)
+		ORDER BY question_id, kind, ref_id`, ids, workspaceID, QuizWaiting, QuizRunning)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.db.SelectContext(d.ctx, &refs, query, args...); err != nil {
+		return nil, fmt.Errorf("查询题目引用失败: %w", err)
+	}
+	return refs, nil
+}
+
+// SetQuestionStatus 修改本工作区题目的状态并记录 question.status_changed 事件，返回实际修改的ID（状态未变的题目不计入）
+func (d *Database) SetQuestionStatus(workspaceID int, ids []int, status string) ([]int, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query, args, err := sqlx.In(`
+		UPDATE questions SET status = ?, status_at = ?
+		WHERE id IN (?) AND workspace_id = ? AND status != ?
+		RETURNING id`, status, time.Now().Format(timeLayout), ids, workspaceID, status)
+	if err != nil {
+		return nil, err
+	}
+	changed := []int{}
+	if err := tx.SelectContext(d.ctx, &changed, query, args...); err != nil {
+		return nil, fmt.Errorf("修改题目状态失败: %w", err)
+	}
+	if len(changed) == 0 {
+		return changed, nil
+	}
+	event := NewEvent(workspaceID, EventQuestionStatusChanged, changed, map[string]interface{}{"status": status, "count": len(changed)})
+	if err := d.CommitWithEvent(tx, event); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// retentionRunRow retention_runs 表中的一行
+type retentionRunRow struct {
+	RetentionRun
+	ArchivedJSON string `db:"archived"`
+	PurgedJSON   string `db:"purged"`
+}
+
+// CreateRetentionRun 记录一次清理，每个工作区只保留最近 keep 条
+func (d *Database) CreateRetentionRun(run *RetentionRun, keep int) error {
+	archived, _ := json.Marshal(run.Archived)
+	purged, _ := json.Marshal(run.Purged)
+	err := d.db.GetContext(d.ctx, &run.ID, `
+		INSERT INTO retention_runs (workspace_id, triggered_by, archive_unused_months, purge_rejected_days,
+			archived, purged, skipped, error, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		run.WorkspaceID, run.Trigger, run.ArchiveUnusedMonths, run.PurgeRejectedDays,
+		string(archived), string(purged), run.Skipped, run.Error, run.StartedAt, run.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("记录清理结果失败: %w", err)
+	}
+	_, err = d.db.ExecContext(d.ctx, `
+		DELETE FROM retention_runs WHERE workspace_id = ? AND id NOT IN (
+			SELECT id FROM retention_runs WHERE workspace_id = ? ORDER BY id DESC LIMIT ?)`,
+		run.WorkspaceID, run.WorkspaceID, keep)
+	return err
+}
+
+// ListRetentionRuns 工作区最近的清理记录（新的在前）
+func (d *Database) ListRetentionRuns(workspaceID, limit int) ([]RetentionRun, error) {
+	var rows []retentionRunRow
+	err := d.db.SelectContext(d.ctx, &rows, `
+		SELECT * FROM retention_runs WHERE workspace_id = ? ORDER BY id DESC LIMIT ?`, workspaceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询清理记录失败: %w", err)
+	}
+	runs := make([]RetentionRun, 0, len(rows))
+	for _, r := range rows {
+		run := r.RetentionRun
+		_ = json.Unmarshal([]byte(r.ArchivedJSON), &run.Archived)
+		_ = json.Unmarshal([]byte(r.PurgedJSON), &run.Purged)
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// LastRetentionRun 工作区最近一次按 trigger 方式执行清理的开始时间，没有记录时返回零值
+func (d *Database) LastRetentionRun(workspaceID int, trigger string) (time.Time, error) {
+	var startedAt string
+	err := d.db.GetContext(d.ctx, &startedAt, `
+		SELECT COALESCE(MAX(started_at), '') FROM retention_runs WHERE workspace_id = ? AND triggered_by = ?`,
+		workspaceID, trigger)
+	if err != nil || startedAt == "" {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation(timeLayout, startedAt, time.Local)
+}
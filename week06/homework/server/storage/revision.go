@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const createRevisionTableSQL = `
+CREATE TABLE IF NOT EXISTS question_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    question_id INTEGER NOT NULL,
+    workspace_id INTEGER NOT NULL,
+    type INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    language TEXT NOT NULL,
+    answers TEXT NOT NULL,
+    rights TEXT NOT NULL,
+    tags TEXT NOT NULL DEFAULT '[]',
+    explanations TEXT NOT NULL DEFAULT '[]',
+    hint TEXT NOT NULL DEFAULT '',
+    reference TEXT NOT NULL DEFAULT '',
+    edited_by TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_question_revisions_question ON question_revisions(question_id, id);
+`
+
+// QuestionRevision 一次修改前的题目内容，当前内容即题目本身
+type QuestionRevision struct {
+	ID           int      `json:"id"`
+	QuestionID   int      `json:"question_id"`
+	Type         int      `json:"type"`
+	Title        string   `json:"title"`
+	Language     string   `json:"language"`
+	Answers      []string `json:"answers"`
+	Rights       []string `json:"rights"`
+	Tags         []string `json:"tags"`
+	Explanations []string `json:"explanations"`
+	Hint         string   `json:"hint"`
+	Reference    string   `json:"reference"`
+	EditedBy     string   `json:"edited_by"`  // 做这次修改的用户
+	CreatedAt    string   `json:"created_at"` // 修改时间
+}
+
+type revisionRow struct {
+	ID           int    `db:"id"`
+	QuestionID   int    `db:"question_id"`
+	WorkspaceID  int    `db:"workspace_id"`
+	Type         int    `db:"type"`
+	Title        string `db:"title"`
+	Language     string `db:"language"`
+	Answers      string `db:"answers"`
+	Rights       string `db:"rights"`
+	Tags         string `db:"tags"`
+	Explanations string `db:"explanations"`
+	Hint         string `db:"hint"`
+	Reference    string `db:"reference"`
+	EditedBy     string `db:"edited_by"`
+	CreatedAt    string `db:"created_at"`
+}
+
+// saveRevision 在修改题目的事务中保存修改前的内容，题目不属于该工作区时不保存
+func saveRevision(d *Database, tx *sqlx.Tx, workspaceID, questionID int, editor string) error {
+	_, err := tx.ExecContext(d.ctx, `
+		INSERT INTO question_revisions (question_id, workspace_id, type, title, language, answers, rights,
+			tags, explanations, hint, reference, edited_by, created_at)
+		SELECT id, workspace_id, type, title, language, answers, rights, tags, explanations, hint, reference, ?, ?
+		FROM questions WHERE id = ? AND workspace_id = ?`,
+		editor, time.Now().Format(timeLayout), questionID, workspaceID)
+	if err != nil {
+		return fmt.Errorf("保存修订记录失败: %w", err)
+	}
+	return nil
+}
+
+// ListQuestionRevisions 题目的修订记录（新的在前）
+func (d *Database) ListQuestionRevisions(questionID, limit int) ([]QuestionRevision, error) {
+	var rows []revisionRow
+	err := d.db.SelectContext(d.ctx, &rows, `
+		SELECT * FROM question_revisions WHERE question_id = ? ORDER BY id DESC LIMIT ?`, questionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询修订记录失败: %w", err)
+	}
+	revisions := make([]QuestionRevision, 0, len(rows))
+	for _, r := range rows {
+		rev := QuestionRevision{
+			ID:         r.ID,
+			QuestionID: r.QuestionID,
+			Type:       r.Type,
+			Title:      r.Title,
+			Language:   r.Language,
+			Hint:       r.Hint,
+			Reference:  r.Reference,
+			EditedBy:   r.EditedBy,
+			CreatedAt:  r.CreatedAt,
+		}
+		for _, f := range []struct {
+			raw  string
+			dest *[]string
+		}{{r.Answers, &rev.Answers}, {r.Rights, &rev.Rights}, {r.Tags, &rev.Tags}, {r.Explanations, &rev.Explanations}} {
+			_ = json.Unmarshal([]byte(f.raw), f.dest)
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
@@ -17,17 +18,21 @@ type Storage interface {
 type JSONStorage struct {
 	basePath string
 	mu       sync.Mutex
+	closed   bool
 }
 
-func NewJSONStorage() *JSONStorage {
+func NewJSONStorage(dir string) *JSONStorage {
 	return &JSONStorage{
-		basePath: "log",
+		basePath: dir,
 	}
 }
 
 func (s *JSONStorage) Save(log config.AILog) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("日志存储已关闭")
+	}
 
 	// 创建目录
 	if err := os.MkdirAll(s.basePath, 0755); err != nil {
@@ -73,6 +78,72 @@ func (s *JSONStorage) Save(log config.AILog) error {
 	return nil
 }
 
+// Close 等待正在进行的写入完成，之后的写入直接返回错误
+func (s *JSONStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// ReadAll 读取日志目录下全部AI日志（按文件名即日期排序）
+func (s *JSONStorage) ReadAll() ([]config.AILog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(s.basePath, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("读取日志目录失败: %w", err)
+	}
+	sort.Strings(files)
+
+	var all []config.AILog
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取文件失败: %w", err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		var logs []config.AILog
+		if err := json.Unmarshal(data, &logs); err != nil {
+			return nil, fmt.Errorf("解析日志 %s 失败: %w", filepath.Base(file), err)
+		}
+		all = append(all, logs...)
+	}
+	return all, nil
+}
+
+// LogFile 一个AI日志文件的内容
+type LogFile struct {
+	Name string
+	Data []byte
+}
+
+// ReadFiles 读取日志目录下全部日志文件的原始内容（按文件名排序），
+// 与写入互斥，不会读到写了一半的文件
+func (s *JSONStorage) ReadFiles() ([]LogFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(s.basePath, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("读取日志目录失败: %w", err)
+	}
+	sort.Strings(files)
+
+	list := make([]LogFile, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取文件失败: %w", err)
+		}
+		list = append(list, LogFile{Name: filepath.Base(file), Data: data})
+	}
+	return list, nil
+}
+
 // 检查文件是否存在
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+const createSubmissionTableSQL = `
+CREATE TABLE IF NOT EXISTS code_submissions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    question_id INTEGER NOT NULL,
+    workspace_id INTEGER NOT NULL,
+    student_id TEXT NOT NULL,
+    language TEXT NOT NULL,
+    code TEXT NOT NULL,
+    submitted_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_code_submissions_question ON code_submissions(question_id, student_id);
+`
+
+// CodeSubmission 学生为编程题提交的代码
+type CodeSubmission struct {
+	ID          int    `json:"id" db:"id"`
+	QuestionID  int    `json:"question_id" db:"question_id"`
+	WorkspaceID int    `json:"workspace_id" db:"workspace_id"`
+	StudentID   string `json:"student_id" db:"student_id"`
+	Language    string `json:"language" db:"language"`
+	Code        string `json:"code,omitempty" db:"code"`
+	SubmittedAt string `json:"submitted_at" db:"submitted_at"`
+}
+
+// CreateCodeSubmission 保存一次代码提交，同一学生可以多次提交
+func (d *Database) CreateCodeSubmission(s *CodeSubmission) error {
+	s.SubmittedAt = time.Now().Format(timeLayout)
+	res, err := d.db.ExecContext(d.ctx, `
+		INSERT INTO code_submissions (question_id, workspace_id, student_id, language, code, submitted_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		s.QuestionID, s.WorkspaceID, s.StudentID, s.Language, s.Code, s.SubmittedAt)
+	if err != nil {
+		return fmt.Errorf("保存代码提交失败: %w", err)
+	}
+	id, _ := res.LastInsertId()
+	s.ID = int(id)
+	return nil
+}
+
+// ListCodeSubmissions 工作区内题目的代码提交，latest 为 true 时每个学生只保留最后一次；
+// studentID 不为空时只返回该学生的提交。按提交时间倒序。
+// 共享题目在各工作区的提交互不可见
+func (d *Database) ListCodeSubmissions(workspaceID, questionID int, studentID string, latest bool) ([]CodeSubmission, error) {
+	query := `SELECT * FROM code_submissions WHERE question_id = ? AND workspace_id = ?`
+	args := []interface{}{questionID, workspaceID}
+	if studentID != "" {
+		query += ` AND student_id = ?`
+		args = append(args, studentID)
+	}
+	if latest {
+		query += ` AND id IN (SELECT MAX(id) FROM code_submissions WHERE question_id = ? AND workspace_id = ? GROUP BY student_id)`
+		args = append(args, questionID, workspaceID)
+	}
+	list := []CodeSubmission{}
+	if err := d.db.SelectContext(d.ctx, &list, query+` ORDER BY id DESC`, args...); err != nil {
+		return nil, fmt.Errorf("查询代码提交失败: %w", err)
+	}
+	return list, nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestDB 在临时目录中创建数据库
+func newTestDB(t *testing.T) *Database {
+	t.Helper()
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestListCodeSubmissionsByWorkspace(t *testing.T) {
+	db := newTestDB(t)
+	// 题目7属于工作区1，共享给工作区2，两个工作区的学生都提交了代码
+	for _, s := range []CodeSubmission{
+		{QuestionID: 7, WorkspaceID: 1, StudentID: "alice", Code: "v1"},
+		{QuestionID: 7, WorkspaceID: 2, StudentID: "bob", Code: "v1"},
+		{QuestionID: 7, WorkspaceID: 1, StudentID: "alice", Code: "v2"},
+		{QuestionID: 7, WorkspaceID: 2, StudentID: "alice", Code: "v3"}, // 同一学生ID在另一个工作区
+		{QuestionID: 8, WorkspaceID: 1, StudentID: "alice", Code: "other"},
+	} {
+		s.Language = "go"
+		if err := db.CreateCodeSubmission(&s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	codes := func(workspaceID int, studentID string, latest bool) []string {
+		list, err := db.ListCodeSubmissions(workspaceID, 7, studentID, latest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, s := range list {
+			if s.WorkspaceID != workspaceID {
+				t.Errorf("workspace %d got submission %d of workspace %d", workspaceID, s.ID, s.WorkspaceID)
+			}
+			out = append(out, s.StudentID+":"+s.Code)
+		}
+		return out
+	}
+	for _, tt := range []struct {
+		workspaceID int
+		studentID   string
+		latest      bool
+		want        []string
+	}{
+		{1, "", false, []string{"alice:v2", "alice:v1"}},
+		{2, "", false, []string{"alice:v3", "bob:v1"}},
+		// 另一个工作区中较新的提交不影响本工作区的最后一次提交
+		{1, "", true, []string{"alice:v2"}},
+		{2, "", true, []string{"alice:v3", "bob:v1"}},
+		{2, "bob", false, []string{"bob:v1"}},
+		{1, "bob", true, nil},
+		{3, "", true, nil},
+	} {
+		if got := codes(tt.workspaceID, tt.studentID, tt.latest); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("workspace %d student %q latest %v: got %v, want %v", tt.workspaceID, tt.studentID, tt.latest, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const createTemplateTableSQL = `
+CREATE TABLE IF NOT EXISTS question_templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL DEFAULT 1,
+    type INTEGER NOT NULL,
+    language TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL,
+    spec TEXT NOT NULL,
+    tags TEXT NOT NULL DEFAULT '[]',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_question_templates_workspace ON question_templates(workspace_id);
+
+CREATE TABLE IF NOT EXISTS template_variants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    template_id INTEGER NOT NULL,
+    workspace_id INTEGER NOT NULL,
+    student_id TEXT NOT NULL DEFAULT '',
+    context TEXT NOT NULL,
+    paper TEXT NOT NULL DEFAULT '',
+    seed INTEGER NOT NULL,
+    signature TEXT NOT NULL,
+    content TEXT NOT NULL,
+    selected TEXT NOT NULL DEFAULT '',
+    correct INTEGER,
+    answered_at TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_template_variants_student ON template_variants(template_id, student_id);
+`
+
+// 题目实例的使用场景
+const (
+	VariantPractice = "practice"
+	VariantExam     = "exam"
+)
+
+// TemplateVariable 模板变量的取值范围：values 不为空时从中选取，否则为 [min, max] 内按 step 递增的整数
+type TemplateVariable struct {
+	Name   string        `json:"name"`
+	Min    int           `json:"min,omitempty"`
+	Max    int           `json:"max,omitempty"`
+	Step   int           `json:"step,omitempty"` // 默认为1
+	Values []interface{} `json:"values,omitempty"`
+}
+
+// TemplateSpec 模板中生成题目实例所需的部分，整体以JSON保存
+type TemplateSpec struct {
+	Variables    []TemplateVariable `json:"variables"`
+	Constraints  []string           `json:"constraints"`  // 取值必须同时满足的条件，如 "m >= n"
+	Answer       string             `json:"answer"`       // 正确选项，可包含 {{公式}}
+	Distractors  []string           `json:"distractors"`  // 干扰项
+	Explanations []string           `json:"explanations"` // 依次对应正确选项与各干扰项
+	Hint         string             `json:"hint"`
+}
+
+// QuestionTemplate 参数化题目模板：标题与选项中的 {{公式}} 按变量取值替换后得到题目实例
+type QuestionTemplate struct {
+	ID          int    `json:"id"`
+	WorkspaceID int    `json:"workspace_id"`
+	Type        int    `json:"type"`
+	Language    string `json:"language"`
+	Title       string `json:"title"`
+	TemplateSpec
+	Tags      []string `json:"tags"`
+	CreatedBy string   `json:"created_by"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// TemplateVariant 发给学生或写入试卷的一个题目实例，保存生成时的完整内容，之后修改模板不影响判分
+type TemplateVariant struct {
+	ID           int                    `json:"id"`
+	TemplateID   int                    `json:"template_id"`
+	WorkspaceID  int                    `json:"workspace_id"`
+	StudentID    string                 `json:"student_id,omitempty"`
+	Context      string                 `json:"context"`         // practice/exam
+	Paper        string                 `json:"paper,omitempty"` // 试卷中的实例：A/B/C/D卷
+	Seed         int64                  `json:"seed"`
+	Signature    string                 `json:"-"` // 变量取值的规范化表示，用于判断实例是否重复
+	Values       map[string]interface{} `json:"values"`
+	Title        string                 `json:"title"`
+	Answers      []string               `json:"answers"`
+	Rights       []string               `json:"rights"`
+	Explanations []string               `json:"explanations"`
+	Hint         string                 `json:"hint"`
+	Selected     []string               `json:"selected,omitempty"`
+	Correct      *bool                  `json:"correct,omitempty"` // 未作答时为空
+	AnsweredAt   string                 `json:"answered_at,omitempty"`
+	CreatedAt    string                 `json:"created_at"`
+}
+
+// templateRow 数据库行，spec 与标签以JSON字符串存储
+type templateRow struct {
+	ID          int    `db:"id"`
+	WorkspaceID int    `db:"workspace_id"`
+	Type        int    `db:"type"`
+	Language    string `db:"language"`
+	Title       string `db:"title"`
+	Spec        string `db:"spec"`
+	Tags        string `db:"tags"`
+	CreatedBy   string `db:"created_by"`
+	CreatedAt   string `db:"created_at"`
+	UpdatedAt   string `db:"updated_at"`
+}
+
+func (r templateRow) toTemplate() (*QuestionTemplate, error) {
+	t := &QuestionTemplate{
+		ID:          r.ID,
+		WorkspaceID: r.WorkspaceID,
+		Type:        r.Type,
+		Language:    r.Language,
+		Title:       r.Title,
+		CreatedBy:   r.CreatedBy,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+	if err := json.Unmarshal([]byte(r.Spec), &t.TemplateSpec); err != nil {
+		return nil, fmt.Errorf("模板%d解析失败: %w", r.ID, err)
+	}
+	if err := json.Unmarshal([]byte(r.Tags), &t.Tags); err != nil {
+		return nil, fmt.Errorf("模板%d标签解析失败: %w", r.ID, err)
+	}
+	return t, nil
+}
+
+// variantContent 题目实例中以JSON保存的内容
+type variantContent struct {
+	Values       map[string]interface{} `json:"values"`
+	Title        string                 `json:"title"`
+	Answers      []string               `json:"answers"`
+	Rights       []string               `json:"rights"`
+	Explanations []string               `json:"explanations"`
+	Hint         string                 `json:"hint"`
+}
+
+type variantRow struct {
+	ID          int    `db:"id"`
+	TemplateID  int    `db:"template_id"`
+	WorkspaceID int    `db:"workspace_id"`
+	StudentID   string `db:"student_id"`
+	Context     string `db:"context"`
+	Paper       string `db:"paper"`
+	Seed        int64  `db:"seed"`
+	Signature   string `db:"signature"`
+	Content     string `db:"content"`
+	Selected    string `db:"selected"`
+	Correct     *bool  `db:"correct"`
+	AnsweredAt  string `db:"answered_at"`
+	CreatedAt   string `db:"created_at"`
+}
+
+func (r variantRow) toVariant() (*TemplateVariant, error) {
+	v := &TemplateVariant{
+		ID:          r.ID,
+		TemplateID:  r.TemplateID,
+		WorkspaceID: r.WorkspaceID,
+		StudentID:   r.StudentID,
+		Context:     r.Context,
+		Paper:       r.Paper,
+		Seed:        r.Seed,
+		Signature:   r.Signature,
+		Correct:     r.Correct,
+		AnsweredAt:  r.AnsweredAt,
+		CreatedAt:   r.CreatedAt,
+	}
+	var content variantContent
+	if err := json.Unmarshal([]byte(r.Content), &content); err != nil {
+		return nil, fmt.Errorf("题目实例%d解析失败: %w", r.ID, err)
+	}
+	v.Values, v.Title, v.Answers, v.Rights = content.Values, content.Title, content.Answers, content.Rights
+	v.Explanations, v.Hint = content.Explanations, content.Hint
+	if r.Selected != "" {
+		_ = json.Unmarshal([]byte(r.Selected), &v.Selected)
+	}
+	return v, nil
+}
+
+// CreateTemplate 保存新模板并回填ID
+func (d *Database) CreateTemplate(t *QuestionTemplate) error {
+	spec, _ := json.Marshal(t.TemplateSpec)
+	t.CreatedAt = time.Now().Format(timeLayout)
+	t.UpdatedAt = t.CreatedAt
+	err := d.db.QueryRowContext(d.ctx, `
+		INSERT INTO question_templates (workspace_id, type, language, title, spec, tags, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		t.WorkspaceID, t.Type, t.Language, t.Title, string(spec), MarshalTags(t.Tags), t.CreatedBy, t.CreatedAt, t.UpdatedAt,
+	).Scan(&t.ID)
+	if err != nil {
+		return fmt.Errorf("保存模板失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateTemplate 修改模板，已生成的题目实例不受影响
+func (d *Database) UpdateTemplate(t *QuestionTemplate) error {
+	spec, _ := json.Marshal(t.TemplateSpec)
+	t.UpdatedAt = time.Now().Format(timeLayout)
+	_, err := d.db.ExecContext(d.ctx, `
+		UPDATE question_templates SET type = ?, language = ?, title = ?, spec = ?, tags = ?, updated_at = ?
+		WHERE id = ? AND workspace_id = ?`,
+		t.Type, t.Language, t.Title, string(spec), MarshalTags(t.Tags), t.UpdatedAt, t.ID, t.WorkspaceID)
+	if err != nil {
+		return fmt.Errorf("更新模板失败: %w", err)
+	}
+	return nil
+}
+
+// GetTemplate 查询工作区的模板，workspaceID 为0时不限工作区（练习接口），不存在时返回 nil
+func (d *Database) GetTemplate(workspaceID, id int) (*QuestionTemplate, error) {
+	var row templateRow
+	err := d.db.GetContext(d.ctx, &row, `
+		SELECT * FROM question_templates WHERE id = ? AND (? = 0 OR workspace_id = ?)`, id, workspaceID, workspaceID)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询模板失败: %w", err)
+	}
+	return row.toTemplate()
+}
+
+// ListTemplates 工作区的模板，ids 不为空时只返回这些模板（按ID升序）
+func (d *Database) ListTemplates(workspaceID int, ids []int) ([]QuestionTemplate, error) {
+	query, args := `SELECT * FROM question_templates WHERE workspace_id = ? ORDER BY id`, []interface{}{workspaceID}
+	if len(ids) > 0 {
+		var err error
+		query, args, err = sqlx.In(`SELECT * FROM question_templates WHERE workspace_id = ? AND id IN (?) ORDER BY id`, workspaceID, ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var rows []templateRow
+	if err := d.db.SelectContext(d.ctx, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("查询模板失败: %w", err)
+	}
+	list := make([]QuestionTemplate, 0, len(rows))
+	for _, row := range rows {
+		t, err := row.toTemplate()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, nil
+}
+
+// DeleteTemplate 删除模板，已生成的题目实例保留（作为作答记录）
+func (d *Database) DeleteTemplate(workspaceID, id int) (bool, error) {
+	result, err := d.db.ExecContext(d.ctx, `DELETE FROM question_templates WHERE id = ? AND workspace_id = ?`, id, workspaceID)
+	if err != nil {
+		return false, fmt.Errorf("删除模板失败: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// SaveTemplateVariants 在一个事务中记录生成的题目实例并回填ID
+func (d *Database) SaveTemplateVariants(variants []*TemplateVariant) error {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format(timeLayout)
+	for _, v := range variants {
+		content, _ := json.Marshal(variantContent{
+			Values:       v.Values,
+			Title:        v.Title,
+			Answers:      v.Answers,
+			Rights:       v.Rights,
+			Explanations: v.Explanations,
+			Hint:         v.Hint,
+		})
+		v.CreatedAt = now
+		err := tx.QueryRowContext(d.ctx, `
+			INSERT INTO template_variants (template_id, workspace_id, student_id, context, paper, seed, signature, content, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id`,
+			v.TemplateID, v.WorkspaceID, v.StudentID, v.Context, v.Paper, v.Seed, v.Signature, string(content), now,
+		).Scan(&v.ID)
+		if err != nil {
+			return fmt.Errorf("记录题目实例失败: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTemplateVariant 按ID查询题目实例，不存在时返回 nil
+func (d *Database) GetTemplateVariant(id int) (*TemplateVariant, error) {
+	var row variantRow
+	err := d.db.GetContext(d.ctx, &row, `SELECT * FROM template_variants WHERE id = ?`, id)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询题目实例失败: %w", err)
+	}
+	return row.toVariant()
+}
+
+// ListTemplateVariants 模板生成过的实例，studentID 不为空时只返回该学生的，最新的在前
+func (d *Database) ListTemplateVariants(templateID int, studentID string, limit int) ([]TemplateVariant, error) {
+	query := `SELECT * FROM template_variants WHERE template_id = ?`
+	args := []interface{}{templateID}
+	if studentID != "" {
+		query += ` AND student_id = ?`
+		args = append(args, studentID)
+	}
+	var rows []variantRow
+	err := d.db.SelectContext(d.ctx, &rows, query+` ORDER BY id DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("查询题目实例失败: %w", err)
+	}
+	list := make([]TemplateVariant, 0, len(rows))
+	for _, row := range rows {
+		v, err := row.toVariant()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *v)
+	}
+	return list, nil
+}
+
+// StudentVariantSignatures 学生做过的该模板实例的取值，用于给学生生成没见过的实例
+func (d *Database) StudentVariantSignatures(templateID int, studentID string) (map[string]bool, error) {
+	var signatures []string
+	err := d.db.SelectContext(d.ctx, &signatures, `
+		SELECT DISTINCT signature FROM template_variants WHERE template_id = ? AND student_id = ?`, templateID, studentID)
+	if err != nil {
+		return nil, fmt.Errorf("查询题目实例失败: %w", err)
+	}
+	seen := make(map[string]bool, len(signatures))
+	for _, s := range signatures {
+		seen[s] = true
+	}
+	return seen, nil
+}
+
+// AnswerTemplateVariant 记录实例的作答结果，每个实例只能作答一次，已作答时返回 false
+func (d *Database) AnswerTemplateVariant(id int, selected []string, correct bool) (bool, error) {
+	selectedJSON, _ := json.Marshal(selected)
+	result, err := d.db.ExecContext(d.ctx, `
+		UPDATE template_variants SET selected = ?, correct = ?, answered_at = ?
+		WHERE id = ? AND answered_at = ''`,
+		string(selectedJSON), correct, time.Now().Format(timeLayout), id)
+	if err != nil {
+		return false, fmt.Errorf("保存作答失败: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"Server/config"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ErrOriginalLocale 目标语言与原题相同，译本不能覆盖原题
+var ErrOriginalLocale = errors.New("目标语言与原题相同")
+
+// ListVariants 读取同一组内的全部语言版本（原题在前）
+func (d *Database) ListVariants(groupID int) ([]Question, error) {
+	var rows []questionRow
+	if err := d.db.SelectContext(d.ctx, &rows, `
+		SELECT `+questionColumnsSQL+`
+		FROM questions
+		WHERE COALESCE(group_id, id) = ?
+		ORDER BY id`, groupID); err != nil {
+		return nil, err
+	}
+
+	variants := make([]Question, 0, len(rows))
+	for _, row := range rows {
+		q, err := row.toQuestion()
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, *q)
+	}
+	return variants, nil
+}
+
+// SaveVariant 保存题目译本：同组已有该语言的译本时覆盖，否则新增一行并关联到原题。
+// 原题不会被覆盖，目标语言与原题相同时返回 ErrOriginalLocale。
+// 题型、编程语言、答案与标签均沿用原题，保证各版本答案一致
+func (d *Database) SaveVariant(src *Question, locale string, tr *config.Translation, model string) (int, bool, error) {
+	var originalLocale string
+	if err := d.db.GetContext(d.ctx, &originalLocale, `SELECT locale FROM questions WHERE id = ?`, src.GroupID); err != nil {
+		return 0, false, err
+	}
+	if originalLocale == locale {
+		return 0, false, ErrOriginalLocale
+	}
+
+	var existing int
+	err := d.db.GetContext(d.ctx, &existing, `
+		SELECT id FROM questions
+		WHERE group_id = ? AND locale = ?
+		LIMIT 1`, src.GroupID, locale)
+	if err != nil && !isNoRows(err) {
+		return 0, false, err
+	}
+
+	rightsJSON := marshalStrings(src.Rights)
+	if existing > 0 {
+		_, err := d.db.ExecContext(d.ctx, `
+			UPDATE questions SET
+				title = ?, answers = ?, rights = ?, explanations = ?, hint = ?,
+				explanation_model = ?, explanation_at = datetime('now', 'localtime')
+			WHERE id = ?`,
+			tr.Title, marshalStrings(tr.Answers), rightsJSON, marshalStrings(tr.Explanations), tr.Hint,
+			model, existing)
+		return existing, false, err
+	}
+
+	var id int
+	err = d.db.QueryRowContext(d.ctx, `
+		INSERT INTO questions
+		(title, type, language, answers, rights, tags, source, status, created_at,
+		 explanations, hint, reference, explanation_source, explanation_model, explanation_at,
+		 locale, group_id, workspace_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, datetime('now', 'localtime'),
+		 ?, ?, ?, ?, ?, datetime('now', 'localtime'), ?, ?, ?)
+		RETURNING id`,
+		tr.Title, src.Type, src.Language, marshalStrings(tr.Answers), rightsJSON,
+		MarshalTags(src.Tags), config.SourceTranslation, src.Status,
+		marshalStrings(tr.Explanations), tr.Hint, src.Reference, src.ExplanationSource, model,
+		locale, src.GroupID, src.WorkspaceID,
+	).Scan(&id)
+	return id, true, err
+}
+
+// SyncVariantRights 将题目的题型与答案同步到同组其他语言版本，返回同步的行数
+func (d *Database) SyncVariantRights(id int) (int64, error) {
+	result, err := d.db.ExecContext(d.ctx, `
+		UPDATE questions SET
+			type = (SELECT type FROM questions WHERE id = ?),
+			rights = (SELECT rights FROM questions WHERE id = ?)
+		WHERE COALESCE(group_id, id) = (SELECT COALESCE(group_id, id) FROM questions WHERE id = ?)
+		  AND id != ?`, id, id, id, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CheckVariantConsistency 校验同组各版本的题型、选项数量与答案是否一致，返回不一致说明
+func CheckVariantConsistency(variants []Question) []string {
+	var problems []string
+	if len(variants) < 2 {
+		return problems
+	}
+
+	base := variants[0]
+	baseRights := sortedCopy(base.Rights)
+	for _, v := range variants[1:] {
+		if v.Type != base.Type {
+			problems = append(problems, fmt.Sprintf("题目%d(%s)题型为%d，与题目%d不一致", v.ID, v.Locale, v.Type, base.ID))
+		}
+		if len(v.Answers) != len(base.Answers) {
+			problems = append(problems, fmt.Sprintf("题目%d(%s)有%d个选项，与题目%d的%d个不一致",
+				v.ID, v.Locale, len(v.Answers), base.ID, len(base.Answers)))
+		}
+		if !reflect.DeepEqual(sortedCopy(v.Rights), baseRights) {
+			problems = append(problems, fmt.Sprintf("题目%d(%s)答案为%v，与题目%d的%v不一致",
+				v.ID, v.Locale, v.Rights, base.ID, base.Rights))
+		}
+	}
+	return problems
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
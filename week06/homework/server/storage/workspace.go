@@ -0,0 +1,426 @@
+package storage
+
+import (
+	"Server/config"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const createWorkspaceTableSQL = `
+CREATE TABLE IF NOT EXISTS workspaces (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    allowed_languages TEXT NOT NULL DEFAULT '[]',
+    default_model TEXT NOT NULL DEFAULT '',
+    max_questions INTEGER NOT NULL DEFAULT 0,
+    daily_ai_requests INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id INTEGER NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL,
+    added_at TEXT NOT NULL,
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS question_shares (
+    question_id INTEGER NOT NULL,
+    workspace_id INTEGER NOT NULL,
+    shared_at TEXT NOT NULL,
+    PRIMARY KEY (question_id, workspace_id)
+);
+
+CREATE TABLE IF NOT EXISTS workspace_usage (
+    workspace_id INTEGER NOT NULL,
+    day TEXT NOT NULL,
+    ai_requests INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (workspace_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_questions_workspace ON questions(workspace_id);
+CREATE INDEX IF NOT EXISTS idx_question_shares_workspace ON question_shares(workspace_id);
+
+INSERT OR IGNORE INTO workspaces (id, slug, name, created_at)
+VALUES (1, 'default', '默认工作区', datetime('now', 'localtime'));
+`
+
+// DefaultWorkspaceID 未指定工作区的请求与旧数据所属的工作区
+const DefaultWorkspaceID = 1
+
+// 成员角色
+const (
+	RoleOwner  = "owner"  // 管理成员与设置，读写题目
+	RoleEditor = "editor" // 读写题目、AI出题
+	RoleViewer = "viewer" // 只读
+)
+
+// WorkspaceSettings 工作区设置，零值表示不限制
+type WorkspaceSettings struct {
+	AllowedLanguages []string `json:"allowed_languages"` // 允许的编程语言，为空表示不限
+	DefaultModel     string   `json:"default_model"`     // 未指定模型时使用的AI服务，为空时使用全局默认
+	MaxQuestions     int      `json:"max_questions"`     // 题目数上限（不含共享进来的题目）
+	DailyAIRequests  int      `json:"daily_ai_requests"` // 每天AI出题调用次数上限
+}
+
+// Workspace 课程或班级的独立题库
+type Workspace struct {
+	ID        int               `json:"id" db:"id"`
+	Slug      string            `json:"slug" db:"slug"`
+	Name      string            `json:"name" db:"name"`
+	Settings  WorkspaceSettings `json:"settings" db:"-"`
+	CreatedAt string            `json:"created_at" db:"created_at"`
+}
+
+// WorkspaceMember 工作区成员
+type WorkspaceMember struct {
+	UserID  string `json:"user_id" db:"user_id"`
+	Role    string `json:"role" db:"role"`
+	AddedAt string `json:"added_at" db:"added_at"`
+}
+
+// workspaceRow workspaces 表中的一行
+type workspaceRow struct {
+	Workspace
+	AllowedLanguages string `db:"allowed_languages"`
+	DefaultModel     string `db:"default_model"`
+	MaxQuestions     int    `db:"max_questions"`
+	DailyAIRequests  int    `db:"daily_ai_requests"`
+}
+
+func (r workspaceRow) workspace() Workspace {
+	ws := r.Workspace
+	ws.Settings = WorkspaceSettings{
+		DefaultModel:    r.DefaultModel,
+		MaxQuestions:    r.MaxQuestions,
+		DailyAIRequests: r.DailyAIRequests,
+	}
+	_ = json.Unmarshal([]byte(r.AllowedLanguages), &ws.Settings.AllowedLanguages)
+	if ws.Settings.AllowedLanguages == nil {
+		ws.Settings.AllowedLanguages = []string{}
+	}
+	return ws
+}
+
+// VisibleInWorkspace 工作区可见题目的条件：本工作区的题目与共享进来的题目，参数为工作区ID两次
+const VisibleInWorkspace = `(workspace_id = ? OR id IN (SELECT question_id FROM question_shares WHERE workspace_id = ?))`
+
+// GetVisibleQuestion 查询工作区可见的题目，不存在或不可见时返回 sql.ErrNoRows
+func (d *Database) GetVisibleQuestion(workspaceID, id int) (*Question, error) {
+	var row questionRow
+	err := d.db.GetContext(d.ctx, &row,
+		"SELECT "+questionColumnsSQL+" FROM questions WHERE id = ? AND "+VisibleInWorkspace, id, workspaceID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	return row.toQuestion()
+}
+
+// CreateWorkspace 创建工作区，owner 成为第一个成员
+func (d *Database) CreateWorkspace(ws *Workspace, owner string) error {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ws.CreatedAt = time.Now().Format(timeLayout)
+	s := ws.Settings
+	err = tx.QueryRowContext(d.ctx, `
+		INSERT INTO workspaces (slug, name, allowed_languages, default_model, max_questions, daily_ai_requests, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		ws.Slug, ws.Name, marshalStrings(s.AllowedLanguages), s.DefaultModel, s.MaxQuestions, s.DailyAIRequests, ws.CreatedAt,
+	).Scan(&ws.ID)
+	if err != nil {
+		return fmt.Errorf("创建工作区失败: %w", err)
+	}
+	if _, err := tx.ExecContext(d.ctx, `
+		INSERT INTO workspace_members (workspace_id, user_id, role, added_at) VALUES (?, ?, ?, ?)`,
+		ws.ID, owner, RoleOwner, ws.CreatedAt); err != nil {
+		return fmt.Errorf("添加成员失败: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetWorkspace 按ID查询工作区，不存在时返回 nil
+func (d *Database) GetWorkspace(id int) (*Workspace, error) {
+	return d.getWorkspace(`SELECT * FROM workspaces WHERE id = ?`, id)
+}
+
+// GetWorkspaceBySlug 按标识查询工作区，不存在时返回 nil
+func (d *Database) GetWorkspaceBySlug(slug string) (*Workspace, error) {
+	return d.getWorkspace(`SELECT * FROM workspaces WHERE slug = ?`, slug)
+}
+
+func (d *Database) getWorkspace(query string, arg interface{}) (*Workspace, error) {
+	var row workspaceRow
+	err := d.db.GetContext(d.ctx, &row, query, arg)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询工作区失败: %w", err)
+	}
+	ws := row.workspace()
+	return &ws, nil
+}
+
+// ListWorkspaces 所有工作区
+func (d *Database) ListWorkspaces() ([]Workspace, error) {
+	var rows []workspaceRow
+	if err := d.db.SelectContext(d.ctx, &rows, `SELECT * FROM workspaces ORDER BY id`); err != nil {
+		return nil, fmt.Errorf("查询工作区失败: %w", err)
+	}
+	list := make([]Workspace, 0, len(rows))
+	for _, row := range rows {
+		list = append(list, row.workspace())
+	}
+	return list, nil
+}
+
+// UpdateWorkspace 修改名称与设置
+func (d *Database) UpdateWorkspace(ws *Workspace) error {
+	s := ws.Settings
+	_, err := d.db.ExecContext(d.ctx, `
+		UPDATE workspaces SET name = ?, allowed_languages = ?, default_model = ?, max_questions = ?, daily_ai_requests = ?
+		WHERE id = ?`,
+		ws.Name, marshalStrings(s.AllowedLanguages), s.DefaultModel, s.MaxQuestions, s.DailyAIRequests, ws.ID)
+	if err != nil {
+		return fmt.Errorf("更新工作区失败: %w", err)
+	}
+	return nil
+}
+
+// WorkspaceMembers 工作区成员，没有成员的工作区对所有人开放
+func (d *Database) WorkspaceMembers(workspaceID int) ([]WorkspaceMember, error) {
+	members := []WorkspaceMember{}
+	err := d.db.SelectContext(d.ctx, &members, `
+		SELECT user_id, role, added_at FROM workspace_members
+		WHERE workspace_id = ? ORDER BY added_at, user_id`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("查询成员失败: %w", err)
+	}
+	return members, nil
+}
+
+// MemberRole 用户在工作区的角色；open 表示工作区没有成员（对所有人开放）
+func (d *Database) MemberRole(workspaceID int, userID string) (role string, open bool, err error) {
+	var rows []WorkspaceMember
+	if err := d.db.SelectContext(d.ctx, &rows, `
+		SELECT user_id, role, added_at FROM workspace_members WHERE workspace_id = ?`, workspaceID); err != nil {
+		return "", false, fmt.Errorf("查询成员失败: %w", err)
+	}
+	for _, m := range rows {
+		if m.UserID == userID {
+			return m.Role, false, nil
+		}
+	}
+	return "", len(rows) == 0, nil
+}
+
+// SetMember 添加成员或修改角色
+func (d *Database) SetMember(workspaceID int, userID, role string) error {
+	_, err := d.db.ExecContext(d.ctx, `
+		INSERT INTO workspace_members (workspace_id, user_id, role, added_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(workspace_id, user_id) DO UPDATE SET role = excluded.role`,
+		workspaceID, userID, role, time.Now().Format(timeLayout))
+	if err != nil {
+		return fmt.Errorf("保存成员失败: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember 移除成员，返回是否存在
+func (d *Database) RemoveMember(workspaceID int, userID string) (bool, error) {
+	result, err := d.db.ExecContext(d.ctx, `
+		DELETE FROM workspace_members WHERE workspace_id = ? AND user_id = ?`, workspaceID, userID)
+	if err != nil {
+		return false, fmt.Errorf("移除成员失败: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// CountOwners 工作区的所有者人数，用于防止移除最后一个所有者
+func (d *Database) CountOwners(workspaceID int) (int, error) {
+	var n int
+	err := d.db.GetContext(d.ctx, &n, `
+		SELECT COUNT(*) FROM workspace_members WHERE workspace_id = ? AND role = ?`, workspaceID, RoleOwner)
+	return n, err
+}
+
+// WorkspaceUsage 工作区的题目数、共享进来的题目数与今天的AI出题调用次数
+type WorkspaceUsage struct {
+	Questions       int `json:"questions" db:"questions"` // 不含已归档的题目
+	Archived        int `json:"archived" db:"archived"`
+	SharedIn        int `json:"shared_in" db:"shared_in"`
+	AIRequestsToday int `json:"ai_requests_today" db:"ai_requests_today"`
+}
+
+// GetWorkspaceUsage 统计工作区的用量
+func (d *Database) GetWorkspaceUsage(workspaceID int) (WorkspaceUsage, error) {
+	var usage WorkspaceUsage
+	err := d.db.GetContext(d.ctx, &usage, `
+		SELECT
+			(SELECT COUNT(*) FROM questions WHERE workspace_id = ? AND status != ?) AS questions,
+			(SELECT COUNT(*) FROM questions WHERE workspace_id = ? AND status = ?) AS archived,
+			(SELECT COUNT(*) FROM question_shares WHERE workspace_id = ?) AS shared_in,
+			COALESCE((SELECT ai_requests FROM workspace_usage WHERE workspace_id = ? AND day = ?), 0) AS ai_requests_today`,
+		workspaceID, config.StatusArchived, workspaceID, config.StatusArchived, workspaceID, workspaceID, today())
+	if err != nil {
+		return usage, fmt.Errorf("统计工作区用量失败: %w", err)
+	}
+	return usage, nil
+}
+
+// CheckQuestionQuota 新增 n 道题后是否超过题目数上限，返回当前题目数
+func (d *Database) CheckQuestionQuota(ws *Workspace, n int) (bool, int, error) {
+	var count int
+	if err := d.db.GetContext(d.ctx, &count, `SELECT COUNT(*) FROM questions WHERE workspace_id = ? AND status != ?`, ws.ID, config.StatusArchived); err != nil {
+		return false, 0, fmt.Errorf("统计题目数失败: %w", err)
+	}
+	limit := ws.Settings.MaxQuestions
+	return limit == 0 || count+n <= limit, count, nil
+}
+
+// ConsumeAIQuota 占用今天的 n 次AI出题调用，超过上限时不占用并返回 false 与已用次数
+func (d *Database) ConsumeAIQuota(ws *Workspace, n int) (bool, int, error) {
+	day := today()
+	limit := ws.Settings.DailyAIRequests
+	if _, err := d.db.ExecContext(d.ctx, `
+		INSERT OR IGNORE INTO workspace_usage (workspace_id, day) VALUES (?, ?)`, ws.ID, day); err != nil {
+		return false, 0, fmt.Errorf("记录AI用量失败: %w", err)
+	}
+	// 检查与占用在同一条语句中完成，并发请求不会超过上限
+	result, err := d.db.ExecContext(d.ctx, `
+		UPDATE workspace_usage SET ai_requests = ai_requests + ?
+		WHERE workspace_id = ? AND day = ? AND (? = 0 OR ai_requests + ? <= ?)`,
+		n, ws.ID, day, limit, n, limit)
+	if err != nil {
+		return false, 0, fmt.Errorf("记录AI用量失败: %w", err)
+	}
+	var used int
+	if err := d.db.GetContext(d.ctx, &used, `
+		SELECT ai_requests FROM workspace_usage WHERE workspace_id = ? AND day = ?`, ws.ID, day); err != nil {
+		return false, 0, fmt.Errorf("查询AI用量失败: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, used, nil
+}
+
+// ShareQuestions 将本工作区的题目共享到目标工作区（只读，修改会同步可见），返回共享的题目ID
+func (d *Database) ShareQuestions(sourceID, targetID int, ids []int) ([]int, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	owned, err := ownedQuestions(d, tx, sourceID, ids)
+	if err != nil || len(owned) == 0 {
+		return owned, err
+	}
+	now := time.Now().Format(timeLayout)
+	for _, id := range owned {
+		if _, err := tx.ExecContext(d.ctx, `
+			INSERT OR IGNORE INTO question_shares (question_id, workspace_id, shared_at) VALUES (?, ?, ?)`,
+			id, targetID, now); err != nil {
+			return nil, fmt.Errorf("共享题目失败: %w", err)
+		}
+	}
+	return owned, tx.Commit()
+}
+
+// UnshareQuestions 取消共享，返回取消的条数
+func (d *Database) UnshareQuestions(sourceID, targetID int, ids []int) (int64, error) {
+	query, args, err := sqlx.In(`
+		DELETE FROM question_shares
+		WHERE workspace_id = ? AND question_id IN (?)
+		  AND question_id IN (SELECT id FROM questions WHERE workspace_id = ?)`, targetID, ids, sourceID)
+	if err != nil {
+		return 0, err
+	}
+	result, err := d.db.ExecContext(d.ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("取消共享失败: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// CopyQuestions 将来源工作区可见的题目复制到目标工作区，返回新题目ID（与传入顺序一致，不可见的跳过）。
+// 复制的题目与原题相互独立，不保留多语言分组
+func (d *Database) CopyQuestions(sourceID, targetID int, ids []int) ([]int, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query, args, err := sqlx.In(`SELECT id FROM questions WHERE id IN (?) AND `+VisibleInWorkspace, ids, sourceID, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	var visible []int
+	if err := tx.SelectContext(d.ctx, &visible, query, args...); err != nil {
+		return nil, fmt.Errorf("查询题目失败: %w", err)
+	}
+	ok := make(map[int]bool, len(visible))
+	for _, id := range visible {
+		ok[id] = true
+	}
+
+	copied := make([]int, 0, len(visible))
+	for _, id := range ids {
+		if !ok[id] {
+			continue
+		}
+		delete(ok, id) // 重复的ID只复制一次
+		var newID int
+		err := tx.QueryRowContext(d.ctx, `
+			INSERT INTO questions (title, type, language, answers, rights, tags, source, status, created_at,
+				explanations, hint, reference, explanation_source, explanation_model, explanation_at, locale, workspace_id)
+			SELECT title, type, language, answers, rights, tags, source, status, datetime('now', 'localtime'),
+				explanations, hint, reference, explanation_source, explanation_model, explanation_at, locale, ?
+			FROM questions WHERE id = ?
+			RETURNING id`, targetID, id).Scan(&newID)
+		if err != nil {
+			return nil, fmt.Errorf("复制题目%d失败: %w", id, err)
+		}
+		copied = append(copied, newID)
+	}
+	if len(copied) == 0 {
+		return copied, nil
+	}
+	event := NewEvent(targetID, EventQuestionCreated, copied, map[string]interface{}{
+		"source":         "copy",
+		"from_workspace": sourceID,
+		"count":          len(copied),
+	})
+	if err := d.CommitWithEvent(tx, event); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// ownedQuestions 筛选出属于该工作区的题目ID（按ID升序）
+func ownedQuestions(d *Database, tx *sqlx.Tx, workspaceID int, ids []int) ([]int, error) {
+	query, args, err := sqlx.In(`SELECT id FROM questions WHERE id IN (?) AND workspace_id = ? ORDER BY id`, ids, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	owned := []int{}
+	if err := tx.SelectContext(d.ctx, &owned, query, args...); err != nil {
+		return nil, fmt.Errorf("查询题目失败: %w", err)
+	}
+	return owned, nil
+}
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
@@ -0,0 +1,205 @@
+package telemetry
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var registerOnce sync.Map
+
+// InstrumentDriver 注册一个包装了原驱动的数据库驱动并返回其名称，
+// 通过它执行的每条语句都会记录耗时，上下文中有span时同时创建子span
+func InstrumentDriver(name string) (string, error) {
+	wrapped := name + "-instrumented"
+	if _, loaded := registerOnce.LoadOrStore(wrapped, true); loaded {
+		return wrapped, nil
+	}
+
+	db, err := sql.Open(name, "")
+	if err != nil {
+		return "", err
+	}
+	parent := db.Driver()
+	db.Close()
+
+	sql.Register(wrapped, &instrumentedDriver{parent: parent})
+	return wrapped, nil
+}
+
+type instrumentedDriver struct {
+	parent driver.Driver
+}
+
+func (d *instrumentedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.parent.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn}, nil
+}
+
+type instrumentedConn struct {
+	driver.Conn
+}
+
+// Unwrap 返回原驱动的连接，用于调用驱动特有的功能（如SQLite在线备份）
+func (c *instrumentedConn) Unwrap() driver.Conn {
+	return c.Conn
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() // 驱动不支持BeginTx时回退
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	done := observeQuery(ctx, query)
+	result, err := e.ExecContext(ctx, query, args)
+	done(err)
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	done := observeQuery(ctx, query)
+	rows, err := q.QueryContext(ctx, query, args)
+	done(err)
+	return rows, err
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	done := observeQuery(ctx, s.query)
+	var result driver.Result
+	var err error
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = e.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(namedToValues(args))
+	}
+	done(err)
+	return result, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	done := observeQuery(ctx, s.query)
+	var rows driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedToValues(args))
+	}
+	done(err)
+	return rows, err
+}
+
+func namedToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+var tablePattern = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE|TABLE(?: IF NOT EXISTS)?)\s+([a-z_][a-z0-9_]*)`)
+
+// queryLabels 从SQL中提取语句类型与主表名，用作监控标签
+func queryLabels(query string) (operation, table string) {
+	fields := strings.Fields(query)
+	operation = "OTHER"
+	if len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	table = "-"
+	if m := tablePattern.FindStringSubmatch(query); m != nil {
+		table = strings.ToLower(m[1])
+	}
+	return operation, table
+}
+
+// observeQuery 开始计时，返回的函数在语句结束时调用
+func observeQuery(ctx context.Context, query string) func(error) {
+	start := time.Now()
+	operation, table := queryLabels(query)
+
+	var span trace.Span
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		_, span = tracer.Start(ctx, "db "+operation+" "+table,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "sqlite"),
+				attribute.String("db.operation", operation),
+				attribute.String("db.sql.table", table),
+				attribute.String("db.statement", truncate(strings.Join(strings.Fields(query), " "), 300)),
+			))
+	}
+
+	return func(err error) {
+		dbDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if span != nil {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
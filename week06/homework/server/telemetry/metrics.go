@@ -0,0 +1,201 @@
+package telemetry
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qs_http_requests_total",
+		Help: "HTTP请求数（按路由与状态码）",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qs_http_request_duration_seconds",
+		Help:    "HTTP请求耗时",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qs_grpc_requests_total",
+		Help: "gRPC调用数（按方法与状态码）",
+	}, []string{"method", "code"})
+
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qs_grpc_request_duration_seconds",
+		Help:    "gRPC调用耗时（流式调用为整个流的时长）",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	aiDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qs_ai_request_duration_seconds",
+		Help:    "AI调用耗时（含重试）",
+		Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+	}, []string{"provider", "operation", "outcome"})
+
+	aiRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qs_ai_retries_total",
+		Help: "AI调用重试次数",
+	}, []string{"provider", "operation"})
+
+	aiFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qs_ai_failures_total",
+		Help: "AI调用失败次数（reason: timeout/canceled/api_error/network/validation/config）",
+	}, []string{"provider", "operation", "reason"})
+
+	aiValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qs_ai_validation_failures_total",
+		Help: "AI返回内容未通过校验的次数（按原因）",
+	}, []string{"provider", "operation", "reason"})
+
+	aiCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qs_ai_cache_requests_total",
+		Help: "AI出题缓存查询次数（result: hit/coalesced/miss）",
+	}, []string{"provider", "result"})
+
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qs_webhook_deliveries_total",
+		Help: "Webhook投递次数（outcome: success/retry/failed）",
+	}, []string{"outcome"})
+
+	ltiPassbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qs_lti_score_passbacks_total",
+		Help: "LTI 成绩回传次数（outcome: success/retry/failed）",
+	}, []string{"outcome"})
+
+	backups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qs_backups_total",
+		Help: "数据库备份次数（kind: auto/manual/pre-restore，outcome: success/failed）",
+	}, []string{"kind", "outcome"})
+
+	backupLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "qs_backup_last_success_timestamp_seconds",
+		Help: "最近一次成功备份的时间（Unix秒），用于告警备份中断",
+	})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qs_db_query_duration_seconds",
+		Help:    "数据库语句耗时",
+		Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+	}, []string{"operation", "table"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		grpcRequests, grpcDuration,
+		aiDuration, aiRetries, aiFailures, aiValidationFailures, aiCache,
+		webhookDeliveries, ltiPassbacks,
+		backups, backupLastSuccess,
+		dbDuration,
+	)
+}
+
+// MetricsHandler Prometheus 抓取接口
+func MetricsHandler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// Middleware 为每个请求创建服务端span、在响应头返回 X-Trace-Id，并记录请求数与耗时
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", c.Request.Method),
+				attribute.String("http.route", route),
+			))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		if id := span.SpanContext().TraceID(); id.IsValid() {
+			c.Header("X-Trace-Id", id.String())
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveRPC 记录一次gRPC调用，code 为状态码名称（如 OK、NotFound）
+func ObserveRPC(method, code string, cost time.Duration) {
+	grpcRequests.WithLabelValues(method, code).Inc()
+	grpcDuration.WithLabelValues(method).Observe(cost.Seconds())
+}
+
+// ObserveAI 记录一次AI调用，reason 为空表示成功
+func ObserveAI(provider, operation string, cost time.Duration, reason string) {
+	outcome := "success"
+	if reason != "" {
+		outcome = "failure"
+		aiFailures.WithLabelValues(provider, operation, reason).Inc()
+	}
+	aiDuration.WithLabelValues(provider, operation, outcome).Observe(cost.Seconds())
+}
+
+// AIRetry 记录一次AI调用重试
+func AIRetry(provider, operation string) {
+	aiRetries.WithLabelValues(provider, operation).Inc()
+}
+
+// AIValidationFailure 记录AI返回内容的校验失败原因
+func AIValidationFailure(provider, operation, reason string) {
+	aiValidationFailures.WithLabelValues(provider, operation, reason).Inc()
+}
+
+// AICache 记录一次出题缓存查询结果
+func AICache(provider, result string) {
+	aiCache.WithLabelValues(provider, result).Inc()
+}
+
+// Backup 记录一次数据库备份结果
+func Backup(kind string, err error) {
+	if err != nil {
+		backups.WithLabelValues(kind, "failed").Inc()
+		return
+	}
+	backups.WithLabelValues(kind, "success").Inc()
+	backupLastSuccess.SetToCurrentTime()
+}
+
+// WebhookDelivery 记录一次Webhook投递结果，retry 表示失败后等待重试，failed 表示重试次数用尽
+func WebhookDelivery(outcome string) {
+	webhookDeliveries.WithLabelValues(outcome).Inc()
+}
+
+// LTIPassback 记录一次 LTI 成绩回传结果，取值同 WebhookDelivery
+func LTIPassback(outcome string) {
+	ltiPassbacks.WithLabelValues(outcome).Inc()
+}